@@ -0,0 +1,89 @@
+package bridge
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// emptyActivityID is the activity ID given to responses to requests which
+// lack one, unless the bridge has an ActivityIDGenerator.
+const emptyActivityID = "00000000-0000-0000-0000-000000000000"
+
+// activityIDField is the JSON field of a request's activity ID.
+const activityIDField = "ActivityId"
+
+// NewRandomActivityID returns a random (version 4) GUID. It may be used as a
+// Bridge's ActivityIDGenerator.
+func NewRandomActivityID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		logrus.Errorf("bridge: failed to generate an activity ID: %s", err)
+		return emptyActivityID
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// activityIDResponseWriter responds to a request with activityID in place of
+// an empty activity ID.
+type activityIDResponseWriter struct {
+	ResponseWriter
+	activityID string
+}
+
+func (w *activityIDResponseWriter) Error(activityID string, err error) {
+	if activityID == "" {
+		activityID = w.activityID
+	}
+	w.ResponseWriter.Error(activityID, err)
+}
+
+// assignActivityID gives a request which lacks an activity ID one from the
+// bridge's ActivityIDGenerator. The ID is added to the request's message, so
+// that the handler echoes it in its response, and used for error responses
+// to requests whose message cannot be parsed.
+func (b *Bridge) assignActivityID(next HandlerFunc) HandlerFunc {
+	return func(w ResponseWriter, r *Request) {
+		if activityIDOf(r) != "" {
+			next(w, r)
+			return
+		}
+		id := b.ActivityIDGenerator()
+		w = &activityIDResponseWriter{ResponseWriter: w, activityID: id}
+		if message, ok := withActivityID(r.Message, id); ok {
+			r = &Request{Header: r.Header, Message: message}
+		}
+		next(w, r)
+	}
+}
+
+// withActivityID returns message with its activity ID set to id. It returns
+// false if message is not a JSON object.
+func withActivityID(message []byte, id string) ([]byte, bool) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(message, &fields); err != nil || fields == nil {
+		return nil, false
+	}
+	// encoding/json matches field names case-insensitively, so remove any
+	// empty activity ID the host sent under a different case.
+	for name := range fields {
+		if strings.EqualFold(name, activityIDField) {
+			delete(fields, name)
+		}
+	}
+	idJSON, err := json.Marshal(id)
+	if err != nil {
+		return nil, false
+	}
+	fields[activityIDField] = idJSON
+	result, err := json.Marshal(fields)
+	if err != nil {
+		return nil, false
+	}
+	return result, true
+}
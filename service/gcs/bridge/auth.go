@@ -0,0 +1,28 @@
+package bridge
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+
+	"github.com/Microsoft/opengcs/service/gcs/gcserr"
+	"github.com/Microsoft/opengcs/service/gcs/prot"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// authenticate responds to a request which does not carry the bridge's
+// AuthToken with HrAccessDenied, rather than handling it. The tokens are
+// compared in constant time, so that the comparison does not reveal how much
+// of a guessed token is correct.
+func (b *Bridge) authenticate(next HandlerFunc) HandlerFunc {
+	token := []byte(b.AuthToken)
+	return func(w ResponseWriter, r *Request) {
+		var base prot.MessageBase
+		if err := json.Unmarshal(r.Message, &base); err != nil || subtle.ConstantTimeCompare([]byte(base.AuthToken), token) != 1 {
+			logrus.Warnf("bridge: rejecting unauthenticated request ID: 0x%x, Type: 0x%x", r.Header.ID, r.Header.Type)
+			w.Error(base.ActivityID, gcserr.WrapHresult(errors.New("bridge: the request does not carry a valid authentication token"), gcserr.HrAccessDenied))
+			return
+		}
+		next(w, r)
+	}
+}
@@ -3,12 +3,18 @@
 package bridge
 
 import (
-	"encoding/binary"
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
 	"strconv"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/Microsoft/opengcs/service/gcs/core"
 	"github.com/Microsoft/opengcs/service/gcs/gcserr"
@@ -73,6 +79,23 @@ func (mux *Mux) Handle(id prot.MessageIdentifier, handler Handler) {
 	mux.m[id] = handler
 }
 
+// register registers the handler for the given message id, returning an
+// error rather than overwriting if a handler is already registered for it.
+func (mux *Mux) register(id prot.MessageIdentifier, handler Handler) error {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+
+	if mux.m == nil {
+		mux.m = make(map[prot.MessageIdentifier]Handler)
+	}
+	if _, ok := mux.m[id]; ok {
+		return errors.Errorf("bridge: a handler is already registered for type: 0x%x", id)
+	}
+
+	mux.m[id] = handler
+	return nil
+}
+
 // HandleFunc registers the handler function for the given message id.
 func (mux *Mux) HandleFunc(id prot.MessageIdentifier, handler func(ResponseWriter, *Request)) {
 	if handler == nil {
@@ -121,7 +144,8 @@ type ResponseWriter interface {
 	Write(interface{})
 	// Error writes the provided error as a response to the message correlated
 	// with the activity ID passed. If the activity ID is the empty string it
-	// will be translated to an empty guid.
+	// will be translated to an empty guid, or to a generated ID if the bridge
+	// has an ActivityIDGenerator.
 	Error(string, error)
 }
 
@@ -131,8 +155,10 @@ type bridgeResponse struct {
 }
 
 type requestResponseWriter struct {
-	header      *prot.MessageHeader
-	respChan    chan bridgeResponse
+	header   *prot.MessageHeader
+	respChan chan bridgeResponse
+	// done, if set, is closed once the bridge has stopped sending responses.
+	done        <-chan struct{}
 	respWritten bool
 }
 
@@ -141,13 +167,17 @@ func (w *requestResponseWriter) Header() *prot.MessageHeader {
 }
 
 func (w *requestResponseWriter) Write(r interface{}) {
-	w.respChan <- bridgeResponse{header: w.header, response: r}
+	select {
+	case w.respChan <- bridgeResponse{header: w.header, response: r}:
+	case <-w.done:
+		logrus.Warnf("bridge: dropping response to request ID: 0x%x since the bridge has stopped", w.header.ID)
+	}
 	w.respWritten = true
 }
 
 func (w *requestResponseWriter) Error(activityID string, err error) {
 	if activityID == "" {
-		activityID = "00000000-0000-0000-0000-000000000000"
+		activityID = emptyActivityID
 	}
 
 	resp := &prot.MessageResponseBase{ActivityID: activityID}
@@ -179,15 +209,111 @@ type Bridge struct {
 	// ComputeSystemCreate) over.
 	commandConn transport.Connection
 
-	// responseChan is the response channel used for both request/response
-	// and publish notification workflows.
+	// responseChan is the response channel used for request/response
+	// workflows.
 	responseChan chan bridgeResponse
 
+	// notificationChan is the channel used for publish notification
+	// workflows. It holds up to NotificationBufferSize notifications.
+	notificationChan chan bridgeResponse
+
+	// done is closed when ListenAndServe returns, after which nothing more is
+	// read from responseChan or notificationChan.
+	done chan struct{}
+
 	// Core - TODO: Remove this and use the mux!
 	coreint core.Core
 
+	// mux is the registry of handlers used by RegisterHandler. It is the mux
+	// passed to AssignHandlers, or a new mux if RegisterHandler is called
+	// first.
+	mux *Mux
+
+	// middleware wraps every request the bridge dispatches, in the order it
+	// was added with Use.
+	middleware []Middleware
+
 	// testing hook to close the bridge ListenAndServe() method.
 	quitChan chan bool
+
+	// serveCtx is cancelled when ListenAndServe returns, which cancels the
+	// contexts of the requests still being handled.
+	serveCtx context.Context
+
+	// DiskPressurePollInterval is how often the scratch disk usage of a
+	// container with a low watermark configured is sampled. If zero, a
+	// default of 5 seconds is used.
+	DiskPressurePollInterval time.Duration
+
+	// RedactedFields lists the field name fragments whose values are masked
+	// when a malformed request is logged. If nil, DefaultRedactedFields is
+	// used.
+	RedactedFields []string
+
+	// IdleTimeout, if nonzero, is how long the utility VM must have no
+	// containers before an NtGcsIdle notification is published. If zero, the
+	// idle watchdog is disabled.
+	IdleTimeout time.Duration
+
+	// NotificationTimeout is how long PublishNotification waits for a
+	// notification to be accepted for sending before failing. If zero, a
+	// default of 30 seconds is used.
+	NotificationTimeout time.Duration
+
+	// NotificationBufferSize is how many notifications may be queued for
+	// sending before NotificationDropPolicy applies. If zero, notifications
+	// are not queued.
+	NotificationBufferSize int
+
+	// NotificationDropPolicy is what PublishNotification does when the
+	// notification queue is full.
+	NotificationDropPolicy NotificationDropPolicy
+
+	// NotificationRetryInterval, if nonzero, is how long the bridge waits
+	// before resending a notification which failed to send, doubling after
+	// each further failure up to maxNotificationRetryInterval. Later
+	// notifications stay queued behind it, so that none are lost while the
+	// host is briefly unavailable. If zero, failing to send a notification
+	// stops the bridge, as failing to send a response does. Retrying assumes
+	// that a failed write sent none of the message.
+	NotificationRetryInterval time.Duration
+
+	// pendingNotification is a notification which failed to send and is
+	// awaiting a retry. It is kept across calls to ListenAndServe, as is the
+	// notification queue, so that it is resent once the bridge serves again.
+	pendingNotification *bridgeResponse
+
+	// droppedNotifications counts the notifications dropped under
+	// NotificationDropOldest. It is accessed atomically.
+	droppedNotifications uint64
+
+	// OnIdle, if set, is called after each NtGcsIdle notification is
+	// published. It may be used, for example, to shut down the utility VM.
+	OnIdle func()
+
+	// idle is the idle watchdog, or nil if it is disabled.
+	idle *idleWatchdog
+
+	// checksumFrames is set to 1 once the host sends a message with
+	// prot.MessageFlagChecksum, after which every message the bridge sends
+	// is checksummed. It is accessed atomically.
+	checksumFrames int32
+
+	// AuthToken, if set, is a shared secret which every request must carry
+	// in its AuthToken field. Requests which do not are rejected with
+	// HrAccessDenied without being handled.
+	AuthToken string
+
+	// ActivityIDGenerator, if set, is called to give an activity ID to each
+	// request which lacks one, which is then used in the response. If nil,
+	// such requests are responded to with the empty GUID as their activity
+	// ID. NewRandomActivityID may be used to generate random GUIDs.
+	ActivityIDGenerator func() string
+
+	// LogRotator, if set, is called to rotate the GCS's log when the host
+	// sends a PtLogRotate request. If nil, such requests fail with
+	// HrNotImpl, as when logging to the console. LogFile.Rotate may be used.
+	LogRotator func() error
 }
 
 // AssignHandlers creates and assigns the appropriate bridge
@@ -195,15 +321,51 @@ type Bridge struct {
 // to `gcs` for handling.
 func (b *Bridge) AssignHandlers(mux *Mux, gcs core.Core) {
 	b.coreint = gcs
+	b.mux = mux
+	if b.Handler == nil {
+		b.Handler = mux
+	}
 	mux.HandleFunc(prot.ComputeSystemCreateV1, b.createContainer)
 	mux.HandleFunc(prot.ComputeSystemExecuteProcessV1, b.execProcess)
 	mux.HandleFunc(prot.ComputeSystemShutdownForcedV1, b.killContainer)
 	mux.HandleFunc(prot.ComputeSystemShutdownGracefulV1, b.shutdownContainer)
 	mux.HandleFunc(prot.ComputeSystemSignalProcessV1, b.signalProcess)
-	mux.HandleFunc(prot.ComputeSystemGetPropertiesV1, b.listProcesses)
+	mux.HandleFunc(prot.ComputeSystemGetPropertiesV1, b.getProperties)
 	mux.HandleFunc(prot.ComputeSystemWaitForProcessV1, b.waitOnProcess)
 	mux.HandleFunc(prot.ComputeSystemResizeConsoleV1, b.resizeConsole)
 	mux.HandleFunc(prot.ComputeSystemModifySettingsV1, b.modifySettings)
+	mux.HandleFunc(prot.ComputeSystemSyncV1, b.syncContainer)
+	mux.HandleFunc(prot.ComputeSystemCheckpointV1, b.checkpointContainer)
+	mux.HandleFunc(prot.ComputeSystemRestoreV1, b.restoreContainer)
+	mux.HandleFunc(prot.ComputeSystemGetInitOutputV1, b.getInitOutput)
+	mux.HandleFunc(prot.ComputeSystemEnumerateV1, b.listContainers)
+	mux.HandleFunc(prot.ComputeSystemGetStateV1, b.getContainerState)
+	mux.HandleFunc(prot.ComputeSystemAttachV1, b.attachProcess)
+	mux.HandleFunc(prot.ComputeSystemDeleteV1, b.deleteContainer)
+	mux.HandleFunc(prot.ComputeSystemWriteStdinV1, b.writeProcessStdin)
+	mux.HandleFunc(prot.ComputeSystemGetGuestInfoV1, b.getGuestInfo)
+	mux.HandleFunc(prot.ComputeSystemReadFileV1, b.readFile)
+	mux.HandleFunc(prot.ComputeSystemWriteFileV1, b.writeFile)
+	mux.HandleFunc(prot.ComputeSystemGetResourceUsageV1, b.getResourceUsage)
+	mux.HandleFunc(prot.ComputeSystemRestartInitV1, b.restartInit)
+}
+
+// RegisterHandler registers h to handle requests of the given message id,
+// alongside the built-in handlers registered by AssignHandlers. If the bridge
+// has no Handler, requests are dispatched through the registry. It is an error
+// to register a handler for an id which already has one, including the id of a
+// built-in handler.
+func (b *Bridge) RegisterHandler(id prot.MessageIdentifier, h HandlerFunc) error {
+	if h == nil {
+		return errors.New("bridge: nil handler func")
+	}
+	if b.mux == nil {
+		b.mux = NewBridgeMux()
+	}
+	if b.Handler == nil {
+		b.Handler = b.mux
+	}
+	return b.mux.register(id, h)
 }
 
 // ListenAndServe connects to the bridge transport, listens for
@@ -222,35 +384,70 @@ func (b *Bridge) ListenAndServe() (conerr error) {
 	requestChan := make(chan *Request)
 	requestErrChan := make(chan error)
 	b.responseChan = make(chan bridgeResponse)
+	if b.notificationChan == nil {
+		b.notificationChan = make(chan bridgeResponse, b.NotificationBufferSize)
+	}
+	b.done = make(chan struct{})
 	responseErrChan := make(chan error)
 	b.quitChan = make(chan bool)
-
-	defer close(requestChan)
-	defer close(requestErrChan)
-	defer close(b.responseChan)
-	defer close(responseErrChan)
+	var cancel context.CancelFunc
+	b.serveCtx, cancel = context.WithCancel(context.Background())
+
+	// The request, response and error channels are never closed, since the
+	// goroutines sending on them may still be running. Closing done instead
+	// stops those goroutines and makes later sends fail, and cancelling
+	// serveCtx cancels the requests being handled.
+	defer close(b.done)
+	defer cancel()
 	defer close(b.quitChan)
+	done := b.done
+
+	b.startIdleWatchdog()
+	defer func() {
+		if b.idle != nil {
+			b.idle.stop()
+		}
+	}()
 
 	// Receive bridge requests and schedule them to be processed.
 	go func() {
 		for {
-			header := &prot.MessageHeader{}
-			if err := binary.Read(b.commandConn, binary.LittleEndian, header); err != nil {
-				requestErrChan <- errors.Wrap(err, "bridge: failed reading message header")
-				continue
+			req, checksummed, err := readRequest(b.commandConn)
+			if checksummed {
+				atomic.StoreInt32(&b.checksumFrames, 1)
 			}
-			message := make([]byte, header.Size-prot.MessageHeaderSize)
-			if _, err := io.ReadFull(b.commandConn, message); err != nil {
-				requestErrChan <- errors.Wrap(err, "bridge: failed reading message payload")
+			if corrupt, ok := err.(*corruptFrameError); ok {
+				logrus.Errorf("bridge: rejecting message ID 0x%x: %s", corrupt.header.ID, err)
+				b.rejectCorruptFrame(corrupt.header, err)
 				continue
 			}
-			logrus.Infof("bridge: read message '%s'\n", message)
-			requestChan <- &Request{header, message}
+			if err != nil {
+				if isClosedConnection(err) {
+					logrus.Warnf("bridge: the connection to the host was closed: %s", err)
+				}
+				select {
+				case requestErrChan <- err:
+				case <-done:
+				}
+				return
+			}
+			logrus.Infof("bridge: read message '%s'\n", b.redact(req.Message))
+			select {
+			case requestChan <- req:
+			case <-done:
+				return
+			}
 		}
 	}()
 	// Process each bridge request async and create the response writer.
 	go func() {
-		for req := range requestChan {
+		for {
+			var req *Request
+			select {
+			case req = <-requestChan:
+			case <-done:
+				return
+			}
 			go func(r *Request) {
 				wr := &requestResponseWriter{
 					header: &prot.MessageHeader{
@@ -258,8 +455,9 @@ func (b *Bridge) ListenAndServe() (conerr error) {
 						ID:   r.Header.ID,
 					},
 					respChan: b.responseChan,
+					done:     b.done,
 				}
-				b.Handler.ServeMsg(wr, r)
+				b.dispatch(wr, r)
 				if !wr.respWritten {
 					logrus.Errorf("bridge: request: ID: 0x%x, Type: %d failed to write a response.\n", r.Header.ID, r.Header.Type)
 				}
@@ -267,26 +465,7 @@ func (b *Bridge) ListenAndServe() (conerr error) {
 		}
 	}()
 	// Process each bridge response sync. This channel is for request/response and publish workflows.
-	go func() {
-		for resp := range b.responseChan {
-			responseBytes, err := json.Marshal(resp.response)
-			if err != nil {
-				responseErrChan <- errors.Wrapf(err, "bridge: failed to marshal JSON for response \"%v\"", resp.response)
-				continue
-			}
-			resp.header.Size = uint32(len(responseBytes) + prot.MessageHeaderSize)
-			if err := binary.Write(b.commandConn, binary.LittleEndian, resp.header); err != nil {
-				responseErrChan <- errors.Wrap(err, "bridge: failed writing message header")
-				continue
-			}
-
-			if _, err := b.commandConn.Write(responseBytes); err != nil {
-				responseErrChan <- errors.Wrap(err, "bridge: failed writing message payload")
-				continue
-			}
-			logrus.Infof("bridge: response sent: '%s' to HCS\n", responseBytes)
-		}
-	}()
+	go b.sendResponses(b.commandConn, responseErrChan)
 	// If we get any errors. We return from Listen and shutdown the bridge connection.
 	select {
 	case conerr = <-requestErrChan:
@@ -299,11 +478,129 @@ func (b *Bridge) ListenAndServe() (conerr error) {
 	return conerr
 }
 
-// PublishNotification writes a specific notification to the bridge.
-func (b *Bridge) PublishNotification(n *prot.ContainerNotification) {
+// maxNotificationRetryInterval is the longest the bridge waits between
+// attempts to resend a notification.
+const maxNotificationRetryInterval = 30 * time.Second
+
+// sendResponses writes each response and notification to w in turn until the
+// bridge stops or a write fails, in which case the error is sent to errs. A
+// notification which fails to send is instead retried with exponential
+// backoff if b.NotificationRetryInterval is set, unless the connection has
+// been closed.
+func (b *Bridge) sendResponses(w io.Writer, errs chan<- error) {
+	done := b.done
+	backoff := b.NotificationRetryInterval
+	var retry *time.Timer
+	var retryChan <-chan time.Time
+	if b.pendingNotification != nil {
+		retry = time.NewTimer(0)
+		retryChan = retry.C
+	}
+	for {
+		// Hold back the queued notifications while one is awaiting a retry,
+		// so that they are sent in order.
+		notificationChan := b.notificationChan
+		if b.pendingNotification != nil {
+			notificationChan = nil
+		}
+		var resp bridgeResponse
+		select {
+		case resp = <-b.responseChan:
+		case resp = <-notificationChan:
+		case <-retryChan:
+			resp = *b.pendingNotification
+			b.pendingNotification = nil
+			retryChan = nil
+		case <-done:
+			if retry != nil {
+				retry.Stop()
+			}
+			return
+		}
+		isNotification := resp.header.Type == prot.ComputeSystemNotificationV1
+		checksum := atomic.LoadInt32(&b.checksumFrames) != 0
+		responseBytes, err := writeResponse(w, resp, checksum)
+		if err != nil {
+			if isClosedConnection(err) {
+				logrus.Warnf("bridge: the connection to the host was closed: %s", err)
+				if isNotification && b.NotificationRetryInterval != 0 {
+					// Resend the notification once the bridge serves again.
+					b.pendingNotification = &resp
+				}
+			} else if isNotification && b.NotificationRetryInterval != 0 {
+				logrus.Warnf("bridge: failed to send notification, retrying in %s: %s", backoff, err)
+				b.pendingNotification = &resp
+				retry = time.NewTimer(backoff)
+				retryChan = retry.C
+				if backoff *= 2; backoff > maxNotificationRetryInterval {
+					backoff = maxNotificationRetryInterval
+				}
+				continue
+			}
+			select {
+			case errs <- err:
+			case <-done:
+			}
+			if retry != nil {
+				retry.Stop()
+			}
+			return
+		}
+		if isNotification {
+			backoff = b.NotificationRetryInterval
+		}
+		logrus.Infof("bridge: response sent: '%s' to HCS\n", responseBytes)
+	}
+}
+
+// rejectCorruptFrame responds to the message with the given header, whose
+// checksum did not match its body, with an error.
+func (b *Bridge) rejectCorruptFrame(header *prot.MessageHeader, err error) {
+	w := &requestResponseWriter{
+		header: &prot.MessageHeader{
+			Type: prot.GetResponseIdentifier(header.Type),
+			ID:   header.ID,
+		},
+		respChan: b.responseChan,
+		done:     b.done,
+	}
+	w.Error("", gcserr.WrapHresult(err, gcserr.HrInvalidArg))
+}
+
+// defaultNotificationTimeout is how long PublishNotification waits when
+// Bridge.NotificationTimeout is zero.
+const defaultNotificationTimeout = 30 * time.Second
+
+// NotificationDropPolicy describes what PublishNotification does when the
+// notification queue is full.
+type NotificationDropPolicy int
+
+const (
+	// NotificationBlock waits for room in the queue, for up to
+	// Bridge.NotificationTimeout.
+	NotificationBlock NotificationDropPolicy = iota
+	// NotificationDropOldest drops the oldest queued notification to make
+	// room for the new one. If there is no queue, the new notification is
+	// dropped instead.
+	NotificationDropOldest
+)
+
+// DroppedNotifications returns how many notifications have been dropped
+// because the notification queue was full.
+func (b *Bridge) DroppedNotifications() uint64 {
+	return atomic.LoadUint64(&b.droppedNotifications)
+}
+
+// PublishNotification writes a specific notification to the bridge. It returns
+// an error rather than blocking if the bridge is not serving, has stopped, or
+// does not accept the notification within b.NotificationTimeout.
+func (b *Bridge) PublishNotification(n *prot.ContainerNotification) error {
 	if n == nil {
 		panic("bridge: cannot publish nil notification")
 	}
+	if b.notificationChan == nil {
+		return errors.New("bridge: cannot publish notification since the bridge is not serving")
+	}
 
 	resp := bridgeResponse{
 		header: &prot.MessageHeader{
@@ -312,13 +609,65 @@ func (b *Bridge) PublishNotification(n *prot.ContainerNotification) {
 		},
 		response: n,
 	}
-	b.responseChan <- resp
+	if b.NotificationDropPolicy == NotificationDropOldest {
+		b.publishDroppingOldest(resp)
+		return nil
+	}
+	timeout := b.NotificationTimeout
+	if timeout == 0 {
+		timeout = defaultNotificationTimeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case b.notificationChan <- resp:
+		return nil
+	case <-b.done:
+		return errors.New("bridge: cannot publish notification since the bridge has stopped")
+	case <-timer.C:
+		return errors.Errorf("bridge: timed out after %s publishing notification", timeout)
+	}
+}
+
+// publishDroppingOldest queues resp without blocking, dropping the oldest
+// queued notification while the queue is full.
+func (b *Bridge) publishDroppingOldest(resp bridgeResponse) {
+	for {
+		select {
+		case b.notificationChan <- resp:
+			return
+		default:
+		}
+		if cap(b.notificationChan) == 0 {
+			b.countDroppedNotification(resp)
+			return
+		}
+		select {
+		case dropped := <-b.notificationChan:
+			b.countDroppedNotification(dropped)
+		default:
+			// The response loop made room, so try again.
+		}
+	}
+}
+
+// countDroppedNotification records that the notification in resp was dropped.
+func (b *Bridge) countDroppedNotification(resp bridgeResponse) {
+	count := atomic.AddUint64(&b.droppedNotifications, 1)
+	n := resp.response.(*prot.ContainerNotification)
+	logrus.Warnf("bridge: notification queue is full, dropped %s notification for container %s (%d dropped in total)", n.Type, n.ContainerID, count)
 }
 
 func (b *Bridge) createContainer(w ResponseWriter, r *Request) {
 	var request prot.ContainerCreate
 	if err := commonutils.UnmarshalJSONWithHresult(r.Message, &request); err != nil {
-		w.Error("", errors.Wrapf(err, "failed to unmarshal JSON in message \"%s\"", r.Message))
+		b.logMalformedRequest(r, err)
+		w.Error("", errors.Wrapf(err, "failed to unmarshal JSON in message \"%s\"", b.redact(r.Message)))
+		return
+	}
+
+	if err := validateContainerID(request.ContainerID); err != nil {
+		w.Error(request.ActivityID, err)
 		return
 	}
 
@@ -326,13 +675,13 @@ func (b *Bridge) createContainer(w ResponseWriter, r *Request) {
 	// CreateContainerInfo struct.
 	var settings prot.VMHostedContainerSettings
 	if err := commonutils.UnmarshalJSONWithHresult([]byte(request.ContainerConfig), &settings); err != nil {
-		w.Error(request.ActivityID, errors.Wrapf(err, "failed to unmarshal JSON for ContainerConfig \"%s\"", request.ContainerConfig))
+		b.logMalformedRequest(r, err)
+		w.Error(request.ActivityID, errors.Wrapf(err, "failed to unmarshal JSON for ContainerConfig \"%s\"", b.redact([]byte(request.ContainerConfig))))
 		return
 	}
 
-	id := request.ContainerID
-	if err := b.coreint.CreateContainer(id, settings); err != nil {
-		w.Error(request.ActivityID, err)
+	if err := validateLogging(settings.LogLevel, settings.LogFormat); err != nil {
+		w.Error(request.ActivityID, gcserr.WrapHresult(err, gcserr.HrInvalidArg))
 		return
 	}
 
@@ -342,10 +691,53 @@ func (b *Bridge) createContainer(w ResponseWriter, r *Request) {
 		},
 		SelectedProtocolVersion: prot.PvV3,
 	}
+
+	id := request.ContainerID
+	if request.Validate {
+		if err := b.coreint.ValidateContainer(id, settings); err != nil {
+			w.Error(request.ActivityID, err)
+			return
+		}
+		w.Write(response)
+		return
+	}
+
+	ctx, cancel := b.requestContext(request.MessageBase)
+	defer cancel()
+	if err := b.coreint.CreateContainer(ctx, id, settings); err != nil {
+		w.Error(request.ActivityID, deadlineError(err))
+		return
+	}
+
+	// The container has been created, so a failure to apply its logging
+	// settings does not fail the request.
+	if err := ConfigureLogging(settings.LogLevel, settings.LogFormat); err != nil {
+		logrus.Errorf("failed to apply the logging settings of container %s: %s", id, err)
+	}
+
 	w.Write(response)
 
+	if b.idle != nil {
+		b.idle.containerCreated(id)
+	}
+
+	done := make(chan struct{})
+	if settings.ScratchLowWatermarkBytes > 0 {
+		go b.monitorScratchDisk(id, request.ActivityID, settings.ScratchLowWatermarkBytes, done)
+	}
+
 	go func() {
-		exitCode, err := b.coreint.WaitContainer(id)
+		exitStatus, err := b.coreint.WaitContainer(id)
+		close(done)
+		if b.idle != nil {
+			b.idle.containerExited(id)
+		}
+		if errors.Cause(err) == context.Canceled {
+			// The container was deleted without being started, so the host
+			// does not expect an exit notification.
+			logrus.Infof("container %s was deleted before it exited", id)
+			return
+		}
 		if err != nil {
 			logrus.Error(err)
 			return
@@ -357,27 +749,43 @@ func (b *Bridge) createContainer(w ResponseWriter, r *Request) {
 			},
 			Type:       prot.NtUnexpectedExit, // TODO: Support different exit types.
 			Operation:  prot.AoNone,
-			Result:     int32(exitCode),
+			Result:     int32(exitStatus.ExitCode),
 			ResultInfo: "",
+			Signal:     int32(exitStatus.Signal),
+		}
+		if err := b.PublishNotification(notification); err != nil {
+			logrus.Errorf("failed to publish exit notification for container %s: %s", id, err)
 		}
-		b.PublishNotification(notification)
 	}()
 }
 
 func (b *Bridge) execProcess(w ResponseWriter, r *Request) {
 	var request prot.ContainerExecuteProcess
 	if err := commonutils.UnmarshalJSONWithHresult(r.Message, &request); err != nil {
-		w.Error("", errors.Wrapf(err, "failed to unmarshal JSON for message \"%s\"", r.Message))
+		b.logMalformedRequest(r, err)
+		w.Error("", errors.Wrapf(err, "failed to unmarshal JSON for message \"%s\"", b.redact(r.Message)))
 		return
 	}
 
 	// The request contains a JSON string field which is equivalent to an
 	// ExecuteProcessInfo struct.
-	var params prot.ProcessParameters
-	if err := commonutils.UnmarshalJSONWithHresult([]byte(request.Settings.ProcessParameters), &params); err != nil {
-		w.Error(request.ActivityID, errors.Wrapf(err, "failed to unmarshal JSON for ProcessParameters \"%s\"", request.Settings.ProcessParameters))
+	params, err := unmarshalProcessParameters(request.Settings.ProcessParameters)
+	if err != nil {
+		b.logMalformedRequest(r, err)
+		w.Error(request.ActivityID, errors.Wrapf(err, "failed to unmarshal JSON for ProcessParameters \"%s\"", b.redact([]byte(request.Settings.ProcessParameters))))
+		return
+	}
+	if err := validateProcessParameters(params); err != nil {
+		b.logMalformedRequest(r, err)
+		w.Error(request.ActivityID, err)
 		return
 	}
+	if !params.IsExternal {
+		if err := validateContainerID(request.ContainerID); err != nil {
+			w.Error(request.ActivityID, err)
+			return
+		}
+	}
 
 	stdioSet, err := connectStdio(b.Transport, params, request.Settings.VsockStdioRelaySettings)
 	if err != nil {
@@ -403,7 +811,37 @@ func (b *Bridge) execProcess(w ResponseWriter, r *Request) {
 		},
 		ProcessID: uint32(pid),
 	}
+	if created, err := b.coreint.GetProcessCreatedTime(pid); err != nil {
+		logrus.Warnf("failed to get the creation time of process %d: %s", pid, err)
+	} else {
+		response.CreatedTime = created.UnixNano()
+	}
 	w.Write(response)
+
+	// External processes are not tied to a container, so there is no
+	// container exit notification to tell the HCS when they exit.
+	if params.IsExternal {
+		go func() {
+			exitCode, err := b.coreint.WaitProcess(pid)
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			notification := &prot.ContainerNotification{
+				MessageBase: &prot.MessageBase{
+					ContainerID: request.ContainerID,
+					ActivityID:  request.ActivityID,
+				},
+				Type:      prot.NtProcessExit,
+				Operation: prot.AoNone,
+				Result:    int32(exitCode),
+				ProcessID: uint32(pid),
+			}
+			if err := b.PublishNotification(notification); err != nil {
+				logrus.Errorf("failed to publish exit notification for process %d: %s", pid, err)
+			}
+		}()
+	}
 }
 
 func (b *Bridge) killContainer(w ResponseWriter, r *Request) {
@@ -411,19 +849,59 @@ func (b *Bridge) killContainer(w ResponseWriter, r *Request) {
 }
 
 func (b *Bridge) shutdownContainer(w ResponseWriter, r *Request) {
-	b.signalContainer(w, r, oslayer.SIGTERM)
+	var request prot.ContainerShutdown
+	if err := commonutils.UnmarshalJSONWithHresult(r.Message, &request); err != nil {
+		b.logMalformedRequest(r, err)
+		w.Error("", errors.Wrapf(err, "failed to unmarshal JSON for message \"%s\"", b.redact(r.Message)))
+		return
+	}
+
+	if err := validateContainerID(request.ContainerID); err != nil {
+		w.Error(request.ActivityID, err)
+		return
+	}
+
+	signal := oslayer.SIGTERM
+	if request.Signal != "" {
+		var err error
+		if signal, err = oslayer.ParseSignal(request.Signal); err != nil {
+			w.Error(request.ActivityID, gcserr.WrapHresult(err, gcserr.HrInvalidArg))
+			return
+		}
+	}
+
+	gracePeriod := time.Duration(request.GracePeriodMs) * time.Millisecond
+	if err := b.coreint.ShutdownContainer(request.ContainerID, signal, gracePeriod); err != nil {
+		w.Error(request.ActivityID, err)
+		return
+	}
+
+	response := &prot.MessageResponseBase{
+		ActivityID: request.ActivityID,
+	}
+	w.Write(response)
 }
 
 // signalContainer is not a handler func. This is because the actual signal is
 // implied based on the message type.
 func (b *Bridge) signalContainer(w ResponseWriter, r *Request, signal oslayer.Signal) {
-	var request prot.MessageBase
+	var request prot.ContainerKill
 	if err := commonutils.UnmarshalJSONWithHresult(r.Message, &request); err != nil {
-		w.Error("", errors.Wrapf(err, "failed to unmarshal JSON for message \"%s\"", r.Message))
+		b.logMalformedRequest(r, err)
+		w.Error("", errors.Wrapf(err, "failed to unmarshal JSON for message \"%s\"", b.redact(r.Message)))
+		return
+	}
+
+	if err := validateContainerID(request.ContainerID); err != nil {
+		w.Error(request.ActivityID, err)
 		return
 	}
 
-	if err := b.coreint.SignalContainer(request.ContainerID, signal); err != nil {
+	signalFunc := b.coreint.SignalContainer
+	if request.KillAll {
+		signalFunc = b.coreint.SignalContainerProcesses
+	}
+	if err := signalFunc(request.ContainerID, signal); err != nil {
 		w.Error(request.ActivityID, err)
 		return
 	}
@@ -437,10 +915,20 @@ func (b *Bridge) signalContainer(w ResponseWriter, r *Request, signal oslayer.Si
 func (b *Bridge) signalProcess(w ResponseWriter, r *Request) {
 	var request prot.ContainerSignalProcess
 	if err := commonutils.UnmarshalJSONWithHresult(r.Message, &request); err != nil {
-		w.Error("", errors.Wrapf(err, "failed to unmarshal JSON for message \"%s\"", r.Message))
+		b.logMalformedRequest(r, err)
+		w.Error("", errors.Wrapf(err, "failed to unmarshal JSON for message \"%s\"", b.redact(r.Message)))
 		return
 	}
 
+	if request.Options.Signal == 0 && request.Options.SignalName != "" {
+		signal, err := oslayer.ParseSignal(request.Options.SignalName)
+		if err != nil {
+			w.Error(request.ActivityID, gcserr.WrapHresult(err, gcserr.HrInvalidArg))
+			return
+		}
+		request.Options.Signal = int32(signal)
+	}
+
 	if err := b.coreint.SignalProcess(int(request.ProcessID), request.Options); err != nil {
 		w.Error(request.ActivityID, err)
 		return
@@ -452,10 +940,120 @@ func (b *Bridge) signalProcess(w ResponseWriter, r *Request) {
 	w.Write(response)
 }
 
+// getProperties responds with the properties whose types are listed in the
+// request's query, as a prot.ContainerProperties. Unsupported property types
+// are ignored. If the query lists no property types, it responds with the
+// container's process list instead.
+func (b *Bridge) getProperties(w ResponseWriter, r *Request) {
+	var request prot.ContainerGetProperties
+	if err := commonutils.UnmarshalJSONWithHresult(r.Message, &request); err != nil {
+		b.logMalformedRequest(r, err)
+		w.Error("", errors.Wrapf(err, "failed to unmarshal JSON for message \"%s\"", b.redact(r.Message)))
+		return
+	}
+
+	if err := validateContainerID(request.ContainerID); err != nil {
+		w.Error(request.ActivityID, err)
+		return
+	}
+	var query prot.ContainerPropertiesQuery
+	if request.Query != "" {
+		if err := commonutils.UnmarshalJSONWithHresult([]byte(request.Query), &query); err != nil {
+			w.Error(request.ActivityID, errors.Wrapf(err, "failed to unmarshal properties query \"%s\"", request.Query))
+			return
+		}
+	}
+	if len(query.PropertyTypes) == 0 {
+		b.listProcesses(w, r)
+		return
+	}
+
+	id := request.ContainerID
+	properties := make(prot.ContainerProperties)
+	for _, propertyType := range query.PropertyTypes {
+		switch propertyType {
+		case prot.PtProcessList:
+			processes, err := b.coreint.ListProcesses(id)
+			if err != nil {
+				w.Error(request.ActivityID, err)
+				return
+			}
+			properties[propertyType] = processes
+		case prot.PtContainerMetadata:
+			metadata, err := b.coreint.GetContainerMetadata(id)
+			if err != nil {
+				w.Error(request.ActivityID, err)
+				return
+			}
+			properties[propertyType] = metadata
+		case prot.PtMounts:
+			mounts, err := b.coreint.GetMounts(id)
+			if err != nil {
+				w.Error(request.ActivityID, err)
+				return
+			}
+			properties[propertyType] = mounts
+		case prot.PtStartTimings:
+			timings, err := b.coreint.GetStartTimings(id)
+			if err != nil {
+				w.Error(request.ActivityID, err)
+				return
+			}
+			properties[propertyType] = timings
+		case prot.PtNetworkStatistics:
+			stats, err := b.coreint.GetNetworkStats(id)
+			if err != nil {
+				w.Error(request.ActivityID, err)
+				return
+			}
+			properties[propertyType] = stats
+		case prot.PtTimeOffset:
+			offset, err := b.coreint.GetTimeOffset(id)
+			if err != nil {
+				w.Error(request.ActivityID, err)
+				return
+			}
+			properties[propertyType] = offset
+		case prot.PtOpenFileDescriptors:
+			processes, err := b.coreint.ListProcesses(id)
+			if err != nil {
+				w.Error(request.ActivityID, err)
+				return
+			}
+			var fds prot.ContainerOpenFileDescriptors
+			for _, process := range processes {
+				if process.OpenFileDescriptors == nil {
+					fds.UncountedProcesses++
+					continue
+				}
+				fds.Count += *process.OpenFileDescriptors
+			}
+			properties[propertyType] = fds
+		default:
+			logrus.Warnf("bridge: ignoring unsupported property type \"%s\" queried for container %s", propertyType, id)
+		}
+	}
+
+	propertiesJSON, err := json.Marshal(properties)
+	if err != nil {
+		w.Error(request.ActivityID, errors.Wrapf(err, "failed to marshal properties into JSON: %v", properties))
+		return
+	}
+
+	response := &prot.ContainerGetPropertiesResponse{
+		MessageResponseBase: &prot.MessageResponseBase{
+			ActivityID: request.ActivityID,
+		},
+		Properties: string(propertiesJSON),
+	}
+	w.Write(response)
+}
+
 func (b *Bridge) listProcesses(w ResponseWriter, r *Request) {
 	var request prot.ContainerGetProperties
 	if err := commonutils.UnmarshalJSONWithHresult(r.Message, &request); err != nil {
-		w.Error("", errors.Wrapf(err, "failed to unmarshal JSON for message \"%s\"", r.Message))
+		b.logMalformedRequest(r, err)
+		w.Error("", errors.Wrapf(err, "failed to unmarshal JSON for message \"%s\"", b.redact(r.Message)))
 		return
 	}
 	id := request.ContainerID
@@ -484,7 +1082,8 @@ func (b *Bridge) listProcesses(w ResponseWriter, r *Request) {
 func (b *Bridge) waitOnProcess(w ResponseWriter, r *Request) {
 	var request prot.ContainerWaitForProcess
 	if err := commonutils.UnmarshalJSONWithHresult(r.Message, &request); err != nil {
-		w.Error("", errors.Wrapf(err, "failed to unmarshal JSON for message \"%s\"", r.Message))
+		b.logMalformedRequest(r, err)
+		w.Error("", errors.Wrapf(err, "failed to unmarshal JSON for message \"%s\"", b.redact(r.Message)))
 		return
 	}
 
@@ -506,7 +1105,8 @@ func (b *Bridge) waitOnProcess(w ResponseWriter, r *Request) {
 func (b *Bridge) resizeConsole(w ResponseWriter, r *Request) {
 	var request prot.ContainerResizeConsole
 	if err := commonutils.UnmarshalJSONWithHresult(r.Message, &request); err != nil {
-		w.Error("", errors.Wrapf(err, "failed to unmarshal JSON for message \"%s\"", r.Message))
+		b.logMalformedRequest(r, err)
+		w.Error("", errors.Wrapf(err, "failed to unmarshal JSON for message \"%s\"", b.redact(r.Message)))
 		return
 	}
 
@@ -524,15 +1124,32 @@ func (b *Bridge) resizeConsole(w ResponseWriter, r *Request) {
 func (b *Bridge) modifySettings(w ResponseWriter, r *Request) {
 	request, err := prot.UnmarshalContainerModifySettings(r.Message)
 	if err != nil {
-		w.Error("", errors.Wrapf(err, "failed to unmarshal JSON for message \"%s\"", r.Message))
+		b.logMalformedRequest(r, err)
+		w.Error("", errors.Wrapf(err, "failed to unmarshal JSON for message \"%s\"", b.redact(r.Message)))
+		return
+	}
+
+	if request.Request.ResourceType == prot.PtLogRotate {
+		if err := b.rotateLog(request.Request); err != nil {
+			w.Error(request.ActivityID, err)
+			return
+		}
+		w.Write(&prot.MessageResponseBase{ActivityID: request.ActivityID})
 		return
 	}
 
-	if err := b.coreint.ModifySettings(request.ContainerID, request.Request); err != nil {
+	if err := validateContainerID(request.ContainerID); err != nil {
 		w.Error(request.ActivityID, err)
 		return
 	}
 
+	ctx, cancel := b.requestContext(request.MessageBase)
+	defer cancel()
+	if err := b.coreint.ModifySettings(ctx, request.ContainerID, request.Request); err != nil {
+		w.Error(request.ActivityID, deadlineError(err))
+		return
+	}
+
 	response := &prot.MessageResponseBase{
 		ActivityID: request.ActivityID,
 	}
@@ -577,3 +1194,502 @@ func setErrorForResponseBase(response *prot.MessageResponseBase, errForResponse
 	}
 	response.ErrorRecords = append(response.ErrorRecords, newRecord)
 }
+
+func (b *Bridge) syncContainer(w ResponseWriter, r *Request) {
+	var request prot.ContainerSync
+	if err := commonutils.UnmarshalJSONWithHresult(r.Message, &request); err != nil {
+		b.logMalformedRequest(r, err)
+		w.Error("", errors.Wrapf(err, "failed to unmarshal JSON for message \"%s\"", b.redact(r.Message)))
+		return
+	}
+
+	if err := validateContainerID(request.ContainerID); err != nil {
+		w.Error(request.ActivityID, err)
+		return
+	}
+
+	timeout := time.Duration(request.TimeoutInMs) * time.Millisecond
+	if err := b.coreint.SyncContainer(request.ContainerID, request.Freeze, timeout); err != nil {
+		w.Error(request.ActivityID, err)
+		return
+	}
+
+	response := &prot.MessageResponseBase{
+		ActivityID: request.ActivityID,
+	}
+	w.Write(response)
+}
+
+func (b *Bridge) checkpointContainer(w ResponseWriter, r *Request) {
+	var request prot.ContainerCheckpoint
+	if err := commonutils.UnmarshalJSONWithHresult(r.Message, &request); err != nil {
+		b.logMalformedRequest(r, err)
+		w.Error("", errors.Wrapf(err, "failed to unmarshal JSON for message \"%s\"", b.redact(r.Message)))
+		return
+	}
+
+	if err := validateContainerID(request.ContainerID); err != nil {
+		w.Error(request.ActivityID, err)
+		return
+	}
+
+	if err := b.coreint.CheckpointContainer(request.ContainerID, request.Options); err != nil {
+		w.Error(request.ActivityID, err)
+		return
+	}
+
+	response := &prot.MessageResponseBase{
+		ActivityID: request.ActivityID,
+	}
+	w.Write(response)
+}
+
+func (b *Bridge) restoreContainer(w ResponseWriter, r *Request) {
+	var request prot.ContainerRestore
+	if err := commonutils.UnmarshalJSONWithHresult(r.Message, &request); err != nil {
+		b.logMalformedRequest(r, err)
+		w.Error("", errors.Wrapf(err, "failed to unmarshal JSON for message \"%s\"", b.redact(r.Message)))
+		return
+	}
+
+	if err := validateContainerID(request.ContainerID); err != nil {
+		w.Error(request.ActivityID, err)
+		return
+	}
+
+	if err := b.coreint.RestoreContainer(request.ContainerID, request.OCISpecification, request.Options); err != nil {
+		w.Error(request.ActivityID, err)
+		return
+	}
+
+	response := &prot.MessageResponseBase{
+		ActivityID: request.ActivityID,
+	}
+	w.Write(response)
+}
+
+func (b *Bridge) getInitOutput(w ResponseWriter, r *Request) {
+	var request prot.ContainerGetProperties
+	if err := commonutils.UnmarshalJSONWithHresult(r.Message, &request); err != nil {
+		b.logMalformedRequest(r, err)
+		w.Error("", errors.Wrapf(err, "failed to unmarshal JSON for message \"%s\"", b.redact(r.Message)))
+		return
+	}
+
+	if err := validateContainerID(request.ContainerID); err != nil {
+		w.Error(request.ActivityID, err)
+		return
+	}
+
+	output, err := b.coreint.GetInitOutput(request.ContainerID)
+	if err != nil {
+		w.Error(request.ActivityID, err)
+		return
+	}
+
+	response := &prot.ContainerGetInitOutputResponse{
+		MessageResponseBase: &prot.MessageResponseBase{
+			ActivityID: request.ActivityID,
+		},
+		Output: output,
+	}
+	w.Write(response)
+}
+
+// listContainers responds with every container known to the GCS. The request
+// applies to the whole utility VM, so any ContainerID in it is ignored.
+func (b *Bridge) listContainers(w ResponseWriter, r *Request) {
+	var request prot.MessageBase
+	if err := commonutils.UnmarshalJSONWithHresult(r.Message, &request); err != nil {
+		b.logMalformedRequest(r, err)
+		w.Error("", errors.Wrapf(err, "failed to unmarshal JSON for message \"%s\"", b.redact(r.Message)))
+		return
+	}
+
+	containers, err := b.coreint.ListContainers()
+	if err != nil {
+		w.Error(request.ActivityID, err)
+		return
+	}
+
+	response := &prot.ContainerEnumerateResponse{
+		MessageResponseBase: &prot.MessageResponseBase{
+			ActivityID: request.ActivityID,
+		},
+		Containers: containers,
+	}
+	w.Write(response)
+}
+
+func (b *Bridge) getContainerState(w ResponseWriter, r *Request) {
+	var request prot.MessageBase
+	if err := commonutils.UnmarshalJSONWithHresult(r.Message, &request); err != nil {
+		b.logMalformedRequest(r, err)
+		w.Error("", errors.Wrapf(err, "failed to unmarshal JSON for message \"%s\"", b.redact(r.Message)))
+		return
+	}
+
+	if err := validateContainerID(request.ContainerID); err != nil {
+		w.Error(request.ActivityID, err)
+		return
+	}
+
+	status, err := b.coreint.GetContainerState(request.ContainerID)
+	if err != nil {
+		w.Error(request.ActivityID, err)
+		return
+	}
+
+	response := &prot.ContainerGetStateResponse{
+		MessageResponseBase: &prot.MessageResponseBase{
+			ActivityID: request.ActivityID,
+		},
+		ContainerStatus: status,
+	}
+	w.Write(response)
+}
+
+func (b *Bridge) attachProcess(w ResponseWriter, r *Request) {
+	var request prot.ContainerAttachProcess
+	if err := commonutils.UnmarshalJSONWithHresult(r.Message, &request); err != nil {
+		b.logMalformedRequest(r, err)
+		w.Error("", errors.Wrapf(err, "failed to unmarshal JSON for message \"%s\"", b.redact(r.Message)))
+		return
+	}
+
+	if err := validateContainerID(request.ContainerID); err != nil {
+		w.Error(request.ActivityID, err)
+		return
+	}
+
+	params := prot.ProcessParameters{
+		CreateStdOutPipe: request.AttachStdOut,
+		CreateStdErrPipe: request.AttachStdErr,
+		MultiplexStdio:   request.MultiplexStdio,
+	}
+	stdioSet, err := connectStdio(b.Transport, params, request.VsockStdioRelaySettings)
+	if err != nil {
+		w.Error(request.ActivityID, err)
+		return
+	}
+	if err := b.coreint.AttachProcess(request.ContainerID, int(request.ProcessID), stdioSet); err != nil {
+		stdioSet.Close() // stdioSet will be eventually closed by coreint on success
+		w.Error(request.ActivityID, err)
+		return
+	}
+
+	response := &prot.MessageResponseBase{
+		ActivityID: request.ActivityID,
+	}
+	w.Write(response)
+}
+
+func (b *Bridge) deleteContainer(w ResponseWriter, r *Request) {
+	var request prot.MessageBase
+	if err := commonutils.UnmarshalJSONWithHresult(r.Message, &request); err != nil {
+		b.logMalformedRequest(r, err)
+		w.Error("", errors.Wrapf(err, "failed to unmarshal JSON for message \"%s\"", b.redact(r.Message)))
+		return
+	}
+
+	if err := validateContainerID(request.ContainerID); err != nil {
+		w.Error(request.ActivityID, err)
+		return
+	}
+
+	response := &prot.MessageResponseBase{
+		ActivityID: request.ActivityID,
+	}
+	if b.idle != nil && b.idle.deleteExited(request.ContainerID) {
+		w.Write(response)
+		return
+	}
+	if err := b.coreint.DeleteContainer(request.ContainerID); err != nil {
+		w.Error(request.ActivityID, err)
+		return
+	}
+	if b.idle != nil {
+		b.idle.containerDeleted(request.ContainerID)
+	}
+	w.Write(response)
+}
+
+// restartInit stops the init process of the container and starts it again
+// with its original parameters. It responds once the new init process has
+// started.
+func (b *Bridge) restartInit(w ResponseWriter, r *Request) {
+	var request prot.MessageBase
+	if err := commonutils.UnmarshalJSONWithHresult(r.Message, &request); err != nil {
+		b.logMalformedRequest(r, err)
+		w.Error("", errors.Wrapf(err, "failed to unmarshal JSON for message \"%s\"", b.redact(r.Message)))
+		return
+	}
+
+	if err := validateContainerID(request.ContainerID); err != nil {
+		w.Error(request.ActivityID, err)
+		return
+	}
+
+	if err := b.coreint.RestartInit(request.ContainerID); err != nil {
+		w.Error(request.ActivityID, err)
+		return
+	}
+
+	response := &prot.MessageResponseBase{
+		ActivityID: request.ActivityID,
+	}
+	w.Write(response)
+}
+
+func (b *Bridge) writeProcessStdin(w ResponseWriter, r *Request) {
+	var request prot.ContainerWriteProcessStdin
+	if err := commonutils.UnmarshalJSONWithHresult(r.Message, &request); err != nil {
+		b.logMalformedRequest(r, err)
+		w.Error("", errors.Wrapf(err, "failed to unmarshal JSON for message \"%s\"", b.redact(r.Message)))
+		return
+	}
+
+	if err := validateContainerID(request.ContainerID); err != nil {
+		w.Error(request.ActivityID, err)
+		return
+	}
+	if len(request.Data) > prot.MaxWriteStdinBytes {
+		w.Error(request.ActivityID, gcserr.WrapHresult(errors.Errorf("%d bytes of stdin data exceeds the maximum of %d", len(request.Data), prot.MaxWriteStdinBytes), gcserr.HrInvalidArg))
+		return
+	}
+
+	n, err := b.coreint.WriteProcessStdin(request.ContainerID, int(request.ProcessID), request.Data)
+	if err != nil {
+		w.Error(request.ActivityID, err)
+		return
+	}
+
+	response := &prot.ContainerWriteProcessStdinResponse{
+		MessageResponseBase: &prot.MessageResponseBase{
+			ActivityID: request.ActivityID,
+		},
+		BytesWritten: uint32(n),
+	}
+	w.Write(response)
+}
+
+// getGuestInfo reports the utility VM's kernel and GCS versions and supported
+// features. The request is not specific to a container, so its container ID is
+// not validated.
+func (b *Bridge) getGuestInfo(w ResponseWriter, r *Request) {
+	var request prot.MessageBase
+	if err := commonutils.UnmarshalJSONWithHresult(r.Message, &request); err != nil {
+		b.logMalformedRequest(r, err)
+		w.Error("", errors.Wrapf(err, "failed to unmarshal JSON for message \"%s\"", b.redact(r.Message)))
+		return
+	}
+
+	info, err := b.coreint.GetGuestInfo()
+	if err != nil {
+		w.Error(request.ActivityID, err)
+		return
+	}
+
+	response := &prot.ContainerGetGuestInfoResponse{
+		MessageResponseBase: &prot.MessageResponseBase{
+			ActivityID: request.ActivityID,
+		},
+		GuestInfo: info,
+	}
+	w.Write(response)
+}
+
+// getResourceUsage reports the resources used by the GCS process itself. The
+// request is not specific to a container, so its container ID is not
+// validated.
+func (b *Bridge) getResourceUsage(w ResponseWriter, r *Request) {
+	var request prot.MessageBase
+	if err := commonutils.UnmarshalJSONWithHresult(r.Message, &request); err != nil {
+		b.logMalformedRequest(r, err)
+		w.Error("", errors.Wrapf(err, "failed to unmarshal JSON for message \"%s\"", b.redact(r.Message)))
+		return
+	}
+
+	usage, err := b.coreint.GetGCSResourceUsage()
+	if err != nil {
+		w.Error(request.ActivityID, err)
+		return
+	}
+
+	response := &prot.ContainerGetResourceUsageResponse{
+		MessageResponseBase: &prot.MessageResponseBase{
+			ActivityID: request.ActivityID,
+		},
+		GCSResourceUsage: usage,
+	}
+	w.Write(response)
+}
+
+// readFile returns the contents of a file in a container, either in the
+// response or, if the request gives a port, by writing them to a connection to
+// that port before responding.
+func (b *Bridge) readFile(w ResponseWriter, r *Request) {
+	var request prot.ContainerReadFile
+	if err := commonutils.UnmarshalJSONWithHresult(r.Message, &request); err != nil {
+		b.logMalformedRequest(r, err)
+		w.Error("", errors.Wrapf(err, "failed to unmarshal JSON for message \"%s\"", b.redact(r.Message)))
+		return
+	}
+
+	if err := validateContainerID(request.ContainerID); err != nil {
+		w.Error(request.ActivityID, err)
+		return
+	}
+
+	if request.ListenForHost && request.Port != 0 {
+		w.Error(request.ActivityID, gcserr.WrapHresult(errors.New("ListenForHost cannot be combined with a relay port"), gcserr.HrInvalidArg))
+		return
+	}
+
+	f, size, err := b.coreint.OpenContainerFile(request.ContainerID, request.Path)
+	if err != nil {
+		w.Error(request.ActivityID, err)
+		return
+	}
+
+	response := &prot.ContainerReadFileResponse{
+		MessageResponseBase: &prot.MessageResponseBase{
+			ActivityID: request.ActivityID,
+		},
+	}
+	if request.ListenForHost {
+		b.readFileToHost(w, &request, response, f, size)
+		return
+	}
+	defer f.Close()
+
+	if request.Port == 0 {
+		if size > prot.MaxReadFileInlineBytes {
+			w.Error(request.ActivityID, gcserr.WrapHresult(errors.Errorf("%s is %d bytes, which exceeds the maximum of %d which may be returned without a relay port", request.Path, size, prot.MaxReadFileInlineBytes), gcserr.HrInvalidArg))
+			return
+		}
+		// The file may have grown since its size was read.
+		contents, err := ioutil.ReadAll(io.LimitReader(f, prot.MaxReadFileInlineBytes+1))
+		if err != nil {
+			w.Error(request.ActivityID, errors.Wrapf(err, "failed to read %s", request.Path))
+			return
+		}
+		if len(contents) > prot.MaxReadFileInlineBytes {
+			w.Error(request.ActivityID, gcserr.WrapHresult(errors.Errorf("%s grew beyond the maximum of %d bytes which may be returned without a relay port", request.Path, prot.MaxReadFileInlineBytes), gcserr.HrInvalidArg))
+			return
+		}
+		response.Size = int64(len(contents))
+		response.Contents = contents
+		w.Write(response)
+		return
+	}
+
+	conn, err := b.Transport.Dial(request.Port)
+	if err != nil {
+		w.Error(request.ActivityID, errors.Wrapf(err, "failed to connect to port %d", request.Port))
+		return
+	}
+	defer conn.Close()
+	n, err := io.Copy(conn, f)
+	if err != nil {
+		w.Error(request.ActivityID, errors.Wrapf(err, "failed to write %s to port %d", request.Path, request.Port))
+		return
+	}
+	response.Size = n
+	w.Write(response)
+}
+
+// readFileToHost listens for a connection from the host on a port which it
+// advertises in response, and writes f to the first connection made to it. If
+// the host does not connect within HostConnectTimeout, the file is not sent.
+// It takes ownership of f.
+func (b *Bridge) readFileToHost(w ResponseWriter, request *prot.ContainerReadFile, response *prot.ContainerReadFileResponse, f io.ReadCloser, size int64) {
+	l, advertised, err := listenForHost(b.Transport)
+	if err != nil {
+		f.Close()
+		w.Error(request.ActivityID, err)
+		return
+	}
+	response.Size = size
+	response.GuestListenPort = advertised
+	w.Write(response)
+
+	go func() {
+		defer f.Close()
+		timer := time.AfterFunc(HostConnectTimeout, func() { l.Close() })
+		conn, err := l.Accept()
+		timer.Stop()
+		l.Close()
+		if err != nil {
+			logrus.Errorf("the host did not connect to port %d for %s in container %s: %s", advertised.ListenPort, request.Path, request.ContainerID, err)
+			return
+		}
+		defer conn.Close()
+		if _, err := io.Copy(conn, f); err != nil {
+			logrus.Errorf("failed to write %s in container %s to port %d: %s", request.Path, request.ContainerID, advertised.ListenPort, err)
+		}
+	}()
+}
+
+// writeFile atomically creates or replaces a file in a container with the
+// contents in the request or, if the request gives a port, read from a
+// connection to that port.
+func (b *Bridge) writeFile(w ResponseWriter, r *Request) {
+	var request prot.ContainerWriteFile
+	if err := commonutils.UnmarshalJSONWithHresult(r.Message, &request); err != nil {
+		b.logMalformedRequest(r, err)
+		w.Error("", errors.Wrapf(err, "failed to unmarshal JSON for message \"%s\"", b.redact(r.Message)))
+		return
+	}
+
+	if err := validateContainerID(request.ContainerID); err != nil {
+		w.Error(request.ActivityID, err)
+		return
+	}
+	if len(request.Contents) > prot.MaxWriteFileInlineBytes {
+		w.Error(request.ActivityID, gcserr.WrapHresult(errors.Errorf("%d bytes of file contents exceeds the maximum of %d which may be sent without a relay port", len(request.Contents), prot.MaxWriteFileInlineBytes), gcserr.HrInvalidArg))
+		return
+	}
+
+	var contents io.Reader = bytes.NewReader(request.Contents)
+	if request.Port != 0 {
+		conn, err := b.Transport.Dial(request.Port)
+		if err != nil {
+			w.Error(request.ActivityID, errors.Wrapf(err, "failed to connect to port %d", request.Port))
+			return
+		}
+		defer conn.Close()
+		contents = conn
+	}
+
+	n, err := b.coreint.WriteContainerFile(request.ContainerID, request.Path, unixModeToFileMode(request.Mode), contents)
+	if err != nil {
+		w.Error(request.ActivityID, err)
+		return
+	}
+
+	response := &prot.ContainerWriteFileResponse{
+		MessageResponseBase: &prot.MessageResponseBase{
+			ActivityID: request.ActivityID,
+		},
+		Size: n,
+	}
+	w.Write(response)
+}
+
+// unixModeToFileMode converts the permission bits of a chmod(2) style mode to
+// an os.FileMode. Any other bits are kept as they are, so that they are
+// rejected as invalid.
+func unixModeToFileMode(mode uint32) os.FileMode {
+	fileMode := os.FileMode(mode &^ (syscall.S_ISUID | syscall.S_ISGID | syscall.S_ISVTX))
+	if mode&syscall.S_ISUID != 0 {
+		fileMode |= os.ModeSetuid
+	}
+	if mode&syscall.S_ISGID != 0 {
+		fileMode |= os.ModeSetgid
+	}
+	if mode&syscall.S_ISVTX != 0 {
+		fileMode |= os.ModeSticky
+	}
+	return fileMode
+}
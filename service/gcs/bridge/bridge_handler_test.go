@@ -1,20 +1,30 @@
 package bridge
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"sync"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/Microsoft/opengcs/service/gcs/core/mockcore"
+	"github.com/Microsoft/opengcs/service/gcs/gcserr"
 	"github.com/Microsoft/opengcs/service/gcs/oslayer"
 	"github.com/Microsoft/opengcs/service/gcs/prot"
+	"github.com/Microsoft/opengcs/service/gcs/runtime"
 	"github.com/Microsoft/opengcs/service/gcs/transport"
+	oci "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
@@ -175,6 +185,52 @@ func Test_CreateContainer_InvalidHostedJson_Failure(t *testing.T) {
 	verifyActivityID(t, r.MessageBase, rw)
 }
 
+func Test_CreateContainer_InvalidHostedJson_LogsRedactedMessage(t *testing.T) {
+	var buf bytes.Buffer
+	logrus.SetOutput(&buf)
+	logrus.SetLevel(logrus.DebugLevel)
+	defer func() {
+		logrus.SetOutput(ioutil.Discard)
+		logrus.SetLevel(logrus.InfoLevel)
+	}()
+
+	r := &prot.ContainerCreate{
+		MessageBase:     newMessageBase(),
+		ContainerConfig: `{"Layers": 5, "SandboxDataPath": "3", "StorageAccountKey": "hunter2", "Password": "hunter3"}`,
+	}
+
+	req, rw := setupRequestResponse(t, prot.ComputeSystemCreateV1, r)
+
+	tb := new(Bridge)
+	tb.createContainer(rw, req)
+
+	verifyResponseJSONError(t, rw)
+	logged := buf.String()
+	if !strings.Contains(logged, "failed to unmarshal request") {
+		t.Fatalf("malformed request was not logged: %s", logged)
+	}
+	if strings.Contains(logged, "hunter2") || strings.Contains(logged, "hunter3") {
+		t.Fatalf("logged request contained a secret value: %s", logged)
+	}
+	if !strings.Contains(logged, redactedValue) {
+		t.Fatalf("logged request did not contain the redaction marker: %s", logged)
+	}
+	if !strings.Contains(logged, "SandboxDataPath") {
+		t.Fatalf("logged request was missing non-sensitive fields: %s", logged)
+	}
+}
+
+func Test_RedactMessage_InvalidJson_CustomFields(t *testing.T) {
+	message := []byte(`{"ContainerId": "abc", "Token": "hunter2", "Key": 12,`)
+	redacted := redactMessage(message, []string{"token"})
+	if strings.Contains(redacted, "hunter2") {
+		t.Fatalf("redacted message contained a secret value: %s", redacted)
+	}
+	if !strings.Contains(redacted, `"Key": 12`) {
+		t.Fatalf("redacted message masked a field not in the redaction list: %s", redacted)
+	}
+}
+
 func Test_CreateContainer_CoreCreateContainerFails_Failure(t *testing.T) {
 	r := &prot.ContainerCreate{
 		MessageBase:     newMessageBase(),
@@ -194,6 +250,211 @@ func Test_CreateContainer_CoreCreateContainerFails_Failure(t *testing.T) {
 	verifyActivityID(t, r.MessageBase, rw)
 }
 
+func Test_CreateContainer_DeadlineExceeded_Timeout(t *testing.T) {
+	r := &prot.ContainerCreate{
+		MessageBase:     newMessageBase(),
+		ContainerConfig: "{}", // Just unmarshal to defaults
+	}
+	r.DeadlineMs = 50
+
+	req, rw := setupRequestResponse(t, prot.ComputeSystemCreateV1, r)
+
+	tb := &Bridge{
+		coreint: &mockcore.MockCore{
+			Behavior: mockcore.Hang,
+		},
+	}
+	start := time.Now()
+	tb.createContainer(rw, req)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("create was not cancelled at its deadline, took %s", elapsed)
+	}
+
+	verifyResponseError(t, rw)
+	verifyActivityID(t, r.MessageBase, rw)
+	if hresult, err := gcserr.GetHresult(rw.err); err != nil || hresult != gcserr.HrTimeout {
+		t.Fatalf("response error was not a timeout: %s", rw.err)
+	}
+}
+
+func Test_CreateContainer_InvalidContainerID_Failure(t *testing.T) {
+	for _, id := range []string{"", "has/slash", "has space", "..", "semi;colon"} {
+		r, _ := createContainerConfig()
+		r.ContainerID = id
+		req, rw := setupRequestResponse(t, prot.ComputeSystemCreateV1, r)
+
+		mc := &mockcore.MockCore{Behavior: mockcore.Success}
+		tb := &Bridge{coreint: mc}
+		tb.createContainer(rw, req)
+
+		verifyResponseError(t, rw)
+		verifyActivityID(t, r.MessageBase, rw)
+		if hr, err := gcserr.GetHresult(rw.err); err != nil || hr != gcserr.HrInvalidArg {
+			t.Fatalf("expected HrInvalidArg for container ID \"%s\", got %v (%v)", id, hr, err)
+		}
+		if mc.LastCreateContainer.ID != "" {
+			t.Fatalf("core was called for invalid container ID \"%s\"", id)
+		}
+	}
+}
+
+func Test_CreateContainer_ValidContainerIDs_Success(t *testing.T) {
+	for _, id := range []string{"01234567-89ab-cdef-0123-456789abcdef", "abc_def.1+2", "A"} {
+		r, _ := createContainerConfig()
+		r.ContainerID = id
+		req, rw := setupRequestResponse(t, prot.ComputeSystemCreateV1, r)
+
+		mc := &mockcore.MockCore{Behavior: mockcore.Error}
+		tb := &Bridge{coreint: mc}
+		tb.createContainer(rw, req)
+
+		if mc.LastCreateContainer.ID != id {
+			t.Fatalf("core was not called for valid container ID \"%s\"", id)
+		}
+	}
+}
+
+// createContainerWithLogSettings runs createContainer with the given log
+// settings against a mock core with the given behavior.
+func createContainerWithLogSettings(t *testing.T, level, format string, behavior mockcore.Behavior) *testResponseWriter {
+	hs := prot.VMHostedContainerSettings{
+		LogLevel:  level,
+		LogFormat: format,
+	}
+	hsb, err := json.Marshal(hs)
+	if err != nil {
+		t.Fatalf("failed to marshal hosted settings: %s", err)
+	}
+	r := &prot.ContainerCreate{
+		MessageBase:     newMessageBase(),
+		ContainerConfig: string(hsb),
+	}
+
+	req, rw := setupRequestResponse(t, prot.ComputeSystemCreateV1, r)
+
+	mc := &mockcore.MockCore{Behavior: behavior}
+	if behavior == mockcore.SingleSuccess {
+		mc.WaitContainerWg.Add(1)
+	}
+	tb := &Bridge{coreint: mc}
+	tb.createContainer(rw, req)
+	if behavior == mockcore.SingleSuccess {
+		mc.WaitContainerWg.Wait()
+	}
+	return rw
+}
+
+func Test_CreateContainer_LogSettings_Applied(t *testing.T) {
+	logrus.SetOutput(ioutil.Discard)
+	defer func() {
+		logrus.SetLevel(logrus.InfoLevel)
+		logrus.SetFormatter(&logrus.TextFormatter{})
+	}()
+
+	rw := createContainerWithLogSettings(t, "warning", LogFormatJSON, mockcore.SingleSuccess)
+
+	verifyResponseSuccess(t, rw)
+	if logrus.GetLevel() != logrus.WarnLevel {
+		t.Fatalf("log level was not applied, got: %s", logrus.GetLevel())
+	}
+	if _, ok := logrus.StandardLogger().Formatter.(*logrus.JSONFormatter); !ok {
+		t.Fatal("json log formatter was not applied")
+	}
+}
+
+func Test_CreateContainer_LogFormatOnly_KeepsLevel(t *testing.T) {
+	logrus.SetOutput(ioutil.Discard)
+	logrus.SetLevel(logrus.DebugLevel)
+	defer func() {
+		logrus.SetLevel(logrus.InfoLevel)
+		logrus.SetFormatter(&logrus.TextFormatter{})
+	}()
+
+	rw := createContainerWithLogSettings(t, "", LogFormatJSON, mockcore.SingleSuccess)
+
+	verifyResponseSuccess(t, rw)
+	if logrus.GetLevel() != logrus.DebugLevel {
+		t.Fatalf("log level was changed to %s", logrus.GetLevel())
+	}
+	if _, ok := logrus.StandardLogger().Formatter.(*logrus.JSONFormatter); !ok {
+		t.Fatal("json log formatter was not applied")
+	}
+}
+
+func Test_CreateContainer_CoreFails_LogSettingsNotApplied(t *testing.T) {
+	logrus.SetLevel(logrus.InfoLevel)
+	logrus.SetFormatter(&logrus.TextFormatter{})
+
+	rw := createContainerWithLogSettings(t, "warning", LogFormatJSON, mockcore.Error)
+
+	verifyResponseError(t, rw)
+	if logrus.GetLevel() != logrus.InfoLevel {
+		t.Fatalf("log level was applied despite the create failing, got: %s", logrus.GetLevel())
+	}
+	if _, ok := logrus.StandardLogger().Formatter.(*logrus.TextFormatter); !ok {
+		t.Fatal("log formatter was applied despite the create failing")
+	}
+}
+
+func Test_CreateContainer_InvalidLogLevel_Failure(t *testing.T) {
+	r := &prot.ContainerCreate{
+		MessageBase:     newMessageBase(),
+		ContainerConfig: `{"LogLevel": "loud"}`,
+	}
+
+	req, rw := setupRequestResponse(t, prot.ComputeSystemCreateV1, r)
+
+	mc := &mockcore.MockCore{Behavior: mockcore.Success}
+	tb := &Bridge{coreint: mc}
+	tb.createContainer(rw, req)
+
+	verifyResponseError(t, rw)
+	verifyActivityID(t, r.MessageBase, rw)
+	if mc.LastCreateContainer.ID != "" {
+		t.Fatal("core create container was called with an invalid log level")
+	}
+}
+
+func Test_CreateContainer_Validate_DoesNotCreate(t *testing.T) {
+	r, hs := createContainerConfig()
+	r.Validate = true
+
+	req, rw := setupRequestResponse(t, prot.ComputeSystemCreateV1, r)
+
+	mc := &mockcore.MockCore{Behavior: mockcore.Success}
+	tb := &Bridge{coreint: mc}
+	tb.createContainer(rw, req)
+
+	verifyResponseSuccess(t, rw)
+	verifyActivityID(t, r.MessageBase, rw)
+	if mc.LastValidateContainer.ID != r.ContainerID {
+		t.Fatal("last validate container did not have the same container ID")
+	}
+	if !reflect.DeepEqual(mc.LastValidateContainer.Settings, hs) {
+		t.Fatal("last validate container did not have the same settings")
+	}
+	if mc.LastCreateContainer.ID != "" {
+		t.Fatal("core create container was called for a validate request")
+	}
+}
+
+func Test_CreateContainer_ValidateFails_Failure(t *testing.T) {
+	r, _ := createContainerConfig()
+	r.Validate = true
+
+	req, rw := setupRequestResponse(t, prot.ComputeSystemCreateV1, r)
+
+	mc := &mockcore.MockCore{Behavior: mockcore.Error}
+	tb := &Bridge{coreint: mc}
+	tb.createContainer(rw, req)
+
+	verifyResponseError(t, rw)
+	verifyActivityID(t, r.MessageBase, rw)
+	if mc.LastCreateContainer.ID != "" {
+		t.Fatal("core create container was called for a validate request")
+	}
+}
+
 func createContainerConfig() (*prot.ContainerCreate, prot.VMHostedContainerSettings) {
 	hs := prot.VMHostedContainerSettings{
 		Layers:          []prot.Layer{prot.Layer{Path: "0"}, prot.Layer{Path: "1"}, prot.Layer{Path: "2"}},
@@ -252,8 +513,8 @@ func Test_CreateContainer_Success_WaitContainer_Failure(t *testing.T) {
 	}
 
 	// Verify that wait was called. This also tests that if we dont exit in the
-	// error case here we would panic when PublishNotification tries to write to
-	// the responseChan.
+	// error case here we would try to publish a notification although the
+	// bridge is not serving.
 	mc.WaitContainerWg.Wait()
 }
 
@@ -264,15 +525,15 @@ func Test_CreateContainer_Success_WaitContainer_Success(t *testing.T) {
 	mc := &mockcore.MockCore{Behavior: mockcore.Success}
 	mc.WaitContainerWg.Add(1)
 	b := &Bridge{coreint: mc}
-	b.responseChan = make(chan bridgeResponse)
-	defer close(b.responseChan)
+	b.notificationChan = make(chan bridgeResponse)
+	defer close(b.notificationChan)
 
 	publishWg := sync.WaitGroup{}
 	publishWg.Add(1)
 	go func() {
 		defer publishWg.Done()
 
-		response := <-b.responseChan
+		response := <-b.notificationChan
 
 		cn := response.response.(*prot.ContainerNotification)
 		if cn.ContainerID != r.ContainerID {
@@ -311,6 +572,95 @@ func Test_CreateContainer_Success_WaitContainer_Success(t *testing.T) {
 	publishWg.Wait()
 }
 
+func Test_CreateContainer_Success_WaitContainer_ExitStatus(t *testing.T) {
+	r, _ := createContainerConfig()
+	req, rw := setupRequestResponse(t, prot.ComputeSystemCreateV1, r)
+
+	mc := &exitCodeCore{MockCore: &mockcore.MockCore{Behavior: mockcore.Success}, exitCode: 137, signal: 9}
+	mc.WaitContainerWg.Add(1)
+	b := &Bridge{coreint: mc}
+	b.notificationChan = make(chan bridgeResponse)
+	defer close(b.notificationChan)
+
+	b.createContainer(rw, req)
+	verifyResponseSuccess(t, rw)
+
+	select {
+	case response := <-b.notificationChan:
+		cn := response.response.(*prot.ContainerNotification)
+		if cn.Type != prot.NtUnexpectedExit {
+			t.Fatalf("publish response had invalid type %s", cn.Type)
+		}
+		if cn.Result != 137 {
+			t.Fatalf("publish response had invalid result %d", cn.Result)
+		}
+		if cn.Signal != 9 {
+			t.Fatalf("publish response had invalid signal %d", cn.Signal)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the container exit notification")
+	}
+}
+
+// scratchUsageCore is a mock core which reports a fixed sequence of free space
+// values for the scratch disk, then fails once the sequence is exhausted.
+type scratchUsageCore struct {
+	*mockcore.MockCore
+	free []uint64
+}
+
+func (c *scratchUsageCore) GetScratchDiskUsage(id string) (prot.ScratchDiskUsage, error) {
+	if len(c.free) == 0 {
+		return prot.ScratchDiskUsage{}, fmt.Errorf("container %s does not exist", id)
+	}
+	free := c.free[0]
+	c.free = c.free[1:]
+	return prot.ScratchDiskUsage{UsedBytes: 1000 - free, FreeBytes: free, TotalBytes: 1000}, nil
+}
+
+func Test_MonitorScratchDisk_PublishesOnceUntilRecovered(t *testing.T) {
+	logrus.SetOutput(ioutil.Discard)
+
+	// 50 crosses the watermark, 40 is still low, 105 is above the watermark
+	// but within the hysteresis margin, so 60 must not publish again. 115
+	// re-arms the monitor and 90 publishes a second notification.
+	mc := &scratchUsageCore{
+		MockCore: &mockcore.MockCore{Behavior: mockcore.Success},
+		free:     []uint64{200, 50, 40, 105, 60, 115, 90},
+	}
+	b := &Bridge{coreint: mc, DiskPressurePollInterval: time.Millisecond}
+	b.notificationChan = make(chan bridgeResponse, 10)
+
+	done := make(chan struct{})
+	defer close(done)
+	b.monitorScratchDisk("container", "activity", 100, done)
+	close(b.notificationChan)
+
+	var notifications []*prot.ContainerNotification
+	for response := range b.notificationChan {
+		notifications = append(notifications, response.response.(*prot.ContainerNotification))
+	}
+	if len(notifications) != 2 {
+		t.Fatalf("expected 2 disk pressure notifications, got %d", len(notifications))
+	}
+	for i, expectedFree := range []uint64{50, 90} {
+		cn := notifications[i]
+		if cn.Type != prot.NtDiskPressure {
+			t.Fatalf("notification had invalid type: %s", cn.Type)
+		}
+		if cn.ContainerID != "container" || cn.ActivityID != "activity" {
+			t.Fatal("notification had invalid container or activity ID")
+		}
+		var usage prot.ScratchDiskUsage
+		if err := json.Unmarshal([]byte(cn.ResultInfo), &usage); err != nil {
+			t.Fatalf("failed to unmarshal notification result info: %s", err)
+		}
+		if usage.FreeBytes != expectedFree {
+			t.Fatalf("expected %d free bytes, got %d", expectedFree, usage.FreeBytes)
+		}
+	}
+}
+
 func Test_ExecProcess_InvalidJson_Failure(t *testing.T) {
 	req, rw := setupRequestResponse(t, prot.ComputeSystemExecuteProcessV1, nil)
 
@@ -347,6 +697,10 @@ func (f *failureTransport) Dial(port uint32) (transport.Connection, error) {
 	return nil, fmt.Errorf("test failed to dial for port %d", port)
 }
 
+func (f *failureTransport) Listen(port uint32) (transport.Listener, error) {
+	return nil, fmt.Errorf("test failed to listen on port %d", port)
+}
+
 func Test_ExecProcess_ConnectFails_Failure(t *testing.T) {
 	pp := prot.ProcessParameters{
 		CreateStdInPipe:  true,
@@ -442,6 +796,76 @@ func Test_ExecProcess_External_CoreSucceeds_Success(t *testing.T) {
 	}
 }
 
+// exitCodeCore is a mock core whose processes and containers all exit with
+// exitCode. Containers also report signal as their terminating signal.
+type exitCodeCore struct {
+	*mockcore.MockCore
+	exitCode int
+	signal   int
+}
+
+func (c *exitCodeCore) WaitContainer(id string) (prot.ContainerExitStatus, error) {
+	c.MockCore.WaitContainer(id)
+	return prot.ContainerExitStatus{ExitCode: c.exitCode, Signal: c.signal}, nil
+}
+
+func (c *exitCodeCore) WaitProcess(pid int) (int, error) {
+	c.MockCore.WaitProcess(pid)
+	return c.exitCode, nil
+}
+
+func Test_ExecProcess_External_Exit_PublishesNotification(t *testing.T) {
+	pp := prot.ProcessParameters{
+		IsExternal: true,
+	}
+	ppbytes, _ := json.Marshal(pp)
+	r := &prot.ContainerExecuteProcess{
+		MessageBase: &prot.MessageBase{
+			ActivityID: newMessageBase().ActivityID,
+		},
+		Settings: prot.ExecuteProcessSettings{
+			ProcessParameters: string(ppbytes),
+		},
+	}
+
+	req, rw := setupRequestResponse(t, prot.ComputeSystemExecuteProcessV1, r)
+	mc := &exitCodeCore{MockCore: &mockcore.MockCore{Behavior: mockcore.Success}, exitCode: 3}
+	tb := &Bridge{
+		Transport: new(failureTransport),
+		coreint:   mc,
+	}
+	tb.notificationChan = make(chan bridgeResponse)
+	defer close(tb.notificationChan)
+
+	tb.execProcess(rw, req)
+	verifyResponseSuccess(t, rw)
+
+	select {
+	case response := <-tb.notificationChan:
+		cn := response.response.(*prot.ContainerNotification)
+		if cn.Type != prot.NtProcessExit {
+			t.Fatalf("publish response had invalid type %s", cn.Type)
+		}
+		if cn.ContainerID != "" {
+			t.Fatalf("publish response had unexpected container ID %s", cn.ContainerID)
+		}
+		if cn.ActivityID != r.ActivityID {
+			t.Fatal("publish response had invalid activity ID")
+		}
+		if cn.ProcessID != 101 {
+			t.Fatalf("publish response had invalid process ID %d", cn.ProcessID)
+		}
+		if cn.Result != 3 {
+			t.Fatalf("publish response had invalid result %d", cn.Result)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the process exit notification")
+	}
+	if mc.LastWaitProcess.Pid != 101 {
+		t.Fatal("last wait process did not have the external process's pid")
+	}
+}
+
 func Test_ExecProcess_Container_CoreFails_Failure(t *testing.T) {
 	r := &prot.ContainerExecuteProcess{
 		MessageBase: newMessageBase(),
@@ -503,6 +927,40 @@ func Test_ExecProcess_Container_CoreSucceeds_Success(t *testing.T) {
 	}
 }
 
+func Test_ExecProcess_Container_ResponseHasPidAndCreatedTime(t *testing.T) {
+	pp := prot.ProcessParameters{
+		CommandLine: "test",
+	}
+	ppbytes, _ := json.Marshal(pp)
+	r := &prot.ContainerExecuteProcess{
+		MessageBase: newMessageBase(),
+		Settings: prot.ExecuteProcessSettings{
+			ProcessParameters: string(ppbytes),
+		},
+	}
+
+	req, rw := setupRequestResponse(t, prot.ComputeSystemExecuteProcessV1, r)
+
+	mc := &mockcore.MockCore{Behavior: mockcore.Success}
+	tb := &Bridge{
+		Transport: new(failureTransport),
+		coreint:   mc,
+	}
+	tb.execProcess(rw, req)
+
+	verifyResponseSuccess(t, rw)
+	response := rw.response.(*prot.ContainerExecuteProcessResponse)
+	if response.ProcessID != 101 {
+		t.Fatalf("response had pid %d rather than the core's pid 101", response.ProcessID)
+	}
+	if mc.LastGetProcessCreatedTime.Pid != 101 {
+		t.Fatalf("the creation time of pid %d was requested", mc.LastGetProcessCreatedTime.Pid)
+	}
+	if response.CreatedTime != mockcore.ProcessCreatedTime.UnixNano() {
+		t.Fatalf("response had creation time %d rather than %d", response.CreatedTime, mockcore.ProcessCreatedTime.UnixNano())
+	}
+}
+
 func Test_KillContainer_InvalidJson_Failure(t *testing.T) {
 	req, rw := setupRequestResponse(t, prot.ComputeSystemShutdownForcedV1, nil)
 
@@ -546,6 +1004,27 @@ func Test_KillContainer_CoreSucceeds_Success(t *testing.T) {
 	}
 }
 
+func Test_KillContainer_KillAll_Success(t *testing.T) {
+	r := &prot.ContainerKill{
+		MessageBase: newMessageBase(),
+		KillAll:     true,
+	}
+	req, rw := setupRequestResponse(t, prot.ComputeSystemShutdownForcedV1, r)
+
+	mc := &mockcore.MockCore{Behavior: mockcore.Success}
+	tb := &Bridge{coreint: mc}
+	tb.killContainer(rw, req)
+
+	verifyResponseSuccess(t, rw)
+	verifyActivityID(t, r.MessageBase, rw)
+	if mc.LastSignalContainerProcesses.ID != r.ContainerID || mc.LastSignalContainerProcesses.Signal != oslayer.SIGKILL {
+		t.Fatalf("the container's processes were not all killed: %+v", mc.LastSignalContainerProcesses)
+	}
+	if mc.LastSignalContainer.ID != "" {
+		t.Fatal("only the container's init process was signaled")
+	}
+}
+
 func Test_ShutdownContainer_InvalidJson_Failure(t *testing.T) {
 	req, rw := setupRequestResponse(t, prot.ComputeSystemShutdownGracefulV1, nil)
 
@@ -581,17 +1060,77 @@ func Test_ShutdownContainer_CoreSucceeds_Success(t *testing.T) {
 
 	verifyResponseSuccess(t, rw)
 	verifyActivityID(t, r, rw)
-	if r.ContainerID != mc.LastSignalContainer.ID {
-		t.Fatal("last signal container did not have the same container ID")
+	if r.ContainerID != mc.LastShutdownContainer.ID {
+		t.Fatal("last shutdown container did not have the same container ID")
 	}
-	if mc.LastSignalContainer.Signal != oslayer.SIGTERM {
-		t.Fatal("last signal container did not have equal signal values")
+	if mc.LastShutdownContainer.GracePeriod != 0 {
+		t.Fatalf("last shutdown container had unexpected grace period %s", mc.LastShutdownContainer.GracePeriod)
+	}
+	if mc.LastShutdownContainer.Signal != oslayer.SIGTERM {
+		t.Fatalf("last shutdown container had unexpected signal %d", mc.LastShutdownContainer.Signal)
 	}
 }
 
-func Test_SignalProcess_InvalidJson_Failure(t *testing.T) {
-	req, rw := setupRequestResponse(t, prot.ComputeSystemSignalProcessV1, nil)
-
+func Test_ShutdownContainer_GracePeriod_Success(t *testing.T) {
+	r := &prot.ContainerShutdown{
+		MessageBase:   newMessageBase(),
+		GracePeriodMs: 2500,
+	}
+	req, rw := setupRequestResponse(t, prot.ComputeSystemShutdownGracefulV1, r)
+
+	mc := &mockcore.MockCore{Behavior: mockcore.Success}
+	tb := &Bridge{coreint: mc}
+	tb.shutdownContainer(rw, req)
+
+	verifyResponseSuccess(t, rw)
+	verifyActivityID(t, r.MessageBase, rw)
+	if r.ContainerID != mc.LastShutdownContainer.ID {
+		t.Fatal("last shutdown container did not have the same container ID")
+	}
+	if mc.LastShutdownContainer.GracePeriod != 2500*time.Millisecond {
+		t.Fatalf("last shutdown container had unexpected grace period %s", mc.LastShutdownContainer.GracePeriod)
+	}
+}
+
+func Test_ShutdownContainer_Signal_Success(t *testing.T) {
+	r := &prot.ContainerShutdown{
+		MessageBase: newMessageBase(),
+		Signal:      "SIGQUIT",
+	}
+	req, rw := setupRequestResponse(t, prot.ComputeSystemShutdownGracefulV1, r)
+
+	mc := &mockcore.MockCore{Behavior: mockcore.Success}
+	tb := &Bridge{coreint: mc}
+	tb.shutdownContainer(rw, req)
+
+	verifyResponseSuccess(t, rw)
+	verifyActivityID(t, r.MessageBase, rw)
+	if mc.LastShutdownContainer.Signal != oslayer.Signal(syscall.SIGQUIT) {
+		t.Fatalf("last shutdown container had unexpected signal %d", mc.LastShutdownContainer.Signal)
+	}
+}
+
+func Test_ShutdownContainer_InvalidSignal_Failure(t *testing.T) {
+	r := &prot.ContainerShutdown{
+		MessageBase: newMessageBase(),
+		Signal:      "SIGBOGUS",
+	}
+	req, rw := setupRequestResponse(t, prot.ComputeSystemShutdownGracefulV1, r)
+
+	mc := &mockcore.MockCore{Behavior: mockcore.Success}
+	tb := &Bridge{coreint: mc}
+	tb.shutdownContainer(rw, req)
+
+	verifyResponseError(t, rw)
+	verifyActivityID(t, r.MessageBase, rw)
+	if mc.LastShutdownContainer.ID != "" {
+		t.Fatal("shutdown container was called for an invalid signal")
+	}
+}
+
+func Test_SignalProcess_InvalidJson_Failure(t *testing.T) {
+	req, rw := setupRequestResponse(t, prot.ComputeSystemSignalProcessV1, nil)
+
 	tb := new(Bridge)
 	tb.signalProcess(rw, req)
 
@@ -646,6 +1185,85 @@ func Test_SignalProcess_CoreSucceeds_Success(t *testing.T) {
 	}
 }
 
+func Test_SignalProcess_SignalName_Resolved(t *testing.T) {
+	names := map[string]int32{
+		"SIGTERM": 15,
+		"SIGUSR1": 10,
+		"sigkill": 9,
+		"HUP":     1,
+	}
+	for name, expected := range names {
+		r := &prot.ContainerSignalProcess{
+			MessageBase: newMessageBase(),
+			ProcessID:   20,
+			Options: prot.SignalProcessOptions{
+				SignalName: name,
+			},
+		}
+
+		req, rw := setupRequestResponse(t, prot.ComputeSystemSignalProcessV1, r)
+
+		mc := &mockcore.MockCore{Behavior: mockcore.Success}
+		tb := &Bridge{coreint: mc}
+		tb.signalProcess(rw, req)
+
+		verifyResponseSuccess(t, rw)
+		if mc.LastSignalProcess.Options.Signal != expected {
+			t.Fatalf("signal name %s resolved to %d, expected %d", name, mc.LastSignalProcess.Options.Signal, expected)
+		}
+	}
+}
+
+func Test_SignalProcess_SignalNameAndNumber_NumberWins(t *testing.T) {
+	r := &prot.ContainerSignalProcess{
+		MessageBase: newMessageBase(),
+		ProcessID:   20,
+		Options: prot.SignalProcessOptions{
+			Signal:     9,
+			SignalName: "SIGTERM",
+		},
+	}
+
+	req, rw := setupRequestResponse(t, prot.ComputeSystemSignalProcessV1, r)
+
+	mc := &mockcore.MockCore{Behavior: mockcore.Success}
+	tb := &Bridge{coreint: mc}
+	tb.signalProcess(rw, req)
+
+	verifyResponseSuccess(t, rw)
+	if mc.LastSignalProcess.Options.Signal != 9 {
+		t.Fatalf("expected signal 9, got %d", mc.LastSignalProcess.Options.Signal)
+	}
+}
+
+func Test_SignalProcess_UnknownSignalName_Failure(t *testing.T) {
+	r := &prot.ContainerSignalProcess{
+		MessageBase: newMessageBase(),
+		ProcessID:   20,
+		Options: prot.SignalProcessOptions{
+			SignalName: "SIGBOGUS",
+		},
+	}
+
+	req, rw := setupRequestResponse(t, prot.ComputeSystemSignalProcessV1, r)
+
+	mc := &mockcore.MockCore{Behavior: mockcore.Success}
+	tb := &Bridge{coreint: mc}
+	tb.signalProcess(rw, req)
+
+	verifyResponseError(t, rw)
+	verifyActivityID(t, r.MessageBase, rw)
+	if !strings.Contains(rw.err.Error(), "SIGBOGUS") {
+		t.Fatalf("error did not name the unknown signal: %s", rw.err)
+	}
+	if hresult, err := gcserr.GetHresult(rw.err); err != nil || hresult != gcserr.HrInvalidArg {
+		t.Fatal("error did not have the invalid argument hresult")
+	}
+	if mc.LastSignalProcess.Pid != 0 {
+		t.Fatal("process was signaled despite an unknown signal name")
+	}
+}
+
 //
 // TODO: List Processes tests.
 //
@@ -850,3 +1468,1598 @@ func Test_ModifySettings_CoreSucceeds_Success(t *testing.T) {
 		t.Fatal("last modify settings did not have equal requests struct")
 	}
 }
+
+// rotateLogRequest returns a PtLogRotate request for the given log level.
+func rotateLogRequest(t *testing.T, level string) (*Request, *testResponseWriter) {
+	r := &prot.ContainerModifySettings{
+		MessageBase: newMessageBase(),
+		Request: prot.ResourceModificationRequestResponse{
+			ResourceType: prot.PtLogRotate,
+			RequestType:  prot.RtUpdate,
+			Settings:     &prot.LogRotate{LogLevel: level},
+		},
+	}
+	return setupRequestResponse(t, prot.ComputeSystemModifySettingsV1, r)
+}
+
+func Test_ModifySettings_LogRotate_RotatesAndSetsLevel(t *testing.T) {
+	logrus.SetOutput(ioutil.Discard)
+	logrus.SetLevel(logrus.InfoLevel)
+	defer logrus.SetLevel(logrus.InfoLevel)
+
+	req, rw := rotateLogRequest(t, "warning")
+
+	rotations := 0
+	mc := &mockcore.MockCore{Behavior: mockcore.Success}
+	tb := &Bridge{
+		coreint:    mc,
+		LogRotator: func() error { rotations++; return nil },
+	}
+	tb.modifySettings(rw, req)
+
+	verifyResponseSuccess(t, rw)
+	if rotations != 1 {
+		t.Fatalf("log rotator was called %d times, expected 1", rotations)
+	}
+	if logrus.GetLevel() != logrus.WarnLevel {
+		t.Fatalf("log level was not applied, got: %s", logrus.GetLevel())
+	}
+	if mc.LastModifySettings.ID != "" {
+		t.Fatal("log rotation was passed to the core")
+	}
+}
+
+func Test_ModifySettings_LogRotate_InvalidLevel_NotRotated(t *testing.T) {
+	req, rw := rotateLogRequest(t, "loud")
+
+	rotations := 0
+	tb := &Bridge{LogRotator: func() error { rotations++; return nil }}
+	tb.modifySettings(rw, req)
+
+	verifyResponseError(t, rw)
+	if hr, err := gcserr.GetHresult(rw.err); err != nil || hr != gcserr.HrInvalidArg {
+		t.Fatalf("expected HrInvalidArg, got %v (%v)", hr, err)
+	}
+	if rotations != 0 {
+		t.Fatal("log was rotated despite the invalid level")
+	}
+}
+
+func Test_ModifySettings_LogRotate_NoRotator_NotImplemented(t *testing.T) {
+	req, rw := rotateLogRequest(t, "")
+
+	tb := new(Bridge)
+	tb.modifySettings(rw, req)
+
+	verifyResponseError(t, rw)
+	if hr, err := gcserr.GetHresult(rw.err); err != nil || hr != gcserr.HrNotImpl {
+		t.Fatalf("expected HrNotImpl, got %v (%v)", hr, err)
+	}
+}
+
+func Test_LogFile_Rotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gcslog")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "gcs.log")
+
+	l, err := OpenLogFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(l, "before\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(l, "after\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	if b, _ := ioutil.ReadFile(path + ".1"); string(b) != "before\n" {
+		t.Fatalf("rotated log contained %q", b)
+	}
+	if b, _ := ioutil.ReadFile(path); string(b) != "after\n" {
+		t.Fatalf("new log contained %q", b)
+	}
+}
+
+func Test_SyncContainer_InvalidJson_Failure(t *testing.T) {
+	req, rw := setupRequestResponse(t, prot.ComputeSystemSyncV1, nil)
+
+	tb := new(Bridge)
+	tb.syncContainer(rw, req)
+
+	verifyResponseJSONError(t, rw)
+	verifyActivityIDEmptyGUID(t, rw)
+}
+
+func Test_SyncContainer_CoreFails_Failure(t *testing.T) {
+	r := &prot.ContainerSync{
+		MessageBase: newMessageBase(),
+	}
+
+	req, rw := setupRequestResponse(t, prot.ComputeSystemSyncV1, r)
+
+	tb := &Bridge{coreint: &mockcore.MockCore{Behavior: mockcore.Error}}
+	tb.syncContainer(rw, req)
+
+	verifyResponseError(t, rw)
+	verifyActivityID(t, r.MessageBase, rw)
+}
+
+func Test_SyncContainer_CoreSucceeds_Success(t *testing.T) {
+	r := &prot.ContainerSync{
+		MessageBase: newMessageBase(),
+		Freeze:      true,
+		TimeoutInMs: 1500,
+	}
+
+	req, rw := setupRequestResponse(t, prot.ComputeSystemSyncV1, r)
+
+	mc := &mockcore.MockCore{Behavior: mockcore.Success}
+	tb := &Bridge{coreint: mc}
+	tb.syncContainer(rw, req)
+
+	verifyResponseSuccess(t, rw)
+	verifyActivityID(t, r.MessageBase, rw)
+	if r.ContainerID != mc.LastSyncContainer.ID {
+		t.Fatal("last sync container did not have the same container ID")
+	}
+	if !mc.LastSyncContainer.Freeze {
+		t.Fatal("last sync container did not request a freeze")
+	}
+	if mc.LastSyncContainer.Timeout != 1500*time.Millisecond {
+		t.Fatalf("last sync container had invalid timeout %s", mc.LastSyncContainer.Timeout)
+	}
+}
+
+func Test_CheckpointContainer_CoreFails_Failure(t *testing.T) {
+	r := &prot.ContainerCheckpoint{
+		MessageBase: newMessageBase(),
+	}
+
+	req, rw := setupRequestResponse(t, prot.ComputeSystemCheckpointV1, r)
+
+	tb := &Bridge{coreint: &mockcore.MockCore{Behavior: mockcore.Error}}
+	tb.checkpointContainer(rw, req)
+
+	verifyResponseError(t, rw)
+	verifyActivityID(t, r.MessageBase, rw)
+}
+
+func Test_CheckpointContainer_CoreSucceeds_Success(t *testing.T) {
+	r := &prot.ContainerCheckpoint{
+		MessageBase: newMessageBase(),
+		Options: prot.CheckpointOptions{
+			ImagesPath:     "/images",
+			LeaveRunning:   true,
+			TCPEstablished: true,
+		},
+	}
+
+	req, rw := setupRequestResponse(t, prot.ComputeSystemCheckpointV1, r)
+
+	mc := &mockcore.MockCore{Behavior: mockcore.Success}
+	tb := &Bridge{coreint: mc}
+	tb.checkpointContainer(rw, req)
+
+	verifyResponseSuccess(t, rw)
+	verifyActivityID(t, r.MessageBase, rw)
+	if r.ContainerID != mc.LastCheckpointContainer.ID {
+		t.Fatal("last checkpoint container did not have the same container ID")
+	}
+	if !reflect.DeepEqual(r.Options, mc.LastCheckpointContainer.Options) {
+		t.Fatal("last checkpoint container did not have equal options structs")
+	}
+}
+
+func Test_RestoreContainer_CoreSucceeds_Success(t *testing.T) {
+	r := &prot.ContainerRestore{
+		MessageBase: newMessageBase(),
+		OCISpecification: oci.Spec{
+			Hostname: "restored",
+		},
+		Options: prot.CheckpointOptions{
+			ImagesPath:     "/images",
+			TCPEstablished: true,
+		},
+	}
+
+	req, rw := setupRequestResponse(t, prot.ComputeSystemRestoreV1, r)
+
+	mc := &mockcore.MockCore{Behavior: mockcore.Success}
+	tb := &Bridge{coreint: mc}
+	tb.restoreContainer(rw, req)
+
+	verifyResponseSuccess(t, rw)
+	verifyActivityID(t, r.MessageBase, rw)
+	if r.ContainerID != mc.LastRestoreContainer.ID {
+		t.Fatal("last restore container did not have the same container ID")
+	}
+	if !reflect.DeepEqual(r.OCISpecification, mc.LastRestoreContainer.Config) {
+		t.Fatal("last restore container did not have equal config structs")
+	}
+	if !reflect.DeepEqual(r.Options, mc.LastRestoreContainer.Options) {
+		t.Fatal("last restore container did not have equal options structs")
+	}
+}
+
+func Test_GetInitOutput_CoreFails_Failure(t *testing.T) {
+	r := &prot.ContainerGetProperties{
+		MessageBase: newMessageBase(),
+	}
+
+	req, rw := setupRequestResponse(t, prot.ComputeSystemGetInitOutputV1, r)
+
+	tb := &Bridge{coreint: &mockcore.MockCore{Behavior: mockcore.Error}}
+	tb.getInitOutput(rw, req)
+
+	verifyResponseError(t, rw)
+	verifyActivityID(t, r.MessageBase, rw)
+}
+
+func Test_GetInitOutput_CoreSucceeds_Success(t *testing.T) {
+	r := &prot.ContainerGetProperties{
+		MessageBase: newMessageBase(),
+	}
+
+	req, rw := setupRequestResponse(t, prot.ComputeSystemGetInitOutputV1, r)
+
+	mc := &mockcore.MockCore{Behavior: mockcore.Success}
+	tb := &Bridge{coreint: mc}
+	tb.getInitOutput(rw, req)
+
+	verifyResponseSuccess(t, rw)
+	verifyActivityID(t, r.MessageBase, rw)
+	if r.ContainerID != mc.LastGetInitOutput.ID {
+		t.Fatal("last get init output did not have the same container ID")
+	}
+	response := rw.response.(*prot.ContainerGetInitOutputResponse)
+	if string(response.Output) != "mockcore init output" {
+		t.Fatalf("response had invalid output %q", response.Output)
+	}
+	encoded, err := json.Marshal(response)
+	if err != nil {
+		t.Fatalf("failed to marshal response: %s", err)
+	}
+	if !strings.Contains(string(encoded), `"Output":"bW9ja2NvcmUgaW5pdCBvdXRwdXQ="`) {
+		t.Fatalf("response output was not base64 encoded: %s", encoded)
+	}
+}
+
+func Test_ExecProcess_Container_DialsStdioPortsInOrder(t *testing.T) {
+	pp := prot.ProcessParameters{
+		CommandLine:      "test",
+		CreateStdInPipe:  true,
+		CreateStdOutPipe: true,
+		CreateStdErrPipe: true,
+	}
+	ppbytes, _ := json.Marshal(pp)
+	r := &prot.ContainerExecuteProcess{
+		MessageBase: newMessageBase(),
+		Settings: prot.ExecuteProcessSettings{
+			VsockStdioRelaySettings: prot.ExecuteProcessVsockStdioRelaySettings{
+				StdIn:  1,
+				StdOut: 2,
+				StdErr: 3,
+			},
+			ProcessParameters: string(ppbytes),
+		},
+	}
+
+	req, rw := setupRequestResponse(t, prot.ComputeSystemExecuteProcessV1, r)
+
+	rt := &transport.RecordingTransport{Transport: &transport.MockTransport{}}
+	mc := &mockcore.MockCore{Behavior: mockcore.Success}
+	tb := &Bridge{
+		Transport: rt,
+		coreint:   mc,
+	}
+	tb.execProcess(rw, req)
+	defer mc.LastExecProcess.StdioSet.Close()
+
+	verifyResponseSuccess(t, rw)
+	if ports := rt.Ports(); !reflect.DeepEqual(ports, []uint32{1, 2, 3}) {
+		t.Fatalf("dialed ports %v, expected stdin, stdout and stderr ports [1 2 3]", ports)
+	}
+	dials := rt.Dials()
+	for i := 1; i < len(dials); i++ {
+		if dials[i].Time.Before(dials[i-1].Time) {
+			t.Fatalf("dial of port %d was recorded before dial of port %d", dials[i].Port, dials[i-1].Port)
+		}
+	}
+}
+
+func Test_ExecProcess_Container_StdioSubsets(t *testing.T) {
+	tests := []struct {
+		name          string
+		in, out, err  bool
+		expectedPorts []uint32
+	}{
+		{name: "stdout only", out: true, expectedPorts: []uint32{2}},
+		{name: "stderr only", err: true, expectedPorts: []uint32{3}},
+		{name: "stdin and stdout", in: true, out: true, expectedPorts: []uint32{1, 2}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pp := prot.ProcessParameters{
+				CommandLine:      "test",
+				CreateStdInPipe:  test.in,
+				CreateStdOutPipe: test.out,
+				CreateStdErrPipe: test.err,
+			}
+			ppbytes, _ := json.Marshal(pp)
+			r := &prot.ContainerExecuteProcess{
+				MessageBase: newMessageBase(),
+				Settings: prot.ExecuteProcessSettings{
+					VsockStdioRelaySettings: prot.ExecuteProcessVsockStdioRelaySettings{
+						StdIn:  1,
+						StdOut: 2,
+						StdErr: 3,
+					},
+					ProcessParameters: string(ppbytes),
+				},
+			}
+
+			req, rw := setupRequestResponse(t, prot.ComputeSystemExecuteProcessV1, r)
+
+			rt := &transport.RecordingTransport{Transport: &transport.MockTransport{}}
+			mc := &mockcore.MockCore{Behavior: mockcore.Success}
+			tb := &Bridge{
+				Transport: rt,
+				coreint:   mc,
+			}
+			tb.execProcess(rw, req)
+			stdioSet := mc.LastExecProcess.StdioSet
+			defer stdioSet.Close()
+
+			verifyResponseSuccess(t, rw)
+			if ports := rt.Ports(); !reflect.DeepEqual(ports, test.expectedPorts) {
+				t.Fatalf("dialed ports %v, expected %v", ports, test.expectedPorts)
+			}
+			if (stdioSet.In != nil) != test.in || (stdioSet.Out != nil) != test.out || (stdioSet.Err != nil) != test.err {
+				t.Fatalf("connection set %+v did not match the requested pipes", stdioSet)
+			}
+		})
+	}
+}
+
+func Test_ExecProcess_MultiplexedStdio_DialsOnce(t *testing.T) {
+	pp := prot.ProcessParameters{
+		CreateStdInPipe:  true,
+		CreateStdOutPipe: true,
+		CreateStdErrPipe: true,
+		MultiplexStdio:   true,
+	}
+	ppbytes, _ := json.Marshal(pp)
+	r := &prot.ContainerExecuteProcess{
+		MessageBase: newMessageBase(),
+		Settings: prot.ExecuteProcessSettings{
+			VsockStdioRelaySettings: prot.ExecuteProcessVsockStdioRelaySettings{
+				StdioMux: 4,
+			},
+			ProcessParameters: string(ppbytes),
+		},
+	}
+
+	req, rw := setupRequestResponse(t, prot.ComputeSystemExecuteProcessV1, r)
+
+	ft := new(failureTransport)
+	tb := &Bridge{
+		Transport: ft,
+	}
+	tb.execProcess(rw, req)
+
+	verifyResponseError(t, rw)
+	verifyActivityID(t, r.MessageBase, rw)
+	if ft.dialCount != 1 {
+		t.Fatal("test dial count was not 1")
+	}
+}
+
+func Test_ExecProcess_MultiplexedStdio_NoPort_Failure(t *testing.T) {
+	pp := prot.ProcessParameters{
+		CreateStdOutPipe: true,
+		MultiplexStdio:   true,
+	}
+	ppbytes, _ := json.Marshal(pp)
+	r := &prot.ContainerExecuteProcess{
+		MessageBase: newMessageBase(),
+		Settings: prot.ExecuteProcessSettings{
+			ProcessParameters: string(ppbytes),
+		},
+	}
+
+	req, rw := setupRequestResponse(t, prot.ComputeSystemExecuteProcessV1, r)
+
+	ft := new(failureTransport)
+	tb := &Bridge{
+		Transport: ft,
+	}
+	tb.execProcess(rw, req)
+
+	verifyResponseError(t, rw)
+	verifyActivityID(t, r.MessageBase, rw)
+	if hr, err := gcserr.GetHresult(rw.err); err != nil || hr != gcserr.HrInvalidArg {
+		t.Fatalf("expected HrInvalidArg, got %v (%v)", hr, err)
+	}
+	if ft.dialCount != 0 {
+		t.Fatal("test dial count was not 0")
+	}
+}
+
+func Test_GetProperties_MetadataQuery_Success(t *testing.T) {
+	r := &prot.ContainerGetProperties{
+		MessageBase: newMessageBase(),
+		Query:       `{"PropertyTypes":["ContainerMetadata"]}`,
+	}
+
+	req, rw := setupRequestResponse(t, prot.ComputeSystemGetPropertiesV1, r)
+
+	mc := &mockcore.MockCore{Behavior: mockcore.Success}
+	tb := &Bridge{coreint: mc}
+	tb.getProperties(rw, req)
+
+	verifyResponseSuccess(t, rw)
+	verifyActivityID(t, r.MessageBase, rw)
+	if r.ContainerID != mc.LastGetContainerMetadata.ID {
+		t.Fatal("last get container metadata did not have the same container ID")
+	}
+	if mc.LastListProcesses.ID != "" {
+		t.Fatal("processes were listed for a metadata query")
+	}
+	response := rw.response.(*prot.ContainerGetPropertiesResponse)
+	if response.Properties != `{"ContainerMetadata":{"mockcore":"metadata"}}` {
+		t.Fatalf("response had invalid properties %q", response.Properties)
+	}
+}
+
+func Test_GetProperties_MultipleQuery_Success(t *testing.T) {
+	logrus.SetOutput(ioutil.Discard)
+
+	r := &prot.ContainerGetProperties{
+		MessageBase: newMessageBase(),
+		Query:       `{"PropertyTypes":["ProcessList","Unsupported","ContainerMetadata"]}`,
+	}
+
+	req, rw := setupRequestResponse(t, prot.ComputeSystemGetPropertiesV1, r)
+
+	mc := &mockcore.MockCore{Behavior: mockcore.Success}
+	tb := &Bridge{coreint: mc}
+	tb.getProperties(rw, req)
+
+	verifyResponseSuccess(t, rw)
+	verifyActivityID(t, r.MessageBase, rw)
+	if r.ContainerID != mc.LastListProcesses.ID {
+		t.Fatal("last list processes did not have the same container ID")
+	}
+	if r.ContainerID != mc.LastGetContainerMetadata.ID {
+		t.Fatal("last get container metadata did not have the same container ID")
+	}
+	response := rw.response.(*prot.ContainerGetPropertiesResponse)
+	var properties map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(response.Properties), &properties); err != nil {
+		t.Fatalf("failed to unmarshal properties: %s", err)
+	}
+	if len(properties) != 2 {
+		t.Fatalf("expected 2 properties, got %q", response.Properties)
+	}
+	var processes []runtime.ContainerProcessState
+	if err := json.Unmarshal(properties["ProcessList"], &processes); err != nil {
+		t.Fatalf("failed to unmarshal process list: %s", err)
+	}
+	if len(processes) != 1 || processes[0].Pid != 101 {
+		t.Fatalf("response had invalid process list %s", properties["ProcessList"])
+	}
+	if string(properties["ContainerMetadata"]) != `{"mockcore":"metadata"}` {
+		t.Fatalf("response had invalid metadata %s", properties["ContainerMetadata"])
+	}
+}
+
+func Test_GetProperties_ProcessListQuery_OmitsMetadata(t *testing.T) {
+	r := &prot.ContainerGetProperties{
+		MessageBase: newMessageBase(),
+		Query:       `{"PropertyTypes":["ProcessList"]}`,
+	}
+
+	req, rw := setupRequestResponse(t, prot.ComputeSystemGetPropertiesV1, r)
+
+	mc := &mockcore.MockCore{Behavior: mockcore.Success}
+	tb := &Bridge{coreint: mc}
+	tb.getProperties(rw, req)
+
+	verifyResponseSuccess(t, rw)
+	if mc.LastGetContainerMetadata.ID != "" {
+		t.Fatal("metadata was queried for a process list query")
+	}
+	response := rw.response.(*prot.ContainerGetPropertiesResponse)
+	if !strings.HasPrefix(response.Properties, `{"ProcessList":[`) {
+		t.Fatalf("response had invalid properties %q", response.Properties)
+	}
+}
+
+func Test_GetProperties_CoreFails_Failure(t *testing.T) {
+	r := &prot.ContainerGetProperties{
+		MessageBase: newMessageBase(),
+		Query:       `{"PropertyTypes":["ContainerMetadata"]}`,
+	}
+
+	req, rw := setupRequestResponse(t, prot.ComputeSystemGetPropertiesV1, r)
+
+	tb := &Bridge{coreint: &mockcore.MockCore{Behavior: mockcore.Error}}
+	tb.getProperties(rw, req)
+
+	verifyResponseError(t, rw)
+	verifyActivityID(t, r.MessageBase, rw)
+}
+
+func Test_GetProperties_NoQuery_ListsProcesses(t *testing.T) {
+	r := &prot.ContainerGetProperties{
+		MessageBase: newMessageBase(),
+	}
+
+	req, rw := setupRequestResponse(t, prot.ComputeSystemGetPropertiesV1, r)
+
+	mc := &mockcore.MockCore{Behavior: mockcore.Success}
+	tb := &Bridge{coreint: mc}
+	tb.getProperties(rw, req)
+
+	verifyResponseSuccess(t, rw)
+	if r.ContainerID != mc.LastListProcesses.ID {
+		t.Fatal("last list processes did not have the same container ID")
+	}
+}
+
+func Test_GetProperties_InvalidQuery_Failure(t *testing.T) {
+	r := &prot.ContainerGetProperties{
+		MessageBase: newMessageBase(),
+		Query:       "ContainerMetadata",
+	}
+
+	req, rw := setupRequestResponse(t, prot.ComputeSystemGetPropertiesV1, r)
+
+	tb := &Bridge{coreint: &mockcore.MockCore{Behavior: mockcore.Success}}
+	tb.getProperties(rw, req)
+
+	verifyResponseError(t, rw)
+	verifyActivityID(t, r.MessageBase, rw)
+}
+
+func Test_ModifySettings_ContainerMetadata_Success(t *testing.T) {
+	r := &prot.ContainerModifySettings{
+		MessageBase: newMessageBase(),
+		Request: prot.ResourceModificationRequestResponse{
+			ResourceType: prot.PtContainerMetadata,
+			RequestType:  prot.RtRemove,
+			Settings:     &prot.ContainerMetadata{"key": ""},
+		},
+	}
+
+	req, rw := setupRequestResponse(t, prot.ComputeSystemModifySettingsV1, r)
+
+	mc := &mockcore.MockCore{Behavior: mockcore.Success}
+	tb := &Bridge{coreint: mc}
+	tb.modifySettings(rw, req)
+
+	verifyResponseSuccess(t, rw)
+	if !reflect.DeepEqual(r.Request, mc.LastModifySettings.Request) {
+		t.Fatal("last modify settings did not have equal requests struct")
+	}
+}
+
+// blockingWaitCore is a mock core whose WaitContainer blocks until exit is
+// closed.
+type blockingWaitCore struct {
+	*mockcore.MockCore
+	exit chan struct{}
+}
+
+func (c *blockingWaitCore) WaitContainer(id string) (prot.ContainerExitStatus, error) {
+	<-c.exit
+	return c.MockCore.WaitContainer(id)
+}
+
+func Test_CreateContainer_Delete_PublishesIdleNotification(t *testing.T) {
+	r, _ := createContainerConfig()
+	req, rw := setupRequestResponse(t, prot.ComputeSystemCreateV1, r)
+
+	mc := &blockingWaitCore{
+		MockCore: &mockcore.MockCore{Behavior: mockcore.Success},
+		exit:     make(chan struct{}),
+	}
+	mc.WaitContainerWg.Add(1)
+	b := &Bridge{coreint: mc, IdleTimeout: 10 * time.Millisecond}
+	b.notificationChan = make(chan bridgeResponse)
+	defer close(b.notificationChan)
+	b.startIdleWatchdog()
+	defer b.idle.stop()
+
+	b.createContainer(rw, req)
+	verifyResponseSuccess(t, rw)
+	close(mc.exit)
+
+	// The utility VM may have been reported idle before the container was
+	// created, so skip idle notifications until the exit notification.
+	timeout := time.After(5 * time.Second)
+	nextNotification := func() prot.NotificationType {
+		select {
+		case response := <-b.notificationChan:
+			return response.response.(*prot.ContainerNotification).Type
+		case <-timeout:
+			t.Fatal("timed out waiting for a notification")
+		}
+		return ""
+	}
+	for {
+		nt := nextNotification()
+		if nt == prot.NtUnexpectedExit {
+			break
+		}
+		if nt != prot.NtGcsIdle {
+			t.Fatalf("publish response had invalid type %s", nt)
+		}
+	}
+
+	// The exited container still exists until it is deleted.
+	select {
+	case response := <-b.notificationChan:
+		t.Fatalf("unexpected %s notification before the container was deleted", response.response.(*prot.ContainerNotification).Type)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	dr := &prot.MessageBase{ContainerID: r.ContainerID, ActivityID: r.ActivityID}
+	dreq, drw := setupRequestResponse(t, prot.ComputeSystemDeleteV1, dr)
+	b.deleteContainer(drw, dreq)
+	verifyResponseSuccess(t, drw)
+	if nt := nextNotification(); nt != prot.NtGcsIdle {
+		t.Fatalf("publish response had invalid type %s", nt)
+	}
+}
+
+func Test_IdleWatchdog_DisabledByDefault(t *testing.T) {
+	b := &Bridge{coreint: &mockcore.MockCore{Behavior: mockcore.Success}}
+	b.startIdleWatchdog()
+	if b.idle != nil {
+		t.Fatal("idle watchdog was started without an idle timeout")
+	}
+}
+
+func Test_IdleWatchdog_DoesNotFireWithContainers(t *testing.T) {
+	idle := make(chan struct{}, 10)
+	w := newIdleWatchdog(time.Hour, func() { idle <- struct{}{} })
+	defer w.stop()
+
+	w.containerCreated("a")
+	w.containerCreated("b")
+	w.timeout = time.Millisecond
+	w.containerExited("a")
+	w.containerDeleted("a")
+	w.containerExited("b")
+	select {
+	case <-idle:
+		t.Fatal("idle watchdog fired while a container existed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if !w.deleteExited("b") {
+		t.Fatal("the exited container was not deleted")
+	}
+	select {
+	case <-idle:
+	case <-time.After(5 * time.Second):
+		t.Fatal("idle watchdog did not fire after the last container was deleted")
+	}
+}
+
+func Test_ListContainers_InvalidJson_Failure(t *testing.T) {
+	req, rw := setupRequestResponse(t, prot.ComputeSystemEnumerateV1, nil)
+
+	tb := new(Bridge)
+	tb.listContainers(rw, req)
+
+	verifyResponseJSONError(t, rw)
+	verifyActivityIDEmptyGUID(t, rw)
+}
+
+func Test_ListContainers_CoreFails_Failure(t *testing.T) {
+	r := &prot.MessageBase{ActivityID: newMessageBase().ActivityID}
+	req, rw := setupRequestResponse(t, prot.ComputeSystemEnumerateV1, r)
+
+	tb := &Bridge{coreint: &mockcore.MockCore{Behavior: mockcore.Error}}
+	tb.listContainers(rw, req)
+
+	verifyResponseError(t, rw)
+	verifyActivityID(t, r, rw)
+}
+
+func Test_ListContainers_CoreSucceeds_Success(t *testing.T) {
+	// The request is guest-wide, so it carries no container ID.
+	r := &prot.MessageBase{ActivityID: newMessageBase().ActivityID}
+	req, rw := setupRequestResponse(t, prot.ComputeSystemEnumerateV1, r)
+
+	mc := &mockcore.MockCore{Behavior: mockcore.Success}
+	tb := &Bridge{coreint: mc}
+	tb.listContainers(rw, req)
+
+	verifyResponseSuccess(t, rw)
+	verifyActivityID(t, r, rw)
+	if !mc.ListContainersCalled {
+		t.Fatal("list containers was not called")
+	}
+	response := rw.response.(*prot.ContainerEnumerateResponse)
+	expected := []prot.ContainerInfo{{ID: "mockcore", State: "running", InitPid: 101}}
+	if !reflect.DeepEqual(response.Containers, expected) {
+		t.Fatalf("response had invalid containers %+v", response.Containers)
+	}
+}
+
+func Test_GetContainerState_InvalidJson_Failure(t *testing.T) {
+	req, rw := setupRequestResponse(t, prot.ComputeSystemGetStateV1, nil)
+
+	tb := new(Bridge)
+	tb.getContainerState(rw, req)
+
+	verifyResponseJSONError(t, rw)
+	verifyActivityIDEmptyGUID(t, rw)
+}
+
+func Test_GetContainerState_CoreFails_Failure(t *testing.T) {
+	r := newMessageBase()
+	req, rw := setupRequestResponse(t, prot.ComputeSystemGetStateV1, r)
+
+	tb := &Bridge{coreint: &mockcore.MockCore{Behavior: mockcore.Error}}
+	tb.getContainerState(rw, req)
+
+	verifyResponseError(t, rw)
+	verifyActivityID(t, r, rw)
+}
+
+func Test_GetContainerState_CoreSucceeds_Success(t *testing.T) {
+	r := newMessageBase()
+	req, rw := setupRequestResponse(t, prot.ComputeSystemGetStateV1, r)
+
+	mc := &mockcore.MockCore{Behavior: mockcore.Success}
+	tb := &Bridge{coreint: mc}
+	tb.getContainerState(rw, req)
+
+	verifyResponseSuccess(t, rw)
+	verifyActivityID(t, r, rw)
+	if mc.LastGetContainerState.ID != r.ContainerID {
+		t.Fatal("last get container state did not have the same container ID")
+	}
+	response := rw.response.(*prot.ContainerGetStateResponse)
+	expected := prot.ContainerStatus{State: prot.CsRunning, InitPid: 101, ExitCode: -1}
+	if response.ContainerStatus != expected {
+		t.Fatalf("response had invalid status %+v", response.ContainerStatus)
+	}
+}
+
+func Test_AttachProcess_InvalidJson_Failure(t *testing.T) {
+	req, rw := setupRequestResponse(t, prot.ComputeSystemAttachV1, nil)
+
+	tb := new(Bridge)
+	tb.attachProcess(rw, req)
+
+	verifyResponseJSONError(t, rw)
+	verifyActivityIDEmptyGUID(t, rw)
+}
+
+func Test_AttachProcess_DialFails_Failure(t *testing.T) {
+	r := &prot.ContainerAttachProcess{
+		MessageBase:  newMessageBase(),
+		ProcessID:    20,
+		AttachStdOut: true,
+	}
+	req, rw := setupRequestResponse(t, prot.ComputeSystemAttachV1, r)
+
+	ft := new(failureTransport)
+	mc := &mockcore.MockCore{Behavior: mockcore.Success}
+	tb := &Bridge{Transport: ft, coreint: mc}
+	tb.attachProcess(rw, req)
+
+	verifyResponseError(t, rw)
+	verifyActivityID(t, r.MessageBase, rw)
+	if mc.LastAttachProcess.StdioSet != nil {
+		t.Fatal("attach was called on the core despite the dial failing")
+	}
+}
+
+func Test_AttachProcess_CoreFails_Failure(t *testing.T) {
+	r := &prot.ContainerAttachProcess{
+		MessageBase: newMessageBase(),
+		ProcessID:   20,
+	}
+	req, rw := setupRequestResponse(t, prot.ComputeSystemAttachV1, r)
+
+	tb := &Bridge{
+		Transport: &transport.MockTransport{},
+		coreint:   &mockcore.MockCore{Behavior: mockcore.Error},
+	}
+	tb.attachProcess(rw, req)
+
+	verifyResponseError(t, rw)
+	verifyActivityID(t, r.MessageBase, rw)
+}
+
+func Test_AttachProcess_CoreSucceeds_ReconnectsStreams(t *testing.T) {
+	r := &prot.ContainerAttachProcess{
+		MessageBase:  newMessageBase(),
+		ProcessID:    20,
+		AttachStdOut: true,
+		AttachStdErr: true,
+		VsockStdioRelaySettings: prot.ExecuteProcessVsockStdioRelaySettings{
+			StdOut: 8001,
+			StdErr: 8002,
+		},
+	}
+	req, rw := setupRequestResponse(t, prot.ComputeSystemAttachV1, r)
+
+	hostConns := make(chan *transport.MockConnection, 2)
+	mc := &mockcore.MockCore{Behavior: mockcore.Success}
+	tb := &Bridge{
+		Transport: &transport.MockTransport{Channel: hostConns},
+		coreint:   mc,
+	}
+	tb.attachProcess(rw, req)
+
+	verifyResponseSuccess(t, rw)
+	verifyActivityID(t, r.MessageBase, rw)
+	call := mc.LastAttachProcess
+	if call.ID != r.ContainerID || call.Pid != 20 {
+		t.Fatalf("attach was called with invalid arguments %+v", call)
+	}
+	if call.StdioSet == nil || call.StdioSet.In != nil || call.StdioSet.Out == nil || call.StdioSet.Err == nil {
+		t.Fatalf("attach was not given new stdout and stderr connections: %+v", call.StdioSet)
+	}
+	defer call.StdioSet.Close()
+	if len(hostConns) != 2 {
+		t.Fatalf("expected the transport to be dialed twice, got %d", len(hostConns))
+	}
+
+	// The connections given to the core must reach the host.
+	out, errConn := <-hostConns, <-hostConns
+	defer out.Close()
+	defer errConn.Close()
+	if _, err := call.StdioSet.Out.Write([]byte("output")); err != nil {
+		t.Fatalf("failed to write to reattached stdout: %s", err)
+	}
+	buf := make([]byte, len("output"))
+	if _, err := io.ReadFull(out, buf); err != nil || string(buf) != "output" {
+		t.Fatalf("host did not receive reattached output %q: %v", buf, err)
+	}
+}
+
+func Test_GetProperties_MountsQuery_Success(t *testing.T) {
+	r := &prot.ContainerGetProperties{
+		MessageBase: newMessageBase(),
+		Query:       `{"PropertyTypes":["Mounts"]}`,
+	}
+
+	req, rw := setupRequestResponse(t, prot.ComputeSystemGetPropertiesV1, r)
+
+	mc := &mockcore.MockCore{Behavior: mockcore.Success}
+	tb := &Bridge{coreint: mc}
+	tb.getProperties(rw, req)
+
+	verifyResponseSuccess(t, rw)
+	verifyActivityID(t, r.MessageBase, rw)
+	if r.ContainerID != mc.LastGetMounts.ID {
+		t.Fatal("last get mounts did not have the same container ID")
+	}
+	response := rw.response.(*prot.ContainerGetPropertiesResponse)
+	expected := `{"Mounts":[{"Source":"/dev/sda","Target":"/mockcore","FileSystem":"ext4","Options":["rw"]}]}`
+	if response.Properties != expected {
+		t.Fatalf("response had invalid properties %q", response.Properties)
+	}
+}
+
+func Test_GetProperties_StartTimingsQuery_Success(t *testing.T) {
+	r := &prot.ContainerGetProperties{
+		MessageBase: newMessageBase(),
+		Query:       `{"PropertyTypes":["StartTimings"]}`,
+	}
+
+	req, rw := setupRequestResponse(t, prot.ComputeSystemGetPropertiesV1, r)
+
+	mc := &mockcore.MockCore{Behavior: mockcore.Success}
+	tb := &Bridge{coreint: mc}
+	tb.getProperties(rw, req)
+
+	verifyResponseSuccess(t, rw)
+	verifyActivityID(t, r.MessageBase, rw)
+	if r.ContainerID != mc.LastGetStartTimings.ID {
+		t.Fatal("last get start timings did not have the same container ID")
+	}
+	response := rw.response.(*prot.ContainerGetPropertiesResponse)
+	expected := `{"StartTimings":{"LayerMountMicroseconds":10000,"SandboxMountMicroseconds":0,"OverlayMicroseconds":0,"NetworkMicroseconds":0,"InitExecMicroseconds":0,"TotalMicroseconds":100000}}`
+	if response.Properties != expected {
+		t.Fatalf("response had invalid properties %q", response.Properties)
+	}
+}
+
+func Test_GetProperties_NetworkStatisticsQuery_Success(t *testing.T) {
+	r := &prot.ContainerGetProperties{
+		MessageBase: newMessageBase(),
+		Query:       `{"PropertyTypes":["NetworkStatistics"]}`,
+	}
+
+	req, rw := setupRequestResponse(t, prot.ComputeSystemGetPropertiesV1, r)
+
+	mc := &mockcore.MockCore{Behavior: mockcore.Success}
+	tb := &Bridge{coreint: mc}
+	tb.getProperties(rw, req)
+
+	verifyResponseSuccess(t, rw)
+	verifyActivityID(t, r.MessageBase, rw)
+	if r.ContainerID != mc.LastGetNetworkStats.ID {
+		t.Fatal("last get network stats did not have the same container ID")
+	}
+	response := rw.response.(*prot.ContainerGetPropertiesResponse)
+	var properties struct {
+		NetworkStatistics prot.ContainerNetworkStatistics
+	}
+	if err := json.Unmarshal([]byte(response.Properties), &properties); err != nil {
+		t.Fatalf("response had invalid properties %q: %s", response.Properties, err)
+	}
+	stats := properties.NetworkStatistics
+	if stats.Total.RxBytes != 100 || stats.Total.TxBytes != 200 {
+		t.Fatalf("response had invalid totals %+v", stats.Total)
+	}
+	if len(stats.Adapters) != 1 || stats.Adapters[0].InterfaceName != "eth0" || stats.Adapters[0].RxPackets != 1 {
+		t.Fatalf("response had invalid adapters %+v", stats.Adapters)
+	}
+}
+
+func Test_GetProperties_TimeOffsetQuery_Success(t *testing.T) {
+	r := &prot.ContainerGetProperties{
+		MessageBase: newMessageBase(),
+		Query:       `{"PropertyTypes":["TimeOffset"]}`,
+	}
+
+	req, rw := setupRequestResponse(t, prot.ComputeSystemGetPropertiesV1, r)
+
+	mc := &mockcore.MockCore{Behavior: mockcore.Success}
+	tb := &Bridge{coreint: mc}
+	tb.getProperties(rw, req)
+
+	verifyResponseSuccess(t, rw)
+	verifyActivityID(t, r.MessageBase, rw)
+	if r.ContainerID != mc.LastGetTimeOffset.ID {
+		t.Fatal("last get time offset did not have the same container ID")
+	}
+	response := rw.response.(*prot.ContainerGetPropertiesResponse)
+	expected := `{"TimeOffset":{"MonotonicNanoseconds":3600000000000}}`
+	if response.Properties != expected {
+		t.Fatalf("response had invalid properties %q", response.Properties)
+	}
+}
+
+func Test_GetProperties_OpenFileDescriptorsQuery_Success(t *testing.T) {
+	r := &prot.ContainerGetProperties{
+		MessageBase: newMessageBase(),
+		Query:       `{"PropertyTypes":["OpenFileDescriptors"]}`,
+	}
+
+	req, rw := setupRequestResponse(t, prot.ComputeSystemGetPropertiesV1, r)
+
+	mc := &mockcore.MockCore{Behavior: mockcore.Success}
+	tb := &Bridge{coreint: mc}
+	tb.getProperties(rw, req)
+
+	verifyResponseSuccess(t, rw)
+	verifyActivityID(t, r.MessageBase, rw)
+	if r.ContainerID != mc.LastListProcesses.ID {
+		t.Fatal("last list processes did not have the same container ID")
+	}
+	response := rw.response.(*prot.ContainerGetPropertiesResponse)
+	expected := `{"OpenFileDescriptors":{"Count":3}}`
+	if response.Properties != expected {
+		t.Fatalf("response had invalid properties %q", response.Properties)
+	}
+}
+
+func Test_DeleteContainer_InvalidJson_Failure(t *testing.T) {
+	req, rw := setupRequestResponse(t, prot.ComputeSystemDeleteV1, nil)
+
+	tb := new(Bridge)
+	tb.deleteContainer(rw, req)
+
+	verifyResponseJSONError(t, rw)
+	verifyActivityIDEmptyGUID(t, rw)
+}
+
+func Test_DeleteContainer_CoreFails_Failure(t *testing.T) {
+	r := newMessageBase()
+	req, rw := setupRequestResponse(t, prot.ComputeSystemDeleteV1, r)
+
+	tb := &Bridge{coreint: &mockcore.MockCore{Behavior: mockcore.Error}}
+	tb.deleteContainer(rw, req)
+
+	verifyResponseError(t, rw)
+	verifyActivityID(t, r, rw)
+}
+
+func Test_DeleteContainer_CoreSucceeds_Success(t *testing.T) {
+	r := newMessageBase()
+	req, rw := setupRequestResponse(t, prot.ComputeSystemDeleteV1, r)
+
+	mc := &mockcore.MockCore{Behavior: mockcore.Success}
+	tb := &Bridge{coreint: mc}
+	tb.deleteContainer(rw, req)
+
+	verifyResponseSuccess(t, rw)
+	verifyActivityID(t, r, rw)
+	if mc.LastDeleteContainer.ID != r.ContainerID {
+		t.Fatal("last delete container did not have the same container ID")
+	}
+}
+
+func Test_RestartInit_InvalidJson_Failure(t *testing.T) {
+	req, rw := setupRequestResponse(t, prot.ComputeSystemRestartInitV1, nil)
+
+	tb := new(Bridge)
+	tb.restartInit(rw, req)
+
+	verifyResponseJSONError(t, rw)
+	verifyActivityIDEmptyGUID(t, rw)
+}
+
+func Test_RestartInit_CoreFails_Failure(t *testing.T) {
+	r := newMessageBase()
+	req, rw := setupRequestResponse(t, prot.ComputeSystemRestartInitV1, r)
+
+	tb := &Bridge{coreint: &mockcore.MockCore{Behavior: mockcore.Error}}
+	tb.restartInit(rw, req)
+
+	verifyResponseError(t, rw)
+	verifyActivityID(t, r, rw)
+}
+
+func Test_RestartInit_CoreSucceeds_Success(t *testing.T) {
+	r := newMessageBase()
+	req, rw := setupRequestResponse(t, prot.ComputeSystemRestartInitV1, r)
+
+	mc := &mockcore.MockCore{Behavior: mockcore.Success}
+	tb := &Bridge{coreint: mc}
+	tb.restartInit(rw, req)
+
+	verifyResponseSuccess(t, rw)
+	verifyActivityID(t, r, rw)
+	if mc.LastRestartInit.ID != r.ContainerID {
+		t.Fatal("last restart init did not have the same container ID")
+	}
+}
+
+func Test_WriteProcessStdin_InvalidJson_Failure(t *testing.T) {
+	req, rw := setupRequestResponse(t, prot.ComputeSystemWriteStdinV1, nil)
+
+	tb := new(Bridge)
+	tb.writeProcessStdin(rw, req)
+
+	verifyResponseJSONError(t, rw)
+	verifyActivityIDEmptyGUID(t, rw)
+}
+
+func Test_WriteProcessStdin_TooMuchData_Failure(t *testing.T) {
+	r := &prot.ContainerWriteProcessStdin{
+		MessageBase: newMessageBase(),
+		ProcessID:   20,
+		Data:        make([]byte, prot.MaxWriteStdinBytes+1),
+	}
+	req, rw := setupRequestResponse(t, prot.ComputeSystemWriteStdinV1, r)
+
+	mc := &mockcore.MockCore{Behavior: mockcore.Success}
+	tb := &Bridge{coreint: mc}
+	tb.writeProcessStdin(rw, req)
+
+	verifyResponseError(t, rw)
+	if hr, err := gcserr.GetHresult(rw.err); err != nil || hr != gcserr.HrInvalidArg {
+		t.Fatalf("expected HrInvalidArg, got %v (%v)", hr, err)
+	}
+	if mc.LastWriteProcessStdin.Pid != 0 {
+		t.Fatal("the core was asked to write too much data")
+	}
+}
+
+func Test_WriteProcessStdin_CoreFails_Failure(t *testing.T) {
+	r := &prot.ContainerWriteProcessStdin{
+		MessageBase: newMessageBase(),
+		ProcessID:   20,
+		Data:        []byte("answer\n"),
+	}
+	req, rw := setupRequestResponse(t, prot.ComputeSystemWriteStdinV1, r)
+
+	tb := &Bridge{coreint: &mockcore.MockCore{Behavior: mockcore.Error}}
+	tb.writeProcessStdin(rw, req)
+
+	verifyResponseError(t, rw)
+	verifyActivityID(t, r.MessageBase, rw)
+}
+
+func Test_WriteProcessStdin_CoreSucceeds_ReturnsBytesWritten(t *testing.T) {
+	r := &prot.ContainerWriteProcessStdin{
+		MessageBase: newMessageBase(),
+		ProcessID:   20,
+		Data:        []byte("answer\n"),
+	}
+	req, rw := setupRequestResponse(t, prot.ComputeSystemWriteStdinV1, r)
+
+	mc := &mockcore.MockCore{Behavior: mockcore.Success}
+	tb := &Bridge{coreint: mc}
+	tb.writeProcessStdin(rw, req)
+
+	verifyResponseSuccess(t, rw)
+	verifyActivityID(t, r.MessageBase, rw)
+	if mc.LastWriteProcessStdin.ID != r.ContainerID || mc.LastWriteProcessStdin.Pid != 20 || !bytes.Equal(mc.LastWriteProcessStdin.Data, r.Data) {
+		t.Fatalf("core was called with unexpected arguments %+v", mc.LastWriteProcessStdin)
+	}
+	response := rw.response.(*prot.ContainerWriteProcessStdinResponse)
+	if response.BytesWritten != uint32(len(r.Data)) {
+		t.Fatalf("response reported %d bytes written, expected %d", response.BytesWritten, len(r.Data))
+	}
+}
+
+func Test_GetGuestInfo_InvalidJson_Failure(t *testing.T) {
+	req, rw := setupRequestResponse(t, prot.ComputeSystemGetGuestInfoV1, nil)
+
+	tb := new(Bridge)
+	tb.getGuestInfo(rw, req)
+
+	verifyResponseJSONError(t, rw)
+	verifyActivityIDEmptyGUID(t, rw)
+}
+
+func Test_GetGuestInfo_CoreFails_Failure(t *testing.T) {
+	r := newMessageBase()
+	req, rw := setupRequestResponse(t, prot.ComputeSystemGetGuestInfoV1, r)
+
+	tb := &Bridge{coreint: &mockcore.MockCore{Behavior: mockcore.Error}}
+	tb.getGuestInfo(rw, req)
+
+	verifyResponseError(t, rw)
+	verifyActivityID(t, r, rw)
+}
+
+func Test_GetGuestInfo_NoContainerID_Success(t *testing.T) {
+	r := newMessageBase()
+	r.ContainerID = ""
+	req, rw := setupRequestResponse(t, prot.ComputeSystemGetGuestInfoV1, r)
+
+	mc := &mockcore.MockCore{Behavior: mockcore.Success}
+	tb := &Bridge{coreint: mc}
+	tb.getGuestInfo(rw, req)
+
+	verifyResponseSuccess(t, rw)
+	verifyActivityID(t, r, rw)
+	if !mc.GetGuestInfoCalled {
+		t.Fatal("core was not asked for guest information")
+	}
+	response := rw.response.(*prot.ContainerGetGuestInfoResponse)
+	if response.KernelVersion != "4.14.0-mockcore" || response.GCSVersion != "mockcore" {
+		t.Fatalf("response reported unexpected versions %+v", response.GuestInfo)
+	}
+	if len(response.Features) != 1 || response.Features[0] != prot.GuestFeatureSeccomp {
+		t.Fatalf("response reported unexpected features %v", response.Features)
+	}
+}
+
+// deletableCore is a mock core whose containers never exit. Waits for a
+// container return a cancellation error once it is deleted.
+type deletableCore struct {
+	*mockcore.MockCore
+	deleted chan struct{}
+}
+
+func (c *deletableCore) WaitContainer(id string) (prot.ContainerExitStatus, error) {
+	<-c.deleted
+	return prot.ContainerExitStatus{ExitCode: -1}, errors.Wrapf(context.Canceled, "container %s was deleted", id)
+}
+
+func (c *deletableCore) DeleteContainer(id string) error {
+	close(c.deleted)
+	return c.MockCore.DeleteContainer(id)
+}
+
+func Test_CreateContainer_DeletedBeforeStart_NoNotification(t *testing.T) {
+	r, _ := createContainerConfig()
+	req, rw := setupRequestResponse(t, prot.ComputeSystemCreateV1, r)
+
+	mc := &deletableCore{
+		MockCore: &mockcore.MockCore{Behavior: mockcore.Success},
+		deleted:  make(chan struct{}),
+	}
+	b := &Bridge{coreint: mc}
+	b.notificationChan = make(chan bridgeResponse)
+
+	b.createContainer(rw, req)
+	verifyResponseSuccess(t, rw)
+
+	deleteReq, deleteRw := setupRequestResponse(t, prot.ComputeSystemDeleteV1, r.MessageBase)
+	b.deleteContainer(deleteRw, deleteReq)
+	verifyResponseSuccess(t, deleteRw)
+
+	select {
+	case response := <-b.notificationChan:
+		t.Fatalf("unexpected notification for a deleted container: %+v", response.response)
+	case <-time.After(500 * time.Millisecond):
+	}
+}
+
+func Test_ExecProcess_InvalidProcessParameters_Rejected(t *testing.T) {
+	tests := []struct {
+		name     string
+		params   string
+		expected string
+	}{
+		{
+			name:     "both command forms",
+			params:   `{"CommandLine":"sleep 100","CommandArgs":["sleep","100"]}`,
+			expected: "CommandArgs and CommandLine are mutually exclusive",
+		},
+		{
+			name:     "empty program",
+			params:   `{"CommandArgs":["","100"]}`,
+			expected: "CommandArgs[0], the program to run, is empty",
+		},
+		{
+			name:     "wrong field type",
+			params:   `{"CommandArgs":"sleep 100"}`,
+			expected: "ProcessParameters field CommandArgs must be a []string, not a JSON string",
+		},
+		{
+			name:     "control frames without multiplexing",
+			params:   `{"CommandLine":"sh","StdioControl":true}`,
+			expected: "StdioControl requires MultiplexStdio",
+		},
+		{
+			name:     "unknown relay failure policy",
+			params:   `{"CommandLine":"sh","RelayFailurePolicy":"Restart"}`,
+			expected: "unknown relay failure policy \"Restart\"",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := &prot.ContainerExecuteProcess{
+				MessageBase: newMessageBase(),
+				Settings: prot.ExecuteProcessSettings{
+					ProcessParameters: test.params,
+				},
+			}
+			req, rw := setupRequestResponse(t, prot.ComputeSystemExecuteProcessV1, r)
+
+			mc := &mockcore.MockCore{Behavior: mockcore.Success}
+			tb := &Bridge{coreint: mc}
+			tb.execProcess(rw, req)
+
+			verifyResponseError(t, rw)
+			verifyActivityID(t, r.MessageBase, rw)
+			if !strings.Contains(rw.err.Error(), test.expected) {
+				t.Fatalf("response error %q did not contain %q", rw.err, test.expected)
+			}
+			if mc.LastExecProcess.ID != "" {
+				t.Fatal("the core was asked to exec a process with invalid parameters")
+			}
+		})
+	}
+}
+
+func Test_ExecProcess_CommandArgs_PassedToCore(t *testing.T) {
+	pp := prot.ProcessParameters{
+		CommandArgs: []string{"sleep", "100"},
+	}
+	ppbytes, _ := json.Marshal(pp)
+	r := &prot.ContainerExecuteProcess{
+		MessageBase: newMessageBase(),
+		Settings: prot.ExecuteProcessSettings{
+			ProcessParameters: string(ppbytes),
+		},
+	}
+	req, rw := setupRequestResponse(t, prot.ComputeSystemExecuteProcessV1, r)
+
+	mc := &mockcore.MockCore{Behavior: mockcore.Success}
+	tb := &Bridge{coreint: mc}
+	tb.execProcess(rw, req)
+
+	verifyResponseSuccess(t, rw)
+	if !reflect.DeepEqual(mc.LastExecProcess.Params.CommandArgs, pp.CommandArgs) {
+		t.Fatalf("last exec process had invalid CommandArgs %v", mc.LastExecProcess.Params.CommandArgs)
+	}
+}
+
+func Test_ReadFile_InvalidJson_Failure(t *testing.T) {
+	req, rw := setupRequestResponse(t, prot.ComputeSystemReadFileV1, nil)
+
+	tb := new(Bridge)
+	tb.readFile(rw, req)
+
+	verifyResponseJSONError(t, rw)
+	verifyActivityIDEmptyGUID(t, rw)
+}
+
+func Test_ReadFile_CoreFails_Failure(t *testing.T) {
+	r := &prot.ContainerReadFile{
+		MessageBase: newMessageBase(),
+		Path:        "/var/log/app.log",
+	}
+	req, rw := setupRequestResponse(t, prot.ComputeSystemReadFileV1, r)
+
+	tb := &Bridge{coreint: &mockcore.MockCore{Behavior: mockcore.Error}}
+	tb.readFile(rw, req)
+
+	verifyResponseError(t, rw)
+	verifyActivityID(t, r.MessageBase, rw)
+}
+
+func Test_ReadFile_Inline_ReturnsContents(t *testing.T) {
+	r := &prot.ContainerReadFile{
+		MessageBase: newMessageBase(),
+		Path:        "/var/log/app.log",
+	}
+	req, rw := setupRequestResponse(t, prot.ComputeSystemReadFileV1, r)
+
+	mc := &mockcore.MockCore{Behavior: mockcore.Success}
+	tb := &Bridge{coreint: mc}
+	tb.readFile(rw, req)
+
+	verifyResponseSuccess(t, rw)
+	verifyActivityID(t, r.MessageBase, rw)
+	if mc.LastOpenContainerFile.ID != r.ContainerID || mc.LastOpenContainerFile.Path != r.Path {
+		t.Fatalf("core was called with unexpected arguments %+v", mc.LastOpenContainerFile)
+	}
+	response := rw.response.(*prot.ContainerReadFileResponse)
+	if string(response.Contents) != mockcore.MockFileContents || response.Size != int64(len(mockcore.MockFileContents)) {
+		t.Fatalf("response returned %d bytes %q, expected %q", response.Size, response.Contents, mockcore.MockFileContents)
+	}
+}
+
+func Test_ReadFile_Port_StreamsContents(t *testing.T) {
+	r := &prot.ContainerReadFile{
+		MessageBase: newMessageBase(),
+		Path:        "/var/log/app.log",
+		Port:        1234,
+	}
+	req, rw := setupRequestResponse(t, prot.ComputeSystemReadFileV1, r)
+
+	mt := &transport.MockTransport{Channel: make(chan *transport.MockConnection, 1)}
+	tb := &Bridge{coreint: &mockcore.MockCore{Behavior: mockcore.Success}, Transport: mt}
+	tb.readFile(rw, req)
+
+	verifyResponseSuccess(t, rw)
+	response := rw.response.(*prot.ContainerReadFileResponse)
+	if len(response.Contents) != 0 || response.Size != int64(len(mockcore.MockFileContents)) {
+		t.Fatalf("response returned %d bytes %q, expected only the size", response.Size, response.Contents)
+	}
+	conn := <-mt.Channel
+	defer conn.Close()
+	received := make([]byte, len(mockcore.MockFileContents))
+	if _, err := io.ReadFull(conn, received); err != nil {
+		t.Fatalf("failed to read from the relay port: %s", err)
+	}
+	if string(received) != mockcore.MockFileContents {
+		t.Fatalf("relay port received %q, expected %q", received, mockcore.MockFileContents)
+	}
+}
+
+func Test_ReadFile_ListenForHost_StreamsContents(t *testing.T) {
+	r := &prot.ContainerReadFile{
+		MessageBase:   newMessageBase(),
+		Path:          "/var/log/app.log",
+		ListenForHost: true,
+	}
+	req, rw := setupRequestResponse(t, prot.ComputeSystemReadFileV1, r)
+
+	mt := &transport.MockTransport{}
+	tb := &Bridge{coreint: &mockcore.MockCore{Behavior: mockcore.Success}, Transport: mt}
+	tb.readFile(rw, req)
+
+	verifyResponseSuccess(t, rw)
+	response := rw.response.(*prot.ContainerReadFileResponse)
+	if response.ListenPort == 0 {
+		t.Fatal("response did not advertise a listen port")
+	}
+	if len(response.Contents) != 0 || response.Size != int64(len(mockcore.MockFileContents)) {
+		t.Fatalf("response returned %d bytes %q, expected only the size", response.Size, response.Contents)
+	}
+	conn, err := mt.Dial(response.ListenPort)
+	if err != nil {
+		t.Fatalf("failed to connect to the advertised port: %s", err)
+	}
+	defer conn.Close()
+	received := make([]byte, len(mockcore.MockFileContents))
+	if _, err := io.ReadFull(conn, received); err != nil {
+		t.Fatalf("failed to read from the advertised port: %s", err)
+	}
+	if string(received) != mockcore.MockFileContents {
+		t.Fatalf("advertised port received %q, expected %q", received, mockcore.MockFileContents)
+	}
+}
+
+func Test_ReadFile_ListenForHostWithPort_Failure(t *testing.T) {
+	r := &prot.ContainerReadFile{
+		MessageBase:   newMessageBase(),
+		Path:          "/var/log/app.log",
+		Port:          1234,
+		ListenForHost: true,
+	}
+	req, rw := setupRequestResponse(t, prot.ComputeSystemReadFileV1, r)
+
+	tb := &Bridge{coreint: &mockcore.MockCore{Behavior: mockcore.Success}, Transport: &transport.MockTransport{}}
+	tb.readFile(rw, req)
+
+	verifyResponseError(t, rw)
+	if hr, err := gcserr.GetHresult(rw.err); err != nil || hr != gcserr.HrInvalidArg {
+		t.Fatalf("expected HrInvalidArg, got %v (%v)", hr, err)
+	}
+}
+
+// largeFileCore is a mock core whose files are too large to be returned
+// inline.
+type largeFileCore struct {
+	*mockcore.MockCore
+}
+
+func (c *largeFileCore) OpenContainerFile(id, path string) (io.ReadCloser, int64, error) {
+	f, _, err := c.MockCore.OpenContainerFile(id, path)
+	return f, prot.MaxReadFileInlineBytes + 1, err
+}
+
+func Test_ReadFile_InlineTooLarge_Failure(t *testing.T) {
+	r := &prot.ContainerReadFile{
+		MessageBase: newMessageBase(),
+		Path:        "/var/log/app.log",
+	}
+	req, rw := setupRequestResponse(t, prot.ComputeSystemReadFileV1, r)
+
+	tb := &Bridge{coreint: &largeFileCore{&mockcore.MockCore{Behavior: mockcore.Success}}}
+	tb.readFile(rw, req)
+
+	verifyResponseError(t, rw)
+	if hr, err := gcserr.GetHresult(rw.err); err != nil || hr != gcserr.HrInvalidArg {
+		t.Fatalf("expected HrInvalidArg, got %v (%v)", hr, err)
+	}
+}
+
+func Test_WriteFile_InvalidJson_Failure(t *testing.T) {
+	req, rw := setupRequestResponse(t, prot.ComputeSystemWriteFileV1, nil)
+
+	tb := new(Bridge)
+	tb.writeFile(rw, req)
+
+	verifyResponseJSONError(t, rw)
+	verifyActivityIDEmptyGUID(t, rw)
+}
+
+func Test_WriteFile_CoreFails_Failure(t *testing.T) {
+	r := &prot.ContainerWriteFile{
+		MessageBase: newMessageBase(),
+		Path:        "/etc/app/secret.conf",
+		Mode:        0600,
+		Contents:    []byte("token=abc\n"),
+	}
+	req, rw := setupRequestResponse(t, prot.ComputeSystemWriteFileV1, r)
+
+	tb := &Bridge{coreint: &mockcore.MockCore{Behavior: mockcore.Error}}
+	tb.writeFile(rw, req)
+
+	verifyResponseError(t, rw)
+	verifyActivityID(t, r.MessageBase, rw)
+}
+
+func Test_WriteFile_TooMuchData_Failure(t *testing.T) {
+	r := &prot.ContainerWriteFile{
+		MessageBase: newMessageBase(),
+		Path:        "/etc/app/secret.conf",
+		Mode:        0600,
+		Contents:    make([]byte, prot.MaxWriteFileInlineBytes+1),
+	}
+	req, rw := setupRequestResponse(t, prot.ComputeSystemWriteFileV1, r)
+
+	mc := &mockcore.MockCore{Behavior: mockcore.Success}
+	tb := &Bridge{coreint: mc}
+	tb.writeFile(rw, req)
+
+	verifyResponseError(t, rw)
+	if hr, err := gcserr.GetHresult(rw.err); err != nil || hr != gcserr.HrInvalidArg {
+		t.Fatalf("expected HrInvalidArg, got %v (%v)", hr, err)
+	}
+	if mc.LastWriteContainerFile.Path != "" {
+		t.Fatal("the core was asked to write too much data")
+	}
+}
+
+func Test_WriteFile_Inline_WritesContents(t *testing.T) {
+	r := &prot.ContainerWriteFile{
+		MessageBase: newMessageBase(),
+		Path:        "/usr/local/bin/tool",
+		Mode:        04755,
+		Contents:    []byte("#!/bin/sh\n"),
+	}
+	req, rw := setupRequestResponse(t, prot.ComputeSystemWriteFileV1, r)
+
+	mc := &mockcore.MockCore{Behavior: mockcore.Success}
+	tb := &Bridge{coreint: mc}
+	tb.writeFile(rw, req)
+
+	verifyResponseSuccess(t, rw)
+	verifyActivityID(t, r.MessageBase, rw)
+	call := mc.LastWriteContainerFile
+	if call.ID != r.ContainerID || call.Path != r.Path || call.Mode != os.ModeSetuid|0755 || !bytes.Equal(call.Contents, r.Contents) {
+		t.Fatalf("core was called with unexpected arguments %+v", call)
+	}
+	response := rw.response.(*prot.ContainerWriteFileResponse)
+	if response.Size != int64(len(r.Contents)) {
+		t.Fatalf("response reported %d bytes written, expected %d", response.Size, len(r.Contents))
+	}
+}
+
+func Test_WriteFile_Port_ReadsContents(t *testing.T) {
+	r := &prot.ContainerWriteFile{
+		MessageBase: newMessageBase(),
+		Path:        "/etc/app/secret.conf",
+		Mode:        0600,
+		Port:        1234,
+	}
+	req, rw := setupRequestResponse(t, prot.ComputeSystemWriteFileV1, r)
+
+	mt := &transport.MockTransport{Channel: make(chan *transport.MockConnection, 1)}
+	go func() {
+		conn := <-mt.Channel
+		defer conn.Close()
+		conn.Write([]byte("token=abc\n"))
+		conn.CloseWrite()
+	}()
+	mc := &mockcore.MockCore{Behavior: mockcore.Success}
+	tb := &Bridge{coreint: mc, Transport: mt}
+	tb.writeFile(rw, req)
+
+	verifyResponseSuccess(t, rw)
+	if string(mc.LastWriteContainerFile.Contents) != "token=abc\n" {
+		t.Fatalf("core was given contents %q, expected those sent to the relay port", mc.LastWriteContainerFile.Contents)
+	}
+}
+
+func Test_GetResourceUsage_InvalidJson_Failure(t *testing.T) {
+	req, rw := setupRequestResponse(t, prot.ComputeSystemGetResourceUsageV1, nil)
+
+	tb := new(Bridge)
+	tb.getResourceUsage(rw, req)
+
+	verifyResponseJSONError(t, rw)
+	verifyActivityIDEmptyGUID(t, rw)
+}
+
+func Test_GetResourceUsage_CoreFails_Failure(t *testing.T) {
+	r := newMessageBase()
+	req, rw := setupRequestResponse(t, prot.ComputeSystemGetResourceUsageV1, r)
+
+	tb := &Bridge{coreint: &mockcore.MockCore{Behavior: mockcore.Error}}
+	tb.getResourceUsage(rw, req)
+
+	verifyResponseError(t, rw)
+	verifyActivityID(t, r, rw)
+}
+
+func Test_GetResourceUsage_NoContainerID_Success(t *testing.T) {
+	r := newMessageBase()
+	r.ContainerID = ""
+	req, rw := setupRequestResponse(t, prot.ComputeSystemGetResourceUsageV1, r)
+
+	mc := &mockcore.MockCore{Behavior: mockcore.Success}
+	tb := &Bridge{coreint: mc}
+	tb.getResourceUsage(rw, req)
+
+	verifyResponseSuccess(t, rw)
+	verifyActivityID(t, r, rw)
+	if !mc.GetGCSResourceUsageCalled {
+		t.Fatal("core was not asked for the GCS's resource usage")
+	}
+	response := rw.response.(*prot.ContainerGetResourceUsageResponse)
+	expected := prot.GCSResourceUsage{ResidentSetBytes: 16 << 20, Goroutines: 10, OpenFileDescriptors: 7}
+	if response.GCSResourceUsage != expected {
+		t.Fatalf("response reported %+v, expected %+v", response.GCSResourceUsage, expected)
+	}
+}
@@ -1,14 +1,21 @@
 package bridge
 
 import (
+	"bytes"
 	"encoding/binary"
 	"encoding/json"
+	"hash/crc32"
 	"io"
 	"io/ioutil"
+	"os"
+	"regexp"
 	"strings"
 	"sync"
+	"syscall"
 	"testing"
+	"time"
 
+	"github.com/Microsoft/opengcs/service/gcs/core/mockcore"
 	"github.com/Microsoft/opengcs/service/gcs/gcserr"
 	"github.com/Microsoft/opengcs/service/gcs/prot"
 	"github.com/Microsoft/opengcs/service/gcs/transport"
@@ -351,6 +358,10 @@ func (e *errorTransport) Dial(_ uint32) (transport.Connection, error) {
 	return nil, e.e
 }
 
+func (e *errorTransport) Listen(_ uint32) (transport.Listener, error) {
+	return nil, e.e
+}
+
 func Test_Bridge_ListenAndServe_NoTransport_Fails(t *testing.T) {
 	defer func() {
 		if r := recover(); r == nil {
@@ -567,6 +578,92 @@ func Test_Bridge_ListenAndServe_CorrectHandler_Success(t *testing.T) {
 	}
 }
 
+// syncBuffer is a bytes.Buffer which is safe to write to from the bridge's
+// goroutines while the test reads from it.
+type syncBuffer struct {
+	m   sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.buf.String()
+}
+
+func Test_Bridge_ListenAndServe_MalformedRequest_SecretsRedacted(t *testing.T) {
+	logs := &syncBuffer{}
+	logrus.SetOutput(logs)
+	logrus.SetLevel(logrus.DebugLevel)
+	defer func() {
+		logrus.SetOutput(ioutil.Discard)
+		logrus.SetLevel(logrus.InfoLevel)
+	}()
+
+	mtc := make(chan *transport.MockConnection)
+	defer close(mtc)
+	mt := &transport.MockTransport{Channel: mtc}
+	mux := NewBridgeMux()
+	b := &Bridge{
+		Transport: mt,
+		Handler:   mux,
+	}
+	mux.HandleFunc(prot.ComputeSystemCreateV1, b.createContainer)
+
+	go func() {
+		if err := b.ListenAndServe(); err != nil {
+			t.Error(err)
+		}
+	}()
+	defer func() {
+		b.quitChan <- true
+	}()
+
+	clientConnection := <-mtc
+	message := &prot.ContainerCreate{
+		MessageBase: &prot.MessageBase{
+			ContainerID: "01234567-89ab-cdef-0123-456789abcdef",
+			ActivityID:  "00000000-0000-0000-0000-000000000001",
+		},
+		ContainerConfig: `{"Layers": 5, "StorageAccountKey": "hunter2"}`,
+	}
+	if err := serverSend(clientConnection, prot.ComputeSystemCreateV1, prot.SequenceID(1), message); err != nil {
+		t.Fatal("Failed to send message to server")
+	}
+	_, body, err := serverRead(clientConnection)
+	if err != nil {
+		t.Fatal("Failed to read message response from server")
+	}
+	if strings.Contains(string(body), "hunter2") {
+		t.Fatalf("response contained a secret value: %s", body)
+	}
+	if !strings.Contains(string(body), redactedValue) {
+		t.Fatalf("response did not contain the redaction marker: %s", body)
+	}
+
+	// The response is logged after it has been written, so wait for it.
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(logs.String(), "response sent") {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the response to be logged")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	logged := logs.String()
+	if !strings.Contains(logged, "read message") || !strings.Contains(logged, "failed to unmarshal request") {
+		t.Fatalf("request was not logged: %s", logged)
+	}
+	if strings.Contains(logged, "hunter2") {
+		t.Fatalf("logs contained a secret value: %s", logged)
+	}
+}
+
 func Test_Bridge_ListenAndServe_HandlersAreAsync_Success(t *testing.T) {
 	// Turn off logging so as not to spam output.
 	logrus.SetOutput(ioutil.Discard)
@@ -648,3 +745,869 @@ func Test_Bridge_ListenAndServe_HandlersAreAsync_Success(t *testing.T) {
 		t.Error("Incorrect response order for 1st request")
 	}
 }
+
+// shortWriteConnection accepts at most max bytes per write without returning
+// an error, simulating a connection which performs short writes.
+type shortWriteConnection struct {
+	bytes.Buffer
+	max    int
+	writes int
+}
+
+func (c *shortWriteConnection) Write(p []byte) (int, error) {
+	c.writes++
+	if len(p) > c.max {
+		p = p[:c.max]
+	}
+	return c.Buffer.Write(p)
+}
+
+func Test_Bridge_WriteResponse_ShortWrites_WritesWholeMessage(t *testing.T) {
+	conn := &shortWriteConnection{max: 3}
+	resp := bridgeResponse{
+		header: &prot.MessageHeader{
+			Type: prot.ComputeSystemResponseCreateV1,
+			ID:   7,
+		},
+		response: &prot.MessageResponseBase{
+			ActivityID: "00000000-0000-0000-0000-000000000001",
+		},
+	}
+
+	payload, err := writeResponse(conn, resp, false)
+	if err != nil {
+		t.Fatalf("failed to write response: %s", err)
+	}
+	if conn.writes < 2 {
+		t.Fatalf("expected the message to need multiple writes, got %d", conn.writes)
+	}
+
+	var header prot.MessageHeader
+	if err := binary.Read(&conn.Buffer, binary.LittleEndian, &header); err != nil {
+		t.Fatalf("failed to read message header: %s", err)
+	}
+	if header.Type != prot.ComputeSystemResponseCreateV1 || header.ID != 7 {
+		t.Fatalf("message header was corrupted: %+v", header)
+	}
+	if int(header.Size) != prot.MessageHeaderSize+len(payload) {
+		t.Fatalf("message header had size %d for a %d byte payload", header.Size, len(payload))
+	}
+	written, _ := ioutil.ReadAll(&conn.Buffer)
+	if !bytes.Equal(written, payload) {
+		t.Fatalf("message payload was corrupted: %q", written)
+	}
+	var base prot.MessageResponseBase
+	if err := json.Unmarshal(written, &base); err != nil || base.ActivityID != "00000000-0000-0000-0000-000000000001" {
+		t.Fatalf("message payload did not round trip: %q (%v)", written, err)
+	}
+}
+
+// stalledWriter accepts no bytes and returns no error.
+type stalledWriter struct{}
+
+func (stalledWriter) Write(p []byte) (int, error) {
+	return 0, nil
+}
+
+func Test_Bridge_WriteFull_NoProgress_Failure(t *testing.T) {
+	if err := writeFull(stalledWriter{}, []byte("message")); err != io.ErrShortWrite {
+		t.Fatalf("expected io.ErrShortWrite, got %v", err)
+	}
+}
+
+func Test_Bridge_WriteFull_WriteError_Failure(t *testing.T) {
+	expected := errors.New("connection reset")
+	if err := writeFull(&errorWriter{err: expected}, []byte("message")); err != expected {
+		t.Fatalf("expected the write error, got %v", err)
+	}
+}
+
+// errorWriter fails every write with err.
+type errorWriter struct {
+	err error
+}
+
+func (w *errorWriter) Write(p []byte) (int, error) {
+	return 0, w.err
+}
+
+// frame serializes a message with the given type, ID and body, followed by
+// checksum if it is not nil.
+func frame(t *testing.T, messageType prot.MessageIdentifier, id prot.SequenceID, body []byte, checksum []byte) *bytes.Buffer {
+	header := prot.MessageHeader{
+		Type: messageType,
+		ID:   id,
+		Size: uint32(prot.MessageHeaderSize + len(body) + len(checksum)),
+	}
+	buf := &bytes.Buffer{}
+	if err := binary.Write(buf, binary.LittleEndian, &header); err != nil {
+		t.Fatalf("failed to write header: %s", err)
+	}
+	buf.Write(body)
+	buf.Write(checksum)
+	return buf
+}
+
+func checksumOf(body []byte) []byte {
+	checksum := make([]byte, prot.ChecksumSize)
+	binary.LittleEndian.PutUint32(checksum, crc32.ChecksumIEEE(body))
+	return checksum
+}
+
+func Test_Bridge_ReadRequest_Unchecked_Success(t *testing.T) {
+	body := []byte(`{"ContainerId":"abc"}`)
+	req, checksummed, err := readRequest(frame(t, prot.ComputeSystemCreateV1, 3, body, nil))
+	if err != nil {
+		t.Fatalf("failed to read request: %s", err)
+	}
+	if checksummed {
+		t.Fatal("unchecked request was reported as checksummed")
+	}
+	if req.Header.Type != prot.ComputeSystemCreateV1 || req.Header.ID != 3 || !bytes.Equal(req.Message, body) {
+		t.Fatalf("request was not read intact: %+v %q", req.Header, req.Message)
+	}
+}
+
+func Test_Bridge_ReadRequest_GoodChecksum_Success(t *testing.T) {
+	body := []byte(`{"ContainerId":"abc"}`)
+	req, checksummed, err := readRequest(frame(t, prot.ComputeSystemCreateV1|prot.MessageFlagChecksum, 3, body, checksumOf(body)))
+	if err != nil {
+		t.Fatalf("failed to read request: %s", err)
+	}
+	if !checksummed {
+		t.Fatal("checksummed request was not reported as checksummed")
+	}
+	if req.Header.Type != prot.ComputeSystemCreateV1 {
+		t.Fatalf("checksum flag was not cleared from the type: 0x%x", req.Header.Type)
+	}
+	if !bytes.Equal(req.Message, body) {
+		t.Fatalf("checksum was not removed from the message: %q", req.Message)
+	}
+}
+
+func Test_Bridge_ReadRequest_CorruptFrame_Failure(t *testing.T) {
+	body := []byte(`{"ContainerId":"abc"}`)
+	checksum := checksumOf(body)
+	corrupted := append([]byte{}, body...)
+	corrupted[2] ^= 0xff
+	buf := frame(t, prot.ComputeSystemCreateV1|prot.MessageFlagChecksum, 3, corrupted, checksum)
+	// A following message must still be readable after the corrupt one.
+	buf.Write(frame(t, prot.ComputeSystemCreateV1, 4, body, nil).Bytes())
+
+	_, _, err := readRequest(buf)
+	corrupt, ok := err.(*corruptFrameError)
+	if !ok {
+		t.Fatalf("expected a corrupt frame error, got %v", err)
+	}
+	if corrupt.header.ID != 3 || corrupt.header.Type != prot.ComputeSystemCreateV1 {
+		t.Fatalf("corrupt frame error had invalid header %+v", corrupt.header)
+	}
+
+	req, _, err := readRequest(buf)
+	if err != nil || req.Header.ID != 4 {
+		t.Fatalf("failed to read the message after the corrupt frame: %v", err)
+	}
+}
+
+// trickleConnection returns the bytes of r one at a time. If eagain is set,
+// every other read fails with EAGAIN, as a non-blocking socket with no data
+// ready would.
+type trickleConnection struct {
+	r      io.Reader
+	eagain bool
+	reads  int
+}
+
+func (c *trickleConnection) Read(p []byte) (int, error) {
+	c.reads++
+	if c.eagain && c.reads%2 == 1 {
+		return 0, &os.SyscallError{Syscall: "read", Err: syscall.EAGAIN}
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	return c.r.Read(p[:1])
+}
+
+func Test_Bridge_ReadRequest_ShortReads_Reassembled(t *testing.T) {
+	body := []byte(`{"ContainerId":"abc"}`)
+	for _, eagain := range []bool{false, true} {
+		conn := &trickleConnection{r: frame(t, prot.ComputeSystemCreateV1|prot.MessageFlagChecksum, 3, body, checksumOf(body)), eagain: eagain}
+		req, checksummed, err := readRequest(conn)
+		if err != nil {
+			t.Fatalf("failed to read request with EAGAIN %v: %s", eagain, err)
+		}
+		if !checksummed || req.Header.Type != prot.ComputeSystemCreateV1 || req.Header.ID != 3 || !bytes.Equal(req.Message, body) {
+			t.Fatalf("request was not reassembled with EAGAIN %v: %+v %q", eagain, req.Header, req.Message)
+		}
+	}
+}
+
+func Test_Bridge_ReadRequest_TruncatedHeader_UnexpectedEOF(t *testing.T) {
+	buf := frame(t, prot.ComputeSystemCreateV1, 3, nil, nil)
+	buf.Truncate(prot.MessageHeaderSize - 1)
+
+	_, _, err := readRequest(&trickleConnection{r: buf})
+	if errors.Cause(err) != io.ErrUnexpectedEOF {
+		t.Fatalf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+func Test_Bridge_RejectCorruptFrame_RespondsWithError(t *testing.T) {
+	b := &Bridge{responseChan: make(chan bridgeResponse, 1)}
+	b.rejectCorruptFrame(&prot.MessageHeader{Type: prot.ComputeSystemCreateV1, ID: 9}, &corruptFrameError{})
+
+	resp := <-b.responseChan
+	if resp.header.Type != prot.ComputeSystemResponseCreateV1 || resp.header.ID != 9 {
+		t.Fatalf("error response had invalid header %+v", resp.header)
+	}
+	base := resp.response.(*prot.MessageResponseBase)
+	if base.Result != int32(gcserr.HrInvalidArg) {
+		t.Fatalf("error response had invalid result 0x%x", uint32(base.Result))
+	}
+}
+
+func Test_Bridge_WriteResponse_Checksum_RoundTrips(t *testing.T) {
+	buf := &bytes.Buffer{}
+	resp := bridgeResponse{
+		header:   &prot.MessageHeader{Type: prot.ComputeSystemResponseCreateV1, ID: 5},
+		response: &prot.MessageResponseBase{ActivityID: "activity"},
+	}
+	payload, err := writeResponse(buf, resp, true)
+	if err != nil {
+		t.Fatalf("failed to write response: %s", err)
+	}
+	if resp.header.Type != prot.ComputeSystemResponseCreateV1 {
+		t.Fatal("writing a checksummed response modified the response's header")
+	}
+
+	req, checksummed, err := readRequest(buf)
+	if err != nil {
+		t.Fatalf("failed to read back response: %s", err)
+	}
+	if !checksummed || !bytes.Equal(req.Message, payload) || req.Header.ID != 5 {
+		t.Fatalf("checksummed response did not round trip: %+v %q", req.Header, req.Message)
+	}
+}
+
+func Test_Bridge_RegisterHandler_Duplicate_Failure(t *testing.T) {
+	b := &Bridge{}
+	b.AssignHandlers(NewBridgeMux(), &mockcore.MockCore{Behavior: mockcore.Success})
+
+	noop := func(w ResponseWriter, r *Request) {}
+	if err := b.RegisterHandler(prot.ComputeSystemCreateV1, noop); err == nil {
+		t.Fatal("registering a handler over a built-in handler should fail")
+	}
+	const customType = prot.MessageIdentifier(0x1010ff01)
+	if err := b.RegisterHandler(customType, noop); err != nil {
+		t.Fatalf("failed to register custom handler: %s", err)
+	}
+	if err := b.RegisterHandler(customType, noop); err == nil {
+		t.Fatal("registering a second handler for the same type should fail")
+	}
+}
+
+func Test_Bridge_RegisterHandler_CustomAndBuiltIn_Success(t *testing.T) {
+	// Turn off logging so as not to spam output.
+	logrus.SetOutput(ioutil.Discard)
+
+	mtc := make(chan *transport.MockConnection)
+	defer close(mtc)
+	mt := &transport.MockTransport{Channel: mtc}
+	b := &Bridge{Transport: mt}
+	b.AssignHandlers(NewBridgeMux(), &mockcore.MockCore{Behavior: mockcore.Success})
+
+	const customType = prot.MessageIdentifier(0x1010ff01)
+	var received *Request
+	custom := func(w ResponseWriter, r *Request) {
+		received = r
+		w.Write(&prot.MessageResponseBase{Result: 7})
+	}
+	if err := b.RegisterHandler(customType, custom); err != nil {
+		t.Fatalf("failed to register custom handler: %s", err)
+	}
+
+	go func() {
+		if err := b.ListenAndServe(); err != nil {
+			t.Error(err)
+		}
+	}()
+	defer func() {
+		b.quitChan <- true
+	}()
+
+	clientConnection := <-mtc
+	message := &prot.MessageBase{ActivityID: "00000000-0000-0000-0000-000000000001"}
+	if err := serverSend(clientConnection, customType, prot.SequenceID(1), message); err != nil {
+		t.Fatal("Failed to send message to server")
+	}
+	header, body, err := serverRead(clientConnection)
+	if err != nil {
+		t.Fatal("Failed to read message response from server")
+	}
+	if received == nil || received.Header.Type != customType {
+		t.Fatal("custom handler did not receive the request")
+	}
+	if header.Type != prot.GetResponseIdentifier(customType) || header.ID != 1 {
+		t.Fatalf("custom response had invalid header %+v", header)
+	}
+	response := &prot.MessageResponseBase{}
+	if err := json.Unmarshal(body, response); err != nil || response.Result != 7 {
+		t.Fatalf("custom response was not written by the custom handler: %s", body)
+	}
+
+	if err := serverSend(clientConnection, prot.ComputeSystemEnumerateV1, prot.SequenceID(2), message); err != nil {
+		t.Fatal("Failed to send message to server")
+	}
+	header, body, err = serverRead(clientConnection)
+	if err != nil {
+		t.Fatal("Failed to read message response from server")
+	}
+	if header.Type != prot.ComputeSystemResponseEnumerateV1 || header.ID != 2 {
+		t.Fatalf("built-in response had invalid header %+v", header)
+	}
+	enumerate := &prot.ContainerEnumerateResponse{}
+	if err := json.Unmarshal(body, enumerate); err != nil || enumerate.Result != 0 || len(enumerate.Containers) != 1 {
+		t.Fatalf("built-in handler did not respond successfully: %s", body)
+	}
+}
+
+func Test_Bridge_Dispatch_MiddlewareOrder_Success(t *testing.T) {
+	// Turn off logging so as not to spam output.
+	logrus.SetOutput(ioutil.Discard)
+
+	var order []string
+	record := func(name string) Middleware {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(w ResponseWriter, r *Request) {
+				order = append(order, name)
+				next(w, r)
+			}
+		}
+	}
+	b := &Bridge{Handler: HandlerFunc(func(w ResponseWriter, r *Request) {
+		order = append(order, "handler")
+		w.Write(&prot.MessageResponseBase{})
+	})}
+	b.Use(record("first"))
+	b.Use(record("second"))
+
+	req, rw := setupRequestResponse(t, prot.ComputeSystemCreateV1, nil)
+	b.dispatch(rw, req)
+	if strings.Join(order, ",") != "first,second,handler" {
+		t.Fatalf("middleware ran in the wrong order: %v", order)
+	}
+}
+
+func Test_Bridge_Dispatch_MiddlewareShortCircuits_Success(t *testing.T) {
+	// Turn off logging so as not to spam output.
+	logrus.SetOutput(ioutil.Discard)
+
+	handlerCalled := false
+	var observed *Request
+	b := &Bridge{Handler: HandlerFunc(func(w ResponseWriter, r *Request) {
+		handlerCalled = true
+		w.Write(&prot.MessageResponseBase{})
+	})}
+	b.Use(func(next HandlerFunc) HandlerFunc {
+		return func(w ResponseWriter, r *Request) {
+			observed = r
+			w.Error("", gcserr.WrapHresult(errors.New("access denied"), gcserr.HrAccessDenied))
+		}
+	})
+
+	req, rw := setupRequestResponse(t, prot.ComputeSystemCreateV1, nil)
+	b.dispatch(rw, req)
+	if observed != req {
+		t.Fatal("middleware did not observe the request")
+	}
+	if handlerCalled {
+		t.Fatal("handler was called after the middleware responded")
+	}
+	verifyResponseError(t, rw)
+	if hresult, err := gcserr.GetHresult(rw.err); err != nil || hresult != gcserr.HrAccessDenied {
+		t.Fatalf("response error was not the middleware's error: %s", rw.err)
+	}
+}
+
+func Test_Bridge_Dispatch_HandlerPanics_RespondsWithError(t *testing.T) {
+	// Turn off logging so as not to spam output.
+	logrus.SetOutput(ioutil.Discard)
+
+	b := &Bridge{Handler: HandlerFunc(func(w ResponseWriter, r *Request) {
+		panic("boom")
+	})}
+
+	req, rw := setupRequestResponse(t, prot.ComputeSystemCreateV1, nil)
+	b.dispatch(rw, req)
+	verifyResponseError(t, rw)
+	if !strings.Contains(rw.err.Error(), "boom") {
+		t.Fatalf("response error did not describe the panic: %s", rw.err)
+	}
+}
+
+func Test_Bridge_PublishNotification_NotServing_Failure(t *testing.T) {
+	b := &Bridge{}
+	if err := b.PublishNotification(&prot.ContainerNotification{MessageBase: &prot.MessageBase{}}); err == nil {
+		t.Fatal("publishing on a bridge which is not serving should fail")
+	}
+}
+
+func Test_Bridge_PublishNotification_FullChannel_TimesOut(t *testing.T) {
+	b := &Bridge{
+		notificationChan:    make(chan bridgeResponse),
+		done:                make(chan struct{}),
+		NotificationTimeout: 10 * time.Millisecond,
+	}
+	result := make(chan error, 1)
+	go func() {
+		result <- b.PublishNotification(&prot.ContainerNotification{MessageBase: &prot.MessageBase{}})
+	}()
+	select {
+	case err := <-result:
+		if err == nil {
+			t.Fatal("publishing to a channel nobody reads should fail")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("publishing to a full channel blocked")
+	}
+}
+
+func Test_Bridge_PublishNotification_Stopped_Failure(t *testing.T) {
+	b := &Bridge{
+		notificationChan: make(chan bridgeResponse),
+		done:             make(chan struct{}),
+	}
+	close(b.done)
+	result := make(chan error, 1)
+	go func() {
+		result <- b.PublishNotification(&prot.ContainerNotification{MessageBase: &prot.MessageBase{}})
+	}()
+	select {
+	case err := <-result:
+		if err == nil {
+			t.Fatal("publishing after the bridge stopped should fail")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("publishing after the bridge stopped blocked")
+	}
+}
+
+func Test_Bridge_ResponseWriter_Stopped_DoesNotBlock(t *testing.T) {
+	done := make(chan struct{})
+	close(done)
+	w := &requestResponseWriter{
+		header:   &prot.MessageHeader{Type: prot.ComputeSystemResponseCreateV1},
+		respChan: make(chan bridgeResponse),
+		done:     done,
+	}
+	w.Write(&prot.MessageResponseBase{})
+	if !w.respWritten {
+		t.Fatal("response was not marked as written")
+	}
+}
+
+func newNotification(id string) *prot.ContainerNotification {
+	return &prot.ContainerNotification{
+		MessageBase: &prot.MessageBase{ContainerID: id},
+		Type:        prot.NtUnexpectedExit,
+	}
+}
+
+func Test_Bridge_PublishNotification_DropOldest_KeepsNewest(t *testing.T) {
+	logrus.SetOutput(ioutil.Discard)
+
+	// No consumer is reading, so the queue fills after two notifications.
+	b := &Bridge{
+		notificationChan:       make(chan bridgeResponse, 2),
+		done:                   make(chan struct{}),
+		NotificationDropPolicy: NotificationDropOldest,
+	}
+	for _, id := range []string{"first", "second", "third", "fourth"} {
+		if err := b.PublishNotification(newNotification(id)); err != nil {
+			t.Fatalf("failed to publish notification %s: %s", id, err)
+		}
+	}
+	if dropped := b.DroppedNotifications(); dropped != 2 {
+		t.Fatalf("expected 2 dropped notifications, got %d", dropped)
+	}
+	var queued []string
+	for len(b.notificationChan) > 0 {
+		queued = append(queued, (<-b.notificationChan).response.(*prot.ContainerNotification).ContainerID)
+	}
+	if strings.Join(queued, ",") != "third,fourth" {
+		t.Fatalf("expected the newest notifications to be queued, got %v", queued)
+	}
+}
+
+func Test_Bridge_PublishNotification_DropOldest_Unbuffered_DropsNew(t *testing.T) {
+	logrus.SetOutput(ioutil.Discard)
+
+	b := &Bridge{
+		notificationChan:       make(chan bridgeResponse),
+		done:                   make(chan struct{}),
+		NotificationDropPolicy: NotificationDropOldest,
+	}
+	if err := b.PublishNotification(newNotification("first")); err != nil {
+		t.Fatalf("failed to publish notification: %s", err)
+	}
+	if dropped := b.DroppedNotifications(); dropped != 1 {
+		t.Fatalf("expected 1 dropped notification, got %d", dropped)
+	}
+}
+
+func Test_Bridge_PublishNotification_Block_QueuesThenTimesOut(t *testing.T) {
+	b := &Bridge{
+		notificationChan:    make(chan bridgeResponse, 1),
+		done:                make(chan struct{}),
+		NotificationTimeout: 10 * time.Millisecond,
+	}
+	if err := b.PublishNotification(newNotification("first")); err != nil {
+		t.Fatalf("failed to queue notification: %s", err)
+	}
+	if err := b.PublishNotification(newNotification("second")); err == nil {
+		t.Fatal("publishing to a full queue should time out")
+	}
+	if dropped := b.DroppedNotifications(); dropped != 0 {
+		t.Fatalf("blocking policy should not drop notifications, got %d", dropped)
+	}
+	if queued := (<-b.notificationChan).response.(*prot.ContainerNotification).ContainerID; queued != "first" {
+		t.Fatalf("expected the first notification to be queued, got %s", queued)
+	}
+}
+
+func Test_Bridge_ListenAndServe_ConnectionClosed_CancelsHandlers(t *testing.T) {
+	logrus.SetOutput(ioutil.Discard)
+
+	mtc := make(chan *transport.MockConnection, 1)
+	mt := &transport.MockTransport{Channel: mtc}
+	b := &Bridge{Transport: mt}
+
+	const blockingType = prot.MessageIdentifier(0x1010ff01)
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	blocking := func(w ResponseWriter, r *Request) {
+		ctx, cancel := b.requestContext(nil)
+		defer cancel()
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+		w.Error("", ctx.Err())
+	}
+	if err := b.RegisterHandler(blockingType, blocking); err != nil {
+		t.Fatalf("failed to register handler: %s", err)
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		served <- b.ListenAndServe()
+	}()
+	clientConnection := <-mtc
+	defer clientConnection.Close()
+	if err := serverSend(clientConnection, blockingType, prot.SequenceID(1), &prot.MessageBase{}); err != nil {
+		t.Fatalf("failed to send message to server: %s", err)
+	}
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the handler was not called")
+	}
+
+	b.commandConn.Close()
+	select {
+	case err := <-served:
+		if err == nil || !isClosedConnection(err) {
+			t.Fatalf("expected the bridge to stop with a closed connection error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the bridge kept serving after its connection was closed")
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the handler's context was not cancelled")
+	}
+}
+
+// pausableConnection fails every write while paused, and otherwise records
+// the bytes written.
+type pausableConnection struct {
+	mu      sync.Mutex
+	paused  bool
+	failed  int
+	written bytes.Buffer
+}
+
+func (c *pausableConnection) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.paused {
+		c.failed++
+		return 0, errors.New("host unavailable")
+	}
+	return c.written.Write(p)
+}
+
+func (c *pausableConnection) resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.paused = false
+}
+
+func Test_Bridge_SendResponses_NotificationRetry_DeliversAfterPause(t *testing.T) {
+	logrus.SetOutput(ioutil.Discard)
+
+	conn := &pausableConnection{paused: true}
+	b := &Bridge{
+		responseChan:              make(chan bridgeResponse),
+		notificationChan:          make(chan bridgeResponse, 4),
+		done:                      make(chan struct{}),
+		NotificationRetryInterval: time.Millisecond,
+	}
+	defer close(b.done)
+	errs := make(chan error, 1)
+	go b.sendResponses(conn, errs)
+
+	ids := []string{"first", "second", "third"}
+	for _, id := range ids {
+		if err := b.PublishNotification(newNotification(id)); err != nil {
+			t.Fatalf("failed to publish notification %s: %s", id, err)
+		}
+	}
+	// Let the first notification fail to send at least twice before the
+	// host becomes available.
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		conn.mu.Lock()
+		failed := conn.failed
+		conn.mu.Unlock()
+		if failed >= 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the notification was not retried")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	conn.resume()
+
+	var delivered []string
+	for deadline := time.Now().Add(5 * time.Second); len(delivered) < len(ids); {
+		select {
+		case err := <-errs:
+			t.Fatalf("failing to send a notification stopped the bridge: %s", err)
+		default:
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("only notifications %v were delivered", delivered)
+		}
+		conn.mu.Lock()
+		for conn.written.Len() > 0 {
+			var header prot.MessageHeader
+			if err := binary.Read(&conn.written, binary.LittleEndian, &header); err != nil {
+				t.Fatalf("failed to read notification header: %s", err)
+			}
+			var n prot.ContainerNotification
+			body := conn.written.Next(int(header.Size) - prot.MessageHeaderSize)
+			if err := json.Unmarshal(body, &n); err != nil {
+				t.Fatalf("failed to read notification %q: %s", body, err)
+			}
+			delivered = append(delivered, n.ContainerID)
+		}
+		conn.mu.Unlock()
+		time.Sleep(time.Millisecond)
+	}
+	if strings.Join(delivered, ",") != strings.Join(ids, ",") {
+		t.Fatalf("expected notifications %v in order, got %v", ids, delivered)
+	}
+}
+
+func Test_NewRandomActivityID_IsVersion4GUID(t *testing.T) {
+	pattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	first := NewRandomActivityID()
+	if !pattern.MatchString(first) {
+		t.Fatalf("activity ID %q was not a version 4 GUID", first)
+	}
+	if second := NewRandomActivityID(); second == first {
+		t.Fatalf("two activity IDs were both %q", first)
+	}
+}
+
+// echoActivityIDHandler responds with the activity ID of the request it is
+// given.
+func echoActivityIDHandler(w ResponseWriter, r *Request) {
+	var request prot.MessageBase
+	if err := json.Unmarshal(r.Message, &request); err != nil {
+		w.Error("", err)
+		return
+	}
+	w.Write(&prot.MessageResponseBase{ActivityID: request.ActivityID})
+}
+
+func Test_Bridge_Dispatch_ActivityIDGenerator_AssignsMissingID(t *testing.T) {
+	// Turn off logging so as not to spam output.
+	logrus.SetOutput(ioutil.Discard)
+
+	b := &Bridge{
+		Handler:             HandlerFunc(echoActivityIDHandler),
+		ActivityIDGenerator: func() string { return "generated" },
+	}
+	req, rw := setupRequestResponse(t, prot.ComputeSystemCreateV1, &prot.MessageBase{ContainerID: "c"})
+	b.dispatch(rw, req)
+	verifyResponseSuccess(t, rw)
+	if id := rw.response.(*prot.MessageResponseBase).ActivityID; id != "generated" {
+		t.Fatalf("response had activity ID %q rather than the generated one", id)
+	}
+}
+
+func Test_Bridge_Dispatch_ActivityIDGenerator_ErrorForMalformedRequest(t *testing.T) {
+	// Turn off logging so as not to spam output.
+	logrus.SetOutput(ioutil.Discard)
+
+	b := &Bridge{ActivityIDGenerator: NewRandomActivityID}
+	b.Handler = HandlerFunc(b.createContainer)
+	req, rw := setupRequestResponse(t, prot.ComputeSystemCreateV1, nil)
+	b.dispatch(rw, req)
+	verifyResponseJSONError(t, rw)
+	if rw.errActivityID == "" || rw.errActivityID == emptyActivityID {
+		t.Fatalf("response had activity ID %q rather than a generated one", rw.errActivityID)
+	}
+}
+
+func Test_Bridge_Dispatch_ActivityIDGenerator_KeepsGivenID(t *testing.T) {
+	// Turn off logging so as not to spam output.
+	logrus.SetOutput(ioutil.Discard)
+
+	generated := false
+	b := &Bridge{
+		Handler: HandlerFunc(echoActivityIDHandler),
+		ActivityIDGenerator: func() string {
+			generated = true
+			return "generated"
+		},
+	}
+	r := newMessageBase()
+	req, rw := setupRequestResponse(t, prot.ComputeSystemCreateV1, r)
+	b.dispatch(rw, req)
+	verifyResponseSuccess(t, rw)
+	verifyActivityID(t, r, rw)
+	if generated {
+		t.Fatal("an activity ID was generated for a request which had one")
+	}
+}
+
+func Test_Bridge_Dispatch_AuthToken(t *testing.T) {
+	// Turn off logging so as not to spam output.
+	logrus.SetOutput(ioutil.Discard)
+
+	for _, tc := range []struct {
+		name    string
+		token   string
+		allowed bool
+	}{
+		{name: "valid", token: "s3cret", allowed: true},
+		{name: "invalid", token: "s3cre7", allowed: false},
+		{name: "missing", token: "", allowed: false},
+	} {
+		handled := false
+		b := &Bridge{
+			Handler: HandlerFunc(func(w ResponseWriter, r *Request) {
+				handled = true
+				echoActivityIDHandler(w, r)
+			}),
+			AuthToken: "s3cret",
+		}
+		r := newMessageBase()
+		r.AuthToken = tc.token
+		req, rw := setupRequestResponse(t, prot.ComputeSystemCreateV1, r)
+		b.dispatch(rw, req)
+		if handled != tc.allowed {
+			t.Fatalf("%s token: expected the request to be handled %v, was %v", tc.name, tc.allowed, handled)
+		}
+		if tc.allowed {
+			verifyResponseSuccess(t, rw)
+			continue
+		}
+		if rw.err == nil {
+			t.Fatalf("%s token: the request was not rejected", tc.name)
+		}
+		if hresult, err := gcserr.GetHresult(rw.err); err != nil || hresult != gcserr.HrAccessDenied {
+			t.Fatalf("%s token: expected HrAccessDenied, got %v", tc.name, rw.err)
+		}
+		if rw.errActivityID != r.ActivityID {
+			t.Fatalf("%s token: the rejection had activity ID %q", tc.name, rw.errActivityID)
+		}
+	}
+}
+
+func Test_Bridge_Dispatch_NoAuthToken_TokenIgnored(t *testing.T) {
+	// Turn off logging so as not to spam output.
+	logrus.SetOutput(ioutil.Discard)
+
+	b := &Bridge{Handler: HandlerFunc(echoActivityIDHandler)}
+	r := newMessageBase()
+	r.AuthToken = "anything"
+	req, rw := setupRequestResponse(t, prot.ComputeSystemCreateV1, r)
+	b.dispatch(rw, req)
+	verifyResponseSuccess(t, rw)
+}
+
+func Test_Bridge_Dispatch_NoActivityIDGenerator_EmptyGUID(t *testing.T) {
+	// Turn off logging so as not to spam output.
+	logrus.SetOutput(ioutil.Discard)
+
+	b := new(Bridge)
+	b.Handler = HandlerFunc(b.createContainer)
+	req, rw := setupRequestResponse(t, prot.ComputeSystemCreateV1, nil)
+	b.dispatch(rw, req)
+	verifyResponseJSONError(t, rw)
+	verifyActivityIDEmptyGUID(t, rw)
+}
+
+func Test_ListenForHost_Success(t *testing.T) {
+	mt := &transport.MockTransport{}
+	l, advertised, err := listenForHost(mt)
+	if err != nil {
+		t.Fatalf("listenForHost failed: %s", err)
+	}
+	defer l.Close()
+	if advertised.ListenPort == 0 || advertised.ListenPort != l.Port() {
+		t.Fatalf("advertised port %d does not match listener port %d", advertised.ListenPort, l.Port())
+	}
+
+	accepted := make(chan transport.Connection, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			t.Errorf("Accept failed: %s", err)
+		}
+		accepted <- conn
+	}()
+	hostConn, err := mt.Dial(advertised.ListenPort)
+	if err != nil {
+		t.Fatalf("Dial failed: %s", err)
+	}
+	defer hostConn.Close()
+	guestConn := <-accepted
+	if guestConn == nil {
+		t.FailNow()
+	}
+	defer guestConn.Close()
+
+	if _, err := guestConn.Write([]byte("ping")); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(hostConn, buf); err != nil {
+		t.Fatalf("Read failed: %s", err)
+	}
+	if string(buf) != "ping" {
+		t.Fatalf("host read %q, expected %q", buf, "ping")
+	}
+}
+
+func Test_ListenForHost_ListenFails_Failure(t *testing.T) {
+	_, _, err := listenForHost(&errorTransport{e: errors.New("no ports")})
+	if err == nil {
+		t.Fatal("listenForHost should have failed")
+	}
+}
@@ -1,6 +1,9 @@
 package bridge
 
 import (
+	"time"
+
+	"github.com/Microsoft/opengcs/service/gcs/gcserr"
 	"github.com/Microsoft/opengcs/service/gcs/prot"
 	"github.com/Microsoft/opengcs/service/gcs/stdio"
 	"github.com/Microsoft/opengcs/service/gcs/transport"
@@ -9,8 +12,12 @@ import (
 
 // connectStdio returns new transport.Connection instances, one for each
 // stdio pipe to be used. If CreateStd*Pipe for a given pipe is false, the
-// given Connection is set to nil.
+// given Connection is set to nil. If MultiplexStdio is set, the pipes all share
+// a single connection.
 func connectStdio(tport transport.Transport, params prot.ProcessParameters, settings prot.ExecuteProcessVsockStdioRelaySettings) (_ *stdio.ConnectionSet, err error) {
+	if params.MultiplexStdio {
+		return connectMultiplexedStdio(tport, params, settings)
+	}
 	connSet := &stdio.ConnectionSet{}
 	defer func() {
 		if err != nil {
@@ -37,3 +44,38 @@ func connectStdio(tport transport.Transport, params prot.ProcessParameters, sett
 	}
 	return connSet, nil
 }
+
+// connectMultiplexedStdio returns a stdio.ConnectionSet whose connections are
+// all carried over a single connection to the StdioMux port. If no pipes are
+// requested, no connection is made.
+func connectMultiplexedStdio(tport transport.Transport, params prot.ProcessParameters, settings prot.ExecuteProcessVsockStdioRelaySettings) (*stdio.ConnectionSet, error) {
+	if !params.CreateStdInPipe && !params.CreateStdOutPipe && !params.CreateStdErrPipe {
+		return &stdio.ConnectionSet{}, nil
+	}
+	if settings.StdioMux == 0 {
+		return nil, gcserr.WrapHresult(errors.New("multiplexed stdio was requested without a StdioMux port"), gcserr.HrInvalidArg)
+	}
+	conn, err := tport.Dial(settings.StdioMux)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed creating multiplexed stdio Connection")
+	}
+	if params.StdioControl {
+		return stdio.NewMuxControlConnectionSet(conn, params.CreateStdInPipe, params.CreateStdOutPipe, params.CreateStdErrPipe), nil
+	}
+	return stdio.NewMuxConnectionSet(conn, params.CreateStdInPipe, params.CreateStdOutPipe, params.CreateStdErrPipe), nil
+}
+
+// HostConnectTimeout is how long the GCS waits for the host to connect to a
+// port it listens on for a stream the guest initiates.
+var HostConnectTimeout = 30 * time.Second
+
+// listenForHost listens on a port allocated by tport for a connection from the
+// host, for a stream which the guest initiates. The returned GuestListenPort
+// advertises the port to the host in a response.
+func listenForHost(tport transport.Transport) (transport.Listener, prot.GuestListenPort, error) {
+	l, err := tport.Listen(transport.AnyPort)
+	if err != nil {
+		return nil, prot.GuestListenPort{}, errors.Wrap(err, "failed to listen for a connection from the host")
+	}
+	return l, prot.GuestListenPort{ListenPort: l.Port()}, nil
+}
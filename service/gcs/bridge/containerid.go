@@ -0,0 +1,25 @@
+package bridge
+
+import (
+	"regexp"
+
+	"github.com/Microsoft/opengcs/service/gcs/gcserr"
+	"github.com/pkg/errors"
+)
+
+// containerIDPattern matches the container IDs accepted by runc.
+var containerIDPattern = regexp.MustCompile(`^[\w+\-.]+$`)
+
+// validateContainerID returns an HrInvalidArg error if id is not a valid
+// container ID. Container IDs are used by runc and as path components in the
+// utility VM, so they must be non-empty, consist only of letters, digits, '_',
+// '+', '-' and '.', and must not be "." or "..".
+func validateContainerID(id string) error {
+	if id == "" {
+		return gcserr.WrapHresult(errors.New("the container ID is empty"), gcserr.HrInvalidArg)
+	}
+	if id == "." || id == ".." || !containerIDPattern.MatchString(id) {
+		return gcserr.WrapHresult(errors.Errorf("the container ID \"%s\" is malformed", id), gcserr.HrInvalidArg)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package bridge
+
+import (
+	"context"
+	"time"
+
+	"github.com/Microsoft/opengcs/service/gcs/gcserr"
+	"github.com/Microsoft/opengcs/service/gcs/prot"
+	"github.com/pkg/errors"
+)
+
+// requestContext returns the context in which to handle a request with the
+// given base. The context has a deadline if the request set DeadlineMs, and is
+// cancelled if the bridge stops serving. The returned cancel function must be
+// called once the request has been handled.
+func (b *Bridge) requestContext(base *prot.MessageBase) (context.Context, context.CancelFunc) {
+	parent := b.serveCtx
+	if parent == nil {
+		parent = context.Background()
+	}
+	if base == nil || base.DeadlineMs == 0 {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, time.Duration(base.DeadlineMs)*time.Millisecond)
+}
+
+// deadlineError marks err with HrTimeout if it was caused by a request's
+// deadline passing, and otherwise returns it unchanged.
+func deadlineError(err error) error {
+	if errors.Cause(err) == context.DeadlineExceeded {
+		return gcserr.WrapHresult(err, gcserr.HrTimeout)
+	}
+	return err
+}
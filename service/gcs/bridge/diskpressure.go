@@ -0,0 +1,78 @@
+package bridge
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Microsoft/opengcs/service/gcs/prot"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultDiskPressurePollInterval is how often a container's scratch disk
+// usage is sampled when Bridge.DiskPressurePollInterval is unset.
+const defaultDiskPressurePollInterval = 5 * time.Second
+
+// diskPressureHysteresisDivisor determines how far above the low watermark the
+// free space must rise before another NtDiskPressure notification can be sent.
+// A value of 10 means the free space must recover to 110% of the watermark.
+const diskPressureHysteresisDivisor = 10
+
+// monitorScratchDisk periodically samples the free space on the scratch disk
+// of the container with the given ID, and publishes an NtDiskPressure
+// notification each time it drops below lowWatermark. Once a notification has
+// been sent, another will not be sent until the free space has recovered past
+// the watermark plus a hysteresis margin. The monitor exits when done is closed
+// or the container's usage can no longer be queried.
+func (b *Bridge) monitorScratchDisk(id, activityID string, lowWatermark uint64, done <-chan struct{}) {
+	interval := b.DiskPressurePollInterval
+	if interval <= 0 {
+		interval = defaultDiskPressurePollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	rearmThreshold := lowWatermark + lowWatermark/diskPressureHysteresisDivisor
+	armed := true
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		usage, err := b.coreint.GetScratchDiskUsage(id)
+		if err != nil {
+			logrus.Debugf("bridge: stopping scratch disk monitor for container %s: %s", id, err)
+			return
+		}
+
+		if armed && usage.FreeBytes < lowWatermark {
+			armed = false
+			info, err := json.Marshal(usage)
+			if err != nil {
+				logrus.Errorf("bridge: failed to marshal scratch disk usage for container %s: %s", id, err)
+				continue
+			}
+			logrus.Warnf("bridge: container %s scratch disk is low on space: %d of %d bytes free", id, usage.FreeBytes, usage.TotalBytes)
+			notification := &prot.ContainerNotification{
+				MessageBase: &prot.MessageBase{
+					ContainerID: id,
+					ActivityID:  activityID,
+				},
+				Type:       prot.NtDiskPressure,
+				Operation:  prot.AoNone,
+				ResultInfo: string(info),
+			}
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if err := b.PublishNotification(notification); err != nil {
+				logrus.Errorf("bridge: failed to publish disk pressure notification for container %s: %s", id, err)
+			}
+		} else if !armed && usage.FreeBytes >= rearmThreshold {
+			armed = true
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package bridge
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Microsoft/opengcs/service/gcs/prot"
+	"github.com/pkg/errors"
+)
+
+// eagainRetryInterval is how long readFull and writeFull wait before retrying
+// an operation on a non-blocking connection which failed with EAGAIN.
+const eagainRetryInterval = time.Millisecond
+
+// maxEmptyReads is the number of consecutive reads returning neither data nor
+// an error after which readFull gives up with io.ErrNoProgress.
+const maxEmptyReads = 100
+
+// corruptFrameError is returned by readRequest when a message's checksum does
+// not match its body. The message was still read in full, so the stream is
+// not desynchronized and the request can be rejected.
+type corruptFrameError struct {
+	header *prot.MessageHeader
+}
+
+func (e *corruptFrameError) Error() string {
+	return "bridge: message checksum does not match its body"
+}
+
+// readRequest reads a message from r. If the message has a checksum, it is
+// verified and removed, MessageFlagChecksum is cleared from the returned
+// header, and checksummed is true. A message whose checksum does not match
+// produces a *corruptFrameError.
+func readRequest(r io.Reader) (req *Request, checksummed bool, err error) {
+	var headerBytes [prot.MessageHeaderSize]byte
+	if err := readFull(r, headerBytes[:]); err != nil {
+		return nil, false, errors.Wrap(err, "bridge: failed reading message header")
+	}
+	header := &prot.MessageHeader{}
+	if err := binary.Read(bytes.NewReader(headerBytes[:]), binary.LittleEndian, header); err != nil {
+		return nil, false, errors.Wrap(err, "bridge: failed decoding message header")
+	}
+	if header.Size < prot.MessageHeaderSize {
+		return nil, false, errors.Errorf("bridge: message size %d is smaller than the message header", header.Size)
+	}
+	message := make([]byte, header.Size-prot.MessageHeaderSize)
+	if err := readFull(r, message); err != nil {
+		return nil, false, errors.Wrap(err, "bridge: failed reading message payload")
+	}
+
+	if header.Type&prot.MessageFlagChecksum == 0 {
+		return &Request{header, message}, false, nil
+	}
+	header.Type &^= prot.MessageFlagChecksum
+	if len(message) < prot.ChecksumSize {
+		return nil, true, &corruptFrameError{header: header}
+	}
+	body := message[:len(message)-prot.ChecksumSize]
+	checksum := binary.LittleEndian.Uint32(message[len(body):])
+	if crc32.ChecksumIEEE(body) != checksum {
+		return nil, true, &corruptFrameError{header: header}
+	}
+	return &Request{header, body}, true, nil
+}
+
+// writeResponse serializes resp and writes its header and payload to w. If
+// checksum is true, the message is flagged with MessageFlagChecksum and
+// followed by the checksum of the payload. It returns the serialized payload.
+func writeResponse(w io.Writer, resp bridgeResponse, checksum bool) ([]byte, error) {
+	responseBytes, err := json.Marshal(resp.response)
+	if err != nil {
+		return nil, errors.Wrapf(err, "bridge: failed to marshal JSON for response \"%v\"", resp.response)
+	}
+	header := *resp.header
+	header.Size = uint32(len(responseBytes) + prot.MessageHeaderSize)
+	if checksum {
+		header.Type |= prot.MessageFlagChecksum
+		header.Size += prot.ChecksumSize
+	}
+
+	var message bytes.Buffer
+	message.Grow(int(header.Size))
+	if err := binary.Write(&message, binary.LittleEndian, &header); err != nil {
+		return nil, errors.Wrap(err, "bridge: failed to serialize message header")
+	}
+	message.Write(responseBytes)
+	if checksum {
+		if err := binary.Write(&message, binary.LittleEndian, crc32.ChecksumIEEE(responseBytes)); err != nil {
+			return nil, errors.Wrap(err, "bridge: failed to serialize message checksum")
+		}
+	}
+
+	if err := writeFull(w, message.Bytes()); err != nil {
+		return nil, errors.Wrap(err, "bridge: failed writing message")
+	}
+	return responseBytes, nil
+}
+
+// readFull reads exactly len(p) bytes from r, retrying after short reads and
+// after EAGAIN from a non-blocking connection, so that a message split across
+// reads is reassembled rather than misframed. Like io.ReadFull, it returns
+// io.EOF if r ends before any of p is read and io.ErrUnexpectedEOF if it ends
+// partway through.
+func readFull(r io.Reader, p []byte) error {
+	read := 0
+	emptyReads := 0
+	for read < len(p) {
+		n, err := r.Read(p[read:])
+		read += n
+		switch {
+		case err == nil:
+		case isEAGAIN(err):
+			time.Sleep(eagainRetryInterval)
+			continue
+		case err == io.EOF && read == len(p):
+			return nil
+		case err == io.EOF && read > 0:
+			return io.ErrUnexpectedEOF
+		default:
+			return err
+		}
+		if n > 0 {
+			emptyReads = 0
+		} else if emptyReads++; emptyReads >= maxEmptyReads {
+			return io.ErrNoProgress
+		}
+	}
+	return nil
+}
+
+// rootCause returns the error underlying err, unwrapping the errors the os
+// and net packages wrap system call errors in.
+func rootCause(err error) error {
+	err = errors.Cause(err)
+	for {
+		switch e := err.(type) {
+		case *os.PathError:
+			err = e.Err
+		case *os.SyscallError:
+			err = e.Err
+		case *net.OpError:
+			err = e.Err
+		default:
+			return err
+		}
+	}
+}
+
+// isEAGAIN returns true if err, or the error it wraps, is EAGAIN.
+func isEAGAIN(err error) bool {
+	return rootCause(err) == syscall.EAGAIN
+}
+
+// isClosedConnection returns true if err, returned by reading from or writing
+// to the bridge connection, means that the connection has been closed, by
+// either the host or the GCS.
+func isClosedConnection(err error) bool {
+	switch cause := rootCause(err); cause {
+	case io.EOF, io.ErrUnexpectedEOF, io.ErrClosedPipe, os.ErrClosed, syscall.EPIPE, syscall.ECONNRESET:
+		return true
+	default:
+		// net returns an unexported error for a connection closed locally.
+		return strings.Contains(cause.Error(), "use of closed network connection")
+	}
+}
+
+// writeFull writes all of p to w, retrying after short writes and after
+// EAGAIN from a non-blocking connection. Although an io.Writer should return
+// an error for a short write, a connection which doesn't would otherwise
+// corrupt the message framing. It returns io.ErrShortWrite if a write makes no
+// progress.
+func writeFull(w io.Writer, p []byte) error {
+	for len(p) > 0 {
+		n, err := w.Write(p)
+		if err != nil {
+			if isEAGAIN(err) {
+				p = p[n:]
+				time.Sleep(eagainRetryInterval)
+				continue
+			}
+			return err
+		}
+		if n <= 0 {
+			return io.ErrShortWrite
+		}
+		p = p[n:]
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package bridge
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Microsoft/opengcs/service/gcs/prot"
+	"github.com/sirupsen/logrus"
+)
+
+// idleWatchdog tracks the containers in the utility VM, and calls onIdle each
+// time the utility VM has had no containers for timeout. A container counts
+// until it is deleted, even once it has exited.
+type idleWatchdog struct {
+	timeout time.Duration
+	onIdle  func()
+
+	mu sync.Mutex
+	// containers maps the ID of each container to whether it has exited.
+	containers map[string]bool
+	timer      *time.Timer
+}
+
+// newIdleWatchdog returns an idleWatchdog for a utility VM which currently has
+// no containers, so its timer is started immediately.
+func newIdleWatchdog(timeout time.Duration, onIdle func()) *idleWatchdog {
+	w := &idleWatchdog{timeout: timeout, onIdle: onIdle, containers: make(map[string]bool)}
+	w.timer = time.AfterFunc(timeout, onIdle)
+	return w
+}
+
+// containerCreated records that the container with the given ID was created,
+// stopping the timer.
+func (w *idleWatchdog) containerCreated(id string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.containers[id] = false
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+}
+
+// containerExited records that the init process of the container with the
+// given ID exited. The container still counts until it is deleted.
+func (w *idleWatchdog) containerExited(id string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, ok := w.containers[id]; ok {
+		w.containers[id] = true
+	}
+}
+
+// containerDeleted records that the container with the given ID was deleted.
+// If it was the last container, the timer is started.
+func (w *idleWatchdog) containerDeleted(id string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.deleteLocked(id)
+}
+
+// deleteExited records that the container with the given ID was deleted if it
+// has exited, returning whether it had. The core forgets a container once it
+// has exited, so deleting it only needs to be recorded here.
+func (w *idleWatchdog) deleteExited(id string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.containers[id] {
+		return false
+	}
+	w.deleteLocked(id)
+	return true
+}
+
+// deleteLocked removes the container with the given ID, starting the timer if
+// it was the last container. w.mu must be held.
+func (w *idleWatchdog) deleteLocked(id string) {
+	delete(w.containers, id)
+	if len(w.containers) == 0 && w.timer == nil {
+		w.timer = time.AfterFunc(w.timeout, w.onIdle)
+	}
+}
+
+// stop stops the timer. The watchdog must not be used afterwards.
+func (w *idleWatchdog) stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+}
+
+// startIdleWatchdog starts the idle watchdog if b.IdleTimeout is set.
+func (b *Bridge) startIdleWatchdog() {
+	if b.IdleTimeout > 0 {
+		b.idle = newIdleWatchdog(b.IdleTimeout, b.handleIdle)
+	}
+}
+
+// handleIdle publishes an NtGcsIdle notification, then calls b.OnIdle if it is
+// set.
+func (b *Bridge) handleIdle() {
+	logrus.Infof("bridge: utility VM has had no containers for %s", b.IdleTimeout)
+	err := b.PublishNotification(&prot.ContainerNotification{
+		MessageBase: &prot.MessageBase{},
+		Type:        prot.NtGcsIdle,
+		Operation:   prot.AoNone,
+	})
+	if err != nil {
+		logrus.Errorf("bridge: failed to publish idle notification: %s", err)
+	}
+	if b.OnIdle != nil {
+		b.OnIdle()
+	}
+}
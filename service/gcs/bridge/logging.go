@@ -0,0 +1,161 @@
+package bridge
+
+import (
+	"os"
+	"sync"
+
+	"github.com/Microsoft/opengcs/service/gcs/gcserr"
+	"github.com/Microsoft/opengcs/service/gcs/prot"
+	"github.com/Microsoft/opengcs/service/libs/commonutils"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// LogFormatText selects logrus's human readable text formatter.
+	LogFormatText = "text"
+	// LogFormatJSON selects logrus's JSON formatter, which is easier for the
+	// host to collect and parse.
+	LogFormatJSON = "json"
+)
+
+// stackHookOnce ensures the debug stack hook is only added to the standard
+// logger once, however many times logging is reconfigured.
+var stackHookOnce sync.Once
+
+// debugStackHook prefixes log messages with their caller while the standard
+// logger is at Debug level, and does nothing otherwise. This allows it to be
+// installed once and take effect whenever debug logging is turned on.
+type debugStackHook struct {
+	logrus.Hook
+}
+
+func (h *debugStackHook) Fire(e *logrus.Entry) error {
+	if logrus.GetLevel() != logrus.DebugLevel {
+		return nil
+	}
+	return h.Hook.Fire(e)
+}
+
+// validateLogging returns an error if level or format is set to a value which
+// ConfigureLogging would reject.
+func validateLogging(level, format string) error {
+	_, _, err := parseLogging(level, format)
+	return err
+}
+
+// ConfigureLogging sets the level and output format of the standard logrus
+// logger. An empty level or format leaves the current setting unchanged.
+func ConfigureLogging(level, format string) error {
+	lvl, formatter, err := parseLogging(level, format)
+	if err != nil {
+		return err
+	}
+	if lvl != nil {
+		logrus.SetLevel(*lvl)
+	}
+	if formatter != nil {
+		logrus.SetFormatter(formatter)
+	}
+	stackHookOnce.Do(func() {
+		logrus.AddHook(&debugStackHook{commonutils.NewStackHook(logrus.AllLevels)})
+	})
+	return nil
+}
+
+// parseLogging parses the given level and format. A nil level or formatter is
+// returned for an empty level or format respectively.
+func parseLogging(level, format string) (*logrus.Level, logrus.Formatter, error) {
+	var lvl *logrus.Level
+	if level != "" {
+		parsed, err := logrus.ParseLevel(level)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "invalid log level \"%s\"", level)
+		}
+		lvl = &parsed
+	}
+
+	var formatter logrus.Formatter
+	switch format {
+	case "":
+	case LogFormatText:
+		formatter = &logrus.TextFormatter{}
+	case LogFormatJSON:
+		formatter = &logrus.JSONFormatter{}
+	default:
+		return nil, nil, errors.Errorf("invalid log format \"%s\"", format)
+	}
+	return lvl, formatter, nil
+}
+
+// LogFile is a log destination which can be rotated while in use. It is safe
+// for concurrent use.
+type LogFile struct {
+	path string
+	mu   sync.Mutex
+	file *os.File
+}
+
+// OpenLogFile creates or truncates the file at path and returns a LogFile
+// writing to it.
+func OpenLogFile(path string) (*LogFile, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create log file %s", path)
+	}
+	return &LogFile{path: path, file: file}, nil
+}
+
+// Write writes p to the current log file.
+func (l *LogFile) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Write(p)
+}
+
+// Rotate moves the current log file to its path with ".1" appended,
+// replacing the log from any earlier rotation, and continues logging to a new
+// empty file at the original path. Only one rotated log is kept, so the logs
+// use at most twice the space logged between rotations.
+func (l *LogFile) Rotate() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	rotatedPath := l.path + ".1"
+	if err := os.Rename(l.path, rotatedPath); err != nil {
+		return errors.Wrapf(err, "failed to rename log file %s to %s", l.path, rotatedPath)
+	}
+	file, err := os.OpenFile(l.path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		// Keep logging to the renamed file rather than losing the log.
+		return errors.Wrapf(err, "failed to create log file %s", l.path)
+	}
+	l.file.Close()
+	l.file = file
+	return nil
+}
+
+// rotateLog handles a PtLogRotate modification request by calling the
+// bridge's LogRotator and then applying the requested log level, if any.
+func (b *Bridge) rotateLog(request prot.ResourceModificationRequestResponse) error {
+	lr, ok := request.Settings.(*prot.LogRotate)
+	if !ok {
+		return errors.New("the request's settings are not of type LogRotate")
+	}
+	if request.RequestType != prot.RtUpdate {
+		return errors.Errorf("the request type \"%s\" is not supported for resource type \"%s\"", request.RequestType, request.ResourceType)
+	}
+	if b.LogRotator == nil {
+		return gcserr.WrapHresult(errors.New("the GCS is not logging to a file which can be rotated"), gcserr.HrNotImpl)
+	}
+	if err := validateLogging(lr.LogLevel, ""); err != nil {
+		return gcserr.WrapHresult(err, gcserr.HrInvalidArg)
+	}
+	if err := b.LogRotator(); err != nil {
+		return errors.Wrap(err, "failed to rotate the GCS log")
+	}
+	if err := ConfigureLogging(lr.LogLevel, ""); err != nil {
+		return err
+	}
+	logrus.Info("rotated the GCS log")
+	return nil
+}
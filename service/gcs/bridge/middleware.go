@@ -0,0 +1,99 @@
+package bridge
+
+import (
+	"encoding/json"
+
+	"github.com/Microsoft/opengcs/service/gcs/prot"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Middleware wraps a handler to add behavior, such as logging or
+// authorization, around it. A middleware may respond to the request itself and
+// not call the handler it wraps.
+type Middleware func(HandlerFunc) HandlerFunc
+
+// defaultMiddleware is applied to every request before any middleware added
+// with Bridge.Use.
+var defaultMiddleware = []Middleware{recoverPanics, logActivity}
+
+// Use adds m to the middleware wrapping every request the bridge dispatches.
+// Middleware is run in the order it was added, so the first middleware added
+// sees each request first. Use must not be called after ListenAndServe.
+func (b *Bridge) Use(m Middleware) {
+	b.middleware = append(b.middleware, m)
+}
+
+// dispatch passes r to the bridge's Handler, wrapped in the default middleware
+// followed by the middleware added with Use. If the bridge has an AuthToken,
+// a request which does not carry it is rejected after the default middleware
+// and before any other. If the bridge has an ActivityIDGenerator, a request
+// lacking an activity ID is given one before any middleware sees it.
+func (b *Bridge) dispatch(w ResponseWriter, r *Request) {
+	h := HandlerFunc(b.Handler.ServeMsg)
+	for i := len(b.middleware) - 1; i >= 0; i-- {
+		h = b.middleware[i](h)
+	}
+	if b.AuthToken != "" {
+		h = b.authenticate(h)
+	}
+	for i := len(defaultMiddleware) - 1; i >= 0; i-- {
+		h = defaultMiddleware[i](h)
+	}
+	if b.ActivityIDGenerator != nil {
+		h = b.assignActivityID(h)
+	}
+	h(w, r)
+}
+
+// trackingResponseWriter records whether a response has been written through
+// it.
+type trackingResponseWriter struct {
+	ResponseWriter
+	written bool
+}
+
+func (w *trackingResponseWriter) Write(r interface{}) {
+	w.ResponseWriter.Write(r)
+	w.written = true
+}
+
+func (w *trackingResponseWriter) Error(activityID string, err error) {
+	w.ResponseWriter.Error(activityID, err)
+	w.written = true
+}
+
+// recoverPanics responds with an error to a request whose handler panics,
+// rather than letting the panic bring down the GCS.
+func recoverPanics(next HandlerFunc) HandlerFunc {
+	return func(w ResponseWriter, r *Request) {
+		tw := &trackingResponseWriter{ResponseWriter: w}
+		defer func() {
+			if p := recover(); p != nil {
+				logrus.Errorf("bridge: handler for request ID: 0x%x, Type: 0x%x panicked: %v", r.Header.ID, r.Header.Type, p)
+				if !tw.written {
+					tw.Error(activityIDOf(r), errors.Errorf("handler panicked: %v", p))
+				}
+			}
+		}()
+		next(tw, r)
+	}
+}
+
+// logActivity logs the activity ID of each request before it is handled.
+func logActivity(next HandlerFunc) HandlerFunc {
+	return func(w ResponseWriter, r *Request) {
+		logrus.Infof("bridge: handling request ID: 0x%x, Type: 0x%x, ActivityID: %s", r.Header.ID, r.Header.Type, activityIDOf(r))
+		next(w, r)
+	}
+}
+
+// activityIDOf returns the activity ID of r, or the empty string if r's
+// message has none.
+func activityIDOf(r *Request) string {
+	var base prot.MessageBase
+	if err := json.Unmarshal(r.Message, &base); err != nil {
+		return ""
+	}
+	return base.ActivityID
+}
@@ -0,0 +1,51 @@
+package bridge
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/Microsoft/opengcs/service/gcs/gcserr"
+	"github.com/Microsoft/opengcs/service/gcs/prot"
+	"github.com/Microsoft/opengcs/service/gcs/stdio"
+	"github.com/pkg/errors"
+)
+
+// unmarshalProcessParameters decodes the JSON string form of a
+// ProcessParameters, as carried in ExecuteProcessSettings. A field given a
+// value of the wrong type is reported by name, rather than with the generic
+// error from encoding/json.
+func unmarshalProcessParameters(s string) (prot.ProcessParameters, error) {
+	var params prot.ProcessParameters
+	if err := json.Unmarshal([]byte(s), &params); err != nil {
+		if typeErr, ok := err.(*json.UnmarshalTypeError); ok && typeErr.Field != "" {
+			err = errors.Errorf("ProcessParameters field %s must be a %s, not a JSON %s", typeErr.Field, typeErr.Type, typeErr.Value)
+		}
+		return prot.ProcessParameters{}, errors.WithStack(gcserr.WrapHresult(err, gcserr.HrVmcomputeInvalidJSON))
+	}
+	return params, nil
+}
+
+// validateProcessParameters returns an HrInvalidArg error if params gives its
+// command in both the CommandLine and CommandArgs forms, if CommandArgs is
+// given but is malformed, if StdioControl is set without MultiplexStdio, or if
+// RelayFailurePolicy is not known. Whether a command is required at all
+// depends on whether the process is a container's init process, so that is
+// left to the core.
+func validateProcessParameters(params prot.ProcessParameters) error {
+	if params.StdioControl && !params.MultiplexStdio {
+		return gcserr.WrapHresult(errors.New("StdioControl requires MultiplexStdio"), gcserr.HrInvalidArg)
+	}
+	if _, err := stdio.ParseRelayFailurePolicy(params.RelayFailurePolicy); err != nil {
+		return gcserr.WrapHresult(err, gcserr.HrInvalidArg)
+	}
+	if len(params.CommandArgs) == 0 {
+		return nil
+	}
+	if params.CommandLine != "" {
+		return gcserr.WrapHresult(errors.New("CommandArgs and CommandLine are mutually exclusive"), gcserr.HrInvalidArg)
+	}
+	if strings.TrimSpace(params.CommandArgs[0]) == "" {
+		return gcserr.WrapHresult(errors.New("CommandArgs[0], the program to run, is empty"), gcserr.HrInvalidArg)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package bridge
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// redactedValue replaces the value of any field whose name matches one of the
+// bridge's redacted field names.
+const redactedValue = "REDACTED"
+
+// DefaultRedactedFields is the list of field name fragments whose values are
+// masked when a request is logged. A field is masked if its name contains any
+// of these fragments, ignoring case.
+var DefaultRedactedFields = []string{"key", "secret", "password", "token"}
+
+// jsonFieldPattern matches a single `"name": value` pair, where value is either
+// a string or a bare literal. It is used to redact messages which are not
+// valid JSON and therefore cannot be walked structurally.
+var jsonFieldPattern = regexp.MustCompile(`"((?:[^"\\]|\\.)*)"(\s*:\s*)("(?:[^"\\]|\\.)*"|[^,}\]\s]+)`)
+
+// redactedFields returns the field name fragments the bridge should redact.
+func (b *Bridge) redactedFields() []string {
+	if b.RedactedFields != nil {
+		return b.RedactedFields
+	}
+	return DefaultRedactedFields
+}
+
+// redact returns message with the values of the bridge's redacted fields
+// masked, for use in logs and error messages.
+func (b *Bridge) redact(message []byte) string {
+	return redactMessage(message, b.redactedFields())
+}
+
+// logMalformedRequest logs the body of a request which failed to unmarshal at
+// Debug level, with the values of any sensitive fields masked.
+func (b *Bridge) logMalformedRequest(r *Request, err error) {
+	if logrus.GetLevel() < logrus.DebugLevel {
+		return
+	}
+	logrus.Debugf("bridge: failed to unmarshal request: ID: 0x%x, Type: 0x%x, error: %s, message: '%s'",
+		r.Header.ID, r.Header.Type, err, b.redact(r.Message))
+}
+
+// redactMessage returns a copy of the given JSON message with the values of any
+// fields matching fields replaced with a placeholder. String values which are
+// themselves JSON documents (such as ContainerConfig) are redacted as well.
+func redactMessage(message []byte, fields []string) string {
+	var v interface{}
+	if err := json.Unmarshal(message, &v); err != nil {
+		return redactText(string(message), fields)
+	}
+	redacted, err := json.Marshal(redactValue(v, fields))
+	if err != nil {
+		return redactText(string(message), fields)
+	}
+	return string(redacted)
+}
+
+// redactValue walks the decoded JSON value v, masking matching fields.
+func redactValue(v interface{}, fields []string) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, fv := range t {
+			if isRedactedField(k, fields) {
+				t[k] = redactedValue
+			} else {
+				t[k] = redactValue(fv, fields)
+			}
+		}
+		return t
+	case []interface{}:
+		for i, ev := range t {
+			t[i] = redactValue(ev, fields)
+		}
+		return t
+	case string:
+		// Nested JSON documents are passed as strings in several messages.
+		trimmed := strings.TrimSpace(t)
+		if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+			return redactMessage([]byte(trimmed), fields)
+		}
+		return t
+	default:
+		return t
+	}
+}
+
+// redactText masks matching fields in text which could not be parsed as JSON.
+func redactText(text string, fields []string) string {
+	return jsonFieldPattern.ReplaceAllStringFunc(text, func(pair string) string {
+		m := jsonFieldPattern.FindStringSubmatch(pair)
+		if !isRedactedField(m[1], fields) {
+			return pair
+		}
+		return `"` + m[1] + `"` + m[2] + `"` + redactedValue + `"`
+	})
+}
+
+// isRedactedField returns true if name contains any of the given fragments,
+// ignoring case.
+func isRedactedField(name string, fields []string) bool {
+	lower := strings.ToLower(name)
+	for _, f := range fields {
+		if f != "" && strings.Contains(lower, strings.ToLower(f)) {
+			return true
+		}
+	}
+	return false
+}
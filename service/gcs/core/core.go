@@ -3,24 +3,57 @@
 package core
 
 import (
+	"context"
+	"io"
+	"os"
+	"time"
+
 	"github.com/Microsoft/opengcs/service/gcs/oslayer"
 	"github.com/Microsoft/opengcs/service/gcs/prot"
 	"github.com/Microsoft/opengcs/service/gcs/runtime"
 	"github.com/Microsoft/opengcs/service/gcs/stdio"
+	oci "github.com/opencontainers/runtime-spec/specs-go"
 )
 
 // Core is the interface defining the core functionality of the GCS-like
 // program. For a real implementation, this may include creating and configuring
 // containers. However, it is also easily mocked out for testing.
+//
+// Methods which take a context abandon their work and return the context's
+// error if it is done before they complete.
 type Core interface {
-	CreateContainer(id string, info prot.VMHostedContainerSettings) error
+	CreateContainer(ctx context.Context, id string, info prot.VMHostedContainerSettings) error
 	ExecProcess(id string, info prot.ProcessParameters, stdioSet *stdio.ConnectionSet) (pid int, err error)
 	SignalContainer(id string, signal oslayer.Signal) error
+	SignalContainerProcesses(id string, signal oslayer.Signal) error
+	ShutdownContainer(id string, signal oslayer.Signal, gracePeriod time.Duration) error
+	RestartInit(id string) error
 	SignalProcess(pid int, options prot.SignalProcessOptions) error
 	ListProcesses(id string) ([]runtime.ContainerProcessState, error)
 	RunExternalProcess(info prot.ProcessParameters, stdioSet *stdio.ConnectionSet) (pid int, err error)
-	ModifySettings(id string, request prot.ResourceModificationRequestResponse) error
+	ModifySettings(ctx context.Context, id string, request prot.ResourceModificationRequestResponse) error
 	ResizeConsole(pid int, height, width uint16) error
-	WaitContainer(id string) (int, error)
+	WaitContainer(id string) (prot.ContainerExitStatus, error)
 	WaitProcess(pid int) (int, error)
+	GetProcessCreatedTime(pid int) (time.Time, error)
+	GetScratchDiskUsage(id string) (prot.ScratchDiskUsage, error)
+	SyncContainer(id string, freeze bool, timeout time.Duration) error
+	CheckpointContainer(id string, options prot.CheckpointOptions) error
+	RestoreContainer(id string, config oci.Spec, options prot.CheckpointOptions) error
+	GetInitOutput(id string) ([]byte, error)
+	GetContainerMetadata(id string) (prot.ContainerMetadata, error)
+	ListContainers() ([]prot.ContainerInfo, error)
+	GetContainerState(id string) (prot.ContainerStatus, error)
+	AttachProcess(id string, pid int, stdioSet *stdio.ConnectionSet) error
+	GetMounts(id string) ([]prot.MountInfo, error)
+	DeleteContainer(id string) error
+	WriteProcessStdin(id string, pid int, data []byte) (int, error)
+	GetGuestInfo() (prot.GuestInfo, error)
+	GetGCSResourceUsage() (prot.GCSResourceUsage, error)
+	GetStartTimings(id string) (prot.ContainerStartTimings, error)
+	GetTimeOffset(id string) (prot.TimeOffset, error)
+	GetNetworkStats(id string) (prot.ContainerNetworkStatistics, error)
+	ValidateContainer(id string, info prot.VMHostedContainerSettings) error
+	OpenContainerFile(id, path string) (io.ReadCloser, int64, error)
+	WriteContainerFile(id, path string, mode os.FileMode, r io.Reader) (int64, error)
 }
@@ -0,0 +1,133 @@
+package gcs
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/Microsoft/opengcs/service/gcs/gcserr"
+	"github.com/Microsoft/opengcs/service/gcs/prot"
+	"github.com/Microsoft/opengcs/service/gcs/stdio"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// minBandwidthBurstBytes is the smallest burst allowed for a bandwidth limit,
+// so that low limits still pass full-sized packets.
+const minBandwidthBurstBytes = 16 * 1024
+
+// ingressQdiscHandle is the handle of the ingress qdisc that ingress
+// policing filters are attached to.
+const ingressQdiscHandle = "ffff:"
+
+// validateBandwidth returns an HrInvalidArg error if any of adapters has a
+// negative bandwidth limit.
+func validateBandwidth(adapters []prot.NetworkAdapter) error {
+	for _, adapter := range adapters {
+		if adapter.IngressBandwidthBps < 0 || adapter.EgressBandwidthBps < 0 {
+			return gcserr.WrapHresult(errors.Errorf("network adapter %s has a negative bandwidth limit", adapter.AdapterInstanceID), gcserr.HrInvalidArg)
+		}
+	}
+	return nil
+}
+
+// bandwidthBurstBytes returns the burst allowed for a limit of bps bytes per
+// second, which is a tenth of a second of traffic.
+func bandwidthBurstBytes(bps int64) int64 {
+	burst := bps / 10
+	if burst < minBandwidthBurstBytes {
+		burst = minBandwidthBurstBytes
+	}
+	return burst
+}
+
+// bandwidthCommands returns the tc commands which apply the bandwidth limits
+// of adapter to the interface ifName. Egress is shaped with a token bucket
+// filter at the root, and ingress, which cannot be shaped, is policed by a
+// filter on the ingress qdisc which drops traffic over the limit.
+func bandwidthCommands(ifName string, adapter prot.NetworkAdapter) [][]string {
+	var commands [][]string
+	if bps := adapter.EgressBandwidthBps; bps > 0 {
+		commands = append(commands, []string{
+			"tc", "qdisc", "add", "dev", ifName, "root", "tbf",
+			"rate", fmt.Sprintf("%dbps", bps),
+			"burst", strconv.FormatInt(bandwidthBurstBytes(bps), 10),
+			"latency", "50ms",
+		})
+	}
+	if bps := adapter.IngressBandwidthBps; bps > 0 {
+		commands = append(commands,
+			[]string{"tc", "qdisc", "add", "dev", ifName, "handle", ingressQdiscHandle, "ingress"},
+			[]string{
+				"tc", "filter", "add", "dev", ifName, "parent", ingressQdiscHandle,
+				"protocol", "all", "u32", "match", "u32", "0", "0",
+				"police", "rate", fmt.Sprintf("%dbps", bps),
+				"burst", strconv.FormatInt(bandwidthBurstBytes(bps), 10),
+				"drop", "flowid", ":1",
+			})
+	}
+	return commands
+}
+
+// bandwidthTeardownCommands returns the tc commands which remove the qdiscs,
+// and so the filters, added by bandwidthCommands for adapter from the
+// interface ifName.
+func bandwidthTeardownCommands(ifName string, adapter prot.NetworkAdapter) [][]string {
+	var commands [][]string
+	if adapter.EgressBandwidthBps > 0 {
+		commands = append(commands, []string{"tc", "qdisc", "del", "dev", ifName, "root"})
+	}
+	if adapter.IngressBandwidthBps > 0 {
+		commands = append(commands, []string{"tc", "qdisc", "del", "dev", ifName, "handle", ingressQdiscHandle, "ingress"})
+	}
+	return commands
+}
+
+// runTcCommand runs the tc command args. If nspid is nonzero, it is run in the
+// network namespace of that process.
+func (c *gcsCore) runTcCommand(nspid int, args []string) error {
+	if nspid != 0 {
+		args = append([]string{"nsenter", fmt.Sprintf("--net=/proc/%d/ns/net", nspid)}, args...)
+	}
+	cmd := c.OS.Command(args[0], args[1:]...)
+	output := stdio.NewCappedBuffer()
+	cmd.SetStdout(output)
+	cmd.SetStderr(output)
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, "failed to run %v: %s", args, output.Bytes())
+	}
+	return nil
+}
+
+// applyBandwidthLimits applies the bandwidth limits of adapter to the
+// interface ifName in the network namespace of the process nspid.
+func (c *gcsCore) applyBandwidthLimits(nspid int, ifName string, adapter prot.NetworkAdapter) error {
+	for _, args := range bandwidthCommands(ifName, adapter) {
+		if err := c.runTcCommand(nspid, args); err != nil {
+			return errors.Wrapf(err, "failed to apply bandwidth limits for adapter %s", adapter.AdapterInstanceID)
+		}
+	}
+	return nil
+}
+
+// removeBandwidthLimits removes the bandwidth limits of each of adapters from
+// its interface, which has returned to the utility VM's network namespace
+// after the container's was destroyed. Failures are only logged, since the
+// limits no longer affect the container.
+func (c *gcsCore) removeBandwidthLimits(adapters []prot.NetworkAdapter) {
+	for _, adapter := range adapters {
+		commands := bandwidthTeardownCommands("", adapter)
+		if len(commands) == 0 {
+			continue
+		}
+		ifName, err := c.instanceIDToName(adapter.AdapterInstanceID)
+		if err != nil {
+			logrus.Warnf("failed to remove bandwidth limits for adapter %s: %s", adapter.AdapterInstanceID, err)
+			continue
+		}
+		for _, args := range bandwidthTeardownCommands(ifName, adapter) {
+			if err := c.runTcCommand(0, args); err != nil {
+				logrus.Warnf("failed to remove bandwidth limits for adapter %s: %s", adapter.AdapterInstanceID, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package gcs
+
+import (
+	"github.com/Microsoft/opengcs/service/gcs/gcserr"
+	"github.com/Microsoft/opengcs/service/gcs/prot"
+	"github.com/Microsoft/opengcs/service/gcs/runtime"
+	"github.com/Microsoft/opengcs/service/gcs/stdio"
+	oci "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pkg/errors"
+)
+
+// CheckpointContainer dumps the state of the container with the given ID to
+// the images path in options using the container runtime.
+func (c *gcsCore) CheckpointContainer(id string, options prot.CheckpointOptions) error {
+	c.containerCacheMutex.Lock()
+	containerEntry := c.getContainer(id)
+	if containerEntry == nil {
+		c.containerCacheMutex.Unlock()
+		return errors.WithStack(gcserr.NewContainerDoesNotExistError(id))
+	}
+	container := containerEntry.container
+	c.containerCacheMutex.Unlock()
+
+	if container == nil {
+		return errors.Errorf("container %s has not been started and cannot be checkpointed", id)
+	}
+	if err := container.Checkpoint(toRuntimeCheckpointOptions(options)); err != nil {
+		return errors.Wrapf(err, "failed to checkpoint container %s", id)
+	}
+	return nil
+}
+
+// RestoreContainer restores the container with the given ID from the images
+// path in options using the container runtime. The container must have been
+// created but not yet started, and config is used as its OCI configuration in
+// place of the one normally supplied with its init process. Once restored, the
+// container's init process is tracked in the same way as one started by
+// ExecProcess.
+func (c *gcsCore) RestoreContainer(id string, config oci.Spec, options prot.CheckpointOptions) error {
+	c.containerCacheMutex.Lock()
+	defer c.containerCacheMutex.Unlock()
+
+	containerEntry := c.getContainer(id)
+	if containerEntry == nil {
+		return errors.WithStack(gcserr.NewContainerDoesNotExistError(id))
+	}
+	if containerEntry.hasRunInitProcess {
+		return errors.Errorf("container %s has already been started and cannot be restored", id)
+	}
+	containerEntry.hasRunInitProcess = true
+
+	config = withHostname(containerEntry.mountSettings.apply(config), containerEntry.hostname)
+	config = withSyslogMount(config, containerEntry.syslogSocketPath())
+	config = withInitShim(config, containerEntry.initShimPath())
+	config = withSecretMounts(config, containerEntry.secretMounts)
+	config = withDeviceCgroupRules(config, containerEntry.devices)
+	config = withTimeNamespace(config, containerEntry.timeOffset)
+	if err := c.writeConfigFile(id, runtimeConfig{Spec: config, timeOffset: containerEntry.timeOffset}); err != nil {
+		containerEntry.exitWg.Done()
+		return err
+	}
+
+	stdioSet := &stdio.ConnectionSet{}
+	if initOutput, ok := c.initOutputs[id]; ok {
+		stdioSet.Out = initOutput
+		stdioSet.Err = initOutput
+	}
+
+	container, err := c.Rtime.RestoreContainer(id, c.getContainerStoragePath(id), stdioSet, toRuntimeCheckpointOptions(options))
+	if err != nil {
+		containerEntry.exitWg.Done()
+		return errors.Wrapf(err, "failed to restore container %s", id)
+	}
+
+	containerEntry.container = container
+	containerEntry.cgroupPath = getCgroupPath(id, config)
+	if err := c.applyCreateLimits(containerEntry); err != nil {
+		containerEntry.exitWg.Done()
+		return err
+	}
+	processEntry := newProcessCacheEntry(id)
+	processEntry.exitWg.Add(1)
+	processEntry.Tty = container.Tty()
+	processEntry.Pipes = container.PipeRelay()
+
+	if err := c.configureNetworkAdapters(container, containerEntry.NetworkAdapters); err != nil {
+		containerEntry.exitWg.Done()
+		return err
+	}
+
+	go c.waitInitProcess(containerEntry, processEntry, container, stdioSet)
+
+	c.processCacheMutex.Lock()
+	c.processCache[container.Pid()] = processEntry
+	c.processCacheMutex.Unlock()
+	return nil
+}
+
+// toRuntimeCheckpointOptions converts checkpoint options from the protocol to
+// the form understood by the container runtime.
+func toRuntimeCheckpointOptions(options prot.CheckpointOptions) runtime.CheckpointOptions {
+	return runtime.CheckpointOptions{
+		ImagesPath:     options.ImagesPath,
+		LeaveRunning:   options.LeaveRunning,
+		TCPEstablished: options.TCPEstablished,
+	}
+}
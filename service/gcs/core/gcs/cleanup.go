@@ -12,13 +12,39 @@ import (
 // This function expects containerCacheMutex to be locked on entry.
 func (c *gcsCore) cleanupContainer(containerEntry *containerCacheEntry) error {
 	var errToReturn error
-	if err := c.forceDeleteContainer(containerEntry.container); err != nil {
+	// The hook's failure is only logged, so that it cannot leave the
+	// container's storage behind.
+	if err := c.runPreDeleteHook(containerEntry); err != nil {
+		logrus.Warn(err)
+	}
+	// A container which was deleted before it was started has no runtime
+	// container.
+	if containerEntry.container != nil {
+		if err := c.forceDeleteContainer(containerEntry.container); err != nil {
+			logrus.Warn(err)
+			if errToReturn == nil {
+				errToReturn = err
+			}
+		}
+	}
+
+	if containerEntry.syslog != nil {
+		if err := containerEntry.syslog.Close(); err != nil {
+			logrus.Warn(err)
+		}
+	}
+
+	if err := c.unmountSecrets(containerEntry); err != nil {
 		logrus.Warn(err)
 		if errToReturn == nil {
 			errToReturn = err
 		}
 	}
 
+	// The container's network namespace is gone, so its adapters are back in
+	// the utility VM's.
+	c.removeBandwidthLimits(containerEntry.NetworkAdapters)
+
 	diskMap := containerEntry.MappedVirtualDisks
 	disks := make([]prot.MappedVirtualDisk, 0, len(diskMap))
 	for _, disk := range diskMap {
@@ -41,6 +67,21 @@ func (c *gcsCore) cleanupContainer(containerEntry *containerCacheEntry) error {
 			errToReturn = err
 		}
 	}
+	// The shared scratch is mounted inside the container's root filesystem,
+	// so it must be unmounted first.
+	if err := c.unmountSharedScratch(containerEntry); err != nil {
+		logrus.Warn(err)
+		if errToReturn == nil {
+			errToReturn = err
+		}
+	}
+	// Trimming is best effort, so a failure does not prevent the container's
+	// storage from being cleaned up.
+	if containerEntry.sandboxDiscard {
+		if err := c.trimSandbox(containerEntry.ID); err != nil {
+			logrus.Warn(err)
+		}
+	}
 	if err := c.unmountLayers(containerEntry.ID); err != nil {
 		logrus.Warn(err)
 		if errToReturn == nil {
@@ -56,6 +97,14 @@ func (c *gcsCore) cleanupContainer(containerEntry *containerCacheEntry) error {
 				errToReturn = err
 			}
 		}
+		for _, dir := range containerEntry.explicitOverlayDirs {
+			if err := c.OS.RemoveAll(dir); err != nil {
+				logrus.Warn(err)
+				if errToReturn == nil {
+					errToReturn = err
+				}
+			}
+		}
 	} else {
 		logrus.Warnf("Failed to unmount storage for container (%s). Will not delete!", containerEntry.ID)
 		logrus.Warn(errToReturn)
@@ -0,0 +1,130 @@
+package gcs
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"github.com/Microsoft/opengcs/service/gcs/gcserr"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// containerPath returns the path in the utility VM of path in the mount
+// namespace of the running container with the given ID. The path is resolved
+// through the container's init process's root, so absolute symbolic links
+// within the container are resolved against the utility VM's root rather than
+// the container's.
+func (c *gcsCore) containerPath(id, path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		return "", gcserr.WrapHresult(errors.Errorf("the path \"%s\" is not absolute", path), gcserr.HrInvalidArg)
+	}
+
+	c.containerCacheMutex.RLock()
+	defer c.containerCacheMutex.RUnlock()
+
+	containerEntry := c.getContainer(id)
+	if containerEntry == nil {
+		return "", errors.WithStack(gcserr.NewContainerDoesNotExistError(id))
+	}
+	if containerEntry.container == nil || containerEntry.initExited {
+		return "", errors.Errorf("container %s is not running", id)
+	}
+	rootPath := filepath.Join("/proc", strconv.Itoa(containerEntry.container.Pid()), "root")
+	return filepath.Join(rootPath, filepath.Clean(path)), nil
+}
+
+// OpenContainerFile opens the regular file at path in the mount namespace of
+// the running container with the given ID, and returns it along with its size.
+func (c *gcsCore) OpenContainerFile(id, path string) (io.ReadCloser, int64, error) {
+	hostPath, err := c.containerPath(id, path)
+	if err != nil {
+		return nil, 0, err
+	}
+	var stat syscall.Stat_t
+	if err := c.OS.Stat(hostPath, &stat); err != nil {
+		return nil, 0, errors.Wrapf(err, "failed to stat %s in container %s", path, id)
+	}
+	switch stat.Mode & syscall.S_IFMT {
+	case syscall.S_IFREG:
+	case syscall.S_IFDIR:
+		return nil, 0, gcserr.WrapHresult(errors.Errorf("%s in container %s is a directory", path, id), gcserr.HrInvalidArg)
+	default:
+		return nil, 0, gcserr.WrapHresult(errors.Errorf("%s in container %s is not a regular file", path, id), gcserr.HrInvalidArg)
+	}
+	f, err := c.OS.OpenFile(hostPath, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "failed to open %s in container %s", path, id)
+	}
+	return f, stat.Size, nil
+}
+
+// WriteContainerFile atomically replaces the file at path in the mount
+// namespace of the running container with the given ID with the contents read
+// from r, and gives it the permission bits in mode. The contents are written
+// to a temporary file in the same directory, which is then renamed over path,
+// so that processes in the container never see a partially written file. The
+// directory containing path must already exist. It returns the number of
+// bytes written.
+func (c *gcsCore) WriteContainerFile(id, path string, mode os.FileMode, r io.Reader) (int64, error) {
+	if mode&^(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky) != 0 {
+		return 0, gcserr.WrapHresult(errors.Errorf("mode %v for %s is not a set of permission bits", mode, path), gcserr.HrInvalidArg)
+	}
+	hostPath, err := c.containerPath(id, path)
+	if err != nil {
+		return 0, err
+	}
+	var stat syscall.Stat_t
+	dir := filepath.Dir(hostPath)
+	if err := c.OS.Stat(dir, &stat); err != nil {
+		return 0, gcserr.WrapHresult(errors.Wrapf(err, "the parent directory of %s in container %s does not exist", path, id), gcserr.HrInvalidArg)
+	}
+	if stat.Mode&syscall.S_IFMT != syscall.S_IFDIR {
+		return 0, gcserr.WrapHresult(errors.Errorf("the parent of %s in container %s is not a directory", path, id), gcserr.HrInvalidArg)
+	}
+	if err := c.OS.Stat(hostPath, &stat); err == nil && stat.Mode&syscall.S_IFMT == syscall.S_IFDIR {
+		return 0, gcserr.WrapHresult(errors.Errorf("%s in container %s is a directory", path, id), gcserr.HrInvalidArg)
+	}
+
+	tempPath := filepath.Join(dir, fmt.Sprintf(".%s.%d.tmp", filepath.Base(hostPath), c.clock().UnixNano()))
+	n, err := c.writeFileContents(tempPath, mode, r)
+	if err == nil {
+		if err = c.OS.Rename(tempPath, hostPath); err != nil {
+			err = errors.Wrapf(err, "failed to rename %s to %s", tempPath, hostPath)
+		}
+	}
+	if err != nil {
+		if removeErr := c.OS.RemoveAll(tempPath); removeErr != nil {
+			logrus.Warnf("failed to remove temporary file %s: %s", tempPath, removeErr)
+		}
+		return 0, errors.Wrapf(err, "failed to write %s in container %s", path, id)
+	}
+	return n, nil
+}
+
+// writeFileContents creates a new file at path with the contents read from r
+// and the permission bits in mode, regardless of the umask, and flushes it to
+// disk.
+func (c *gcsCore) writeFileContents(path string, mode os.FileMode, r io.Reader) (int64, error) {
+	f, err := c.OS.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode.Perm())
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to create %s", path)
+	}
+	n, err := io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to write %s", path)
+	}
+	if err := c.OS.Chmod(path, mode); err != nil {
+		return 0, errors.Wrapf(err, "failed to set the mode of %s", path)
+	}
+	if err := c.OS.Fsync(path); err != nil {
+		return 0, errors.Wrapf(err, "failed to flush %s", path)
+	}
+	return n, nil
+}
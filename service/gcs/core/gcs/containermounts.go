@@ -0,0 +1,146 @@
+package gcs
+
+import (
+	"path/filepath"
+
+	"github.com/Microsoft/opengcs/service/gcs/gcserr"
+	"github.com/Microsoft/opengcs/service/gcs/prot"
+	oci "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pkg/errors"
+)
+
+// containerMountSettings holds the mounts, masked paths and read-only paths
+// given at create, which are applied to the container's OCI specification when
+// its init process is started.
+type containerMountSettings struct {
+	mounts        []prot.Mount
+	maskedPaths   []string
+	readonlyPaths []string
+}
+
+// newContainerMountSettings validates the mount settings in settings and
+// returns them.
+func newContainerMountSettings(settings prot.VMHostedContainerSettings) (containerMountSettings, error) {
+	for _, mount := range settings.Mounts {
+		if !filepath.IsAbs(mount.Destination) {
+			return containerMountSettings{}, gcserr.WrapHresult(errors.Errorf("mount destination \"%s\" is not an absolute path", mount.Destination), gcserr.HrInvalidArg)
+		}
+	}
+	for _, paths := range [][]string{settings.MaskedPaths, settings.ReadonlyPaths} {
+		for _, path := range paths {
+			if !filepath.IsAbs(path) {
+				return containerMountSettings{}, gcserr.WrapHresult(errors.Errorf("path \"%s\" is not an absolute path", path), gcserr.HrInvalidArg)
+			}
+		}
+	}
+	return containerMountSettings{
+		mounts:        settings.Mounts,
+		maskedPaths:   settings.MaskedPaths,
+		readonlyPaths: settings.ReadonlyPaths,
+	}, nil
+}
+
+// apply returns a copy of config with the mount settings added. A mount
+// replaces any mount in config with the same destination. runc masks the
+// masked paths by bind mounting /dev/null over them, and remounts the
+// read-only paths read-only. config itself is not modified.
+func (s containerMountSettings) apply(config oci.Spec) oci.Spec {
+	if len(s.mounts) == 0 && len(s.maskedPaths) == 0 && len(s.readonlyPaths) == 0 {
+		return config
+	}
+
+	mounts := make([]oci.Mount, 0, len(config.Mounts)+len(s.mounts))
+	for _, existing := range config.Mounts {
+		if !s.overridesMount(existing.Destination) {
+			mounts = append(mounts, existing)
+		}
+	}
+	for _, mount := range s.mounts {
+		mounts = append(mounts, oci.Mount{
+			Destination: mount.Destination,
+			Type:        mount.Type,
+			Source:      mount.Source,
+			Options:     mount.Options,
+		})
+	}
+	config.Mounts = mounts
+
+	var linux oci.Linux
+	if config.Linux != nil {
+		linux = *config.Linux
+	}
+	linux.MaskedPaths = appendMissingPaths(linux.MaskedPaths, s.maskedPaths)
+	linux.ReadonlyPaths = appendMissingPaths(linux.ReadonlyPaths, s.readonlyPaths)
+	config.Linux = &linux
+	return config
+}
+
+// rootfsPropagations are the mount propagations a container's root
+// filesystem may be given.
+var rootfsPropagations = map[string]bool{
+	"shared":   true,
+	"slave":    true,
+	"private":  true,
+	"rshared":  true,
+	"rslave":   true,
+	"rprivate": true,
+}
+
+// validateRootfsPropagation returns an HrInvalidArg error if propagation is
+// not a mount propagation runc can give a container's root filesystem.
+func validateRootfsPropagation(propagation string) error {
+	if !rootfsPropagations[propagation] {
+		return gcserr.WrapHresult(errors.Errorf("unsupported root filesystem propagation \"%s\"", propagation), gcserr.HrInvalidArg)
+	}
+	return nil
+}
+
+// withRootfsSettings returns a copy of config whose root filesystem is
+// read-only if readonly is set, and has the given mount propagation if it is
+// not empty. runc remounts the root filesystem read-only after setting up the
+// container's mounts, so they remain writable.
+func withRootfsSettings(config oci.Spec, readonly bool, propagation string) oci.Spec {
+	if readonly {
+		var root oci.Root
+		if config.Root != nil {
+			root = *config.Root
+		}
+		root.Readonly = true
+		config.Root = &root
+	}
+	if propagation != "" {
+		var linux oci.Linux
+		if config.Linux != nil {
+			linux = *config.Linux
+		}
+		linux.RootfsPropagation = propagation
+		config.Linux = &linux
+	}
+	return config
+}
+
+// overridesMount returns whether one of the mounts in s has the given
+// destination.
+func (s containerMountSettings) overridesMount(destination string) bool {
+	for _, mount := range s.mounts {
+		if filepath.Clean(mount.Destination) == filepath.Clean(destination) {
+			return true
+		}
+	}
+	return false
+}
+
+// appendMissingPaths returns a new slice containing paths followed by
+// additional, with duplicates removed.
+func appendMissingPaths(paths []string, additional []string) []string {
+	result := make([]string, 0, len(paths)+len(additional))
+	seen := make(map[string]bool)
+	for _, path := range append(append([]string{}, paths...), additional...) {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		result = append(result, path)
+	}
+	return result
+}
@@ -0,0 +1,87 @@
+package gcs
+
+import (
+	"strings"
+
+	"github.com/Microsoft/opengcs/service/gcs/gcserr"
+	"github.com/Microsoft/opengcs/service/gcs/prot"
+	oci "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pkg/errors"
+)
+
+// validateDeviceCgroupRules returns an HrInvalidArg error if any of rules has
+// an unknown type, a negative device number other than the wildcard, or an
+// access string which is empty or not made up of distinct "r", "w" and "m"
+// characters.
+func validateDeviceCgroupRules(rules []prot.DeviceCgroupRule) error {
+	for i, rule := range rules {
+		switch rule.Type {
+		case "a", "b", "c":
+		default:
+			return gcserr.WrapHresult(errors.Errorf("device rule %d has unknown type \"%s\"", i, rule.Type), gcserr.HrInvalidArg)
+		}
+		if rule.Major < prot.DeviceCgroupWildcard {
+			return gcserr.WrapHresult(errors.Errorf("device rule %d has invalid major number %d", i, rule.Major), gcserr.HrInvalidArg)
+		}
+		if rule.Minor < prot.DeviceCgroupWildcard {
+			return gcserr.WrapHresult(errors.Errorf("device rule %d has invalid minor number %d", i, rule.Minor), gcserr.HrInvalidArg)
+		}
+		if rule.Access == "" || len(rule.Access) > 3 {
+			return gcserr.WrapHresult(errors.Errorf("device rule %d has invalid access \"%s\"", i, rule.Access), gcserr.HrInvalidArg)
+		}
+		for j, c := range rule.Access {
+			if !strings.ContainsRune("rwm", c) || strings.ContainsRune(rule.Access[:j], c) {
+				return gcserr.WrapHresult(errors.Errorf("device rule %d has invalid access \"%s\"", i, rule.Access), gcserr.HrInvalidArg)
+			}
+		}
+	}
+	return nil
+}
+
+// toDeviceCgroupRules converts rules to their form in an OCI specification.
+func toDeviceCgroupRules(rules []prot.DeviceCgroupRule) []oci.LinuxDeviceCgroup {
+	if len(rules) == 0 {
+		return nil
+	}
+	devices := make([]oci.LinuxDeviceCgroup, 0, len(rules))
+	for _, rule := range rules {
+		device := oci.LinuxDeviceCgroup{
+			Allow:  rule.Allow,
+			Type:   rule.Type,
+			Access: rule.Access,
+		}
+		if rule.Major != prot.DeviceCgroupWildcard {
+			major := rule.Major
+			device.Major = &major
+		}
+		if rule.Minor != prot.DeviceCgroupWildcard {
+			minor := rule.Minor
+			device.Minor = &minor
+		}
+		devices = append(devices, device)
+	}
+	return devices
+}
+
+// withDeviceCgroupRules returns a copy of config with devices appended to the
+// device cgroup rules in its resources, so that they take precedence over any
+// rules config already has. If devices is empty, config is returned unchanged.
+func withDeviceCgroupRules(config oci.Spec, devices []oci.LinuxDeviceCgroup) oci.Spec {
+	if len(devices) == 0 {
+		return config
+	}
+	var linux oci.Linux
+	if config.Linux != nil {
+		linux = *config.Linux
+	}
+	var resources oci.LinuxResources
+	if linux.Resources != nil {
+		resources = *linux.Resources
+	}
+	rules := make([]oci.LinuxDeviceCgroup, 0, len(resources.Devices)+len(devices))
+	rules = append(rules, resources.Devices...)
+	resources.Devices = append(rules, devices...)
+	linux.Resources = &resources
+	config.Linux = &linux
+	return config
+}
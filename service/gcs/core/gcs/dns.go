@@ -0,0 +1,120 @@
+package gcs
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+
+	"github.com/Microsoft/opengcs/service/gcs/gcserr"
+	"github.com/Microsoft/opengcs/service/gcs/prot"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// validateDNSSettings returns an HrInvalidArg error if dns has more than
+// prot.MaxDNSServers servers, a server which is not an IP address, or a search
+// domain or option which is empty or contains whitespace.
+func validateDNSSettings(dns prot.DNSSettings) error {
+	if len(dns.Servers) > prot.MaxDNSServers {
+		return gcserr.WrapHresult(errors.Errorf("%d DNS servers were given, but at most %d can be used", len(dns.Servers), prot.MaxDNSServers), gcserr.HrInvalidArg)
+	}
+	for _, server := range dns.Servers {
+		if net.ParseIP(server) == nil {
+			return gcserr.WrapHresult(errors.Errorf("DNS server \"%s\" is not a valid IP address", server), gcserr.HrInvalidArg)
+		}
+	}
+	for _, values := range [][]string{dns.Search, dns.Options} {
+		for _, value := range values {
+			if value == "" || strings.ContainsAny(value, " \t\n\x00") {
+				return gcserr.WrapHresult(errors.Errorf("DNS search domain or option \"%s\" is empty or contains whitespace", value), gcserr.HrInvalidArg)
+			}
+		}
+	}
+	return nil
+}
+
+// addDNSSettings returns the result of adding the values in added which are
+// not already in dns to the end of it.
+func addDNSSettings(dns, added prot.DNSSettings) prot.DNSSettings {
+	return prot.DNSSettings{
+		Servers: appendMissingPaths(dns.Servers, added.Servers),
+		Search:  appendMissingPaths(dns.Search, added.Search),
+		Options: appendMissingPaths(dns.Options, added.Options),
+	}
+}
+
+// removeDNSSettings returns the result of removing the values in removed from
+// dns.
+func removeDNSSettings(dns, removed prot.DNSSettings) prot.DNSSettings {
+	return prot.DNSSettings{
+		Servers: removeStrings(dns.Servers, removed.Servers),
+		Search:  removeStrings(dns.Search, removed.Search),
+		Options: removeStrings(dns.Options, removed.Options),
+	}
+}
+
+// removeStrings returns a new slice with the values of values which are not
+// in removed.
+func removeStrings(values, removed []string) []string {
+	removedSet := make(map[string]bool)
+	for _, value := range removed {
+		removedSet[value] = true
+	}
+	var result []string
+	for _, value := range values {
+		if !removedSet[value] {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// resolvConfContents returns the contents of a resolv.conf file for dns.
+func resolvConfContents(dns prot.DNSSettings) string {
+	var b strings.Builder
+	for _, server := range dns.Servers {
+		fmt.Fprintf(&b, "nameserver %s\n", server)
+	}
+	if len(dns.Search) != 0 {
+		fmt.Fprintf(&b, "search %s\n", strings.Join(dns.Search, " "))
+	}
+	if len(dns.Options) != 0 {
+		fmt.Fprintf(&b, "options %s\n", strings.Join(dns.Options, " "))
+	}
+	return b.String()
+}
+
+// updateResolvConf atomically replaces /etc/resolv.conf in the root filesystem
+// of the container in containerEntry with one for dns, and records dns as the
+// container's DNS settings. The file is written to a temporary file which is
+// renamed over the old one, so that resolvers in the container never read a
+// partially written file.
+func (c *gcsCore) updateResolvConf(containerEntry *containerCacheEntry, dns prot.DNSSettings) error {
+	if err := validateDNSSettings(dns); err != nil {
+		return errors.Wrapf(err, "invalid DNS settings for container %s", containerEntry.ID)
+	}
+	_, _, _, rootfsPath := c.getUnioningPaths(containerEntry.ID)
+	etcPath := filepath.Join(rootfsPath, "etc")
+	if err := c.mkdirAll(etcPath, 0755); err != nil {
+		return errors.Wrapf(err, "failed to create directory %s", etcPath)
+	}
+	resolvPath := filepath.Join(etcPath, "resolv.conf")
+	tempPath := filepath.Join(etcPath, fmt.Sprintf(".resolv.conf.%d.tmp", c.clock().UnixNano()))
+	contents := resolvConfContents(dns)
+	_, err := c.writeFileContents(tempPath, 0644, strings.NewReader(contents))
+	if err == nil {
+		if err = c.OS.Rename(tempPath, resolvPath); err != nil {
+			err = errors.Wrapf(err, "failed to rename %s to %s", tempPath, resolvPath)
+		}
+	}
+	if err != nil {
+		if removeErr := c.OS.RemoveAll(tempPath); removeErr != nil {
+			logrus.Warnf("failed to remove temporary file %s: %s", tempPath, removeErr)
+		}
+		return errors.Wrapf(err, "failed to write resolv.conf for container %s", containerEntry.ID)
+	}
+	containerEntry.dns = dns
+	logrus.Debugf("wrote %s:\n%s", resolvPath, contents)
+	return nil
+}
@@ -5,11 +5,16 @@
 package gcs
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/Microsoft/opengcs/service/gcs/core"
 	"github.com/Microsoft/opengcs/service/gcs/gcserr"
@@ -47,20 +52,50 @@ type gcsCore struct {
 	// into the gcsCore. It is structured as a map from pid to cache entry.
 	processCache map[int]*processCacheEntry
 
+	// initOutputs stores the buffered output of container init processes
+	// started without stdout or stderr pipes. It is structured as a map from
+	// container ID to buffer, and is protected by containerCacheMutex. Unlike
+	// containerCache, entries are kept after the container exits so that the
+	// output can still be retrieved. They are removed the first time the output
+	// is retrieved after the container has exited, or replaced when a
+	// container with the same ID is created.
+	initOutputs map[string]*stdio.RingBuffer
+
+	// sharedScratches stores the shared scratch directories in use by
+	// containers. It is structured as a map from shared scratch ID to entry,
+	// and is protected by containerCacheMutex.
+	sharedScratches map[string]*sharedScratchEntry
+
 	// baseStoragePath is the path where all container storage should be nested.
 	baseStoragePath string
+
+	// clock returns the current time, for timing the phases of starting a
+	// container. It is time.Now outside of tests.
+	clock func() time.Time
+
+	// lastQuotaProjectID is the project ID most recently given to a
+	// container's overlay upperdir for its writable layer quota. It is
+	// protected by containerCacheMutex.
+	lastQuotaProjectID uint32
 }
 
 // NewGCSCore creates a new gcsCore struct initialized with the given Runtime.
 func NewGCSCore(basePath string, rtime runtime.Runtime, os oslayer.OS, vsock transport.Transport) core.Core {
-	return &gcsCore{
+	c := &gcsCore{
 		baseStoragePath: basePath,
 		Rtime:           rtime,
 		OS:              os,
 		vsock:           vsock,
 		containerCache:  make(map[string]*containerCacheEntry),
 		processCache:    make(map[int]*processCacheEntry),
+		initOutputs:     make(map[string]*stdio.RingBuffer),
+		sharedScratches: make(map[string]*sharedScratchEntry),
+		clock:           time.Now,
+	}
+	if OrphanReapInterval > 0 {
+		go c.reapOrphansPeriodically(OrphanReapInterval)
 	}
+	return c
 }
 
 // containerCacheEntry stores cached information for a single container.
@@ -73,14 +108,124 @@ type containerCacheEntry struct {
 	hasRunInitProcess  bool
 	exitWg             sync.WaitGroup
 	exitCode           int
+	// initExited is set, along with exitCode and exitSignal, once the
+	// container's init process has exited. All are written with
+	// containerCacheMutex held.
+	initExited bool
+	exitSignal int
+	// upperDirPath is the overlay upperdir of the container's root
+	// filesystem, where writes to the container are stored.
+	upperDirPath string
+	// explicitOverlayDirs are the overlay upperdir and workdir of the
+	// container if they were specified at create, rather than derived from
+	// its storage path. They are removed when the container is cleaned up.
+	explicitOverlayDirs []string
+	// scratchDevicePath is the block device backing the container's scratch
+	// space, or empty if the container has no scratch device.
+	scratchDevicePath string
+	// sandboxDiscard specifies that the container's scratch space is mounted
+	// with the discard option, and should be trimmed before it is unmounted.
+	sandboxDiscard bool
+	// sharedScratch is the shared scratch directory mounted into the
+	// container, or nil if it has none.
+	sharedScratch *sharedScratchMount
+	// metadata holds the labels and annotations attached to the container by
+	// the host.
+	metadata prot.ContainerMetadata
+	// cgroupPath is the path of the container's cgroup relative to the root of
+	// the cgroup hierarchy. It is set when the container's init process is
+	// started.
+	cgroupPath string
+	// readinessFile, if set, is the path within the container's root
+	// filesystem which must exist before starting the init process is
+	// reported as complete. readinessTimeout bounds the wait.
+	readinessFile    string
+	readinessTimeout time.Duration
+	// user, if set, is the user given at create which the init process runs
+	// as, in the form user or user:group.
+	user string
+	// rootReadonly and rootfsPropagation are the root filesystem settings
+	// given at create, which are applied to the container's OCI
+	// specification.
+	rootReadonly      bool
+	rootfsPropagation string
+	// timeOffset, if set, is the offset of the container's clocks, which
+	// gives it a private time namespace.
+	timeOffset *prot.TimeOffset
+	// mountSettings are the additional mounts, masked paths and read-only
+	// paths applied to the container's OCI specification.
+	mountSettings containerMountSettings
+	// ociSpec, if set, is the OCI specification given at create, which is
+	// used in place of the one in the init process's parameters.
+	ociSpec *oci.Spec
+	// hostname, if set, is the hostname given at create, which is applied to
+	// the container's configuration when its init process is started.
+	hostname string
+	// syslog, if set, forwards the messages written to the container's
+	// /dev/log to its init output buffer. It is closed when the container is
+	// cleaned up.
+	syslog *syslogForwarder
+	// initShim specifies that the container's init process is run under the
+	// GCS's init shim.
+	initShim bool
+	// devices are the device cgroup rules given at create, appended to those
+	// in the container's OCI specification.
+	devices []oci.LinuxDeviceCgroup
+	// pidsLimit, if positive, is the process limit given at create, which is
+	// applied to the container's cgroup when its init process is created.
+	pidsLimit int64
+	// blkioWeight and blkioDeviceLimits are the block IO settings given at
+	// create, which are applied to the container's cgroup along with
+	// pidsLimit.
+	blkioWeight       uint16
+	blkioDeviceLimits []prot.BlkioDeviceLimit
+	// secretsPath is the tmpfs in the utility VM holding the container's
+	// secrets, or empty if it has none. secretMounts bind each secret into
+	// the container.
+	secretsPath  string
+	secretMounts []oci.Mount
+	// maxConcurrentExec, if positive, limits the number of exec'd processes
+	// running in the container at once. runningExecs counts them, and is
+	// written with containerCacheMutex held.
+	maxConcurrentExec uint32
+	runningExecs      uint32
+	// postCreateHook, if set, is run before the container's init process
+	// is started. preDeleteHook, if set, is run before the container's
+	// storage is unmounted.
+	postCreateHook *prot.ContainerHook
+	preDeleteHook  *prot.ContainerHook
+	// dns is the DNS settings most recently written to the container's
+	// /etc/resolv.conf by a modify settings request. It is empty until the
+	// first such request, which replaces the file generated from the
+	// container's network adapters.
+	dns prot.DNSSettings
+	// startTimings records the time taken by each phase of creating the
+	// container and starting its init process.
+	startTimings *startTimings
+	// initParams are the parameters the container's init process was started
+	// with, which RestartInit starts it with again.
+	initParams prot.ProcessParameters
+	// initStopped, if set, is closed once the container's init process has
+	// exited while it is being restarted. The container is then kept rather
+	// than cleaned up.
+	initStopped chan struct{}
+	// ctx is cancelled by cancel when the container is deleted before its
+	// init process is started. Waits for the container then report its
+	// error rather than an exit code.
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 func newContainerCacheEntry(id string) *containerCacheEntry {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &containerCacheEntry{
 		ID:                 id,
 		MappedVirtualDisks: make(map[uint8]prot.MappedVirtualDisk),
 		MappedDirectories:  make(map[uint32]prot.MappedDirectory),
+		metadata:           make(prot.ContainerMetadata),
 		exitCode:           -1,
+		ctx:                ctx,
+		cancel:             cancel,
 	}
 }
 func (e *containerCacheEntry) AddNetworkAdapter(adapter prot.NetworkAdapter) {
@@ -121,6 +266,13 @@ type processCacheEntry struct {
 	ContainerID string // If "" a host process otherwise a container process.
 	exitWg      sync.WaitGroup
 	exitCode    int
+	// Pipes is the relay for the process's stdio pipes, through which its
+	// output can be reattached. It is nil for external processes and for
+	// processes using a TTY.
+	Pipes *stdio.PipeRelay
+	// createdTime is when the process was created, taken as soon as the
+	// runtime or OS reported it started.
+	createdTime time.Time
 }
 
 func newProcessCacheEntry(containerID string) *processCacheEntry {
@@ -134,25 +286,197 @@ func (c *gcsCore) getContainer(id string) *containerCacheEntry {
 	return nil
 }
 
+// validatedCreateSettings holds the values derived from a container's create
+// settings while validating them.
+type validatedCreateSettings struct {
+	networkAdapters []prot.NetworkAdapter
+	ociSpec         *oci.Spec
+	mountSettings   containerMountSettings
+}
+
+// validateCreateSettings checks that settings can be used to create the
+// container with the given ID, without changing the state of the system.
+func validateCreateSettings(id string, settings prot.VMHostedContainerSettings) (validatedCreateSettings, error) {
+	if (settings.UpperDirPath == "") != (settings.WorkDirPath == "") {
+		return validatedCreateSettings{}, errors.Errorf("UpperDirPath and WorkDirPath must either both be set or both be unset for container %s", id)
+	}
+	if settings.PidsLimit < 0 {
+		return validatedCreateSettings{}, gcserr.WrapHresult(errors.Errorf("PidsLimit %d for container %s is negative", settings.PidsLimit, id), gcserr.HrInvalidArg)
+	}
+	if err := validateLayers(settings.Layers); err != nil {
+		return validatedCreateSettings{}, errors.Wrapf(err, "invalid layers for container %s", id)
+	}
+	if err := validateBlkioSettings(settings); err != nil {
+		return validatedCreateSettings{}, errors.Wrapf(err, "invalid block IO settings for container %s", id)
+	}
+	if err := validateHook(settings.PostCreateHook); err != nil {
+		return validatedCreateSettings{}, errors.Wrapf(err, "invalid post-create hook for container %s", id)
+	}
+	if err := validateHook(settings.PreDeleteHook); err != nil {
+		return validatedCreateSettings{}, errors.Wrapf(err, "invalid pre-delete hook for container %s", id)
+	}
+	if settings.InitOutputBufferBytes > prot.MaxInitOutputBufferBytes {
+		return validatedCreateSettings{}, gcserr.WrapHresult(errors.Errorf("InitOutputBufferBytes %d for container %s exceeds the maximum of %d", settings.InitOutputBufferBytes, id, prot.MaxInitOutputBufferBytes), gcserr.HrInvalidArg)
+	}
+	if settings.SandboxFilesystem != "" {
+		if err := validateSandboxFilesystem(settings.SandboxFilesystem); err != nil {
+			return validatedCreateSettings{}, errors.Wrapf(err, "invalid sandbox settings for container %s", id)
+		}
+		if settings.WritableLayerQuotaBytes != 0 && !supportsProjectQuotas(settings.SandboxFilesystem) {
+			return validatedCreateSettings{}, gcserr.WrapHresult(errors.Errorf("the sandbox filesystem %s of container %s does not support project quotas", settings.SandboxFilesystem, id), gcserr.HrNotImpl)
+		}
+	}
+	if err := validateMappedVirtualDisks(settings.MappedVirtualDisks); err != nil {
+		return validatedCreateSettings{}, errors.Wrapf(err, "invalid mapped virtual disks for container %s", id)
+	}
+	if err := validateHostname(settings.Hostname); err != nil {
+		return validatedCreateSettings{}, errors.Wrapf(err, "invalid hostname for container %s", id)
+	}
+	if settings.RootfsPropagation != "" {
+		if err := validateRootfsPropagation(settings.RootfsPropagation); err != nil {
+			return validatedCreateSettings{}, errors.Wrapf(err, "invalid root filesystem settings for container %s", id)
+		}
+	}
+	if settings.User != "" {
+		if err := validateUser(settings.User); err != nil {
+			return validatedCreateSettings{}, errors.Wrapf(err, "invalid user for container %s", id)
+		}
+	}
+	if err := validateHostsEntries(settings.HostsEntries); err != nil {
+		return validatedCreateSettings{}, errors.Wrapf(err, "invalid hosts entries for container %s", id)
+	}
+	if err := validateDeviceCgroupRules(settings.Devices); err != nil {
+		return validatedCreateSettings{}, errors.Wrapf(err, "invalid device rules for container %s", id)
+	}
+	if err := validateSecrets(settings.Secrets); err != nil {
+		return validatedCreateSettings{}, errors.Wrapf(err, "invalid secrets for container %s", id)
+	}
+	if err := validateNetworkAdapterNames(settings.NetworkAdapters); err != nil {
+		return validatedCreateSettings{}, errors.Wrapf(err, "invalid network adapters for container %s", id)
+	}
+	if err := validateRoutes(settings.NetworkAdapters); err != nil {
+		return validatedCreateSettings{}, errors.Wrapf(err, "invalid network adapters for container %s", id)
+	}
+	if err := validateBandwidth(settings.NetworkAdapters); err != nil {
+		return validatedCreateSettings{}, errors.Wrapf(err, "invalid network adapters for container %s", id)
+	}
+	networkAdapters, err := resolveRoutingPolicies(settings.NetworkAdapters)
+	if err != nil {
+		return validatedCreateSettings{}, errors.Wrapf(err, "invalid network adapters for container %s", id)
+	}
+	var ociSpec *oci.Spec
+	if settings.OCISpecJSON != "" {
+		spec, err := parseOCISpec(settings.OCISpecJSON)
+		if err != nil {
+			return validatedCreateSettings{}, errors.Wrapf(err, "invalid OCI specification for container %s", id)
+		}
+		ociSpec = spec
+		if len(settings.Mounts) != 0 || len(settings.MaskedPaths) != 0 || len(settings.ReadonlyPaths) != 0 {
+			logrus.Warnf("ignoring mount settings for container %s since an OCI specification was given", id)
+			settings.Mounts, settings.MaskedPaths, settings.ReadonlyPaths = nil, nil, nil
+		}
+	}
+	mountSettings, err := newContainerMountSettings(settings)
+	if err != nil {
+		return validatedCreateSettings{}, errors.Wrapf(err, "invalid mount settings for container %s", id)
+	}
+	return validatedCreateSettings{
+		networkAdapters: networkAdapters,
+		ociSpec:         ociSpec,
+		mountSettings:   mountSettings,
+	}, nil
+}
+
+// validateMappedVirtualDisks returns an HrInvalidArg error if more than one of
+// disks has the same LUN.
+func validateMappedVirtualDisks(disks []prot.MappedVirtualDisk) error {
+	luns := make(map[uint8]bool)
+	for _, disk := range disks {
+		if luns[disk.Lun] {
+			return gcserr.WrapHresult(errors.Errorf("more than one mapped virtual disk has lun %d", disk.Lun), gcserr.HrInvalidArg)
+		}
+		luns[disk.Lun] = true
+	}
+	return nil
+}
+
+// validateBlkioSettings returns an HrInvalidArg error if the block IO weight
+// in settings is out of range, or if a device is given a negative device
+// number or more than one limit.
+func validateBlkioSettings(settings prot.VMHostedContainerSettings) error {
+	if settings.BlkioWeight != 0 && (settings.BlkioWeight < prot.MinBlkioWeight || settings.BlkioWeight > prot.MaxBlkioWeight) {
+		return gcserr.WrapHresult(errors.Errorf("BlkioWeight %d is not between %d and %d", settings.BlkioWeight, prot.MinBlkioWeight, prot.MaxBlkioWeight), gcserr.HrInvalidArg)
+	}
+	devices := make(map[string]bool)
+	for _, limit := range settings.BlkioDeviceLimits {
+		if limit.Major < 0 || limit.Minor < 0 {
+			return gcserr.WrapHresult(errors.Errorf("block IO limit for device %d:%d has a negative device number", limit.Major, limit.Minor), gcserr.HrInvalidArg)
+		}
+		device := fmt.Sprintf("%d:%d", limit.Major, limit.Minor)
+		if devices[device] {
+			return gcserr.WrapHresult(errors.Errorf("more than one block IO limit is given for device %s", device), gcserr.HrInvalidArg)
+		}
+		devices[device] = true
+	}
+	return nil
+}
+
+// ValidateContainer checks whether CreateContainer would accept settings for
+// a container with the given ID, without creating anything. Settings which can
+// only be checked against the devices attached to the utility VM, such as
+// whether a layer's device exists, are not checked.
+func (c *gcsCore) ValidateContainer(id string, settings prot.VMHostedContainerSettings) error {
+	c.containerCacheMutex.RLock()
+	defer c.containerCacheMutex.RUnlock()
+
+	if c.getContainer(id) != nil {
+		return errors.WithStack(gcserr.NewContainerExistsError(id))
+	}
+	_, err := validateCreateSettings(id, settings)
+	return err
+}
+
 // CreateContainer creates all the infrastructure for a container, including
 // setting up layers and networking, and then starts up its init process in a
 // suspended state waiting for a call to StartContainer.
-func (c *gcsCore) CreateContainer(id string, settings prot.VMHostedContainerSettings) error {
+func (c *gcsCore) CreateContainer(ctx context.Context, id string, settings prot.VMHostedContainerSettings) error {
 	c.containerCacheMutex.Lock()
 	defer c.containerCacheMutex.Unlock()
 
 	if c.getContainer(id) != nil {
 		return errors.WithStack(gcserr.NewContainerExistsError(id))
 	}
+	validated, err := validateCreateSettings(id, settings)
+	if err != nil {
+		return err
+	}
+	networkAdapters := validated.networkAdapters
+	if settings.TimeOffset != nil {
+		if err := c.checkTimeNamespaceSupport(); err != nil {
+			return errors.Wrapf(err, "cannot offset the clocks of container %s", id)
+		}
+	}
 
 	containerEntry := newContainerCacheEntry(id)
+	containerEntry.startTimings = newStartTimings(c.clock)
+	containerEntry.mountSettings = validated.mountSettings
+	containerEntry.ociSpec = validated.ociSpec
+	containerEntry.hostname = settings.Hostname
+	containerEntry.initShim = settings.InitShim
+	containerEntry.devices = toDeviceCgroupRules(settings.Devices)
+	containerEntry.pidsLimit = settings.PidsLimit
+	containerEntry.blkioWeight = settings.BlkioWeight
+	containerEntry.blkioDeviceLimits = settings.BlkioDeviceLimits
+	containerEntry.maxConcurrentExec = settings.MaxConcurrentExec
+	containerEntry.postCreateHook = settings.PostCreateHook
+	containerEntry.preDeleteHook = settings.PreDeleteHook
 	// We must add it here because we begin the wait for the init process before
 	// returning to the HCS. This is safe if failures occur because we dont add to the
 	// containerCache
 	containerEntry.exitWg.Add(1)
 
 	// Set up mapped virtual disks.
-	if err := c.setupMappedVirtualDisks(id, settings.MappedVirtualDisks, containerEntry); err != nil {
+	if err := c.setupMappedVirtualDisks(ctx, id, settings.MappedVirtualDisks, containerEntry); err != nil {
 		return errors.Wrapf(err, "failed to set up mapped virtual disks during create for container %s", id)
 	}
 	// Set up mapped directories.
@@ -161,16 +485,73 @@ func (c *gcsCore) CreateContainer(id string, settings prot.VMHostedContainerSett
 	}
 
 	// Set up layers.
-	scratch, layers, err := c.getLayerMounts(settings.SandboxDataPath, settings.Layers)
+	stopLayerMount := containerEntry.startTimings.begin(phaseLayerMount)
+	scratch, layers, err := c.getLayerMounts(ctx, settings.SandboxDataPath, settings.Layers)
+	stopLayerMount()
 	if err != nil {
 		return errors.Wrapf(err, "failed to get layer devices for container %s", id)
 	}
-	if err := c.mountLayers(id, scratch, layers); err != nil {
+	upperDir, workdirPath := c.getOverlayDirs(id, settings)
+	if err := ctx.Err(); err != nil {
+		return errors.Wrapf(err, "abandoned mounting layers for container %s", id)
+	}
+	if scratch != nil && settings.SandboxFilesystem != "" {
+		stopSandboxMount := containerEntry.startTimings.begin(phaseSandboxMount)
+		err := c.formatSandbox(scratch.Source, settings.SandboxFilesystem, settings.WritableLayerQuotaBytes != 0)
+		stopSandboxMount()
+		if err != nil {
+			return errors.Wrapf(err, "failed to format sandbox for container %s", id)
+		}
+		scratch.FileSystem = settings.SandboxFilesystem
+	}
+	if scratch != nil && settings.SandboxDiscard {
+		scratch.Options = append(scratch.Options, mountOptionDiscard)
+	}
+	if scratch != nil && settings.WritableLayerQuotaBytes != 0 {
+		scratch.Options = append(scratch.Options, mountOptionProjectQuota)
+	}
+	if err := c.mountLayers(id, scratch, layers, upperDir, workdirPath, containerEntry.startTimings); err != nil {
 		return errors.Wrapf(err, "failed to mount layers for container %s", id)
 	}
+	if settings.WritableLayerQuotaBytes != 0 {
+		if err := c.applyWritableLayerQuota(upperDir, settings.WritableLayerQuotaBytes); err != nil {
+			return errors.Wrapf(err, "failed to apply the writable layer quota for container %s", id)
+		}
+	}
+
+	if len(settings.HostsEntries) != 0 {
+		if err := c.writeHostsFile(id, settings.HostsEntries); err != nil {
+			return errors.Wrapf(err, "failed to write hosts file for container %s", id)
+		}
+	}
+
+	containerEntry.upperDirPath = upperDir
+	if settings.UpperDirPath != "" {
+		containerEntry.explicitOverlayDirs = []string{upperDir, workdirPath}
+	}
+	if scratch != nil {
+		containerEntry.scratchDevicePath = scratch.Source
+		containerEntry.sandboxDiscard = settings.SandboxDiscard
+	}
+	if settings.SharedScratch != nil {
+		if err := c.mountSharedScratch(id, settings.SharedScratch, containerEntry); err != nil {
+			return errors.Wrapf(err, "failed to mount shared scratch for container %s", id)
+		}
+	}
+
+	containerEntry.readinessFile = settings.ReadinessFile
+	containerEntry.user = settings.User
+	containerEntry.rootReadonly = settings.RootReadonly
+	containerEntry.timeOffset = settings.TimeOffset
+	containerEntry.rootfsPropagation = settings.RootfsPropagation
+	if settings.ReadinessTimeoutMs != 0 {
+		containerEntry.readinessTimeout = time.Duration(settings.ReadinessTimeoutMs) * time.Millisecond
+	} else {
+		containerEntry.readinessTimeout = defaultReadinessTimeout
+	}
 
 	// Stash network adapters away
-	for _, adapter := range settings.NetworkAdapters {
+	for _, adapter := range networkAdapters {
 		containerEntry.AddNetworkAdapter(adapter)
 	}
 	// Create the directory that will contain the resolv.conf file.
@@ -184,101 +565,327 @@ func (c *gcsCore) CreateContainer(id string, settings prot.VMHostedContainerSett
 	// supposed to be read-only layer in the overlay...  Ideally,
 	// dockerd would pass a runc config with a bind mount for
 	// /etc/resolv.conf like it does on unix.
-	if err := c.OS.MkdirAll(filepath.Join(baseFilesPath, "etc"), 0755); err != nil {
+	if err := c.mkdirAll(filepath.Join(baseFilesPath, "etc"), 0755); err != nil {
 		return errors.Wrapf(err, "failed to create resolv.conf directory")
 	}
 
+	if settings.BufferInitOutput || settings.ForwardSyslog {
+		c.initOutputs[id] = stdio.NewRingBuffer(int(settings.InitOutputBufferBytes))
+	} else {
+		delete(c.initOutputs, id)
+	}
+	if len(settings.Secrets) != 0 {
+		if err := c.setupSecrets(id, settings.Secrets, containerEntry); err != nil {
+			return errors.Wrapf(err, "failed to set up secrets for container %s", id)
+		}
+	}
+	if settings.ForwardSyslog {
+		forwarder, err := startSyslogForwarder(c.getSyslogSocketPath(id), c.initOutputs[id])
+		if err != nil {
+			if unmountErr := c.unmountSecrets(containerEntry); unmountErr != nil {
+				logrus.Warn(unmountErr)
+			}
+			return errors.Wrapf(err, "failed to set up syslog forwarding for container %s", id)
+		}
+		containerEntry.syslog = forwarder
+	}
+
 	c.containerCache[id] = containerEntry
 
 	return nil
 }
 
+// waitInitProcess waits for the init process of the container in
+// containerEntry to exit, then cleans up the container, closes the init
+// process's stdioSet and records the exit code in both containerEntry and
+// processEntry. Both entries must already have been added to their exitWgs.
+func (c *gcsCore) waitInitProcess(containerEntry *containerCacheEntry, processEntry *processCacheEntry, container runtime.Container, stdioSet *stdio.ConnectionSet) {
+	state, err := container.Wait()
+	c.containerCacheMutex.Lock()
+	if stopped := containerEntry.initStopped; stopped != nil {
+		containerEntry.initStopped = nil
+		// Until the init process is restarted, the container has nothing
+		// to exec or signal into.
+		containerEntry.container = nil
+		c.containerCacheMutex.Unlock()
+		c.finishStoppedInit(processEntry, container, stdioSet, state, err)
+		close(stopped)
+		return
+	}
+	if err != nil {
+		logrus.Error(err)
+		if err := c.cleanupContainer(containerEntry); err != nil {
+			logrus.Error(err)
+		}
+	}
+	exitCode := state.ExitCode()
+	exitSignal := state.Signal()
+	logrus.Infof("container init process %d exited with exit status %d, signal %d", container.Pid(), exitCode, exitSignal)
+
+	if err := c.cleanupContainer(containerEntry); err != nil {
+		logrus.Error(err)
+	}
+	containerEntry.exitCode = exitCode
+	containerEntry.exitSignal = exitSignal
+	containerEntry.initExited = true
+	c.containerCacheMutex.Unlock()
+
+	shutdownProcessStdio(container.Pid(), stdioSet)
+
+	// We are the only writer. Safe to do without a lock
+	processEntry.exitCode = exitCode
+	processEntry.exitWg.Done()
+
+	containerEntry.exitWg.Done()
+
+	c.containerCacheMutex.Lock()
+	// This is safe because the init process WaitContainer has already
+	// been initiated and thus removing from the map will not remove its
+	// reference to the actual cacheEntry
+	delete(c.containerCache, containerEntry.ID)
+	c.containerCacheMutex.Unlock()
+}
+
+// deleteUnstartedContainer deletes the runtime container of containerEntry,
+// which was created but whose init process will not be started, so that it
+// does not linger with its namespaces and network adapters.
+// This function expects containerCacheMutex to be locked on entry.
+func (c *gcsCore) deleteUnstartedContainer(containerEntry *containerCacheEntry) {
+	container := containerEntry.container
+	containerEntry.container = nil
+	// If we don't wait on a created container before deleting it, it will
+	// become unblocked, and delete will fail.
+	go container.Wait()
+	if err := container.Delete(); err != nil {
+		logrus.Errorf("failed to delete container %s after its init process failed to start: %s", containerEntry.ID, err)
+	}
+}
+
 // ExecProcess executes a new process in the container. It forwards the
-// process's stdio through the members of the core.StdioSet provided.
+// process's stdio through the members of the core.StdioSet provided. If the
+// process is the container's init process and the container was created with
+// a ReadinessFile, ExecProcess does not return until that file exists in the
+// container's root filesystem.
 func (c *gcsCore) ExecProcess(id string, params prot.ProcessParameters, stdioSet *stdio.ConnectionSet) (int, error) {
+	pid, gate, err := c.execProcess(id, params, stdioSet)
+	if err != nil {
+		return -1, err
+	}
+	if err := c.waitForInitReadiness(id, gate); err != nil {
+		return -1, err
+	}
+	return pid, nil
+}
+
+// waitForInitReadiness waits for the readiness file described by gate, if it
+// is not nil, after the container's init process has been started. The host
+// is told that the init process failed to start if the wait fails, so it is
+// killed rather than left running.
+// This function expects containerCacheMutex not to be held.
+func (c *gcsCore) waitForInitReadiness(id string, gate *readinessGate) error {
+	if gate == nil {
+		return nil
+	}
+	if err := c.waitForReadiness(id, gate); err != nil {
+		c.killInitProcess(id)
+		return err
+	}
+	return nil
+}
+
+// killInitProcess sends SIGKILL to the init process of the container with the
+// given ID, if it is running. waitInitProcess cleans up the container once it
+// has exited.
+func (c *gcsCore) killInitProcess(id string) {
+	c.containerCacheMutex.RLock()
+	containerEntry := c.getContainer(id)
+	if containerEntry == nil || containerEntry.container == nil || containerEntry.initExited {
+		c.containerCacheMutex.RUnlock()
+		return
+	}
+	container := containerEntry.container
+	c.containerCacheMutex.RUnlock()
+
+	if err := container.Kill(oslayer.SIGKILL); err != nil {
+		logrus.Errorf("failed to kill the init process of container %s: %s", id, err)
+	}
+}
+
+// execProcess executes a new process in the container. If the process is the
+// container's init process and the container has a readiness file, the
+// returned readinessGate describes the file to wait for. The wait must happen
+// without holding containerCacheMutex.
+func (c *gcsCore) execProcess(id string, params prot.ProcessParameters, stdioSet *stdio.ConnectionSet) (int, *readinessGate, error) {
 	c.containerCacheMutex.Lock()
 	defer c.containerCacheMutex.Unlock()
+	return c.execProcessLocked(id, params, stdioSet, false)
+}
 
+// execProcessLocked is execProcess with containerCacheMutex already locked. If
+// restart is set, the container's init process, which has exited to be
+// restarted, is started again with params. The config file written for its
+// original start is reused and the container's post-create hook is not run
+// again. If the restarted init process fails to start, the container is
+// cleaned up and reported as exited.
+// This function expects containerCacheMutex to be locked on entry.
+func (c *gcsCore) execProcessLocked(id string, params prot.ProcessParameters, stdioSet *stdio.ConnectionSet, restart bool) (int, *readinessGate, error) {
 	containerEntry := c.getContainer(id)
 	if containerEntry == nil {
-		return -1, errors.WithStack(gcserr.NewContainerDoesNotExistError(id))
+		return -1, nil, errors.WithStack(gcserr.NewContainerDoesNotExistError(id))
+	}
+	if params.PrivateMountNamespace {
+		if !containerEntry.hasRunInitProcess {
+			// The init process creates the container's namespaces, which
+			// are chosen by its OCI specification instead.
+			return -1, nil, gcserr.WrapHresult(errors.Errorf("PrivateMountNamespace is not supported for the init process of container %s", id), gcserr.HrInvalidArg)
+		}
+		if err := c.checkMountNamespaceSupport(); err != nil {
+			return -1, nil, err
+		}
+	}
+	killer, err := c.applyRelayFailurePolicy(params, stdioSet)
+	if err != nil {
+		return -1, nil, errors.Wrapf(err, "invalid stdio settings for a process in container %s", id)
 	}
 	processEntry := newProcessCacheEntry(id)
 
 	var p runtime.Process
-	if !containerEntry.hasRunInitProcess {
-		containerEntry.hasRunInitProcess = true
-		if err := c.writeConfigFile(id, params.OCISpecification); err != nil {
-			containerEntry.exitWg.Done()
-			return -1, err
+	var gate *readinessGate
+	if restart || !containerEntry.hasRunInitProcess {
+		// failed reports to waits on the container that its init process
+		// will not run.
+		failed := containerEntry.exitWg.Done
+		// A restart is not part of creating the container, so it is not
+		// timed.
+		timings := containerEntry.startTimings
+		if restart {
+			failed = func() { c.abandonRestartedContainer(containerEntry) }
+			timings = nil
+		} else {
+			config := containerEntry.initConfig(params)
+			if params.JoinContainerID != "" {
+				var err error
+				if config, err = c.joinContainerNamespaces(config, params.JoinContainerID); err != nil {
+					return -1, nil, err
+				}
+			}
+
+			if containerEntry.user != "" {
+				var err error
+				if config, err = c.withInitUser(id, config, containerEntry.user); err != nil {
+					return -1, nil, err
+				}
+			}
+
+			containerEntry.hasRunInitProcess = true
+			containerEntry.initParams = params
+			if err := c.writeConfigFile(id, runtimeConfig{Spec: config, timeOffset: containerEntry.timeOffset}); err != nil {
+				failed()
+				return -1, nil, err
+			}
+			containerEntry.cgroupPath = getCgroupPath(id, config)
 		}
 
+		if initOutput, ok := c.initOutputs[id]; ok && stdioSet != nil {
+			if stdioSet.Out == nil {
+				stdioSet.Out = initOutput
+			}
+			if stdioSet.Err == nil {
+				stdioSet.Err = initOutput
+			}
+		}
+
+		stopInitExec := timings.begin(phaseInitExec)
 		container, err := c.Rtime.CreateContainer(id, c.getContainerStoragePath(id), stdioSet)
+		stopInitExec()
 		if err != nil {
-			containerEntry.exitWg.Done()
-			return -1, err
+			failed()
+			return -1, nil, err
 		}
+		processEntry.createdTime = c.clock()
 
 		containerEntry.container = container
+		if err := c.applyCreateLimits(containerEntry); err != nil {
+			c.deleteUnstartedContainer(containerEntry)
+			failed()
+			return -1, nil, err
+		}
 		p = container
 		processEntry.exitWg.Add(1)
 		processEntry.Tty = p.Tty()
+		processEntry.Pipes = p.PipeRelay()
 
 		// Configure network adapters in the namespace.
-		for _, adapter := range containerEntry.NetworkAdapters {
-			if err := c.configureAdapterInNamespace(container, adapter); err != nil {
-				containerEntry.exitWg.Done()
-				return -1, err
-			}
+		stopNetwork := timings.begin(phaseNetwork)
+		err = c.configureNetworkAdapters(container, containerEntry.NetworkAdapters)
+		stopNetwork()
+		if err != nil {
+			c.deleteUnstartedContainer(containerEntry)
+			failed()
+			return -1, nil, err
 		}
 
-		go func() {
-			state, err := container.Wait()
-			c.containerCacheMutex.Lock()
-			if err != nil {
-				logrus.Error(err)
-				if err := c.cleanupContainer(containerEntry); err != nil {
-					logrus.Error(err)
-				}
-			}
-			exitCode := state.ExitCode()
-			logrus.Infof("container init process %d exited with exit status %d", p.Pid(), exitCode)
-
-			if err := c.cleanupContainer(containerEntry); err != nil {
-				logrus.Error(err)
+		// The hook has already set up the container for its original init
+		// process.
+		if !restart {
+			if err := c.runPostCreateHook(containerEntry); err != nil {
+				c.deleteUnstartedContainer(containerEntry)
+				failed()
+				return -1, nil, err
 			}
-			c.containerCacheMutex.Unlock()
-
-			// We are the only writer. Safe to do without a lock
-			processEntry.exitCode = exitCode
-			processEntry.exitWg.Done()
-
-			// We are the only writer. Safe to do without a lock
-			containerEntry.exitCode = exitCode
-			containerEntry.exitWg.Done()
+		}
 
-			c.containerCacheMutex.Lock()
-			// This is safe because the init process WaitContainer has already
-			// been initiated and thus removing from the map will not remove its
-			// reference to the actual cacheEntry
-			delete(c.containerCache, id)
-			c.containerCacheMutex.Unlock()
-		}()
+		go c.waitInitProcess(containerEntry, processEntry, container, stdioSet)
 
-		if err := container.Start(); err != nil {
-			return -1, err
+		stopInitExec = timings.begin(phaseInitExec)
+		err = container.Start()
+		stopInitExec()
+		if err != nil {
+			return -1, nil, err
+		}
+		timings.finish()
+		if containerEntry.readinessFile != "" {
+			_, _, _, rootfsPath := c.getUnioningPaths(id)
+			gate = &readinessGate{
+				path:    filepath.Join(rootfsPath, containerEntry.readinessFile),
+				timeout: containerEntry.readinessTimeout,
+			}
 		}
 	} else {
+		// The container's init process has been started, but may have failed
+		// to start or since exited, in which case there is nothing to exec
+		// into.
+		if containerEntry.container == nil || containerEntry.initExited {
+			return -1, nil, errors.Errorf("container %s is not running", id)
+		}
 		ociProcess, err := processParametersToOCI(params)
 		if err != nil {
-			return -1, err
+			return -1, nil, err
+		}
+		if err := validateProcessArgs(ociProcess.Args); err != nil {
+			return -1, nil, err
+		}
+		if containerEntry.maxConcurrentExec > 0 && containerEntry.runningExecs >= containerEntry.maxConcurrentExec {
+			return -1, nil, gcserr.WrapHresult(errors.Errorf("container %s already has %d executed processes running, the maximum allowed", id, containerEntry.runningExecs), gcserr.HrBusy)
+		}
+		if params.PrivateMountNamespace {
+			// runc can only exec a process into the container's existing
+			// namespaces, so the process moves itself into a new one.
+			ociProcess.Args = append(append([]string{}, privateMountNamespacePrefix...), ociProcess.Args...)
+		}
+		if params.JoinContainerID != "" {
+			pid, err := c.execJoinedProcess(containerEntry, ociProcess, params.JoinContainerID, stdioSet, killer)
+			return pid, nil, err
 		}
 		p, err = containerEntry.container.ExecProcess(ociProcess, stdioSet)
 		if err != nil {
-			return -1, err
+			return -1, nil, err
 		}
+		processEntry.createdTime = c.clock()
+		containerEntry.runningExecs++
 		processEntry.exitWg.Add(1)
 		processEntry.Tty = p.Tty()
+		processEntry.Pipes = p.PipeRelay()
 
 		go func() {
 			state, err := p.Wait()
@@ -288,6 +895,10 @@ func (c *gcsCore) ExecProcess(id string, params prot.ProcessParameters, stdioSet
 			exitCode := state.ExitCode()
 			logrus.Infof("container process %d exited with exit status %d", p.Pid(), exitCode)
 
+			shutdownProcessStdio(p.Pid(), stdioSet)
+			c.containerCacheMutex.Lock()
+			containerEntry.runningExecs--
+			c.containerCacheMutex.Unlock()
 			processEntry.exitCode = exitCode
 			processEntry.exitWg.Done()
 
@@ -312,7 +923,32 @@ func (c *gcsCore) ExecProcess(id string, params prot.ProcessParameters, stdioSet
 	// applies to external processes as well.
 	c.processCache[p.Pid()] = processEntry
 	c.processCacheMutex.Unlock()
-	return p.Pid(), nil
+	killer.setPid(p.Pid())
+	return p.Pid(), gate, nil
+}
+
+// execJoinedProcess executes process for the container of containerEntry in
+// the namespaces of the container with ID joinID. runc can only exec a
+// process into the namespaces of the container itself, so the process is
+// started from the utility VM under nsenter instead.
+// This function expects containerCacheMutex to be locked on entry.
+func (c *gcsCore) execJoinedProcess(containerEntry *containerCacheEntry, process oci.Process, joinID string, stdioSet *stdio.ConnectionSet, killer *relayFailureKiller) (int, error) {
+	args, err := c.joinContainerNamespacesArgs(process, joinID, containerEntry.container.Pid())
+	if err != nil {
+		return -1, err
+	}
+	cmd := c.OS.Command(args[0], args[1:]...)
+	kind := fmt.Sprintf("process in container %s", containerEntry.ID)
+	pid, err := c.startUtilityVMProcess(containerEntry.ID, cmd, process, stdioSet, killer, kind, func() {
+		c.containerCacheMutex.Lock()
+		containerEntry.runningExecs--
+		c.containerCacheMutex.Unlock()
+	})
+	if err != nil {
+		return -1, err
+	}
+	containerEntry.runningExecs++
+	return pid, nil
 }
 
 // SignalContainer sends the specified signal to the container's init process.
@@ -334,6 +970,92 @@ func (c *gcsCore) SignalContainer(id string, signal oslayer.Signal) error {
 	return nil
 }
 
+// SignalContainerProcesses sends the specified signal to every process in the
+// container's cgroup, so that processes the init process does not pass signals
+// on to are reached too. The container is frozen while its processes are
+// listed and signaled, so that none can fork a new process which is missed.
+func (c *gcsCore) SignalContainerProcesses(id string, signal oslayer.Signal) error {
+	c.containerCacheMutex.Lock()
+	defer c.containerCacheMutex.Unlock()
+
+	containerEntry := c.getContainer(id)
+	if containerEntry == nil {
+		return errors.WithStack(gcserr.NewContainerDoesNotExistError(id))
+	}
+	if containerEntry.container == nil || containerEntry.initExited {
+		return errors.Errorf("container %s is not running", id)
+	}
+
+	if err := containerEntry.container.Pause(); err != nil {
+		return errors.Wrapf(err, "failed to freeze container %s", id)
+	}
+	defer func() {
+		if err := containerEntry.container.Resume(); err != nil {
+			logrus.Errorf("failed to thaw container %s: %s", id, err)
+		}
+	}()
+	pids, err := oslayer.CgroupProcesses(c.OS, containerEntry.cgroupPath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to list the processes of container %s", id)
+	}
+	for _, pid := range pids {
+		// A process which has already exited is not an error.
+		if err := c.OS.Kill(pid, syscall.Signal(signal)); err != nil && errors.Cause(err) != syscall.ESRCH {
+			return errors.Wrapf(err, "failed to signal process %d in container %s", pid, id)
+		}
+	}
+	return nil
+}
+
+// ShutdownContainer sends signal, normally SIGTERM, to the container's init
+// process. If gracePeriod is nonzero and the init process has not exited once
+// it elapses, SIGKILL is sent. ShutdownContainer returns once signal has been
+// sent.
+func (c *gcsCore) ShutdownContainer(id string, signal oslayer.Signal, gracePeriod time.Duration) error {
+	if err := c.SignalContainer(id, signal); err != nil {
+		return err
+	}
+	if gracePeriod <= 0 {
+		return nil
+	}
+
+	c.containerCacheMutex.Lock()
+	containerEntry := c.getContainer(id)
+	c.containerCacheMutex.Unlock()
+	if containerEntry == nil {
+		return nil
+	}
+	go c.escalateShutdown(containerEntry, signal, gracePeriod)
+	return nil
+}
+
+// escalateShutdown sends SIGKILL to the init process of the container in
+// containerEntry if it has not exited within gracePeriod of being sent signal.
+func (c *gcsCore) escalateShutdown(containerEntry *containerCacheEntry, signal oslayer.Signal, gracePeriod time.Duration) {
+	exited := make(chan struct{})
+	go func() {
+		containerEntry.exitWg.Wait()
+		close(exited)
+	}()
+
+	select {
+	case <-exited:
+		return
+	case <-time.After(gracePeriod):
+	}
+
+	logrus.Warnf("container %s did not exit within %s of signal %d, sending SIGKILL", containerEntry.ID, gracePeriod, signal)
+	c.containerCacheMutex.Lock()
+	container := containerEntry.container
+	c.containerCacheMutex.Unlock()
+	if container == nil {
+		return
+	}
+	if err := container.Kill(oslayer.SIGKILL); err != nil {
+		logrus.Errorf("failed to send SIGKILL to container %s: %s", containerEntry.ID, err)
+	}
+}
+
 // SignalProcess sends the signal specified in options to the given process.
 func (c *gcsCore) SignalProcess(pid int, options prot.SignalProcessOptions) error {
 	c.processCacheMutex.Lock()
@@ -360,7 +1082,8 @@ func (c *gcsCore) SignalProcess(pid int, options prot.SignalProcessOptions) erro
 	return nil
 }
 
-// ListProcesses returns all container processes, even zombies.
+// ListProcesses returns all container processes, even zombies, with the
+// number of file descriptors each has open.
 func (c *gcsCore) ListProcesses(id string) ([]runtime.ContainerProcessState, error) {
 	c.containerCacheMutex.Lock()
 	defer c.containerCacheMutex.Unlock()
@@ -378,9 +1101,47 @@ func (c *gcsCore) ListProcesses(id string) ([]runtime.ContainerProcessState, err
 	if err != nil {
 		return nil, err
 	}
+	for i := range processes {
+		processes[i].OpenFileDescriptors = c.countOpenFileDescriptors(processes[i].Pid)
+	}
+
+	c.processCacheMutex.RLock()
+	defer c.processCacheMutex.RUnlock()
+	for i := range processes {
+		processEntry, ok := c.processCache[processes[i].Pid]
+		if !ok {
+			continue
+		}
+		var counts stdio.RelayCounts
+		switch {
+		case processEntry.Pipes != nil:
+			counts = processEntry.Pipes.BytesRelayed()
+		case processEntry.Tty != nil:
+			counts = processEntry.Tty.BytesRelayed()
+		default:
+			continue
+		}
+		processes[i].StdioBytes = &counts
+	}
 	return processes, nil
 }
 
+// countOpenFileDescriptors returns the number of file descriptors the process
+// with the given pid has open, or nil if they cannot be counted. A process
+// which has exited has no fd directory, so this is not treated as an error.
+func (c *gcsCore) countOpenFileDescriptors(pid int) *int {
+	fdPath := filepath.Join("/proc", strconv.Itoa(pid), "fd")
+	fds, err := c.OS.ReadDir(fdPath)
+	if err != nil {
+		if !os.IsNotExist(errors.Cause(err)) {
+			logrus.Warnf("failed to count open file descriptors of process %d: %s", pid, err)
+		}
+		return nil
+	}
+	count := len(fds)
+	return &count
+}
+
 // RunExternalProcess runs a process in the utility VM outside of a container's
 // namespace.
 // This can be used for things like debugging or diagnosing the utility VM's
@@ -388,14 +1149,38 @@ func (c *gcsCore) ListProcesses(id string) ([]runtime.ContainerProcessState, err
 func (c *gcsCore) RunExternalProcess(params prot.ProcessParameters, stdioSet *stdio.ConnectionSet) (pid int, err error) {
 	ociProcess, err := processParametersToOCI(params)
 	if err != nil {
-		return -1, err
+		return -1, err
+	}
+	if err := validateProcessArgs(ociProcess.Args); err != nil {
+		return -1, err
+	}
+	cmd := c.OS.Command(ociProcess.Args[0], ociProcess.Args[1:]...)
+	cmd.SetDir(ociProcess.Cwd)
+	if params.PrivateMountNamespace {
+		if err := c.checkMountNamespaceSupport(); err != nil {
+			return -1, err
+		}
+		cmd.SetUnshareflags(syscall.CLONE_NEWNS)
+	}
+
+	killer, err := c.applyRelayFailurePolicy(params, stdioSet)
+	if err != nil {
+		return -1, errors.Wrap(err, "invalid stdio settings for external process")
 	}
-	cmd := c.OS.Command(ociProcess.Args[0], ociProcess.Args[1:]...)
-	cmd.SetDir(ociProcess.Cwd)
-	cmd.SetEnv(ociProcess.Env)
+	return c.startUtilityVMProcess("", cmd, ociProcess, stdioSet, killer, "external process", nil)
+}
+
+// startUtilityVMProcess starts cmd in the utility VM with the environment and
+// console of process, forwarding its stdio through stdioSet, and adds it to
+// the process cache as a process of the container with the given ID, which
+// is empty for external processes. kind describes the process in errors and
+// logs. If onExit is not nil, it is called once the process has exited,
+// before its exit code is made available.
+func (c *gcsCore) startUtilityVMProcess(containerID string, cmd oslayer.Cmd, process oci.Process, stdioSet *stdio.ConnectionSet, killer *relayFailureKiller, kind string, onExit func()) (pid int, err error) {
+	cmd.SetEnv(process.Env)
 
 	var relay *stdio.TtyRelay
-	if params.EmulateConsole {
+	if process.Terminal {
 		// Allocate a console for the process.
 		var (
 			master      *os.File
@@ -403,7 +1188,7 @@ func (c *gcsCore) RunExternalProcess(params prot.ProcessParameters, stdioSet *st
 		)
 		master, consolePath, err = stdio.NewConsole()
 		if err != nil {
-			return -1, errors.Wrap(err, "failed to create console for external process")
+			return -1, errors.Wrapf(err, "failed to create console for %s", kind)
 		}
 		defer func() {
 			if err != nil {
@@ -413,7 +1198,7 @@ func (c *gcsCore) RunExternalProcess(params prot.ProcessParameters, stdioSet *st
 
 		console, err := c.OS.OpenFile(consolePath, os.O_RDWR, 0777)
 		if err != nil {
-			return -1, errors.Wrap(err, "failed to open console file for external process")
+			return -1, errors.Wrapf(err, "failed to open console file for %s", kind)
 		}
 		defer console.Close()
 
@@ -428,19 +1213,31 @@ func (c *gcsCore) RunExternalProcess(params prot.ProcessParameters, stdioSet *st
 		}
 		defer fileSet.Close()
 		defer stdioSet.Close()
-		cmd.SetStdin(fileSet.In)
-		cmd.SetStdout(fileSet.Out)
-		cmd.SetStderr(fileSet.Err)
+		// Streams which were not requested are left unset, so that they are
+		// connected to /dev/null. Setting a nil *os.File would instead make
+		// the command use an invalid file descriptor.
+		if fileSet.In != nil {
+			cmd.SetStdin(fileSet.In)
+		}
+		if fileSet.Out != nil {
+			cmd.SetStdout(fileSet.Out)
+		}
+		if fileSet.Err != nil {
+			cmd.SetStderr(fileSet.Err)
+		}
 	}
 	if err := cmd.Start(); err != nil {
-		return -1, errors.Wrap(err, "failed call to Start for external process")
+		return -1, errors.Wrapf(err, "failed call to Start for %s", kind)
 	}
+	createdTime := c.clock()
 
+	killer.setPid(cmd.Process().Pid())
 	if relay != nil {
 		relay.Start()
 	}
 
-	processEntry := newProcessCacheEntry("")
+	processEntry := newProcessCacheEntry(containerID)
+	processEntry.createdTime = createdTime
 	processEntry.exitWg.Add(1)
 	processEntry.Tty = relay
 	go func() {
@@ -450,13 +1247,17 @@ func (c *gcsCore) RunExternalProcess(params prot.ProcessParameters, stdioSet *st
 			// error 127), Wait also returns an error. We should find a way to
 			// distinguish between these errors and ones which are actually
 			// important.
-			logrus.Error(errors.Wrap(err, "failed call to Wait for external process"))
+			logrus.Error(errors.Wrapf(err, "failed call to Wait for %s", kind))
 		}
 		exitCode := cmd.ExitState().ExitCode()
-		logrus.Infof("external process %d exited with exit status %d", cmd.Process().Pid(), exitCode)
+		logrus.Infof("%s %d exited with exit status %d", kind, cmd.Process().Pid(), exitCode)
 
 		if relay != nil {
 			relay.Wait()
+			shutdownProcessStdio(cmd.Process().Pid(), stdioSet)
+		}
+		if onExit != nil {
+			onExit()
 		}
 
 		// We are the only writer safe to do without a lock.
@@ -471,10 +1272,23 @@ func (c *gcsCore) RunExternalProcess(params prot.ProcessParameters, stdioSet *st
 	return pid, nil
 }
 
+// shutdownProcessStdio shuts down the stdio connections of the exited process
+// pid, so that the host sees EOF on them without waiting for them to be
+// garbage collected. Connections already closed by the process's relay are
+// skipped.
+func shutdownProcessStdio(pid int, stdioSet *stdio.ConnectionSet) {
+	if stdioSet == nil {
+		return
+	}
+	if err := stdioSet.Shutdown(); err != nil {
+		logrus.Errorf("failed to close stdio connections of process %d: %s", pid, err)
+	}
+}
+
 // ModifySettings takes the given request and performs the modification it
 // specifies. At the moment, this function only supports the request types Add
 // and Remove, both for the resource type MappedVirtualDisk.
-func (c *gcsCore) ModifySettings(id string, request prot.ResourceModificationRequestResponse) error {
+func (c *gcsCore) ModifySettings(ctx context.Context, id string, request prot.ResourceModificationRequestResponse) error {
 	c.containerCacheMutex.Lock()
 	defer c.containerCacheMutex.Unlock()
 
@@ -491,7 +1305,7 @@ func (c *gcsCore) ModifySettings(id string, request prot.ResourceModificationReq
 		}
 		switch request.RequestType {
 		case prot.RtAdd:
-			if err := c.setupMappedVirtualDisks(id, []prot.MappedVirtualDisk{*mvd}, containerEntry); err != nil {
+			if err := c.setupMappedVirtualDisks(ctx, id, []prot.MappedVirtualDisk{*mvd}, containerEntry); err != nil {
 				return errors.Wrapf(err, "failed to hot add mapped virtual disk for container %s", id)
 			}
 		case prot.RtRemove:
@@ -518,6 +1332,96 @@ func (c *gcsCore) ModifySettings(id string, request prot.ResourceModificationReq
 		default:
 			return errors.Errorf("the request type \"%s\" is not supported for resource type \"%s\"", request.RequestType, request.ResourceType)
 		}
+	case prot.PtMemory:
+		ml, ok := request.Settings.(*prot.MemoryLimit)
+		if !ok {
+			return errors.New("the request's settings are not of type MemoryLimit")
+		}
+		if request.RequestType != prot.RtUpdate {
+			return errors.Errorf("the request type \"%s\" is not supported for resource type \"%s\"", request.RequestType, request.ResourceType)
+		}
+		if ml.ForceEmpty && !ml.Reclaim {
+			return gcserr.WrapHresult(errors.New("ForceEmpty can only be given with Reclaim"), gcserr.HrInvalidArg)
+		}
+		if ml.Reclaim {
+			if err := c.ReclaimMemory(containerEntry, ml.ForceEmpty); err != nil {
+				return err
+			}
+		} else if err := c.UpdateMemoryLimit(containerEntry, ml.LimitInBytes); err != nil {
+			return err
+		}
+	case prot.PtCPULimit:
+		cl, ok := request.Settings.(*prot.CPULimit)
+		if !ok {
+			return errors.New("the request's settings are not of type CPULimit")
+		}
+		if request.RequestType != prot.RtUpdate {
+			return errors.Errorf("the request type \"%s\" is not supported for resource type \"%s\"", request.RequestType, request.ResourceType)
+		}
+		if err := c.UpdateCPULimit(containerEntry, cl.Quota, cl.Period); err != nil {
+			return err
+		}
+	case prot.PtPids:
+		pl, ok := request.Settings.(*prot.PidsLimit)
+		if !ok {
+			return errors.New("the request's settings are not of type PidsLimit")
+		}
+		if request.RequestType != prot.RtUpdate {
+			return errors.Errorf("the request type \"%s\" is not supported for resource type \"%s\"", request.RequestType, request.ResourceType)
+		}
+		if pl.Limit <= 0 {
+			return gcserr.WrapHresult(errors.Errorf("the process limit %d for container %s is not positive", pl.Limit, id), gcserr.HrInvalidArg)
+		}
+		if err := c.UpdatePidsLimit(containerEntry, pl.Limit); err != nil {
+			return err
+		}
+	case prot.PtDNS:
+		dns, ok := request.Settings.(*prot.DNSSettings)
+		if !ok {
+			return errors.New("the request's settings are not of type DNSSettings")
+		}
+		var updated prot.DNSSettings
+		switch request.RequestType {
+		case prot.RtAdd:
+			updated = addDNSSettings(containerEntry.dns, *dns)
+		case prot.RtRemove:
+			updated = removeDNSSettings(containerEntry.dns, *dns)
+		case prot.RtUpdate:
+			updated = *dns
+		default:
+			return errors.Errorf("the request type \"%s\" is not supported for resource type \"%s\"", request.RequestType, request.ResourceType)
+		}
+		if err := c.updateResolvConf(containerEntry, updated); err != nil {
+			return err
+		}
+	case prot.PtTimeOffset:
+		to, ok := request.Settings.(*prot.TimeOffset)
+		if !ok {
+			return errors.New("the request's settings are not of type TimeOffset")
+		}
+		if request.RequestType != prot.RtUpdate {
+			return errors.Errorf("the request type \"%s\" is not supported for resource type \"%s\"", request.RequestType, request.ResourceType)
+		}
+		if err := c.setTimeOffset(containerEntry, *to); err != nil {
+			return err
+		}
+	case prot.PtContainerMetadata:
+		cm, ok := request.Settings.(*prot.ContainerMetadata)
+		if !ok {
+			return errors.New("the request's settings are not of type ContainerMetadata")
+		}
+		switch request.RequestType {
+		case prot.RtAdd:
+			for key, value := range *cm {
+				containerEntry.metadata[key] = value
+			}
+		case prot.RtRemove:
+			for key := range *cm {
+				delete(containerEntry.metadata, key)
+			}
+		default:
+			return errors.Errorf("the request type \"%s\" is not supported for resource type \"%s\"", request.RequestType, request.ResourceType)
+		}
 	default:
 		return errors.Errorf("the resource type \"%s\" is not supported", request.ResourceType)
 	}
@@ -542,18 +1446,101 @@ func (c *gcsCore) ResizeConsole(pid int, height, width uint16) error {
 	return p.Tty.ResizeConsole(height, width)
 }
 
-// WaitContainer waits for a container to complete and returns its exit code.
-func (c *gcsCore) WaitContainer(id string) (int, error) {
+// AttachProcess attaches the output of the process with the given pid in the
+// container with the given ID to the connections in stdioSet, replacing the
+// connections it was previously relayed to. Only the output of processes
+// whose stdio is relayed through pipes can be reattached.
+func (c *gcsCore) AttachProcess(id string, pid int, stdioSet *stdio.ConnectionSet) error {
+	c.processCacheMutex.Lock()
+	p, ok := c.processCache[pid]
+	c.processCacheMutex.Unlock()
+	if !ok || p.ContainerID != id {
+		return errors.WithStack(gcserr.NewProcessDoesNotExistError(pid))
+	}
+	if p.Pipes == nil {
+		return gcserr.WrapHresult(errors.Errorf("process %d in container %s has no retained stdio pipes to attach to", pid, id), gcserr.HrInvalidArg)
+	}
+	if err := p.Pipes.Attach(stdioSet); err != nil {
+		return errors.Wrapf(err, "failed to attach to process %d in container %s", pid, id)
+	}
+	return nil
+}
+
+// WriteProcessStdin writes data to the stdin of the process with the given pid
+// in the container with the given ID, alongside any stdin relayed from the
+// host. It returns the number of bytes written.
+func (c *gcsCore) WriteProcessStdin(id string, pid int, data []byte) (int, error) {
+	c.processCacheMutex.Lock()
+	p, ok := c.processCache[pid]
+	c.processCacheMutex.Unlock()
+	if !ok || p.ContainerID != id {
+		return 0, errors.WithStack(gcserr.NewProcessDoesNotExistError(pid))
+	}
+
+	var (
+		n   int
+		err error
+	)
+	switch {
+	case p.Pipes != nil:
+		n, err = p.Pipes.WriteStdin(data)
+	case p.Tty != nil:
+		n, err = p.Tty.WriteStdin(data)
+	default:
+		err = errors.WithStack(stdio.ErrNoStdin)
+	}
+	if errors.Cause(err) == stdio.ErrNoStdin {
+		return 0, gcserr.WrapHresult(errors.Wrapf(err, "process %d in container %s has no stdin pipe", pid, id), gcserr.HrInvalidArg)
+	}
+	if err != nil {
+		return n, errors.Wrapf(err, "failed to write to stdin of process %d in container %s", pid, id)
+	}
+	return n, nil
+}
+
+// WaitContainer waits for a container to complete and returns the exit code
+// and terminating signal of its init process. If the container is deleted
+// before its init process is started, WaitContainer returns an error whose
+// cause is context.Canceled.
+func (c *gcsCore) WaitContainer(id string) (prot.ContainerExitStatus, error) {
 	c.containerCacheMutex.Lock()
 	entry := c.getContainer(id)
 	if entry == nil {
 		c.containerCacheMutex.Unlock()
-		return -1, errors.WithStack(gcserr.NewContainerDoesNotExistError(id))
+		return prot.ContainerExitStatus{ExitCode: -1}, errors.WithStack(gcserr.NewContainerDoesNotExistError(id))
 	}
 	c.containerCacheMutex.Unlock()
 
 	entry.exitWg.Wait()
-	return entry.exitCode, nil
+	if err := entry.ctx.Err(); err != nil {
+		return prot.ContainerExitStatus{ExitCode: -1}, errors.Wrapf(err, "container %s was deleted", id)
+	}
+	return prot.ContainerExitStatus{ExitCode: entry.exitCode, Signal: entry.exitSignal}, nil
+}
+
+// DeleteContainer removes a container whose init process has not been
+// started, and cleans up its storage. Containers whose init process has been
+// started are removed once it exits, and cannot be deleted.
+func (c *gcsCore) DeleteContainer(id string) error {
+	c.containerCacheMutex.Lock()
+	defer c.containerCacheMutex.Unlock()
+
+	entry := c.getContainer(id)
+	if entry == nil {
+		return errors.WithStack(gcserr.NewContainerDoesNotExistError(id))
+	}
+	if entry.hasRunInitProcess {
+		return errors.Errorf("container %s has been started and cannot be deleted", id)
+	}
+	// Cancel before releasing the waiters, so that they see the deletion.
+	entry.cancel()
+	entry.hasRunInitProcess = true
+	entry.exitWg.Done()
+	delete(c.containerCache, id)
+	if err := c.cleanupContainer(entry); err != nil {
+		return errors.Wrapf(err, "failed to clean up container %s", id)
+	}
+	return nil
 }
 
 // WaitProcess waits for a process to complete and returns its exit code.
@@ -570,16 +1557,392 @@ func (c *gcsCore) WaitProcess(pid int) (int, error) {
 	return entry.exitCode, nil
 }
 
+// GetProcessCreatedTime returns when the process with the given pid was
+// created.
+func (c *gcsCore) GetProcessCreatedTime(pid int) (time.Time, error) {
+	c.processCacheMutex.Lock()
+	defer c.processCacheMutex.Unlock()
+
+	entry, ok := c.processCache[pid]
+	if !ok {
+		return time.Time{}, errors.WithStack(gcserr.NewProcessDoesNotExistError(pid))
+	}
+	return entry.createdTime, nil
+}
+
+// GetScratchDiskUsage returns the space used on the filesystem backing the
+// container's overlay upperdir. The free space reported excludes blocks
+// reserved for root, since the container's processes cannot rely on them.
+func (c *gcsCore) GetScratchDiskUsage(id string) (prot.ScratchDiskUsage, error) {
+	c.containerCacheMutex.Lock()
+	entry := c.getContainer(id)
+	if entry == nil {
+		c.containerCacheMutex.Unlock()
+		return prot.ScratchDiskUsage{}, errors.WithStack(gcserr.NewContainerDoesNotExistError(id))
+	}
+	upperDirPath := entry.upperDirPath
+	c.containerCacheMutex.Unlock()
+
+	var stat syscall.Statfs_t
+	if err := c.OS.Statfs(upperDirPath, &stat); err != nil {
+		return prot.ScratchDiskUsage{}, errors.Wrapf(err, "failed to stat scratch filesystem for container %s", id)
+	}
+	blockSize := uint64(stat.Bsize)
+	return prot.ScratchDiskUsage{
+		UsedBytes:  (stat.Blocks - stat.Bfree) * blockSize,
+		FreeBytes:  stat.Bavail * blockSize,
+		TotalBytes: stat.Blocks * blockSize,
+	}, nil
+}
+
+// SyncContainer flushes the writes to the container's filesystem to disk. If
+// freeze is true and the container is running, its processes are frozen for
+// the duration of the sync. If timeout is nonzero and the sync has not
+// completed within it, an error is returned. In that case the sync carries on
+// in the background and its result is only logged, and the container is
+// thawed straight away, so the flushed filesystem is no longer guaranteed to
+// be consistent.
+func (c *gcsCore) SyncContainer(id string, freeze bool, timeout time.Duration) error {
+	c.containerCacheMutex.Lock()
+	entry := c.getContainer(id)
+	if entry == nil {
+		c.containerCacheMutex.Unlock()
+		return errors.WithStack(gcserr.NewContainerDoesNotExistError(id))
+	}
+	container := entry.container
+	upperDirPath := entry.upperDirPath
+	scratchDevicePath := entry.scratchDevicePath
+	c.containerCacheMutex.Unlock()
+
+	if freeze && container != nil {
+		if err := container.Pause(); err != nil {
+			return errors.Wrapf(err, "failed to freeze container %s", id)
+		}
+		defer func() {
+			if err := container.Resume(); err != nil {
+				logrus.Errorf("failed to thaw container %s after sync: %s", id, err)
+			}
+		}()
+	}
+
+	syncErr := make(chan error, 1)
+	go func() {
+		if err := c.OS.Syncfs(upperDirPath); err != nil {
+			syncErr <- errors.Wrapf(err, "failed to sync upper directory %s", upperDirPath)
+			return
+		}
+		if scratchDevicePath != "" {
+			if err := c.OS.Fsync(scratchDevicePath); err != nil {
+				syncErr <- errors.Wrapf(err, "failed to sync scratch device %s", scratchDevicePath)
+				return
+			}
+		}
+		syncErr <- nil
+	}()
+
+	var timeoutChan <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutChan = timer.C
+	}
+	select {
+	case err := <-syncErr:
+		return err
+	case <-timeoutChan:
+		go func() {
+			if err := <-syncErr; err != nil {
+				logrus.Errorf("background sync of container %s failed after timing out: %s", id, err)
+			} else {
+				logrus.Infof("background sync of container %s completed after timing out", id)
+			}
+		}()
+		return errors.Errorf("timed out after %s waiting for container %s to sync", timeout, id)
+	}
+}
+
+// GetInitOutput returns the buffered output of the init process of the
+// container with the given ID. The container must have been created with
+// BufferInitOutput set. The output remains available after the container has
+// exited, until it has been retrieved once. If older output has been
+// discarded, the output is preceded by stdio.TruncatedOutputMarker.
+func (c *gcsCore) GetInitOutput(id string) ([]byte, error) {
+	c.containerCacheMutex.Lock()
+	defer c.containerCacheMutex.Unlock()
+
+	initOutput, ok := c.initOutputs[id]
+	if !ok {
+		if c.getContainer(id) == nil {
+			return nil, errors.WithStack(gcserr.NewContainerDoesNotExistError(id))
+		}
+		return nil, errors.Errorf("container %s was not created with init process output buffering", id)
+	}
+	if c.getContainer(id) == nil {
+		delete(c.initOutputs, id)
+	}
+	if initOutput.Truncated() {
+		return append([]byte(stdio.TruncatedOutputMarker), initOutput.Bytes()...), nil
+	}
+	return initOutput.Bytes(), nil
+}
+
+// UpdateMemoryLimit sets the memory limit of the given running container.
+// This function expects containerCacheMutex to be locked on entry.
+func (c *gcsCore) UpdateMemoryLimit(containerEntry *containerCacheEntry, limit int64) error {
+	if containerEntry.cgroupPath == "" {
+		return errors.Errorf("container %s has not been started and has no cgroup", containerEntry.ID)
+	}
+	if err := oslayer.UpdateMemoryLimit(c.OS, containerEntry.cgroupPath, limit); err != nil {
+		return errors.Wrapf(err, "failed to update memory limit for container %s", containerEntry.ID)
+	}
+	return nil
+}
+
+// ReclaimMemory drops the utility VM's caches and, if forceEmpty is set,
+// reclaims what it can from the given running container's memory cgroup. It
+// returns an HrAccessDenied error if the GCS is not permitted to do so.
+// This function expects containerCacheMutex to be locked on entry.
+func (c *gcsCore) ReclaimMemory(containerEntry *containerCacheEntry, forceEmpty bool) error {
+	if forceEmpty && containerEntry.cgroupPath == "" {
+		return errors.Errorf("container %s has not been started and has no cgroup", containerEntry.ID)
+	}
+	if err := oslayer.DropCaches(c.OS); err != nil {
+		return errors.Wrap(reclaimError(err), "failed to drop caches")
+	}
+	if forceEmpty {
+		if err := oslayer.ForceEmptyMemory(c.OS, containerEntry.cgroupPath); err != nil {
+			return errors.Wrapf(reclaimError(err), "failed to reclaim memory for container %s", containerEntry.ID)
+		}
+	}
+	return nil
+}
+
+// reclaimError attaches an HRESULT to err, returned while reclaiming memory,
+// if its cause is one the host can act on.
+func reclaimError(err error) error {
+	switch cause := errors.Cause(err); {
+	case cause == oslayer.ErrCgroupV1Only:
+		return gcserr.WrapHresult(err, gcserr.HrNotImpl)
+	case os.IsPermission(cause):
+		return gcserr.WrapHresult(err, gcserr.HrAccessDenied)
+	}
+	return err
+}
+
+// UpdateCPULimit sets the CPU bandwidth of the given running container.
+// This function expects containerCacheMutex to be locked on entry.
+func (c *gcsCore) UpdateCPULimit(containerEntry *containerCacheEntry, quota int64, period uint64) error {
+	if containerEntry.cgroupPath == "" {
+		return errors.Errorf("container %s has not been started and has no cgroup", containerEntry.ID)
+	}
+	if err := oslayer.UpdateCPULimit(c.OS, containerEntry.cgroupPath, quota, period); err != nil {
+		return errors.Wrapf(err, "failed to update CPU limit for container %s", containerEntry.ID)
+	}
+	return nil
+}
+
+// UpdatePidsLimit sets the maximum number of processes in the given running
+// container.
+// This function expects containerCacheMutex to be locked on entry.
+func (c *gcsCore) UpdatePidsLimit(containerEntry *containerCacheEntry, limit int64) error {
+	if containerEntry.cgroupPath == "" {
+		return errors.Errorf("container %s has not been started and has no cgroup", containerEntry.ID)
+	}
+	if err := oslayer.UpdatePidsLimit(c.OS, containerEntry.cgroupPath, limit); err != nil {
+		return errors.Wrapf(err, "failed to update process limit for container %s", containerEntry.ID)
+	}
+	return nil
+}
+
+// applyCreateLimits applies the process and block IO limits given when the
+// container was created, if any, to its cgroup.
+// This function expects containerCacheMutex to be locked on entry.
+func (c *gcsCore) applyCreateLimits(containerEntry *containerCacheEntry) error {
+	if containerEntry.pidsLimit > 0 {
+		if err := c.UpdatePidsLimit(containerEntry, containerEntry.pidsLimit); err != nil {
+			return err
+		}
+	}
+	if containerEntry.blkioWeight != 0 {
+		if err := oslayer.UpdateBlkioWeight(c.OS, containerEntry.cgroupPath, containerEntry.blkioWeight); err != nil {
+			return errors.Wrapf(err, "failed to set block IO weight for container %s", containerEntry.ID)
+		}
+	}
+	for _, limit := range containerEntry.blkioDeviceLimits {
+		if err := oslayer.UpdateBlkioDeviceLimit(c.OS, containerEntry.cgroupPath, limit.Major, limit.Minor, limit.ReadBps, limit.WriteBps); err != nil {
+			return errors.Wrapf(err, "failed to set block IO limit for device %d:%d for container %s", limit.Major, limit.Minor, containerEntry.ID)
+		}
+	}
+	return nil
+}
+
+// parseOCISpec parses specJSON as an OCI runtime specification. It returns an
+// HrInvalidArg error if specJSON is not valid JSON or doesn't specify an OCI
+// version.
+func parseOCISpec(specJSON string) (*oci.Spec, error) {
+	var spec oci.Spec
+	if err := json.Unmarshal([]byte(specJSON), &spec); err != nil {
+		return nil, gcserr.WrapHresult(errors.Wrap(err, "failed to parse OCI specification"), gcserr.HrInvalidArg)
+	}
+	if spec.Version == "" {
+		return nil, gcserr.WrapHresult(errors.New("the OCI specification does not specify an ociVersion"), gcserr.HrInvalidArg)
+	}
+	return &spec, nil
+}
+
+// initConfig returns the configuration to start the container's init process
+// with. This is the OCI specification given at create if there was one, and
+// otherwise the one in params with the container's mount settings applied. In
+// either case the container's hostname, root filesystem settings, syslog
+// socket, init shim, secrets, device cgroup rules and the initial console size
+// in params are applied.
+func (e *containerCacheEntry) initConfig(params prot.ProcessParameters) oci.Spec {
+	var config oci.Spec
+	if e.ociSpec != nil {
+		config = *e.ociSpec
+	} else {
+		config = e.mountSettings.apply(params.OCISpecification)
+	}
+	config = withHostname(config, e.hostname)
+	config = withRootfsSettings(config, e.rootReadonly, e.rootfsPropagation)
+	config = withSyslogMount(config, e.syslogSocketPath())
+	config = withInitShim(config, e.initShimPath())
+	config = withSecretMounts(config, e.secretMounts)
+	config = withDeviceCgroupRules(config, e.devices)
+	config = withTimeNamespace(config, e.timeOffset)
+	return withInitialConsoleSize(config, params)
+}
+
+// processParamsToConsoleSize returns the initial console size requested in
+// params, or nil if none was requested.
+func processParamsToConsoleSize(params prot.ProcessParameters) *oci.Box {
+	if !params.EmulateConsole || params.ConsoleWidth == 0 || params.ConsoleHeight == 0 {
+		return nil
+	}
+	return &oci.Box{
+		Height: uint(params.ConsoleHeight),
+		Width:  uint(params.ConsoleWidth),
+	}
+}
+
+// withInitialConsoleSize returns a copy of the init process configuration
+// config with the initial console size requested in params applied, if the
+// process has a terminal and config doesn't already specify a size.
+func withInitialConsoleSize(config oci.Spec, params prot.ProcessParameters) oci.Spec {
+	size := processParamsToConsoleSize(params)
+	if size == nil || config.Process == nil || !config.Process.Terminal || config.Process.ConsoleSize != nil {
+		return config
+	}
+	process := *config.Process
+	process.ConsoleSize = size
+	config.Process = &process
+	return config
+}
+
+// getCgroupPath returns the path of the cgroup runc places a container with
+// the given ID and configuration in, relative to the root of the cgroup
+// hierarchy.
+func getCgroupPath(id string, config oci.Spec) string {
+	if config.Linux != nil && config.Linux.CgroupsPath != "" {
+		return filepath.Clean("/" + config.Linux.CgroupsPath)
+	}
+	return "/" + id
+}
+
+// ListContainers returns the ID, state and init pid of every container known
+// to the GCS, sorted by ID.
+func (c *gcsCore) ListContainers() ([]prot.ContainerInfo, error) {
+	c.containerCacheMutex.RLock()
+	defer c.containerCacheMutex.RUnlock()
+
+	containers := make([]prot.ContainerInfo, 0, len(c.containerCache))
+	for id, entry := range c.containerCache {
+		info := prot.ContainerInfo{ID: id, State: "created"}
+		if entry.container != nil {
+			info.InitPid = uint32(entry.container.Pid())
+			state, err := entry.container.GetState()
+			if err != nil {
+				logrus.Warnf("failed to get the state of container %s: %s", id, err)
+				info.State = "unknown"
+			} else {
+				info.State = state.Status
+			}
+		}
+		containers = append(containers, info)
+	}
+	sort.Slice(containers, func(i, j int) bool {
+		return containers[i].ID < containers[j].ID
+	})
+	return containers, nil
+}
+
+// GetContainerState returns the lifecycle state of the container with the
+// given ID, along with the pid and, once it has exited, the exit code of its
+// init process.
+func (c *gcsCore) GetContainerState(id string) (prot.ContainerStatus, error) {
+	c.containerCacheMutex.RLock()
+	defer c.containerCacheMutex.RUnlock()
+
+	containerEntry := c.getContainer(id)
+	if containerEntry == nil {
+		return prot.ContainerStatus{}, errors.WithStack(gcserr.NewContainerDoesNotExistError(id))
+	}
+	status := prot.ContainerStatus{State: prot.CsCreated, ExitCode: -1}
+	if containerEntry.container == nil {
+		return status, nil
+	}
+	status.InitPid = uint32(containerEntry.container.Pid())
+	if containerEntry.initExited {
+		status.State = prot.CsStopped
+		status.ExitCode = containerEntry.exitCode
+		return status, nil
+	}
+	state, err := containerEntry.container.GetState()
+	if err != nil {
+		return prot.ContainerStatus{}, errors.Wrapf(err, "failed to get the state of container %s", id)
+	}
+	switch state.Status {
+	case "created":
+		status.State = prot.CsCreated
+	case "running":
+		status.State = prot.CsRunning
+	case "paused", "pausing":
+		status.State = prot.CsPaused
+	case "stopped":
+		status.State = prot.CsStopped
+	default:
+		return prot.ContainerStatus{}, errors.Errorf("container %s has unknown runtime status \"%s\"", id, state.Status)
+	}
+	return status, nil
+}
+
+// GetContainerMetadata returns a copy of the labels and annotations attached
+// to the container with the given ID.
+func (c *gcsCore) GetContainerMetadata(id string) (prot.ContainerMetadata, error) {
+	c.containerCacheMutex.RLock()
+	defer c.containerCacheMutex.RUnlock()
+
+	containerEntry := c.getContainer(id)
+	if containerEntry == nil {
+		return nil, errors.WithStack(gcserr.NewContainerDoesNotExistError(id))
+	}
+	metadata := make(prot.ContainerMetadata, len(containerEntry.metadata))
+	for key, value := range containerEntry.metadata {
+		metadata[key] = value
+	}
+	return metadata, nil
+}
+
 // setupMappedVirtualDisks is a helper function which calls into the functions
 // in storage.go to set up a set of mapped virtual disks for a given container.
 // It then adds them to the container's cache entry.
 // This function expects containerCacheMutex to be locked on entry.
-func (c *gcsCore) setupMappedVirtualDisks(id string, disks []prot.MappedVirtualDisk, containerEntry *containerCacheEntry) error {
-	mounts, err := c.getMappedVirtualDiskMounts(disks)
+func (c *gcsCore) setupMappedVirtualDisks(ctx context.Context, id string, disks []prot.MappedVirtualDisk, containerEntry *containerCacheEntry) error {
+	mounts, err := c.getMappedVirtualDiskMounts(ctx, disks)
 	if err != nil {
 		return errors.Wrapf(err, "failed to get mapped virtual disk devices for container %s", id)
 	}
-	if err := c.mountMappedVirtualDisks(disks, mounts); err != nil {
+	if err := c.mountMappedVirtualDisks(ctx, disks, mounts); err != nil {
 		return errors.Wrapf(err, "failed to mount mapped virtual disks for container %s", id)
 	}
 	for _, disk := range disks {
@@ -609,15 +1972,21 @@ func (c *gcsCore) setupMappedDirectories(id string, dirs []prot.MappedDirectory,
 }
 
 // removeMappedVirtualDisks is a helper function which calls into the functions
-// in storage.go to unmount a set of mapped virtual disks for a given
-// container. It then removes them from the container's cache entry.
+// in storage.go to prepare a set of mapped virtual disks for a given container
+// to be detached by the host. It then removes them from the container's cache
+// entry. Disks which are not attached to the container are ignored.
 // This function expects containerCacheMutex to be locked on entry.
 func (c *gcsCore) removeMappedVirtualDisks(id string, disks []prot.MappedVirtualDisk, containerEntry *containerCacheEntry) error {
-	if err := c.unmountMappedVirtualDisks(disks); err != nil {
-		return errors.Wrapf(err, "failed to mount mapped virtual disks for container %s", id)
-	}
 	for _, disk := range disks {
-		containerEntry.RemoveMappedVirtualDisk(disk)
+		attached, ok := containerEntry.MappedVirtualDisks[disk.Lun]
+		if !ok {
+			logrus.Warnf("attempt to remove virtual disk with lun %d which is not attached to container %s", disk.Lun, id)
+			continue
+		}
+		if err := c.hotRemoveMappedVirtualDisk(attached); err != nil {
+			return errors.Wrapf(err, "failed to remove mapped virtual disk with lun %d for container %s", disk.Lun, id)
+		}
+		containerEntry.RemoveMappedVirtualDisk(attached)
 	}
 	return nil
 }
@@ -648,14 +2017,18 @@ func processParametersToOCI(params prot.ProcessParameters) (oci.Process, error)
 		if err != nil {
 			return oci.Process{}, err
 		}
+		if params.ExpandEnv {
+			args = expandArgsEnv(args, params.Environment)
+		}
 	} else {
 		args = params.CommandArgs
 	}
 	return oci.Process{
-		Args:     args,
-		Cwd:      params.WorkingDirectory,
-		Env:      processParamEnvToOCIEnv(params.Environment),
-		Terminal: params.EmulateConsole,
+		Args:        args,
+		Cwd:         params.WorkingDirectory,
+		Env:         processParamEnvToOCIEnv(params.Environment),
+		Terminal:    params.EmulateConsole,
+		ConsoleSize: processParamsToConsoleSize(params),
 
 		// TODO: We might want to eventually choose alternate default values
 		// for these.
@@ -734,6 +2107,37 @@ func processParametersToOCI(params prot.ProcessParameters) (oci.Process, error)
 	}, nil
 }
 
+// mountNamespacePath exists if the kernel supports mount namespaces.
+const mountNamespacePath = "/proc/self/ns/mnt"
+
+// privateMountNamespacePrefix is prefixed to the arguments of a process in a
+// container which is given a private mount namespace. unshare is run from the
+// container's root filesystem.
+var privateMountNamespacePrefix = []string{"unshare", "--mount", "--propagation", "private", "--"}
+
+// checkMountNamespaceSupport returns an HrNotImpl error if the kernel does not
+// support mount namespaces, so a process cannot be given a private one.
+func (c *gcsCore) checkMountNamespaceSupport() error {
+	exists, err := c.OS.PathExists(mountNamespacePath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to check for mount namespace support at %s", mountNamespacePath)
+	}
+	if !exists {
+		return gcserr.WrapHresult(errors.Errorf("the kernel does not support mount namespaces: %s does not exist", mountNamespacePath), gcserr.HrNotImpl)
+	}
+	return nil
+}
+
+// validateProcessArgs returns an HrInvalidArg error if args, converted from
+// the command of a process other than a container's init process, is empty.
+// Init processes may instead take their command from the OCI specification.
+func validateProcessArgs(args []string) error {
+	if len(args) == 0 {
+		return gcserr.WrapHresult(errors.New("the process has no command: one of CommandArgs or CommandLine must be set"), gcserr.HrInvalidArg)
+	}
+	return nil
+}
+
 // processParamCommandLineToOCIArgs converts a CommandLine field from
 // ProcessParameters (a space separate argument string) into an array of string
 // arguments which can be used by an oci.Process.
@@ -745,6 +2149,21 @@ func processParamCommandLineToOCIArgs(commandLine string) ([]string, error) {
 	return args, nil
 }
 
+// expandArgsEnv returns args with each reference to an environment variable,
+// of the form $VAR or ${VAR}, replaced with its value in environment, or the
+// empty string if it is not set. Each argument is expanded after the command
+// line is split, so a value containing spaces is not split into several
+// arguments.
+func expandArgsEnv(args []string, environment map[string]string) []string {
+	expanded := make([]string, 0, len(args))
+	for _, arg := range args {
+		expanded = append(expanded, os.Expand(arg, func(name string) string {
+			return environment[name]
+		}))
+	}
+	return expanded
+}
+
 // processParamEnvToOCIEnv converts an Environment field from ProcessParameters
 // (a map from environment variable to value) into an array of environment
 // variable assignments (where each is in the form "<variable>=<value>") which
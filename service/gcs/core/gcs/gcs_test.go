@@ -1,9 +1,21 @@
 package gcs
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
 
+	"github.com/Microsoft/opengcs/service/gcs/gcserr"
 	"github.com/Microsoft/opengcs/service/gcs/oslayer"
 	"github.com/Microsoft/opengcs/service/gcs/oslayer/mockos"
 	"github.com/Microsoft/opengcs/service/gcs/prot"
@@ -14,6 +26,7 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	oci "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pkg/errors"
 )
 
 var _ = Describe("GCS", func() {
@@ -221,6 +234,48 @@ var _ = Describe("GCS", func() {
 					}))
 				})
 			})
+			Context("CommandArgs has arguments containing spaces and quotes", func() {
+				BeforeEach(func() {
+					params = prot.ProcessParameters{
+						CommandArgs: []string{"echo", "hello world", `"quoted"`, "it's"},
+					}
+				})
+				AssertNoError()
+				It("should pass the arguments through verbatim", func() {
+					Expect(process.Args).To(Equal([]string{"echo", "hello world", `"quoted"`, "it's"}))
+				})
+			})
+			Context("CommandLine references environment variables and ExpandEnv is set", func() {
+				BeforeEach(func() {
+					params = prot.ProcessParameters{
+						CommandLine: "ls $HOME ${DIR}/sub --color=$UNSET",
+						ExpandEnv:   true,
+						Environment: map[string]string{
+							"HOME": "/root",
+							"DIR":  "/my dir",
+						},
+					}
+				})
+				AssertNoError()
+				It("should expand set variables and replace unset ones with nothing", func() {
+					Expect(process.Args).To(Equal([]string{"ls", "/root", "/my dir/sub", "--color="}))
+				})
+			})
+			Context("CommandLine references environment variables and ExpandEnv is not set", func() {
+				BeforeEach(func() {
+					params = prot.ProcessParameters{
+						CommandLine: "ls $HOME ${DIR}/sub",
+						Environment: map[string]string{
+							"HOME": "/root",
+							"DIR":  "/my dir",
+						},
+					}
+				})
+				AssertNoError()
+				It("should leave the references literal", func() {
+					Expect(process.Args).To(Equal([]string{"ls", "$HOME", "${DIR}/sub"}))
+				})
+			})
 			Context("CommandLine is used rather than CommandArgs", func() {
 				BeforeEach(func() {
 					params = prot.ProcessParameters{
@@ -319,6 +374,74 @@ var _ = Describe("GCS", func() {
 					}))
 				})
 			})
+			Context("a terminal with an initial size is requested", func() {
+				BeforeEach(func() {
+					params = prot.ProcessParameters{
+						CommandArgs:    []string{"sh"},
+						EmulateConsole: true,
+						ConsoleWidth:   120,
+						ConsoleHeight:  40,
+					}
+				})
+				AssertNoError()
+				It("should allocate a terminal with the initial size", func() {
+					Expect(process.Terminal).To(BeTrue())
+					Expect(process.ConsoleSize).To(Equal(&oci.Box{Height: 40, Width: 120}))
+				})
+			})
+			Context("an initial size is given without a terminal", func() {
+				BeforeEach(func() {
+					params = prot.ProcessParameters{
+						CommandArgs:   []string{"sh"},
+						ConsoleWidth:  120,
+						ConsoleHeight: 40,
+					}
+				})
+				AssertNoError()
+				It("should not allocate a terminal or set a size", func() {
+					Expect(process.Terminal).To(BeFalse())
+					Expect(process.ConsoleSize).To(BeNil())
+				})
+			})
+		})
+
+		Describe("calling withInitialConsoleSize", func() {
+			var (
+				params prot.ProcessParameters
+				config oci.Spec
+				result oci.Spec
+			)
+			BeforeEach(func() {
+				params = prot.ProcessParameters{
+					EmulateConsole: true,
+					ConsoleWidth:   80,
+					ConsoleHeight:  25,
+				}
+				config = oci.Spec{Process: &oci.Process{Terminal: true}}
+			})
+			JustBeforeEach(func() {
+				result = withInitialConsoleSize(config, params)
+			})
+			It("should set the initial size of the init process's terminal", func() {
+				Expect(result.Process.ConsoleSize).To(Equal(&oci.Box{Height: 25, Width: 80}))
+				Expect(config.Process.ConsoleSize).To(BeNil())
+			})
+			Context("the configuration already specifies a size", func() {
+				BeforeEach(func() {
+					config.Process.ConsoleSize = &oci.Box{Height: 10, Width: 10}
+				})
+				It("should keep the configured size", func() {
+					Expect(result.Process.ConsoleSize).To(Equal(&oci.Box{Height: 10, Width: 10}))
+				})
+			})
+			Context("the init process has no terminal", func() {
+				BeforeEach(func() {
+					config.Process.Terminal = false
+				})
+				It("should not set a size", func() {
+					Expect(result.Process.ConsoleSize).To(BeNil())
+				})
+			})
 		})
 
 		Describe("calling processParamCommandLineToOCIArgs", func() {
@@ -733,7 +856,7 @@ var _ = Describe("GCS", func() {
 			Describe("calling CreateContainer", func() {
 				Context("mapped virtual disk is created in the utility VM", func() {
 					JustBeforeEach(func() {
-						err = coreint.CreateContainer(containerID, createSettings)
+						err = coreint.CreateContainer(context.Background(), containerID, createSettings)
 					})
 					It("should not produce an error", func() {
 						Expect(err).NotTo(HaveOccurred())
@@ -741,7 +864,7 @@ var _ = Describe("GCS", func() {
 				})
 				Context("mapped virtual disk is created in the container namespace", func() {
 					JustBeforeEach(func() {
-						err = coreint.CreateContainer(containerID, createSettingsCreateInUtilityVMFalse)
+						err = coreint.CreateContainer(context.Background(), containerID, createSettingsCreateInUtilityVMFalse)
 					})
 					It("should produce an error", func() {
 						Expect(err).To(HaveOccurred())
@@ -762,7 +885,7 @@ var _ = Describe("GCS", func() {
 					})
 					Context("the container has already been created", func() {
 						BeforeEach(func() {
-							err = coreint.CreateContainer(containerID, createSettings)
+							err = coreint.CreateContainer(context.Background(), containerID, createSettings)
 							Expect(err).NotTo(HaveOccurred())
 						})
 						It("should not produce an error", func() {
@@ -781,7 +904,7 @@ var _ = Describe("GCS", func() {
 					})
 					Context("the container has already been created", func() {
 						BeforeEach(func() {
-							err = coreint.CreateContainer(containerID, createSettings)
+							err = coreint.CreateContainer(context.Background(), containerID, createSettings)
 							Expect(err).NotTo(HaveOccurred())
 						})
 						Context("the container already has an initial process in it", func() {
@@ -792,6 +915,28 @@ var _ = Describe("GCS", func() {
 							It("should not produce an error", func() {
 								Expect(err).NotTo(HaveOccurred())
 							})
+							Context("the process has no command", func() {
+								BeforeEach(func() {
+									params = prot.ProcessParameters{}
+								})
+								It("should produce an invalid argument error", func() {
+									Expect(err).To(HaveOccurred())
+									hresult, herr := gcserr.GetHresult(err)
+									Expect(herr).NotTo(HaveOccurred())
+									Expect(hresult).To(Equal(gcserr.HrInvalidArg))
+								})
+							})
+							Context("the container's init process has exited", func() {
+								BeforeEach(func() {
+									coreint.containerCacheMutex.Lock()
+									coreint.getContainer(containerID).initExited = true
+									coreint.containerCacheMutex.Unlock()
+								})
+								It("should produce a not running error", func() {
+									Expect(err).To(HaveOccurred())
+									Expect(err.Error()).To(ContainSubstring("container %s is not running", containerID))
+								})
+							})
 						})
 						Context("the container does not already have an initial process in it", func() {
 							It("should produce an error", func() {
@@ -815,7 +960,7 @@ var _ = Describe("GCS", func() {
 					})
 					Context("the container has already been created", func() {
 						BeforeEach(func() {
-							err = coreint.CreateContainer(containerID, createSettings)
+							err = coreint.CreateContainer(context.Background(), containerID, createSettings)
 							Expect(err).NotTo(HaveOccurred())
 						})
 						It("should not produce an error", func() {
@@ -834,7 +979,7 @@ var _ = Describe("GCS", func() {
 					})
 					Context("the container has already been created", func() {
 						BeforeEach(func() {
-							err = coreint.CreateContainer(containerID, createSettings)
+							err = coreint.CreateContainer(context.Background(), containerID, createSettings)
 							Expect(err).NotTo(HaveOccurred())
 						})
 						It("should not produce an error", func() {
@@ -860,7 +1005,7 @@ var _ = Describe("GCS", func() {
 				})
 				Context("the process has already been created", func() {
 					BeforeEach(func() {
-						err = coreint.CreateContainer(containerID, createSettings)
+						err = coreint.CreateContainer(context.Background(), containerID, createSettings)
 						Expect(err).NotTo(HaveOccurred())
 						_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
 						Expect(err).NotTo(HaveOccurred())
@@ -893,7 +1038,7 @@ var _ = Describe("GCS", func() {
 				})
 				Context("the container has already been created", func() {
 					BeforeEach(func() {
-						err = coreint.CreateContainer(containerID, createSettings)
+						err = coreint.CreateContainer(context.Background(), containerID, createSettings)
 						Expect(err).NotTo(HaveOccurred())
 					})
 					It("should not produce an error", func() {
@@ -905,6 +1050,33 @@ var _ = Describe("GCS", func() {
 						Expect(err).To(HaveOccurred())
 					})
 				})
+				Context("the container's init process has been started", func() {
+					var fds *fdCountingOS
+					BeforeEach(func() {
+						fds = &fdCountingOS{OS: coreint.OS, counts: map[string]int{"/proc/123/fd": 4}}
+						coreint.OS = fds
+						err = coreint.CreateContainer(context.Background(), containerID, createSettings)
+						Expect(err).NotTo(HaveOccurred())
+						_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+						Expect(err).NotTo(HaveOccurred())
+					})
+					It("should report each process's open file descriptors", func() {
+						Expect(err).NotTo(HaveOccurred())
+						Expect(processes).To(HaveLen(1))
+						Expect(processes[0].OpenFileDescriptors).NotTo(BeNil())
+						Expect(*processes[0].OpenFileDescriptors).To(Equal(4))
+					})
+					Context("a process exits while the processes are listed", func() {
+						BeforeEach(func() {
+							delete(fds.counts, "/proc/123/fd")
+						})
+						It("should list the process without a count", func() {
+							Expect(err).NotTo(HaveOccurred())
+							Expect(processes).To(HaveLen(1))
+							Expect(processes[0].OpenFileDescriptors).To(BeNil())
+						})
+					})
+				})
 			})
 			Describe("calling RunExternalProcess", func() {
 				var (
@@ -916,14 +1088,59 @@ var _ = Describe("GCS", func() {
 				It("should not produce an error", func() {
 					Expect(err).NotTo(HaveOccurred())
 				})
+				Context("an unknown relay failure policy is given", func() {
+					BeforeEach(func() {
+						externalParams.RelayFailurePolicy = "retry"
+					})
+					It("should produce an invalid argument error", func() {
+						Expect(err).To(HaveOccurred())
+						hresult, herr := gcserr.GetHresult(err)
+						Expect(herr).NotTo(HaveOccurred())
+						Expect(hresult).To(Equal(gcserr.HrInvalidArg))
+					})
+				})
+				Context("the kill relay failure policy is given", func() {
+					BeforeEach(func() {
+						externalParams.RelayFailurePolicy = string(stdio.RelayFailureKill)
+					})
+					It("should set the policy and a failure callback on the stdio set", func() {
+						Expect(err).NotTo(HaveOccurred())
+						Expect(fullStdioSet.FailurePolicy).To(Equal(stdio.RelayFailureKill))
+						Expect(fullStdioSet.OnFailure).NotTo(BeNil())
+					})
+				})
+				Context("the process is given as CommandArgs", func() {
+					var recordingOS *argvRecordingOS
+					BeforeEach(func() {
+						recordingOS = &argvRecordingOS{OS: coreint.OS}
+						coreint.OS = recordingOS
+						externalParams.CommandLine = ""
+						externalParams.CommandArgs = []string{"sh", "-c", "echo 'a  b'"}
+					})
+					It("should exec the arguments verbatim", func() {
+						Expect(err).NotTo(HaveOccurred())
+						Expect(recordingOS.argv).To(Equal([][]string{{"sh", "-c", "echo 'a  b'"}}))
+					})
+				})
+				Context("the process has no command", func() {
+					BeforeEach(func() {
+						externalParams = prot.ProcessParameters{IsExternal: true}
+					})
+					It("should produce an invalid argument error", func() {
+						Expect(err).To(HaveOccurred())
+						hresult, herr := gcserr.GetHresult(err)
+						Expect(herr).NotTo(HaveOccurred())
+						Expect(hresult).To(Equal(gcserr.HrInvalidArg))
+					})
+				})
 			})
 			Describe("calling ModifySettings", func() {
 				Context("adding a mapped virtual disk", func() {
 					Context("the lun is already in use", func() {
 						BeforeEach(func() {
-							err = coreint.CreateContainer(containerID, createSettings)
+							err = coreint.CreateContainer(context.Background(), containerID, createSettings)
 							Expect(err).NotTo(HaveOccurred())
-							err = coreint.ModifySettings(containerID, diskModificationRequestSameLun)
+							err = coreint.ModifySettings(context.Background(), containerID, diskModificationRequestSameLun)
 						})
 						It("should produce an error", func() {
 							Expect(err).To(HaveOccurred())
@@ -931,11 +1148,11 @@ var _ = Describe("GCS", func() {
 					})
 					Context("the lun is not already in use", func() {
 						JustBeforeEach(func() {
-							err = coreint.ModifySettings(containerID, diskModificationRequest)
+							err = coreint.ModifySettings(context.Background(), containerID, diskModificationRequest)
 						})
 						Context("the container has already been created", func() {
 							BeforeEach(func() {
-								err = coreint.CreateContainer(containerID, createSettings)
+								err = coreint.CreateContainer(context.Background(), containerID, createSettings)
 								Expect(err).NotTo(HaveOccurred())
 							})
 							It("should not produce an error", func() {
@@ -952,9 +1169,9 @@ var _ = Describe("GCS", func() {
 				Context("removing a mapped virtual disk", func() {
 					Context("the disk has not been added", func() {
 						BeforeEach(func() {
-							err = coreint.CreateContainer(containerID, createSettings)
+							err = coreint.CreateContainer(context.Background(), containerID, createSettings)
 							Expect(err).NotTo(HaveOccurred())
-							err = coreint.ModifySettings(containerID, diskModificationRequestRemove)
+							err = coreint.ModifySettings(context.Background(), containerID, diskModificationRequestRemove)
 						})
 						It("should not produce an error", func() {
 							Expect(err).NotTo(HaveOccurred())
@@ -962,11 +1179,11 @@ var _ = Describe("GCS", func() {
 					})
 					Context("the disk has been added", func() {
 						JustBeforeEach(func() {
-							err = coreint.ModifySettings(containerID, diskModificationRequestRemove)
+							err = coreint.ModifySettings(context.Background(), containerID, diskModificationRequestRemove)
 						})
 						Context("the container has already been created", func() {
 							BeforeEach(func() {
-								err = coreint.CreateContainer(containerID, createSettings)
+								err = coreint.CreateContainer(context.Background(), containerID, createSettings)
 								Expect(err).NotTo(HaveOccurred())
 								coreint.containerCache[containerID].AddMappedVirtualDisk(mappedVirtualDisk)
 							})
@@ -984,11 +1201,11 @@ var _ = Describe("GCS", func() {
 				Context("adding a mapped directory", func() {
 					Context("the port is already in use", func() {
 						BeforeEach(func() {
-							err = coreint.CreateContainer(containerID, createSettings)
+							err = coreint.CreateContainer(context.Background(), containerID, createSettings)
 							Expect(err).NotTo(HaveOccurred())
-							err = coreint.ModifySettings(containerID, dirModificationRequestSamePort)
+							err = coreint.ModifySettings(context.Background(), containerID, dirModificationRequestSamePort)
 							Expect(err).NotTo(HaveOccurred())
-							err = coreint.ModifySettings(containerID, dirModificationRequestSamePort)
+							err = coreint.ModifySettings(context.Background(), containerID, dirModificationRequestSamePort)
 						})
 						It("should produce an error", func() {
 							Expect(err).To(HaveOccurred())
@@ -996,11 +1213,11 @@ var _ = Describe("GCS", func() {
 					})
 					Context("the port is not already in use", func() {
 						JustBeforeEach(func() {
-							err = coreint.ModifySettings(containerID, dirModificationRequest)
+							err = coreint.ModifySettings(context.Background(), containerID, dirModificationRequest)
 						})
 						Context("the container has already been created", func() {
 							BeforeEach(func() {
-								err = coreint.CreateContainer(containerID, createSettings)
+								err = coreint.CreateContainer(context.Background(), containerID, createSettings)
 								Expect(err).NotTo(HaveOccurred())
 							})
 							It("should not produce an error", func() {
@@ -1017,9 +1234,9 @@ var _ = Describe("GCS", func() {
 				Context("removing a mapped directory", func() {
 					Context("the directory has not been added", func() {
 						BeforeEach(func() {
-							err = coreint.CreateContainer(containerID, createSettings)
+							err = coreint.CreateContainer(context.Background(), containerID, createSettings)
 							Expect(err).NotTo(HaveOccurred())
-							err = coreint.ModifySettings(containerID, dirModificationRequestRemove)
+							err = coreint.ModifySettings(context.Background(), containerID, dirModificationRequestRemove)
 						})
 						It("should not produce an error", func() {
 							Expect(err).NotTo(HaveOccurred())
@@ -1027,11 +1244,11 @@ var _ = Describe("GCS", func() {
 					})
 					Context("the directory has been added", func() {
 						JustBeforeEach(func() {
-							err = coreint.ModifySettings(containerID, dirModificationRequestRemove)
+							err = coreint.ModifySettings(context.Background(), containerID, dirModificationRequestRemove)
 						})
 						Context("the container has already been created", func() {
 							BeforeEach(func() {
-								err = coreint.CreateContainer(containerID, createSettings)
+								err = coreint.CreateContainer(context.Background(), containerID, createSettings)
 								Expect(err).NotTo(HaveOccurred())
 								coreint.containerCache[containerID].AddMappedDirectory(mappedDirectory)
 							})
@@ -1049,10 +1266,10 @@ var _ = Describe("GCS", func() {
 			})
 			Describe("calling wait container", func() {
 				var (
-					exitCode int
+					exitStatus prot.ContainerExitStatus
 				)
 				JustBeforeEach(func() {
-					exitCode, err = coreint.WaitContainer(containerID)
+					exitStatus, err = coreint.WaitContainer(containerID)
 				})
 				Context("container does not exist", func() {
 					It("should produce errors", func() {
@@ -1061,7 +1278,7 @@ var _ = Describe("GCS", func() {
 				})
 				Context("container does exist", func() {
 					JustBeforeEach(func() {
-						err = coreint.CreateContainer(containerID, createSettings)
+						err = coreint.CreateContainer(context.Background(), containerID, createSettings)
 						Expect(err).NotTo(HaveOccurred())
 					})
 					It("should not produce an error", func() {
@@ -1093,7 +1310,7 @@ var _ = Describe("GCS", func() {
 				})
 				Context("is a container process", func() {
 					JustBeforeEach(func() {
-						err = coreint.CreateContainer(containerID, createSettings)
+						err = coreint.CreateContainer(context.Background(), containerID, createSettings)
 						Expect(err).NotTo(HaveOccurred())
 						pid, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
 						Expect(err).NotTo(HaveOccurred())
@@ -1103,6 +1320,4228 @@ var _ = Describe("GCS", func() {
 					})
 				})
 			})
-		})
-	})
-})
+			Describe("calling GetScratchDiskUsage", func() {
+				var (
+					usage prot.ScratchDiskUsage
+				)
+				JustBeforeEach(func() {
+					usage, err = coreint.GetScratchDiskUsage(containerID)
+				})
+				Context("the container has already been created", func() {
+					BeforeEach(func() {
+						err = coreint.CreateContainer(context.Background(), containerID, createSettings)
+						Expect(err).NotTo(HaveOccurred())
+					})
+					It("should report the scratch filesystem usage", func() {
+						Expect(err).NotTo(HaveOccurred())
+						Expect(usage.TotalBytes).To(Equal(uint64(1000 * 4096)))
+						Expect(usage.UsedBytes).To(Equal(uint64(500 * 4096)))
+						Expect(usage.FreeBytes).To(Equal(uint64(400 * 4096)))
+					})
+				})
+				Context("the container has not already been created", func() {
+					It("should produce an error", func() {
+						Expect(err).To(HaveOccurred())
+					})
+				})
+			})
+			Describe("calling getOverlayDirs", func() {
+				var (
+					upperDir    string
+					workdirPath string
+				)
+				JustBeforeEach(func() {
+					upperDir, workdirPath = coreint.getOverlayDirs(containerID, createSettings)
+				})
+				Context("the paths are not specified", func() {
+					It("should derive them from the scratch space", func() {
+						Expect(upperDir).To(Equal(filepath.Join("/tmp/gcs", containerID, "scratch", "upper")))
+						Expect(workdirPath).To(Equal(filepath.Join("/tmp/gcs", containerID, "scratch", "work")))
+					})
+				})
+				Context("the paths are specified", func() {
+					BeforeEach(func() {
+						createSettings.UpperDirPath = "/disk/upper"
+						createSettings.WorkDirPath = "/disk/work"
+					})
+					It("should use the specified paths", func() {
+						Expect(upperDir).To(Equal("/disk/upper"))
+						Expect(workdirPath).To(Equal("/disk/work"))
+					})
+				})
+			})
+			Describe("calling CreateContainer with explicit overlay directories", func() {
+				JustBeforeEach(func() {
+					err = coreint.CreateContainer(context.Background(), containerID, createSettings)
+				})
+				Context("the directories are on the same filesystem", func() {
+					BeforeEach(func() {
+						createSettings.UpperDirPath = "/disk/upper"
+						createSettings.WorkDirPath = "/disk/work"
+					})
+					It("should not produce an error", func() {
+						Expect(err).NotTo(HaveOccurred())
+					})
+				})
+				Context("only the upper directory is specified", func() {
+					BeforeEach(func() {
+						createSettings.UpperDirPath = "/disk/upper"
+					})
+					It("should produce an error", func() {
+						Expect(err).To(HaveOccurred())
+					})
+				})
+				Context("the directories are on different filesystems", func() {
+					BeforeEach(func() {
+						createSettings.UpperDirPath = "/disk1/upper"
+						createSettings.WorkDirPath = "/disk2/work"
+					})
+					It("should produce an error", func() {
+						Expect(err).To(HaveOccurred())
+					})
+				})
+			})
+			Describe("calling SyncContainer", func() {
+				var (
+					freeze bool
+				)
+				BeforeEach(func() {
+					freeze = false
+				})
+				JustBeforeEach(func() {
+					err = coreint.SyncContainer(containerID, freeze, time.Second)
+				})
+				Context("the container has already been created", func() {
+					BeforeEach(func() {
+						err = coreint.CreateContainer(context.Background(), containerID, createSettings)
+						Expect(err).NotTo(HaveOccurred())
+					})
+					It("should not produce an error", func() {
+						Expect(err).NotTo(HaveOccurred())
+					})
+					Context("the container is running and frozen during the sync", func() {
+						BeforeEach(func() {
+							freeze = true
+							_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+							Expect(err).NotTo(HaveOccurred())
+						})
+						It("should not produce an error", func() {
+							Expect(err).NotTo(HaveOccurred())
+						})
+					})
+				})
+				Context("the container has not already been created", func() {
+					It("should produce an error", func() {
+						Expect(err).To(HaveOccurred())
+					})
+				})
+			})
+			Describe("calling RestoreContainer", func() {
+				JustBeforeEach(func() {
+					err = coreint.RestoreContainer(containerID, initialExecParams.OCISpecification, prot.CheckpointOptions{ImagesPath: "/images"})
+				})
+				Context("the container has been created but not started", func() {
+					BeforeEach(func() {
+						err = coreint.CreateContainer(context.Background(), containerID, createSettings)
+						Expect(err).NotTo(HaveOccurred())
+					})
+					It("should not produce an error", func() {
+						Expect(err).NotTo(HaveOccurred())
+					})
+					It("should track the restored container and its init process", func() {
+						entry := coreint.getContainer(containerID)
+						Expect(entry).NotTo(BeNil())
+						Expect(entry.container).NotTo(BeNil())
+						Expect(entry.hasRunInitProcess).To(BeTrue())
+						_, ok := coreint.processCache[entry.container.Pid()]
+						Expect(ok).To(BeTrue())
+					})
+				})
+				Context("the container is running", func() {
+					BeforeEach(func() {
+						err = coreint.CreateContainer(context.Background(), containerID, createSettings)
+						Expect(err).NotTo(HaveOccurred())
+						_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+						Expect(err).NotTo(HaveOccurred())
+					})
+					It("should produce an error", func() {
+						Expect(err).To(HaveOccurred())
+					})
+				})
+				Context("the container has not already been created", func() {
+					It("should produce an error", func() {
+						Expect(err).To(HaveOccurred())
+					})
+				})
+			})
+			Describe("calling CheckpointContainer", func() {
+				JustBeforeEach(func() {
+					err = coreint.CheckpointContainer(containerID, prot.CheckpointOptions{ImagesPath: "/images"})
+				})
+				Context("the container is running", func() {
+					BeforeEach(func() {
+						err = coreint.CreateContainer(context.Background(), containerID, createSettings)
+						Expect(err).NotTo(HaveOccurred())
+						_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+						Expect(err).NotTo(HaveOccurred())
+					})
+					It("should not produce an error", func() {
+						Expect(err).NotTo(HaveOccurred())
+					})
+				})
+				Context("the container has been created but not started", func() {
+					BeforeEach(func() {
+						err = coreint.CreateContainer(context.Background(), containerID, createSettings)
+						Expect(err).NotTo(HaveOccurred())
+					})
+					It("should produce an error", func() {
+						Expect(err).To(HaveOccurred())
+					})
+				})
+				Context("the container has not already been created", func() {
+					It("should produce an error", func() {
+						Expect(err).To(HaveOccurred())
+					})
+				})
+			})
+			Describe("calling GetInitOutput", func() {
+				var (
+					output []byte
+				)
+				JustBeforeEach(func() {
+					output, err = coreint.GetInitOutput(containerID)
+				})
+				Context("the container was created with output buffering", func() {
+					BeforeEach(func() {
+						createSettings.BufferInitOutput = true
+						err = coreint.CreateContainer(context.Background(), containerID, createSettings)
+						Expect(err).NotTo(HaveOccurred())
+						stdioSet := &stdio.ConnectionSet{}
+						_, err = coreint.ExecProcess(containerID, initialExecParams, stdioSet)
+						Expect(err).NotTo(HaveOccurred())
+						// The runtime writes the init process's output to
+						// the connections it was given.
+						stdioSet.Out.Write([]byte("init "))
+						stdioSet.Err.Write([]byte("output"))
+					})
+					It("should return the buffered output", func() {
+						Expect(err).NotTo(HaveOccurred())
+						Expect(string(output)).To(Equal("init output"))
+					})
+					It("should keep the output while the container exists", func() {
+						_, err = coreint.GetInitOutput(containerID)
+						Expect(err).NotTo(HaveOccurred())
+					})
+					Context("the container has exited", func() {
+						BeforeEach(func() {
+							coreint.containerCacheMutex.Lock()
+							delete(coreint.containerCache, containerID)
+							coreint.containerCacheMutex.Unlock()
+						})
+						It("should return the buffered output only once", func() {
+							Expect(err).NotTo(HaveOccurred())
+							Expect(string(output)).To(Equal("init output"))
+							_, err = coreint.GetInitOutput(containerID)
+							Expect(err).To(HaveOccurred())
+						})
+					})
+				})
+				Context("the requested buffer size exceeds the maximum", func() {
+					BeforeEach(func() {
+						createSettings.BufferInitOutput = true
+						createSettings.InitOutputBufferBytes = prot.MaxInitOutputBufferBytes + 1
+					})
+					It("should fail to create the container", func() {
+						Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(HaveOccurred())
+					})
+				})
+				Context("the container was created without output buffering", func() {
+					BeforeEach(func() {
+						err = coreint.CreateContainer(context.Background(), containerID, createSettings)
+						Expect(err).NotTo(HaveOccurred())
+					})
+					It("should produce an error", func() {
+						Expect(err).To(HaveOccurred())
+					})
+				})
+				Context("the container has not already been created", func() {
+					It("should produce an error", func() {
+						Expect(err).To(HaveOccurred())
+					})
+				})
+			})
+			Describe("looking up a mapped virtual disk by controller and LUN", func() {
+				var (
+					recorder *pathRecordingOS
+					device   string
+				)
+				BeforeEach(func() {
+					recorder = &pathRecordingOS{OS: mockos.NewOS()}
+				})
+				JustBeforeEach(func() {
+					device, err = scsiControllerLunToName(context.Background(), recorder, 2, 5)
+				})
+				It("should scan only the given controller", func() {
+					Expect(err).NotTo(HaveOccurred())
+					Expect(recorder.opened).To(Equal([]string{"/sys/class/scsi_host/host2/scan"}))
+				})
+				It("should look up the device at the controller's SCSI address", func() {
+					Expect(err).NotTo(HaveOccurred())
+					Expect(recorder.readDirs).To(Equal([]string{"/sys/bus/scsi/devices/2:0:0:5/block"}))
+					Expect(device).To(HavePrefix("/dev/"))
+				})
+			})
+			Describe("setting up a mapped virtual disk which is not yet visible", func() {
+				var (
+					flaky *flakyDeviceOS
+					disks []prot.MappedVirtualDisk
+					ctx   context.Context
+				)
+				BeforeEach(func() {
+					DeviceRescanInterval = time.Millisecond
+					ctx = context.Background()
+					flaky = &flakyDeviceOS{OS: coreint.OS, readDirFailures: 2}
+					coreint.OS = flaky
+					disks = []prot.MappedVirtualDisk{
+						{
+							ContainerPath:     "/path/inside/uvm",
+							Lun:               3,
+							CreateInUtilityVM: true,
+						},
+					}
+				})
+				AfterEach(func() {
+					DeviceRescanInterval = 100 * time.Millisecond
+				})
+				JustBeforeEach(func() {
+					err = coreint.setupMappedVirtualDisks(ctx, containerID, disks, newContainerCacheEntry(containerID))
+				})
+				Context("the device appears on the third scan", func() {
+					It("should rescan until it appears and mount it", func() {
+						Expect(err).NotTo(HaveOccurred())
+						Expect(flaky.readDirs).To(Equal(3))
+						Expect(flaky.scans).To(Equal(3))
+					})
+				})
+				Context("the device never appears", func() {
+					BeforeEach(func() {
+						flaky.readDirFailures = DeviceRescanAttempts
+					})
+					It("should give up after the configured number of scans", func() {
+						Expect(err).To(HaveOccurred())
+						Expect(flaky.scans).To(Equal(DeviceRescanAttempts))
+					})
+				})
+				Context("the request's context is done before the device appears", func() {
+					BeforeEach(func() {
+						flaky.readDirFailures = DeviceRescanAttempts
+						var cancel context.CancelFunc
+						ctx, cancel = context.WithCancel(context.Background())
+						cancel()
+					})
+					It("should stop rescanning and return the context's error", func() {
+						Expect(errors.Cause(err)).To(Equal(context.Canceled))
+						Expect(flaky.scans).To(Equal(1))
+					})
+				})
+			})
+			Describe("sharing scratch between containers", func() {
+				var (
+					recorder     *mountRecordingOS
+					secondID     string
+					sharedPath   string
+					firstTarget  string
+					secondTarget string
+				)
+				BeforeEach(func() {
+					recorder = &mountRecordingOS{OS: coreint.OS}
+					coreint.OS = recorder
+					secondID = containerID + "-second"
+					sharedPath = filepath.Join(sharedScratchBasePath, "pod")
+					createSettings.SharedScratch = &prot.SharedScratch{ID: "pod", ContainerPath: "/shared"}
+					Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+					Expect(coreint.CreateContainer(context.Background(), secondID, createSettings)).To(Succeed())
+					_, _, _, rootfsPath := coreint.getUnioningPaths(containerID)
+					firstTarget = filepath.Join(rootfsPath, "shared")
+					_, _, _, rootfsPath = coreint.getUnioningPaths(secondID)
+					secondTarget = filepath.Join(rootfsPath, "shared")
+				})
+				It("should bind the same directory into both containers", func() {
+					Expect(recorder.ops).To(ContainElement("bind " + sharedPath + " " + firstTarget))
+					Expect(recorder.ops).To(ContainElement("bind " + sharedPath + " " + secondTarget))
+					Expect(coreint.sharedScratches["pod"].refs).To(Equal(2))
+				})
+				It("should only remove the directory when the last container is cleaned up", func() {
+					recorder.ops = nil
+					Expect(coreint.unmountSharedScratch(coreint.getContainer(containerID))).To(Succeed())
+					Expect(recorder.ops).To(Equal([]string{"unmount " + firstTarget}))
+					Expect(coreint.sharedScratches["pod"].refs).To(Equal(1))
+
+					recorder.ops = nil
+					Expect(coreint.unmountSharedScratch(coreint.getContainer(secondID))).To(Succeed())
+					Expect(recorder.ops).To(Equal([]string{"unmount " + secondTarget, "remove " + sharedPath}))
+					Expect(coreint.sharedScratches).NotTo(HaveKey("pod"))
+				})
+				Context("the container path is relative", func() {
+					BeforeEach(func() {
+						createSettings.SharedScratch.ContainerPath = "shared"
+					})
+					It("should fail to create the container", func() {
+						Expect(coreint.CreateContainer(context.Background(), containerID+"-third", createSettings)).NotTo(Succeed())
+					})
+				})
+			})
+			Describe("modifying container metadata", func() {
+				var (
+					metadata prot.ContainerMetadata
+				)
+				modify := func(requestType prot.RequestType, settings prot.ContainerMetadata) error {
+					return coreint.ModifySettings(context.Background(), containerID, prot.ResourceModificationRequestResponse{
+						ResourceType: prot.PtContainerMetadata,
+						RequestType:  requestType,
+						Settings:     &settings,
+					})
+				}
+				BeforeEach(func() {
+					err = coreint.CreateContainer(context.Background(), containerID, createSettings)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(modify(prot.RtAdd, prot.ContainerMetadata{"a": "1", "b": "2"})).To(Succeed())
+				})
+				JustBeforeEach(func() {
+					metadata, err = coreint.GetContainerMetadata(containerID)
+				})
+				Context("more metadata is added", func() {
+					BeforeEach(func() {
+						Expect(modify(prot.RtAdd, prot.ContainerMetadata{"b": "3", "c": "4"})).To(Succeed())
+					})
+					It("should merge it into the existing metadata", func() {
+						Expect(err).NotTo(HaveOccurred())
+						Expect(metadata).To(Equal(prot.ContainerMetadata{"a": "1", "b": "3", "c": "4"}))
+					})
+				})
+				Context("metadata is removed", func() {
+					BeforeEach(func() {
+						Expect(modify(prot.RtRemove, prot.ContainerMetadata{"a": "", "missing": ""})).To(Succeed())
+					})
+					It("should delete only the given keys", func() {
+						Expect(err).NotTo(HaveOccurred())
+						Expect(metadata).To(Equal(prot.ContainerMetadata{"b": "2"}))
+					})
+				})
+				Context("the returned metadata is modified", func() {
+					It("should not change the container's metadata", func() {
+						metadata["a"] = "changed"
+						current, err := coreint.GetContainerMetadata(containerID)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(current["a"]).To(Equal("1"))
+					})
+				})
+			})
+			Describe("retrieving init output which has overflowed its buffer", func() {
+				BeforeEach(func() {
+					createSettings.BufferInitOutput = true
+					createSettings.InitOutputBufferBytes = 4
+					err = coreint.CreateContainer(context.Background(), containerID, createSettings)
+					Expect(err).NotTo(HaveOccurred())
+					stdioSet := &stdio.ConnectionSet{}
+					_, err = coreint.ExecProcess(containerID, initialExecParams, stdioSet)
+					Expect(err).NotTo(HaveOccurred())
+					stdioSet.Out.Write([]byte("abcdef"))
+				})
+				It("should mark the output as truncated", func() {
+					output, err := coreint.GetInitOutput(containerID)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(output)).To(Equal(stdio.TruncatedOutputMarker + "cdef"))
+				})
+			})
+			Describe("updating container resource limits", func() {
+				var (
+					cgroups *cgroupRecordingOS
+					request prot.ResourceModificationRequestResponse
+				)
+				BeforeEach(func() {
+					cgroups = &cgroupRecordingOS{OS: coreint.OS, written: make(map[string]string)}
+					coreint.OS = cgroups
+					err = coreint.CreateContainer(context.Background(), containerID, createSettings)
+					Expect(err).NotTo(HaveOccurred())
+					_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+					Expect(err).NotTo(HaveOccurred())
+				})
+				JustBeforeEach(func() {
+					err = coreint.ModifySettings(context.Background(), containerID, request)
+				})
+				Context("the memory limit is updated", func() {
+					BeforeEach(func() {
+						request = prot.ResourceModificationRequestResponse{
+							ResourceType: prot.PtMemory,
+							RequestType:  prot.RtUpdate,
+							Settings:     &prot.MemoryLimit{LimitInBytes: 1048576},
+						}
+					})
+					Context("cgroup v1 is mounted", func() {
+						It("should write the limit to the memory controller", func() {
+							Expect(err).NotTo(HaveOccurred())
+							Expect(cgroups.written).To(Equal(map[string]string{
+								"/sys/fs/cgroup/memory/" + containerID + "/memory.limit_in_bytes": "1048576",
+							}))
+						})
+					})
+					Context("cgroup v2 is mounted", func() {
+						BeforeEach(func() {
+							cgroups.unified = true
+						})
+						It("should write the limit to the unified hierarchy", func() {
+							Expect(err).NotTo(HaveOccurred())
+							Expect(cgroups.written).To(Equal(map[string]string{
+								"/sys/fs/cgroup/" + containerID + "/memory.max": "1048576",
+							}))
+						})
+					})
+				})
+				Context("the memory limit is removed on cgroup v2", func() {
+					BeforeEach(func() {
+						cgroups.unified = true
+						request = prot.ResourceModificationRequestResponse{
+							ResourceType: prot.PtMemory,
+							RequestType:  prot.RtUpdate,
+							Settings:     &prot.MemoryLimit{},
+						}
+					})
+					It("should write max", func() {
+						Expect(err).NotTo(HaveOccurred())
+						Expect(cgroups.written["/sys/fs/cgroup/"+containerID+"/memory.max"]).To(Equal("max"))
+					})
+				})
+				Context("the CPU limit is updated", func() {
+					BeforeEach(func() {
+						request = prot.ResourceModificationRequestResponse{
+							ResourceType: prot.PtCPULimit,
+							RequestType:  prot.RtUpdate,
+							Settings:     &prot.CPULimit{Quota: 50000, Period: 100000},
+						}
+					})
+					Context("cgroup v1 is mounted", func() {
+						It("should write the period and quota to the cpu controller", func() {
+							Expect(err).NotTo(HaveOccurred())
+							Expect(cgroups.written).To(Equal(map[string]string{
+								"/sys/fs/cgroup/cpu/" + containerID + "/cpu.cfs_period_us": "100000",
+								"/sys/fs/cgroup/cpu/" + containerID + "/cpu.cfs_quota_us":  "50000",
+							}))
+						})
+					})
+					Context("cgroup v2 is mounted", func() {
+						BeforeEach(func() {
+							cgroups.unified = true
+						})
+						It("should write cpu.max in the unified hierarchy", func() {
+							Expect(err).NotTo(HaveOccurred())
+							Expect(cgroups.written).To(Equal(map[string]string{
+								"/sys/fs/cgroup/" + containerID + "/cpu.max": "50000 100000",
+							}))
+						})
+					})
+				})
+				Context("memory is reclaimed", func() {
+					BeforeEach(func() {
+						request = prot.ResourceModificationRequestResponse{
+							ResourceType: prot.PtMemory,
+							RequestType:  prot.RtUpdate,
+							Settings:     &prot.MemoryLimit{LimitInBytes: 1, Reclaim: true},
+						}
+					})
+					It("should drop caches without changing the limit", func() {
+						Expect(err).NotTo(HaveOccurred())
+						Expect(cgroups.written).To(Equal(map[string]string{
+							"/proc/sys/vm/drop_caches": "3",
+						}))
+					})
+					Context("the container's cgroup is also emptied", func() {
+						BeforeEach(func() {
+							request.Settings = &prot.MemoryLimit{Reclaim: true, ForceEmpty: true}
+						})
+						Context("cgroup v1 is mounted", func() {
+							It("should write memory.force_empty", func() {
+								Expect(err).NotTo(HaveOccurred())
+								Expect(cgroups.written).To(Equal(map[string]string{
+									"/proc/sys/vm/drop_caches":                                     "3",
+									"/sys/fs/cgroup/memory/" + containerID + "/memory.force_empty": "0",
+								}))
+							})
+						})
+						Context("cgroup v2 is mounted", func() {
+							BeforeEach(func() {
+								cgroups.unified = true
+							})
+							It("should produce a not implemented error", func() {
+								Expect(err).To(HaveOccurred())
+								hresult, herr := gcserr.GetHresult(err)
+								Expect(herr).NotTo(HaveOccurred())
+								Expect(hresult).To(Equal(gcserr.HrNotImpl))
+							})
+						})
+					})
+					Context("dropping caches is not permitted", func() {
+						BeforeEach(func() {
+							cgroups.denied = true
+						})
+						It("should produce an access denied error", func() {
+							Expect(err).To(HaveOccurred())
+							hresult, herr := gcserr.GetHresult(err)
+							Expect(herr).NotTo(HaveOccurred())
+							Expect(hresult).To(Equal(gcserr.HrAccessDenied))
+						})
+					})
+					Context("ForceEmpty is given without Reclaim", func() {
+						BeforeEach(func() {
+							request.Settings = &prot.MemoryLimit{ForceEmpty: true}
+						})
+						It("should produce an invalid argument error", func() {
+							Expect(err).To(HaveOccurred())
+							hresult, herr := gcserr.GetHresult(err)
+							Expect(herr).NotTo(HaveOccurred())
+							Expect(hresult).To(Equal(gcserr.HrInvalidArg))
+							Expect(cgroups.written).To(BeEmpty())
+						})
+					})
+				})
+				Context("the process limit is updated", func() {
+					BeforeEach(func() {
+						request = prot.ResourceModificationRequestResponse{
+							ResourceType: prot.PtPids,
+							RequestType:  prot.RtUpdate,
+							Settings:     &prot.PidsLimit{Limit: 256},
+						}
+					})
+					Context("cgroup v1 is mounted", func() {
+						It("should write the limit to the pids controller", func() {
+							Expect(err).NotTo(HaveOccurred())
+							Expect(cgroups.written).To(Equal(map[string]string{
+								"/sys/fs/cgroup/pids/" + containerID + "/pids.max": "256",
+							}))
+						})
+					})
+					Context("cgroup v2 is mounted", func() {
+						BeforeEach(func() {
+							cgroups.unified = true
+						})
+						It("should write pids.max in the unified hierarchy", func() {
+							Expect(err).NotTo(HaveOccurred())
+							Expect(cgroups.written).To(Equal(map[string]string{
+								"/sys/fs/cgroup/" + containerID + "/pids.max": "256",
+							}))
+						})
+					})
+				})
+				Context("the process limit is not positive", func() {
+					BeforeEach(func() {
+						request = prot.ResourceModificationRequestResponse{
+							ResourceType: prot.PtPids,
+							RequestType:  prot.RtUpdate,
+							Settings:     &prot.PidsLimit{},
+						}
+					})
+					It("should produce an invalid argument error", func() {
+						Expect(err).To(HaveOccurred())
+						hresult, herr := gcserr.GetHresult(err)
+						Expect(herr).NotTo(HaveOccurred())
+						Expect(hresult).To(Equal(gcserr.HrInvalidArg))
+						Expect(cgroups.written).To(BeEmpty())
+					})
+				})
+				Context("the request type is not an update", func() {
+					BeforeEach(func() {
+						request = prot.ResourceModificationRequestResponse{
+							ResourceType: prot.PtMemory,
+							RequestType:  prot.RtAdd,
+							Settings:     &prot.MemoryLimit{LimitInBytes: 1},
+						}
+					})
+					It("should produce an error", func() {
+						Expect(err).To(HaveOccurred())
+						Expect(cgroups.written).To(BeEmpty())
+					})
+				})
+			})
+			Describe("gating container start on a readiness file", func() {
+				var (
+					readiness *readinessOS
+					pid       int
+				)
+				BeforeEach(func() {
+					readiness = &readinessOS{OS: coreint.OS, name: "ready"}
+					coreint.OS = readiness
+					createSettings.ReadinessFile = "/run/ready"
+					createSettings.ReadinessTimeoutMs = 5000
+				})
+				JustBeforeEach(func() {
+					Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+					pid, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+				})
+				Context("the readiness file appears late", func() {
+					BeforeEach(func() {
+						readiness.missingChecks = 3
+					})
+					It("should complete once the file exists", func() {
+						Expect(err).NotTo(HaveOccurred())
+						Expect(pid).NotTo(Equal(-1))
+						Expect(readiness.checks).To(Equal(4))
+						_, _, _, rootfsPath := coreint.getUnioningPaths(containerID)
+						Expect(readiness.path).To(Equal(filepath.Join(rootfsPath, "run", "ready")))
+					})
+				})
+				Context("the readiness file never appears", func() {
+					var rtime *termIgnoringRuntime
+					BeforeEach(func() {
+						readiness.missingChecks = -1
+						createSettings.ReadinessTimeoutMs = 1
+						rtime = &termIgnoringRuntime{Runtime: coreint.Rtime}
+						coreint.Rtime = rtime
+					})
+					It("should time out", func() {
+						Expect(err).To(HaveOccurred())
+						Expect(err.Error()).To(ContainSubstring("timed out"))
+					})
+					It("should kill the init process", func() {
+						Expect(rtime.sentSignals()).NotTo(BeEmpty())
+						Expect(rtime.sentSignals()[0]).To(Equal(oslayer.SIGKILL))
+					})
+				})
+			})
+			Describe("applying mount settings to a container's configuration", func() {
+				var (
+					settings containerMountSettings
+					config   oci.Spec
+					result   oci.Spec
+				)
+				BeforeEach(func() {
+					createSettings.Mounts = []prot.Mount{
+						{Destination: "/sys", Type: "sysfs", Source: "sysfs", Options: []string{"ro", "nosuid"}},
+						{Destination: "/extra", Type: "tmpfs", Source: "tmpfs"},
+					}
+					createSettings.MaskedPaths = []string{"/proc/kcore", "/proc/keys"}
+					createSettings.ReadonlyPaths = []string{"/proc/sys"}
+					config = oci.Spec{
+						Mounts: []oci.Mount{
+							{Destination: "/proc", Type: "proc", Source: "proc"},
+							{Destination: "/sys/", Type: "sysfs", Source: "sysfs"},
+						},
+						Linux: &oci.Linux{MaskedPaths: []string{"/proc/kcore"}},
+					}
+				})
+				JustBeforeEach(func() {
+					settings, err = newContainerMountSettings(createSettings)
+					result = settings.apply(config)
+				})
+				It("should replace mounts with the same destination and add new ones", func() {
+					Expect(err).NotTo(HaveOccurred())
+					Expect(result.Mounts).To(Equal([]oci.Mount{
+						{Destination: "/proc", Type: "proc", Source: "proc"},
+						{Destination: "/sys", Type: "sysfs", Source: "sysfs", Options: []string{"ro", "nosuid"}},
+						{Destination: "/extra", Type: "tmpfs", Source: "tmpfs"},
+					}))
+				})
+				It("should add the masked and read-only paths", func() {
+					Expect(err).NotTo(HaveOccurred())
+					Expect(result.Linux.MaskedPaths).To(Equal([]string{"/proc/kcore", "/proc/keys"}))
+					Expect(result.Linux.ReadonlyPaths).To(Equal([]string{"/proc/sys"}))
+				})
+				It("should not modify the original configuration", func() {
+					Expect(config.Mounts).To(HaveLen(2))
+					Expect(config.Linux.MaskedPaths).To(Equal([]string{"/proc/kcore"}))
+					Expect(config.Linux.ReadonlyPaths).To(BeEmpty())
+				})
+				Context("the configuration has no Linux section", func() {
+					BeforeEach(func() {
+						config.Linux = nil
+					})
+					It("should create one", func() {
+						Expect(result.Linux).NotTo(BeNil())
+						Expect(result.Linux.MaskedPaths).To(Equal([]string{"/proc/kcore", "/proc/keys"}))
+					})
+				})
+				Context("no mount settings are given", func() {
+					BeforeEach(func() {
+						createSettings.Mounts = nil
+						createSettings.MaskedPaths = nil
+						createSettings.ReadonlyPaths = nil
+					})
+					It("should leave the configuration unchanged", func() {
+						Expect(result).To(Equal(config))
+					})
+				})
+				Context("a masked path is relative", func() {
+					BeforeEach(func() {
+						createSettings.MaskedPaths = []string{"proc/kcore"}
+					})
+					It("should be rejected by CreateContainer", func() {
+						Expect(err).To(HaveOccurred())
+						Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).NotTo(Succeed())
+					})
+				})
+			})
+			Describe("calling ShutdownContainer", func() {
+				var (
+					rtime       *termIgnoringRuntime
+					signal      oslayer.Signal
+					gracePeriod time.Duration
+				)
+				BeforeEach(func() {
+					signal = oslayer.SIGTERM
+					rtime = &termIgnoringRuntime{Runtime: coreint.Rtime}
+					coreint.Rtime = rtime
+					Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+					_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+					Expect(err).NotTo(HaveOccurred())
+				})
+				JustBeforeEach(func() {
+					err = coreint.ShutdownContainer(containerID, signal, gracePeriod)
+				})
+				Context("the init process ignores SIGTERM and a grace period is given", func() {
+					BeforeEach(func() {
+						gracePeriod = 10 * time.Millisecond
+					})
+					It("should send SIGKILL after the grace period", func() {
+						Expect(err).NotTo(HaveOccurred())
+						Eventually(rtime.sentSignals).Should(ContainElement(oslayer.SIGKILL))
+						Expect(rtime.sentSignals()[:2]).To(Equal([]oslayer.Signal{oslayer.SIGTERM, oslayer.SIGKILL}))
+					})
+				})
+				Context("SIGQUIT is given as the signal", func() {
+					BeforeEach(func() {
+						signal = oslayer.Signal(syscall.SIGQUIT)
+						gracePeriod = 0
+					})
+					It("should send SIGQUIT rather than SIGTERM", func() {
+						Expect(err).NotTo(HaveOccurred())
+						Expect(rtime.sentSignals()).NotTo(BeEmpty())
+						Expect(rtime.sentSignals()[0]).To(Equal(oslayer.Signal(syscall.SIGQUIT)))
+						Expect(rtime.sentSignals()).NotTo(ContainElement(oslayer.SIGTERM))
+					})
+				})
+				Context("the init process ignores SIGTERM and no grace period is given", func() {
+					BeforeEach(func() {
+						gracePeriod = 0
+					})
+					It("should only send SIGTERM", func() {
+						Expect(err).NotTo(HaveOccurred())
+						Consistently(rtime.sentSignals, 50*time.Millisecond).Should(Equal([]oslayer.Signal{oslayer.SIGTERM}))
+						Expect(coreint.SignalContainer(containerID, oslayer.SIGKILL)).To(Succeed())
+					})
+				})
+				Context("the container does not exist", func() {
+					BeforeEach(func() {
+						gracePeriod = 10 * time.Millisecond
+						containerID = "nonexistent"
+					})
+					It("should fail", func() {
+						Expect(err).To(HaveOccurred())
+					})
+				})
+			})
+			Describe("creating a container with an OCI specification", func() {
+				var recorder *configRecordingOS
+				BeforeEach(func() {
+					recorder = &configRecordingOS{OS: coreint.OS, written: make(map[string]string)}
+					coreint.OS = recorder
+					createSettings.OCISpecJSON = `{"ociVersion":"1.0.0","hostname":"passthrough","process":{"args":["/sbin/init"],"cwd":"/"}}`
+				})
+				JustBeforeEach(func() {
+					err = coreint.CreateContainer(context.Background(), containerID, createSettings)
+				})
+				It("should use the specification as the container's configuration", func() {
+					Expect(err).NotTo(HaveOccurred())
+					_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+					Expect(err).NotTo(HaveOccurred())
+					var config oci.Spec
+					Expect(json.Unmarshal([]byte(recorder.written[coreint.getConfigPath(containerID)]), &config)).To(Succeed())
+					Expect(config.Hostname).To(Equal("passthrough"))
+					Expect(config.Process.Args).To(Equal([]string{"/sbin/init"}))
+				})
+				Context("the specification is not valid JSON", func() {
+					BeforeEach(func() {
+						createSettings.OCISpecJSON = `{"ociVersion":`
+					})
+					It("should fail with an invalid argument error", func() {
+						Expect(err).To(HaveOccurred())
+						hresult, herr := gcserr.GetHresult(err)
+						Expect(herr).NotTo(HaveOccurred())
+						Expect(hresult).To(Equal(gcserr.HrInvalidArg))
+					})
+				})
+				Context("the specification has no OCI version", func() {
+					BeforeEach(func() {
+						createSettings.OCISpecJSON = `{"hostname":"passthrough"}`
+					})
+					It("should fail", func() {
+						Expect(err).To(HaveOccurred())
+					})
+				})
+			})
+			Describe("starting a container which joins another container's namespaces", func() {
+				var (
+					recorder *configRecordingOS
+					sidecar  string
+					params   prot.ProcessParameters
+				)
+				BeforeEach(func() {
+					recorder = &configRecordingOS{OS: coreint.OS, written: make(map[string]string)}
+					coreint.OS = recorder
+					sidecar = containerID + "-sidecar"
+					Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+					Expect(coreint.CreateContainer(context.Background(), sidecar, createSettings)).To(Succeed())
+					params = initialExecParams
+					params.JoinContainerID = containerID
+					params.OCISpecification.Linux = &oci.Linux{
+						Namespaces: []oci.LinuxNamespace{
+							{Type: oci.NetworkNamespace},
+							{Type: oci.MountNamespace},
+						},
+					}
+				})
+				Context("the target container is running", func() {
+					BeforeEach(func() {
+						_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+						Expect(err).NotTo(HaveOccurred())
+					})
+					It("should join the target's network and PID namespaces", func() {
+						_, err = coreint.ExecProcess(sidecar, params, fullStdioSet)
+						Expect(err).NotTo(HaveOccurred())
+						var config oci.Spec
+						Expect(json.Unmarshal([]byte(recorder.written[coreint.getConfigPath(sidecar)]), &config)).To(Succeed())
+						Expect(config.Linux.Namespaces).To(Equal([]oci.LinuxNamespace{
+							{Type: oci.MountNamespace},
+							{Type: oci.NetworkNamespace, Path: "/proc/101/ns/net"},
+							{Type: oci.PIDNamespace, Path: "/proc/101/ns/pid"},
+						}))
+					})
+					Context("a process other than init joins them", func() {
+						var argvOS *argvRecordingOS
+						BeforeEach(func() {
+							_, err = coreint.ExecProcess(sidecar, initialExecParams, fullStdioSet)
+							Expect(err).NotTo(HaveOccurred())
+							argvOS = &argvRecordingOS{OS: coreint.OS}
+							coreint.OS = argvOS
+							params = nonInitialExecParams
+							params.JoinContainerID = containerID
+							params.CommandArgs = []string{"/bin/sh", "-c", "ip addr"}
+							params.WorkingDirectory = "/../work"
+						})
+						It("should run it in the target's network, PID and mount namespaces", func() {
+							_, err = coreint.ExecProcess(sidecar, params, fullStdioSet)
+							Expect(err).NotTo(HaveOccurred())
+							Expect(argvOS.argv).To(Equal([][]string{{
+								"nsenter",
+								"--uts=/proc/101/ns/uts",
+								"--ipc=/proc/101/ns/ipc",
+								"--net=/proc/101/ns/net",
+								"--pid=/proc/101/ns/pid",
+								"--mount=/proc/101/ns/mnt",
+								"--root=/proc/101/root",
+								"--wd=/proc/101/root/work",
+								"--",
+								"/bin/sh", "-c", "ip addr",
+							}}))
+						})
+						Context("the target container has exited", func() {
+							BeforeEach(func() {
+								coreint.containerCache[containerID].container = nil
+							})
+							It("should fail", func() {
+								_, err = coreint.ExecProcess(sidecar, params, fullStdioSet)
+								Expect(err).To(HaveOccurred())
+								Expect(argvOS.argv).To(BeEmpty())
+							})
+						})
+					})
+				})
+				Context("the target container has not been started", func() {
+					It("should fail and leave the container startable", func() {
+						_, err = coreint.ExecProcess(sidecar, params, fullStdioSet)
+						Expect(err).To(HaveOccurred())
+						_, err = coreint.ExecProcess(sidecar, initialExecParams, fullStdioSet)
+						Expect(err).NotTo(HaveOccurred())
+					})
+				})
+				Context("the target container does not exist", func() {
+					BeforeEach(func() {
+						params.JoinContainerID = "nonexistent"
+					})
+					It("should fail", func() {
+						_, err = coreint.ExecProcess(sidecar, params, fullStdioSet)
+						Expect(err).To(HaveOccurred())
+					})
+				})
+			})
+			Describe("calling ListContainers", func() {
+				var (
+					containers []prot.ContainerInfo
+					secondID   string
+				)
+				BeforeEach(func() {
+					secondID = "ffffffff-89ab-cdef-0123-456789abcdef"
+					Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+					Expect(coreint.CreateContainer(context.Background(), secondID, createSettings)).To(Succeed())
+					_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+					Expect(err).NotTo(HaveOccurred())
+				})
+				JustBeforeEach(func() {
+					containers, err = coreint.ListContainers()
+				})
+				It("should list the created containers", func() {
+					Expect(err).NotTo(HaveOccurred())
+					Expect(containers).To(Equal([]prot.ContainerInfo{
+						{ID: containerID, State: "running", InitPid: 101},
+						{ID: secondID, State: "created"},
+					}))
+				})
+			})
+			Describe("calling GetContainerState", func() {
+				var status prot.ContainerStatus
+				JustBeforeEach(func() {
+					status, err = coreint.GetContainerState(containerID)
+				})
+				Context("the container has not been created", func() {
+					It("should produce an error", func() {
+						Expect(err).To(HaveOccurred())
+					})
+				})
+				Context("the container's init process has not been started", func() {
+					BeforeEach(func() {
+						Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+					})
+					It("should report the container as created", func() {
+						Expect(err).NotTo(HaveOccurred())
+						Expect(status).To(Equal(prot.ContainerStatus{State: prot.CsCreated, ExitCode: -1}))
+					})
+				})
+				Context("the container's init process is running", func() {
+					BeforeEach(func() {
+						Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+						_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+						Expect(err).NotTo(HaveOccurred())
+					})
+					It("should report the container as running with its init pid", func() {
+						Expect(err).NotTo(HaveOccurred())
+						Expect(status).To(Equal(prot.ContainerStatus{State: prot.CsRunning, InitPid: 101, ExitCode: -1}))
+					})
+				})
+			})
+			Describe("calling AttachProcess", func() {
+				BeforeEach(func() {
+					Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+				})
+				Context("the process does not exist", func() {
+					It("should produce an error", func() {
+						err = coreint.AttachProcess(containerID, 12345, &stdio.ConnectionSet{})
+						Expect(err).To(HaveOccurred())
+					})
+				})
+				Context("the process has no retained stdio pipes", func() {
+					It("should produce an invalid argument error", func() {
+						pid, err := coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+						Expect(err).NotTo(HaveOccurred())
+						err = coreint.AttachProcess(containerID, pid, &stdio.ConnectionSet{})
+						Expect(err).To(HaveOccurred())
+						hresult, herr := gcserr.GetHresult(err)
+						Expect(herr).NotTo(HaveOccurred())
+						Expect(hresult).To(Equal(gcserr.HrInvalidArg))
+					})
+				})
+				Context("the process belongs to a different container", func() {
+					It("should produce an error", func() {
+						pid, err := coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+						Expect(err).NotTo(HaveOccurred())
+						err = coreint.AttachProcess("other", pid, &stdio.ConnectionSet{})
+						Expect(err).To(HaveOccurred())
+					})
+				})
+			})
+			Describe("mounting a disk on flaky storage", func() {
+				var (
+					flaky *flakyMountOS
+					ms    *mountSpec
+				)
+				BeforeEach(func() {
+					flaky = &flakyMountOS{OS: coreint.OS}
+					ms = &mountSpec{Source: "/dev/sda", FileSystem: defaultFileSystem}
+				})
+				Context("the first mount fails with EIO", func() {
+					It("should retry the mount and succeed", func() {
+						flaky.mountErrors = []error{syscall.EIO}
+						err := ms.Mount(flaky, "/mnt/disk")
+						Expect(err).NotTo(HaveOccurred())
+						Expect(flaky.mounts).To(Equal(2))
+					})
+				})
+				Context("every mount fails with EIO", func() {
+					It("should give up after MountIOAttempts attempts", func() {
+						flaky.mountErrors = []error{syscall.EIO, syscall.EIO, syscall.EIO, syscall.EIO}
+						err := ms.Mount(flaky, "/mnt/disk")
+						Expect(err).To(HaveOccurred())
+						Expect(flaky.mounts).To(Equal(MountIOAttempts))
+					})
+				})
+				Context("the mount fails with EINVAL", func() {
+					It("should not retry the mount", func() {
+						flaky.mountErrors = []error{syscall.EINVAL}
+						err := ms.Mount(flaky, "/mnt/disk")
+						Expect(err).To(HaveOccurred())
+						Expect(flaky.mounts).To(Equal(1))
+					})
+				})
+			})
+			Describe("reaping a container process", func() {
+				var (
+					in, out, errConn *closeRecordingConnection
+				)
+				BeforeEach(func() {
+					coreint.Rtime = &exitingRuntime{Runtime: coreint.Rtime}
+					Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+					_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+					Expect(err).NotTo(HaveOccurred())
+					in = &closeRecordingConnection{Connection: mockos.NewMockReadWriteCloser()}
+					out = &closeRecordingConnection{Connection: mockos.NewMockReadWriteCloser()}
+					errConn = &closeRecordingConnection{Connection: mockos.NewMockReadWriteCloser()}
+				})
+				It("should half-close and close the process's stdio connections", func() {
+					pid, err := coreint.ExecProcess(containerID, prot.ProcessParameters{CommandLine: "sh"}, &stdio.ConnectionSet{In: in, Out: out, Err: errConn})
+					Expect(err).NotTo(HaveOccurred())
+					_, err = coreint.WaitProcess(pid)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(in.ops()).To(Equal([]string{"CloseRead", "Close"}))
+					Expect(out.ops()).To(Equal([]string{"CloseWrite", "Close"}))
+					Expect(errConn.ops()).To(Equal([]string{"CloseWrite", "Close"}))
+				})
+			})
+			Describe("creating a container with a sandbox filesystem", func() {
+				var (
+					recorder *commandRecordingOS
+				)
+				BeforeEach(func() {
+					recorder = &commandRecordingOS{OS: coreint.OS}
+					coreint.OS = recorder
+				})
+				for filesystem, expected := range map[string]string{
+					"ext4":  "mkfs.ext4 -F -q",
+					"xfs":   "mkfs.xfs -f -q",
+					"btrfs": "mkfs.btrfs -f -q",
+				} {
+					filesystem, expected := filesystem, expected
+					Context("the filesystem is "+filesystem, func() {
+						It("should format the sandbox device with "+expected, func() {
+							createSettings.SandboxFilesystem = filesystem
+							Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+							Expect(recorder.commands).To(ContainElement(HavePrefix(expected + " ")))
+						})
+					})
+				}
+				Context("the filesystem is unset", func() {
+					It("should not format the sandbox device", func() {
+						Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+						for _, command := range recorder.commands {
+							Expect(command).NotTo(HavePrefix("mkfs"))
+						}
+					})
+				})
+				Context("the filesystem is unsupported", func() {
+					It("should produce an invalid argument error", func() {
+						createSettings.SandboxFilesystem = "ntfs"
+						err := coreint.CreateContainer(context.Background(), containerID, createSettings)
+						Expect(err).To(HaveOccurred())
+						hresult, herr := gcserr.GetHresult(err)
+						Expect(herr).NotTo(HaveOccurred())
+						Expect(hresult).To(Equal(gcserr.HrInvalidArg))
+						Expect(recorder.commands).To(BeEmpty())
+					})
+				})
+			})
+			Describe("creating a container with sandbox discard", func() {
+				var (
+					mounts      *mountDataRecordingOS
+					commands    *commandRecordingOS
+					scratchPath string
+				)
+				BeforeEach(func() {
+					mounts = &mountDataRecordingOS{OS: coreint.OS, data: make(map[string]string)}
+					commands = &commandRecordingOS{OS: mounts}
+					coreint.OS = commands
+					_, scratchPath, _, _ = coreint.getUnioningPaths(containerID)
+				})
+				Context("discard is enabled", func() {
+					BeforeEach(func() {
+						createSettings.SandboxDiscard = true
+						Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+					})
+					It("should mount the sandbox with the discard option", func() {
+						Expect(strings.Split(mounts.data[scratchPath], ",")).To(ContainElement("discard"))
+					})
+					It("should trim the sandbox when the container is deleted", func() {
+						Expect(commands.commands).NotTo(ContainElement("fstrim " + scratchPath))
+						entry := coreint.getContainer(containerID)
+						entry.container = &deletedContainer{}
+						Expect(coreint.cleanupContainer(entry)).To(Succeed())
+						Expect(commands.commands).To(ContainElement("fstrim " + scratchPath))
+					})
+				})
+				Context("discard is not enabled", func() {
+					BeforeEach(func() {
+						Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+					})
+					It("should not mount the sandbox with the discard option", func() {
+						Expect(strings.Split(mounts.data[scratchPath], ",")).NotTo(ContainElement("discard"))
+					})
+					It("should not trim the sandbox when the container is deleted", func() {
+						entry := coreint.getContainer(containerID)
+						entry.container = &deletedContainer{}
+						Expect(coreint.cleanupContainer(entry)).To(Succeed())
+						Expect(commands.commands).NotTo(ContainElement("fstrim " + scratchPath))
+					})
+				})
+			})
+			Describe("calling GetMounts", func() {
+				var (
+					table *mountTableOS
+				)
+				BeforeEach(func() {
+					table = &mountTableOS{OS: coreint.OS}
+					coreint.OS = table
+				})
+				Context("the container does not exist", func() {
+					It("should produce an error", func() {
+						_, err := coreint.GetMounts(containerID)
+						Expect(err).To(HaveOccurred())
+					})
+				})
+				Context("a mapped virtual disk has been added", func() {
+					It("should report the container's mounts", func() {
+						Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+						disk := prot.MappedVirtualDisk{ContainerPath: "/mnt/added", Lun: 6, CreateInUtilityVM: true}
+						Expect(coreint.ModifySettings(context.Background(), containerID, prot.ResourceModificationRequestResponse{
+							ResourceType: prot.PtMappedVirtualDisk,
+							RequestType:  prot.RtAdd,
+							Settings:     &disk,
+						})).To(Succeed())
+						_, scratchPath, _, _ := coreint.getUnioningPaths(containerID)
+						table.contents = "/dev/sda " + scratchPath + " ext4 rw,relatime 0 0\n" +
+							"/dev/sdb /mnt/added ext4 rw 0 0\n" +
+							"/dev/sdc /mnt/other\\040disk ext4 ro 0 0\n" +
+							"proc /proc proc rw,nosuid 0 0\n"
+
+						mounts, err := coreint.GetMounts(containerID)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(mounts).To(Equal([]prot.MountInfo{
+							{Source: "/dev/sda", Target: scratchPath, FileSystem: "ext4", Options: []string{"rw", "relatime"}},
+							{Source: "/dev/sdb", Target: "/mnt/added", FileSystem: "ext4", Options: []string{"rw"}},
+						}))
+					})
+				})
+			})
+			Describe("parsing a mount table", func() {
+				It("should unescape paths", func() {
+					mounts, err := parseMountTable(strings.NewReader("/dev/sdc /mnt/a\\040b\\134c ext4 ro 0 0\n"))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(mounts).To(HaveLen(1))
+					Expect(mounts[0].Target).To(Equal(`/mnt/a b\c`))
+				})
+			})
+			Describe("hot removing a mapped virtual disk", func() {
+				var (
+					recorder *hotRemoveOS
+					disk     prot.MappedVirtualDisk
+					request  prot.ResourceModificationRequestResponse
+				)
+				BeforeEach(func() {
+					recorder = &hotRemoveOS{OS: coreint.OS}
+					Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+					disk = prot.MappedVirtualDisk{ContainerPath: "/mnt/removed", Controller: 1, Lun: 7, CreateInUtilityVM: true}
+					Expect(coreint.ModifySettings(context.Background(), containerID, prot.ResourceModificationRequestResponse{
+						ResourceType: prot.PtMappedVirtualDisk,
+						RequestType:  prot.RtAdd,
+						Settings:     &disk,
+					})).To(Succeed())
+					coreint.OS = recorder
+					request = prot.ResourceModificationRequestResponse{
+						ResourceType: prot.PtMappedVirtualDisk,
+						RequestType:  prot.RtRemove,
+						Settings:     &prot.MappedVirtualDisk{Lun: 7},
+					}
+				})
+				Context("the disk is not in use", func() {
+					It("should sync and unmount the disk, then delete its SCSI device", func() {
+						Expect(coreint.ModifySettings(context.Background(), containerID, request)).To(Succeed())
+						Expect(recorder.ops).To(Equal([]string{
+							"syncfs /mnt/removed",
+							"unmount /mnt/removed",
+							"open /sys/bus/scsi/devices/1:0:0:7/delete",
+						}))
+						Expect(coreint.containerCache[containerID].MappedVirtualDisks).NotTo(HaveKey(uint8(7)))
+					})
+				})
+				Context("the disk is in use", func() {
+					It("should produce a busy error and keep the disk attached", func() {
+						recorder.unmountErr = syscall.EBUSY
+						err := coreint.ModifySettings(context.Background(), containerID, request)
+						Expect(err).To(HaveOccurred())
+						hresult, herr := gcserr.GetHresult(err)
+						Expect(herr).NotTo(HaveOccurred())
+						Expect(hresult).To(Equal(gcserr.HrBusy))
+						Expect(recorder.ops).To(Equal([]string{
+							"syncfs /mnt/removed",
+							"unmount /mnt/removed",
+						}))
+						Expect(coreint.containerCache[containerID].MappedVirtualDisks).To(HaveKey(uint8(7)))
+					})
+				})
+			})
+			Describe("calling DeleteContainer", func() {
+				JustBeforeEach(func() {
+					err = coreint.DeleteContainer(containerID)
+				})
+				Context("the container has not been created", func() {
+					It("should produce an error", func() {
+						Expect(err).To(HaveOccurred())
+					})
+				})
+				Context("the container's init process has not been started", func() {
+					var waitErr chan error
+					BeforeEach(func() {
+						Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+						waitErr = make(chan error, 1)
+						go func() {
+							_, err := coreint.WaitContainer(containerID)
+							waitErr <- err
+						}()
+						// Give the wait time to block on the container.
+						Consistently(waitErr, "50ms").ShouldNot(Receive())
+					})
+					It("should stop the wait with a cancellation error", func() {
+						Expect(err).NotTo(HaveOccurred())
+						var werr error
+						Eventually(waitErr).Should(Receive(&werr))
+						Expect(errors.Cause(werr)).To(Equal(context.Canceled))
+					})
+					It("should remove the container", func() {
+						Expect(err).NotTo(HaveOccurred())
+						Expect(coreint.getContainer(containerID)).To(BeNil())
+					})
+				})
+				Context("the container's init process is running", func() {
+					BeforeEach(func() {
+						Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+						_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+						Expect(err).NotTo(HaveOccurred())
+					})
+					It("should produce an error", func() {
+						Expect(err).To(HaveOccurred())
+						Expect(coreint.getContainer(containerID)).NotTo(BeNil())
+					})
+				})
+			})
+			Describe("running a process with a private mount namespace", func() {
+				var recordingOS *unshareRecordingOS
+				BeforeEach(func() {
+					recordingOS = &unshareRecordingOS{OS: coreint.OS}
+					coreint.OS = recordingOS
+					externalParams.PrivateMountNamespace = true
+				})
+				Context("the process is external", func() {
+					JustBeforeEach(func() {
+						_, err = coreint.RunExternalProcess(externalParams, fullStdioSet)
+					})
+					It("should unshare the mount namespace for the process", func() {
+						Expect(err).NotTo(HaveOccurred())
+						Expect(recordingOS.flags).To(Equal([]uintptr{syscall.CLONE_NEWNS}))
+					})
+					Context("the kernel does not support mount namespaces", func() {
+						BeforeEach(func() {
+							recordingOS.noMountNamespaces = true
+						})
+						It("should fail with a not implemented error", func() {
+							Expect(err).To(HaveOccurred())
+							hresult, herr := gcserr.GetHresult(err)
+							Expect(herr).NotTo(HaveOccurred())
+							Expect(hresult).To(Equal(gcserr.HrNotImpl))
+							Expect(recordingOS.flags).To(BeEmpty())
+						})
+					})
+					Context("the private mount namespace is not requested", func() {
+						BeforeEach(func() {
+							externalParams.PrivateMountNamespace = false
+						})
+						It("should not unshare any namespaces", func() {
+							Expect(err).NotTo(HaveOccurred())
+							Expect(recordingOS.flags).To(BeEmpty())
+						})
+					})
+				})
+				Context("the process is in a container", func() {
+					var recordingRuntime *execRecordingRuntime
+					BeforeEach(func() {
+						recordingRuntime = &execRecordingRuntime{Runtime: coreint.Rtime}
+						coreint.Rtime = recordingRuntime
+						Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+						_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+						Expect(err).NotTo(HaveOccurred())
+					})
+					It("should run the process under unshare in the container", func() {
+						params := nonInitialExecParams
+						params.PrivateMountNamespace = true
+						params.CommandArgs = []string{"/bin/mount", "-a"}
+						_, err = coreint.ExecProcess(containerID, params, fullStdioSet)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(recordingRuntime.execArgs()).To(Equal([][]string{
+							{"unshare", "--mount", "--propagation", "private", "--", "/bin/mount", "-a"},
+						}))
+					})
+					Context("the kernel does not support mount namespaces", func() {
+						BeforeEach(func() {
+							recordingOS.noMountNamespaces = true
+						})
+						It("should fail with a not implemented error", func() {
+							params := nonInitialExecParams
+							params.PrivateMountNamespace = true
+							_, err = coreint.ExecProcess(containerID, params, fullStdioSet)
+							Expect(err).To(HaveOccurred())
+							hresult, herr := gcserr.GetHresult(err)
+							Expect(herr).NotTo(HaveOccurred())
+							Expect(hresult).To(Equal(gcserr.HrNotImpl))
+							Expect(recordingRuntime.execArgs()).To(BeEmpty())
+						})
+					})
+					Context("the private mount namespace is not requested", func() {
+						It("should run the process directly", func() {
+							params := nonInitialExecParams
+							params.CommandArgs = []string{"/bin/mount", "-a"}
+							_, err = coreint.ExecProcess(containerID, params, fullStdioSet)
+							Expect(err).NotTo(HaveOccurred())
+							Expect(recordingRuntime.execArgs()).To(Equal([][]string{{"/bin/mount", "-a"}}))
+						})
+					})
+				})
+				Context("the process is a container's init process", func() {
+					It("should fail with an invalid argument error", func() {
+						Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+						params := initialExecParams
+						params.PrivateMountNamespace = true
+						_, err = coreint.ExecProcess(containerID, params, fullStdioSet)
+						Expect(err).To(HaveOccurred())
+						hresult, herr := gcserr.GetHresult(err)
+						Expect(herr).NotTo(HaveOccurred())
+						Expect(hresult).To(Equal(gcserr.HrInvalidArg))
+					})
+				})
+			})
+			Describe("creating a container with a hostname and hosts entries", func() {
+				var recorder *configRecordingOS
+				BeforeEach(func() {
+					recorder = &configRecordingOS{OS: coreint.OS, written: make(map[string]string)}
+					coreint.OS = recorder
+					createSettings.Hostname = "web-1"
+					createSettings.HostsEntries = []prot.HostsEntry{
+						{IP: "127.0.0.1", Hostnames: []string{"localhost"}},
+						{IP: "10.0.0.5", Hostnames: []string{"db", "db.internal"}},
+						{IP: "fe80::1", Hostnames: []string{"gateway"}},
+					}
+				})
+				JustBeforeEach(func() {
+					err = coreint.CreateContainer(context.Background(), containerID, createSettings)
+				})
+				It("should write the entries to the container's hosts file", func() {
+					Expect(err).NotTo(HaveOccurred())
+					_, _, _, rootfsPath := coreint.getUnioningPaths(containerID)
+					Expect(recorder.written[filepath.Join(rootfsPath, "etc", "hosts")]).To(Equal(
+						"127.0.0.1\tlocalhost\n" +
+							"10.0.0.5\tdb db.internal\n" +
+							"fe80::1\tgateway\n"))
+				})
+				It("should set the hostname in a private UTS namespace", func() {
+					Expect(err).NotTo(HaveOccurred())
+					_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+					Expect(err).NotTo(HaveOccurred())
+					var config oci.Spec
+					Expect(json.Unmarshal([]byte(recorder.written[coreint.getConfigPath(containerID)]), &config)).To(Succeed())
+					Expect(config.Hostname).To(Equal("web-1"))
+					Expect(config.Linux.Namespaces).To(ContainElement(oci.LinuxNamespace{Type: oci.UTSNamespace}))
+				})
+				Context("no hosts entries are given", func() {
+					BeforeEach(func() {
+						createSettings.HostsEntries = nil
+					})
+					It("should leave the image's hosts file alone", func() {
+						Expect(err).NotTo(HaveOccurred())
+						_, _, _, rootfsPath := coreint.getUnioningPaths(containerID)
+						Expect(recorder.written).NotTo(HaveKey(filepath.Join(rootfsPath, "etc", "hosts")))
+					})
+				})
+				Context("a hosts entry has an invalid IP address", func() {
+					BeforeEach(func() {
+						createSettings.HostsEntries = []prot.HostsEntry{{IP: "10.0.0", Hostnames: []string{"db"}}}
+					})
+					It("should fail with an invalid argument error", func() {
+						Expect(err).To(HaveOccurred())
+						hresult, herr := gcserr.GetHresult(err)
+						Expect(herr).NotTo(HaveOccurred())
+						Expect(hresult).To(Equal(gcserr.HrInvalidArg))
+					})
+				})
+				Context("the hostname contains whitespace", func() {
+					BeforeEach(func() {
+						createSettings.Hostname = "web 1"
+					})
+					It("should fail with an invalid argument error", func() {
+						Expect(err).To(HaveOccurred())
+						hresult, herr := gcserr.GetHresult(err)
+						Expect(herr).NotTo(HaveOccurred())
+						Expect(hresult).To(Equal(gcserr.HrInvalidArg))
+					})
+				})
+			})
+			Describe("listing processes whose stdio is relayed", func() {
+				var (
+					processes []runtime.ContainerProcessState
+					host      *transport.MockConnection
+					relay     *stdio.PipeRelay
+					files     *stdio.FileSet
+				)
+				BeforeEach(func() {
+					Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+					_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+					Expect(err).NotTo(HaveOccurred())
+
+					tport := &transport.MockTransport{Channel: make(chan *transport.MockConnection, 1)}
+					out, err := tport.Dial(0)
+					Expect(err).NotTo(HaveOccurred())
+					host = <-tport.Channel
+					relay, err = (&stdio.ConnectionSet{Out: out}).NewPipeRelay()
+					Expect(err).NotTo(HaveOccurred())
+					relay.Start()
+					files, _ = relay.Files()
+					_, err = files.Out.Write([]byte("hello world"))
+					Expect(err).NotTo(HaveOccurred())
+					buf := make([]byte, len("hello world"))
+					_, err = io.ReadFull(host, buf)
+					Expect(err).NotTo(HaveOccurred())
+
+					// The mock runtime lists a single process with PID 123.
+					processEntry := newProcessCacheEntry(containerID)
+					processEntry.Pipes = relay
+					coreint.processCache[123] = processEntry
+				})
+				AfterEach(func() {
+					files.Out.Close()
+					relay.Wait()
+					host.Close()
+				})
+				JustBeforeEach(func() {
+					processes, err = coreint.ListProcesses(containerID)
+				})
+				It("should report the bytes relayed for each stream", func() {
+					Expect(err).NotTo(HaveOccurred())
+					Expect(processes).To(HaveLen(1))
+					Expect(processes[0].StdioBytes).To(Equal(&stdio.RelayCounts{Stdout: uint64(len("hello world"))}))
+				})
+			})
+			Describe("creating a container with named network adapters", func() {
+				var recordingOS *commandRecordingOS
+				BeforeEach(func() {
+					recordingOS = &commandRecordingOS{OS: coreint.OS}
+					coreint.OS = recordingOS
+					first := createSettings.NetworkAdapters[0]
+					first.Name = "eth0"
+					second := first
+					second.AdapterInstanceID = "11111111-1111-1111-1111-111111111111"
+					second.Name = "backend"
+					createSettings.NetworkAdapters = []prot.NetworkAdapter{first, second}
+				})
+				JustBeforeEach(func() {
+					err = coreint.CreateContainer(context.Background(), containerID, createSettings)
+				})
+				It("should configure the adapters in order with their names", func() {
+					Expect(err).NotTo(HaveOccurred())
+					_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+					Expect(err).NotTo(HaveOccurred())
+					var netnscfg []string
+					for _, command := range recordingOS.commands {
+						if strings.HasPrefix(command, "netnscfg ") {
+							netnscfg = append(netnscfg, command)
+						}
+					}
+					Expect(netnscfg).To(HaveLen(2))
+					Expect(netnscfg[0]).To(ContainSubstring(`"Name":"eth0"`))
+					Expect(netnscfg[1]).To(ContainSubstring(`"Name":"backend"`))
+				})
+				Context("two adapters are given the same name", func() {
+					BeforeEach(func() {
+						createSettings.NetworkAdapters[1].Name = "eth0"
+					})
+					It("should fail with an invalid argument error", func() {
+						Expect(err).To(HaveOccurred())
+						hresult, herr := gcserr.GetHresult(err)
+						Expect(herr).NotTo(HaveOccurred())
+						Expect(hresult).To(Equal(gcserr.HrInvalidArg))
+					})
+				})
+				Context("an adapter is given an invalid name", func() {
+					BeforeEach(func() {
+						createSettings.NetworkAdapters[1].Name = "much-too-long-name"
+					})
+					It("should fail with an invalid argument error", func() {
+						Expect(err).To(HaveOccurred())
+						hresult, herr := gcserr.GetHresult(err)
+						Expect(herr).NotTo(HaveOccurred())
+						Expect(hresult).To(Equal(gcserr.HrInvalidArg))
+					})
+				})
+			})
+			Describe("creating a container with static routes", func() {
+				var recordingOS *commandRecordingOS
+				BeforeEach(func() {
+					recordingOS = &commandRecordingOS{OS: coreint.OS}
+					coreint.OS = recordingOS
+					createSettings.NetworkAdapters[0].Routes = []prot.Route{
+						{Destination: "10.1.0.0/16", Gateway: "192.168.0.254", Metric: 10},
+						{Destination: "fd00::/8"},
+					}
+				})
+				JustBeforeEach(func() {
+					err = coreint.CreateContainer(context.Background(), containerID, createSettings)
+				})
+				It("should pass the routes to netnscfg for the adapter", func() {
+					Expect(err).NotTo(HaveOccurred())
+					_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+					Expect(err).NotTo(HaveOccurred())
+					var netnscfg []string
+					for _, command := range recordingOS.commands {
+						if strings.HasPrefix(command, "netnscfg ") {
+							netnscfg = append(netnscfg, command)
+						}
+					}
+					Expect(netnscfg).To(HaveLen(1))
+					Expect(netnscfg[0]).To(ContainSubstring(`"Routes":[{"Destination":"10.1.0.0/16","Gateway":"192.168.0.254","Metric":10},{"Destination":"fd00::/8"}]`))
+				})
+				Context("a route's destination is not a CIDR", func() {
+					BeforeEach(func() {
+						createSettings.NetworkAdapters[0].Routes[1].Destination = "10.2.0.0"
+					})
+					It("should fail with an invalid argument error", func() {
+						Expect(err).To(HaveOccurred())
+						hresult, herr := gcserr.GetHresult(err)
+						Expect(herr).NotTo(HaveOccurred())
+						Expect(hresult).To(Equal(gcserr.HrInvalidArg))
+					})
+				})
+				Context("a route's gateway is not an IP address", func() {
+					BeforeEach(func() {
+						createSettings.NetworkAdapters[0].Routes[0].Gateway = "gateway"
+					})
+					It("should fail with an invalid argument error", func() {
+						Expect(err).To(HaveOccurred())
+						hresult, herr := gcserr.GetHresult(err)
+						Expect(herr).NotTo(HaveOccurred())
+						Expect(hresult).To(Equal(gcserr.HrInvalidArg))
+					})
+				})
+			})
+			Describe("creating a container with per-adapter routing tables", func() {
+				var recordingOS *commandRecordingOS
+				netnscfgCommands := func() []string {
+					var commands []string
+					for _, command := range recordingOS.commands {
+						if strings.HasPrefix(command, "netnscfg ") {
+							commands = append(commands, command)
+						}
+					}
+					return commands
+				}
+				BeforeEach(func() {
+					recordingOS = &commandRecordingOS{OS: coreint.OS}
+					coreint.OS = recordingOS
+					first := createSettings.NetworkAdapters[0]
+					first.RoutingTableID = 100
+					second := first
+					second.AdapterInstanceID = "11111111-1111-1111-1111-111111111111"
+					second.AllocatedIPAddress = "10.0.0.5"
+					second.RoutingTableID = 101
+					second.SourceBasedRules = []string{"10.0.0.0/24", "10.0.1.0/24"}
+					createSettings.NetworkAdapters = []prot.NetworkAdapter{first, second}
+				})
+				JustBeforeEach(func() {
+					err = coreint.CreateContainer(context.Background(), containerID, createSettings)
+				})
+				It("should direct each adapter's sources to its table", func() {
+					Expect(err).NotTo(HaveOccurred())
+					_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+					Expect(err).NotTo(HaveOccurred())
+					commands := netnscfgCommands()
+					Expect(commands).To(HaveLen(2))
+					Expect(commands[0]).To(ContainSubstring(`"RoutingTableId":100,"SourceBasedRules":["192.168.0.0/32"]`))
+					Expect(commands[1]).To(ContainSubstring(`"RoutingTableId":101,"SourceBasedRules":["10.0.0.0/24","10.0.1.0/24"]`))
+				})
+				AssertInvalidArg := func() {
+					It("should fail with an invalid argument error", func() {
+						Expect(err).To(HaveOccurred())
+						hresult, herr := gcserr.GetHresult(err)
+						Expect(herr).NotTo(HaveOccurred())
+						Expect(hresult).To(Equal(gcserr.HrInvalidArg))
+					})
+				}
+				Context("two adapters use the same table", func() {
+					BeforeEach(func() {
+						createSettings.NetworkAdapters[1].RoutingTableID = 100
+					})
+					AssertInvalidArg()
+				})
+				Context("an adapter uses the main table", func() {
+					BeforeEach(func() {
+						createSettings.NetworkAdapters[0].RoutingTableID = 254
+					})
+					AssertInvalidArg()
+				})
+				Context("an adapter has source-based rules but no table", func() {
+					BeforeEach(func() {
+						createSettings.NetworkAdapters[1].RoutingTableID = 0
+					})
+					AssertInvalidArg()
+				})
+				Context("a source-based rule is not a CIDR", func() {
+					BeforeEach(func() {
+						createSettings.NetworkAdapters[1].SourceBasedRules = []string{"10.0.0.1"}
+					})
+					AssertInvalidArg()
+				})
+				Context("an adapter with a table has no sources or allocated address", func() {
+					BeforeEach(func() {
+						createSettings.NetworkAdapters[0].AllocatedIPAddress = ""
+					})
+					AssertInvalidArg()
+				})
+			})
+			Describe("creating a container with bandwidth limits", func() {
+				var recordingOS *commandRecordingOS
+				tcCommands := func() []string {
+					var commands []string
+					for _, command := range recordingOS.commands {
+						if strings.HasPrefix(command, "tc ") || strings.HasPrefix(command, "nsenter ") {
+							commands = append(commands, command)
+						}
+					}
+					return commands
+				}
+				BeforeEach(func() {
+					recordingOS = &commandRecordingOS{OS: coreint.OS}
+					coreint.OS = recordingOS
+					createSettings.NetworkAdapters[0].Name = "eth0"
+					createSettings.NetworkAdapters[0].EgressBandwidthBps = 1000000
+					createSettings.NetworkAdapters[0].IngressBandwidthBps = 100000
+				})
+				JustBeforeEach(func() {
+					err = coreint.CreateContainer(context.Background(), containerID, createSettings)
+				})
+				It("should shape the adapter in the container's namespace after configuring it", func() {
+					Expect(err).NotTo(HaveOccurred())
+					_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+					Expect(err).NotTo(HaveOccurred())
+					var netnscfgIndex, tcIndex int
+					for i, command := range recordingOS.commands {
+						if strings.HasPrefix(command, "netnscfg ") {
+							netnscfgIndex = i
+						}
+						if strings.HasPrefix(command, "nsenter ") && tcIndex == 0 {
+							tcIndex = i
+						}
+					}
+					Expect(tcIndex).To(BeNumerically(">", netnscfgIndex))
+					commands := tcCommands()
+					Expect(commands).To(HaveLen(3))
+					for _, command := range commands {
+						Expect(command).To(MatchRegexp(`^nsenter --net=/proc/\d+/ns/net tc `))
+					}
+					Expect(commands[0]).To(HaveSuffix("tc qdisc add dev eth0 root tbf rate 1000000bps burst 100000 latency 50ms"))
+					Expect(commands[1]).To(HaveSuffix("tc qdisc add dev eth0 handle ffff: ingress"))
+					Expect(commands[2]).To(HaveSuffix("tc filter add dev eth0 parent ffff: protocol all u32 match u32 0 0 police rate 100000bps burst 16384 drop flowid :1"))
+				})
+				It("should remove the shaping when the container is deleted", func() {
+					Expect(err).NotTo(HaveOccurred())
+					Expect(coreint.DeleteContainer(containerID)).To(Succeed())
+					commands := tcCommands()
+					Expect(commands).To(HaveLen(2))
+					Expect(commands[0]).To(MatchRegexp(`^tc qdisc del dev \S+ root$`))
+					Expect(commands[1]).To(MatchRegexp(`^tc qdisc del dev \S+ handle ffff: ingress$`))
+				})
+				Context("only egress is limited", func() {
+					BeforeEach(func() {
+						createSettings.NetworkAdapters[0].IngressBandwidthBps = 0
+					})
+					It("should only add the root qdisc", func() {
+						Expect(err).NotTo(HaveOccurred())
+						_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+						Expect(err).NotTo(HaveOccurred())
+						commands := tcCommands()
+						Expect(commands).To(HaveLen(1))
+						Expect(commands[0]).To(ContainSubstring("tc qdisc add dev eth0 root tbf"))
+					})
+				})
+				Context("a bandwidth limit is negative", func() {
+					BeforeEach(func() {
+						createSettings.NetworkAdapters[0].EgressBandwidthBps = -1
+					})
+					It("should fail with an invalid argument error", func() {
+						Expect(err).To(HaveOccurred())
+						hresult, herr := gcserr.GetHresult(err)
+						Expect(herr).NotTo(HaveOccurred())
+						Expect(hresult).To(Equal(gcserr.HrInvalidArg))
+					})
+				})
+			})
+			Describe("a container with orphaned zombie processes", func() {
+				var recordingOS *waitRecordingOS
+				BeforeEach(func() {
+					recordingOS = &waitRecordingOS{OS: coreint.OS}
+					coreint.OS = recordingOS
+					coreint.Rtime = &zombieRuntime{Runtime: coreint.Rtime}
+					Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+					_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+					Expect(err).NotTo(HaveOccurred())
+				})
+				It("should report the zombies when listing processes", func() {
+					processes, err := coreint.ListProcesses(containerID)
+					Expect(err).NotTo(HaveOccurred())
+					zombies := map[int]bool{}
+					for _, process := range processes {
+						zombies[process.Pid] = process.IsZombie
+					}
+					Expect(zombies).To(HaveKeyWithValue(orphanedZombiePid, true))
+					Expect(zombies).To(HaveKeyWithValue(orphanedRunningPid, false))
+				})
+				It("should reap only the orphaned zombies", func() {
+					Expect(coreint.reapOrphans()).To(Equal(1))
+					Expect(recordingOS.waited).To(Equal([]int{orphanedZombiePid}))
+				})
+				Context("the container's init process has exited", func() {
+					BeforeEach(func() {
+						coreint.containerCacheMutex.Lock()
+						coreint.getContainer(containerID).initExited = true
+						coreint.containerCacheMutex.Unlock()
+					})
+					It("should not reap anything", func() {
+						Expect(coreint.reapOrphans()).To(Equal(0))
+						Expect(recordingOS.waited).To(BeEmpty())
+					})
+				})
+			})
+			Describe("writing to a process's stdin", func() {
+				const pid = 4242
+				var (
+					data []byte
+					n    int
+				)
+				BeforeEach(func() {
+					data = []byte("answer\n")
+				})
+				JustBeforeEach(func() {
+					n, err = coreint.WriteProcessStdin(containerID, pid, data)
+				})
+				Context("the process has a stdin pipe", func() {
+					var (
+						host  *transport.MockConnection
+						relay *stdio.PipeRelay
+						files *stdio.FileSet
+					)
+					BeforeEach(func() {
+						tport := &transport.MockTransport{Channel: make(chan *transport.MockConnection, 1)}
+						in, err := tport.Dial(0)
+						Expect(err).NotTo(HaveOccurred())
+						host = <-tport.Channel
+						relay, err = (&stdio.ConnectionSet{In: in}).NewPipeRelay()
+						Expect(err).NotTo(HaveOccurred())
+						files, _ = relay.Files()
+						relay.Start()
+						processEntry := newProcessCacheEntry(containerID)
+						processEntry.Pipes = relay
+						coreint.processCache[pid] = processEntry
+					})
+					AfterEach(func() {
+						host.Close()
+						relay.Wait()
+						files.In.Close()
+					})
+					It("should write the data to the process's stdin", func() {
+						Expect(err).NotTo(HaveOccurred())
+						Expect(n).To(Equal(len(data)))
+						buf := make([]byte, len(data))
+						_, err = io.ReadFull(files.In, buf)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(buf).To(Equal(data))
+					})
+				})
+				Context("the process has no stdin pipe", func() {
+					BeforeEach(func() {
+						relay, err := (&stdio.ConnectionSet{}).NewPipeRelay()
+						Expect(err).NotTo(HaveOccurred())
+						processEntry := newProcessCacheEntry(containerID)
+						processEntry.Pipes = relay
+						coreint.processCache[pid] = processEntry
+					})
+					It("should fail with an invalid argument error", func() {
+						Expect(err).To(HaveOccurred())
+						hresult, herr := gcserr.GetHresult(err)
+						Expect(herr).NotTo(HaveOccurred())
+						Expect(hresult).To(Equal(gcserr.HrInvalidArg))
+					})
+				})
+				Context("the process is in another container", func() {
+					BeforeEach(func() {
+						coreint.processCache[pid] = newProcessCacheEntry("other")
+					})
+					It("should produce an error", func() {
+						Expect(err).To(HaveOccurred())
+					})
+				})
+			})
+			Describe("getting guest information", func() {
+				var (
+					probe *probeOS
+					info  prot.GuestInfo
+				)
+				BeforeEach(func() {
+					probe = &probeOS{OS: coreint.OS, existing: map[string]bool{}}
+					coreint.OS = probe
+				})
+				JustBeforeEach(func() {
+					info, err = coreint.GetGuestInfo()
+				})
+				Context("no capability probes succeed", func() {
+					It("should report the versions but no features", func() {
+						Expect(err).NotTo(HaveOccurred())
+						Expect(info.KernelVersion).To(Equal("4.14.0-probe"))
+						Expect(info.GCSVersion).To(Equal(GCSVersion))
+						Expect(info.Features).To(BeEmpty())
+					})
+				})
+				Context("some capability probes succeed", func() {
+					BeforeEach(func() {
+						probe.existing["/proc/sys/kernel/seccomp"] = true
+						probe.existing[mountNamespacePath] = true
+						probe.cgroup2 = true
+					})
+					It("should report exactly those features, sorted", func() {
+						Expect(err).NotTo(HaveOccurred())
+						Expect(info.Features).To(Equal([]string{
+							prot.GuestFeatureCgroupV2,
+							prot.GuestFeatureMountNamespaces,
+							prot.GuestFeatureSeccomp,
+						}))
+					})
+				})
+				Context("only dm-verity is available", func() {
+					BeforeEach(func() {
+						probe.existing["/sys/module/dm_verity"] = true
+					})
+					It("should report only verity", func() {
+						Expect(err).NotTo(HaveOccurred())
+						Expect(info.Features).To(Equal([]string{prot.GuestFeatureVerity}))
+					})
+				})
+			})
+			Describe("creating a container with syslog forwarding", func() {
+				var recorder *configRecordingOS
+				BeforeEach(func() {
+					recorder = &configRecordingOS{OS: coreint.OS, written: make(map[string]string)}
+					coreint.OS = recorder
+					createSettings.ForwardSyslog = true
+					Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+				})
+				AfterEach(func() {
+					if containerEntry := coreint.getContainer(containerID); containerEntry != nil && containerEntry.syslog != nil {
+						Expect(containerEntry.syslog.Close()).To(Succeed())
+					}
+					os.RemoveAll(coreint.getContainerStoragePath(containerID))
+				})
+				It("should bind mount the syslog socket at /dev/log", func() {
+					_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+					Expect(err).NotTo(HaveOccurred())
+					var config oci.Spec
+					Expect(json.Unmarshal([]byte(recorder.written[coreint.getConfigPath(containerID)]), &config)).To(Succeed())
+					Expect(config.Mounts).To(ContainElement(oci.Mount{
+						Destination: "/dev/log",
+						Type:        "bind",
+						Source:      coreint.getSyslogSocketPath(containerID),
+						Options:     []string{"rbind", "rw"},
+					}))
+				})
+				It("should forward messages written to the socket to the init output buffer", func() {
+					conn, err := net.Dial("unixgram", coreint.getSyslogSocketPath(containerID))
+					Expect(err).NotTo(HaveOccurred())
+					defer conn.Close()
+					_, err = conn.Write([]byte("<14>app: hello from syslog\n"))
+					Expect(err).NotTo(HaveOccurred())
+					Eventually(func() string {
+						output, err := coreint.GetInitOutput(containerID)
+						Expect(err).NotTo(HaveOccurred())
+						return string(output)
+					}).Should(Equal("<14>app: hello from syslog\n"))
+				})
+			})
+			Describe("timing the phases of starting a container", func() {
+				var (
+					clock   *steppingClock
+					timings prot.ContainerStartTimings
+				)
+				BeforeEach(func() {
+					clock = &steppingClock{now: time.Unix(0, 0), step: time.Millisecond}
+					coreint.clock = clock.Now
+					Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+				})
+				Context("the init process has not been started", func() {
+					It("should record only the create phases", func() {
+						timings, err = coreint.GetStartTimings(containerID)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(timings.LayerMountMicroseconds).To(BeNumerically(">", 0))
+						Expect(timings.SandboxMountMicroseconds).To(BeNumerically(">", 0))
+						Expect(timings.OverlayMicroseconds).To(BeNumerically(">", 0))
+						Expect(timings.NetworkMicroseconds).To(BeZero())
+						Expect(timings.InitExecMicroseconds).To(BeZero())
+						Expect(timings.TotalMicroseconds).To(BeZero())
+					})
+				})
+				Context("the init process has been started", func() {
+					BeforeEach(func() {
+						_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+						Expect(err).NotTo(HaveOccurred())
+					})
+					It("should record every phase within the total", func() {
+						timings, err = coreint.GetStartTimings(containerID)
+						Expect(err).NotTo(HaveOccurred())
+						phases := []uint64{
+							timings.LayerMountMicroseconds,
+							timings.SandboxMountMicroseconds,
+							timings.OverlayMicroseconds,
+							timings.NetworkMicroseconds,
+							timings.InitExecMicroseconds,
+						}
+						var sum uint64
+						for _, phase := range phases {
+							Expect(phase).To(BeNumerically(">", 0))
+							Expect(phase % 1000).To(BeZero())
+							sum += phase
+						}
+						Expect(sum).To(BeNumerically("<=", timings.TotalMicroseconds))
+						Expect(timings.TotalMicroseconds).To(Equal(uint64(clock.Elapsed() / time.Microsecond)))
+					})
+				})
+				Context("the container does not exist", func() {
+					It("should fail", func() {
+						_, err = coreint.GetStartTimings("nonexistent")
+						Expect(err).To(HaveOccurred())
+					})
+				})
+			})
+			Describe("validating container settings", func() {
+				var recorder *mountDataRecordingOS
+				BeforeEach(func() {
+					recorder = &mountDataRecordingOS{OS: coreint.OS, data: make(map[string]string)}
+					coreint.OS = recorder
+				})
+				JustBeforeEach(func() {
+					err = coreint.ValidateContainer(containerID, createSettings)
+				})
+				Context("the settings are valid", func() {
+					It("should succeed without creating the container", func() {
+						Expect(err).NotTo(HaveOccurred())
+						Expect(coreint.getContainer(containerID)).To(BeNil())
+						Expect(recorder.data).To(BeEmpty())
+					})
+				})
+				Context("two mapped virtual disks have the same LUN", func() {
+					BeforeEach(func() {
+						disk := createSettings.MappedVirtualDisks[0]
+						disk.ContainerPath = "/another/path"
+						createSettings.MappedVirtualDisks = append(createSettings.MappedVirtualDisks, disk)
+					})
+					It("should fail with an invalid argument error", func() {
+						Expect(err).To(HaveOccurred())
+						hresult, herr := gcserr.GetHresult(err)
+						Expect(herr).NotTo(HaveOccurred())
+						Expect(hresult).To(Equal(gcserr.HrInvalidArg))
+						Expect(recorder.data).To(BeEmpty())
+					})
+					It("should also be rejected by create before mounting anything", func() {
+						Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).NotTo(Succeed())
+						Expect(recorder.data).To(BeEmpty())
+					})
+				})
+				Context("a network adapter has an invalid bandwidth limit", func() {
+					BeforeEach(func() {
+						createSettings.NetworkAdapters[0].EgressBandwidthBps = -1
+					})
+					It("should fail with an invalid argument error", func() {
+						Expect(err).To(HaveOccurred())
+						hresult, herr := gcserr.GetHresult(err)
+						Expect(herr).NotTo(HaveOccurred())
+						Expect(hresult).To(Equal(gcserr.HrInvalidArg))
+					})
+				})
+				Context("the container already exists", func() {
+					BeforeEach(func() {
+						Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+						recorder.data = make(map[string]string)
+					})
+					It("should fail", func() {
+						Expect(err).To(HaveOccurred())
+					})
+				})
+			})
+			Describe("creating a container with the init shim", func() {
+				var (
+					recorder *configRecordingOS
+					params   prot.ProcessParameters
+				)
+				BeforeEach(func() {
+					recorder = &configRecordingOS{OS: coreint.OS, written: make(map[string]string)}
+					coreint.OS = recorder
+					params = initialExecParams
+					params.OCISpecification = oci.Spec{Process: &oci.Process{Args: []string{"/app", "--serve"}}}
+				})
+				writtenConfig := func() oci.Spec {
+					var config oci.Spec
+					Expect(json.Unmarshal([]byte(recorder.written[coreint.getConfigPath(containerID)]), &config)).To(Succeed())
+					return config
+				}
+				Context("the shim is enabled", func() {
+					BeforeEach(func() {
+						createSettings.InitShim = true
+						Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+						_, err = coreint.ExecProcess(containerID, params, fullStdioSet)
+						Expect(err).NotTo(HaveOccurred())
+					})
+					It("should run the shim as argv[0] wrapping the real command", func() {
+						config := writtenConfig()
+						Expect(config.Process.Args).To(Equal([]string{"/sbin/gcsinit", "--", "/app", "--serve"}))
+					})
+					It("should bind mount the shim into the container", func() {
+						config := writtenConfig()
+						Expect(config.Mounts).To(ContainElement(oci.Mount{
+							Destination: "/sbin/gcsinit",
+							Type:        "bind",
+							Source:      InitShimPath,
+							Options:     []string{"bind", "ro"},
+						}))
+					})
+					It("should not modify the caller's specification", func() {
+						Expect(params.OCISpecification.Process.Args).To(Equal([]string{"/app", "--serve"}))
+					})
+				})
+				Context("the shim is not enabled", func() {
+					BeforeEach(func() {
+						Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+						_, err = coreint.ExecProcess(containerID, params, fullStdioSet)
+						Expect(err).NotTo(HaveOccurred())
+					})
+					It("should run the command directly", func() {
+						config := writtenConfig()
+						Expect(config.Process.Args).To(Equal([]string{"/app", "--serve"}))
+						Expect(config.Mounts).To(BeEmpty())
+					})
+				})
+			})
+			Describe("creating a container with device rules", func() {
+				var recorder *configRecordingOS
+				BeforeEach(func() {
+					recorder = &configRecordingOS{OS: coreint.OS, written: make(map[string]string)}
+					coreint.OS = recorder
+				})
+				Context("the rules are valid", func() {
+					var (
+						major = int64(1)
+						minor = int64(3)
+					)
+					BeforeEach(func() {
+						createSettings.Devices = []prot.DeviceCgroupRule{
+							{Type: "a", Major: prot.DeviceCgroupWildcard, Minor: prot.DeviceCgroupWildcard, Access: "rwm", Allow: false},
+							{Type: "c", Major: 1, Minor: 3, Access: "rw", Allow: true},
+						}
+						params := initialExecParams
+						params.OCISpecification = oci.Spec{Linux: &oci.Linux{Resources: &oci.LinuxResources{
+							Devices: []oci.LinuxDeviceCgroup{{Allow: true, Type: "b", Access: "r"}},
+						}}}
+						Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+						_, err = coreint.ExecProcess(containerID, params, fullStdioSet)
+						Expect(err).NotTo(HaveOccurred())
+					})
+					It("should append the rules to the device cgroup in order", func() {
+						var config oci.Spec
+						Expect(json.Unmarshal([]byte(recorder.written[coreint.getConfigPath(containerID)]), &config)).To(Succeed())
+						Expect(config.Linux.Resources.Devices).To(Equal([]oci.LinuxDeviceCgroup{
+							{Allow: true, Type: "b", Access: "r"},
+							{Allow: false, Type: "a", Access: "rwm"},
+							{Allow: true, Type: "c", Major: &major, Minor: &minor, Access: "rw"},
+						}))
+					})
+				})
+				Context("a rule is invalid", func() {
+					var rule prot.DeviceCgroupRule
+					BeforeEach(func() {
+						rule = prot.DeviceCgroupRule{Type: "c", Major: 1, Minor: 3, Access: "rw", Allow: true}
+					})
+					JustBeforeEach(func() {
+						createSettings.Devices = []prot.DeviceCgroupRule{rule}
+						err = coreint.CreateContainer(context.Background(), containerID, createSettings)
+					})
+					expectInvalidArg := func() {
+						Expect(err).To(HaveOccurred())
+						hresult, herr := gcserr.GetHresult(err)
+						Expect(herr).NotTo(HaveOccurred())
+						Expect(hresult).To(Equal(gcserr.HrInvalidArg))
+					}
+					Context("the type is unknown", func() {
+						BeforeEach(func() { rule.Type = "p" })
+						It("should produce an invalid argument error", expectInvalidArg)
+					})
+					Context("the major number is negative", func() {
+						BeforeEach(func() { rule.Major = -2 })
+						It("should produce an invalid argument error", expectInvalidArg)
+					})
+					Context("the minor number is negative", func() {
+						BeforeEach(func() { rule.Minor = -2 })
+						It("should produce an invalid argument error", expectInvalidArg)
+					})
+					Context("the access is empty", func() {
+						BeforeEach(func() { rule.Access = "" })
+						It("should produce an invalid argument error", expectInvalidArg)
+					})
+					Context("the access has an unknown character", func() {
+						BeforeEach(func() { rule.Access = "rx" })
+						It("should produce an invalid argument error", expectInvalidArg)
+					})
+					Context("the access repeats a character", func() {
+						BeforeEach(func() { rule.Access = "rr" })
+						It("should produce an invalid argument error", expectInvalidArg)
+					})
+				})
+			})
+			Describe("creating a container with a process limit", func() {
+				var cgroups *cgroupRecordingOS
+				BeforeEach(func() {
+					cgroups = &cgroupRecordingOS{OS: coreint.OS, written: make(map[string]string)}
+					coreint.OS = cgroups
+				})
+				Context("the limit is positive", func() {
+					BeforeEach(func() {
+						createSettings.PidsLimit = 100
+						Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+					})
+					It("should not write the limit before the init process is created", func() {
+						Expect(cgroups.written).To(BeEmpty())
+					})
+					It("should write the limit when the init process is created", func() {
+						_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(cgroups.written).To(Equal(map[string]string{
+							"/sys/fs/cgroup/pids/" + containerID + "/pids.max": "100",
+						}))
+					})
+				})
+				Context("no limit is given", func() {
+					It("should not write pids.max", func() {
+						Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+						_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(cgroups.written).To(BeEmpty())
+					})
+				})
+				Context("the limit is negative", func() {
+					It("should produce an invalid argument error", func() {
+						createSettings.PidsLimit = -1
+						err = coreint.CreateContainer(context.Background(), containerID, createSettings)
+						Expect(err).To(HaveOccurred())
+						hresult, herr := gcserr.GetHresult(err)
+						Expect(herr).NotTo(HaveOccurred())
+						Expect(hresult).To(Equal(gcserr.HrInvalidArg))
+					})
+				})
+			})
+			Describe("creating a container with block IO limits", func() {
+				var cgroups *cgroupRecordingOS
+				BeforeEach(func() {
+					cgroups = &cgroupRecordingOS{OS: coreint.OS, written: make(map[string]string)}
+					coreint.OS = cgroups
+				})
+				Context("the settings are valid", func() {
+					BeforeEach(func() {
+						createSettings.BlkioWeight = 500
+						createSettings.BlkioDeviceLimits = []prot.BlkioDeviceLimit{
+							{Major: 8, Minor: 16, ReadBps: 1048576},
+						}
+					})
+					JustBeforeEach(func() {
+						Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+						_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+						Expect(err).NotTo(HaveOccurred())
+					})
+					Context("cgroup v1 is mounted", func() {
+						It("should write the weight and throttles to the blkio controller", func() {
+							Expect(cgroups.written).To(Equal(map[string]string{
+								"/sys/fs/cgroup/blkio/" + containerID + "/blkio.weight":                    "500",
+								"/sys/fs/cgroup/blkio/" + containerID + "/blkio.throttle.read_bps_device":  "8:16 1048576",
+								"/sys/fs/cgroup/blkio/" + containerID + "/blkio.throttle.write_bps_device": "8:16 0",
+							}))
+						})
+					})
+					Context("cgroup v2 is mounted", func() {
+						BeforeEach(func() {
+							cgroups.unified = true
+						})
+						It("should write the scaled weight and io.max in the unified hierarchy", func() {
+							Expect(cgroups.written).To(Equal(map[string]string{
+								"/sys/fs/cgroup/" + containerID + "/io.weight": "default 4950",
+								"/sys/fs/cgroup/" + containerID + "/io.max":    "8:16 rbps=1048576 wbps=max",
+							}))
+						})
+					})
+				})
+				Context("the settings are invalid", func() {
+					JustBeforeEach(func() {
+						err = coreint.CreateContainer(context.Background(), containerID, createSettings)
+					})
+					expectInvalidArg := func() {
+						Expect(err).To(HaveOccurred())
+						hresult, herr := gcserr.GetHresult(err)
+						Expect(herr).NotTo(HaveOccurred())
+						Expect(hresult).To(Equal(gcserr.HrInvalidArg))
+					}
+					Context("the weight is too small", func() {
+						BeforeEach(func() { createSettings.BlkioWeight = 9 })
+						It("should produce an invalid argument error", expectInvalidArg)
+					})
+					Context("the weight is too large", func() {
+						BeforeEach(func() { createSettings.BlkioWeight = 1001 })
+						It("should produce an invalid argument error", expectInvalidArg)
+					})
+					Context("a device number is negative", func() {
+						BeforeEach(func() {
+							createSettings.BlkioDeviceLimits = []prot.BlkioDeviceLimit{{Major: -1, Minor: 0, ReadBps: 1}}
+						})
+						It("should produce an invalid argument error", expectInvalidArg)
+					})
+					Context("a device is limited twice", func() {
+						BeforeEach(func() {
+							createSettings.BlkioDeviceLimits = []prot.BlkioDeviceLimit{
+								{Major: 8, Minor: 0, ReadBps: 1},
+								{Major: 8, Minor: 0, WriteBps: 1},
+							}
+						})
+						It("should produce an invalid argument error", expectInvalidArg)
+					})
+				})
+			})
+			Describe("opening a file in a container", func() {
+				var (
+					files   *containerFileOS
+					pid     int
+					path    string
+					f       io.ReadCloser
+					size    int64
+					started bool
+				)
+				BeforeEach(func() {
+					files = &containerFileOS{OS: coreint.OS, files: make(map[string]string), dirs: make(map[string]bool), modes: make(map[string]os.FileMode)}
+					coreint.OS = files
+					path = "/var/log/app.log"
+					started = true
+					Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+				})
+				JustBeforeEach(func() {
+					if started {
+						pid, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+						Expect(err).NotTo(HaveOccurred())
+						files.files[fmt.Sprintf("/proc/%d/root/var/log/app.log", pid)] = "log line\n"
+						files.dirs[fmt.Sprintf("/proc/%d/root/var/log", pid)] = true
+					}
+					f, size, err = coreint.OpenContainerFile(containerID, path)
+				})
+				expectInvalidArg := func() {
+					Expect(err).To(HaveOccurred())
+					hresult, herr := gcserr.GetHresult(err)
+					Expect(herr).NotTo(HaveOccurred())
+					Expect(hresult).To(Equal(gcserr.HrInvalidArg))
+				}
+				It("should return the file's contents from the container's root", func() {
+					Expect(err).NotTo(HaveOccurred())
+					defer f.Close()
+					Expect(size).To(Equal(int64(len("log line\n"))))
+					contents, err := ioutil.ReadAll(f)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(contents)).To(Equal("log line\n"))
+				})
+				Context("the path is a directory", func() {
+					BeforeEach(func() { path = "/var/log" })
+					It("should produce an invalid argument error", expectInvalidArg)
+				})
+				Context("the path is relative", func() {
+					BeforeEach(func() { path = "var/log/app.log" })
+					It("should produce an invalid argument error", expectInvalidArg)
+				})
+				Context("the path does not exist", func() {
+					BeforeEach(func() { path = "/missing" })
+					It("should produce an error", func() {
+						Expect(err).To(HaveOccurred())
+					})
+				})
+				Context("the container has not been started", func() {
+					BeforeEach(func() { started = false })
+					It("should produce an error", func() {
+						Expect(err).To(HaveOccurred())
+					})
+				})
+			})
+			Describe("writing a file in a container", func() {
+				var (
+					files *containerFileOS
+					root  string
+					path  string
+					mode  os.FileMode
+					n     int64
+				)
+				BeforeEach(func() {
+					files = &containerFileOS{OS: coreint.OS, files: make(map[string]string), dirs: make(map[string]bool), modes: make(map[string]os.FileMode)}
+					coreint.OS = files
+					path = "/etc/app/secret.conf"
+					mode = 0600
+					Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+					pid, err := coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+					Expect(err).NotTo(HaveOccurred())
+					root = fmt.Sprintf("/proc/%d/root", pid)
+					files.dirs[root+"/etc/app"] = true
+				})
+				JustBeforeEach(func() {
+					n, err = coreint.WriteContainerFile(containerID, path, mode, strings.NewReader("token=abc\n"))
+				})
+				expectInvalidArg := func() {
+					Expect(err).To(HaveOccurred())
+					hresult, herr := gcserr.GetHresult(err)
+					Expect(herr).NotTo(HaveOccurred())
+					Expect(hresult).To(Equal(gcserr.HrInvalidArg))
+				}
+				It("should create the file with the given contents and mode", func() {
+					Expect(err).NotTo(HaveOccurred())
+					Expect(n).To(Equal(int64(len("token=abc\n"))))
+					Expect(files.files).To(Equal(map[string]string{root + path: "token=abc\n"}))
+					Expect(files.modes).To(Equal(map[string]os.FileMode{root + path: 0600}))
+				})
+				It("should rename a temporary file in the same directory over the file", func() {
+					Expect(files.renamed).To(HaveLen(1))
+					Expect(files.renamed[0]).To(HavePrefix(root + "/etc/app/.secret.conf."))
+					Expect(files.renamed[0]).To(HaveSuffix(" -> " + root + path))
+				})
+				Context("the file already exists", func() {
+					BeforeEach(func() {
+						files.files[root+path] = "old"
+					})
+					It("should replace its contents", func() {
+						Expect(err).NotTo(HaveOccurred())
+						Expect(files.files[root+path]).To(Equal("token=abc\n"))
+					})
+				})
+				Context("the mode has the setuid bit", func() {
+					BeforeEach(func() { mode = os.ModeSetuid | 0755 })
+					It("should keep the setuid bit", func() {
+						Expect(err).NotTo(HaveOccurred())
+						Expect(files.modes[root+path]).To(Equal(os.ModeSetuid | 0755))
+					})
+				})
+				Context("the mode is not a set of permission bits", func() {
+					BeforeEach(func() { mode = os.ModeDir | 0755 })
+					It("should produce an invalid argument error", expectInvalidArg)
+				})
+				Context("the parent directory does not exist", func() {
+					BeforeEach(func() { path = "/etc/missing/secret.conf" })
+					It("should produce an invalid argument error", expectInvalidArg)
+				})
+				Context("the path is a directory", func() {
+					BeforeEach(func() {
+						files.dirs[root+"/etc"] = true
+						path = "/etc/app"
+					})
+					It("should produce an invalid argument error", expectInvalidArg)
+				})
+				Context("the path is relative", func() {
+					BeforeEach(func() { path = "etc/app/secret.conf" })
+					It("should produce an invalid argument error", expectInvalidArg)
+				})
+			})
+			Describe("creating a container with secrets", func() {
+				var (
+					recorder    *secretsOS
+					secretsPath string
+				)
+				BeforeEach(func() {
+					recorder = &secretsOS{
+						configRecordingOS: &configRecordingOS{OS: coreint.OS, written: make(map[string]string)},
+						fstypes:           make(map[string]string),
+						modes:             make(map[string]os.FileMode),
+					}
+					coreint.OS = recorder
+					secretsPath = coreint.getSecretsPath(containerID)
+				})
+				Context("the secrets are valid", func() {
+					BeforeEach(func() {
+						createSettings.Secrets = []prot.Secret{
+							{ContainerPath: "/run/secrets/token", Mode: 0400, Content: []byte("abc")},
+							{ContainerPath: "/etc/app/key.pem", Mode: 0640, Content: []byte("key")},
+						}
+						Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+					})
+					It("should write the secrets to a tmpfs outside the container's root filesystem", func() {
+						Expect(recorder.fstypes[secretsPath]).To(Equal("tmpfs"))
+						_, _, _, rootfsPath := coreint.getUnioningPaths(containerID)
+						Expect(strings.HasPrefix(secretsPath, rootfsPath+"/")).To(BeFalse())
+						Expect(recorder.written[filepath.Join(secretsPath, "0")]).To(Equal("abc"))
+						Expect(recorder.written[filepath.Join(secretsPath, "1")]).To(Equal("key"))
+					})
+					It("should give the secrets their modes", func() {
+						Expect(recorder.modes).To(Equal(map[string]os.FileMode{
+							filepath.Join(secretsPath, "0"): 0400,
+							filepath.Join(secretsPath, "1"): 0640,
+						}))
+					})
+					It("should zero the secrets' contents", func() {
+						Expect(createSettings.Secrets[0].Content).To(Equal([]byte{0, 0, 0}))
+						Expect(createSettings.Secrets[1].Content).To(Equal([]byte{0, 0, 0}))
+					})
+					It("should bind mount the secrets into the container read-only", func() {
+						_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+						Expect(err).NotTo(HaveOccurred())
+						var config oci.Spec
+						Expect(json.Unmarshal([]byte(recorder.written[coreint.getConfigPath(containerID)]), &config)).To(Succeed())
+						Expect(config.Mounts).To(Equal([]oci.Mount{
+							{Destination: "/run/secrets/token", Type: "bind", Source: filepath.Join(secretsPath, "0"), Options: []string{"bind", "ro"}},
+							{Destination: "/etc/app/key.pem", Type: "bind", Source: filepath.Join(secretsPath, "1"), Options: []string{"bind", "ro"}},
+						}))
+					})
+					It("should unmount the tmpfs when the container is cleaned up", func() {
+						Expect(coreint.DeleteContainer(containerID)).To(Succeed())
+						Expect(recorder.unmounted).To(ContainElement(secretsPath))
+					})
+				})
+				Context("the secrets are invalid", func() {
+					JustBeforeEach(func() {
+						err = coreint.CreateContainer(context.Background(), containerID, createSettings)
+					})
+					expectInvalidArg := func() {
+						Expect(err).To(HaveOccurred())
+						hresult, herr := gcserr.GetHresult(err)
+						Expect(herr).NotTo(HaveOccurred())
+						Expect(hresult).To(Equal(gcserr.HrInvalidArg))
+						Expect(recorder.fstypes).NotTo(HaveKey(secretsPath))
+					}
+					Context("a path is relative", func() {
+						BeforeEach(func() {
+							createSettings.Secrets = []prot.Secret{{ContainerPath: "run/secrets/token", Mode: 0400}}
+						})
+						It("should produce an invalid argument error", expectInvalidArg)
+					})
+					Context("two secrets share a path", func() {
+						BeforeEach(func() {
+							createSettings.Secrets = []prot.Secret{
+								{ContainerPath: "/run/secrets/token", Mode: 0400},
+								{ContainerPath: "/run/secrets//token", Mode: 0400},
+							}
+						})
+						It("should produce an invalid argument error", expectInvalidArg)
+					})
+					Context("a mode has bits other than permissions", func() {
+						BeforeEach(func() {
+							createSettings.Secrets = []prot.Secret{{ContainerPath: "/run/secrets/token", Mode: 04755}}
+						})
+						It("should produce an invalid argument error", expectInvalidArg)
+					})
+				})
+			})
+			Describe("limiting the processes executed concurrently in a container", func() {
+				BeforeEach(func() {
+					createSettings.MaxConcurrentExec = 2
+					Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+					_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+					Expect(err).NotTo(HaveOccurred())
+					for i := 0; i < 2; i++ {
+						_, err = coreint.ExecProcess(containerID, nonInitialExecParams, fullStdioSet)
+						Expect(err).NotTo(HaveOccurred())
+					}
+				})
+				It("should reject processes beyond the limit as busy", func() {
+					_, err = coreint.ExecProcess(containerID, nonInitialExecParams, fullStdioSet)
+					Expect(err).To(HaveOccurred())
+					hresult, herr := gcserr.GetHresult(err)
+					Expect(herr).NotTo(HaveOccurred())
+					Expect(hresult).To(Equal(gcserr.HrBusy))
+				})
+			})
+			Describe("running a post-create hook", func() {
+				var hooks *hookOS
+				BeforeEach(func() {
+					hooks = &hookOS{OS: coreint.OS, output: "setup failed: no such file"}
+					coreint.OS = hooks
+					createSettings.PostCreateHook = &prot.ContainerHook{Args: []string{"/bin/setup", "--fast"}}
+				})
+				Context("the hook has no command", func() {
+					BeforeEach(func() {
+						createSettings.PostCreateHook.Args = nil
+					})
+					It("should reject the create settings", func() {
+						err = coreint.CreateContainer(context.Background(), containerID, createSettings)
+						Expect(err).To(HaveOccurred())
+						hresult, herr := gcserr.GetHresult(err)
+						Expect(herr).NotTo(HaveOccurred())
+						Expect(hresult).To(Equal(gcserr.HrInvalidArg))
+					})
+				})
+				Context("the container is created", func() {
+					BeforeEach(func() {
+						Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+					})
+					It("should run the hook in the container's namespaces before starting the init process", func() {
+						_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(hooks.ops).To(Equal([]string{
+							"nsenter --target=101 --mount --uts --ipc --net --pid --root --wd -- /bin/setup --fast",
+						}))
+					})
+					Context("the hook fails", func() {
+						BeforeEach(func() {
+							hooks.waitErr = errors.New("exit status 1")
+						})
+						It("should fail to start the init process with the hook's output", func() {
+							_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+							Expect(err).To(HaveOccurred())
+							Expect(err.Error()).To(ContainSubstring("setup failed: no such file"))
+						})
+						It("should delete the created runtime container", func() {
+							rtime := &restartableRuntime{Runtime: coreint.Rtime}
+							coreint.Rtime = rtime
+							_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+							Expect(err).To(HaveOccurred())
+							Expect(rtime.createdCount()).To(Equal(1))
+							Expect(rtime.deletedCount()).To(Equal(1))
+							Expect(coreint.getContainer(containerID).container).To(BeNil())
+						})
+					})
+				})
+				Context("the container is deleted with a pre-delete hook", func() {
+					BeforeEach(func() {
+						createSettings.PostCreateHook = nil
+						createSettings.PreDeleteHook = &prot.ContainerHook{Args: []string{"/bin/teardown"}}
+						Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+					})
+					It("should run the hook in the container's root filesystem before unmounting its storage", func() {
+						Expect(coreint.DeleteContainer(containerID)).To(Succeed())
+						_, _, _, rootfsPath := coreint.getUnioningPaths(containerID)
+						Expect(hooks.ops).NotTo(BeEmpty())
+						Expect(hooks.ops[0]).To(Equal("chroot " + rootfsPath + " /bin/teardown"))
+						Expect(hooks.ops[1:]).To(ContainElement(HavePrefix("unmount ")))
+					})
+					Context("the hook fails", func() {
+						BeforeEach(func() {
+							hooks.waitErr = errors.New("exit status 1")
+						})
+						It("should still delete the container", func() {
+							Expect(coreint.DeleteContainer(containerID)).To(Succeed())
+							Expect(coreint.getContainer(containerID)).To(BeNil())
+							Expect(hooks.ops[1:]).To(ContainElement(HavePrefix("unmount ")))
+						})
+					})
+				})
+			})
+			Describe("creating a container over directories which already exist", func() {
+				var existing *existingPathsOS
+				BeforeEach(func() {
+					existing = &existingPathsOS{OS: coreint.OS, files: make(map[string]bool)}
+					coreint.OS = existing
+				})
+				It("should succeed", func() {
+					Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+					Expect(existing.created).NotTo(BeEmpty())
+				})
+				Context("one of the paths exists as a file", func() {
+					var rootfsPath string
+					BeforeEach(func() {
+						_, _, _, rootfsPath = coreint.getUnioningPaths(containerID)
+						existing.files[rootfsPath] = true
+					})
+					It("should fail to create the container", func() {
+						err = coreint.CreateContainer(context.Background(), containerID, createSettings)
+						Expect(err).To(HaveOccurred())
+						Expect(err.Error()).To(ContainSubstring(rootfsPath + " already exists and is not a directory"))
+					})
+				})
+			})
+			Describe("updating a container's DNS settings", func() {
+				var (
+					files      *renameRecordingOS
+					resolvPath string
+				)
+				modifyDNS := func(requestType prot.RequestType, dns prot.DNSSettings) error {
+					return coreint.ModifySettings(context.Background(), containerID, prot.ResourceModificationRequestResponse{
+						ResourceType: prot.PtDNS,
+						RequestType:  requestType,
+						Settings:     &dns,
+					})
+				}
+				BeforeEach(func() {
+					Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+					files = &renameRecordingOS{configRecordingOS: &configRecordingOS{OS: coreint.OS, written: make(map[string]string)}}
+					coreint.OS = files
+					_, _, _, rootfsPath := coreint.getUnioningPaths(containerID)
+					resolvPath = filepath.Join(rootfsPath, "etc", "resolv.conf")
+					Expect(modifyDNS(prot.RtUpdate, prot.DNSSettings{
+						Servers: []string{"10.0.0.1", "10.0.0.2"},
+						Search:  []string{"corp.example.com"},
+						Options: []string{"ndots:2"},
+					})).To(Succeed())
+				})
+				It("should replace resolv.conf with the settings through a rename", func() {
+					Expect(files.written).To(Equal(map[string]string{
+						resolvPath: "nameserver 10.0.0.1\nnameserver 10.0.0.2\nsearch corp.example.com\noptions ndots:2\n",
+					}))
+					Expect(files.renamed).To(HaveLen(1))
+				})
+				It("should add only the values which are not already set", func() {
+					Expect(modifyDNS(prot.RtAdd, prot.DNSSettings{
+						Servers: []string{"10.0.0.2", "10.0.0.3"},
+						Search:  []string{"example.com"},
+					})).To(Succeed())
+					Expect(files.written[resolvPath]).To(Equal("nameserver 10.0.0.1\nnameserver 10.0.0.2\nnameserver 10.0.0.3\nsearch corp.example.com example.com\noptions ndots:2\n"))
+				})
+				It("should remove the values given", func() {
+					Expect(modifyDNS(prot.RtRemove, prot.DNSSettings{
+						Servers: []string{"10.0.0.1"},
+						Options: []string{"ndots:2"},
+					})).To(Succeed())
+					Expect(files.written[resolvPath]).To(Equal("nameserver 10.0.0.2\nsearch corp.example.com\n"))
+				})
+				It("should replace all of the settings on a further update", func() {
+					Expect(modifyDNS(prot.RtUpdate, prot.DNSSettings{Servers: []string{"192.168.1.1"}})).To(Succeed())
+					Expect(files.written[resolvPath]).To(Equal("nameserver 192.168.1.1\n"))
+				})
+				It("should reject a server which is not an IP address", func() {
+					err = modifyDNS(prot.RtAdd, prot.DNSSettings{Servers: []string{"dns.example.com"}})
+					Expect(err).To(HaveOccurred())
+					hresult, herr := gcserr.GetHresult(err)
+					Expect(herr).NotTo(HaveOccurred())
+					Expect(hresult).To(Equal(gcserr.HrInvalidArg))
+					Expect(files.renamed).To(HaveLen(1))
+				})
+				It("should reject adding more servers than the resolver uses", func() {
+					err = modifyDNS(prot.RtAdd, prot.DNSSettings{Servers: []string{"10.0.0.3", "10.0.0.4"}})
+					Expect(err).To(HaveOccurred())
+					hresult, herr := gcserr.GetHresult(err)
+					Expect(herr).NotTo(HaveOccurred())
+					Expect(hresult).To(Equal(gcserr.HrInvalidArg))
+					Expect(files.written[resolvPath]).To(ContainSubstring("10.0.0.1"))
+				})
+			})
+			Describe("creating a container with a writable layer quota", func() {
+				var (
+					quotas      *quotaOS
+					scratchPath string
+					upperDir    string
+				)
+				BeforeEach(func() {
+					_, scratchPath, _, _ = coreint.getUnioningPaths(containerID)
+					upperDir = filepath.Join(scratchPath, "upper")
+					quotas = &quotaOS{
+						commandRecordingOS: &commandRecordingOS{OS: coreint.OS},
+						fsType:             0x58465342,
+						mounts:             "/dev/sda / ext4 rw 0 0\n/dev/sdb " + scratchPath + " xfs rw,relatime,prjquota 0 0\n",
+					}
+					coreint.OS = quotas
+					createSettings.WritableLayerQuotaBytes = 10 << 20
+				})
+				It("should give the upperdir a project with the quota as its limit", func() {
+					Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+					Expect(quotas.commands).To(ContainElement("chattr +P -p 1000 " + upperDir))
+					Expect(quotas.commands).To(ContainElement("setquota -P 1000 0 10240 0 0 " + scratchPath))
+				})
+				It("should give each container its own project", func() {
+					_, otherScratchPath, _, _ := coreint.getUnioningPaths("other")
+					quotas.mounts += "/dev/sdc " + otherScratchPath + " xfs rw,prjquota 0 0\n"
+					Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+					Expect(coreint.CreateContainer(context.Background(), "other", createSettings)).To(Succeed())
+					Expect(quotas.commands).To(ContainElement(HavePrefix("chattr +P -p 1001 ")))
+				})
+				It("should format an ext4 sandbox with project quota support", func() {
+					quotas.fsType = 0xef53
+					createSettings.SandboxFilesystem = "ext4"
+					Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+					Expect(quotas.commands).To(ContainElement(MatchRegexp(`^mkfs\.ext4 .*-O quota,project `)))
+				})
+				Context("the filesystem does not support project quotas", func() {
+					BeforeEach(func() {
+						quotas.fsType = 0x01021994
+					})
+					It("should fail with a not implemented error", func() {
+						err = coreint.CreateContainer(context.Background(), containerID, createSettings)
+						Expect(err).To(HaveOccurred())
+						hresult, herr := gcserr.GetHresult(err)
+						Expect(herr).NotTo(HaveOccurred())
+						Expect(hresult).To(Equal(gcserr.HrNotImpl))
+						Expect(quotas.commands).NotTo(ContainElement(HavePrefix("setquota ")))
+					})
+				})
+				Context("the filesystem is mounted without project quotas", func() {
+					BeforeEach(func() {
+						quotas.mounts = "/dev/sdb " + scratchPath + " xfs rw,relatime 0 0\n"
+					})
+					It("should fail with a not implemented error", func() {
+						err = coreint.CreateContainer(context.Background(), containerID, createSettings)
+						Expect(err).To(HaveOccurred())
+						hresult, herr := gcserr.GetHresult(err)
+						Expect(herr).NotTo(HaveOccurred())
+						Expect(hresult).To(Equal(gcserr.HrNotImpl))
+					})
+				})
+				Context("the sandbox is formatted as btrfs", func() {
+					BeforeEach(func() {
+						createSettings.SandboxFilesystem = "btrfs"
+					})
+					It("should reject the settings", func() {
+						err = coreint.CreateContainer(context.Background(), containerID, createSettings)
+						Expect(err).To(HaveOccurred())
+						hresult, herr := gcserr.GetHresult(err)
+						Expect(herr).NotTo(HaveOccurred())
+						Expect(hresult).To(Equal(gcserr.HrNotImpl))
+					})
+				})
+			})
+			Describe("calling GetGCSResourceUsage", func() {
+				BeforeEach(func() {
+					coreint.OS = &statmOS{
+						OS:       &fdCountingOS{OS: coreint.OS, counts: map[string]int{"/proc/self/fd": 9}},
+						contents: "5000 1200 300 10 0 900 0\n",
+					}
+				})
+				It("should report the resident set size and open file descriptors", func() {
+					usage, err := coreint.GetGCSResourceUsage()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(usage.ResidentSetBytes).To(Equal(uint64(1200 * os.Getpagesize())))
+					Expect(usage.OpenFileDescriptors).To(Equal(8))
+				})
+				It("should count the goroutines started since a baseline", func() {
+					baseline, err := coreint.GetGCSResourceUsage()
+					Expect(err).NotTo(HaveOccurred())
+					release := make(chan struct{})
+					defer close(release)
+					for i := 0; i < 5; i++ {
+						go func() {
+							<-release
+						}()
+					}
+					usage, err := coreint.GetGCSResourceUsage()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(usage.Goroutines).To(Equal(baseline.Goroutines + 5))
+				})
+				Context("statm is malformed", func() {
+					BeforeEach(func() {
+						coreint.OS.(*statmOS).contents = "5000"
+					})
+					It("should produce an error", func() {
+						_, err := coreint.GetGCSResourceUsage()
+						Expect(err).To(HaveOccurred())
+					})
+				})
+			})
+			Describe("calling SignalContainerProcesses", func() {
+				var procs *cgroupProcsOS
+				BeforeEach(func() {
+					procs = &cgroupProcsOS{OS: coreint.OS, procs: "101\n205\n317\n"}
+					coreint.OS = procs
+				})
+				Context("the container is running", func() {
+					BeforeEach(func() {
+						Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+						_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+						Expect(err).NotTo(HaveOccurred())
+					})
+					It("should signal every process in the container's cgroup", func() {
+						Expect(coreint.SignalContainerProcesses(containerID, oslayer.SIGKILL)).To(Succeed())
+						Expect(procs.read).To(Equal([]string{"/sys/fs/cgroup/freezer/" + containerID + "/cgroup.procs"}))
+						Expect(procs.killed).To(Equal([]int{101, 205, 317}))
+						Expect(procs.signals).To(ConsistOf(syscall.SIGKILL, syscall.SIGKILL, syscall.SIGKILL))
+					})
+					Context("a process exits before it is signaled", func() {
+						BeforeEach(func() {
+							procs.exited = 205
+						})
+						It("should signal the remaining processes", func() {
+							Expect(coreint.SignalContainerProcesses(containerID, oslayer.SIGKILL)).To(Succeed())
+							Expect(procs.killed).To(Equal([]int{101, 205, 317}))
+						})
+					})
+				})
+				Context("the container has not been started", func() {
+					BeforeEach(func() {
+						Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+					})
+					It("should produce an error", func() {
+						Expect(coreint.SignalContainerProcesses(containerID, oslayer.SIGKILL)).NotTo(Succeed())
+						Expect(procs.killed).To(BeEmpty())
+					})
+				})
+			})
+			Describe("creating a container with invalid layers", func() {
+				Context("there are no layers", func() {
+					BeforeEach(func() {
+						createSettings.Layers = nil
+					})
+					It("should produce an invalid argument error", func() {
+						err = coreint.CreateContainer(context.Background(), containerID, createSettings)
+						hresult, herr := gcserr.GetHresult(err)
+						Expect(herr).NotTo(HaveOccurred())
+						Expect(hresult).To(Equal(gcserr.HrInvalidArg))
+						Expect(coreint.getContainer(containerID)).To(BeNil())
+					})
+				})
+				Context("two layers are the same device", func() {
+					BeforeEach(func() {
+						createSettings.Layers = []prot.Layer{{Path: "0"}, {Path: "1"}, {Path: "0"}}
+					})
+					It("should produce an invalid argument error", func() {
+						err = coreint.CreateContainer(context.Background(), containerID, createSettings)
+						hresult, herr := gcserr.GetHresult(err)
+						Expect(herr).NotTo(HaveOccurred())
+						Expect(hresult).To(Equal(gcserr.HrInvalidArg))
+					})
+				})
+				Context("a layer's device does not exist", func() {
+					BeforeEach(func() {
+						coreint.OS = &missingDevicesOS{OS: coreint.OS}
+					})
+					It("should produce an error before mounting the layers", func() {
+						err = coreint.CreateContainer(context.Background(), containerID, createSettings)
+						Expect(err).To(HaveOccurred())
+						Expect(err.Error()).To(ContainSubstring("invalid layer 0"))
+						Expect(err.Error()).To(ContainSubstring("does not exist"))
+						Expect(coreint.getContainer(containerID)).To(BeNil())
+					})
+				})
+			})
+			Describe("starting the init process of a container with a user", func() {
+				var (
+					recorder *configRecordingOS
+					files    map[string]string
+				)
+				BeforeEach(func() {
+					_, _, _, rootfsPath := coreint.getUnioningPaths(containerID)
+					files = map[string]string{
+						filepath.Join(rootfsPath, "etc", "passwd"): "root:x:0:0:root:/root:/bin/sh\n" +
+							"# service accounts\n" +
+							"web:x:1000:1000:Web server:/home/web:/bin/sh\n",
+						filepath.Join(rootfsPath, "etc", "group"): "root:x:0:\n" +
+							"web:x:1000:\n" +
+							"audio:x:29:web,other\n" +
+							"video:x:44:other\n" +
+							"staff:x:50:\n",
+					}
+					recorder = &configRecordingOS{OS: coreint.OS, written: make(map[string]string)}
+					coreint.OS = &containerFileOS{OS: recorder, files: files, dirs: make(map[string]bool), modes: make(map[string]os.FileMode)}
+				})
+				JustBeforeEach(func() {
+					Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+					_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+				})
+				initUser := func() oci.User {
+					var config oci.Spec
+					Expect(json.Unmarshal([]byte(recorder.written[coreint.getConfigPath(containerID)]), &config)).To(Succeed())
+					return config.Process.User
+				}
+				Context("the user is a name", func() {
+					BeforeEach(func() {
+						createSettings.User = "web"
+					})
+					It("should run the init process as the user and their groups", func() {
+						Expect(err).NotTo(HaveOccurred())
+						Expect(initUser()).To(Equal(oci.User{UID: 1000, GID: 1000, AdditionalGids: []uint32{29}}))
+					})
+				})
+				Context("the user and group are names", func() {
+					BeforeEach(func() {
+						createSettings.User = "web:staff"
+					})
+					It("should run the init process with the given group", func() {
+						Expect(err).NotTo(HaveOccurred())
+						Expect(initUser()).To(Equal(oci.User{UID: 1000, GID: 50, AdditionalGids: []uint32{29}}))
+					})
+				})
+				Context("the user is a numeric ID which is not in /etc/passwd", func() {
+					BeforeEach(func() {
+						createSettings.User = "2000:44"
+					})
+					It("should run the init process with the given IDs", func() {
+						Expect(err).NotTo(HaveOccurred())
+						Expect(initUser()).To(Equal(oci.User{UID: 2000, GID: 44}))
+					})
+				})
+				Context("the user does not exist", func() {
+					BeforeEach(func() {
+						createSettings.User = "nobody"
+					})
+					It("should produce an invalid argument error", func() {
+						hresult, herr := gcserr.GetHresult(err)
+						Expect(herr).NotTo(HaveOccurred())
+						Expect(hresult).To(Equal(gcserr.HrInvalidArg))
+						Expect(recorder.written).NotTo(HaveKey(coreint.getConfigPath(containerID)))
+					})
+				})
+			})
+			Describe("creating a container with a malformed user", func() {
+				BeforeEach(func() {
+					createSettings.User = "web:staff:extra"
+				})
+				It("should produce an invalid argument error", func() {
+					err = coreint.CreateContainer(context.Background(), containerID, createSettings)
+					hresult, herr := gcserr.GetHresult(err)
+					Expect(herr).NotTo(HaveOccurred())
+					Expect(hresult).To(Equal(gcserr.HrInvalidArg))
+				})
+			})
+			Describe("getting the creation time of a process", func() {
+				BeforeEach(func() {
+					Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+				})
+				It("should report when each process was started", func() {
+					before := time.Now()
+					initPid, err := coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+					Expect(err).NotTo(HaveOccurred())
+					created, err := coreint.GetProcessCreatedTime(initPid)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(created).To(BeTemporally(">=", before))
+					Expect(created).To(BeTemporally("<=", time.Now()))
+
+					before = time.Now()
+					externalPid, err := coreint.RunExternalProcess(externalParams, fullStdioSet)
+					Expect(err).NotTo(HaveOccurred())
+					created, err = coreint.GetProcessCreatedTime(externalPid)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(created).To(BeTemporally(">=", before))
+					Expect(created).To(BeTemporally("<=", time.Now()))
+				})
+				It("should produce an error for an unknown process", func() {
+					_, err := coreint.GetProcessCreatedTime(4242)
+					Expect(err).To(HaveOccurred())
+				})
+			})
+			Describe("starting the init process of a container with root filesystem settings", func() {
+				var recorder *configRecordingOS
+				BeforeEach(func() {
+					recorder = &configRecordingOS{OS: coreint.OS, written: make(map[string]string)}
+					coreint.OS = recorder
+					createSettings.RootReadonly = true
+					createSettings.RootfsPropagation = "rslave"
+					createSettings.Mounts = []prot.Mount{{Destination: "/scratch", Type: "tmpfs", Source: "tmpfs", Options: []string{"rw"}}}
+				})
+				It("should have runc remount the root filesystem read-only, keeping its mounts", func() {
+					Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+					_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+					Expect(err).NotTo(HaveOccurred())
+					var config oci.Spec
+					Expect(json.Unmarshal([]byte(recorder.written[coreint.getConfigPath(containerID)]), &config)).To(Succeed())
+					Expect(config.Root).NotTo(BeNil())
+					Expect(config.Root.Readonly).To(BeTrue())
+					Expect(config.Linux.RootfsPropagation).To(Equal("rslave"))
+					Expect(config.Mounts).To(ContainElement(oci.Mount{Destination: "/scratch", Type: "tmpfs", Source: "tmpfs", Options: []string{"rw"}}))
+				})
+				Context("the propagation is not supported", func() {
+					BeforeEach(func() {
+						createSettings.RootfsPropagation = "sideways"
+					})
+					It("should produce an invalid argument error", func() {
+						err = coreint.CreateContainer(context.Background(), containerID, createSettings)
+						hresult, herr := gcserr.GetHresult(err)
+						Expect(herr).NotTo(HaveOccurred())
+						Expect(hresult).To(Equal(gcserr.HrInvalidArg))
+					})
+				})
+			})
+			Describe("calling RestartInit", func() {
+				var (
+					recorder *configRecordingOS
+					rtime    *restartableRuntime
+				)
+				BeforeEach(func() {
+					recorder = &configRecordingOS{OS: coreint.OS, written: make(map[string]string)}
+					coreint.OS = recorder
+					rtime = &restartableRuntime{Runtime: coreint.Rtime}
+					coreint.Rtime = rtime
+					createSettings.OCISpecJSON = `{"ociVersion":"1.0.0","process":{"args":["/bin/server","--port","80"],"cwd":"/srv"}}`
+				})
+				JustBeforeEach(func() {
+					err = coreint.RestartInit(containerID)
+				})
+				Context("the container is running", func() {
+					BeforeEach(func() {
+						Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+						_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+						Expect(err).NotTo(HaveOccurred())
+						delete(recorder.written, coreint.getConfigPath(containerID))
+					})
+					It("should start the init process again from its original config file", func() {
+						Expect(err).NotTo(HaveOccurred())
+						Expect(rtime.createdCount()).To(Equal(2))
+						Expect(recorder.written).NotTo(HaveKey(coreint.getConfigPath(containerID)))
+					})
+					It("should keep the container", func() {
+						Expect(err).NotTo(HaveOccurred())
+						containerEntry := coreint.getContainer(containerID)
+						Expect(containerEntry).NotTo(BeNil())
+						Expect(containerEntry.initExited).To(BeFalse())
+						state, err := coreint.GetContainerState(containerID)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(state.State).To(Equal(prot.CsRunning))
+					})
+				})
+				Context("the container has a post-create hook", func() {
+					var hooks *hookOS
+					BeforeEach(func() {
+						hooks = &hookOS{OS: coreint.OS}
+						coreint.OS = hooks
+						createSettings.PostCreateHook = &prot.ContainerHook{Args: []string{"/bin/setup"}}
+						Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+						_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+						Expect(err).NotTo(HaveOccurred())
+					})
+					It("should not run the hook again", func() {
+						Expect(err).NotTo(HaveOccurred())
+						Expect(rtime.createdCount()).To(Equal(2))
+						Expect(hooks.ops).To(Equal([]string{
+							"nsenter --target=101 --mount --uts --ipc --net --pid --root --wd -- /bin/setup",
+						}))
+					})
+				})
+				Context("the init process fails to start again", func() {
+					var containerEntry *containerCacheEntry
+					BeforeEach(func() {
+						rtime.maxCreated = 1
+						Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+						_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+						Expect(err).NotTo(HaveOccurred())
+						containerEntry = coreint.getContainer(containerID)
+					})
+					It("should clean up the container", func() {
+						Expect(err).To(HaveOccurred())
+						Expect(coreint.getContainer(containerID)).To(BeNil())
+					})
+					It("should report the container as exited to waits on it", func() {
+						Expect(err).To(HaveOccurred())
+						waited := make(chan struct{})
+						go func() {
+							containerEntry.exitWg.Wait()
+							close(waited)
+						}()
+						Eventually(waited).Should(BeClosed())
+						Expect(containerEntry.initExited).To(BeTrue())
+						Expect(containerEntry.exitCode).To(Equal(-1))
+					})
+				})
+				Context("the container's init process has not been started", func() {
+					BeforeEach(func() {
+						Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+					})
+					It("should fail", func() {
+						Expect(err).To(HaveOccurred())
+						Expect(rtime.createdCount()).To(Equal(0))
+					})
+				})
+				Context("the container does not exist", func() {
+					It("should fail", func() {
+						Expect(err).To(HaveOccurred())
+					})
+				})
+			})
+			Describe("offsetting a container's clocks", func() {
+				var recorder *configRecordingOS
+				BeforeEach(func() {
+					recorder = &configRecordingOS{OS: coreint.OS, written: make(map[string]string)}
+					coreint.OS = recorder
+					createSettings.TimeOffset = &prot.TimeOffset{
+						MonotonicNanoseconds: int64(time.Hour),
+						BoottimeNanoseconds:  -int64(1500 * time.Millisecond),
+					}
+				})
+				JustBeforeEach(func() {
+					err = coreint.CreateContainer(context.Background(), containerID, createSettings)
+				})
+				It("should apply the offset to a time namespace in the container's configuration", func() {
+					Expect(err).NotTo(HaveOccurred())
+					_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+					Expect(err).NotTo(HaveOccurred())
+					var config struct {
+						Linux struct {
+							Namespaces  []oci.LinuxNamespace
+							TimeOffsets map[string]linuxTimeOffset `json:"timeOffsets"`
+						} `json:"linux"`
+					}
+					Expect(json.Unmarshal([]byte(recorder.written[coreint.getConfigPath(containerID)]), &config)).To(Succeed())
+					Expect(config.Linux.Namespaces).To(ContainElement(oci.LinuxNamespace{Type: timeNamespace}))
+					Expect(config.Linux.TimeOffsets).To(Equal(map[string]linuxTimeOffset{
+						"monotonic": {Secs: 3600, Nanosecs: 0},
+						"boottime":  {Secs: -2, Nanosecs: 500000000},
+					}))
+				})
+				It("should report the offset", func() {
+					Expect(err).NotTo(HaveOccurred())
+					offset, err := coreint.GetTimeOffset(containerID)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(offset).To(Equal(*createSettings.TimeOffset))
+				})
+				Context("the kernel does not support time namespaces", func() {
+					BeforeEach(func() {
+						coreint.OS = &absentPathsOS{OS: coreint.OS, absent: map[string]bool{timeNamespacePath: true}}
+					})
+					It("should fail with a not implemented error", func() {
+						Expect(err).To(HaveOccurred())
+						hresult, herr := gcserr.GetHresult(err)
+						Expect(herr).NotTo(HaveOccurred())
+						Expect(hresult).To(Equal(gcserr.HrNotImpl))
+						Expect(coreint.getContainer(containerID)).To(BeNil())
+					})
+				})
+				Context("no offset is given", func() {
+					BeforeEach(func() {
+						createSettings.TimeOffset = nil
+					})
+					It("should not give the container a time namespace", func() {
+						Expect(err).NotTo(HaveOccurred())
+						_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+						Expect(err).NotTo(HaveOccurred())
+						written := recorder.written[coreint.getConfigPath(containerID)]
+						Expect(written).NotTo(ContainSubstring("timeOffsets"))
+						var config oci.Spec
+						Expect(json.Unmarshal([]byte(written), &config)).To(Succeed())
+						if config.Linux != nil {
+							Expect(config.Linux.Namespaces).NotTo(ContainElement(oci.LinuxNamespace{Type: timeNamespace}))
+						}
+						offset, err := coreint.GetTimeOffset(containerID)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(offset).To(Equal(prot.TimeOffset{}))
+					})
+					It("should allow an offset to be set before the container is started", func() {
+						Expect(err).NotTo(HaveOccurred())
+						request := prot.ResourceModificationRequestResponse{
+							ResourceType: prot.PtTimeOffset,
+							RequestType:  prot.RtUpdate,
+							Settings:     &prot.TimeOffset{BoottimeNanoseconds: int64(time.Second)},
+						}
+						Expect(coreint.ModifySettings(context.Background(), containerID, request)).To(Succeed())
+						_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(recorder.written[coreint.getConfigPath(containerID)]).To(ContainSubstring(`"timeOffsets":{"boottime":{"secs":1,"nanosecs":0},"monotonic":{"secs":0,"nanosecs":0}}`))
+					})
+					It("should not allow an offset to be set once the container is started", func() {
+						Expect(err).NotTo(HaveOccurred())
+						_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+						Expect(err).NotTo(HaveOccurred())
+						request := prot.ResourceModificationRequestResponse{
+							ResourceType: prot.PtTimeOffset,
+							RequestType:  prot.RtUpdate,
+							Settings:     &prot.TimeOffset{BoottimeNanoseconds: int64(time.Second)},
+						}
+						Expect(coreint.ModifySettings(context.Background(), containerID, request)).NotTo(Succeed())
+					})
+				})
+			})
+			Describe("getting a container's network statistics", func() {
+				var (
+					fileOS *containerFileOS
+					stats  prot.ContainerNetworkStatistics
+				)
+				BeforeEach(func() {
+					fileOS = &containerFileOS{OS: coreint.OS, files: map[string]string{}, dirs: map[string]bool{}, modes: map[string]os.FileMode{}}
+					writeStats := func(name string, base uint64) {
+						for i, counter := range []string{"rx_bytes", "tx_bytes", "rx_packets", "tx_packets", "rx_errors", "tx_errors", "rx_dropped", "tx_dropped"} {
+							fileOS.files["/proc/101/root/sys/class/net/"+name+"/statistics/"+counter] = strconv.FormatUint(base+uint64(i), 10) + "\n"
+						}
+					}
+					writeStats("a", 1000)
+					writeStats("backend", 2000)
+					coreint.OS = &interfaceNamesOS{
+						OS: fileOS,
+						names: map[string]string{
+							"/proc/101/root/sys/bus/vmbus/devices/" + createSettings.NetworkAdapters[0].AdapterInstanceID + "/net": "a",
+						},
+					}
+					first := createSettings.NetworkAdapters[0]
+					second := first
+					second.AdapterInstanceID = "11111111-1111-1111-1111-111111111111"
+					second.Name = "backend"
+					createSettings.NetworkAdapters = []prot.NetworkAdapter{first, second}
+					Expect(coreint.CreateContainer(context.Background(), containerID, createSettings)).To(Succeed())
+				})
+				JustBeforeEach(func() {
+					stats, err = coreint.GetNetworkStats(containerID)
+				})
+				Context("the container is running", func() {
+					BeforeEach(func() {
+						_, err = coreint.ExecProcess(containerID, initialExecParams, fullStdioSet)
+						Expect(err).NotTo(HaveOccurred())
+					})
+					It("should report the statistics of each adapter", func() {
+						Expect(err).NotTo(HaveOccurred())
+						Expect(stats.Adapters).To(Equal([]prot.AdapterNetworkStatistics{
+							{
+								AdapterInstanceID: createSettings.NetworkAdapters[0].AdapterInstanceID,
+								InterfaceName:     "a",
+								NetworkInterfaceStatistics: prot.NetworkInterfaceStatistics{
+									RxBytes: 1000, TxBytes: 1001, RxPackets: 1002, TxPackets: 1003,
+									RxErrors: 1004, TxErrors: 1005, RxDropped: 1006, TxDropped: 1007,
+								},
+							},
+							{
+								AdapterInstanceID: "11111111-1111-1111-1111-111111111111",
+								InterfaceName:     "backend",
+								NetworkInterfaceStatistics: prot.NetworkInterfaceStatistics{
+									RxBytes: 2000, TxBytes: 2001, RxPackets: 2002, TxPackets: 2003,
+									RxErrors: 2004, TxErrors: 2005, RxDropped: 2006, TxDropped: 2007,
+								},
+							},
+						}))
+					})
+					It("should report the totals across the adapters", func() {
+						Expect(err).NotTo(HaveOccurred())
+						Expect(stats.Total).To(Equal(prot.NetworkInterfaceStatistics{
+							RxBytes: 3000, TxBytes: 3002, RxPackets: 3004, TxPackets: 3006,
+							RxErrors: 3008, TxErrors: 3010, RxDropped: 3012, TxDropped: 3014,
+						}))
+					})
+					Context("a counter is not a number", func() {
+						BeforeEach(func() {
+							fileOS.files["/proc/101/root/sys/class/net/backend/statistics/rx_bytes"] = "lots\n"
+						})
+						It("should fail", func() {
+							Expect(err).To(HaveOccurred())
+						})
+					})
+				})
+				Context("the container has not been started", func() {
+					It("should fail", func() {
+						Expect(err).To(HaveOccurred())
+					})
+				})
+			})
+		})
+	})
+})
+
+// pathRecordingOS records the paths of files opened and directories read
+// through it, delegating the operations themselves to the wrapped OS.
+type pathRecordingOS struct {
+	oslayer.OS
+	opened   []string
+	readDirs []string
+}
+
+func (o *pathRecordingOS) OpenFile(name string, flag int, perm os.FileMode) (oslayer.File, error) {
+	o.opened = append(o.opened, name)
+	return o.OS.OpenFile(name, flag, perm)
+}
+
+func (o *pathRecordingOS) ReadDir(dirname string) ([]os.FileInfo, error) {
+	o.readDirs = append(o.readDirs, dirname)
+	return o.OS.ReadDir(dirname)
+}
+
+// flakyDeviceOS fails the first readDirFailures directory reads through it, as
+// when a disk attached by the host has not yet appeared in the guest.
+type flakyDeviceOS struct {
+	oslayer.OS
+	readDirFailures int
+	readDirs        int
+	scans           int
+}
+
+func (o *flakyDeviceOS) OpenFile(name string, flag int, perm os.FileMode) (oslayer.File, error) {
+	if strings.HasPrefix(name, "/sys/class/scsi_host/") {
+		o.scans++
+	}
+	return o.OS.OpenFile(name, flag, perm)
+}
+
+func (o *flakyDeviceOS) ReadDir(dirname string) ([]os.FileInfo, error) {
+	o.readDirs++
+	if o.readDirs <= o.readDirFailures {
+		return nil, errors.Errorf("%s does not exist", dirname)
+	}
+	return o.OS.ReadDir(dirname)
+}
+
+// mountRecordingOS records the mounts, unmounts and removals made through it,
+// in order, delegating the operations themselves to the wrapped OS.
+type mountRecordingOS struct {
+	oslayer.OS
+	ops []string
+}
+
+func (o *mountRecordingOS) Mount(source string, target string, fstype string, flags uintptr, data string) error {
+	if flags&syscall.MS_BIND != 0 {
+		o.ops = append(o.ops, "bind "+source+" "+target)
+	} else {
+		o.ops = append(o.ops, "mount "+source+" "+target)
+	}
+	return o.OS.Mount(source, target, fstype, flags, data)
+}
+
+func (o *mountRecordingOS) Unmount(target string, flags int) error {
+	o.ops = append(o.ops, "unmount "+target)
+	return o.OS.Unmount(target, flags)
+}
+
+func (o *mountRecordingOS) RemoveAll(path string) error {
+	o.ops = append(o.ops, "remove "+path)
+	return o.OS.RemoveAll(path)
+}
+
+// flakyMountOS fails mounts through it with the errors in mountErrors, in
+// order, before delegating to the wrapped OS.
+type flakyMountOS struct {
+	oslayer.OS
+	mountErrors []error
+	mounts      int
+}
+
+func (o *flakyMountOS) Mount(source string, target string, fstype string, flags uintptr, data string) error {
+	o.mounts++
+	if o.mounts <= len(o.mountErrors) {
+		return errors.WithStack(o.mountErrors[o.mounts-1])
+	}
+	return o.OS.Mount(source, target, fstype, flags, data)
+}
+
+// cgroupRecordingOS reports either a cgroup v1 or v2 hierarchy, and records
+// the values written to files under the cgroup root and to drop_caches. If
+// denied is set, opening those files fails with a permission error instead.
+type cgroupRecordingOS struct {
+	oslayer.OS
+	unified bool
+	denied  bool
+	written map[string]string
+}
+
+func (o *cgroupRecordingOS) Statfs(path string, buf *syscall.Statfs_t) error {
+	if err := o.OS.Statfs(path, buf); err != nil {
+		return err
+	}
+	if o.unified && path == oslayer.CgroupRoot {
+		buf.Type = 0x63677270
+	}
+	return nil
+}
+
+func (o *cgroupRecordingOS) OpenFile(name string, flag int, perm os.FileMode) (oslayer.File, error) {
+	if !strings.HasPrefix(name, oslayer.CgroupRoot+"/") && name != oslayer.DropCachesPath {
+		return o.OS.OpenFile(name, flag, perm)
+	}
+	if o.denied {
+		return nil, errors.WithStack(&os.PathError{Op: "open", Path: name, Err: syscall.EACCES})
+	}
+	return &recordedFile{name: name, written: o.written}, nil
+}
+
+// recordedFile stores everything written to it in written, keyed by name.
+type recordedFile struct {
+	name    string
+	written map[string]string
+}
+
+func (f *recordedFile) Read(p []byte) (int, error) {
+	return 0, io.EOF
+}
+
+func (f *recordedFile) Write(p []byte) (int, error) {
+	f.written[f.name] += string(p)
+	return len(p), nil
+}
+
+func (f *recordedFile) Close() error {
+	return nil
+}
+
+// readinessOS reports a path ending in name as missing for the first
+// missingChecks checks of it, or forever if missingChecks is negative.
+type readinessOS struct {
+	oslayer.OS
+	name          string
+	missingChecks int
+	checks        int
+	path          string
+}
+
+func (o *readinessOS) PathExists(name string) (bool, error) {
+	if filepath.Base(name) != o.name {
+		return o.OS.PathExists(name)
+	}
+	o.checks++
+	o.path = name
+	if o.missingChecks < 0 || o.checks <= o.missingChecks {
+		return false, nil
+	}
+	return true, nil
+}
+
+// termIgnoringRuntime creates containers whose init processes record the
+// signals sent to them and ignore SIGTERM.
+type termIgnoringRuntime struct {
+	runtime.Runtime
+	mu      sync.Mutex
+	signals []oslayer.Signal
+}
+
+func (r *termIgnoringRuntime) CreateContainer(id string, bundlePath string, stdioSet *stdio.ConnectionSet) (runtime.Container, error) {
+	container, err := r.Runtime.CreateContainer(id, bundlePath, stdioSet)
+	if err != nil {
+		return nil, err
+	}
+	return &termIgnoringContainer{Container: container, r: r}, nil
+}
+
+// sentSignals returns the signals sent to the runtime's containers so far.
+func (r *termIgnoringRuntime) sentSignals() []oslayer.Signal {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]oslayer.Signal{}, r.signals...)
+}
+
+type termIgnoringContainer struct {
+	runtime.Container
+	r *termIgnoringRuntime
+}
+
+func (c *termIgnoringContainer) Kill(signal oslayer.Signal) error {
+	c.r.mu.Lock()
+	c.r.signals = append(c.r.signals, signal)
+	c.r.mu.Unlock()
+	if signal == oslayer.SIGTERM {
+		return nil
+	}
+	return c.Container.Kill(signal)
+}
+
+// restartableRuntime creates containers whose init processes exit when they
+// are first signalled, and counts the containers it creates and deletes. If
+// maxCreated is set, creating any more containers than that fails.
+type restartableRuntime struct {
+	runtime.Runtime
+	mu         sync.Mutex
+	created    int
+	deleted    int
+	maxCreated int
+}
+
+func (r *restartableRuntime) CreateContainer(id string, bundlePath string, stdioSet *stdio.ConnectionSet) (runtime.Container, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.maxCreated > 0 && r.created >= r.maxCreated {
+		return nil, errors.New("failed to create container")
+	}
+	container, err := r.Runtime.CreateContainer(id, bundlePath, stdioSet)
+	if err != nil {
+		return nil, err
+	}
+	r.created++
+	return &restartableContainer{Container: container, r: r, exited: make(chan struct{})}, nil
+}
+
+// createdCount returns the number of containers the runtime has created.
+func (r *restartableRuntime) createdCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.created
+}
+
+// deletedCount returns the number of containers the runtime has deleted.
+func (r *restartableRuntime) deletedCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.deleted
+}
+
+type restartableContainer struct {
+	runtime.Container
+	r      *restartableRuntime
+	once   sync.Once
+	exited chan struct{}
+}
+
+func (c *restartableContainer) Delete() error {
+	c.r.mu.Lock()
+	c.r.deleted++
+	c.r.mu.Unlock()
+	return c.Container.Delete()
+}
+
+func (c *restartableContainer) Kill(signal oslayer.Signal) error {
+	c.once.Do(func() { close(c.exited) })
+	return nil
+}
+
+func (c *restartableContainer) Wait() (oslayer.ProcessExitState, error) {
+	<-c.exited
+	return mockos.NewProcessExitState(143), nil
+}
+
+// absentPathsOS reports the paths in absent as not existing.
+type absentPathsOS struct {
+	oslayer.OS
+	absent map[string]bool
+}
+
+func (o *absentPathsOS) PathExists(name string) (bool, error) {
+	if o.absent[name] {
+		return false, nil
+	}
+	return o.OS.PathExists(name)
+}
+
+// interfaceNamesOS lists the interface named in names, keyed by directory,
+// as the only entry of each of those directories.
+type interfaceNamesOS struct {
+	oslayer.OS
+	names map[string]string
+}
+
+func (o *interfaceNamesOS) ReadDir(dirname string) ([]os.FileInfo, error) {
+	if name, ok := o.names[dirname]; ok {
+		return []os.FileInfo{namedFileInfo{name: name}}, nil
+	}
+	return o.OS.ReadDir(dirname)
+}
+
+// namedFileInfo is a directory entry with only a name.
+type namedFileInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (i namedFileInfo) Name() string {
+	return i.name
+}
+
+// execRecordingRuntime creates containers which record the arguments of each
+// process exec'd in them.
+type execRecordingRuntime struct {
+	runtime.Runtime
+	mutex sync.Mutex
+	args  [][]string
+}
+
+func (r *execRecordingRuntime) CreateContainer(id string, bundlePath string, stdioSet *stdio.ConnectionSet) (runtime.Container, error) {
+	container, err := r.Runtime.CreateContainer(id, bundlePath, stdioSet)
+	if err != nil {
+		return nil, err
+	}
+	return &execRecordingContainer{Container: container, r: r}, nil
+}
+
+func (r *execRecordingRuntime) execArgs() [][]string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.args
+}
+
+type execRecordingContainer struct {
+	runtime.Container
+	r *execRecordingRuntime
+}
+
+func (c *execRecordingContainer) ExecProcess(process oci.Process, stdioSet *stdio.ConnectionSet) (runtime.Process, error) {
+	c.r.mutex.Lock()
+	c.r.args = append(c.r.args, process.Args)
+	c.r.mutex.Unlock()
+	return c.Container.ExecProcess(process, stdioSet)
+}
+
+// exitingRuntime creates containers whose exec'd processes have already
+// exited by the time they are waited on.
+type exitingRuntime struct {
+	runtime.Runtime
+}
+
+func (r *exitingRuntime) CreateContainer(id string, bundlePath string, stdioSet *stdio.ConnectionSet) (runtime.Container, error) {
+	container, err := r.Runtime.CreateContainer(id, bundlePath, stdioSet)
+	if err != nil {
+		return nil, err
+	}
+	return &exitingContainer{Container: container}, nil
+}
+
+type exitingContainer struct {
+	runtime.Container
+}
+
+func (c *exitingContainer) ExecProcess(process oci.Process, stdioSet *stdio.ConnectionSet) (runtime.Process, error) {
+	p, err := c.Container.ExecProcess(process, stdioSet)
+	if err != nil {
+		return nil, err
+	}
+	return &exitedProcess{Process: p}, nil
+}
+
+type exitedProcess struct {
+	runtime.Process
+}
+
+func (p *exitedProcess) Wait() (oslayer.ProcessExitState, error) {
+	return mockos.NewProcessExitState(0), nil
+}
+
+// closeRecordingConnection records the close operations performed on it, in
+// order.
+type closeRecordingConnection struct {
+	transport.Connection
+	mu     sync.Mutex
+	closes []string
+}
+
+func (c *closeRecordingConnection) record(op string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closes = append(c.closes, op)
+}
+
+func (c *closeRecordingConnection) ops() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string{}, c.closes...)
+}
+
+func (c *closeRecordingConnection) Close() error {
+	c.record("Close")
+	return c.Connection.Close()
+}
+
+func (c *closeRecordingConnection) CloseRead() error {
+	c.record("CloseRead")
+	return c.Connection.CloseRead()
+}
+
+func (c *closeRecordingConnection) CloseWrite() error {
+	c.record("CloseWrite")
+	return c.Connection.CloseWrite()
+}
+
+// commandRecordingOS records the command lines of the commands created
+// through it, delegating the commands themselves to the wrapped OS.
+type commandRecordingOS struct {
+	oslayer.OS
+	commands []string
+}
+
+func (o *commandRecordingOS) Command(name string, arg ...string) oslayer.Cmd {
+	o.commands = append(o.commands, strings.Join(append([]string{name}, arg...), " "))
+	return o.OS.Command(name, arg...)
+}
+
+// argvRecordingOS records the argument vector of each command created through
+// it, delegating the commands themselves to the wrapped OS.
+type argvRecordingOS struct {
+	oslayer.OS
+	argv [][]string
+}
+
+func (o *argvRecordingOS) Command(name string, arg ...string) oslayer.Cmd {
+	o.argv = append(o.argv, append([]string{name}, arg...))
+	return o.OS.Command(name, arg...)
+}
+
+// unshareRecordingOS records the unshare flags set on each command created
+// through it. If noMountNamespaces is set, it reports the kernel as lacking
+// mount namespace support.
+type unshareRecordingOS struct {
+	oslayer.OS
+	flags             []uintptr
+	noMountNamespaces bool
+}
+
+func (o *unshareRecordingOS) Command(name string, arg ...string) oslayer.Cmd {
+	return &unshareRecordingCmd{Cmd: o.OS.Command(name, arg...), os: o}
+}
+
+func (o *unshareRecordingOS) PathExists(name string) (bool, error) {
+	if name == mountNamespacePath && o.noMountNamespaces {
+		return false, nil
+	}
+	return o.OS.PathExists(name)
+}
+
+type unshareRecordingCmd struct {
+	oslayer.Cmd
+	os *unshareRecordingOS
+}
+
+func (c *unshareRecordingCmd) SetUnshareflags(flags uintptr) {
+	c.os.flags = append(c.os.flags, flags)
+	c.Cmd.SetUnshareflags(flags)
+}
+
+// orphanedZombiePid and orphanedRunningPid are the pids of the extra
+// processes listed in containers created by zombieRuntime.
+const (
+	orphanedZombiePid  = 456
+	orphanedRunningPid = 789
+)
+
+// zombieRuntime creates containers which list an orphaned zombie process and
+// an orphaned running process along with their other processes.
+type zombieRuntime struct {
+	runtime.Runtime
+}
+
+func (r *zombieRuntime) CreateContainer(id string, bundlePath string, stdioSet *stdio.ConnectionSet) (runtime.Container, error) {
+	container, err := r.Runtime.CreateContainer(id, bundlePath, stdioSet)
+	if err != nil {
+		return nil, err
+	}
+	return &zombieContainer{Container: container}, nil
+}
+
+type zombieContainer struct {
+	runtime.Container
+}
+
+func (c *zombieContainer) GetAllProcesses() ([]runtime.ContainerProcessState, error) {
+	processes, err := c.Container.GetAllProcesses()
+	if err != nil {
+		return nil, err
+	}
+	return append(processes,
+		runtime.ContainerProcessState{Pid: orphanedZombiePid, Command: []string{""}, IsZombie: true},
+		runtime.ContainerProcessState{Pid: orphanedRunningPid, Command: []string{"sleep", "100"}},
+	), nil
+}
+
+// waitRecordingOS records the pids waited on through it.
+type waitRecordingOS struct {
+	oslayer.OS
+	waited []int
+}
+
+func (o *waitRecordingOS) Wait4(pid int, wstatus *syscall.WaitStatus, options int, rusage *syscall.Rusage) (int, error) {
+	o.waited = append(o.waited, pid)
+	return o.OS.Wait4(pid, wstatus, options, rusage)
+}
+
+// probeOS reports only the paths in existing as existing, reports the cgroup
+// v2 hierarchy as mounted if cgroup2 is set, and reports a fixed kernel
+// release, so that guest capability probes can be controlled.
+type probeOS struct {
+	oslayer.OS
+	existing map[string]bool
+	cgroup2  bool
+}
+
+func (o *probeOS) PathExists(name string) (bool, error) {
+	return o.existing[name], nil
+}
+
+func (o *probeOS) Statfs(path string, buf *syscall.Statfs_t) error {
+	if err := o.OS.Statfs(path, buf); err != nil {
+		return err
+	}
+	if o.cgroup2 && path == oslayer.CgroupRoot {
+		buf.Type = 0x63677270
+	}
+	return nil
+}
+
+func (o *probeOS) KernelRelease() (string, error) {
+	return "4.14.0-probe", nil
+}
+
+// steppingClock is a clock which advances by step each time it is read.
+type steppingClock struct {
+	mutex   sync.Mutex
+	now     time.Time
+	step    time.Duration
+	elapsed time.Duration
+}
+
+func (c *steppingClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	now := c.now.Add(c.elapsed)
+	c.elapsed += c.step
+	return now
+}
+
+// Elapsed returns the time between the first and the most recent reading of
+// the clock.
+func (c *steppingClock) Elapsed() time.Duration {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.elapsed == 0 {
+		return 0
+	}
+	return c.elapsed - c.step
+}
+
+// containerFileOS serves the regular files in files, with their contents, and
+// the directories in dirs to Stat and OpenFile. Any other path under /proc does
+// not exist. Files created under /proc are added to files, and the modes they
+// are given with Chmod are recorded in modes.
+type containerFileOS struct {
+	oslayer.OS
+	files   map[string]string
+	dirs    map[string]bool
+	modes   map[string]os.FileMode
+	renamed []string
+}
+
+func (o *containerFileOS) Stat(path string, buf *syscall.Stat_t) error {
+	if contents, ok := o.files[path]; ok {
+		*buf = syscall.Stat_t{Mode: syscall.S_IFREG | 0644, Size: int64(len(contents))}
+		return nil
+	}
+	if o.dirs[path] {
+		*buf = syscall.Stat_t{Mode: syscall.S_IFDIR | 0755}
+		return nil
+	}
+	if !strings.HasPrefix(path, "/proc/") {
+		return o.OS.Stat(path, buf)
+	}
+	return errors.WithStack(&os.PathError{Op: "stat", Path: path, Err: syscall.ENOENT})
+}
+
+func (o *containerFileOS) OpenFile(name string, flag int, perm os.FileMode) (oslayer.File, error) {
+	if flag&os.O_CREATE != 0 && strings.HasPrefix(name, "/proc/") {
+		o.files[name] = ""
+		return &recordedFile{name: name, written: o.files}, nil
+	}
+	if contents, ok := o.files[name]; ok {
+		return &readOnlyFile{Reader: strings.NewReader(contents)}, nil
+	}
+	return o.OS.OpenFile(name, flag, perm)
+}
+
+func (o *containerFileOS) Chmod(name string, mode os.FileMode) error {
+	if _, ok := o.files[name]; !ok {
+		return errors.WithStack(&os.PathError{Op: "chmod", Path: name, Err: syscall.ENOENT})
+	}
+	o.modes[name] = mode
+	return nil
+}
+
+func (o *containerFileOS) Rename(oldpath, newpath string) error {
+	contents, ok := o.files[oldpath]
+	if !ok {
+		return errors.WithStack(&os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.ENOENT})
+	}
+	o.files[newpath] = contents
+	o.modes[newpath] = o.modes[oldpath]
+	delete(o.files, oldpath)
+	delete(o.modes, oldpath)
+	o.renamed = append(o.renamed, oldpath+" -> "+newpath)
+	return nil
+}
+
+// readOnlyFile is a file which can only be read.
+type readOnlyFile struct {
+	io.Reader
+}
+
+func (f *readOnlyFile) Write(p []byte) (int, error) {
+	return 0, errors.New("the file is read-only")
+}
+
+func (f *readOnlyFile) Close() error {
+	return nil
+}
+
+// secretsOS records the filesystem type of each mount made through it, keyed
+// by target, the targets unmounted, and the modes set with Chmod, keyed by
+// name, as well as the files written through it.
+type secretsOS struct {
+	*configRecordingOS
+	fstypes   map[string]string
+	unmounted []string
+	modes     map[string]os.FileMode
+}
+
+func (o *secretsOS) Mount(source string, target string, fstype string, flags uintptr, data string) error {
+	o.fstypes[target] = fstype
+	return o.OS.Mount(source, target, fstype, flags, data)
+}
+
+func (o *secretsOS) Unmount(target string, flags int) error {
+	o.unmounted = append(o.unmounted, target)
+	return o.OS.Unmount(target, flags)
+}
+
+func (o *secretsOS) Chmod(name string, mode os.FileMode) error {
+	o.modes[name] = mode
+	return nil
+}
+
+// fdCountingOS serves directories under /proc with the number of entries in
+// counts, keyed by path. Any other directory under /proc does not exist.
+type fdCountingOS struct {
+	oslayer.OS
+	counts map[string]int
+}
+
+func (o *fdCountingOS) ReadDir(dirname string) ([]os.FileInfo, error) {
+	if !strings.HasPrefix(dirname, "/proc/") {
+		return o.OS.ReadDir(dirname)
+	}
+	count, ok := o.counts[dirname]
+	if !ok {
+		return nil, errors.WithStack(&os.PathError{Op: "open", Path: dirname, Err: syscall.ENOENT})
+	}
+	return make([]os.FileInfo, count), nil
+}
+
+// hookOS records, in order, the command lines of the nsenter and chroot
+// commands which run container hooks, and the unmounts made through it. The
+// hook commands write output and fail with waitErr if it is set. Other
+// commands are delegated to the wrapped OS.
+type hookOS struct {
+	oslayer.OS
+	ops     []string
+	output  string
+	waitErr error
+}
+
+func (o *hookOS) Command(name string, arg ...string) oslayer.Cmd {
+	if name != "nsenter" && name != "chroot" {
+		return o.OS.Command(name, arg...)
+	}
+	o.ops = append(o.ops, strings.Join(append([]string{name}, arg...), " "))
+	return &hookCmd{Cmd: o.OS.Command(name, arg...), os: o}
+}
+
+func (o *hookOS) Unmount(target string, flags int) error {
+	o.ops = append(o.ops, "unmount "+target)
+	return o.OS.Unmount(target, flags)
+}
+
+// hookCmd is a command created by hookOS.
+type hookCmd struct {
+	oslayer.Cmd
+	os     *hookOS
+	stdout io.Writer
+}
+
+func (c *hookCmd) SetStdout(stdout io.Writer) {
+	c.stdout = stdout
+}
+
+func (c *hookCmd) Wait() error {
+	if c.stdout != nil {
+		io.WriteString(c.stdout, c.os.output)
+	}
+	return c.os.waitErr
+}
+
+// existingPathsOS reports every directory created through it as already
+// existing, as the real OS does when mkdir races with another creator, and
+// records the paths in created. Paths in files are reported as regular files,
+// block devices as block devices, and all others as directories.
+type existingPathsOS struct {
+	oslayer.OS
+	files   map[string]bool
+	created []string
+}
+
+func (o *existingPathsOS) MkdirAll(path string, perm os.FileMode) error {
+	o.created = append(o.created, path)
+	return &os.PathError{Op: "mkdir", Path: path, Err: syscall.EEXIST}
+}
+
+func (o *existingPathsOS) Stat(path string, buf *syscall.Stat_t) error {
+	if err := o.OS.Stat(path, buf); err != nil {
+		return err
+	}
+	if buf.Mode&syscall.S_IFMT == syscall.S_IFBLK {
+		return nil
+	}
+	if o.files[path] {
+		buf.Mode = syscall.S_IFREG | 0644
+	} else {
+		buf.Mode = syscall.S_IFDIR | 0755
+	}
+	return nil
+}
+
+// renameRecordingOS moves the recorded contents of files renamed through it
+// to their new names, and records each rename in renamed.
+type renameRecordingOS struct {
+	*configRecordingOS
+	renamed []string
+}
+
+func (o *renameRecordingOS) Rename(oldpath, newpath string) error {
+	o.renamed = append(o.renamed, oldpath+" -> "+newpath)
+	o.written[newpath] = o.written[oldpath]
+	delete(o.written, oldpath)
+	return nil
+}
+
+// quotaOS reports every filesystem as having type fsType, serves mounts as
+// the utility VM's mount table, and records the command lines of the commands
+// created through it.
+type quotaOS struct {
+	*commandRecordingOS
+	fsType int64
+	mounts string
+}
+
+func (o *quotaOS) Statfs(path string, buf *syscall.Statfs_t) error {
+	if err := o.commandRecordingOS.Statfs(path, buf); err != nil {
+		return err
+	}
+	buf.Type = o.fsType
+	return nil
+}
+
+func (o *quotaOS) OpenFile(name string, flag int, perm os.FileMode) (oslayer.File, error) {
+	if name == mountTablePath {
+		file := mockos.NewMockReadWriteCloser()
+		file.Write([]byte(o.mounts))
+		return file, nil
+	}
+	return o.commandRecordingOS.OpenFile(name, flag, perm)
+}
+
+// statmOS serves contents as the GCS's /proc/self/statm.
+type statmOS struct {
+	oslayer.OS
+	contents string
+}
+
+func (o *statmOS) OpenFile(name string, flag int, perm os.FileMode) (oslayer.File, error) {
+	if name == selfStatmPath {
+		file := mockos.NewMockReadWriteCloser()
+		file.Write([]byte(o.contents))
+		return file, nil
+	}
+	return o.OS.OpenFile(name, flag, perm)
+}
+
+// cgroupProcsOS serves procs as the contents of every cgroup.procs file, and
+// records the paths of the cgroup.procs files read and the pids and signals
+// of the processes killed through it. Killing the pid exited fails with ESRCH.
+type cgroupProcsOS struct {
+	oslayer.OS
+	procs   string
+	exited  int
+	read    []string
+	killed  []int
+	signals []syscall.Signal
+}
+
+func (o *cgroupProcsOS) OpenFile(name string, flag int, perm os.FileMode) (oslayer.File, error) {
+	if filepath.Base(name) == "cgroup.procs" {
+		o.read = append(o.read, name)
+		file := mockos.NewMockReadWriteCloser()
+		file.Write([]byte(o.procs))
+		return file, nil
+	}
+	return o.OS.OpenFile(name, flag, perm)
+}
+
+func (o *cgroupProcsOS) Kill(pid int, sig syscall.Signal) error {
+	o.killed = append(o.killed, pid)
+	o.signals = append(o.signals, sig)
+	if pid == o.exited {
+		return errors.WithStack(syscall.ESRCH)
+	}
+	return o.OS.Kill(pid, sig)
+}
+
+// missingDevicesOS reports that nothing exists under /dev.
+type missingDevicesOS struct {
+	oslayer.OS
+}
+
+func (o *missingDevicesOS) Stat(path string, buf *syscall.Stat_t) error {
+	if strings.HasPrefix(path, "/dev/") {
+		return errors.WithStack(syscall.ENOENT)
+	}
+	return o.OS.Stat(path, buf)
+}
+
+// mountDataRecordingOS records the data passed to each mount made through it,
+// keyed by target, delegating the mounts themselves to the wrapped OS.
+type mountDataRecordingOS struct {
+	oslayer.OS
+	data map[string]string
+}
+
+func (o *mountDataRecordingOS) Mount(source string, target string, fstype string, flags uintptr, data string) error {
+	o.data[target] = data
+	return o.OS.Mount(source, target, fstype, flags, data)
+}
+
+// deletedContainer is a container which no longer exists in the runtime.
+type deletedContainer struct {
+	runtime.Container
+}
+
+func (c *deletedContainer) Exists() (bool, error) {
+	return false, nil
+}
+
+// mountTableOS serves contents as the utility VM's mount table.
+type mountTableOS struct {
+	oslayer.OS
+	contents string
+}
+
+func (o *mountTableOS) OpenFile(name string, flag int, perm os.FileMode) (oslayer.File, error) {
+	if name == mountTablePath {
+		file := mockos.NewMockReadWriteCloser()
+		file.Write([]byte(o.contents))
+		return file, nil
+	}
+	return o.OS.OpenFile(name, flag, perm)
+}
+
+// hotRemoveOS records the syncs, unmounts and file opens made through it, in
+// order. Unmounts fail with unmountErr if it is set.
+type hotRemoveOS struct {
+	oslayer.OS
+	ops        []string
+	unmountErr error
+}
+
+func (o *hotRemoveOS) Syncfs(path string) error {
+	o.ops = append(o.ops, "syncfs "+path)
+	return o.OS.Syncfs(path)
+}
+
+func (o *hotRemoveOS) Unmount(target string, flags int) error {
+	o.ops = append(o.ops, "unmount "+target)
+	if o.unmountErr != nil {
+		return errors.WithStack(o.unmountErr)
+	}
+	return o.OS.Unmount(target, flags)
+}
+
+func (o *hotRemoveOS) OpenFile(name string, flag int, perm os.FileMode) (oslayer.File, error) {
+	o.ops = append(o.ops, "open "+name)
+	return o.OS.OpenFile(name, flag, perm)
+}
+
+// configRecordingOS records the contents of the files created or opened for
+// writing through it in written, keyed by name.
+type configRecordingOS struct {
+	oslayer.OS
+	written map[string]string
+}
+
+func (o *configRecordingOS) Create(name string) (oslayer.File, error) {
+	return &recordedFile{name: name, written: o.written}, nil
+}
+
+func (o *configRecordingOS) OpenFile(name string, flag int, perm os.FileMode) (oslayer.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return o.OS.OpenFile(name, flag, perm)
+	}
+	return &recordedFile{name: name, written: o.written}, nil
+}
@@ -0,0 +1,55 @@
+package gcs
+
+import (
+	"sort"
+
+	"github.com/Microsoft/opengcs/service/gcs/oslayer"
+	"github.com/Microsoft/opengcs/service/gcs/prot"
+	"github.com/pkg/errors"
+)
+
+// GCSVersion is the version of the GCS build, as reported by GetGuestInfo.
+var GCSVersion = "unknown"
+
+// guestFeaturePaths lists the features reported by GetGuestInfo which are
+// detected by the existence of a path.
+var guestFeaturePaths = []struct {
+	feature string
+	path    string
+}{
+	{prot.GuestFeatureSeccomp, "/proc/sys/kernel/seccomp"},
+	{prot.GuestFeatureVerity, "/sys/module/dm_verity"},
+	{prot.GuestFeatureMountNamespaces, mountNamespacePath},
+	{prot.GuestFeatureTimeNamespaces, timeNamespacePath},
+}
+
+// GetGuestInfo returns the version of the utility VM's kernel and of the GCS,
+// along with the features the utility VM supports.
+func (c *gcsCore) GetGuestInfo() (prot.GuestInfo, error) {
+	release, err := c.OS.KernelRelease()
+	if err != nil {
+		return prot.GuestInfo{}, errors.Wrap(err, "failed to get the kernel release")
+	}
+	info := prot.GuestInfo{
+		KernelVersion: release,
+		GCSVersion:    GCSVersion,
+	}
+	for _, probe := range guestFeaturePaths {
+		exists, err := c.OS.PathExists(probe.path)
+		if err != nil {
+			return prot.GuestInfo{}, errors.Wrapf(err, "failed to probe for %s support at %s", probe.feature, probe.path)
+		}
+		if exists {
+			info.Features = append(info.Features, probe.feature)
+		}
+	}
+	version, err := oslayer.DetectCgroupVersion(c.OS)
+	if err != nil {
+		return prot.GuestInfo{}, errors.Wrapf(err, "failed to probe for %s support", prot.GuestFeatureCgroupV2)
+	}
+	if version == oslayer.CgroupV2 {
+		info.Features = append(info.Features, prot.GuestFeatureCgroupV2)
+	}
+	sort.Strings(info.Features)
+	return info, nil
+}
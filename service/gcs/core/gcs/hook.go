@@ -0,0 +1,95 @@
+package gcs
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+
+	"github.com/Microsoft/opengcs/service/gcs/gcserr"
+	"github.com/Microsoft/opengcs/service/gcs/prot"
+	"github.com/Microsoft/opengcs/service/gcs/stdio"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultHookTimeout is how long a container hook may run if its settings do
+// not give a timeout.
+const defaultHookTimeout = 60 * time.Second
+
+// validateHook returns an HrInvalidArg error if hook is set but has no
+// command.
+func validateHook(hook *prot.ContainerHook) error {
+	if hook != nil && len(hook.Args) == 0 {
+		return gcserr.WrapHresult(errors.New("the hook has no command"), gcserr.HrInvalidArg)
+	}
+	return nil
+}
+
+// runPostCreateHook runs the container's post-create hook, if it has one, in
+// the namespaces and root filesystem of its created but not yet started init
+// process.
+func (c *gcsCore) runPostCreateHook(containerEntry *containerCacheEntry) error {
+	if containerEntry.postCreateHook == nil {
+		return nil
+	}
+	prefix := []string{
+		"nsenter",
+		fmt.Sprintf("--target=%d", containerEntry.container.Pid()),
+		"--mount", "--uts", "--ipc", "--net", "--pid", "--root", "--wd",
+		"--",
+	}
+	return c.runHook(containerEntry.ID, "post-create", prefix, containerEntry.postCreateHook)
+}
+
+// runPreDeleteHook runs the container's pre-delete hook, if it has one, with
+// its root filesystem as the root directory. The container's namespaces may
+// already be gone by the time it is deleted, so the hook runs in the utility
+// VM's.
+func (c *gcsCore) runPreDeleteHook(containerEntry *containerCacheEntry) error {
+	if containerEntry.preDeleteHook == nil {
+		return nil
+	}
+	_, _, _, rootfsPath := c.getUnioningPaths(containerEntry.ID)
+	prefix := []string{"chroot", rootfsPath}
+	return c.runHook(containerEntry.ID, "pre-delete", prefix, containerEntry.preDeleteHook)
+}
+
+// runHook runs hook for the container with the given ID, with its arguments
+// appended to prefix. The hook's output is included in the error if it fails
+// or does not exit within its timeout, in which case it is killed.
+func (c *gcsCore) runHook(id, kind string, prefix []string, hook *prot.ContainerHook) error {
+	timeout := defaultHookTimeout
+	if hook.TimeoutMs != 0 {
+		timeout = time.Duration(hook.TimeoutMs) * time.Millisecond
+	}
+
+	args := append(append([]string{}, prefix...), hook.Args...)
+	cmd := c.OS.Command(args[0], args[1:]...)
+	output := stdio.NewCappedBuffer()
+	cmd.SetStdout(output)
+	cmd.SetStderr(output)
+	if err := cmd.Start(); err != nil {
+		return errors.Wrapf(err, "failed to start %s hook %v for container %s", kind, hook.Args, id)
+	}
+	waitErr := make(chan error, 1)
+	go func() {
+		waitErr <- cmd.Wait()
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-waitErr:
+		if err != nil {
+			return errors.Wrapf(err, "%s hook %v for container %s failed: %s", kind, hook.Args, id, output.Bytes())
+		}
+	case <-timer.C:
+		if err := c.OS.Kill(cmd.Process().Pid(), syscall.SIGKILL); err != nil {
+			logrus.Warnf("failed to kill %s hook %v for container %s: %s", kind, hook.Args, id, err)
+		}
+		<-waitErr
+		return gcserr.WrapHresult(errors.Errorf("%s hook %v for container %s did not exit within %s: %s", kind, hook.Args, id, timeout, output.Bytes()), gcserr.HrTimeout)
+	}
+	logrus.Debugf("%s hook %v for container %s output:\n%s", kind, hook.Args, id, output.Bytes())
+	return nil
+}
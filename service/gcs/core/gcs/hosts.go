@@ -0,0 +1,115 @@
+package gcs
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Microsoft/opengcs/service/gcs/gcserr"
+	"github.com/Microsoft/opengcs/service/gcs/prot"
+	oci "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// maxHostnameLength is the longest hostname the kernel allows in a UTS
+// namespace.
+const maxHostnameLength = 64
+
+// validateHostname returns an HrInvalidArg error if name cannot be used as a
+// container's hostname.
+func validateHostname(name string) error {
+	if len(name) > maxHostnameLength {
+		return gcserr.WrapHresult(errors.Errorf("hostname \"%s\" is longer than %d characters", name, maxHostnameLength), gcserr.HrInvalidArg)
+	}
+	if strings.ContainsAny(name, " \t\n\x00") {
+		return gcserr.WrapHresult(errors.Errorf("hostname \"%s\" contains whitespace", name), gcserr.HrInvalidArg)
+	}
+	return nil
+}
+
+// validateHostsEntries returns an HrInvalidArg error if any of entries does
+// not have a valid IP address and at least one valid hostname.
+func validateHostsEntries(entries []prot.HostsEntry) error {
+	for _, entry := range entries {
+		if net.ParseIP(entry.IP) == nil {
+			return gcserr.WrapHresult(errors.Errorf("hosts entry IP \"%s\" is not a valid IP address", entry.IP), gcserr.HrInvalidArg)
+		}
+		if len(entry.Hostnames) == 0 {
+			return gcserr.WrapHresult(errors.Errorf("hosts entry for %s has no hostnames", entry.IP), gcserr.HrInvalidArg)
+		}
+		for _, name := range entry.Hostnames {
+			if name == "" {
+				return gcserr.WrapHresult(errors.Errorf("hosts entry for %s has an empty hostname", entry.IP), gcserr.HrInvalidArg)
+			}
+			if err := validateHostname(name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// hostsFileContents returns the contents of an /etc/hosts file with a line
+// for each of entries.
+func hostsFileContents(entries []prot.HostsEntry) string {
+	var b strings.Builder
+	for _, entry := range entries {
+		b.WriteString(entry.IP)
+		b.WriteString("\t")
+		b.WriteString(strings.Join(entry.Hostnames, " "))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// writeHostsFile writes entries to /etc/hosts in the root filesystem of the
+// container with the given ID, replacing any file from its image. The root
+// filesystem must already be mounted, so that the file is written to the
+// container's scratch space.
+func (c *gcsCore) writeHostsFile(id string, entries []prot.HostsEntry) error {
+	_, _, _, rootfsPath := c.getUnioningPaths(id)
+	etcPath := filepath.Join(rootfsPath, "etc")
+	if err := c.mkdirAll(etcPath, 0755); err != nil {
+		return errors.Wrapf(err, "failed to create directory %s", etcPath)
+	}
+	hostsPath := filepath.Join(etcPath, "hosts")
+	file, err := c.OS.OpenFile(hostsPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create hosts file %s", hostsPath)
+	}
+	defer file.Close()
+	contents := hostsFileContents(entries)
+	if _, err := io.WriteString(file, contents); err != nil {
+		return errors.Wrapf(err, "failed to write hosts file %s", hostsPath)
+	}
+	logrus.Debugf("wrote %s:\n%s", hostsPath, contents)
+	return nil
+}
+
+// withHostname returns a copy of config which sets the container's hostname
+// to hostname, if it is set. Since runc can only set the hostname of a
+// private UTS namespace, one is added to config if it doesn't have one.
+func withHostname(config oci.Spec, hostname string) oci.Spec {
+	if hostname == "" {
+		return config
+	}
+	config.Hostname = hostname
+	var linux oci.Linux
+	if config.Linux != nil {
+		linux = *config.Linux
+	}
+	for _, namespace := range linux.Namespaces {
+		if namespace.Type == oci.UTSNamespace {
+			config.Linux = &linux
+			return config
+		}
+	}
+	namespaces := make([]oci.LinuxNamespace, 0, len(linux.Namespaces)+1)
+	namespaces = append(namespaces, linux.Namespaces...)
+	linux.Namespaces = append(namespaces, oci.LinuxNamespace{Type: oci.UTSNamespace})
+	config.Linux = &linux
+	return config
+}
@@ -0,0 +1,52 @@
+package gcs
+
+import (
+	oci "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// InitShimPath is the path in the utility VM of the init shim, which is run as
+// the init process of containers created with InitShim.
+var InitShimPath = "/bin/gcsinit"
+
+// initShimContainerPath is where the init shim is bind mounted in a container.
+const initShimContainerPath = "/sbin/gcsinit"
+
+// withInitShim returns a copy of config which bind mounts the init shim at
+// shimPath into the container, and runs the shim as the container's init
+// process with the original command as its arguments. If shimPath is empty,
+// or config has no command, config is returned unchanged.
+func withInitShim(config oci.Spec, shimPath string) oci.Spec {
+	if shimPath == "" || config.Process == nil || len(config.Process.Args) == 0 {
+		return config
+	}
+	process := *config.Process
+	if process.Args[0] != initShimContainerPath {
+		args := make([]string, 0, len(process.Args)+2)
+		args = append(args, initShimContainerPath, "--")
+		process.Args = append(args, process.Args...)
+	}
+	config.Process = &process
+
+	mounts := make([]oci.Mount, 0, len(config.Mounts)+1)
+	for _, mount := range config.Mounts {
+		if mount.Destination != initShimContainerPath {
+			mounts = append(mounts, mount)
+		}
+	}
+	config.Mounts = append(mounts, oci.Mount{
+		Destination: initShimContainerPath,
+		Type:        "bind",
+		Source:      shimPath,
+		Options:     []string{"bind", "ro"},
+	})
+	return config
+}
+
+// initShimPath returns the path of the init shim to run as the container's init
+// process, or "" if it was not created with InitShim.
+func (e *containerCacheEntry) initShimPath() string {
+	if !e.initShim {
+		return ""
+	}
+	return InitShimPath
+}
@@ -0,0 +1,100 @@
+package gcs
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Microsoft/opengcs/service/gcs/gcserr"
+	"github.com/Microsoft/opengcs/service/gcs/prot"
+	"github.com/pkg/errors"
+)
+
+// mountTablePath is the mount table of the GCS's mount namespace, in the
+// format described by fstab(5).
+const mountTablePath = "/proc/self/mounts"
+
+// GetMounts returns the entries of the utility VM's mount table which were
+// mounted for the container with the given ID: those under the container's
+// storage path, and its mapped virtual disks and mapped directories.
+func (c *gcsCore) GetMounts(id string) ([]prot.MountInfo, error) {
+	c.containerCacheMutex.RLock()
+	containerEntry := c.getContainer(id)
+	if containerEntry == nil {
+		c.containerCacheMutex.RUnlock()
+		return nil, errors.WithStack(gcserr.NewContainerDoesNotExistError(id))
+	}
+	targets := make(map[string]bool)
+	for _, disk := range containerEntry.MappedVirtualDisks {
+		targets[filepath.Clean(disk.ContainerPath)] = true
+	}
+	for _, dir := range containerEntry.MappedDirectories {
+		targets[filepath.Clean(dir.ContainerPath)] = true
+	}
+	c.containerCacheMutex.RUnlock()
+
+	storagePath := c.getContainerStoragePath(id)
+	table, err := c.OS.OpenFile(mountTablePath, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open %s", mountTablePath)
+	}
+	defer table.Close()
+	mounts, err := parseMountTable(table)
+	if err != nil {
+		return nil, err
+	}
+
+	var containerMounts []prot.MountInfo
+	for _, mount := range mounts {
+		if targets[mount.Target] || mount.Target == storagePath || strings.HasPrefix(mount.Target, storagePath+"/") {
+			containerMounts = append(containerMounts, mount)
+		}
+	}
+	return containerMounts, nil
+}
+
+// parseMountTable parses a mount table in the format of /proc/self/mounts.
+func parseMountTable(r io.Reader) ([]prot.MountInfo, error) {
+	var mounts []prot.MountInfo
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			return nil, errors.Errorf("invalid mount table entry %q", scanner.Text())
+		}
+		mounts = append(mounts, prot.MountInfo{
+			Source:     unescapeMountField(fields[0]),
+			Target:     unescapeMountField(fields[1]),
+			FileSystem: fields[2],
+			Options:    strings.Split(fields[3], ","),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", mountTablePath)
+	}
+	return mounts, nil
+}
+
+// unescapeMountField replaces the octal escapes the kernel uses for spaces,
+// tabs, newlines and backslashes in mount table fields with the characters
+// they represent.
+func unescapeMountField(field string) string {
+	if !strings.Contains(field, `\`) {
+		return field
+	}
+	var b strings.Builder
+	for i := 0; i < len(field); i++ {
+		if field[i] == '\\' && i+4 <= len(field) {
+			if v, err := strconv.ParseUint(field[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(field[i])
+	}
+	return b.String()
+}
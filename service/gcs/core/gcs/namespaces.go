@@ -0,0 +1,122 @@
+package gcs
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/Microsoft/opengcs/service/gcs/gcserr"
+	oci "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pkg/errors"
+)
+
+// joinedNamespaces describes the namespaces a process joins when
+// JoinContainerID is given: their types, their names under /proc/<pid>/ns and
+// the nsenter options which enter them. The mount namespace is only joined by
+// processes executed in an already running container. A container's init
+// process keeps its own, since runc would otherwise set up the container's
+// root filesystem in the target's mount namespace.
+var joinedNamespaces = []struct {
+	nsType  oci.LinuxNamespaceType
+	name    string
+	option  string
+	forInit bool
+}{
+	{oci.NetworkNamespace, "net", "--net", true},
+	{oci.PIDNamespace, "pid", "--pid", true},
+	{oci.MountNamespace, "mnt", "--mount", false},
+}
+
+// runningInitPid returns the pid of the init process of the container with
+// the given ID, which must be running, so that its namespaces can be joined.
+// This function expects containerCacheMutex to be locked on entry.
+func (c *gcsCore) runningInitPid(id string) (int, error) {
+	target := c.getContainer(id)
+	if target == nil {
+		return -1, errors.WithStack(gcserr.NewContainerDoesNotExistError(id))
+	}
+	if target.container == nil {
+		return -1, errors.Errorf("cannot join the namespaces of container %s since it has not been started", id)
+	}
+	state, err := target.container.GetState()
+	if err != nil {
+		return -1, errors.Wrapf(err, "failed to get the state of container %s", id)
+	}
+	if state.Status != "running" {
+		return -1, errors.Errorf("cannot join the namespaces of container %s since it is %s", id, state.Status)
+	}
+	return target.container.Pid(), nil
+}
+
+// joinContainerNamespaces returns a copy of config in which the namespaces in
+// joinedNamespaces joined by an init process are those of the init process of
+// the container with the given ID, which must be running. runc then setns's
+// into them when starting the process. config itself is not modified.
+// This function expects containerCacheMutex to be locked on entry.
+func (c *gcsCore) joinContainerNamespaces(config oci.Spec, id string) (oci.Spec, error) {
+	pid, err := c.runningInitPid(id)
+	if err != nil {
+		return oci.Spec{}, err
+	}
+
+	var linux oci.Linux
+	if config.Linux != nil {
+		linux = *config.Linux
+	}
+	namespaces := make([]oci.LinuxNamespace, 0, len(linux.Namespaces)+len(joinedNamespaces))
+	for _, namespace := range linux.Namespaces {
+		if !isJoinedNamespace(namespace.Type) {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	for _, joined := range joinedNamespaces {
+		if !joined.forInit {
+			continue
+		}
+		namespaces = append(namespaces, oci.LinuxNamespace{
+			Type: joined.nsType,
+			Path: fmt.Sprintf("/proc/%d/ns/%s", pid, joined.name),
+		})
+	}
+	linux.Namespaces = namespaces
+	config.Linux = &linux
+	return config, nil
+}
+
+// joinContainerNamespacesArgs returns the arguments of process prefixed with
+// an nsenter command which runs it in all the namespaces in joinedNamespaces
+// of the init process of the container with the given ID, which must be
+// running, with that container's root directory and process's working
+// directory within it. The process keeps the UTS and IPC namespaces of the
+// init process with pid execPid, that of the container it is executed in.
+// This function expects containerCacheMutex to be locked on entry.
+func (c *gcsCore) joinContainerNamespacesArgs(process oci.Process, id string, execPid int) ([]string, error) {
+	pid, err := c.runningInitPid(id)
+	if err != nil {
+		return nil, err
+	}
+	prefix := []string{
+		"nsenter",
+		fmt.Sprintf("--uts=/proc/%d/ns/uts", execPid),
+		fmt.Sprintf("--ipc=/proc/%d/ns/ipc", execPid),
+	}
+	for _, joined := range joinedNamespaces {
+		prefix = append(prefix, fmt.Sprintf("%s=/proc/%d/ns/%s", joined.option, pid, joined.name))
+	}
+	root := fmt.Sprintf("/proc/%d/root", pid)
+	// Cleaning the working directory as an absolute path first keeps it
+	// within the root.
+	wd := path.Join(root, path.Join("/", process.Cwd))
+	prefix = append(prefix, "--root="+root, "--wd="+wd, "--")
+	return append(prefix, process.Args...), nil
+}
+
+// isJoinedNamespace returns whether namespaces of the given type are joined by
+// joinContainerNamespaces.
+func isJoinedNamespace(nsType oci.LinuxNamespaceType) bool {
+	for _, joined := range joinedNamespaces {
+		if joined.forInit && joined.nsType == nsType {
+			return true
+		}
+	}
+	return false
+}
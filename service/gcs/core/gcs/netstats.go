@@ -0,0 +1,112 @@
+package gcs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Microsoft/opengcs/service/gcs/gcserr"
+	"github.com/Microsoft/opengcs/service/gcs/prot"
+	"github.com/pkg/errors"
+)
+
+// GetNetworkStats returns the traffic counts of each of the network adapters
+// of the running container with the given ID, along with their totals. They
+// are read from the statistics of the adapters' interfaces in the sysfs of
+// the container's network namespace, as seen through its init process's root.
+func (c *gcsCore) GetNetworkStats(id string) (prot.ContainerNetworkStatistics, error) {
+	sysPath, err := c.containerPath(id, "/sys")
+	if err != nil {
+		return prot.ContainerNetworkStatistics{}, err
+	}
+	c.containerCacheMutex.RLock()
+	containerEntry := c.getContainer(id)
+	if containerEntry == nil {
+		c.containerCacheMutex.RUnlock()
+		return prot.ContainerNetworkStatistics{}, errors.WithStack(gcserr.NewContainerDoesNotExistError(id))
+	}
+	adapters := append([]prot.NetworkAdapter{}, containerEntry.NetworkAdapters...)
+	c.containerCacheMutex.RUnlock()
+
+	stats := prot.ContainerNetworkStatistics{
+		Adapters: make([]prot.AdapterNetworkStatistics, 0, len(adapters)),
+	}
+	for _, adapter := range adapters {
+		name := adapter.Name
+		if name == "" {
+			if name, err = c.instanceIDToNameIn(sysPath, adapter.AdapterInstanceID); err != nil {
+				return prot.ContainerNetworkStatistics{}, err
+			}
+		}
+		interfaceStats, err := c.readInterfaceStatistics(filepath.Join(sysPath, "class", "net", name, "statistics"))
+		if err != nil {
+			return prot.ContainerNetworkStatistics{}, errors.Wrapf(err, "failed to read the statistics of network adapter %s in container %s", adapter.AdapterInstanceID, id)
+		}
+		stats.Adapters = append(stats.Adapters, prot.AdapterNetworkStatistics{
+			AdapterInstanceID:          adapter.AdapterInstanceID,
+			InterfaceName:              name,
+			NetworkInterfaceStatistics: interfaceStats,
+		})
+		addInterfaceStatistics(&stats.Total, interfaceStats)
+	}
+	return stats, nil
+}
+
+// readInterfaceStatistics reads the counts of a network interface from its
+// sysfs statistics directory at path.
+func (c *gcsCore) readInterfaceStatistics(path string) (prot.NetworkInterfaceStatistics, error) {
+	var stats prot.NetworkInterfaceStatistics
+	counters := []struct {
+		file  string
+		value *uint64
+	}{
+		{"rx_bytes", &stats.RxBytes},
+		{"tx_bytes", &stats.TxBytes},
+		{"rx_packets", &stats.RxPackets},
+		{"tx_packets", &stats.TxPackets},
+		{"rx_errors", &stats.RxErrors},
+		{"tx_errors", &stats.TxErrors},
+		{"rx_dropped", &stats.RxDropped},
+		{"tx_dropped", &stats.TxDropped},
+	}
+	for _, counter := range counters {
+		value, err := c.readCounter(filepath.Join(path, counter.file))
+		if err != nil {
+			return prot.NetworkInterfaceStatistics{}, err
+		}
+		*counter.value = value
+	}
+	return stats, nil
+}
+
+// readCounter reads the decimal counter in the sysfs file at path.
+func (c *gcsCore) readCounter(path string) (uint64, error) {
+	file, err := c.OS.OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to open %s", path)
+	}
+	defer file.Close()
+	contents, err := ioutil.ReadAll(file)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to read %s", path)
+	}
+	value, err := strconv.ParseUint(strings.TrimSpace(string(contents)), 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "%s has an invalid counter %q", path, contents)
+	}
+	return value, nil
+}
+
+// addInterfaceStatistics adds the counts in stats to total.
+func addInterfaceStatistics(total *prot.NetworkInterfaceStatistics, stats prot.NetworkInterfaceStatistics) {
+	total.RxBytes += stats.RxBytes
+	total.TxBytes += stats.TxBytes
+	total.RxPackets += stats.RxPackets
+	total.TxPackets += stats.TxPackets
+	total.RxErrors += stats.RxErrors
+	total.TxErrors += stats.TxErrors
+	total.RxDropped += stats.RxDropped
+	total.TxDropped += stats.TxDropped
+}
@@ -4,39 +4,183 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/Microsoft/opengcs/service/gcs/gcserr"
 	"github.com/Microsoft/opengcs/service/gcs/prot"
 	"github.com/Microsoft/opengcs/service/gcs/runtime"
+	"github.com/Microsoft/opengcs/service/gcs/stdio"
 	"github.com/sirupsen/logrus"
 	"github.com/pkg/errors"
 )
 
-// configureAdapterInNamespace moves a given adapter into a network
-// namespace and configures it there.
-func (c *gcsCore) configureAdapterInNamespace(container runtime.Container, adapter prot.NetworkAdapter) error {
-	id := adapter.AdapterInstanceID
-	interfaceName, err := c.instanceIDToName(id)
-	if err != nil {
-		return err
+// maxInterfaceNameLength is the longest network interface name the kernel
+// allows.
+const maxInterfaceNameLength = 15
+
+// validateNetworkAdapterNames returns an HrInvalidArg error if any of the
+// names given to adapters is not a valid interface name, or if two adapters
+// are given the same name.
+func validateNetworkAdapterNames(adapters []prot.NetworkAdapter) error {
+	names := make(map[string]string)
+	for _, adapter := range adapters {
+		name := adapter.Name
+		if name == "" {
+			continue
+		}
+		if len(name) > maxInterfaceNameLength || name == "." || name == ".." || strings.ContainsAny(name, "/: \t\n") {
+			return gcserr.WrapHresult(errors.Errorf("network adapter %s has an invalid interface name \"%s\"", adapter.AdapterInstanceID, name), gcserr.HrInvalidArg)
+		}
+		if other, ok := names[name]; ok {
+			return gcserr.WrapHresult(errors.Errorf("network adapters %s and %s are both named \"%s\"", other, adapter.AdapterInstanceID, name), gcserr.HrInvalidArg)
+		}
+		names[name] = adapter.AdapterInstanceID
+	}
+	return nil
+}
+
+// Routing tables reserved by the kernel, which adapters may not use.
+const (
+	rtTableDefault = 253
+	rtTableMain    = 254
+	rtTableLocal   = 255
+	// maxRoutingTableID is the largest routing table ID accepted, since
+	// netlink treats IDs as signed 32-bit values.
+	maxRoutingTableID = 1<<31 - 1
+)
+
+// resolveRoutingPolicies returns a copy of adapters in which each adapter with
+// a routing table has its source-based rules set, defaulting to its allocated
+// IP address. It returns an HrInvalidArg error if a routing table ID is
+// reserved, out of range or used by two adapters, or if a source is not a
+// CIDR.
+func resolveRoutingPolicies(adapters []prot.NetworkAdapter) ([]prot.NetworkAdapter, error) {
+	resolved := make([]prot.NetworkAdapter, len(adapters))
+	tables := make(map[uint32]string)
+	for i, adapter := range adapters {
+		resolved[i] = adapter
+		id := adapter.RoutingTableID
+		if id == 0 {
+			if len(adapter.SourceBasedRules) != 0 {
+				return nil, gcserr.WrapHresult(errors.Errorf("network adapter %s has source-based rules but no routing table", adapter.AdapterInstanceID), gcserr.HrInvalidArg)
+			}
+			continue
+		}
+		if id == rtTableDefault || id == rtTableMain || id == rtTableLocal || id > maxRoutingTableID {
+			return nil, gcserr.WrapHresult(errors.Errorf("network adapter %s has a reserved or out of range routing table %d", adapter.AdapterInstanceID, id), gcserr.HrInvalidArg)
+		}
+		if other, ok := tables[id]; ok {
+			return nil, gcserr.WrapHresult(errors.Errorf("network adapters %s and %s both use routing table %d", other, adapter.AdapterInstanceID, id), gcserr.HrInvalidArg)
+		}
+		tables[id] = adapter.AdapterInstanceID
+
+		sources := adapter.SourceBasedRules
+		if len(sources) == 0 {
+			ip := net.ParseIP(adapter.AllocatedIPAddress)
+			if ip == nil {
+				return nil, gcserr.WrapHresult(errors.Errorf("network adapter %s has a routing table but no source-based rules or allocated IP address", adapter.AdapterInstanceID), gcserr.HrInvalidArg)
+			}
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+			sources = []string{fmt.Sprintf("%s/%d", ip, bits)}
+		}
+		for _, source := range sources {
+			if _, _, err := net.ParseCIDR(source); err != nil {
+				return nil, gcserr.WrapHresult(errors.Wrapf(err, "network adapter %s has a source-based rule with an invalid source", adapter.AdapterInstanceID), gcserr.HrInvalidArg)
+			}
+		}
+		resolved[i].SourceBasedRules = sources
+	}
+	return resolved, nil
+}
+
+// validateRoutes returns an HrInvalidArg error if any of the routes of
+// adapters has a destination which is not a CIDR, a gateway which is not an
+// IP address, or a negative metric.
+func validateRoutes(adapters []prot.NetworkAdapter) error {
+	for _, adapter := range adapters {
+		for _, route := range adapter.Routes {
+			if _, _, err := net.ParseCIDR(route.Destination); err != nil {
+				return gcserr.WrapHresult(errors.Wrapf(err, "network adapter %s has a route with an invalid destination", adapter.AdapterInstanceID), gcserr.HrInvalidArg)
+			}
+			if route.Gateway != "" && net.ParseIP(route.Gateway) == nil {
+				return gcserr.WrapHresult(errors.Errorf("network adapter %s has a route to %s with an invalid gateway \"%s\"", adapter.AdapterInstanceID, route.Destination, route.Gateway), gcserr.HrInvalidArg)
+			}
+			if route.Metric < 0 {
+				return gcserr.WrapHresult(errors.Errorf("network adapter %s has a route to %s with a negative metric", adapter.AdapterInstanceID, route.Destination), gcserr.HrInvalidArg)
+			}
+		}
+	}
+	return nil
+}
+
+// configureNetworkAdapters moves each of adapters into the network namespace
+// of container and configures it there, in order. Each adapter's interface is
+// named with its Name if it has one, and otherwise keeps its name in the
+// utility VM, so the names are known before any adapter is moved.
+func (c *gcsCore) configureNetworkAdapters(container runtime.Container, adapters []prot.NetworkAdapter) error {
+	interfaceNames := make([]string, len(adapters))
+	used := make(map[string]string)
+	for i, adapter := range adapters {
+		interfaceName, err := c.instanceIDToName(adapter.AdapterInstanceID)
+		if err != nil {
+			return err
+		}
+		interfaceNames[i] = interfaceName
+		name := interfaceName
+		if adapter.Name != "" {
+			name = adapter.Name
+		}
+		if other, ok := used[name]; ok {
+			return errors.Errorf("network adapters %s and %s would both be named %s in the container", other, adapter.AdapterInstanceID, name)
+		}
+		used[name] = adapter.AdapterInstanceID
+	}
+	for i, adapter := range adapters {
+		if err := c.configureAdapterInNamespace(container, adapter, interfaceNames[i]); err != nil {
+			return err
+		}
 	}
+	return nil
+}
+
+// configureAdapterInNamespace moves a given adapter, whose interface in the
+// utility VM is interfaceName, into a network namespace and configures it
+// there.
+func (c *gcsCore) configureAdapterInNamespace(container runtime.Container, adapter prot.NetworkAdapter, interfaceName string) error {
 	nspid := container.Pid()
 	cfg, err := json.Marshal(adapter)
 	if err != nil {
-		return errors.Wrapf(err, "failed to marshal adapter struct to JSON for adapter %s", id)
+		return errors.Wrapf(err, "failed to marshal adapter struct to JSON for adapter %s", adapter.AdapterInstanceID)
 	}
 
-	out, err := c.OS.Command("netnscfg",
+	cmd := c.OS.Command("netnscfg",
 		"-if", interfaceName,
 		"-nspid", fmt.Sprintf("%d", nspid),
-		"-cfg", string(cfg)).CombinedOutput()
+		"-cfg", string(cfg))
+	output := stdio.NewCappedBuffer()
+	cmd.SetStdout(output)
+	cmd.SetStderr(output)
+	err = cmd.Run()
+	out := output.Bytes()
 	if err != nil {
 		return errors.Wrapf(err, "failed to configure network adapter %s: %s", adapter.AdapterInstanceID, out)
 	}
 	logrus.Debugf("netnscfg output:\n%s", out)
 
+	nsInterfaceName := interfaceName
+	if adapter.Name != "" {
+		nsInterfaceName = adapter.Name
+	}
+	if err := c.applyBandwidthLimits(nspid, nsInterfaceName, adapter); err != nil {
+		return err
+	}
+
 	// Handle resolve.conf
 	// There is no need to create <baseFilesPath>/etc here as it
 	// is created in CreateContainer().
@@ -93,7 +237,13 @@ func (c *gcsCore) generateResolvConfFile(resolvPath string, adapter prot.Network
 // instanceIDToName converts from the given instance ID (a GUID generated on
 // the Windows host) to its corresponding interface name (e.g. "eth0").
 func (c *gcsCore) instanceIDToName(id string) (string, error) {
-	deviceDirs, err := c.OS.ReadDir(filepath.Join("/sys", "bus", "vmbus", "devices", id, "net"))
+	return c.instanceIDToNameIn("/sys", id)
+}
+
+// instanceIDToNameIn converts from the given instance ID to its corresponding
+// interface name in the network namespace of the sysfs mounted at sysPath.
+func (c *gcsCore) instanceIDToNameIn(sysPath, id string) (string, error) {
+	deviceDirs, err := c.OS.ReadDir(filepath.Join(sysPath, "bus", "vmbus", "devices", id, "net"))
 	if err != nil {
 		return "", errors.Wrapf(err, "failed to read vmbus network device from /sys filesystem for adapter %s", id)
 	}
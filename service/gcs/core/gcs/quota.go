@@ -0,0 +1,120 @@
+package gcs
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/Microsoft/opengcs/service/gcs/gcserr"
+	"github.com/Microsoft/opengcs/service/gcs/prot"
+	"github.com/Microsoft/opengcs/service/gcs/stdio"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ext4SuperMagic and xfsSuperMagic are the statfs(2) filesystem types of
+	// the filesystems which support project quotas.
+	ext4SuperMagic = 0xef53
+	xfsSuperMagic  = 0x58465342
+
+	// firstQuotaProjectID is the project ID given to the first container with
+	// a writable layer quota. Lower IDs are left for the utility VM's own use.
+	firstQuotaProjectID = 1000
+)
+
+// supportsProjectQuotas returns whether the sandbox filesystem with the given
+// name supports project quotas.
+func supportsProjectQuotas(filesystem string) bool {
+	return filesystem == "ext4" || filesystem == "xfs"
+}
+
+// applyWritableLayerQuota limits the space used by the files in upperDir to
+// limit bytes. upperDir is given a new project ID, which its new files and
+// directories inherit, and the project's block limit is set on the filesystem
+// containing it. The filesystem must be ext4 or xfs, mounted with project
+// quotas enabled.
+func (c *gcsCore) applyWritableLayerQuota(upperDir string, limit uint64) error {
+	var stat syscall.Statfs_t
+	if err := c.OS.Statfs(upperDir, &stat); err != nil {
+		return errors.Wrapf(err, "failed to stat the filesystem of %s", upperDir)
+	}
+	if stat.Type != ext4SuperMagic && stat.Type != xfsSuperMagic {
+		return gcserr.WrapHresult(errors.Errorf("the filesystem of %s, of type %#x, does not support project quotas, only ext4 and xfs do", upperDir, stat.Type), gcserr.HrNotImpl)
+	}
+	mount, err := c.findMount(upperDir)
+	if err != nil {
+		return err
+	}
+	if !hasProjectQuotaOption(mount.Options) {
+		return gcserr.WrapHresult(errors.Errorf("the filesystem of %s mounted at %s does not have project quotas enabled", upperDir, mount.Target), gcserr.HrNotImpl)
+	}
+
+	c.lastQuotaProjectID++
+	if c.lastQuotaProjectID < firstQuotaProjectID {
+		c.lastQuotaProjectID = firstQuotaProjectID
+	}
+	projectID := strconv.FormatUint(uint64(c.lastQuotaProjectID), 10)
+	// setquota takes block limits in KiB.
+	limitKiB := strconv.FormatUint((limit+1023)/1024, 10)
+	commands := [][]string{
+		{"chattr", "+P", "-p", projectID, upperDir},
+		{"setquota", "-P", projectID, "0", limitKiB, "0", "0", mount.Target},
+	}
+	for _, args := range commands {
+		cmd := c.OS.Command(args[0], args[1:]...)
+		output := stdio.NewCappedBuffer()
+		cmd.SetStdout(output)
+		cmd.SetStderr(output)
+		if err := cmd.Run(); err != nil {
+			return errors.Wrapf(err, "failed to run %v: %s", args, output.Bytes())
+		}
+	}
+	return nil
+}
+
+// hasProjectQuotaOption returns whether options, the options of a mount,
+// enable project quotas.
+func hasProjectQuotaOption(options []string) bool {
+	for _, option := range options {
+		switch option {
+		case mountOptionProjectQuota, "pquota":
+			return true
+		}
+	}
+	return false
+}
+
+// findMount returns the entry of the utility VM's mount table for the mount
+// containing path.
+func (c *gcsCore) findMount(path string) (prot.MountInfo, error) {
+	table, err := c.OS.OpenFile(mountTablePath, os.O_RDONLY, 0)
+	if err != nil {
+		return prot.MountInfo{}, errors.Wrapf(err, "failed to open %s", mountTablePath)
+	}
+	defer table.Close()
+	mounts, err := parseMountTable(table)
+	if err != nil {
+		return prot.MountInfo{}, err
+	}
+
+	path = filepath.Clean(path)
+	found := false
+	var longest prot.MountInfo
+	for _, mount := range mounts {
+		target := filepath.Clean(mount.Target)
+		if target != "/" && path != target && !strings.HasPrefix(path, target+"/") {
+			continue
+		}
+		// Later mounts over the same target hide earlier ones.
+		if !found || len(target) >= len(filepath.Clean(longest.Target)) {
+			longest = mount
+			found = true
+		}
+	}
+	if !found {
+		return prot.MountInfo{}, errors.Errorf("no mount containing %s was found in %s", path, mountTablePath)
+	}
+	return longest, nil
+}
@@ -0,0 +1,47 @@
+package gcs
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultReadinessTimeout is how long to wait for a container's readiness
+	// file when the create settings don't specify a timeout.
+	defaultReadinessTimeout = 30 * time.Second
+	// readinessPollInterval is how often to check for a container's readiness
+	// file.
+	readinessPollInterval = 50 * time.Millisecond
+)
+
+// readinessGate describes a file which must exist before a container's init
+// process is considered started.
+type readinessGate struct {
+	// path is the full path of the readiness file in the utility VM.
+	path    string
+	timeout time.Duration
+}
+
+// waitForReadiness polls for the readiness file described by gate until it
+// exists or the gate's timeout elapses.
+// This function expects containerCacheMutex not to be held, so that other
+// requests can be handled while waiting.
+func (c *gcsCore) waitForReadiness(id string, gate *readinessGate) error {
+	deadline := time.Now().Add(gate.timeout)
+	for {
+		exists, err := c.OS.PathExists(gate.path)
+		if err != nil {
+			return errors.Wrapf(err, "failed to check for readiness file %s of container %s", gate.path, id)
+		}
+		if exists {
+			logrus.Infof("container %s is ready", id)
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			return errors.Errorf("timed out after %s waiting for readiness file %s of container %s", gate.timeout, gate.path, id)
+		}
+		time.Sleep(readinessPollInterval)
+	}
+}
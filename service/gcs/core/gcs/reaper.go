@@ -0,0 +1,66 @@
+package gcs
+
+import (
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// OrphanReapInterval is how often the core reaps orphaned zombie processes
+// in its containers. Zero disables reaping. The GCS is made a subreaper when
+// it starts a container process, so a container process whose parent exits
+// without a PID namespace init to adopt it is reparented to the GCS, which
+// must reap it once it exits.
+var OrphanReapInterval time.Duration
+
+// reapOrphansPeriodically calls reapOrphans every interval, forever.
+func (c *gcsCore) reapOrphansPeriodically(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		c.reapOrphans()
+	}
+}
+
+// reapOrphans waits on each zombie process in the core's containers which is
+// not an init process or a process created by the runtime, both of which are
+// waited on by the core already. Zombies which are not children of the GCS
+// are left for their parents to reap, and it returns the number of zombies
+// reaped.
+func (c *gcsCore) reapOrphans() int {
+	c.containerCacheMutex.RLock()
+	defer c.containerCacheMutex.RUnlock()
+
+	reaped := 0
+	for id, containerEntry := range c.containerCache {
+		if containerEntry.container == nil || containerEntry.initExited {
+			continue
+		}
+		processes, err := containerEntry.container.GetAllProcesses()
+		if err != nil {
+			logrus.Debugf("failed to list processes of container %s to reap orphans: %s", id, err)
+			continue
+		}
+		initPid := containerEntry.container.Pid()
+		for _, process := range processes {
+			if !process.IsZombie || process.CreatedByRuntime || process.Pid == initPid {
+				continue
+			}
+			var status syscall.WaitStatus
+			wpid, err := c.OS.Wait4(process.Pid, &status, syscall.WNOHANG, nil)
+			if err != nil {
+				if errors.Cause(err) != syscall.ECHILD {
+					logrus.Warnf("failed to reap orphaned process %d of container %s: %s", process.Pid, id, err)
+				}
+				continue
+			}
+			if wpid == process.Pid {
+				logrus.Infof("reaped orphaned process %d of container %s", process.Pid, id)
+				reaped++
+			}
+		}
+	}
+	return reaped
+}
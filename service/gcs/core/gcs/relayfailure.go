@@ -0,0 +1,73 @@
+package gcs
+
+import (
+	"sync"
+	"syscall"
+
+	"github.com/Microsoft/opengcs/service/gcs/gcserr"
+	"github.com/Microsoft/opengcs/service/gcs/oslayer"
+	"github.com/Microsoft/opengcs/service/gcs/prot"
+	"github.com/Microsoft/opengcs/service/gcs/stdio"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// relayFailureKiller kills a process when a connection relaying its stdio
+// fails under stdio.RelayFailureKill. Since the relay may be started before
+// the process's pid is known, a failure before then is remembered and acted on
+// once the pid is set.
+type relayFailureKiller struct {
+	os     oslayer.OS
+	m      sync.Mutex
+	pid    int
+	failed bool
+}
+
+// kill kills the process, or does so once its pid is set.
+func (k *relayFailureKiller) kill() {
+	k.m.Lock()
+	defer k.m.Unlock()
+
+	k.failed = true
+	k.killLocked()
+}
+
+// setPid records the pid of the process, killing it if its relay has already
+// failed.
+func (k *relayFailureKiller) setPid(pid int) {
+	k.m.Lock()
+	defer k.m.Unlock()
+
+	k.pid = pid
+	if k.failed {
+		k.killLocked()
+	}
+}
+
+func (k *relayFailureKiller) killLocked() {
+	if k.pid <= 0 {
+		return
+	}
+	if err := k.os.Kill(k.pid, syscall.SIGKILL); err != nil {
+		logrus.Warnf("failed to kill process %d after its stdio relay failed: %s", k.pid, err)
+	}
+}
+
+// applyRelayFailurePolicy sets the relay failure policy in params on stdioSet.
+// With stdio.RelayFailureKill, the returned relayFailureKiller must be given
+// the process's pid once it is known. It returns an HrInvalidArg error if the
+// policy is not known.
+func (c *gcsCore) applyRelayFailurePolicy(params prot.ProcessParameters, stdioSet *stdio.ConnectionSet) (*relayFailureKiller, error) {
+	policy, err := stdio.ParseRelayFailurePolicy(params.RelayFailurePolicy)
+	if err != nil {
+		return nil, gcserr.WrapHresult(errors.WithStack(err), gcserr.HrInvalidArg)
+	}
+	killer := &relayFailureKiller{os: c.OS}
+	if stdioSet != nil {
+		stdioSet.FailurePolicy = policy
+		if policy == stdio.RelayFailureKill {
+			stdioSet.OnFailure = killer.kill
+		}
+	}
+	return killer, nil
+}
@@ -0,0 +1,68 @@
+package gcs
+
+import (
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/Microsoft/opengcs/service/gcs/prot"
+	"github.com/pkg/errors"
+)
+
+const (
+	// selfStatmPath reports the GCS's memory usage, in pages, as described
+	// by proc(5).
+	selfStatmPath = "/proc/self/statm"
+	// selfFdPath lists the GCS's open file descriptors.
+	selfFdPath = "/proc/self/fd"
+)
+
+// GetGCSResourceUsage returns the resident set size, goroutine count and open
+// file descriptor count of the GCS process, so that its overhead can be told
+// apart from that of its containers.
+func (c *gcsCore) GetGCSResourceUsage() (prot.GCSResourceUsage, error) {
+	rss, err := c.residentSetBytes()
+	if err != nil {
+		return prot.GCSResourceUsage{}, err
+	}
+	fds, err := c.OS.ReadDir(selfFdPath)
+	if err != nil {
+		return prot.GCSResourceUsage{}, errors.Wrapf(err, "failed to list %s", selfFdPath)
+	}
+	// Listing the directory opens it, so one of the entries is the listing's
+	// own file descriptor.
+	openFds := len(fds) - 1
+	if openFds < 0 {
+		openFds = 0
+	}
+	return prot.GCSResourceUsage{
+		ResidentSetBytes:    rss,
+		Goroutines:          runtime.NumGoroutine(),
+		OpenFileDescriptors: openFds,
+	}, nil
+}
+
+// residentSetBytes returns the GCS's resident set size, from the second field
+// of /proc/self/statm.
+func (c *gcsCore) residentSetBytes() (uint64, error) {
+	file, err := c.OS.OpenFile(selfStatmPath, os.O_RDONLY, 0)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to open %s", selfStatmPath)
+	}
+	defer file.Close()
+	contents, err := ioutil.ReadAll(file)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to read %s", selfStatmPath)
+	}
+	fields := strings.Fields(string(contents))
+	if len(fields) < 2 {
+		return 0, errors.Errorf("%s has unexpected contents %q", selfStatmPath, contents)
+	}
+	pages, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "%s has an invalid resident set size %q", selfStatmPath, fields[1])
+	}
+	return pages * uint64(os.Getpagesize()), nil
+}
@@ -0,0 +1,112 @@
+package gcs
+
+import (
+	"time"
+
+	"github.com/Microsoft/opengcs/service/gcs/gcserr"
+	"github.com/Microsoft/opengcs/service/gcs/oslayer"
+	"github.com/Microsoft/opengcs/service/gcs/runtime"
+	"github.com/Microsoft/opengcs/service/gcs/stdio"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// InitRestartGracePeriod is how long RestartInit waits for a container's init
+// process to exit after sending it SIGTERM before sending SIGKILL.
+var InitRestartGracePeriod = 10 * time.Second
+
+// RestartInit stops the init process of the running container with the given
+// ID and starts it again with the parameters it was originally started with.
+// The container keeps its ID, storage, mounts, config file and cache entry, so
+// waits on the container continue until the restarted init process exits.
+// runc creates the container's namespaces again for the new init process, so
+// its network adapters are configured again as they were at the original
+// start, but its post-create hook is not run again. The restarted init
+// process's output goes to the container's init output buffer, if it has one,
+// since the host's stdio connections for the original init process are closed
+// when it exits. If the init process fails to start again, the container is
+// cleaned up and reported as exited.
+func (c *gcsCore) RestartInit(id string) error {
+	c.containerCacheMutex.Lock()
+	containerEntry := c.getContainer(id)
+	if containerEntry == nil {
+		c.containerCacheMutex.Unlock()
+		return errors.WithStack(gcserr.NewContainerDoesNotExistError(id))
+	}
+	if containerEntry.container == nil || containerEntry.initExited {
+		c.containerCacheMutex.Unlock()
+		return errors.Errorf("container %s is not running", id)
+	}
+	if containerEntry.initStopped != nil {
+		c.containerCacheMutex.Unlock()
+		return gcserr.WrapHresult(errors.Errorf("the init process of container %s is already being restarted", id), gcserr.HrBusy)
+	}
+	stopped := make(chan struct{})
+	containerEntry.initStopped = stopped
+	container := containerEntry.container
+	params := containerEntry.initParams
+	c.containerCacheMutex.Unlock()
+
+	if err := container.Kill(oslayer.SIGTERM); err != nil {
+		c.containerCacheMutex.Lock()
+		containerEntry.initStopped = nil
+		c.containerCacheMutex.Unlock()
+		return errors.Wrapf(err, "failed to stop the init process of container %s", id)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(InitRestartGracePeriod):
+		logrus.Warnf("container %s init process did not exit within %s of SIGTERM, sending SIGKILL", id, InitRestartGracePeriod)
+		if err := container.Kill(oslayer.SIGKILL); err != nil {
+			logrus.Errorf("failed to send SIGKILL to container %s: %s", id, err)
+		}
+		<-stopped
+	}
+
+	// The lock is held until the init process has started again, so that no
+	// other process can be exec'd into the container in between.
+	c.containerCacheMutex.Lock()
+	_, gate, err := c.execProcessLocked(id, params, &stdio.ConnectionSet{}, true)
+	c.containerCacheMutex.Unlock()
+	if err != nil {
+		return errors.Wrapf(err, "failed to restart the init process of container %s", id)
+	}
+	if err := c.waitForInitReadiness(id, gate); err != nil {
+		return errors.Wrapf(err, "failed to restart the init process of container %s", id)
+	}
+	return nil
+}
+
+// abandonRestartedContainer cleans up the container of containerEntry, whose
+// init process failed to start again after exiting to be restarted, and
+// reports it to waits on it as having exited with no exit code.
+// This function expects containerCacheMutex to be locked on entry.
+func (c *gcsCore) abandonRestartedContainer(containerEntry *containerCacheEntry) {
+	logrus.Errorf("container %s init process failed to restart, cleaning up the container", containerEntry.ID)
+	if err := c.cleanupContainer(containerEntry); err != nil {
+		logrus.Error(err)
+	}
+	containerEntry.initExited = true
+	containerEntry.exitWg.Done()
+	delete(c.containerCache, containerEntry.ID)
+}
+
+// finishStoppedInit completes the exit of a container's init process which is
+// being restarted. The runtime container is deleted so that it can be created
+// again, and the process's exit is reported to waits on it, but the container
+// itself is left running.
+func (c *gcsCore) finishStoppedInit(processEntry *processCacheEntry, container runtime.Container, stdioSet *stdio.ConnectionSet, state oslayer.ProcessExitState, err error) {
+	if err != nil {
+		logrus.Error(err)
+	}
+	exitCode := state.ExitCode()
+	logrus.Infof("container init process %d exited with exit status %d for restart", container.Pid(), exitCode)
+	if err := container.Delete(); err != nil {
+		logrus.Error(err)
+	}
+
+	shutdownProcessStdio(container.Pid(), stdioSet)
+
+	processEntry.exitCode = exitCode
+	processEntry.exitWg.Done()
+}
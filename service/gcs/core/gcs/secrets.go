@@ -0,0 +1,139 @@
+package gcs
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"github.com/Microsoft/opengcs/service/gcs/gcserr"
+	"github.com/Microsoft/opengcs/service/gcs/prot"
+	oci "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// validateSecrets returns an HrInvalidArg error if any of secrets has a
+// container path which is not absolute or is shared with another secret, or
+// has a mode with bits other than the permission bits.
+func validateSecrets(secrets []prot.Secret) error {
+	paths := make(map[string]bool)
+	for _, secret := range secrets {
+		path := filepath.Clean(secret.ContainerPath)
+		if !filepath.IsAbs(path) || path == "/" {
+			return gcserr.WrapHresult(errors.Errorf("secret container path \"%s\" must be an absolute file path", secret.ContainerPath), gcserr.HrInvalidArg)
+		}
+		if paths[path] {
+			return gcserr.WrapHresult(errors.Errorf("more than one secret has container path %s", path), gcserr.HrInvalidArg)
+		}
+		paths[path] = true
+		if secret.Mode&^uint32(os.ModePerm) != 0 {
+			return gcserr.WrapHresult(errors.Errorf("secret %s has mode %#o, which is not a set of permission bits", path, secret.Mode), gcserr.HrInvalidArg)
+		}
+	}
+	return nil
+}
+
+// getSecretsPath returns the path in the utility VM of the tmpfs holding the
+// secrets of the container with the given ID.
+func (c *gcsCore) getSecretsPath(id string) string {
+	return filepath.Join(c.getContainerStoragePath(id), ".secrets")
+}
+
+// setupSecrets mounts a tmpfs for the secrets of the container with the given
+// ID and writes each of secrets to a file in it, so that their contents never
+// reach a disk. Each secret's contents are zeroed once written. The mounts
+// which bind the files into the container are recorded in containerEntry.
+func (c *gcsCore) setupSecrets(id string, secrets []prot.Secret, containerEntry *containerCacheEntry) (err error) {
+	path := c.getSecretsPath(id)
+	if err := c.mkdirAll(path, 0700); err != nil {
+		return errors.Wrapf(err, "failed to create directory for secrets %s", path)
+	}
+	if err := c.OS.Mount("tmpfs", path, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, "mode=0700"); err != nil {
+		return errors.Wrapf(err, "failed to mount tmpfs for secrets at %s", path)
+	}
+	defer func() {
+		if err != nil {
+			if unmountErr := c.OS.Unmount(path, 0); unmountErr != nil {
+				logrus.Warnf("failed to unmount secrets at %s: %s", path, unmountErr)
+			}
+		}
+	}()
+
+	mounts := make([]oci.Mount, 0, len(secrets))
+	for i := range secrets {
+		secret := &secrets[i]
+		source := filepath.Join(path, strconv.Itoa(i))
+		err := c.writeSecret(source, secret)
+		for j := range secret.Content {
+			secret.Content[j] = 0
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to write secret %s", secret.ContainerPath)
+		}
+		mounts = append(mounts, oci.Mount{
+			Destination: filepath.Clean(secret.ContainerPath),
+			Type:        "bind",
+			Source:      source,
+			Options:     []string{"bind", "ro"},
+		})
+	}
+	containerEntry.secretMounts = mounts
+	containerEntry.secretsPath = path
+	return nil
+}
+
+// writeSecret writes the contents of secret to a new file at path with the
+// secret's mode.
+func (c *gcsCore) writeSecret(path string, secret *prot.Secret) error {
+	mode := os.FileMode(secret.Mode)
+	f, err := c.OS.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create %s", path)
+	}
+	_, err = f.Write(secret.Content)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to write %s", path)
+	}
+	// The mode given at creation is subject to the umask.
+	if err := c.OS.Chmod(path, mode); err != nil {
+		return errors.Wrapf(err, "failed to set the mode of %s", path)
+	}
+	return nil
+}
+
+// unmountSecrets unmounts the tmpfs holding the container's secrets, if it
+// has any, discarding their contents.
+func (c *gcsCore) unmountSecrets(containerEntry *containerCacheEntry) error {
+	if containerEntry.secretsPath == "" {
+		return nil
+	}
+	if err := c.OS.Unmount(containerEntry.secretsPath, 0); err != nil {
+		return errors.Wrapf(err, "failed to unmount secrets at %s", containerEntry.secretsPath)
+	}
+	containerEntry.secretsPath = ""
+	return nil
+}
+
+// withSecretMounts returns a copy of config with mounts added, replacing any
+// existing mounts at their destinations.
+func withSecretMounts(config oci.Spec, mounts []oci.Mount) oci.Spec {
+	if len(mounts) == 0 {
+		return config
+	}
+	destinations := make(map[string]bool)
+	for _, mount := range mounts {
+		destinations[mount.Destination] = true
+	}
+	merged := make([]oci.Mount, 0, len(config.Mounts)+len(mounts))
+	for _, mount := range config.Mounts {
+		if !destinations[filepath.Clean(mount.Destination)] {
+			merged = append(merged, mount)
+		}
+	}
+	config.Mounts = append(merged, mounts...)
+	return config
+}
@@ -0,0 +1,99 @@
+package gcs
+
+import (
+	"path/filepath"
+	"syscall"
+
+	"github.com/Microsoft/opengcs/service/gcs/prot"
+	"github.com/pkg/errors"
+)
+
+// sharedScratchBasePath is the path in the utility VM under which the
+// directories backing shared scratch are stored.
+const sharedScratchBasePath = "/tmp/sharedscratch/"
+
+// sharedScratchEntry tracks the containers using a shared scratch directory.
+type sharedScratchEntry struct {
+	// path is the directory in the utility VM backing the shared scratch.
+	path string
+	// refs is the number of containers the directory is mounted into.
+	refs int
+}
+
+// sharedScratchMount records where a container's shared scratch is mounted.
+type sharedScratchMount struct {
+	id     string
+	target string
+}
+
+// mountSharedScratch bind mounts the shared scratch directory with the given
+// settings into the root filesystem of the container with the given ID,
+// creating the directory if this is the first container to reference it. The
+// container's root filesystem must already be mounted.
+// This function expects containerCacheMutex to be locked on entry.
+func (c *gcsCore) mountSharedScratch(id string, scratch *prot.SharedScratch, containerEntry *containerCacheEntry) error {
+	if scratch.ID == "" || filepath.Base(scratch.ID) != scratch.ID {
+		return errors.Errorf("invalid shared scratch ID \"%s\"", scratch.ID)
+	}
+	if !filepath.IsAbs(scratch.ContainerPath) {
+		return errors.Errorf("shared scratch container path \"%s\" must be absolute", scratch.ContainerPath)
+	}
+
+	entry, ok := c.sharedScratches[scratch.ID]
+	if !ok {
+		entry = &sharedScratchEntry{path: filepath.Join(sharedScratchBasePath, scratch.ID)}
+		if err := c.mkdirAll(entry.path, 0755); err != nil {
+			return errors.Wrapf(err, "failed to create directory for shared scratch %s", scratch.ID)
+		}
+	}
+
+	_, _, _, rootfsPath := c.getUnioningPaths(id)
+	target := filepath.Join(rootfsPath, scratch.ContainerPath)
+	if err := c.mkdirAll(target, 0755); err != nil {
+		return errors.Wrapf(err, "failed to create mountpoint for shared scratch %s", scratch.ID)
+	}
+	if err := c.OS.Mount(entry.path, target, "", syscall.MS_BIND, ""); err != nil {
+		return errors.Wrapf(err, "failed to mount shared scratch %s", scratch.ID)
+	}
+
+	entry.refs++
+	c.sharedScratches[scratch.ID] = entry
+	containerEntry.sharedScratch = &sharedScratchMount{id: scratch.ID, target: target}
+	return nil
+}
+
+// unmountSharedScratch unmounts the shared scratch directory, if any, from the
+// given container. If no other container is using the directory, it is
+// removed. This must be called before the container's root filesystem is
+// unmounted.
+// This function expects containerCacheMutex to be locked on entry.
+func (c *gcsCore) unmountSharedScratch(containerEntry *containerCacheEntry) error {
+	mount := containerEntry.sharedScratch
+	if mount == nil {
+		return nil
+	}
+	mounted, err := c.OS.PathIsMounted(mount.target)
+	if err != nil {
+		return errors.Wrapf(err, "failed to determine if shared scratch path is mounted %s", mount.target)
+	}
+	if mounted {
+		if err := c.OS.Unmount(mount.target, 0); err != nil {
+			return errors.Wrapf(err, "failed to unmount shared scratch path %s", mount.target)
+		}
+	}
+	containerEntry.sharedScratch = nil
+
+	entry, ok := c.sharedScratches[mount.id]
+	if !ok {
+		return nil
+	}
+	entry.refs--
+	if entry.refs > 0 {
+		return nil
+	}
+	delete(c.sharedScratches, mount.id)
+	if err := c.OS.RemoveAll(entry.path); err != nil {
+		return errors.Wrapf(err, "failed to remove shared scratch %s", mount.id)
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package gcs
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -11,9 +12,10 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/Microsoft/opengcs/service/gcs/gcserr"
 	"github.com/Microsoft/opengcs/service/gcs/oslayer"
 	"github.com/Microsoft/opengcs/service/gcs/prot"
-	oci "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/Microsoft/opengcs/service/gcs/stdio"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
@@ -23,15 +25,115 @@ const (
 	// that will be used as the base layer for containers.
 	baseFilesPath = "/tmp/base/"
 
-	// deviceLookupTimeout is the amount of time before deviceIDToName will
-	// give up trying to look up the device name from its ID.
-	deviceLookupTimeout = time.Second * 2
-
 	// mappedDiskMountTimeout is the amount of time before
 	// mountMappedVirtualDisks will give up trying to mount a device.
 	mappedDiskMountTimeout = time.Second * 2
 )
 
+var (
+	// DeviceRescanAttempts is the number of times the SCSI controller of a
+	// mapped virtual disk is scanned for the disk before giving up. Disks are
+	// attached asynchronously by the host, so the disk may not be visible
+	// when it is first looked up.
+	DeviceRescanAttempts = 20
+	// DeviceRescanInterval is the time waited after each scan for the disk to
+	// appear before scanning again.
+	DeviceRescanInterval = 100 * time.Millisecond
+	// MountIOAttempts is the number of times a mount which fails with EIO is
+	// attempted before giving up. Flaky backing storage can fail a mount with
+	// a transient I/O error even though a retry succeeds.
+	MountIOAttempts = 3
+)
+
+// sandboxMkfsCommands maps each filesystem the sandbox device may be formatted
+// with to the command used to format it. Each command overwrites any existing
+// filesystem on the device without prompting.
+var sandboxMkfsCommands = map[string][]string{
+	"ext4":  {"mkfs.ext4", "-F", "-q"},
+	"xfs":   {"mkfs.xfs", "-f", "-q"},
+	"btrfs": {"mkfs.btrfs", "-f", "-q"},
+}
+
+// sandboxProjectQuotaMkfsArgs maps each filesystem which needs additional
+// features to support project quotas to the arguments of its mkfs command
+// which enable them.
+var sandboxProjectQuotaMkfsArgs = map[string][]string{
+	"ext4": {"-O", "quota,project"},
+}
+
+// validateSandboxFilesystem returns an error if the sandbox device cannot be
+// formatted with filesystem.
+func validateSandboxFilesystem(filesystem string) error {
+	if _, ok := sandboxMkfsCommands[filesystem]; !ok {
+		return gcserr.WrapHresult(errors.Errorf("unsupported sandbox filesystem %q, must be one of ext4, xfs or btrfs", filesystem), gcserr.HrInvalidArg)
+	}
+	return nil
+}
+
+// validateLayers returns an HrInvalidArg error if layers is empty, or if any
+// layer has no device ID or has the same device ID as another layer.
+func validateLayers(layers []prot.Layer) error {
+	if len(layers) == 0 {
+		return gcserr.WrapHresult(errors.New("at least one layer is required"), gcserr.HrInvalidArg)
+	}
+	seen := make(map[string]int)
+	for i, layer := range layers {
+		if layer.Path == "" {
+			return gcserr.WrapHresult(errors.Errorf("layer %d has no device ID", i), gcserr.HrInvalidArg)
+		}
+		if j, ok := seen[layer.Path]; ok {
+			return gcserr.WrapHresult(errors.Errorf("layers %d and %d are both device %s", j, i, layer.Path), gcserr.HrInvalidArg)
+		}
+		seen[layer.Path] = i
+	}
+	return nil
+}
+
+// checkBlockDevice returns an error if device does not exist or is not a
+// block device.
+func (c *gcsCore) checkBlockDevice(device string) error {
+	var stat syscall.Stat_t
+	if err := c.OS.Stat(device, &stat); err != nil {
+		return errors.Wrapf(err, "device %s does not exist", device)
+	}
+	if stat.Mode&syscall.S_IFMT != syscall.S_IFBLK {
+		return errors.Errorf("%s is not a block device", device)
+	}
+	return nil
+}
+
+// formatSandbox formats device with filesystem, which must have been
+// validated with validateSandboxFilesystem. If projectQuota is true, the
+// filesystem is given the features it needs to support project quotas.
+func (c *gcsCore) formatSandbox(device, filesystem string, projectQuota bool) error {
+	mkfs := append([]string{}, sandboxMkfsCommands[filesystem]...)
+	if projectQuota {
+		mkfs = append(mkfs, sandboxProjectQuotaMkfsArgs[filesystem]...)
+	}
+	cmd := c.OS.Command(mkfs[0], append(mkfs[1:], device)...)
+	output := stdio.NewCappedBuffer()
+	cmd.SetStdout(output)
+	cmd.SetStderr(output)
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, "failed to format sandbox device %s as %s: %s", device, filesystem, output.Bytes())
+	}
+	return nil
+}
+
+// trimSandbox discards the unused blocks of the container's mounted sandbox,
+// so that the host can reclaim their space.
+func (c *gcsCore) trimSandbox(id string) error {
+	_, scratchPath, _, _ := c.getUnioningPaths(id)
+	cmd := c.OS.Command("fstrim", scratchPath)
+	output := stdio.NewCappedBuffer()
+	cmd.SetStdout(output)
+	cmd.SetStderr(output)
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, "failed to trim sandbox %s: %s", scratchPath, output.Bytes())
+	}
+	return nil
+}
+
 type mountSpec struct {
 	Source     string
 	FileSystem string
@@ -49,29 +151,44 @@ const (
 	// accesses the storage directly from host memory, reducing memory use
 	// and increasing sharing across VMs. Only supported on vPMEM devices.
 	mountOptionDax = "dax"
+	// Issue discard requests to the device as blocks are freed, so that the
+	// space can be reclaimed by the host.
+	mountOptionDiscard = "discard"
+	// Enable accounting and enforcement of project quotas.
+	mountOptionProjectQuota = "prjquota"
 
 	// For now the file system is hard-coded
 	defaultFileSystem = "ext4"
 )
 
-// Mount mounts the file system to the specified target.
+// Mount mounts the file system to the specified target. A mount which fails
+// with EIO is retried up to MountIOAttempts times in total; any other error is
+// returned immediately.
 func (ms *mountSpec) Mount(osl oslayer.OS, target string) error {
 	options := strings.Join(ms.Options, ",")
-	err := osl.Mount(ms.Source, target, ms.FileSystem, ms.Flags, options)
-	if err != nil {
-		return errors.Wrapf(err, "mount %s %s %s 0x%x %s", ms.Source, target, ms.FileSystem, ms.Flags, options)
+	for attempt := 1; ; attempt++ {
+		err := osl.Mount(ms.Source, target, ms.FileSystem, ms.Flags, options)
+		if err == nil {
+			return nil
+		}
+		if errors.Cause(err) != syscall.EIO || attempt >= MountIOAttempts {
+			return errors.Wrapf(err, "mount %s %s %s 0x%x %s", ms.Source, target, ms.FileSystem, ms.Flags, options)
+		}
+		logrus.Warnf("mount %s on %s failed with an I/O error, retrying (attempt %d of %d)", ms.Source, target, attempt, MountIOAttempts)
 	}
-	return nil
 }
 
 // getLayerMounts computes the mount specs for the scratch and layers.
-func (c *gcsCore) getLayerMounts(scratch string, layers []prot.Layer) (scratchMount *mountSpec, layerMounts []*mountSpec, err error) {
+func (c *gcsCore) getLayerMounts(ctx context.Context, scratch string, layers []prot.Layer) (scratchMount *mountSpec, layerMounts []*mountSpec, err error) {
 	layerMounts = make([]*mountSpec, len(layers))
 	for i, layer := range layers {
-		deviceName, pmem, err := deviceIDToName(c.OS, layer.Path)
+		deviceName, pmem, err := deviceIDToName(ctx, c.OS, layer.Path)
 		if err != nil {
 			return nil, nil, err
 		}
+		if err := c.checkBlockDevice(deviceName); err != nil {
+			return nil, nil, errors.Wrapf(err, "invalid layer %d", i)
+		}
 		options := []string{mountOptionNoLoad}
 		if pmem {
 			// PMEM devices support DAX and should use it
@@ -86,7 +203,7 @@ func (c *gcsCore) getLayerMounts(scratch string, layers []prot.Layer) (scratchMo
 	}
 	// An empty scratch value indicates no scratch space is to be attached.
 	if scratch != "" {
-		scratchDevice, _, err := deviceIDToName(c.OS, scratch)
+		scratchDevice, _, err := deviceIDToName(ctx, c.OS, scratch)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -99,14 +216,14 @@ func (c *gcsCore) getLayerMounts(scratch string, layers []prot.Layer) (scratchMo
 	return scratchMount, layerMounts, nil
 }
 
-// getMappedVirtualDiskMounts uses the Lun values in the given disks to
-// retrieve their associated mount spec.
-func (c *gcsCore) getMappedVirtualDiskMounts(disks []prot.MappedVirtualDisk) ([]*mountSpec, error) {
+// getMappedVirtualDiskMounts uses the Controller and Lun values in the given
+// disks to retrieve their associated mount spec.
+func (c *gcsCore) getMappedVirtualDiskMounts(ctx context.Context, disks []prot.MappedVirtualDisk) ([]*mountSpec, error) {
 	devices := make([]*mountSpec, len(disks))
 	for i, disk := range disks {
-		device, err := scsiLunToName(c.OS, disk.Lun)
+		device, err := scsiControllerLunToName(ctx, c.OS, disk.Controller, disk.Lun)
 		if err != nil {
-			return nil, errors.Wrapf(err, "failed to get device name for mapped virtual disk %s, lun %d", disk.ContainerPath, disk.Lun)
+			return nil, errors.Wrapf(err, "failed to get device name for mapped virtual disk %s, controller %d, lun %d", disk.ContainerPath, disk.Controller, disk.Lun)
 		}
 		flags := uintptr(0)
 		var options []string
@@ -124,29 +241,36 @@ func (c *gcsCore) getMappedVirtualDiskMounts(disks []prot.MappedVirtualDisk) ([]
 	return devices, nil
 }
 
-// scsiLunToName finds the SCSI device with the given LUN. This assumes
-// only one SCSI controller.
-func scsiLunToName(osl oslayer.OS, lun uint8) (string, error) {
-	scsiID := fmt.Sprintf("0:0:0:%d", lun)
+// scsiControllerLunToName finds the SCSI device with the given LUN on the
+// given controller. This assumes that SCSI controller N is exposed to the
+// kernel as SCSI host N. Only that host is scanned for the LUN, so LUNs on
+// other controllers cannot be mistaken for it. The controller is rescanned up
+// to DeviceRescanAttempts times until the device appears, or until ctx is
+// done.
+func scsiControllerLunToName(ctx context.Context, osl oslayer.OS, controller, lun uint8) (string, error) {
+	scsiID := fmt.Sprintf("%d:0:0:%d", controller, lun)
 
-	// Query for the device name up until the timeout.
 	var deviceNames []os.FileInfo
-	startTime := time.Now()
-	for {
+	for attempt := 1; ; attempt++ {
+		if err := scanSCSIHost(osl, controller, lun); err != nil {
+			return "", err
+		}
 		// Devices matching the given SCSI code should each have a subdirectory
 		// under /sys/bus/scsi/devices/<scsiID>/block.
 		var err error
 		deviceNames, err = osl.ReadDir(filepath.Join("/sys/bus/scsi/devices", scsiID, "block"))
-		if err != nil {
-			currentTime := time.Now()
-			elapsedTime := currentTime.Sub(startTime)
-			if elapsedTime > deviceLookupTimeout {
-				return "", errors.Wrap(err, "failed to retrieve SCSI device names from filesystem")
-			}
-		} else {
+		if err == nil {
 			break
 		}
-		time.Sleep(time.Millisecond * 10)
+		if attempt >= DeviceRescanAttempts {
+			return "", errors.Wrapf(err, "failed to retrieve SCSI device names from filesystem after %d scans", attempt)
+		}
+		logrus.Debugf("SCSI device %s not found, rescanning controller %d (attempt %d of %d)", scsiID, controller, attempt+1, DeviceRescanAttempts)
+		select {
+		case <-ctx.Done():
+			return "", errors.Wrapf(ctx.Err(), "abandoned waiting for SCSI device %s after %d scans", scsiID, attempt)
+		case <-time.After(DeviceRescanInterval):
+		}
 	}
 
 	if len(deviceNames) == 0 {
@@ -158,10 +282,33 @@ func scsiLunToName(osl oslayer.OS, lun uint8) (string, error) {
 	return filepath.Join("/dev", deviceNames[0].Name()), nil
 }
 
+// scanSCSIHost asks the kernel to scan the given SCSI controller for the given
+// LUN.
+func scanSCSIHost(osl oslayer.OS, controller, lun uint8) error {
+	scanPath := scsiHostScanPath(controller)
+	scanFile, err := osl.OpenFile(scanPath, os.O_WRONLY, 0)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open %s", scanPath)
+	}
+	defer scanFile.Close()
+	// The scan file takes "<channel> <target> <lun>".
+	if _, err := scanFile.Write([]byte(fmt.Sprintf("0 0 %d", lun))); err != nil {
+		return errors.Wrapf(err, "failed to scan SCSI controller %d for lun %d", controller, lun)
+	}
+	return nil
+}
+
+// scsiHostScanPath returns the path of the file which triggers a scan of the
+// given SCSI controller when written to.
+func scsiHostScanPath(controller uint8) string {
+	return filepath.Join("/sys/class/scsi_host", fmt.Sprintf("host%d", controller), "scan")
+}
+
 // deviceIDToName converts a device ID (scsi:<lun> or pmem:<device#> to a
-// device name (/dev/sd? or /dev/pmem?).
+// device name (/dev/sd? or /dev/pmem?). SCSI devices are looked up on
+// controller 0.
 // For temporary compatibility, this also accepts just <lun> for SCSI devices.
-func deviceIDToName(osl oslayer.OS, id string) (device string, pmem bool, err error) {
+func deviceIDToName(ctx context.Context, osl oslayer.OS, id string) (device string, pmem bool, err error) {
 	const (
 		pmemPrefix = "pmem:"
 		scsiPrefix = "scsi:"
@@ -177,7 +324,7 @@ func deviceIDToName(osl oslayer.OS, id string) (device string, pmem bool, err er
 	}
 
 	if lun, err := strconv.ParseInt(lunStr, 10, 8); err == nil {
-		name, err := scsiLunToName(osl, uint8(lun))
+		name, err := scsiControllerLunToName(ctx, osl, 0, uint8(lun))
 		return name, false, err
 	}
 
@@ -186,8 +333,8 @@ func deviceIDToName(osl oslayer.OS, id string) (device string, pmem bool, err er
 
 // mountMappedVirtualDisks mounts the given disks to the given directories,
 // with the given options. The device names of each disk are given in a
-// parallel slice.
-func (c *gcsCore) mountMappedVirtualDisks(disks []prot.MappedVirtualDisk, mounts []*mountSpec) error {
+// parallel slice. Retrying a mount is abandoned if ctx is done.
+func (c *gcsCore) mountMappedVirtualDisks(ctx context.Context, disks []prot.MappedVirtualDisk, mounts []*mountSpec) error {
 	if len(disks) != len(mounts) {
 		return errors.Errorf("disk and device slices were of different sizes. disks: %d, mounts: %d", len(disks), len(mounts))
 	}
@@ -198,7 +345,7 @@ func (c *gcsCore) mountMappedVirtualDisks(disks []prot.MappedVirtualDisk, mounts
 				return errors.New("we do not currently support mapping virtual disks inside the container namespace")
 			}
 			mount := mounts[i]
-			if err := c.OS.MkdirAll(disk.ContainerPath, 0700); err != nil {
+			if err := c.mkdirAll(disk.ContainerPath, 0700); err != nil {
 				return errors.Wrapf(err, "failed to create directory for mapped virtual disk %s", disk.ContainerPath)
 			}
 
@@ -221,7 +368,11 @@ func (c *gcsCore) mountMappedVirtualDisks(disks []prot.MappedVirtualDisk, mounts
 				} else {
 					break
 				}
-				time.Sleep(time.Millisecond * 10)
+				select {
+				case <-ctx.Done():
+					return errors.Wrapf(ctx.Err(), "abandoned mounting directory %s for mapped virtual disk device %s", disk.ContainerPath, mount.Source)
+				case <-time.After(time.Millisecond * 10):
+				}
 			}
 		}
 	}
@@ -253,13 +404,84 @@ func (c *gcsCore) unmountMappedVirtualDisks(disks []prot.MappedVirtualDisk) erro
 	return nil
 }
 
+// hotRemoveMappedVirtualDisk syncs and unmounts the given mapped virtual disk,
+// then removes its SCSI device from the utility VM so that the host can
+// safely detach it. If the disk is in use and cannot be unmounted, the
+// returned error has the HrBusy HRESULT.
+func (c *gcsCore) hotRemoveMappedVirtualDisk(disk prot.MappedVirtualDisk) error {
+	if !disk.AttachOnly {
+		exists, err := c.OS.PathExists(disk.ContainerPath)
+		if err != nil {
+			return errors.Wrapf(err, "failed to determine if mapped virtual disk path exists %s", disk.ContainerPath)
+		}
+		mounted, err := c.OS.PathIsMounted(disk.ContainerPath)
+		if err != nil {
+			return errors.Wrapf(err, "failed to determine if mapped virtual disk path is mounted %s", disk.ContainerPath)
+		}
+		if exists && mounted {
+			if err := c.OS.Syncfs(disk.ContainerPath); err != nil {
+				return errors.Wrapf(err, "failed to sync mapped virtual disk path %s", disk.ContainerPath)
+			}
+			if err := c.OS.Unmount(disk.ContainerPath, 0); err != nil {
+				if errors.Cause(err) == syscall.EBUSY {
+					return gcserr.WrapHresult(errors.Wrapf(err, "mapped virtual disk path %s is in use", disk.ContainerPath), gcserr.HrBusy)
+				}
+				return errors.Wrapf(err, "failed to unmount mapped virtual disk path %s", disk.ContainerPath)
+			}
+		}
+	}
+	return deleteSCSIDevice(c.OS, disk.Controller, disk.Lun)
+}
+
+// deleteSCSIDevice removes the SCSI device with the given LUN on the given
+// controller from the utility VM, flushing any data the kernel has cached for
+// it.
+func deleteSCSIDevice(osl oslayer.OS, controller, lun uint8) error {
+	deletePath := filepath.Join("/sys/bus/scsi/devices", fmt.Sprintf("%d:0:0:%d", controller, lun), "delete")
+	deleteFile, err := osl.OpenFile(deletePath, os.O_WRONLY, 0)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open %s", deletePath)
+	}
+	defer deleteFile.Close()
+	if _, err := deleteFile.Write([]byte("1")); err != nil {
+		return errors.Wrapf(err, "failed to delete SCSI device for controller %d, lun %d", controller, lun)
+	}
+	return nil
+}
+
+// mkdirAll creates the directory at path along with any missing parents. A
+// directory which already exists, such as one left behind by an earlier
+// attempt to create the same container, is not an error, but a path which
+// exists as something other than a directory is.
+func (c *gcsCore) mkdirAll(path string, perm os.FileMode) error {
+	err := c.OS.MkdirAll(path, perm)
+	if err == nil {
+		return nil
+	}
+	cause := errors.Cause(err)
+	if pathErr, ok := cause.(*os.PathError); ok {
+		cause = pathErr.Err
+	}
+	if cause != syscall.EEXIST && cause != syscall.ENOTDIR {
+		return err
+	}
+	var stat syscall.Stat_t
+	if statErr := c.OS.Stat(path, &stat); statErr != nil {
+		return err
+	}
+	if stat.Mode&syscall.S_IFMT != syscall.S_IFDIR {
+		return errors.Errorf("%s already exists and is not a directory", path)
+	}
+	return nil
+}
+
 // mountMappedDirectory mounts the given mapped directory using a Plan9
 // filesystem with the given options.
 func (c *gcsCore) mountMappedDirectory(dir *prot.MappedDirectory) error {
 	if !dir.CreateInUtilityVM {
 		return errors.New("we do not currently support mapping directories inside the container namespace")
 	}
-	if err := c.OS.MkdirAll(dir.ContainerPath, 0700); err != nil {
+	if err := c.mkdirAll(dir.ContainerPath, 0700); err != nil {
 		return errors.Wrapf(err, "failed to create directory for mapped directory %s", dir.ContainerPath)
 	}
 	conn, err := c.vsock.Dial(dir.Port)
@@ -308,21 +530,25 @@ func (c *gcsCore) unmountMappedDirectories(dirs []prot.MappedDirectory) error {
 // mountLayers mounts each device into a mountpoint, and then layers them into a
 // union filesystem in the given order.
 // These mountpoints are all stored under a directory reserved for the container
-// with the given ID.
-func (c *gcsCore) mountLayers(id string, scratchMount *mountSpec, layers []*mountSpec) error {
-	layerPrefix, scratchPath, workdirPath, rootfsPath := c.getUnioningPaths(id)
+// with the given ID. upperDir and workdirPath are used as the overlay's upperdir
+// and workdir, and must be on the same filesystem. The time taken by each
+// phase is recorded in timings, which may be nil.
+func (c *gcsCore) mountLayers(id string, scratchMount *mountSpec, layers []*mountSpec, upperDir, workdirPath string, timings *startTimings) error {
+	layerPrefix, scratchPath, _, rootfsPath := c.getUnioningPaths(id)
 
 	logrus.Infof("layerPrefix=%s\n", layerPrefix)
 	logrus.Infof("scratchPath:%s\n", scratchPath)
+	logrus.Infof("upperDir=%s\n", upperDir)
 	logrus.Infof("workdirPath=%s\n", workdirPath)
 	logrus.Infof("rootfsPath=%s\n", rootfsPath)
 
 	// Mount the layer devices.
+	stopLayerMount := timings.begin(phaseLayerMount)
 	layerPaths := make([]string, len(layers)+1)
 	for i, layer := range layers {
 		layerPath := fmt.Sprintf("%s%d", layerPrefix, i)
 		logrus.Infof("layerPath: %s\n", layerPath)
-		if err := c.OS.MkdirAll(layerPath, 0700); err != nil {
+		if err := c.mkdirAll(layerPath, 0700); err != nil {
 			return errors.Wrapf(err, "failed to create directory for layer %s", layerPath)
 		}
 		if err := layer.Mount(c.OS, layerPath); err != nil {
@@ -330,6 +556,7 @@ func (c *gcsCore) mountLayers(id string, scratchMount *mountSpec, layers []*moun
 		}
 		layerPaths[i+1] = layerPath
 	}
+	stopLayerMount()
 	// TODO: The base path code may be temporary until a more permanent DNS
 	// solution is reached.
 	// NOTE: This should probably still always be kept, because otherwise
@@ -340,14 +567,17 @@ func (c *gcsCore) mountLayers(id string, scratchMount *mountSpec, layers []*moun
 
 	// Mount the layers into a union filesystem.
 	var mountOptions uintptr
-	if err := c.OS.MkdirAll(baseFilesPath, 0700); err != nil {
+	if err := c.mkdirAll(baseFilesPath, 0700); err != nil {
 		return errors.Wrapf(err, "failed to create directory for base files %s", baseFilesPath)
 	}
-	if err := c.OS.MkdirAll(scratchPath, 0755); err != nil {
+	if err := c.mkdirAll(scratchPath, 0755); err != nil {
 		return errors.Wrapf(err, "failed to create directory for scratch space %s", scratchPath)
 	}
 	if scratchMount != nil {
-		if err := scratchMount.Mount(c.OS, scratchPath); err != nil {
+		stopSandboxMount := timings.begin(phaseSandboxMount)
+		err := scratchMount.Mount(c.OS, scratchPath)
+		stopSandboxMount()
+		if err != nil {
 			return errors.Wrapf(err, "failed to mount scratch directory %s", scratchPath)
 		}
 	} else {
@@ -355,18 +585,22 @@ func (c *gcsCore) mountLayers(id string, scratchMount *mountSpec, layers []*moun
 		// readonly.
 		mountOptions |= syscall.O_RDONLY
 	}
-	upperDir := filepath.Join(scratchPath, "upper")
-	if err := c.OS.MkdirAll(upperDir, 0755); err != nil {
-		return errors.Wrap(err, "failed to create upper directory in scratch space")
+	if err := c.mkdirAll(upperDir, 0755); err != nil {
+		return errors.Wrapf(err, "failed to create upper directory %s", upperDir)
+	}
+	if err := c.mkdirAll(workdirPath, 0755); err != nil {
+		return errors.Wrapf(err, "failed to create workdir %s", workdirPath)
 	}
-	if err := c.OS.MkdirAll(workdirPath, 0755); err != nil {
-		return errors.Wrap(err, "failed to create workdir in scratch space")
+	if err := c.checkSameFilesystem(upperDir, workdirPath); err != nil {
+		return errors.Wrap(err, "overlay upperdir and workdir must be on the same filesystem")
 	}
-	if err := c.OS.MkdirAll(rootfsPath, 0755); err != nil {
+	if err := c.mkdirAll(rootfsPath, 0755); err != nil {
 		return errors.Wrapf(err, "failed to create directory for container root filesystem %s", rootfsPath)
 	}
 	lowerdir := strings.Join(layerPaths, ":")
 	options := fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s", lowerdir, upperDir, workdirPath)
+	stopOverlay := timings.begin(phaseOverlay)
+	defer stopOverlay()
 	if err := c.OS.Mount("overlay", rootfsPath, "overlay", mountOptions, options); err != nil {
 		return errors.Wrapf(err, "failed to mount container root filesystem using overlayfs %s", rootfsPath)
 	}
@@ -444,11 +678,11 @@ func (c *gcsCore) destroyContainerStorage(id string) error {
 	return nil
 }
 
-// writeConfigFile writes the given oci.Spec to disk so that it can be consumed
-// by an OCI runtime.
-func (c *gcsCore) writeConfigFile(id string, config oci.Spec) error {
+// writeConfigFile writes the given configuration to disk so that it can be
+// consumed by an OCI runtime.
+func (c *gcsCore) writeConfigFile(id string, config runtimeConfig) error {
 	configPath := c.getConfigPath(id)
-	if err := c.OS.MkdirAll(filepath.Dir(configPath), 0700); err != nil {
+	if err := c.mkdirAll(filepath.Dir(configPath), 0700); err != nil {
 		return errors.Wrapf(err, "failed to create config file directory for container %s", id)
 	}
 	configFile, err := c.OS.Create(configPath)
@@ -483,6 +717,38 @@ func (c *gcsCore) getUnioningPaths(id string) (layerPrefix string, scratchPath s
 	return
 }
 
+// getOverlayDirs returns the overlay upperdir and workdir for the container
+// with the given ID. The paths given in settings are used if set, otherwise
+// they are derived from the container's scratch space. CreateContainer ensures
+// that either both or neither are set.
+func (c *gcsCore) getOverlayDirs(id string, settings prot.VMHostedContainerSettings) (upperDir string, workdirPath string) {
+	_, scratchPath, workdirPath, _ := c.getUnioningPaths(id)
+	upperDir = filepath.Join(scratchPath, "upper")
+	if settings.UpperDirPath != "" {
+		upperDir = settings.UpperDirPath
+	}
+	if settings.WorkDirPath != "" {
+		workdirPath = settings.WorkDirPath
+	}
+	return
+}
+
+// checkSameFilesystem returns an error if the two given paths do not reside on
+// the same filesystem.
+func (c *gcsCore) checkSameFilesystem(path1, path2 string) error {
+	var stat1, stat2 syscall.Stat_t
+	if err := c.OS.Stat(path1, &stat1); err != nil {
+		return errors.Wrapf(err, "failed to stat %s", path1)
+	}
+	if err := c.OS.Stat(path2, &stat2); err != nil {
+		return errors.Wrapf(err, "failed to stat %s", path2)
+	}
+	if stat1.Dev != stat2.Dev {
+		return errors.Errorf("%s and %s are on different filesystems", path1, path2)
+	}
+	return nil
+}
+
 // getConfigPath returns the path to the container's config file.
 func (c *gcsCore) getConfigPath(id string) string {
 	return filepath.Join(c.getContainerStoragePath(id), "config.json")
@@ -1,6 +1,7 @@
 package gcs
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -343,7 +344,8 @@ var _ = Describe("Storage", func() {
 			})
 			It("should behave properly", func() {
 				// Mount the layers.
-				err = coreint.mountLayers(containerID, scratchSpec, layerSpecs)
+				upperDir, workdirPath := coreint.getOverlayDirs(containerID, prot.VMHostedContainerSettings{})
+				err = coreint.mountLayers(containerID, scratchSpec, layerSpecs, upperDir, workdirPath, nil)
 				Expect(err).NotTo(HaveOccurred())
 
 				containerPath := filepath.Join("/tmp", "gcs", containerID)
@@ -451,7 +453,8 @@ var _ = Describe("Storage", func() {
 			})
 			It("should behave properly", func() {
 				// Mount the layers.
-				err = coreint.mountLayers(containerID, nil, layerSpecs)
+				upperDir, workdirPath := coreint.getOverlayDirs(containerID, prot.VMHostedContainerSettings{})
+				err = coreint.mountLayers(containerID, nil, layerSpecs, upperDir, workdirPath, nil)
 				Expect(err).NotTo(HaveOccurred())
 
 				containerPath := filepath.Join("/tmp", "gcs", containerID)
@@ -550,7 +553,8 @@ var _ = Describe("Storage", func() {
 			})
 			It("should behave properly", func() {
 				// Mount the layers.
-				err = coreint.mountLayers(containerID, scratchSpec, nil)
+				upperDir, workdirPath := coreint.getOverlayDirs(containerID, prot.VMHostedContainerSettings{})
+				err = coreint.mountLayers(containerID, scratchSpec, nil, upperDir, workdirPath, nil)
 				Expect(err).NotTo(HaveOccurred())
 
 				containerPath := filepath.Join("/tmp", "gcs", containerID)
@@ -644,7 +648,8 @@ var _ = Describe("Storage", func() {
 			})
 			It("should behave properly", func() {
 				// Mount the layers.
-				err = coreint.mountLayers(containerID, nil, nil)
+				upperDir, workdirPath := coreint.getOverlayDirs(containerID, prot.VMHostedContainerSettings{})
+				err = coreint.mountLayers(containerID, nil, nil, upperDir, workdirPath, nil)
 				Expect(err).NotTo(HaveOccurred())
 
 				containerPath := filepath.Join("/tmp", "gcs", containerID)
@@ -774,7 +779,7 @@ var _ = Describe("Storage", func() {
 						{Source: "/dev/loop0", FileSystem: defaultFileSystem, Flags: syscall.MS_RDONLY},
 						{Source: "/dev/loop1", FileSystem: defaultFileSystem},
 					}
-					err = coreint.mountMappedVirtualDisks([]prot.MappedVirtualDisk{disk1, disk2}, ms)
+					err = coreint.mountMappedVirtualDisks(context.Background(), []prot.MappedVirtualDisk{disk1, disk2}, ms)
 					Expect(err).NotTo(HaveOccurred())
 
 					// Check the state of layer1.
@@ -862,9 +867,9 @@ var _ = Describe("Storage", func() {
 					// Mount the disks.
 					ms1 := []*mountSpec{{Source: "/dev/loop0", FileSystem: defaultFileSystem, Flags: syscall.MS_RDONLY}}
 					ms2 := []*mountSpec{{Source: "/dev/loop1", FileSystem: defaultFileSystem}}
-					err = coreint.mountMappedVirtualDisks([]prot.MappedVirtualDisk{disk1}, ms1)
+					err = coreint.mountMappedVirtualDisks(context.Background(), []prot.MappedVirtualDisk{disk1}, ms1)
 					Expect(err).To(HaveOccurred())
-					err = coreint.mountMappedVirtualDisks([]prot.MappedVirtualDisk{disk2}, ms2)
+					err = coreint.mountMappedVirtualDisks(context.Background(), []prot.MappedVirtualDisk{disk2}, ms2)
 					Expect(err).To(HaveOccurred())
 				})
 			})
@@ -895,7 +900,7 @@ var _ = Describe("Storage", func() {
 
 					// Mount the disks.
 					ms := []*mountSpec{{Source: "/dev/fakeloop"}}
-					err = coreint.mountMappedVirtualDisks([]prot.MappedVirtualDisk{disk}, ms)
+					err = coreint.mountMappedVirtualDisks(context.Background(), []prot.MappedVirtualDisk{disk}, ms)
 					Expect(err).To(HaveOccurred())
 				})
 			})
@@ -0,0 +1,127 @@
+package gcs
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	oci "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// syslogDevicePath is where the syslog socket is bind mounted in a container
+// created with ForwardSyslog.
+const syslogDevicePath = "/dev/log"
+
+// maxSyslogMessageBytes is the largest syslog message which is forwarded
+// whole. Longer datagrams are truncated.
+const maxSyslogMessageBytes = 64 * 1024
+
+// syslogForwarder listens on a unix datagram socket in the utility VM and
+// writes each message received on it, followed by a newline, to a writer.
+type syslogForwarder struct {
+	conn      *net.UnixConn
+	path      string
+	closeOnce sync.Once
+}
+
+// getSyslogSocketPath returns the path in the utility VM of the syslog socket
+// of the container with the given ID.
+func (c *gcsCore) getSyslogSocketPath(id string) string {
+	return filepath.Join(c.getContainerStoragePath(id), "syslog.sock")
+}
+
+// startSyslogForwarder creates a syslog socket at path and forwards the
+// messages written to it to w until it is closed. The socket is a real file
+// regardless of the OS layer, since it has to be bind mounted into the
+// container.
+func startSyslogForwarder(path string, w io.Writer) (*syslogForwarder, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, errors.Wrapf(err, "failed to create directory for syslog socket %s", path)
+	}
+	// A socket left behind by a previous container with the same ID would
+	// prevent binding.
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrapf(err, "failed to remove stale syslog socket %s", path)
+	}
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to listen on syslog socket %s", path)
+	}
+	// Processes in the container may run as any user.
+	if err := os.Chmod(path, 0666); err != nil {
+		conn.Close()
+		os.Remove(path)
+		return nil, errors.Wrapf(err, "failed to set permissions of syslog socket %s", path)
+	}
+	f := &syslogForwarder{conn: conn, path: path}
+	go f.forward(w)
+	return f, nil
+}
+
+// forward copies messages from the socket to w until the socket is closed.
+func (f *syslogForwarder) forward(w io.Writer) {
+	buf := make([]byte, maxSyslogMessageBytes)
+	for {
+		n, _, err := f.conn.ReadFrom(buf)
+		if err != nil {
+			logrus.Debugf("stopped forwarding syslog messages from %s: %s", f.path, err)
+			return
+		}
+		message := bytes.TrimRight(buf[:n], "\r\n\x00")
+		if len(message) == 0 {
+			continue
+		}
+		if _, err := w.Write(append(message, '\n')); err != nil {
+			logrus.Warnf("failed to forward syslog message from %s: %s", f.path, err)
+		}
+	}
+}
+
+// Close stops forwarding and removes the socket. It may be called more than
+// once.
+func (f *syslogForwarder) Close() error {
+	var err error
+	f.closeOnce.Do(func() {
+		err = f.conn.Close()
+		if removeErr := os.Remove(f.path); removeErr != nil && !os.IsNotExist(removeErr) && err == nil {
+			err = removeErr
+		}
+	})
+	return errors.Wrapf(err, "failed to close syslog socket %s", f.path)
+}
+
+// syslogSocketPath returns the path of the container's syslog socket, or ""
+// if it was not created with ForwardSyslog.
+func (e *containerCacheEntry) syslogSocketPath() string {
+	if e.syslog == nil {
+		return ""
+	}
+	return e.syslog.path
+}
+
+// withSyslogMount returns a copy of config which bind mounts the syslog socket
+// at socketPath over /dev/log in the container, replacing any existing mount
+// there. If socketPath is empty, config is returned unchanged.
+func withSyslogMount(config oci.Spec, socketPath string) oci.Spec {
+	if socketPath == "" {
+		return config
+	}
+	mounts := make([]oci.Mount, 0, len(config.Mounts)+1)
+	for _, mount := range config.Mounts {
+		if filepath.Clean(mount.Destination) != syslogDevicePath {
+			mounts = append(mounts, mount)
+		}
+	}
+	config.Mounts = append(mounts, oci.Mount{
+		Destination: syslogDevicePath,
+		Type:        "bind",
+		Source:      socketPath,
+		Options:     []string{"rbind", "rw"},
+	})
+	return config
+}
@@ -0,0 +1,145 @@
+package gcs
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Microsoft/opengcs/service/gcs/gcserr"
+	"github.com/Microsoft/opengcs/service/gcs/prot"
+	oci "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pkg/errors"
+)
+
+// timeNamespacePath exists if the kernel supports time namespaces.
+const timeNamespacePath = "/proc/self/ns/time"
+
+// timeNamespace is the OCI namespace type of a time namespace, which the
+// vendored runtime specification predates.
+const timeNamespace oci.LinuxNamespaceType = "time"
+
+// checkTimeNamespaceSupport returns an HrNotImpl error if the kernel does not
+// support time namespaces, so a container's clocks cannot be offset.
+func (c *gcsCore) checkTimeNamespaceSupport() error {
+	exists, err := c.OS.PathExists(timeNamespacePath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to check for time namespace support at %s", timeNamespacePath)
+	}
+	if !exists {
+		return gcserr.WrapHresult(errors.Errorf("the kernel does not support time namespaces: %s does not exist", timeNamespacePath), gcserr.HrNotImpl)
+	}
+	return nil
+}
+
+// withTimeNamespace returns a copy of config with a private time namespace
+// added, if offset is set and config does not already have one.
+func withTimeNamespace(config oci.Spec, offset *prot.TimeOffset) oci.Spec {
+	if offset == nil {
+		return config
+	}
+	var linux oci.Linux
+	if config.Linux != nil {
+		linux = *config.Linux
+	}
+	for _, namespace := range linux.Namespaces {
+		if namespace.Type == timeNamespace {
+			config.Linux = &linux
+			return config
+		}
+	}
+	namespaces := make([]oci.LinuxNamespace, 0, len(linux.Namespaces)+1)
+	namespaces = append(namespaces, linux.Namespaces...)
+	linux.Namespaces = append(namespaces, oci.LinuxNamespace{Type: timeNamespace})
+	config.Linux = &linux
+	return config
+}
+
+// linuxTimeOffset is the offset of one clock in the linux.timeOffsets field of
+// an OCI specification. Nanosecs is always in [0, 1e9), so a negative offset
+// has a negative Secs.
+type linuxTimeOffset struct {
+	Secs     int64  `json:"secs"`
+	Nanosecs uint32 `json:"nanosecs"`
+}
+
+// toLinuxTimeOffset splits an offset in nanoseconds into seconds and
+// nanoseconds as the kernel expects them.
+func toLinuxTimeOffset(nanoseconds int64) linuxTimeOffset {
+	secs := nanoseconds / int64(time.Second)
+	nanosecs := nanoseconds % int64(time.Second)
+	if nanosecs < 0 {
+		secs--
+		nanosecs += int64(time.Second)
+	}
+	return linuxTimeOffset{Secs: secs, Nanosecs: uint32(nanosecs)}
+}
+
+// runtimeConfig is the configuration written to a container's bundle for the
+// container runtime. It is the container's OCI specification, along with the
+// clock offsets of its time namespace, if it has one, which are in the
+// linux.timeOffsets field of newer runtime specifications than the vendored
+// one.
+type runtimeConfig struct {
+	oci.Spec
+	timeOffset *prot.TimeOffset
+}
+
+// MarshalJSON encodes the configuration as an OCI specification.
+func (r runtimeConfig) MarshalJSON() ([]byte, error) {
+	if r.timeOffset == nil {
+		return json.Marshal(r.Spec)
+	}
+	var linux oci.Linux
+	if r.Spec.Linux != nil {
+		linux = *r.Spec.Linux
+	}
+	return json.Marshal(struct {
+		oci.Spec
+		Linux linuxWithTimeOffsets `json:"linux"`
+	}{
+		Spec: r.Spec,
+		Linux: linuxWithTimeOffsets{
+			Linux: linux,
+			TimeOffsets: map[string]linuxTimeOffset{
+				"monotonic": toLinuxTimeOffset(r.timeOffset.MonotonicNanoseconds),
+				"boottime":  toLinuxTimeOffset(r.timeOffset.BoottimeNanoseconds),
+			},
+		},
+	})
+}
+
+// linuxWithTimeOffsets is the linux section of an OCI specification with the
+// linux.timeOffsets field.
+type linuxWithTimeOffsets struct {
+	oci.Linux
+	TimeOffsets map[string]linuxTimeOffset `json:"timeOffsets"`
+}
+
+// GetTimeOffset returns the offset of the clocks of the container with the
+// given ID. A container without a time namespace has a zero offset.
+func (c *gcsCore) GetTimeOffset(id string) (prot.TimeOffset, error) {
+	c.containerCacheMutex.RLock()
+	defer c.containerCacheMutex.RUnlock()
+
+	containerEntry := c.getContainer(id)
+	if containerEntry == nil {
+		return prot.TimeOffset{}, errors.WithStack(gcserr.NewContainerDoesNotExistError(id))
+	}
+	if containerEntry.timeOffset == nil {
+		return prot.TimeOffset{}, nil
+	}
+	return *containerEntry.timeOffset, nil
+}
+
+// setTimeOffset replaces the clock offset of the container in containerEntry,
+// which is applied when its init process is started.
+// This function expects containerCacheMutex to be locked on entry.
+func (c *gcsCore) setTimeOffset(containerEntry *containerCacheEntry, offset prot.TimeOffset) error {
+	if containerEntry.hasRunInitProcess {
+		return errors.Errorf("the time offset of container %s cannot be changed once it has been started", containerEntry.ID)
+	}
+	if err := c.checkTimeNamespaceSupport(); err != nil {
+		return err
+	}
+	containerEntry.timeOffset = &offset
+	return nil
+}
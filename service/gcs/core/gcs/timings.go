@@ -0,0 +1,91 @@
+package gcs
+
+import (
+	"time"
+
+	"github.com/Microsoft/opengcs/service/gcs/gcserr"
+	"github.com/Microsoft/opengcs/service/gcs/prot"
+	"github.com/pkg/errors"
+)
+
+// startPhase identifies a phase of creating and starting a container whose
+// duration is recorded in its startTimings.
+type startPhase int
+
+const (
+	phaseLayerMount startPhase = iota
+	phaseSandboxMount
+	phaseOverlay
+	phaseNetwork
+	phaseInitExec
+)
+
+// startTimings records how long each phase of creating and starting a
+// container takes, as measured by the core's clock. A phase may be timed more
+// than once, in which case the durations are added together. Its methods may be
+// called on a nil *startTimings, in which case nothing is recorded.
+type startTimings struct {
+	now     func() time.Time
+	created time.Time
+	timings prot.ContainerStartTimings
+}
+
+// newStartTimings returns a startTimings for a container whose creation began
+// at the current time according to now.
+func newStartTimings(now func() time.Time) *startTimings {
+	return &startTimings{now: now, created: now()}
+}
+
+// begin starts timing phase, and returns a function which stops timing it.
+func (t *startTimings) begin(phase startPhase) func() {
+	if t == nil {
+		return func() {}
+	}
+	start := t.now()
+	return func() {
+		elapsed := microseconds(t.now().Sub(start))
+		switch phase {
+		case phaseLayerMount:
+			t.timings.LayerMountMicroseconds += elapsed
+		case phaseSandboxMount:
+			t.timings.SandboxMountMicroseconds += elapsed
+		case phaseOverlay:
+			t.timings.OverlayMicroseconds += elapsed
+		case phaseNetwork:
+			t.timings.NetworkMicroseconds += elapsed
+		case phaseInitExec:
+			t.timings.InitExecMicroseconds += elapsed
+		}
+	}
+}
+
+// finish records the time from the container's creation until now as the
+// total time taken to start it.
+func (t *startTimings) finish() {
+	if t == nil {
+		return
+	}
+	t.timings.TotalMicroseconds = microseconds(t.now().Sub(t.created))
+}
+
+// microseconds returns d in whole microseconds, or zero if it is negative.
+func microseconds(d time.Duration) uint64 {
+	if d < 0 {
+		return 0
+	}
+	return uint64(d / time.Microsecond)
+}
+
+// GetStartTimings returns how long each phase of creating and starting the
+// container with the given ID took. Phases which have not happened yet are
+// reported as zero.
+func (c *gcsCore) GetStartTimings(id string) (prot.ContainerStartTimings, error) {
+	c.containerCacheMutex.RLock()
+	defer c.containerCacheMutex.RUnlock()
+
+	containerEntry := c.getContainer(id)
+	if containerEntry == nil {
+		return prot.ContainerStartTimings{}, errors.WithStack(gcserr.NewContainerDoesNotExistError(id))
+	}
+	return containerEntry.startTimings.timings, nil
+}
@@ -0,0 +1,168 @@
+package gcs
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Microsoft/opengcs/service/gcs/gcserr"
+	oci "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pkg/errors"
+)
+
+// validateUser returns an HrInvalidArg error if user is not of the form user
+// or user:group.
+func validateUser(user string) error {
+	parts := strings.Split(user, ":")
+	if len(parts) > 2 {
+		return gcserr.WrapHresult(errors.Errorf("user \"%s\" must be of the form user or user:group", user), gcserr.HrInvalidArg)
+	}
+	for _, part := range parts {
+		if part == "" {
+			return gcserr.WrapHresult(errors.Errorf("user \"%s\" must be of the form user or user:group", user), gcserr.HrInvalidArg)
+		}
+	}
+	return nil
+}
+
+// passwdEntry is a line of an /etc/passwd or /etc/group file, split into its
+// fields.
+type passwdEntry []string
+
+// readPasswdEntries returns the entries of the passwd or group file at path,
+// skipping comments and lines with fewer than minFields fields. A file which
+// does not exist has no entries.
+func (c *gcsCore) readPasswdEntries(path string, minFields int) ([]passwdEntry, error) {
+	f, err := c.OS.OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		if os.IsNotExist(errors.Cause(err)) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "failed to open %s", path)
+	}
+	defer f.Close()
+
+	var entries []passwdEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		if len(fields) < minFields {
+			continue
+		}
+		entries = append(entries, passwdEntry(fields))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", path)
+	}
+	return entries, nil
+}
+
+// resolveUser resolves user, of the form user or user:group where each is a
+// name or a numeric ID, against /etc/passwd and /etc/group in the root
+// filesystem at rootfsPath. A numeric user which is not in /etc/passwd is
+// used as is, with group 0 unless a group is given. If no group is given, the
+// user's primary group is used. The groups in /etc/group which list the user
+// as a member are added as supplementary groups.
+func (c *gcsCore) resolveUser(rootfsPath, user string) (oci.User, error) {
+	parts := strings.SplitN(user, ":", 2)
+	passwd, err := c.readPasswdEntries(filepath.Join(rootfsPath, "etc", "passwd"), 4)
+	if err != nil {
+		return oci.User{}, err
+	}
+	groups, err := c.readPasswdEntries(filepath.Join(rootfsPath, "etc", "group"), 3)
+	if err != nil {
+		return oci.User{}, err
+	}
+
+	var resolved oci.User
+	var name string
+	uid, numeric := parseID(parts[0])
+	found := false
+	for _, entry := range passwd {
+		entryUID, ok := parseID(entry[2])
+		if !ok || (numeric && entryUID != uid) || (!numeric && entry[0] != parts[0]) {
+			continue
+		}
+		gid, ok := parseID(entry[3])
+		if !ok {
+			return oci.User{}, errors.Errorf("user %s has an invalid group ID \"%s\" in /etc/passwd", entry[0], entry[3])
+		}
+		name, resolved.UID, resolved.GID, found = entry[0], entryUID, gid, true
+		break
+	}
+	if !found {
+		if !numeric {
+			return oci.User{}, gcserr.WrapHresult(errors.Errorf("user %s was not found in /etc/passwd", parts[0]), gcserr.HrInvalidArg)
+		}
+		resolved.UID = uid
+	}
+
+	if len(parts) == 2 {
+		gid, ok := parseID(parts[1])
+		if !ok {
+			gid, ok = findGroup(groups, parts[1])
+			if !ok {
+				return oci.User{}, gcserr.WrapHresult(errors.Errorf("group %s was not found in /etc/group", parts[1]), gcserr.HrInvalidArg)
+			}
+		}
+		resolved.GID = gid
+	}
+
+	if name != "" {
+		for _, entry := range groups {
+			gid, ok := parseID(entry[2])
+			if !ok || gid == resolved.GID || len(entry) < 4 {
+				continue
+			}
+			for _, member := range strings.Split(entry[3], ",") {
+				if member == name {
+					resolved.AdditionalGids = append(resolved.AdditionalGids, gid)
+					break
+				}
+			}
+		}
+	}
+	return resolved, nil
+}
+
+// withInitUser returns a copy of config whose process runs as user, resolved
+// against the root filesystem of the container with the given ID.
+func (c *gcsCore) withInitUser(id string, config oci.Spec, user string) (oci.Spec, error) {
+	_, _, _, rootfsPath := c.getUnioningPaths(id)
+	resolved, err := c.resolveUser(rootfsPath, user)
+	if err != nil {
+		return config, errors.Wrapf(err, "failed to resolve user %s in container %s", user, id)
+	}
+	var process oci.Process
+	if config.Process != nil {
+		process = *config.Process
+	}
+	process.User = resolved
+	config.Process = &process
+	return config, nil
+}
+
+// findGroup returns the ID of the group with the given name in groups.
+func findGroup(groups []passwdEntry, name string) (uint32, bool) {
+	for _, entry := range groups {
+		if entry[0] == name {
+			return parseID(entry[2])
+		}
+	}
+	return 0, false
+}
+
+// parseID parses s as a numeric user or group ID.
+func parseID(s string) (uint32, bool) {
+	id, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(id), true
+}
@@ -2,12 +2,19 @@
 package mockcore
 
 import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/Microsoft/opengcs/service/gcs/oslayer"
 	"github.com/Microsoft/opengcs/service/gcs/prot"
 	"github.com/Microsoft/opengcs/service/gcs/runtime"
 	"github.com/Microsoft/opengcs/service/gcs/stdio"
+	oci "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/pkg/errors"
 )
 
@@ -22,6 +29,9 @@ const (
 	// SingleSuccess specifies that the first method call should succeed and additional
 	// calls should return an error.
 	SingleSuccess
+	// Hang specifies that method calls taking a context should block until the
+	// context is done and then return its error. Other method calls succeed.
+	Hang
 )
 
 // CreateContainerCall captures the arguments of CreateContainer.
@@ -30,6 +40,27 @@ type CreateContainerCall struct {
 	Settings prot.VMHostedContainerSettings
 }
 
+// ValidateContainerCall captures the arguments of ValidateContainer.
+type ValidateContainerCall struct {
+	ID       string
+	Settings prot.VMHostedContainerSettings
+}
+
+// OpenContainerFileCall captures the arguments of OpenContainerFile.
+type OpenContainerFileCall struct {
+	ID   string
+	Path string
+}
+
+// WriteContainerFileCall captures the arguments of WriteContainerFile, with
+// the contents read from its reader.
+type WriteContainerFileCall struct {
+	ID       string
+	Path     string
+	Mode     os.FileMode
+	Contents []byte
+}
+
 // ExecProcessCall captures the arguments of ExecProcess.
 type ExecProcessCall struct {
 	ID       string
@@ -43,6 +74,13 @@ type SignalContainerCall struct {
 	Signal oslayer.Signal
 }
 
+// ShutdownContainerCall captures the arguments of ShutdownContainer.
+type ShutdownContainerCall struct {
+	ID          string
+	Signal      oslayer.Signal
+	GracePeriod time.Duration
+}
+
 // SignalProcessCall captures the arguments of SignalProcess.
 type SignalProcessCall struct {
 	Pid     int
@@ -83,22 +121,141 @@ type WaitProcessCall struct {
 	Pid int
 }
 
+// GetProcessCreatedTimeCall captures the arguments of GetProcessCreatedTime
+type GetProcessCreatedTimeCall struct {
+	Pid int
+}
+
+// GetScratchDiskUsageCall captures the arguments of GetScratchDiskUsage
+type GetScratchDiskUsageCall struct {
+	ID string
+}
+
+// SyncContainerCall captures the arguments of SyncContainer
+type SyncContainerCall struct {
+	ID      string
+	Freeze  bool
+	Timeout time.Duration
+}
+
+// CheckpointContainerCall captures the arguments of CheckpointContainer
+type CheckpointContainerCall struct {
+	ID      string
+	Options prot.CheckpointOptions
+}
+
+// RestoreContainerCall captures the arguments of RestoreContainer
+type RestoreContainerCall struct {
+	ID      string
+	Config  oci.Spec
+	Options prot.CheckpointOptions
+}
+
+// GetInitOutputCall captures the arguments of GetInitOutput
+type GetInitOutputCall struct {
+	ID string
+}
+
+// GetContainerMetadataCall captures the arguments of GetContainerMetadata
+type GetContainerMetadataCall struct {
+	ID string
+}
+
+// AttachProcessCall captures the arguments of AttachProcess.
+type AttachProcessCall struct {
+	ID       string
+	Pid      int
+	StdioSet *stdio.ConnectionSet
+}
+
+// GetContainerStateCall captures the arguments of GetContainerState.
+type GetContainerStateCall struct {
+	ID string
+}
+
+// GetMountsCall captures the arguments of GetMounts.
+type GetMountsCall struct {
+	ID string
+}
+
+// GetStartTimingsCall captures the arguments of GetStartTimings.
+type GetStartTimingsCall struct {
+	ID string
+}
+
+// GetTimeOffsetCall captures the arguments of GetTimeOffset.
+type GetTimeOffsetCall struct {
+	ID string
+}
+
+// GetNetworkStatsCall captures the arguments of GetNetworkStats.
+type GetNetworkStatsCall struct {
+	ID string
+}
+
+// DeleteContainerCall captures the arguments of DeleteContainer.
+type DeleteContainerCall struct {
+	ID string
+}
+
+// RestartInitCall captures the arguments of RestartInit.
+type RestartInitCall struct {
+	ID string
+}
+
+// WriteProcessStdinCall captures the arguments of WriteProcessStdin.
+type WriteProcessStdinCall struct {
+	ID   string
+	Pid  int
+	Data []byte
+}
+
 // MockCore serves as an argument capture mechanism which implements the Core
 // interface. Arguments passed to one of its methods are stored to be queried
 // later.
 type MockCore struct {
-	Behavior               Behavior
-	LastCreateContainer    CreateContainerCall
-	LastExecProcess        ExecProcessCall
-	LastSignalContainer    SignalContainerCall
-	LastSignalProcess      SignalProcessCall
-	LastListProcesses      ListProcessesCall
-	LastRunExternalProcess RunExternalProcessCall
-	LastModifySettings     ModifySettingsCall
-	LastResizeConsole      ResizeConsoleCall
-	LastWaitContainer      WaitContainerCall
-	LastWaitProcess        WaitProcessCall
-	WaitContainerWg        sync.WaitGroup
+	Behavior                     Behavior
+	LastCreateContainer          CreateContainerCall
+	LastExecProcess              ExecProcessCall
+	LastSignalContainer          SignalContainerCall
+	LastSignalContainerProcesses SignalContainerCall
+	LastShutdownContainer        ShutdownContainerCall
+	LastSignalProcess            SignalProcessCall
+	LastListProcesses            ListProcessesCall
+	LastRunExternalProcess       RunExternalProcessCall
+	LastModifySettings           ModifySettingsCall
+	LastResizeConsole            ResizeConsoleCall
+	LastWaitContainer            WaitContainerCall
+	LastWaitProcess              WaitProcessCall
+	LastGetProcessCreatedTime    GetProcessCreatedTimeCall
+	LastGetScratchDiskUsage      GetScratchDiskUsageCall
+	LastSyncContainer            SyncContainerCall
+	LastCheckpointContainer      CheckpointContainerCall
+	LastRestoreContainer         RestoreContainerCall
+	LastGetInitOutput            GetInitOutputCall
+	LastGetContainerMetadata     GetContainerMetadataCall
+	LastGetContainerState        GetContainerStateCall
+	LastAttachProcess            AttachProcessCall
+	LastGetMounts                GetMountsCall
+	LastDeleteContainer          DeleteContainerCall
+	LastRestartInit              RestartInitCall
+	LastWriteProcessStdin        WriteProcessStdinCall
+	LastGetStartTimings          GetStartTimingsCall
+	LastGetTimeOffset            GetTimeOffsetCall
+	LastGetNetworkStats          GetNetworkStatsCall
+	LastValidateContainer        ValidateContainerCall
+	LastOpenContainerFile        OpenContainerFileCall
+	LastWriteContainerFile       WriteContainerFileCall
+	WaitContainerWg              sync.WaitGroup
+	// ListContainersCalled records whether ListContainers has been called,
+	// since it takes no arguments.
+	ListContainersCalled bool
+	// GetGuestInfoCalled records whether GetGuestInfo has been called,
+	// since it takes no arguments.
+	GetGuestInfoCalled bool
+	// GetGCSResourceUsageCalled records whether GetGCSResourceUsage has been
+	// called, since it takes no arguments.
+	GetGCSResourceUsageCalled bool
 }
 
 // behaviorResulout produces the correct result given the MockCore's Behavior.
@@ -116,12 +273,30 @@ func (c *MockCore) behaviorResult() error {
 	}
 }
 
+// contextBehaviorResult is behaviorResult for methods taking a context.
+func (c *MockCore) contextBehaviorResult(ctx context.Context) error {
+	if c.Behavior == Hang {
+		<-ctx.Done()
+		return errors.Wrap(ctx.Err(), "mockcore hang")
+	}
+	return c.behaviorResult()
+}
+
 // CreateContainer captures its arguments.
-func (c *MockCore) CreateContainer(id string, settings prot.VMHostedContainerSettings) error {
+func (c *MockCore) CreateContainer(ctx context.Context, id string, settings prot.VMHostedContainerSettings) error {
 	c.LastCreateContainer = CreateContainerCall{
 		ID:       id,
 		Settings: settings,
 	}
+	return c.contextBehaviorResult(ctx)
+}
+
+// ValidateContainer captures its arguments.
+func (c *MockCore) ValidateContainer(id string, settings prot.VMHostedContainerSettings) error {
+	c.LastValidateContainer = ValidateContainerCall{
+		ID:       id,
+		Settings: settings,
+	}
 	return c.behaviorResult()
 }
 
@@ -141,6 +316,22 @@ func (c *MockCore) SignalContainer(id string, signal oslayer.Signal) error {
 	return c.behaviorResult()
 }
 
+// SignalContainerProcesses captures its arguments.
+func (c *MockCore) SignalContainerProcesses(id string, signal oslayer.Signal) error {
+	c.LastSignalContainerProcesses = SignalContainerCall{ID: id, Signal: signal}
+	return c.behaviorResult()
+}
+
+// ShutdownContainer captures its arguments.
+func (c *MockCore) ShutdownContainer(id string, signal oslayer.Signal, gracePeriod time.Duration) error {
+	c.LastShutdownContainer = ShutdownContainerCall{
+		ID:          id,
+		Signal:      signal,
+		GracePeriod: gracePeriod,
+	}
+	return c.behaviorResult()
+}
+
 // SignalProcess captures its arguments.
 func (c *MockCore) SignalProcess(pid int, options prot.SignalProcessOptions) error {
 	c.LastSignalProcess = SignalProcessCall{
@@ -151,15 +342,18 @@ func (c *MockCore) SignalProcess(pid int, options prot.SignalProcessOptions) err
 }
 
 // ListProcesses captures its arguments. It then returns a process with pid
-// 101, command "sh -c testexe", CreatedByRuntime true, and IsZombie true.
+// 101, command "sh -c testexe", CreatedByRuntime true, IsZombie true and 3
+// open file descriptors.
 func (c *MockCore) ListProcesses(id string) ([]runtime.ContainerProcessState, error) {
 	c.LastListProcesses = ListProcessesCall{ID: id}
+	fds := 3
 	return []runtime.ContainerProcessState{
 		runtime.ContainerProcessState{
-			Pid:              101,
-			Command:          []string{"sh", "-c", "testexe"},
-			CreatedByRuntime: true,
-			IsZombie:         true,
+			Pid:                 101,
+			Command:             []string{"sh", "-c", "testexe"},
+			CreatedByRuntime:    true,
+			IsZombie:            true,
+			OpenFileDescriptors: &fds,
 		},
 	}, c.behaviorResult()
 }
@@ -174,12 +368,12 @@ func (c *MockCore) RunExternalProcess(params prot.ProcessParameters, stdioSet *s
 }
 
 // ModifySettings captures its arguments.
-func (c *MockCore) ModifySettings(id string, request prot.ResourceModificationRequestResponse) error {
+func (c *MockCore) ModifySettings(ctx context.Context, id string, request prot.ResourceModificationRequestResponse) error {
 	c.LastModifySettings = ModifySettingsCall{
 		ID:      id,
 		Request: request,
 	}
-	return c.behaviorResult()
+	return c.contextBehaviorResult(ctx)
 }
 
 // ResizeConsole captures its arguments and returns a nil error.
@@ -192,13 +386,13 @@ func (c *MockCore) ResizeConsole(pid int, height, width uint16) error {
 	return c.behaviorResult()
 }
 
-// WaitContainer captures its arguments and returns a nil error.
-func (c *MockCore) WaitContainer(id string) (int, error) {
+// WaitContainer captures its arguments and returns exit code -1.
+func (c *MockCore) WaitContainer(id string) (prot.ContainerExitStatus, error) {
 	c.LastWaitContainer = WaitContainerCall{
 		ID: id,
 	}
 	c.WaitContainerWg.Done()
-	return -1, c.behaviorResult()
+	return prot.ContainerExitStatus{ExitCode: -1}, c.behaviorResult()
 }
 
 // WaitProcess captures its arguments and returns a nil error.
@@ -208,3 +402,221 @@ func (c *MockCore) WaitProcess(pid int) (int, error) {
 	}
 	return -1, c.behaviorResult()
 }
+
+// ProcessCreatedTime is the creation time GetProcessCreatedTime reports for
+// every process.
+var ProcessCreatedTime = time.Unix(1500000000, 123456789)
+
+// GetProcessCreatedTime captures its arguments and returns ProcessCreatedTime.
+func (c *MockCore) GetProcessCreatedTime(pid int) (time.Time, error) {
+	c.LastGetProcessCreatedTime = GetProcessCreatedTimeCall{
+		Pid: pid,
+	}
+	return ProcessCreatedTime, c.behaviorResult()
+}
+
+// GetScratchDiskUsage captures its arguments and returns a half full 1MB disk.
+func (c *MockCore) GetScratchDiskUsage(id string) (prot.ScratchDiskUsage, error) {
+	c.LastGetScratchDiskUsage = GetScratchDiskUsageCall{
+		ID: id,
+	}
+	return prot.ScratchDiskUsage{
+		UsedBytes:  512 * 1024,
+		FreeBytes:  512 * 1024,
+		TotalBytes: 1024 * 1024,
+	}, c.behaviorResult()
+}
+
+// SyncContainer captures its arguments and returns a nil error.
+func (c *MockCore) SyncContainer(id string, freeze bool, timeout time.Duration) error {
+	c.LastSyncContainer = SyncContainerCall{
+		ID:      id,
+		Freeze:  freeze,
+		Timeout: timeout,
+	}
+	return c.behaviorResult()
+}
+
+// CheckpointContainer captures its arguments and returns a nil error.
+func (c *MockCore) CheckpointContainer(id string, options prot.CheckpointOptions) error {
+	c.LastCheckpointContainer = CheckpointContainerCall{
+		ID:      id,
+		Options: options,
+	}
+	return c.behaviorResult()
+}
+
+// RestoreContainer captures its arguments and returns a nil error.
+func (c *MockCore) RestoreContainer(id string, config oci.Spec, options prot.CheckpointOptions) error {
+	c.LastRestoreContainer = RestoreContainerCall{
+		ID:      id,
+		Config:  config,
+		Options: options,
+	}
+	return c.behaviorResult()
+}
+
+// GetInitOutput captures its arguments and returns a fixed output.
+func (c *MockCore) GetInitOutput(id string) ([]byte, error) {
+	c.LastGetInitOutput = GetInitOutputCall{
+		ID: id,
+	}
+	return []byte("mockcore init output"), c.behaviorResult()
+}
+
+// GetContainerMetadata captures its arguments and returns fixed metadata.
+func (c *MockCore) GetContainerMetadata(id string) (prot.ContainerMetadata, error) {
+	c.LastGetContainerMetadata = GetContainerMetadataCall{
+		ID: id,
+	}
+	return prot.ContainerMetadata{"mockcore": "metadata"}, c.behaviorResult()
+}
+
+// ListContainers records that it was called and returns a single running
+// container with ID "mockcore" and init pid 101.
+func (c *MockCore) ListContainers() ([]prot.ContainerInfo, error) {
+	c.ListContainersCalled = true
+	return []prot.ContainerInfo{
+		{ID: "mockcore", State: "running", InitPid: 101},
+	}, c.behaviorResult()
+}
+
+// GetContainerState captures its arguments and reports a running container
+// with init pid 101.
+func (c *MockCore) GetContainerState(id string) (prot.ContainerStatus, error) {
+	c.LastGetContainerState = GetContainerStateCall{ID: id}
+	return prot.ContainerStatus{State: prot.CsRunning, InitPid: 101, ExitCode: -1}, c.behaviorResult()
+}
+
+// AttachProcess captures its arguments.
+func (c *MockCore) AttachProcess(id string, pid int, stdioSet *stdio.ConnectionSet) error {
+	c.LastAttachProcess = AttachProcessCall{
+		ID:       id,
+		Pid:      pid,
+		StdioSet: stdioSet,
+	}
+	return c.behaviorResult()
+}
+
+// GetMounts captures its arguments and reports a single ext4 mount of
+// /dev/sda at /mockcore.
+func (c *MockCore) GetMounts(id string) ([]prot.MountInfo, error) {
+	c.LastGetMounts = GetMountsCall{ID: id}
+	return []prot.MountInfo{
+		{Source: "/dev/sda", Target: "/mockcore", FileSystem: "ext4", Options: []string{"rw"}},
+	}, c.behaviorResult()
+}
+
+// GetStartTimings captures its arguments and reports a start which took
+// 100ms, 10ms of which was spent mounting layers.
+func (c *MockCore) GetStartTimings(id string) (prot.ContainerStartTimings, error) {
+	c.LastGetStartTimings = GetStartTimingsCall{ID: id}
+	return prot.ContainerStartTimings{
+		LayerMountMicroseconds: 10000,
+		TotalMicroseconds:      100000,
+	}, c.behaviorResult()
+}
+
+// GetNetworkStats captures its arguments and reports a single adapter which
+// has received and sent one packet.
+func (c *MockCore) GetNetworkStats(id string) (prot.ContainerNetworkStatistics, error) {
+	c.LastGetNetworkStats = GetNetworkStatsCall{ID: id}
+	adapter := prot.NetworkInterfaceStatistics{
+		RxBytes:   100,
+		TxBytes:   200,
+		RxPackets: 1,
+		TxPackets: 1,
+	}
+	return prot.ContainerNetworkStatistics{
+		Total: adapter,
+		Adapters: []prot.AdapterNetworkStatistics{
+			{
+				AdapterInstanceID:          "00000000-0000-0000-0000-000000000000",
+				InterfaceName:              "eth0",
+				NetworkInterfaceStatistics: adapter,
+			},
+		},
+	}, c.behaviorResult()
+}
+
+// GetTimeOffset captures its arguments and reports a monotonic clock offset
+// of one hour.
+func (c *MockCore) GetTimeOffset(id string) (prot.TimeOffset, error) {
+	c.LastGetTimeOffset = GetTimeOffsetCall{ID: id}
+	return prot.TimeOffset{
+		MonotonicNanoseconds: int64(time.Hour),
+	}, c.behaviorResult()
+}
+
+// RestartInit captures its arguments.
+func (c *MockCore) RestartInit(id string) error {
+	c.LastRestartInit = RestartInitCall{ID: id}
+	return c.behaviorResult()
+}
+
+// DeleteContainer captures its arguments.
+func (c *MockCore) DeleteContainer(id string) error {
+	c.LastDeleteContainer = DeleteContainerCall{ID: id}
+	return c.behaviorResult()
+}
+
+// WriteProcessStdin captures its arguments and reports all of data as
+// written.
+func (c *MockCore) WriteProcessStdin(id string, pid int, data []byte) (int, error) {
+	c.LastWriteProcessStdin = WriteProcessStdinCall{
+		ID:   id,
+		Pid:  pid,
+		Data: data,
+	}
+	return len(data), c.behaviorResult()
+}
+
+// MockFileContents is the contents of every file opened by OpenContainerFile.
+const MockFileContents = "mockcore file contents"
+
+// OpenContainerFile captures its arguments and returns a file containing
+// MockFileContents.
+func (c *MockCore) OpenContainerFile(id, path string) (io.ReadCloser, int64, error) {
+	c.LastOpenContainerFile = OpenContainerFileCall{
+		ID:   id,
+		Path: path,
+	}
+	return ioutil.NopCloser(strings.NewReader(MockFileContents)), int64(len(MockFileContents)), c.behaviorResult()
+}
+
+// WriteContainerFile captures its arguments, reading all of r, and reports
+// everything read as written.
+func (c *MockCore) WriteContainerFile(id, path string, mode os.FileMode, r io.Reader) (int64, error) {
+	contents, err := ioutil.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	c.LastWriteContainerFile = WriteContainerFileCall{
+		ID:       id,
+		Path:     path,
+		Mode:     mode,
+		Contents: contents,
+	}
+	return int64(len(contents)), c.behaviorResult()
+}
+
+// GetGuestInfo records that it was called and reports a mock kernel and GCS
+// supporting seccomp.
+func (c *MockCore) GetGuestInfo() (prot.GuestInfo, error) {
+	c.GetGuestInfoCalled = true
+	return prot.GuestInfo{
+		KernelVersion: "4.14.0-mockcore",
+		GCSVersion:    "mockcore",
+		Features:      []string{prot.GuestFeatureSeccomp},
+	}, c.behaviorResult()
+}
+
+// GetGCSResourceUsage records that it was called and reports fixed usage.
+func (c *MockCore) GetGCSResourceUsage() (prot.GCSResourceUsage, error) {
+	c.GetGCSResourceUsageCalled = true
+	return prot.GCSResourceUsage{
+		ResidentSetBytes:    16 << 20,
+		Goroutines:          10,
+		OpenFileDescriptors: 7,
+	}, c.behaviorResult()
+}
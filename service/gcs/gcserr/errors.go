@@ -23,6 +23,12 @@ const (
 	HrFail = Hresult(-2147467259) // 0x80004005
 	// HrAccessDenied is the HRESULT for access denied to a resource.
 	HrAccessDenied = Hresult(-2147024891) // 0x80070005
+	// HrTimeout is the HRESULT for an operation which did not complete in
+	// the time allowed.
+	HrTimeout = Hresult(-2147023436) // 0x800705B4
+	// HrBusy is the HRESULT for a resource which cannot be released because
+	// it is in use.
+	HrBusy = Hresult(-2147024726) // 0x800700AA
 	// HrVmcomputeInvalidJSON is the HRESULT for failing to unmarshal a json
 	// string.
 	HrVmcomputeInvalidJSON = Hresult(-1070137075) // 0xC037010D
@@ -3,20 +3,42 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"strings"
 
 	"github.com/Microsoft/opengcs/service/gcs/bridge"
 	"github.com/Microsoft/opengcs/service/gcs/core/gcs"
 	"github.com/Microsoft/opengcs/service/gcs/oslayer/realos"
 	"github.com/Microsoft/opengcs/service/gcs/runtime/runc"
+	"github.com/Microsoft/opengcs/service/gcs/stdio"
 	"github.com/Microsoft/opengcs/service/gcs/transport"
-	"github.com/Microsoft/opengcs/service/libs/commonutils"
 	"github.com/sirupsen/logrus"
 )
 
+// version is the GCS build version reported to the host. It is set at build
+// time with -ldflags "-X main.version=...".
+var version = "unknown"
+
 func main() {
 	logLevel := flag.String("loglevel", "debug", "Logging Level: debug, info, warning, error, fatal, panic.")
 	logFile := flag.String("logfile", "", "Logging Target: An optional file name/path. Omit for console output.")
+	logFormat := flag.String("logformat", "text", "Logging Format: text or json.")
+	deviceRescanAttempts := flag.Int("devicerescanattempts", gcs.DeviceRescanAttempts, "Number of times to scan for a mapped virtual disk before giving up.")
+	deviceRescanInterval := flag.Duration("devicerescaninterval", gcs.DeviceRescanInterval, "Time to wait for a mapped virtual disk to appear after each scan.")
+	notificationBufferSize := flag.Int("notificationbuffersize", 0, "Number of notifications queued for sending to the host before the drop policy applies.")
+	dropOldestNotifications := flag.Bool("dropoldestnotifications", false, "Drop the oldest queued notification when the queue is full, rather than waiting for room.")
+	notificationRetryInterval := flag.Duration("notificationretryinterval", 0, "Time to wait before resending a notification which failed to send, doubling after each failure. Zero stops the GCS when a notification fails to send.")
+	idleTimeout := flag.Duration("idletimeout", 0, "Time the utility VM may have no containers before the host is notified. Zero disables the notification.")
+	mountIOAttempts := flag.Int("mountioattempts", gcs.MountIOAttempts, "Number of times to attempt a disk mount which fails with an I/O error before giving up.")
+	generateActivityIDs := flag.Bool("generateactivityids", false, "Give requests from the host which lack an activity ID a random one, rather than the empty GUID.")
+	initShimPath := flag.String("initshimpath", gcs.InitShimPath, "Path of the init shim run as the init process of containers created with InitShim.")
+	orphanReapInterval := flag.Duration("orphanreapinterval", 0, "Time between reaping orphaned zombie processes in containers. Zero disables reaping.")
+	authTokenFile := flag.String("authtokenfile", "", "File containing a shared secret which every request from the host must carry. If unset, requests are not authenticated.")
+	relayDrainTimeout := flag.Duration("relaydraintimeout", stdio.RelayDrainTimeout, "Time to keep relaying a process's output after it exits, for output still buffered or written by its descendants.")
+	maxCapturedOutputBytes := flag.Int("maxcapturedoutputbytes", stdio.MaxCapturedOutputBytes, "Maximum bytes of process output kept in memory for any single capture.")
+	vsockReceiveBufferSize := flag.Int("vsockreceivebuffersize", 0, "Size in bytes of the receive buffer (SO_RCVBUF) of each vsock connection. Zero uses the kernel default.")
+	vsockSendBufferSize := flag.Int("vsocksendbuffersize", 0, "Size in bytes of the send buffer (SO_SNDBUF) of each vsock connection. Zero uses the kernel default.")
 
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "\nUsage of %s:\n", os.Args[0])
@@ -29,29 +51,36 @@ func main() {
 	flag.Parse()
 
 	// Use a file instead of stdout
+	var logRotator func() error
 	if *logFile != "" {
-		logFileHandle, err := os.OpenFile(*logFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+		logFileHandle, err := bridge.OpenLogFile(*logFile)
 		if err != nil {
-			logrus.Fatalf("failed to create log file %s", *logFile)
+			logrus.Fatal(err)
 		}
 		logrus.SetOutput(logFileHandle)
+		logRotator = logFileHandle.Rotate
 	}
 
-	level, err := logrus.ParseLevel(*logLevel)
-	if err != nil {
+	if err := bridge.ConfigureLogging(*logLevel, *logFormat); err != nil {
 		logrus.Fatal(err)
 	}
 
-	if level == logrus.DebugLevel {
-		logrus.AddHook(commonutils.NewStackHook(logrus.AllLevels))
-	}
-
-	logrus.SetLevel(level)
+	gcs.DeviceRescanAttempts = *deviceRescanAttempts
+	gcs.DeviceRescanInterval = *deviceRescanInterval
+	gcs.MountIOAttempts = *mountIOAttempts
+	gcs.OrphanReapInterval = *orphanReapInterval
+	gcs.InitShimPath = *initShimPath
+	gcs.GCSVersion = version
+	stdio.MaxCapturedOutputBytes = *maxCapturedOutputBytes
+	stdio.RelayDrainTimeout = *relayDrainTimeout
 
 	baseLogPath := "/tmp/gcs"
 
 	logrus.Info("GCS started")
-	tport := &transport.VsockTransport{}
+	tport := &transport.VsockTransport{
+		ReceiveBufferSize: *vsockReceiveBufferSize,
+		SendBufferSize:    *vsockSendBufferSize,
+	}
 	rtime, err := runc.NewRuntime(baseLogPath)
 	if err != nil {
 		logrus.Fatalf("%+v", err)
@@ -60,8 +89,28 @@ func main() {
 	coreint := gcs.NewGCSCore(baseLogPath, rtime, os, tport)
 	mux := bridge.NewBridgeMux()
 	b := bridge.Bridge{
-		Transport: tport,
-		Handler:   mux,
+		Transport:                 tport,
+		Handler:                   mux,
+		IdleTimeout:               *idleTimeout,
+		NotificationBufferSize:    *notificationBufferSize,
+		NotificationRetryInterval: *notificationRetryInterval,
+		LogRotator:                logRotator,
+	}
+	if *dropOldestNotifications {
+		b.NotificationDropPolicy = bridge.NotificationDropOldest
+	}
+	if *authTokenFile != "" {
+		token, err := ioutil.ReadFile(*authTokenFile)
+		if err != nil {
+			logrus.Fatalf("failed to read the authentication token: %s", err)
+		}
+		b.AuthToken = strings.TrimSpace(string(token))
+		if b.AuthToken == "" {
+			logrus.Fatalf("the authentication token file %s is empty", *authTokenFile)
+		}
+	}
+	if *generateActivityIDs {
+		b.ActivityIDGenerator = bridge.NewRandomActivityID
 	}
 	b.AssignHandlers(mux, coreint)
 	err = b.ListenAndServe()
@@ -0,0 +1,233 @@
+package oslayer
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// CgroupRoot is the path the cgroup hierarchies are mounted under.
+const CgroupRoot = "/sys/fs/cgroup"
+
+// cgroup2SuperMagic is the filesystem type reported by statfs for a cgroup v2
+// mount.
+const cgroup2SuperMagic = 0x63677270
+
+// CgroupVersion identifies which cgroup hierarchy is mounted at CgroupRoot.
+type CgroupVersion int
+
+const (
+	// CgroupV1 is the legacy hierarchy, with one mount per controller under
+	// CgroupRoot.
+	CgroupV1 = CgroupVersion(1)
+	// CgroupV2 is the unified hierarchy, mounted directly at CgroupRoot.
+	CgroupV2 = CgroupVersion(2)
+)
+
+// DetectCgroupVersion returns the version of the cgroup hierarchy mounted at
+// CgroupRoot.
+func DetectCgroupVersion(osl OS) (CgroupVersion, error) {
+	var stat syscall.Statfs_t
+	if err := osl.Statfs(CgroupRoot, &stat); err != nil {
+		return 0, errors.Wrapf(err, "failed to stat %s", CgroupRoot)
+	}
+	if stat.Type == cgroup2SuperMagic {
+		return CgroupV2, nil
+	}
+	return CgroupV1, nil
+}
+
+// UpdateMemoryLimit sets the memory limit of the cgroup at cgroupPath, relative
+// to the root of the hierarchy, to limit bytes. A limit of zero or less
+// removes the limit.
+func UpdateMemoryLimit(osl OS, cgroupPath string, limit int64) error {
+	version, err := DetectCgroupVersion(osl)
+	if err != nil {
+		return err
+	}
+	if version == CgroupV2 {
+		value := "max"
+		if limit > 0 {
+			value = strconv.FormatInt(limit, 10)
+		}
+		return writeCgroupFile(osl, filepath.Join(CgroupRoot, cgroupPath, "memory.max"), value)
+	}
+	if limit <= 0 {
+		limit = -1
+	}
+	return writeCgroupFile(osl, filepath.Join(CgroupRoot, "memory", cgroupPath, "memory.limit_in_bytes"), strconv.FormatInt(limit, 10))
+}
+
+// ErrCgroupV1Only is returned by operations which only exist on cgroup v1 when
+// cgroup v2 is mounted.
+var ErrCgroupV1Only = errors.New("the operation is only supported on cgroup v1")
+
+// DropCachesPath is the file written to drop the kernel's caches.
+const DropCachesPath = "/proc/sys/vm/drop_caches"
+
+// DropCaches drops the kernel's clean page cache and reclaimable slab objects,
+// such as dentries and inodes. Dirty pages are not dropped.
+func DropCaches(osl OS) error {
+	return writeCgroupFile(osl, DropCachesPath, "3")
+}
+
+// ForceEmptyMemory reclaims as much memory as possible from the cgroup at
+// cgroupPath, relative to the root of the hierarchy. It returns
+// ErrCgroupV1Only on cgroup v2, which has no equivalent.
+func ForceEmptyMemory(osl OS, cgroupPath string) error {
+	version, err := DetectCgroupVersion(osl)
+	if err != nil {
+		return err
+	}
+	if version == CgroupV2 {
+		return errors.WithStack(ErrCgroupV1Only)
+	}
+	return writeCgroupFile(osl, filepath.Join(CgroupRoot, "memory", cgroupPath, "memory.force_empty"), "0")
+}
+
+// UpdateCPULimit sets the CPU bandwidth of the cgroup at cgroupPath, relative
+// to the root of the hierarchy, to quota microseconds of CPU time per period
+// microseconds. A quota of zero or less removes the limit.
+func UpdateCPULimit(osl OS, cgroupPath string, quota int64, period uint64) error {
+	if period == 0 {
+		return errors.New("the CPU period must be greater than zero")
+	}
+	version, err := DetectCgroupVersion(osl)
+	if err != nil {
+		return err
+	}
+	if version == CgroupV2 {
+		value := fmt.Sprintf("max %d", period)
+		if quota > 0 {
+			value = fmt.Sprintf("%d %d", quota, period)
+		}
+		return writeCgroupFile(osl, filepath.Join(CgroupRoot, cgroupPath, "cpu.max"), value)
+	}
+	if quota <= 0 {
+		quota = -1
+	}
+	cpuPath := filepath.Join(CgroupRoot, "cpu", cgroupPath)
+	if err := writeCgroupFile(osl, filepath.Join(cpuPath, "cpu.cfs_period_us"), strconv.FormatUint(period, 10)); err != nil {
+		return err
+	}
+	return writeCgroupFile(osl, filepath.Join(cpuPath, "cpu.cfs_quota_us"), strconv.FormatInt(quota, 10))
+}
+
+// UpdatePidsLimit sets the maximum number of processes in the cgroup at
+// cgroupPath, relative to the root of the hierarchy, to limit. A limit of zero
+// or less removes the limit.
+func UpdatePidsLimit(osl OS, cgroupPath string, limit int64) error {
+	version, err := DetectCgroupVersion(osl)
+	if err != nil {
+		return err
+	}
+	value := "max"
+	if limit > 0 {
+		value = strconv.FormatInt(limit, 10)
+	}
+	if version == CgroupV2 {
+		return writeCgroupFile(osl, filepath.Join(CgroupRoot, cgroupPath, "pids.max"), value)
+	}
+	return writeCgroupFile(osl, filepath.Join(CgroupRoot, "pids", cgroupPath, "pids.max"), value)
+}
+
+// UpdateBlkioWeight sets the block IO weight of the cgroup at cgroupPath,
+// relative to the root of the hierarchy, to weight, which is in the range
+// 10-1000 used by cgroup v1. On cgroup v2 it is scaled to the range 1-10000
+// used by io.weight.
+func UpdateBlkioWeight(osl OS, cgroupPath string, weight uint16) error {
+	version, err := DetectCgroupVersion(osl)
+	if err != nil {
+		return err
+	}
+	if version == CgroupV2 {
+		ioWeight := 1 + (uint64(weight)-10)*9999/990
+		return writeCgroupFile(osl, filepath.Join(CgroupRoot, cgroupPath, "io.weight"), fmt.Sprintf("default %d", ioWeight))
+	}
+	return writeCgroupFile(osl, filepath.Join(CgroupRoot, "blkio", cgroupPath, "blkio.weight"), strconv.FormatUint(uint64(weight), 10))
+}
+
+// UpdateBlkioDeviceLimit limits the rate at which the cgroup at cgroupPath,
+// relative to the root of the hierarchy, may read from and write to the block
+// device major:minor to readBps and writeBps bytes per second. A rate of zero
+// removes that limit.
+func UpdateBlkioDeviceLimit(osl OS, cgroupPath string, major, minor int64, readBps, writeBps uint64) error {
+	version, err := DetectCgroupVersion(osl)
+	if err != nil {
+		return err
+	}
+	device := fmt.Sprintf("%d:%d", major, minor)
+	if version == CgroupV2 {
+		value := fmt.Sprintf("%s rbps=%s wbps=%s", device, ioMaxValue(readBps), ioMaxValue(writeBps))
+		return writeCgroupFile(osl, filepath.Join(CgroupRoot, cgroupPath, "io.max"), value)
+	}
+	blkioPath := filepath.Join(CgroupRoot, "blkio", cgroupPath)
+	if err := writeCgroupFile(osl, filepath.Join(blkioPath, "blkio.throttle.read_bps_device"), fmt.Sprintf("%s %d", device, readBps)); err != nil {
+		return err
+	}
+	return writeCgroupFile(osl, filepath.Join(blkioPath, "blkio.throttle.write_bps_device"), fmt.Sprintf("%s %d", device, writeBps))
+}
+
+// ioMaxValue returns the form of rate in io.max, where zero is no limit.
+func ioMaxValue(rate uint64) string {
+	if rate == 0 {
+		return "max"
+	}
+	return strconv.FormatUint(rate, 10)
+}
+
+// CgroupProcesses returns the pids of the processes in the cgroup at
+// cgroupPath, relative to the root of the hierarchy. On cgroup v1 the freezer
+// hierarchy is used. Processes in descendant cgroups are not included.
+func CgroupProcesses(osl OS, cgroupPath string) ([]int, error) {
+	version, err := DetectCgroupVersion(osl)
+	if err != nil {
+		return nil, err
+	}
+	procsPath := filepath.Join(CgroupRoot, "freezer", cgroupPath, "cgroup.procs")
+	if version == CgroupV2 {
+		procsPath = filepath.Join(CgroupRoot, cgroupPath, "cgroup.procs")
+	}
+	f, err := osl.OpenFile(procsPath, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open cgroup file %s", procsPath)
+	}
+	defer f.Close()
+	var pids []int
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		pid, err := strconv.Atoi(line)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cgroup file %s has an invalid pid \"%s\"", procsPath, line)
+		}
+		pids = append(pids, pid)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to read cgroup file %s", procsPath)
+	}
+	return pids, nil
+}
+
+// writeCgroupFile writes value to the cgroup or other kernel control file at
+// path.
+func writeCgroupFile(osl OS, path, value string) error {
+	f, err := osl.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open cgroup file %s", path)
+	}
+	defer f.Close()
+	if _, err := f.Write([]byte(value)); err != nil {
+		return errors.Wrapf(err, "failed to write \"%s\" to cgroup file %s", value, path)
+	}
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
@@ -46,6 +47,9 @@ func NewProcessExitState(exitCode int) oslayer.ProcessExitState {
 func (s *mockProcessExitState) ExitCode() int {
 	return s.exitCode
 }
+func (s *mockProcessExitState) Signal() int {
+	return 0
+}
 
 type mockFile struct {
 	name string
@@ -85,8 +89,9 @@ type mockCmd struct {
 func newCmd(name string, arg ...string) *mockCmd {
 	return &mockCmd{name: name, arg: arg}
 }
-func (c *mockCmd) SetDir(dir string)   {}
-func (c *mockCmd) SetEnv(env []string) {}
+func (c *mockCmd) SetDir(dir string)             {}
+func (c *mockCmd) SetEnv(env []string)           {}
+func (c *mockCmd) SetUnshareflags(flags uintptr) {}
 func (c *mockCmd) StdinPipe() (io.WriteCloser, error) {
 	return NewMockReadWriteCloser(), nil
 }
@@ -197,8 +202,51 @@ func (o *mockOS) PathIsMounted(name string) (bool, error) {
 func (o *mockOS) Link(oldname, newname string) error {
 	return nil
 }
+func (o *mockOS) Rename(oldpath, newpath string) error {
+	return nil
+}
+func (o *mockOS) Chmod(name string, mode os.FileMode) error {
+	return nil
+}
+func (o *mockOS) Statfs(path string, buf *syscall.Statfs_t) error {
+	buf.Bsize = 4096
+	buf.Blocks = 1000
+	buf.Bfree = 500
+	buf.Bavail = 400
+	return nil
+}
+
+// Stat reports paths which share the same top-level directory as being on the
+// same device, so that "/a/x" and "/a/y" are on one filesystem while "/b/z" is
+// on another. Paths under /dev are reported as block devices.
+func (o *mockOS) Stat(path string, buf *syscall.Stat_t) error {
+	top := strings.SplitN(strings.TrimPrefix(filepath.Clean(path), "/"), "/", 2)[0]
+	var dev uint64
+	for _, c := range top {
+		dev = dev*31 + uint64(c)
+	}
+	buf.Dev = dev
+	if top == "dev" {
+		buf.Mode = syscall.S_IFBLK | 0660
+	}
+	return nil
+}
+func (o *mockOS) Fsync(path string) error {
+	return nil
+}
+func (o *mockOS) Syncfs(path string) error {
+	return nil
+}
+
+// System
+func (o *mockOS) KernelRelease() (string, error) {
+	return "4.14.0-mock", nil
+}
 
 // Processes
 func (o *mockOS) Kill(pid int, sig syscall.Signal) error {
 	return nil
 }
+func (o *mockOS) Wait4(pid int, wstatus *syscall.WaitStatus, options int, rusage *syscall.Rusage) (int, error) {
+	return pid, nil
+}
@@ -5,7 +5,10 @@ package oslayer
 import (
 	"io"
 	"os"
+	"strings"
 	"syscall"
+
+	"github.com/pkg/errors"
 )
 
 // Signal represents signals which may be sent to processes, such as SIGKILL or
@@ -19,12 +22,61 @@ const (
 	SIGTERM = Signal(syscall.SIGTERM)
 )
 
+// signalsByName maps the names of the standard signals, without their "SIG"
+// prefix, to their numbers.
+var signalsByName = map[string]syscall.Signal{
+	"ABRT":   syscall.SIGABRT,
+	"ALRM":   syscall.SIGALRM,
+	"BUS":    syscall.SIGBUS,
+	"CHLD":   syscall.SIGCHLD,
+	"CONT":   syscall.SIGCONT,
+	"FPE":    syscall.SIGFPE,
+	"HUP":    syscall.SIGHUP,
+	"ILL":    syscall.SIGILL,
+	"INT":    syscall.SIGINT,
+	"IO":     syscall.SIGIO,
+	"KILL":   syscall.SIGKILL,
+	"PIPE":   syscall.SIGPIPE,
+	"PROF":   syscall.SIGPROF,
+	"PWR":    syscall.SIGPWR,
+	"QUIT":   syscall.SIGQUIT,
+	"SEGV":   syscall.SIGSEGV,
+	"STKFLT": syscall.SIGSTKFLT,
+	"STOP":   syscall.SIGSTOP,
+	"SYS":    syscall.SIGSYS,
+	"TERM":   syscall.SIGTERM,
+	"TRAP":   syscall.SIGTRAP,
+	"TSTP":   syscall.SIGTSTP,
+	"TTIN":   syscall.SIGTTIN,
+	"TTOU":   syscall.SIGTTOU,
+	"URG":    syscall.SIGURG,
+	"USR1":   syscall.SIGUSR1,
+	"USR2":   syscall.SIGUSR2,
+	"VTALRM": syscall.SIGVTALRM,
+	"WINCH":  syscall.SIGWINCH,
+	"XCPU":   syscall.SIGXCPU,
+	"XFSZ":   syscall.SIGXFSZ,
+}
+
+// ParseSignal returns the Signal with the given name, such as "SIGTERM". The
+// name is case insensitive, and the "SIG" prefix is optional.
+func ParseSignal(name string) (Signal, error) {
+	upper := strings.ToUpper(name)
+	if sig, ok := signalsByName[strings.TrimPrefix(upper, "SIG")]; ok {
+		return Signal(sig), nil
+	}
+	return 0, errors.Errorf("unknown signal name \"%s\"", name)
+}
+
 // ProcessExitState is an interface describing the state of a process after it
 // exits. Since os.ProcessState structs can only be obtained by an actual exited
 // process, this interface can be mocked out for testing purposes to provide
 // fake exit states.
 type ProcessExitState interface {
 	ExitCode() int
+	// Signal returns the signal which terminated the process, or 0 if the
+	// process exited normally.
+	Signal() int
 }
 
 // File is an interface describing the methods exposed by a file on the system.
@@ -42,6 +94,10 @@ type Process interface {
 type Cmd interface {
 	SetDir(dir string)
 	SetEnv(env []string)
+	// SetUnshareflags sets the CLONE_* flags for the namespaces the command
+	// should be moved out of, into new namespaces of its own, before it is
+	// executed.
+	SetUnshareflags(flags uintptr)
 	StdinPipe() (io.WriteCloser, error)
 	StdoutPipe() (io.ReadCloser, error)
 	StderrPipe() (io.ReadCloser, error)
@@ -72,7 +128,17 @@ type OS interface {
 	PathExists(name string) (bool, error)
 	PathIsMounted(name string) (bool, error)
 	Link(oldname, newname string) error
+	Rename(oldpath, newpath string) error
+	Chmod(name string, mode os.FileMode) error
+	Statfs(path string, buf *syscall.Statfs_t) error
+	Stat(path string, buf *syscall.Stat_t) error
+	Fsync(path string) error
+	Syncfs(path string) error
+
+	// System
+	KernelRelease() (string, error)
 
 	// Processes
 	Kill(pid int, sig syscall.Signal) error
+	Wait4(pid int, wstatus *syscall.WaitStatus, options int, rusage *syscall.Rusage) (int, error)
 }
@@ -13,6 +13,7 @@ import (
 
 	"github.com/Microsoft/opengcs/service/gcs/oslayer"
 	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
 )
 
 // realProcessExitState represents an oslayer.ProcessExitState which uses an
@@ -29,6 +30,13 @@ func NewProcessExitState(state *os.ProcessState) oslayer.ProcessExitState {
 func (s *realProcessExitState) ExitCode() int {
 	return s.state.Sys().(syscall.WaitStatus).ExitStatus()
 }
+func (s *realProcessExitState) Signal() int {
+	status := s.state.Sys().(syscall.WaitStatus)
+	if !status.Signaled() {
+		return 0
+	}
+	return int(status.Signal())
+}
 
 type realFile struct {
 	file *os.File
@@ -58,6 +66,15 @@ func (c *realCmd) SetDir(dir string) {
 func (c *realCmd) SetEnv(env []string) {
 	c.cmd.Env = env
 }
+func (c *realCmd) SetUnshareflags(flags uintptr) {
+	if c.cmd.SysProcAttr == nil {
+		c.cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	// When CLONE_NEWNS is given, the Go runtime also makes the new mount
+	// namespace's mounts private, so that they don't propagate back to the
+	// parent namespace.
+	c.cmd.SysProcAttr.Unshareflags = flags
+}
 func (c *realCmd) StdinPipe() (io.WriteCloser, error) {
 	pipe, err := c.cmd.StdinPipe()
 	if err != nil {
@@ -218,6 +235,65 @@ func (o *realOS) Link(oldname, newname string) error {
 	}
 	return nil
 }
+func (o *realOS) Rename(oldpath, newpath string) error {
+	if err := os.Rename(oldpath, newpath); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+func (o *realOS) Chmod(name string, mode os.FileMode) error {
+	if err := os.Chmod(name, mode); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+func (o *realOS) Statfs(path string, buf *syscall.Statfs_t) error {
+	if err := syscall.Statfs(path, buf); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+func (o *realOS) Stat(path string, buf *syscall.Stat_t) error {
+	if err := syscall.Stat(path, buf); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+func (o *realOS) Fsync(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+	if err := f.Sync(); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+func (o *realOS) Syncfs(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+	if _, _, errno := unix.Syscall(unix.SYS_SYNCFS, f.Fd(), 0, 0); errno != 0 {
+		return errors.WithStack(errno)
+	}
+	return nil
+}
+
+// System
+
+// kernelReleasePath is the file giving the release of the running kernel.
+const kernelReleasePath = "/proc/sys/kernel/osrelease"
+
+func (o *realOS) KernelRelease() (string, error) {
+	release, err := ioutil.ReadFile(kernelReleasePath)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return strings.TrimSpace(string(release)), nil
+}
 
 // Processes
 func (o *realOS) Kill(pid int, sig syscall.Signal) error {
@@ -226,3 +302,10 @@ func (o *realOS) Kill(pid int, sig syscall.Signal) error {
 	}
 	return nil
 }
+func (o *realOS) Wait4(pid int, wstatus *syscall.WaitStatus, options int, rusage *syscall.Rusage) (int, error) {
+	wpid, err := syscall.Wait4(pid, wstatus, options, rusage)
+	if err != nil {
+		return wpid, errors.WithStack(err)
+	}
+	return wpid, nil
+}
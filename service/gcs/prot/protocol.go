@@ -96,6 +96,38 @@ const (
 	ComputeSystemGetPropertiesV1 = 0x10100901
 	// ComputeSystemModifySettingsV1 is the modify container request.
 	ComputeSystemModifySettingsV1 = 0x10100a01
+	// ComputeSystemSyncV1 is the flush container filesystem request.
+	ComputeSystemSyncV1 = 0x10100b01
+	// ComputeSystemCheckpointV1 is the checkpoint container request.
+	ComputeSystemCheckpointV1 = 0x10100c01
+	// ComputeSystemRestoreV1 is the restore container request.
+	ComputeSystemRestoreV1 = 0x10100d01
+	// ComputeSystemGetInitOutputV1 is the buffered init process output
+	// request.
+	ComputeSystemGetInitOutputV1 = 0x10100e01
+	// ComputeSystemEnumerateV1 is the list containers request.
+	ComputeSystemEnumerateV1 = 0x10100f01
+	// ComputeSystemGetStateV1 is the container state request.
+	ComputeSystemGetStateV1 = 0x10101001
+	// ComputeSystemAttachV1 is the reattach process stdio request.
+	ComputeSystemAttachV1 = 0x10101101
+	// ComputeSystemDeleteV1 is the delete unstarted container request.
+	ComputeSystemDeleteV1 = 0x10101201
+	// ComputeSystemWriteStdinV1 is the write to process stdin request.
+	ComputeSystemWriteStdinV1 = 0x10101301
+	// ComputeSystemGetGuestInfoV1 is the guest kernel and GCS information
+	// request.
+	ComputeSystemGetGuestInfoV1 = 0x10101401
+	// ComputeSystemReadFileV1 is the read file from container request.
+	ComputeSystemReadFileV1 = 0x10101501
+	// ComputeSystemWriteFileV1 is the write file to container request.
+	ComputeSystemWriteFileV1 = 0x10101601
+	// ComputeSystemGetResourceUsageV1 is the GCS process resource usage
+	// request.
+	ComputeSystemGetResourceUsageV1 = 0x10101701
+	// ComputeSystemRestartInitV1 is the restart container init process
+	// request.
+	ComputeSystemRestartInitV1 = 0x10101801
 
 	// ComputeSystemResponseCreateV1 is the create container response.
 	ComputeSystemResponseCreateV1 = 0x20100101
@@ -121,6 +153,42 @@ const (
 	ComputeSystemResponseGetPropertiesV1 = 0x20100901
 	// ComputeSystemResponseModifySettingsV1 is the modify container response.
 	ComputeSystemResponseModifySettingsV1 = 0x20100a01
+	// ComputeSystemResponseSyncV1 is the flush container filesystem response.
+	ComputeSystemResponseSyncV1 = 0x20100b01
+	// ComputeSystemResponseCheckpointV1 is the checkpoint container response.
+	ComputeSystemResponseCheckpointV1 = 0x20100c01
+	// ComputeSystemResponseRestoreV1 is the restore container response.
+	ComputeSystemResponseRestoreV1 = 0x20100d01
+	// ComputeSystemResponseGetInitOutputV1 is the buffered init process output
+	// response.
+	ComputeSystemResponseGetInitOutputV1 = 0x20100e01
+	// ComputeSystemResponseEnumerateV1 is the list containers response.
+	ComputeSystemResponseEnumerateV1 = 0x20100f01
+	// ComputeSystemResponseGetStateV1 is the container state response.
+	ComputeSystemResponseGetStateV1 = 0x20101001
+	// ComputeSystemResponseAttachV1 is the reattach process stdio response.
+	ComputeSystemResponseAttachV1 = 0x20101101
+	// ComputeSystemResponseDeleteV1 is the delete unstarted container
+	// response.
+	ComputeSystemResponseDeleteV1 = 0x20101201
+	// ComputeSystemResponseWriteStdinV1 is the write to process stdin
+	// response.
+	ComputeSystemResponseWriteStdinV1 = 0x20101301
+	// ComputeSystemResponseGetGuestInfoV1 is the guest kernel and GCS
+	// information response.
+	ComputeSystemResponseGetGuestInfoV1 = 0x20101401
+	// ComputeSystemResponseReadFileV1 is the read file from container
+	// response.
+	ComputeSystemResponseReadFileV1 = 0x20101501
+	// ComputeSystemResponseWriteFileV1 is the write file to container
+	// response.
+	ComputeSystemResponseWriteFileV1 = 0x20101601
+	// ComputeSystemResponseGetResourceUsageV1 is the GCS process resource
+	// usage response.
+	ComputeSystemResponseGetResourceUsageV1 = 0x20101701
+	// ComputeSystemResponseRestartInitV1 is the restart container init
+	// process response.
+	ComputeSystemResponseRestartInitV1 = 0x20101801
 
 	// ComputeSystemNotificationV1 is the notification identifier.
 	ComputeSystemNotificationV1 = 0x30100101
@@ -139,6 +207,17 @@ type MessageHeader struct {
 // MessageHeaderSize is the size in bytes of the MessageHeader struct.
 const MessageHeaderSize = 16
 
+const (
+	// MessageFlagChecksum is set in the Type of a MessageHeader whose message
+	// is followed by a ChecksumSize byte little-endian CRC32 (IEEE) of the
+	// message body. The header's Size includes the checksum. It occupies a
+	// bit of the message type which no MessageType uses. Once a host sends a
+	// message with the flag set, the GCS sets it on every message it sends.
+	MessageFlagChecksum = 0x80000000
+	// ChecksumSize is the size in bytes of a message checksum.
+	ChecksumSize = 4
+)
+
 /////////////////////////////////////////////////////
 
 // Protocol version.
@@ -163,6 +242,13 @@ type ProtocolSupport struct {
 type MessageBase struct {
 	ContainerID string `json:"ContainerId"`
 	ActivityID  string `json:"ActivityId"`
+	// DeadlineMs, if nonzero, is how many milliseconds the GCS may spend
+	// handling the request. Requests which support a deadline fail with
+	// HrTimeout once it has passed.
+	DeadlineMs uint32 `json:",omitempty"`
+	// AuthToken is the shared secret which authenticates the request, if the
+	// GCS is configured to require one.
+	AuthToken string `json:",omitempty"`
 }
 
 // ContainerCreate is the message from the HCS specifying to create a container
@@ -173,6 +259,10 @@ type ContainerCreate struct {
 	*MessageBase
 	ContainerConfig   string
 	SupportedVersions ProtocolSupport `json:",omitempty"`
+	// Validate specifies that ContainerConfig is only checked, and the
+	// response reports whether a create with it would be accepted. Nothing is
+	// created, and no notification is sent for the container.
+	Validate bool `json:",omitempty"`
 }
 
 // NotificationType defines a type of notification to be sent back to the HCS.
@@ -201,6 +291,15 @@ const (
 	NtPaused = NotificationType("Paused")
 	// NtUnknown indicates an unknown notification to be sent back to the HCS
 	NtUnknown = NotificationType("Unknown")
+	// NtDiskPressure indicates that the free space on a container's scratch
+	// disk has dropped below its low watermark
+	NtDiskPressure = NotificationType("DiskPressure")
+	// NtProcessExit indicates that an external process, identified by the
+	// notification's ProcessID, has exited
+	NtProcessExit = NotificationType("ProcessExit")
+	// NtGcsIdle indicates that the utility VM has had no containers for the
+	// GCS's configured idle timeout
+	NtGcsIdle = NotificationType("GcsIdle")
 )
 
 // ActiveOperation defines an operation to be associated with a notification
@@ -225,14 +324,19 @@ const (
 )
 
 // ContainerNotification is a message sent from the GCS to the HCS to indicate
-// some kind of event. At the moment, it is only used for container exit
-// notifications.
+// some kind of event, such as a container or external process exiting.
 type ContainerNotification struct {
 	*MessageBase
 	Type       NotificationType
 	Operation  ActiveOperation
 	Result     int32
 	ResultInfo string `json:",omitempty"`
+	// ProcessID is the pid of the process the notification is about, for
+	// notifications which are not about a container.
+	ProcessID uint32 `json:"ProcessId,omitempty"`
+	// Signal is the signal which terminated the container's init process, for
+	// container exit notifications.
+	Signal int32 `json:",omitempty"`
 }
 
 // ExecuteProcessVsockStdioRelaySettings defines the port numbers for each
@@ -241,6 +345,9 @@ type ExecuteProcessVsockStdioRelaySettings struct {
 	StdIn  uint32 `json:",omitempty"`
 	StdOut uint32 `json:",omitempty"`
 	StdErr uint32 `json:",omitempty"`
+	// StdioMux is the port of the single connection carrying all of the
+	// process's stdio streams when ProcessParameters.MultiplexStdio is set.
+	StdioMux uint32 `json:",omitempty"`
 }
 
 // ExecuteProcessSettings defines the settings for a single process to be
@@ -266,6 +373,82 @@ type ContainerResizeConsole struct {
 	Width     uint16
 }
 
+// ContainerAttachProcess is the message from the HCS requesting that the
+// output of a running process be relayed over new stdio connections, such as
+// after the host has reconnected.
+type ContainerAttachProcess struct {
+	*MessageBase
+	ProcessID uint32 `json:"ProcessId"`
+	// AttachStdOut and AttachStdErr select which of the process's output
+	// streams to reattach. Stdin cannot be reattached.
+	AttachStdOut bool
+	AttachStdErr bool
+	// MultiplexStdio carries the reattached streams over a single connection
+	// to the StdioMux port, as for ProcessParameters.MultiplexStdio.
+	MultiplexStdio          bool `json:",omitempty"`
+	VsockStdioRelaySettings ExecuteProcessVsockStdioRelaySettings
+}
+
+// MaxWriteStdinBytes is the most data a ContainerWriteProcessStdin message may
+// carry.
+const MaxWriteStdinBytes = 64 * 1024
+
+// ContainerWriteProcessStdin is the message from the HCS requesting that data
+// be written to the stdin of a running process, such as the answer to a
+// prompt, without relaying a stdin connection to it.
+type ContainerWriteProcessStdin struct {
+	*MessageBase
+	ProcessID uint32 `json:"ProcessId"`
+	// Data is the bytes to write, base64 encoded in JSON. It may be at most
+	// MaxWriteStdinBytes long.
+	Data []byte
+}
+
+// MaxReadFileInlineBytes is the largest file whose contents may be returned in
+// a ContainerReadFileResponse. Larger files must be streamed over a relay
+// port.
+const MaxReadFileInlineBytes = 1024 * 1024
+
+// ContainerReadFile is the message from the HCS requesting the contents of a
+// regular file in a running container.
+type ContainerReadFile struct {
+	*MessageBase
+	// Path is the absolute path of the file in the container's mount
+	// namespace.
+	Path string
+	// Port, if set, is the vsock port to which the file's contents are
+	// written. Otherwise they are returned in the response, which requires
+	// the file to be at most MaxReadFileInlineBytes long.
+	Port uint32 `json:",omitempty"`
+	// ListenForHost, if set, has the GCS listen on a vsock port it allocates,
+	// given in the response's ListenPort, and write the file's contents to
+	// the first connection the host makes to it. It cannot be combined with
+	// Port.
+	ListenForHost bool `json:",omitempty"`
+}
+
+// MaxWriteFileInlineBytes is the most data a ContainerWriteFile message may
+// carry. Larger files must be streamed over a relay port.
+const MaxWriteFileInlineBytes = 1024 * 1024
+
+// ContainerWriteFile is the message from the HCS requesting that a file in a
+// running container be atomically created or replaced.
+type ContainerWriteFile struct {
+	*MessageBase
+	// Path is the absolute path of the file in the container's mount
+	// namespace. Its parent directory must exist.
+	Path string
+	// Mode is the file's permission bits, including the setuid, setgid and
+	// sticky bits, as in chmod(2).
+	Mode uint32
+	// Contents is the contents of the file, base64 encoded in JSON. It may be
+	// at most MaxWriteFileInlineBytes long, and is ignored if Port is set.
+	Contents []byte `json:",omitempty"`
+	// Port, if set, is the vsock port from which the file's contents are
+	// read until the host closes its end of the connection for writing.
+	Port uint32 `json:",omitempty"`
+}
+
 // ContainerWaitForProcess is the message from the HCS specifying to wait until
 // the given process exits. After receiving this message, the corresponding
 // response should not be sent until the process has exited.
@@ -292,6 +475,234 @@ type ContainerGetProperties struct {
 	Query string
 }
 
+// ContainerPropertiesQuery is the JSON structure of the Query in a
+// ContainerGetProperties message. An empty query requests the process list.
+type ContainerPropertiesQuery struct {
+	PropertyTypes []PropertyType `json:",omitempty"`
+}
+
+// ContainerProperties is the JSON structure of the Properties in the response
+// to a ContainerGetProperties message whose query lists property types. It
+// maps each requested property type the GCS supports to its value. Currently
+// PtProcessList, PtContainerMetadata, PtMounts, PtStartTimings and
+// PtOpenFileDescriptors are supported.
+type ContainerProperties map[PropertyType]interface{}
+
+// ContainerOpenFileDescriptors is the value of the PtOpenFileDescriptors
+// property, totalling the file descriptors open in a container's processes.
+type ContainerOpenFileDescriptors struct {
+	Count int
+	// UncountedProcesses is the number of processes whose file descriptors
+	// could not be counted, such as because they exited while being counted.
+	UncountedProcesses int `json:",omitempty"`
+}
+
+// NetworkInterfaceStatistics is the traffic counts of a network interface,
+// from its statistics in sysfs.
+type NetworkInterfaceStatistics struct {
+	RxBytes   uint64
+	TxBytes   uint64
+	RxPackets uint64
+	TxPackets uint64
+	RxErrors  uint64
+	TxErrors  uint64
+	RxDropped uint64
+	TxDropped uint64
+}
+
+// AdapterNetworkStatistics is the traffic counts of one of a container's
+// network adapters.
+type AdapterNetworkStatistics struct {
+	AdapterInstanceID string `json:"AdapterInstanceId"`
+	// InterfaceName is the name of the adapter's interface in the
+	// container's network namespace.
+	InterfaceName string
+	NetworkInterfaceStatistics
+}
+
+// ContainerNetworkStatistics is the value of the PtNetworkStatistics
+// property. Total is the sum of the counts of each of the container's network
+// adapters, which are listed in Adapters in the order they were given at
+// create.
+type ContainerNetworkStatistics struct {
+	Total    NetworkInterfaceStatistics
+	Adapters []AdapterNetworkStatistics
+}
+
+// ContainerStartTimings is the value of the PtStartTimings property. It gives
+// the time, in microseconds, taken by each phase of creating a container and
+// starting its init process. A phase which has not happened yet, or did not
+// apply to the container, is zero. TotalMicroseconds is the time from the
+// start of creation until the init process was started, including any time
+// spent outside the listed phases, and is zero until then.
+type ContainerStartTimings struct {
+	// LayerMountMicroseconds covers finding and mounting the layer devices.
+	LayerMountMicroseconds uint64
+	// SandboxMountMicroseconds covers formatting and mounting the scratch
+	// device.
+	SandboxMountMicroseconds uint64
+	// OverlayMicroseconds covers mounting the container's root filesystem.
+	OverlayMicroseconds uint64
+	// NetworkMicroseconds covers configuring the container's network
+	// adapters.
+	NetworkMicroseconds uint64
+	// InitExecMicroseconds covers creating and starting the init process
+	// with the runtime.
+	InitExecMicroseconds uint64
+	TotalMicroseconds    uint64
+}
+
+// MemoryLimit is the settings of an RtUpdate request for PtMemory, setting the
+// memory limit of a running container or reclaiming memory.
+type MemoryLimit struct {
+	// LimitInBytes is the container's new memory limit. Zero removes the
+	// limit. It is ignored if Reclaim is set.
+	LimitInBytes int64 `json:",omitempty"`
+	// Reclaim specifies that, rather than changing the limit, the utility
+	// VM's page cache and reclaimable slab objects are dropped.
+	Reclaim bool `json:",omitempty"`
+	// ForceEmpty, with Reclaim, also reclaims as much of the container's
+	// memory as possible through its cgroup. It is only supported on cgroup
+	// v1.
+	ForceEmpty bool `json:",omitempty"`
+}
+
+// CPULimit is the settings of an RtUpdate request for PtCPULimit, setting the
+// CPU bandwidth of a running container.
+type CPULimit struct {
+	// Quota is the CPU time, in microseconds, the container may use in each
+	// Period. Zero removes the limit.
+	Quota int64 `json:",omitempty"`
+	// Period is the length of each period in microseconds.
+	Period uint64
+}
+
+// PidsLimit is the settings of an RtUpdate request for PtPids, setting the
+// maximum number of processes in a running container.
+type PidsLimit struct {
+	// Limit is the container's new process limit, which must be positive.
+	Limit int64
+}
+
+// TimeOffset is the offset of a container's clocks from the utility VM's. It
+// is also the settings of an RtUpdate request for PtTimeOffset, which replaces
+// the offset of a container whose init process has not been started, since a
+// time namespace's offsets cannot be changed once a process is in it.
+type TimeOffset struct {
+	// MonotonicNanoseconds is added to CLOCK_MONOTONIC in the container.
+	MonotonicNanoseconds int64 `json:",omitempty"`
+	// BoottimeNanoseconds is added to CLOCK_BOOTTIME in the container.
+	BoottimeNanoseconds int64 `json:",omitempty"`
+}
+
+// DNSSettings is the settings of a request for PtDNS, which changes a running
+// container's /etc/resolv.conf. An RtUpdate request replaces the container's
+// DNS settings with these, an RtAdd request adds any values not already
+// present, and an RtRemove request removes the values given.
+type DNSSettings struct {
+	// Servers are the IP addresses of the name servers, at most
+	// MaxDNSServers of which may be set.
+	Servers []string `json:",omitempty"`
+	// Search are the domains searched when resolving unqualified names.
+	Search []string `json:",omitempty"`
+	// Options are resolver options, such as "ndots:2".
+	Options []string `json:",omitempty"`
+}
+
+// MaxDNSServers is the most name servers the resolver uses.
+const MaxDNSServers = 3
+
+// LogRotate is the settings of an RtUpdate request for PtLogRotate, which
+// rotates the GCS's log file. The request applies to the utility VM rather
+// than to a container, so its container ID is ignored.
+type LogRotate struct {
+	// LogLevel, if set, is the level the GCS logs at after the rotation.
+	LogLevel string `json:",omitempty"`
+}
+
+// MountInfo describes a filesystem mounted in the utility VM, as listed in its
+// mount table.
+type MountInfo struct {
+	Source     string
+	Target     string
+	FileSystem string
+	Options    []string `json:",omitempty"`
+}
+
+// ContainerMetadata is the set of labels and annotations attached to a
+// container by the host. With RtAdd, its entries are merged into the
+// container's metadata. With RtRemove, its keys are removed from the
+// container's metadata and its values are ignored.
+type ContainerMetadata map[string]string
+
+// ContainerShutdown is the message from the HCS requesting that a container be
+// shut down gracefully.
+type ContainerShutdown struct {
+	*MessageBase
+	// GracePeriodMs, if nonzero, is how long to wait after sending Signal to
+	// the container's init process before sending SIGKILL if it has not
+	// exited. If zero, SIGKILL is never sent.
+	GracePeriodMs uint32 `json:",omitempty"`
+	// Signal, if set, is the name of the signal sent to the container's init
+	// process to ask it to exit, such as "SIGINT" or "SIGQUIT". It defaults
+	// to SIGTERM.
+	Signal string `json:",omitempty"`
+}
+
+// ContainerKill is the message from the HCS requesting that a container be
+// shut down forcefully.
+type ContainerKill struct {
+	*MessageBase
+	// KillAll specifies that every process in the container's cgroup is sent
+	// SIGKILL, rather than only its init process. This stops processes which
+	// would otherwise survive because the init process does not pass the
+	// signal on to them.
+	KillAll bool `json:",omitempty"`
+}
+
+// ContainerSync is the message from the HCS requesting that the writes to the
+// container's filesystem be flushed to disk.
+type ContainerSync struct {
+	*MessageBase
+	// Freeze specifies that the container's processes should be frozen while
+	// the sync takes place, so that the flushed filesystem is consistent.
+	Freeze bool `json:",omitempty"`
+	// TimeoutInMs is how long to wait for the sync to complete before failing.
+	// A value of zero waits indefinitely.
+	TimeoutInMs uint32 `json:",omitempty"`
+}
+
+// CheckpointOptions describes how a container's processes are checkpointed to
+// or restored from disk.
+type CheckpointOptions struct {
+	// ImagesPath is the directory the checkpoint images are written to or
+	// read from.
+	ImagesPath string
+	// LeaveRunning specifies that the container's processes should continue
+	// running after they have been checkpointed.
+	LeaveRunning bool `json:",omitempty"`
+	// TCPEstablished specifies that established TCP connections should be
+	// checkpointed and restored.
+	TCPEstablished bool `json:",omitempty"`
+}
+
+// ContainerCheckpoint is the message from the HCS requesting that the
+// container's process tree be checkpointed to disk.
+type ContainerCheckpoint struct {
+	*MessageBase
+	Options CheckpointOptions
+}
+
+// ContainerRestore is the message from the HCS requesting that the container
+// be restored from a checkpoint on disk. OCISpecification is the configuration
+// of the container which was checkpointed, and is used in place of the one
+// normally supplied with the container's init process.
+type ContainerRestore struct {
+	*MessageBase
+	OCISpecification oci.Spec `json:"OciSpecification,omitempty"`
+	Options          CheckpointOptions
+}
+
 // PropertyType is the type of property, such as memory or virtual disk, which
 // is to be modified for the container.
 type PropertyType string
@@ -321,6 +732,32 @@ const (
 	PtMappedPipe = PropertyType("MappedPipe")
 	// PtMappedVirtualDisk is the property type for mapped virtual disks
 	PtMappedVirtualDisk = PropertyType("MappedVirtualDisk")
+	// PtContainerMetadata is the property type for container metadata
+	PtContainerMetadata = PropertyType("ContainerMetadata")
+	// PtCPULimit is the property type for CPU bandwidth limits
+	PtCPULimit = PropertyType("CpuLimit")
+	// PtMounts is the property type for the mounts made for a container
+	PtMounts = PropertyType("Mounts")
+	// PtLogRotate is the property type for rotating the GCS log
+	PtLogRotate = PropertyType("LogRotate")
+	// PtStartTimings is the property type for the time taken by each phase of
+	// creating and starting a container
+	PtStartTimings = PropertyType("StartTimings")
+	// PtPids is the property type for the limit on a container's number of
+	// processes
+	PtPids = PropertyType("Pids")
+	// PtOpenFileDescriptors is the property type for the number of file
+	// descriptors open in a container
+	PtOpenFileDescriptors = PropertyType("OpenFileDescriptors")
+	// PtDNS is the property type for a container's DNS resolver
+	// configuration
+	PtDNS = PropertyType("DNS")
+	// PtTimeOffset is the property type for the offset of a container's
+	// clocks
+	PtTimeOffset = PropertyType("TimeOffset")
+	// PtNetworkStatistics is the property type for the traffic counts of a
+	// container's network adapters
+	PtNetworkStatistics = PropertyType("NetworkStatistics")
 )
 
 // RequestType is the type of operation to perform on a given property type.
@@ -381,6 +818,48 @@ func UnmarshalContainerModifySettings(b []byte) (*ContainerModifySettings, error
 			return nil, errors.Wrap(err, "failed to unmarshal settings as MappedDirectory")
 		}
 		request.Request.Settings = md
+	case PtContainerMetadata:
+		cm := &ContainerMetadata{}
+		if err := commonutils.UnmarshalJSONWithHresult(rawSettings, cm); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal settings as ContainerMetadata")
+		}
+		request.Request.Settings = cm
+	case PtMemory:
+		ml := &MemoryLimit{}
+		if err := commonutils.UnmarshalJSONWithHresult(rawSettings, ml); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal settings as MemoryLimit")
+		}
+		request.Request.Settings = ml
+	case PtCPULimit:
+		cl := &CPULimit{}
+		if err := commonutils.UnmarshalJSONWithHresult(rawSettings, cl); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal settings as CPULimit")
+		}
+		request.Request.Settings = cl
+	case PtPids:
+		pl := &PidsLimit{}
+		if err := commonutils.UnmarshalJSONWithHresult(rawSettings, pl); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal settings as PidsLimit")
+		}
+		request.Request.Settings = pl
+	case PtDNS:
+		dns := &DNSSettings{}
+		if err := commonutils.UnmarshalJSONWithHresult(rawSettings, dns); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal settings as DNSSettings")
+		}
+		request.Request.Settings = dns
+	case PtTimeOffset:
+		to := &TimeOffset{}
+		if err := commonutils.UnmarshalJSONWithHresult(rawSettings, to); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal settings as TimeOffset")
+		}
+		request.Request.Settings = to
+	case PtLogRotate:
+		lr := &LogRotate{}
+		if err := commonutils.UnmarshalJSONWithHresult(rawSettings, lr); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal settings as LogRotate")
+		}
+		request.Request.Settings = lr
 	default:
 		return nil, errors.Errorf("invalid ResourceType '%s'", request.Request.ResourceType)
 	}
@@ -423,6 +902,17 @@ type ContainerCreateResponse struct {
 type ContainerExecuteProcessResponse struct {
 	*MessageResponseBase
 	ProcessID uint32 `json:"ProcessId"`
+	// CreatedTime is when the process was created, in nanoseconds since the
+	// Unix epoch. Together with ProcessID it identifies the process even if
+	// its pid is later reused.
+	CreatedTime int64 `json:",omitempty"`
+}
+
+// ContainerWriteProcessStdinResponse is the response to a
+// ComputeSystemWriteStdinV1 request.
+type ContainerWriteProcessStdinResponse struct {
+	*MessageResponseBase
+	BytesWritten uint32
 }
 
 // ContainerWaitForProcessResponse is the message to the HCS responding to a
@@ -463,12 +953,50 @@ type NetworkAdapter struct {
 	HostDNSSuffix      string `json:"HostDnsSuffix,omitempty"`
 	EnableLowMetric    bool   `json:",omitempty"`
 	EncapOverhead      uint16 `json:",omitempty"`
+	// Name, if set, is the name the adapter's interface is given in the
+	// container's network namespace, such as "eth0". If unset, the interface
+	// keeps its name in the utility VM. Names must be unique within a
+	// container.
+	Name string `json:",omitempty"`
+	// Routes are static routes through the adapter, which are added once its
+	// interface is up.
+	Routes []Route `json:",omitempty"`
+	// RoutingTableID, if nonzero, is the routing table the adapter's gateway
+	// and static routes are added to, instead of the main table. Traffic from
+	// the sources in SourceBasedRules is directed to the table by a policy
+	// rule. If SourceBasedRules is empty, the adapter's AllocatedIPAddress is
+	// used as the only source, so it must be set. Each adapter of a container
+	// must use a different table, which must not be one of the tables
+	// reserved by the kernel.
+	RoutingTableID   uint32   `json:"RoutingTableId,omitempty"`
+	SourceBasedRules []string `json:",omitempty"`
+	// IngressBandwidthBps and EgressBandwidthBps, if nonzero, limit the
+	// traffic received and sent through the adapter to that many bytes per
+	// second. Egress traffic over the limit is queued, and ingress traffic
+	// over the limit is dropped.
+	IngressBandwidthBps int64 `json:",omitempty"`
+	EgressBandwidthBps  int64 `json:",omitempty"`
+}
+
+// Route is a static route through a network adapter.
+type Route struct {
+	// Destination is the destination network in CIDR notation, such as
+	// "10.1.0.0/16".
+	Destination string
+	// Gateway, if set, is the IP address of the next hop. If unset, the
+	// destination is reached directly through the adapter.
+	Gateway string `json:",omitempty"`
+	Metric  int    `json:",omitempty"`
 }
 
 // MappedVirtualDisk represents a disk on the host which is mapped into a
 // directory in the guest.
 type MappedVirtualDisk struct {
-	ContainerPath     string
+	ContainerPath string
+	// Controller is the SCSI controller the disk is attached to. Together with
+	// Lun it identifies the disk when the utility VM has more than one SCSI
+	// controller. It defaults to controller 0.
+	Controller        uint8 `json:",omitempty"`
 	Lun               uint8 `json:",omitempty"`
 	CreateInUtilityVM bool  `json:",omitempty"`
 	ReadOnly          bool  `json:",omitempty"`
@@ -490,10 +1018,390 @@ type VMHostedContainerSettings struct {
 	Layers []Layer
 	// SandboxDataPath is in this case the identifier (such as the SCSI number)
 	// of the sandbox device.
-	SandboxDataPath    string
+	SandboxDataPath string
+	// SandboxFilesystem, if set, is the filesystem the sandbox device is
+	// formatted with when the container is created, and then mounted as. It
+	// is one of "ext4", "xfs" or "btrfs". If it is unset, the sandbox device
+	// must already be formatted as ext4.
+	SandboxFilesystem string `json:",omitempty"`
+	// SandboxDiscard specifies that the sandbox device is mounted with the
+	// discard option, and that its unused blocks are trimmed with fstrim
+	// when the container is deleted, so that the host can reclaim the space
+	// of a thinly provisioned disk.
+	SandboxDiscard     bool `json:",omitempty"`
 	MappedVirtualDisks []MappedVirtualDisk
 	MappedDirectories  []MappedDirectory
 	NetworkAdapters    []NetworkAdapter `json:",omitempty"`
+	// LogLevel and LogFormat, if either is set, reconfigure the GCS's logging
+	// when the container is created. LogLevel is one of the logrus level
+	// names (debug, info, warning, error, fatal, panic) and LogFormat is
+	// either "text" or "json". An unset value defaults to "info" or "text"
+	// respectively.
+	LogLevel  string `json:",omitempty"`
+	LogFormat string `json:",omitempty"`
+	// ScratchLowWatermarkBytes, if nonzero, enables monitoring of the free
+	// space on the container's scratch disk. An NtDiskPressure notification
+	// is sent when the free space drops below this many bytes.
+	ScratchLowWatermarkBytes uint64 `json:",omitempty"`
+	// UpperDirPath and WorkDirPath, if set, are the directories used as the
+	// overlay upperdir and workdir for the container's root filesystem. This
+	// allows them to be placed on a specific disk. They must either both be
+	// set or both be unset, in which case they are derived from the
+	// container's scratch space. overlayfs requires both directories to be on
+	// the same filesystem. They are removed when the container is cleaned up.
+	UpperDirPath string `json:",omitempty"`
+	WorkDirPath  string `json:",omitempty"`
+	// WritableLayerQuotaBytes, if nonzero, caps the space used by the
+	// container's overlay upperdir with a project quota. The upperdir must
+	// be on an ext4 or xfs filesystem mounted with project quotas, which
+	// the container's scratch space is if it is given this setting. A
+	// scratch device formatted as ext4 by the GCS is given the features
+	// project quotas need; one formatted beforehand must already have them.
+	WritableLayerQuotaBytes uint64 `json:",omitempty"`
+	// BufferInitOutput specifies that if the container's init process is
+	// started without a stdout or stderr pipe, its output should instead be
+	// kept in a buffer in the GCS, which can be retrieved with a
+	// ComputeSystemGetInitOutputV1 request. The buffer retains the last
+	// InitOutputBufferBytes bytes of output, or 64KiB if that is zero.
+	// Values larger than MaxInitOutputBufferBytes are rejected.
+	BufferInitOutput      bool   `json:",omitempty"`
+	InitOutputBufferBytes uint32 `json:",omitempty"`
+	// SharedScratch, if set, mounts a writable directory shared with every
+	// other container which references the same SharedScratch ID.
+	SharedScratch *SharedScratch `json:",omitempty"`
+	// ReadinessFile, if set, is a path in the container's root filesystem
+	// which must exist before starting the container's init process is
+	// reported as successful. The GCS waits up to ReadinessTimeoutMs
+	// milliseconds for the file, or 30 seconds if that is zero, and fails the
+	// request if it does not appear.
+	ReadinessFile      string `json:",omitempty"`
+	ReadinessTimeoutMs uint32 `json:",omitempty"`
+	// Mounts are added to the mounts in the container's OCI specification
+	// when its init process is started. A mount replaces any mount in the
+	// specification with the same destination, which allows the standard
+	// pseudo-filesystems such as /dev, /proc and /sys to be customized.
+	Mounts []Mount `json:",omitempty"`
+	// MaskedPaths are paths in the container which are masked by bind
+	// mounting /dev/null over them, and ReadonlyPaths are paths which are
+	// remounted read-only. They are added to the paths in the container's
+	// OCI specification. All paths must be absolute.
+	MaskedPaths   []string `json:",omitempty"`
+	ReadonlyPaths []string `json:",omitempty"`
+	// RootReadonly specifies that the container's root filesystem is
+	// remounted read-only by runc once its mounts are set up, so that only
+	// the mounts in the container are writable.
+	RootReadonly bool `json:",omitempty"`
+	// RootfsPropagation, if set, is the mount propagation of the container's
+	// root filesystem. It is one of "shared", "slave", "private", "rshared",
+	// "rslave" or "rprivate".
+	RootfsPropagation string `json:",omitempty"`
+	// OCISpecJSON, if set, is a complete OCI runtime specification in JSON.
+	// It is passed to runc as the container's configuration when its init
+	// process is started, in place of the OCISpecification in the init
+	// process's parameters. Mounts, MaskedPaths and ReadonlyPaths are ignored
+	// when it is set.
+	OCISpecJSON string `json:",omitempty"`
+	// Hostname, if set, is the hostname of the container. A private UTS
+	// namespace is added to the container's OCI specification if it doesn't
+	// have one.
+	Hostname string `json:",omitempty"`
+	// User, if set, is the user the container's init process runs as, in the
+	// form user or user:group, where each is a name or a numeric ID. Names
+	// are resolved against /etc/passwd and /etc/group in the container's
+	// root filesystem when the init process is started. It replaces the user
+	// in the container's OCI specification.
+	User string `json:",omitempty"`
+	// TimeOffset, if set, offsets the container's CLOCK_MONOTONIC and
+	// CLOCK_BOOTTIME from the utility VM's by giving it a private time
+	// namespace. It requires kernel support for time namespaces, which is
+	// reported by GuestFeatureTimeNamespaces.
+	TimeOffset *TimeOffset `json:",omitempty"`
+	// HostsEntries, if set, are written to /etc/hosts in the container's root
+	// filesystem when it is created, replacing the file from its image.
+	HostsEntries []HostsEntry `json:",omitempty"`
+	// ForwardSyslog specifies that a syslog socket is bind mounted at
+	// /dev/log in the container. Each message written to it is appended, as
+	// a line, to the container's init process output buffer, which is
+	// created as for BufferInitOutput if that is not set.
+	ForwardSyslog bool `json:",omitempty"`
+	// InitShim specifies that the container's command is run under a minimal
+	// init process supplied by the GCS, which forwards signals to the command
+	// and reaps orphaned processes. This is for containers whose command does
+	// not reap its orphaned children itself.
+	InitShim bool `json:",omitempty"`
+	// Devices are rules, applied in order, allowing or denying the
+	// container access to device nodes through the device cgroup.
+	Devices []DeviceCgroupRule `json:",omitempty"`
+	// PidsLimit, if positive, is the maximum number of processes in the
+	// container, enforced by the pids cgroup controller.
+	PidsLimit int64 `json:",omitempty"`
+	// BlkioWeight, if set, is the container's relative weight for block IO,
+	// between MinBlkioWeight and MaxBlkioWeight.
+	BlkioWeight uint16 `json:",omitempty"`
+	// BlkioDeviceLimits throttle the container's block IO to individual
+	// devices.
+	BlkioDeviceLimits []BlkioDeviceLimit `json:",omitempty"`
+	// Secrets are files written to a tmpfs in the utility VM and bind
+	// mounted read-only into the container, so that their contents are
+	// never written to a disk.
+	Secrets []Secret `json:",omitempty"`
+	// MaxConcurrentExec, if positive, is the maximum number of processes
+	// other than the init process which may be running in the container at
+	// once. Requests to execute further processes fail with HrBusy.
+	MaxConcurrentExec uint32 `json:",omitempty"`
+	// PostCreateHook, if set, is a command run in the container's namespaces
+	// once its filesystem and network are set up, before its init process
+	// starts. Starting the init process fails if the hook fails.
+	PostCreateHook *ContainerHook `json:",omitempty"`
+	// PreDeleteHook, if set, is a command run in the container's root
+	// filesystem when the container is deleted, before its storage is
+	// unmounted. A failure of the hook is logged and does not prevent the
+	// container from being deleted.
+	PreDeleteHook *ContainerHook `json:",omitempty"`
+}
+
+// ContainerHook is a command run at a point in a container's lifecycle.
+type ContainerHook struct {
+	// Args is the hook's argument vector. Args[0] is looked up in the
+	// container's root filesystem.
+	Args []string
+	// TimeoutMs is how long the hook may run before it is killed and treated
+	// as failed, or 60 seconds if it is zero.
+	TimeoutMs uint32 `json:",omitempty"`
+}
+
+// Secret is a file whose contents are provided by the host at create and kept
+// only in memory.
+type Secret struct {
+	// ContainerPath is the absolute path in the container at which the
+	// secret appears.
+	ContainerPath string
+	// Mode is the file's permission bits.
+	Mode uint32
+	// Content is the contents of the file, base64 encoded in JSON.
+	Content []byte `json:"ContentBase64"`
+}
+
+const (
+	// MinBlkioWeight is the smallest BlkioWeight a container may be given.
+	MinBlkioWeight = 10
+	// MaxBlkioWeight is the largest BlkioWeight a container may be given.
+	MaxBlkioWeight = 1000
+)
+
+// BlkioDeviceLimit limits the rate at which a container may read from and
+// write to a block device.
+type BlkioDeviceLimit struct {
+	// Major and Minor are the device numbers of the block device.
+	Major int64
+	Minor int64
+	// ReadBps and WriteBps are the maximum bytes per second the container
+	// may read and write. Zero means no limit.
+	ReadBps  uint64 `json:",omitempty"`
+	WriteBps uint64 `json:",omitempty"`
+}
+
+// DeviceCgroupWildcard, given as a DeviceCgroupRule's Major or Minor, matches
+// any device number.
+const DeviceCgroupWildcard = -1
+
+// DeviceCgroupRule allows or denies access to a set of device nodes through a
+// container's device cgroup.
+type DeviceCgroupRule struct {
+	// Type is "c" for character devices, "b" for block devices or "a" for
+	// all devices.
+	Type string
+	// Major and Minor are the device numbers the rule applies to, or
+	// DeviceCgroupWildcard to match any.
+	Major int64
+	Minor int64
+	// Access is a combination of "r" (read), "w" (write) and "m" (mknod).
+	Access string
+	// Allow is true if the rule allows access, and false if it denies it.
+	Allow bool
+}
+
+// HostsEntry is a line of a container's /etc/hosts file, mapping an IP
+// address to one or more hostnames.
+type HostsEntry struct {
+	IP        string
+	Hostnames []string
+}
+
+// Mount describes a filesystem mount in a container, in the same form as a
+// mount in an OCI specification.
+type Mount struct {
+	// Destination is the absolute path in the container to mount at.
+	Destination string
+	Type        string   `json:",omitempty"`
+	Source      string   `json:",omitempty"`
+	Options     []string `json:",omitempty"`
+}
+
+// SharedScratch describes a writable directory in the utility VM which is
+// shared between containers, such as those in the same pod. The directory is
+// created when the first container referencing its ID is created, and removed
+// when the last such container is cleaned up.
+type SharedScratch struct {
+	ID string
+	// ContainerPath is the path inside the container the directory is
+	// mounted at.
+	ContainerPath string
+}
+
+// MaxInitOutputBufferBytes is the largest InitOutputBufferBytes which may be
+// requested for a container.
+const MaxInitOutputBufferBytes = 4 * 1024 * 1024
+
+// ContainerGetInitOutputResponse is the response to a
+// ComputeSystemGetInitOutputV1 request, containing the buffered output of the
+// container's init process.
+type ContainerGetInitOutputResponse struct {
+	*MessageResponseBase
+	Output []byte `json:",omitempty"`
+}
+
+// ContainerInfo describes a container known to the GCS.
+type ContainerInfo struct {
+	ID string `json:"Id"`
+	// State is "created" if the container's init process has not been
+	// started, and otherwise the container's state as reported by runc, such
+	// as "running" or "stopped".
+	State string
+	// InitPid is the pid of the container's init process, or zero if it has
+	// not been started.
+	InitPid uint32 `json:",omitempty"`
+}
+
+// ContainerState is the lifecycle state of a container.
+type ContainerState string
+
+const (
+	// CsCreated means the container's init process has not been started.
+	CsCreated = ContainerState("Created")
+	// CsRunning means the container's init process is running.
+	CsRunning = ContainerState("Running")
+	// CsStopped means the container's init process has exited.
+	CsStopped = ContainerState("Stopped")
+	// CsPaused means the container's processes are frozen.
+	CsPaused = ContainerState("Paused")
+)
+
+// ContainerStatus describes the state of a single container.
+type ContainerStatus struct {
+	State ContainerState
+	// InitPid is the pid of the container's init process, or zero if it has
+	// not been started.
+	InitPid uint32 `json:",omitempty"`
+	// ExitCode is the exit code of the container's init process if State is
+	// CsStopped, and otherwise -1.
+	ExitCode int
+}
+
+// ContainerExitStatus describes how a container's init process exited.
+type ContainerExitStatus struct {
+	ExitCode int
+	// Signal is the signal which terminated the init process, or zero if it
+	// exited normally.
+	Signal int
+}
+
+// ContainerGetStateResponse is the response to a ComputeSystemGetStateV1
+// request.
+type ContainerGetStateResponse struct {
+	*MessageResponseBase
+	ContainerStatus
+}
+
+// Features of the utility VM which may be listed in GuestInfo.Features.
+const (
+	// GuestFeatureSeccomp is listed if the kernel supports seccomp filters.
+	GuestFeatureSeccomp = "Seccomp"
+	// GuestFeatureVerity is listed if the kernel supports dm-verity.
+	GuestFeatureVerity = "Verity"
+	// GuestFeatureCgroupV2 is listed if the unified cgroup v2 hierarchy is
+	// mounted, rather than the v1 hierarchies.
+	GuestFeatureCgroupV2 = "CgroupV2"
+	// GuestFeatureMountNamespaces is listed if the kernel supports mount
+	// namespaces, as needed by ProcessParameters.PrivateMountNamespace.
+	GuestFeatureMountNamespaces = "MountNamespaces"
+	// GuestFeatureTimeNamespaces is listed if the kernel supports time
+	// namespaces, as needed by VMHostedContainerSettings.TimeOffset.
+	GuestFeatureTimeNamespaces = "TimeNamespaces"
+)
+
+// GuestInfo describes the utility VM's kernel and GCS, so that the host can
+// decide which features to request.
+type GuestInfo struct {
+	KernelVersion string
+	GCSVersion    string `json:"GcsVersion"`
+	// Features lists, in sorted order, the GuestFeature values the utility
+	// VM supports.
+	Features []string `json:",omitempty"`
+}
+
+// ContainerGetGuestInfoResponse is the response to a
+// ComputeSystemGetGuestInfoV1 request. The request applies to the utility VM
+// rather than to a container, so its container ID is ignored.
+type ContainerGetGuestInfoResponse struct {
+	*MessageResponseBase
+	GuestInfo
+}
+
+// GCSResourceUsage describes the resources used by the GCS process itself, as
+// opposed to its containers.
+type GCSResourceUsage struct {
+	// ResidentSetBytes is the GCS's resident set size.
+	ResidentSetBytes uint64
+	// Goroutines is the number of goroutines in the GCS.
+	Goroutines int
+	// OpenFileDescriptors is the number of file descriptors the GCS has open.
+	OpenFileDescriptors int
+}
+
+// ContainerGetResourceUsageResponse is the response to a
+// ComputeSystemGetResourceUsageV1 request. The request applies to the GCS
+// rather than to a container, so its container ID is ignored.
+type ContainerGetResourceUsageResponse struct {
+	*MessageResponseBase
+	GCSResourceUsage
+}
+
+// ContainerReadFileResponse is the response to a ComputeSystemReadFileV1
+// request.
+type ContainerReadFileResponse struct {
+	*MessageResponseBase
+	// Size is the number of bytes read from the file.
+	Size int64
+	// Contents is the contents of the file, base64 encoded in JSON, if it was
+	// not written to a relay port.
+	Contents []byte `json:",omitempty"`
+	// GuestListenPort is set if the request had ListenForHost set. Size is
+	// then the size of the file when it was opened.
+	GuestListenPort
+}
+
+// ContainerWriteFileResponse is the response to a ComputeSystemWriteFileV1
+// request.
+type ContainerWriteFileResponse struct {
+	*MessageResponseBase
+	// Size is the number of bytes written to the file.
+	Size int64
+}
+
+// ContainerEnumerateResponse is the response to a ComputeSystemEnumerateV1
+// request, listing every container known to the GCS.
+type ContainerEnumerateResponse struct {
+	*MessageResponseBase
+	Containers []ContainerInfo
+}
+
+// ScratchDiskUsage describes the space used on a container's scratch disk. It
+// is sent as the ResultInfo of an NtDiskPressure notification.
+type ScratchDiskUsage struct {
+	UsedBytes  uint64
+	FreeBytes  uint64
+	TotalBytes uint64
 }
 
 // ProcessParameters represents any process which may be started in the utility
@@ -511,21 +1419,59 @@ type ProcessParameters struct {
 	// example, the command which sleeps for 100 seconds would be represented by
 	// the CommandLine string "sleep 100".
 	CommandLine string `json:",omitempty"`
-	// CommandArgs is a list of strings representing the command to execute. If
-	// it is not empty, it will be used by the GCS. If it is empty, CommandLine
-	// will be used instead.
-	CommandArgs      []string          `json:",omitempty"`
+	// CommandArgs is a list of strings representing the command to execute,
+	// the first of which is the program to run. It is an alternative to
+	// CommandLine, and the two may not both be given.
+	CommandArgs []string `json:",omitempty"`
+	// ExpandEnv specifies that references to environment variables in
+	// CommandLine, of the form $VAR or ${VAR}, are replaced with their values
+	// in Environment. Variables which are not set are replaced with the empty
+	// string. When it is not set, CommandLine is used literally.
+	ExpandEnv        bool              `json:",omitempty"`
 	WorkingDirectory string            `json:",omitempty"`
 	Environment      map[string]string `json:",omitempty"`
-	EmulateConsole   bool              `json:",omitempty"`
-	CreateStdInPipe  bool              `json:",omitempty"`
-	CreateStdOutPipe bool              `json:",omitempty"`
-	CreateStdErrPipe bool              `json:",omitempty"`
+	// EmulateConsole specifies that a pty should be allocated for the process,
+	// with its master relayed over the stdio connections. ConsoleWidth and
+	// ConsoleHeight, if both nonzero, give the initial size of the pty. It
+	// can later be changed with a ComputeSystemResizeConsoleV1 request.
+	EmulateConsole   bool   `json:",omitempty"`
+	ConsoleWidth     uint16 `json:",omitempty"`
+	ConsoleHeight    uint16 `json:",omitempty"`
+	CreateStdInPipe  bool   `json:",omitempty"`
+	CreateStdOutPipe bool   `json:",omitempty"`
+	CreateStdErrPipe bool   `json:",omitempty"`
+	// MultiplexStdio specifies that the requested stdio pipes should all be
+	// carried over a single connection on the StdioMux port, with each write
+	// framed with the stream it belongs to. Hosts which do not support this
+	// leave it unset, and a separate connection is used for each pipe.
+	MultiplexStdio bool `json:",omitempty"`
+	// StdioControl, with MultiplexStdio, specifies that the host may send
+	// control frames on the multiplexed connection's control stream, such as
+	// console resizes as an alternative to ResizeConsole messages.
+	StdioControl bool `json:",omitempty"`
+	// RelayFailurePolicy determines what happens to the process if a
+	// connection relaying its stdio fails while it is running. It is one of
+	// "Ignore", the default, which discards the process's output until it is
+	// reattached; "Detach", which buffers the output until it is reattached;
+	// or "Kill", which kills the process.
+	RelayFailurePolicy string `json:",omitempty"`
 	// If IsExternal is false, the process will be created inside a container.
 	// If true, it will be created external to any container. The latter is
 	// useful if, for example, you want to start up a shell in the utility VM
 	// for debugging/diagnostic purposes.
 	IsExternal bool `json:"CreateInUtilityVM,omitempty"`
+	// PrivateMountNamespace specifies that the process should be run in a
+	// mount namespace of its own, so that mounts it makes are not seen by
+	// other processes. It is not supported for a container's init process.
+	// Other processes in a container are run under unshare, which the
+	// container's root filesystem must provide.
+	PrivateMountNamespace bool `json:",omitempty"`
+	// JoinContainerID, if set, is the ID of a running container whose
+	// namespaces the process should join. A container's init process joins
+	// its network and PID namespaces rather than creating its own. Any other
+	// process in the container also joins its mount namespace, and runs in
+	// its root filesystem.
+	JoinContainerID string `json:",omitempty"`
 	// If this is the first process created for this container, this field must
 	// be specified. Otherwise, it must be left blank and the other fields must
 	// be specified.
@@ -535,4 +1481,14 @@ type ProcessParameters struct {
 // SignalProcessOptions represents the options for signaling a process.
 type SignalProcessOptions struct {
 	Signal int32
+	// SignalName is the name of the signal to send, such as "SIGTERM". It is
+	// only used if Signal is zero.
+	SignalName string `json:",omitempty"`
+}
+
+// GuestListenPort advertises a vsock port the GCS is listening on, for the
+// host to connect to, in responses for streams which the guest rather than
+// the host initiates.
+type GuestListenPort struct {
+	ListenPort uint32 `json:",omitempty"`
 }
@@ -34,6 +34,10 @@ func (r *mockRuntime) CreateContainer(id string, bundlePath string, stdioSet *st
 	return &container{id: id, r: r}, nil
 }
 
+func (r *mockRuntime) RestoreContainer(id string, bundlePath string, stdioSet *stdio.ConnectionSet, options runtime.CheckpointOptions) (c runtime.Container, err error) {
+	return &container{id: id, r: r}, nil
+}
+
 func (c *container) Start() error {
 	return nil
 }
@@ -50,6 +54,10 @@ func (c *container) Tty() *stdio.TtyRelay {
 	return nil
 }
 
+func (c *container) PipeRelay() *stdio.PipeRelay {
+	return nil
+}
+
 func (c *container) ExecProcess(process oci.Process, stdioSet *stdio.ConnectionSet) (p runtime.Process, err error) {
 	return c, nil
 }
@@ -73,6 +81,10 @@ func (c *container) Resume() error {
 	return nil
 }
 
+func (c *container) Checkpoint(options runtime.CheckpointOptions) error {
+	return nil
+}
+
 func (c *container) GetState() (*runtime.ContainerState, error) {
 	state := &runtime.ContainerState{
 		OCIVersion: "v1",
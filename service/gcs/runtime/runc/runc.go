@@ -53,6 +53,10 @@ func (c *container) Tty() *stdio.TtyRelay {
 	return c.init.ttyRelay
 }
 
+func (c *container) PipeRelay() *stdio.PipeRelay {
+	return c.init.pipeRelay
+}
+
 type process struct {
 	c         *container
 	pid       int
@@ -68,6 +72,10 @@ func (p *process) Tty() *stdio.TtyRelay {
 	return p.ttyRelay
 }
 
+func (p *process) PipeRelay() *stdio.PipeRelay {
+	return p.pipeRelay
+}
+
 // NewRuntime instantiates a new runcRuntime struct.
 func NewRuntime(logBasePath string) (runtime.Runtime, error) {
 
@@ -108,6 +116,18 @@ func (r *runcRuntime) CreateContainer(id string, bundlePath string, stdioSet *st
 	return c, nil
 }
 
+// RestoreContainer creates and starts a container with the given ID from the
+// checkpoint images described by options. bundlePath should be a path to an OCI
+// bundle containing a config.json file and a rootfs for the container, matching
+// the bundle of the container which was checkpointed.
+func (r *runcRuntime) RestoreContainer(id string, bundlePath string, stdioSet *stdio.ConnectionSet, options runtime.CheckpointOptions) (c runtime.Container, err error) {
+	c, err = r.runRestoreCommand(id, bundlePath, stdioSet, options)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
 // Start unblocks the container's init process created by the call to
 // CreateContainer.
 func (c *container) Start() error {
@@ -188,6 +208,20 @@ func (c *container) Resume() error {
 	return nil
 }
 
+// Checkpoint dumps the state of all processes running in the container to the
+// images path in options.
+func (c *container) Checkpoint(options runtime.CheckpointOptions) error {
+	logPath := c.r.getLogPath(c.id)
+	args := append([]string{"--log", logPath}, checkpointArgs(options)...)
+	args = append(args, c.id)
+	cmd := exec.Command("runc", args...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err, "runc checkpoint failed with: %s", out)
+	}
+	return nil
+}
+
 // GetState returns information about the given container.
 func (c *container) GetState() (*runtime.ContainerState, error) {
 	logPath := c.r.getLogPath(c.id)
@@ -248,8 +282,12 @@ func (c *container) GetRunningProcesses() ([]runtime.ContainerProcessState, erro
 
 	pidMap := map[int]*runtime.ContainerProcessState{}
 	// Initialize all processes with a pid and command, and mark correctly that
-	// none of them are zombies. Default CreatedByRuntime to false.
+	// none of them are zombies. Default CreatedByRuntime to false. runC lists
+	// zombies along with running processes, so they are skipped.
 	for _, pid := range pids {
+		if c.r.processIsZombie(pid) {
+			continue
+		}
 		command, err := c.r.getProcessCommand(pid)
 		if err != nil {
 			return nil, err
@@ -288,13 +326,15 @@ func (c *container) GetAllProcesses() ([]runtime.ContainerProcessState, error) {
 
 	pidMap := map[int]*runtime.ContainerProcessState{}
 	// Initialize all processes with a pid and command, leaving CreatedByRuntime
-	// and IsZombie at the default value of false.
+	// at the default value of false. runC lists zombies along with running
+	// processes, such as orphans which nothing has reaped, so each is checked
+	// for the zombie state.
 	for _, pid := range runningPids {
 		command, err := c.r.getProcessCommand(pid)
 		if err != nil {
 			return nil, err
 		}
-		pidMap[pid] = &runtime.ContainerProcessState{Pid: pid, Command: command, CreatedByRuntime: false, IsZombie: false}
+		pidMap[pid] = &runtime.ContainerProcessState{Pid: pid, Command: command, CreatedByRuntime: false, IsZombie: c.r.processIsZombie(pid)}
 	}
 
 	processDirs, err := ioutil.ReadDir(filepath.Join(containerFilesDir, c.id))
@@ -455,6 +495,62 @@ func (r *runcRuntime) runCreateCommand(id string, bundlePath string, stdioSet *s
 	return c, nil
 }
 
+// runRestoreCommand sets up the arguments for calling runc restore.
+func (r *runcRuntime) runRestoreCommand(id string, bundlePath string, stdioSet *stdio.ConnectionSet, options runtime.CheckpointOptions) (runtime.Container, error) {
+	c := &container{r: r, id: id}
+	if err := r.makeContainerDir(id); err != nil {
+		return nil, err
+	}
+	// Create a temporary random directory to store the process's files.
+	tempProcessDir, err := ioutil.TempDir(containerFilesDir, id)
+	if err != nil {
+		return nil, err
+	}
+
+	hasTerminal, err := r.hasTerminal(bundlePath)
+	if err != nil {
+		return nil, err
+	}
+	p, err := c.startProcess(tempProcessDir, hasTerminal, stdioSet, restoreArgs(bundlePath, options)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Write pid to initpid file for container.
+	containerDir := r.getContainerDir(id)
+	if err := ioutil.WriteFile(filepath.Join(containerDir, initPidFilename), []byte(strconv.Itoa(p.pid)), 0777); err != nil {
+		return nil, err
+	}
+
+	c.init = p
+	return c, nil
+}
+
+// checkpointArgs returns the runc checkpoint arguments, not including the
+// container ID, for the given options.
+func checkpointArgs(options runtime.CheckpointOptions) []string {
+	args := []string{"checkpoint", "--image-path", options.ImagesPath}
+	if options.LeaveRunning {
+		args = append(args, "--leave-running")
+	}
+	if options.TCPEstablished {
+		args = append(args, "--tcp-established")
+	}
+	return args
+}
+
+// restoreArgs returns the runc restore arguments, not including the container
+// ID, to restore a container from bundlePath with the given options. The
+// container is detached from runc once it has been restored, in the same way
+// as a container started by runc create.
+func restoreArgs(bundlePath string, options runtime.CheckpointOptions) []string {
+	args := []string{"restore", "-b", bundlePath, "--no-pivot", "--detach", "--image-path", options.ImagesPath}
+	if options.TCPEstablished {
+		args = append(args, "--tcp-established")
+	}
+	return args
+}
+
 // hasTerminal looks at the config.json in the bundlePath, and determines
 // whether its process's terminal value is true or false.
 func (r *runcRuntime) hasTerminal(bundlePath string) (bool, error) {
@@ -547,7 +643,7 @@ func (c *container) startProcess(tempProcessDir string, hasTerminal bool, stdioS
 	}
 
 	if err := cmd.Run(); err != nil {
-		return nil, errors.Wrapf(err, "failed to run runc create/exec call for container %s", c.id)
+		return nil, errors.Wrapf(err, "failed to run runc create/exec/restore call for container %s", c.id)
 	}
 
 	var ttyRelay *stdio.TtyRelay
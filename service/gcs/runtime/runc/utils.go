@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/pkg/errors"
 )
@@ -88,3 +89,26 @@ func (r *runcRuntime) processExists(pid int) bool {
 	_, err := os.Stat(filepath.Join("/proc", strconv.Itoa(pid)))
 	return !os.IsNotExist(err)
 }
+
+// processIsZombie returns true if the process with the given pid has exited
+// but has not yet been waited on by its parent, according to its state in
+// /proc. A process which cannot be found is not considered a zombie.
+func (r *runcRuntime) processIsZombie(pid int) bool {
+	data, err := ioutil.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return false
+	}
+	return parseProcessState(string(data)) == 'Z'
+}
+
+// parseProcessState returns the state character from the contents of a
+// /proc/<pid>/stat file, or 0 if it is malformed. The command name before the
+// state is in parentheses and may itself contain spaces and parentheses, so
+// the state is found after the last closing parenthesis.
+func parseProcessState(stat string) byte {
+	i := strings.LastIndex(stat, ")")
+	if i < 0 || i+2 >= len(stat) {
+		return 0
+	}
+	return stat[i+2]
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"strconv"
 
+	"github.com/Microsoft/opengcs/service/gcs/runtime"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -26,6 +27,18 @@ var _ = Describe("Utils", func() {
 		Expect(err).NotTo(HaveOccurred())
 	})
 
+	Describe("parsing a process's state", func() {
+		It("should find the state after the command name", func() {
+			Expect(parseProcessState("42 (sh) Z 1 42 42 0 -1")).To(Equal(byte('Z')))
+		})
+		It("should handle command names containing parentheses", func() {
+			Expect(parseProcessState("42 (a) R (b)) S 1 42 42 0 -1")).To(Equal(byte('S')))
+		})
+		It("should return 0 for malformed contents", func() {
+			Expect(parseProcessState("42 (sh")).To(Equal(byte(0)))
+		})
+	})
+
 	Describe("reading a pid file", func() {
 		var (
 			pidFile     string
@@ -159,3 +172,28 @@ var _ = Describe("Utils", func() {
 		})
 	})
 })
+
+var _ = Describe("Checkpoint arguments", func() {
+	var (
+		options runtime.CheckpointOptions
+	)
+	BeforeEach(func() {
+		options = runtime.CheckpointOptions{ImagesPath: "/images"}
+	})
+	Context("no options are set", func() {
+		It("should only specify the images path", func() {
+			Expect(checkpointArgs(options)).To(Equal([]string{"checkpoint", "--image-path", "/images"}))
+			Expect(restoreArgs("/bundle", options)).To(Equal([]string{"restore", "-b", "/bundle", "--no-pivot", "--detach", "--image-path", "/images"}))
+		})
+	})
+	Context("all options are set", func() {
+		BeforeEach(func() {
+			options.LeaveRunning = true
+			options.TCPEstablished = true
+		})
+		It("should include the corresponding flags", func() {
+			Expect(checkpointArgs(options)).To(Equal([]string{"checkpoint", "--image-path", "/images", "--leave-running", "--tcp-established"}))
+			Expect(restoreArgs("/bundle", options)).To(Equal([]string{"restore", "-b", "/bundle", "--no-pivot", "--detach", "--image-path", "/images", "--tcp-established"}))
+		})
+	})
+})
@@ -28,6 +28,13 @@ type ContainerProcessState struct {
 	Command          []string
 	CreatedByRuntime bool
 	IsZombie         bool
+	// StdioBytes, if the process's stdio is relayed by the GCS, is the number
+	// of bytes relayed so far for each of its streams.
+	StdioBytes *stdio.RelayCounts `json:",omitempty"`
+	// OpenFileDescriptors is the number of file descriptors the process has
+	// open, or nil if they could not be counted, such as because the
+	// process exited while the processes were being listed.
+	OpenFileDescriptors *int `json:",omitempty"`
 }
 
 // StdioPipes contain the interfaces for reading from and writing to a
@@ -38,12 +45,29 @@ type StdioPipes struct {
 	Err io.ReadCloser
 }
 
+// CheckpointOptions describes how a container is checkpointed to or restored
+// from disk.
+type CheckpointOptions struct {
+	// ImagesPath is the directory the checkpoint images are written to or
+	// read from.
+	ImagesPath string
+	// LeaveRunning specifies that the container should continue running
+	// after it has been checkpointed.
+	LeaveRunning bool
+	// TCPEstablished specifies that established TCP connections should be
+	// checkpointed and restored.
+	TCPEstablished bool
+}
+
 // Process is an interface to manipulate process state.
 type Process interface {
 	Wait() (oslayer.ProcessExitState, error)
 	Pid() int
 	Delete() error
 	Tty() *stdio.TtyRelay
+	// PipeRelay returns the relay for the process's stdio pipes, or nil if
+	// the process uses a TTY or has no stdio.
+	PipeRelay() *stdio.PipeRelay
 }
 
 // Container is an interface to manipulate container state.
@@ -56,6 +80,7 @@ type Container interface {
 	Kill(signal oslayer.Signal) error
 	Pause() error
 	Resume() error
+	Checkpoint(options CheckpointOptions) error
 	GetState() (*ContainerState, error)
 	GetRunningProcesses() ([]ContainerProcessState, error)
 	GetAllProcesses() ([]ContainerProcessState, error)
@@ -65,5 +90,6 @@ type Container interface {
 // such as runC.
 type Runtime interface {
 	CreateContainer(id string, bundlePath string, stdioSet *stdio.ConnectionSet) (c Container, err error)
+	RestoreContainer(id string, bundlePath string, stdioSet *stdio.ConnectionSet, options CheckpointOptions) (c Container, err error)
 	ListContainerStates() ([]ContainerState, error)
 }
@@ -0,0 +1,132 @@
+package stdio
+
+import (
+	"sync"
+
+	"github.com/Microsoft/opengcs/service/gcs/transport"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// attachableWriter writes to a connection which can be replaced while a relay
+// is copying into it. If writing to the connection fails, for example because
+// the host has disconnected, the connection is dropped and the relay's failure
+// policy is applied. Output is then discarded, or buffered with
+// RelayFailureDetach, until a new connection is attached, so that the process
+// is never blocked on a full pipe.
+type attachableWriter struct {
+	m       sync.Mutex
+	name    string
+	conn    transport.Connection
+	closed  bool
+	handler *relayFailureHandler
+	// buffered holds the output written since the connection failed, if the
+	// policy is RelayFailureDetach.
+	buffered *RingBuffer
+}
+
+func newAttachableWriter(name string, conn transport.Connection, handler *relayFailureHandler) *attachableWriter {
+	return &attachableWriter{name: name, conn: conn, handler: handler}
+}
+
+func (w *attachableWriter) Write(p []byte) (int, error) {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	if w.conn == nil {
+		if w.buffered != nil {
+			return w.buffered.Write(p)
+		}
+		return len(p), nil
+	}
+	if _, err := w.conn.Write(p); err != nil {
+		if err := w.conn.Close(); err != nil {
+			logrus.Errorf("error closing %s socket: %s", w.name, err)
+		}
+		w.conn = nil
+		hostGone := w.handler.hostGone(w.name, err)
+		if w.handler.policy == RelayFailureDetach {
+			if !hostGone {
+				logrus.Warnf("error writing %s, buffering output until it is reattached: %s", w.name, err)
+			}
+			w.buffered = NewRingBuffer(0)
+			w.buffered.Write(p)
+		} else if !hostGone {
+			logrus.Warnf("error writing %s, discarding output until it is reattached: %s", w.name, err)
+		}
+		w.handler.failed(w.name, err)
+	}
+	return len(p), nil
+}
+
+// attach replaces the connection written to with conn, closing the previous
+// connection. Any output buffered since the previous connection failed is
+// written to conn first.
+func (w *attachableWriter) attach(conn transport.Connection) error {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	if w.closed {
+		return errors.Errorf("%s has already been closed", w.name)
+	}
+	if w.conn != nil {
+		if err := w.conn.Close(); err != nil {
+			logrus.Errorf("error closing %s socket: %s", w.name, err)
+		}
+	}
+	w.conn = conn
+	if w.buffered != nil {
+		buffered := w.buffered.Bytes()
+		if w.buffered.Truncated() {
+			buffered = append([]byte(TruncatedOutputMarker), buffered...)
+		}
+		w.buffered = nil
+		if _, err := conn.Write(buffered); err != nil {
+			logrus.Warnf("error writing buffered %s to reattached connection: %s", w.name, err)
+		}
+	}
+	return nil
+}
+
+// Close closes the current connection. No connection can be attached
+// afterwards.
+func (w *attachableWriter) Close() error {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	w.closed = true
+	w.buffered = nil
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+// Attach replaces the connections the relay's stdout and stderr are copied to
+// with those in s. The previous connections are closed. Stdin cannot be
+// reattached, and s may only contain streams which the relay was created
+// with. On success, the relay owns the connections in s.
+func (pr *PipeRelay) Attach(s *ConnectionSet) error {
+	if s.In != nil {
+		return errors.New("stdin cannot be reattached")
+	}
+	if s.Out != nil && pr.stdout == nil {
+		return errors.New("the process has no stdout to attach to")
+	}
+	if s.Err != nil && pr.stderr == nil {
+		return errors.New("the process has no stderr to attach to")
+	}
+	if s.Out != nil {
+		if err := pr.stdout.attach(s.Out); err != nil {
+			return err
+		}
+	}
+	if s.Err != nil {
+		if err := pr.stderr.attach(s.Err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
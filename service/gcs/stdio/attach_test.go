@@ -0,0 +1,88 @@
+package stdio
+
+import (
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/Microsoft/opengcs/service/gcs/transport"
+	"github.com/sirupsen/logrus"
+)
+
+// dialPair returns a connection dialed over an in-memory transport, along
+// with the host's end of that connection.
+func dialPair(t *testing.T) (transport.Connection, *transport.MockConnection) {
+	tport := &transport.MockTransport{Channel: make(chan *transport.MockConnection, 1)}
+	conn, err := tport.Dial(0)
+	if err != nil {
+		t.Fatalf("failed to dial mock transport: %s", err)
+	}
+	return conn, <-tport.Channel
+}
+
+func readString(t *testing.T, r io.Reader, length int) string {
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		t.Fatalf("failed to read %d bytes: %s", length, err)
+	}
+	return string(buf)
+}
+
+func Test_PipeRelay_Attach_ReplacesOutputConnection(t *testing.T) {
+	logrus.SetOutput(ioutil.Discard)
+
+	out, firstHost := dialPair(t)
+	defer firstHost.Close()
+	pr, err := (&ConnectionSet{Out: out}).NewPipeRelay()
+	if err != nil {
+		t.Fatalf("failed to create pipe relay: %s", err)
+	}
+	files, _ := pr.Files()
+	pr.Start()
+
+	files.Out.Write([]byte("before"))
+	if s := readString(t, firstHost, len("before")); s != "before" {
+		t.Fatalf("first connection received %q", s)
+	}
+
+	reattached, secondHost := dialPair(t)
+	defer secondHost.Close()
+	if err := pr.Attach(&ConnectionSet{Out: reattached}); err != nil {
+		t.Fatalf("failed to attach: %s", err)
+	}
+	files.Out.Write([]byte("after"))
+	if s := readString(t, secondHost, len("after")); s != "after" {
+		t.Fatalf("reattached connection received %q", s)
+	}
+
+	files.Out.Close()
+	pr.Wait()
+	if err := pr.Attach(&ConnectionSet{Out: reattached}); err == nil {
+		t.Fatal("attaching to a finished relay should fail")
+	}
+}
+
+func Test_PipeRelay_Attach_InvalidStreams_Failure(t *testing.T) {
+	out, host := dialPair(t)
+	defer host.Close()
+	pr, err := (&ConnectionSet{Out: out}).NewPipeRelay()
+	if err != nil {
+		t.Fatalf("failed to create pipe relay: %s", err)
+	}
+	files, _ := pr.Files()
+	pr.Start()
+	defer func() {
+		files.Out.Close()
+		pr.Wait()
+	}()
+
+	extra, extraHost := dialPair(t)
+	defer extraHost.Close()
+	defer extra.Close()
+	if err := pr.Attach(&ConnectionSet{In: extra}); err == nil {
+		t.Fatal("attaching stdin should fail")
+	}
+	if err := pr.Attach(&ConnectionSet{Err: extra}); err == nil {
+		t.Fatal("attaching stderr to a relay without stderr should fail")
+	}
+}
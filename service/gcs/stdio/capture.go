@@ -0,0 +1,58 @@
+package stdio
+
+import (
+	"sync"
+)
+
+// MaxCapturedOutputBytes is the most output the GCS keeps in memory for any
+// single capture of a process's output which is not relayed to the host.
+// Output beyond it is discarded, and TruncatedOutputMarker is added in its
+// place.
+var MaxCapturedOutputBytes = 1024 * 1024
+
+// TruncatedOutputMarker marks where captured output was truncated.
+const TruncatedOutputMarker = "\n[output truncated]\n"
+
+// CappedBuffer is an io.Writer which keeps the first limit bytes written to it
+// and discards the rest.
+type CappedBuffer struct {
+	m         sync.Mutex
+	buf       []byte
+	limit     int
+	truncated bool
+}
+
+// NewCappedBuffer returns a CappedBuffer which keeps at most
+// MaxCapturedOutputBytes.
+func NewCappedBuffer() *CappedBuffer {
+	return &CappedBuffer{limit: MaxCapturedOutputBytes}
+}
+
+// Write appends as much of p as fits under the buffer's limit. It never fails,
+// so that the process writing to it is not interrupted once the limit is
+// reached.
+func (b *CappedBuffer) Write(p []byte) (int, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	n := len(p)
+	if free := b.limit - len(b.buf); len(p) > free {
+		p = p[:free]
+		b.truncated = true
+	}
+	b.buf = append(b.buf, p...)
+	return n, nil
+}
+
+// Bytes returns a copy of the buffer's contents, followed by
+// TruncatedOutputMarker if anything was discarded.
+func (b *CappedBuffer) Bytes() []byte {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	out := append([]byte(nil), b.buf...)
+	if b.truncated {
+		out = append(out, TruncatedOutputMarker...)
+	}
+	return out
+}
@@ -0,0 +1,45 @@
+package stdio
+
+import (
+	"testing"
+)
+
+func Test_CappedBuffer_UnderLimit_NotMarked(t *testing.T) {
+	b := &CappedBuffer{limit: 8}
+	b.Write([]byte("abc"))
+	b.Write([]byte("defgh"))
+
+	if got := string(b.Bytes()); got != "abcdefgh" {
+		t.Fatalf("expected \"abcdefgh\", got %q", got)
+	}
+}
+
+func Test_CappedBuffer_OverLimit_TruncatedAndMarked(t *testing.T) {
+	b := &CappedBuffer{limit: 8}
+	n, err := b.Write([]byte("abcdef"))
+	if n != 6 || err != nil {
+		t.Fatalf("expected write of 6 bytes to succeed, got %d, %v", n, err)
+	}
+	n, err = b.Write([]byte("ghijkl"))
+	if n != 6 || err != nil {
+		t.Fatalf("expected write past the limit to report success, got %d, %v", n, err)
+	}
+	b.Write([]byte("mn"))
+
+	expected := "abcdefgh" + TruncatedOutputMarker
+	if got := string(b.Bytes()); got != expected {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+}
+
+func Test_NewCappedBuffer_UsesMaxCapturedOutputBytes(t *testing.T) {
+	defer func(max int) { MaxCapturedOutputBytes = max }(MaxCapturedOutputBytes)
+	MaxCapturedOutputBytes = 2
+
+	b := NewCappedBuffer()
+	b.Write([]byte("abc"))
+
+	if expected := "ab" + TruncatedOutputMarker; string(b.Bytes()) != expected {
+		t.Fatalf("expected %q, got %q", expected, b.Bytes())
+	}
+}
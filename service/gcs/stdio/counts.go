@@ -0,0 +1,43 @@
+package stdio
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+// RelayCounts is the number of bytes a relay has copied for each of a
+// process's stdio streams.
+type RelayCounts struct {
+	Stdin  uint64
+	Stdout uint64
+	Stderr uint64
+}
+
+// relayCounters holds the counts updated by a relay's copying goroutines.
+// The counters are accessed atomically, so they must be 64-bit aligned. The
+// structs containing a relayCounters keep it as their first field to ensure
+// this.
+type relayCounters struct {
+	stdin, stdout, stderr uint64
+}
+
+// counts returns a snapshot of the counters.
+func (c *relayCounters) counts() RelayCounts {
+	return RelayCounts{
+		Stdin:  atomic.LoadUint64(&c.stdin),
+		Stdout: atomic.LoadUint64(&c.stdout),
+		Stderr: atomic.LoadUint64(&c.stderr),
+	}
+}
+
+// countingWriter adds the number of bytes written through it to n.
+type countingWriter struct {
+	w io.Writer
+	n *uint64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	atomic.AddUint64(w.n, uint64(n))
+	return n, err
+}
@@ -0,0 +1,126 @@
+package stdio
+
+import (
+	"io"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// RelayFailurePolicy determines how a relay reacts when one of the connections
+// it relays a process's stdio over fails while the process is running, for
+// example because the host has disconnected.
+type RelayFailurePolicy string
+
+const (
+	// RelayFailureIgnore discards the process's output until new connections
+	// are attached. It is the default.
+	RelayFailureIgnore = RelayFailurePolicy("Ignore")
+	// RelayFailureDetach keeps the process running, and buffers its output
+	// until new connections are attached, when the buffered output is sent
+	// first. Only the most recent DefaultRingBufferSize bytes of each stream
+	// are kept. The stdin of the process is not closed. A process with a
+	// console cannot be reattached, so for it this is the same as
+	// RelayFailureIgnore.
+	RelayFailureDetach = RelayFailurePolicy("Detach")
+	// RelayFailureKill calls the ConnectionSet's OnFailure, which should kill
+	// the process, and then discards its output.
+	RelayFailureKill = RelayFailurePolicy("Kill")
+)
+
+// ParseRelayFailurePolicy returns the RelayFailurePolicy named by s. An empty
+// string is RelayFailureIgnore.
+func ParseRelayFailurePolicy(s string) (RelayFailurePolicy, error) {
+	switch policy := RelayFailurePolicy(s); policy {
+	case "":
+		return RelayFailureIgnore, nil
+	case RelayFailureIgnore, RelayFailureDetach, RelayFailureKill:
+		return policy, nil
+	}
+	return "", errors.Errorf("unknown relay failure policy \"%s\"", s)
+}
+
+// relayFailureHandler applies the failure policy of a ConnectionSet when one of
+// its connections fails.
+type relayFailureHandler struct {
+	policy    RelayFailurePolicy
+	onFailure func()
+	once      sync.Once
+	// hostGoneOnce ensures that the host going away is logged only once for
+	// all of the relay's connections.
+	hostGoneOnce sync.Once
+}
+
+func newRelayFailureHandler(s *ConnectionSet) *relayFailureHandler {
+	policy := s.FailurePolicy
+	if policy == "" {
+		policy = RelayFailureIgnore
+	}
+	return &relayFailureHandler{policy: policy, onFailure: s.OnFailure}
+}
+
+// failed reacts to the failure of the connection for the named stream. With
+// RelayFailureKill, OnFailure is called the first time any connection fails.
+func (h *relayFailureHandler) failed(name string, err error) {
+	if h.policy != RelayFailureKill || h.onFailure == nil {
+		return
+	}
+	h.once.Do(func() {
+		logrus.Warnf("killing process since its %s connection failed: %s", name, err)
+		h.onFailure()
+	})
+}
+
+// hostGone returns whether err, from the connection for the named stream,
+// means that the host has gone away, such as when the utility VM's host
+// disconnects. This is an expected way for a relay to be torn down, so it is
+// logged only once for the relay, at Info level, and callers should not log it
+// again.
+func (h *relayFailureHandler) hostGone(name string, err error) bool {
+	if !isHostGone(err) {
+		return false
+	}
+	h.hostGoneOnce.Do(func() {
+		logrus.Infof("the host has gone away, tearing down the stdio relay after its %s connection failed: %s", name, err)
+	})
+	return true
+}
+
+// isHostGone returns whether err is ENODEV or ECONNRESET, which vsock
+// connections fail with once the host has gone away.
+func isHostGone(err error) bool {
+	for {
+		switch e := errors.Cause(err).(type) {
+		case *net.OpError:
+			err = e.Err
+		case *os.PathError:
+			err = e.Err
+		case *os.SyscallError:
+			err = e.Err
+		case syscall.Errno:
+			return e == syscall.ENODEV || e == syscall.ECONNRESET
+		default:
+			return false
+		}
+	}
+}
+
+// failureReader reports errors reading a stdin connection, other than EOF, to
+// a relayFailureHandler.
+type failureReader struct {
+	r       io.Reader
+	name    string
+	handler *relayFailureHandler
+}
+
+func (r *failureReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && err != io.EOF {
+		r.handler.failed(r.name, err)
+	}
+	return n, err
+}
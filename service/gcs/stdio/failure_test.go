@@ -0,0 +1,231 @@
+package stdio
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// dropRelay starts a pipe relay of stdout over an in-memory connection using
+// the given policy, then drops the host's end of the connection and writes
+// "lost" to stdout. It returns once the relay has noticed the dropped
+// connection, with the relay, its files, and a channel which is closed if
+// OnFailure is called.
+func dropRelay(t *testing.T, policy RelayFailurePolicy) (*PipeRelay, *FileSet, <-chan struct{}) {
+	logrus.SetOutput(ioutil.Discard)
+
+	out, host := dialPair(t)
+	failed := make(chan struct{})
+	s := &ConnectionSet{
+		Out:           out,
+		FailurePolicy: policy,
+		OnFailure:     func() { close(failed) },
+	}
+	pr, err := s.NewPipeRelay()
+	if err != nil {
+		t.Fatalf("failed to create pipe relay: %s", err)
+	}
+	files, _ := pr.Files()
+	pr.Start()
+
+	// The host's end of the mock transport has a duplicate file descriptor,
+	// so closing it would not be seen. Shutting down reads makes writes to
+	// the connection fail instead.
+	host.CloseRead()
+	host.Close()
+	files.Out.Write([]byte("lost"))
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		pr.stdout.m.Lock()
+		dropped := pr.stdout.conn == nil
+		pr.stdout.m.Unlock()
+		if dropped {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the relay did not notice the dropped connection")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return pr, files, failed
+}
+
+// reattach attaches a new stdout connection to pr, writes "after" to its
+// stdout, and returns the first length bytes the new connection receives.
+func reattach(t *testing.T, pr *PipeRelay, files *FileSet, length int) string {
+	out, host := dialPair(t)
+	defer host.Close()
+	if err := pr.Attach(&ConnectionSet{Out: out}); err != nil {
+		t.Fatalf("failed to attach: %s", err)
+	}
+	files.Out.Write([]byte("after"))
+	received := readString(t, host, length)
+	files.Out.Close()
+	pr.Wait()
+	return received
+}
+
+func Test_RelayFailure_Kill_CallsOnFailure(t *testing.T) {
+	pr, files, failed := dropRelay(t, RelayFailureKill)
+	select {
+	case <-failed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnFailure was not called")
+	}
+	files.Out.Close()
+	pr.Wait()
+}
+
+func Test_RelayFailure_Detach_BuffersOutput(t *testing.T) {
+	pr, files, failed := dropRelay(t, RelayFailureDetach)
+	if received := reattach(t, pr, files, len("lostafter")); received != "lostafter" {
+		t.Fatalf("reattached connection received %q, expected the buffered output followed by \"after\"", received)
+	}
+	select {
+	case <-failed:
+		t.Fatal("OnFailure was called")
+	default:
+	}
+}
+
+func Test_RelayFailure_Ignore_DiscardsOutput(t *testing.T) {
+	pr, files, failed := dropRelay(t, RelayFailureIgnore)
+	if received := reattach(t, pr, files, len("after")); received != "after" {
+		t.Fatalf("reattached connection received %q, expected only \"after\"", received)
+	}
+	select {
+	case <-failed:
+		t.Fatal("OnFailure was called")
+	default:
+	}
+}
+
+func Test_ParseRelayFailurePolicy(t *testing.T) {
+	for s, expected := range map[string]RelayFailurePolicy{
+		"":       RelayFailureIgnore,
+		"Ignore": RelayFailureIgnore,
+		"Detach": RelayFailureDetach,
+		"Kill":   RelayFailureKill,
+	} {
+		if policy, err := ParseRelayFailurePolicy(s); err != nil || policy != expected {
+			t.Fatalf("ParseRelayFailurePolicy(%q) returned %q, %v", s, policy, err)
+		}
+	}
+	if _, err := ParseRelayFailurePolicy("Restart"); err == nil {
+		t.Fatal("ParseRelayFailurePolicy accepted an unknown policy")
+	}
+}
+
+// hostGoneConnection is a connection whose reads and writes fail with ENODEV,
+// as vsock connections do once the host has gone away.
+type hostGoneConnection struct {
+	closed int32
+}
+
+func (c *hostGoneConnection) Read(p []byte) (int, error) {
+	return 0, &os.PathError{Op: "read", Path: "vsock", Err: syscall.ENODEV}
+}
+
+func (c *hostGoneConnection) Write(p []byte) (int, error) {
+	return 0, &os.PathError{Op: "write", Path: "vsock", Err: syscall.ENODEV}
+}
+
+func (c *hostGoneConnection) Close() error {
+	atomic.StoreInt32(&c.closed, 1)
+	return nil
+}
+
+func (c *hostGoneConnection) CloseRead() error {
+	return &os.SyscallError{Syscall: "shutdown", Err: syscall.ENODEV}
+}
+
+func (c *hostGoneConnection) CloseWrite() error {
+	return &os.SyscallError{Syscall: "shutdown", Err: syscall.ENODEV}
+}
+
+func (c *hostGoneConnection) File() (*os.File, error) {
+	return nil, errors.New("hostGoneConnection has no file")
+}
+
+func Test_RelayFailure_HostGone_TearsDownAndLogsOnce(t *testing.T) {
+	var logs bytes.Buffer
+	logrus.SetOutput(&logs)
+	defer logrus.SetOutput(ioutil.Discard)
+
+	in, out, errConn := &hostGoneConnection{}, &hostGoneConnection{}, &hostGoneConnection{}
+	failed := make(chan struct{})
+	s := &ConnectionSet{
+		In:            in,
+		Out:           out,
+		Err:           errConn,
+		FailurePolicy: RelayFailureKill,
+		OnFailure:     func() { close(failed) },
+	}
+	pr, err := s.NewPipeRelay()
+	if err != nil {
+		t.Fatalf("failed to create pipe relay: %s", err)
+	}
+	files, _ := pr.Files()
+	pr.Start()
+
+	files.Out.Write([]byte("lost"))
+	files.Err.Write([]byte("lost"))
+	select {
+	case <-failed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnFailure was not called")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&out.closed) == 0 || atomic.LoadInt32(&errConn.closed) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the relay did not close the failed output connections")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	files.Out.Close()
+	files.Err.Close()
+	pr.Wait()
+
+	if atomic.LoadInt32(&in.closed) == 0 {
+		t.Fatal("the stdin connection was not closed")
+	}
+	logged := logs.String()
+	if n := strings.Count(logged, "the host has gone away"); n != 1 {
+		t.Fatalf("the host going away was logged %d times, expected once:\n%s", n, logged)
+	}
+	if !strings.Contains(logged, "level=info msg=\"the host has gone away") {
+		t.Fatalf("the host going away was not logged at Info level:\n%s", logged)
+	}
+	for _, line := range strings.Split(logged, "\n") {
+		if strings.Contains(line, "error writing") || (strings.Contains(line, "level=error") && strings.Contains(line, "no such device")) {
+			t.Fatalf("the host going away was logged as an error:\n%s", logged)
+		}
+	}
+}
+
+func Test_IsHostGone(t *testing.T) {
+	for _, tc := range []struct {
+		err      error
+		expected bool
+	}{
+		{syscall.ENODEV, true},
+		{&os.PathError{Op: "write", Path: "vsock", Err: syscall.ENODEV}, true},
+		{&net.OpError{Op: "read", Err: &os.SyscallError{Syscall: "read", Err: syscall.ECONNRESET}}, true},
+		{errors.Wrap(&os.PathError{Op: "read", Path: "vsock", Err: syscall.ECONNRESET}, "failed"), true},
+		{&os.PathError{Op: "write", Path: "vsock", Err: syscall.EPIPE}, false},
+		{errors.New("some other failure"), false},
+	} {
+		if actual := isHostGone(tc.err); actual != tc.expected {
+			t.Fatalf("isHostGone(%v) returned %t, expected %t", tc.err, actual, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package stdio
+
+import (
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNoStdin is returned when writing to the stdin of a process whose stdin
+// is not open, either because it was started without a stdin pipe or because
+// its stdin has been closed.
+var ErrNoStdin = errors.New("the process's stdin is not open")
+
+// StdinWriteTimeout is how long WriteStdin waits for a process to read the
+// data written to its stdin before giving up.
+var StdinWriteTimeout = 5 * time.Second
+
+// lockedWriter serializes the writes to w with m.
+type lockedWriter struct {
+	m *sync.Mutex
+	w io.Writer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.m.Lock()
+	defer w.m.Unlock()
+	return w.w.Write(p)
+}
+
+// writeWithTimeout writes p to f, failing if f is not ready for all of it
+// within StdinWriteTimeout. The timeout is not applied to files which do not
+// support deadlines.
+func writeWithTimeout(f *os.File, p []byte) (int, error) {
+	if err := f.SetWriteDeadline(time.Now().Add(StdinWriteTimeout)); err == nil {
+		defer f.SetWriteDeadline(time.Time{})
+	}
+	n, err := f.Write(p)
+	if err != nil {
+		return n, errors.Wrap(err, "failed to write to stdin")
+	}
+	return n, nil
+}
+
+// WriteStdin writes p to the process's stdin pipe, alongside any stdin being
+// relayed from the host. Relayed stdin is written in whole chunks around it,
+// so the two are not interleaved mid-write. Data written this way is not
+// included in BytesRelayed.
+func (pr *PipeRelay) WriteStdin(p []byte) (int, error) {
+	pr.stdinMutex.Lock()
+	defer pr.stdinMutex.Unlock()
+	if pr.pipes[1] == nil {
+		return 0, errors.WithStack(ErrNoStdin)
+	}
+	return writeWithTimeout(pr.pipes[1], p)
+}
+
+// WriteStdin writes p to the process's console as input, alongside any stdin
+// being relayed from the host. As for input typed at a terminal, it is
+// subject to the console's line discipline, such as echoing. Data written
+// this way is not included in BytesRelayed.
+func (r *TtyRelay) WriteStdin(p []byte) (int, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.closed {
+		return 0, errors.WithStack(ErrNoStdin)
+	}
+	r.stdinMutex.Lock()
+	defer r.stdinMutex.Unlock()
+	return writeWithTimeout(r.pty, p)
+}
@@ -0,0 +1,387 @@
+package stdio
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/Microsoft/opengcs/service/gcs/transport"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Stream identifiers used in the header of each multiplexed stdio frame.
+const (
+	MuxStreamStdin  = 0
+	MuxStreamStdout = 1
+	MuxStreamStderr = 2
+	// MuxStreamControl carries control frames from the host, such as console
+	// resizes, on connections created by NewMuxControlConnectionSet.
+	MuxStreamControl = 3
+)
+
+// Control frame types, given by the first byte of a control frame's payload.
+const (
+	// MuxControlResize resizes the process's console. It is followed by the
+	// new height and width as big-endian uint16s.
+	MuxControlResize = 1
+)
+
+// muxResizePayloadSize is the size of a MuxControlResize payload.
+const muxResizePayloadSize = 5
+
+// muxHeaderSize is the size of a multiplexed frame header: one byte of stream
+// identifier followed by a big-endian uint32 payload length.
+const muxHeaderSize = 5
+
+// MaxMuxFramePayload is the largest payload carried by a single multiplexed
+// frame. Larger writes are split across several frames.
+const MaxMuxFramePayload = 32 * 1024
+
+// WriteMuxFrame writes a single multiplexed frame for the given stream to w. A
+// frame with an empty payload marks the end of the stream.
+func WriteMuxFrame(w io.Writer, stream byte, payload []byte) error {
+	if len(payload) > MaxMuxFramePayload {
+		return errors.Errorf("multiplexed frame payload of %d bytes exceeds the maximum of %d", len(payload), MaxMuxFramePayload)
+	}
+	frame := make([]byte, muxHeaderSize+len(payload))
+	frame[0] = stream
+	binary.BigEndian.PutUint32(frame[1:muxHeaderSize], uint32(len(payload)))
+	copy(frame[muxHeaderSize:], payload)
+	if _, err := w.Write(frame); err != nil {
+		return errors.Wrap(err, "failed to write multiplexed frame")
+	}
+	return nil
+}
+
+// ReadMuxFrame reads a single multiplexed frame from r, returning its stream
+// identifier and payload.
+func ReadMuxFrame(r io.Reader) (stream byte, payload []byte, err error) {
+	var header [muxHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	length := binary.BigEndian.Uint32(header[1:])
+	if length > MaxMuxFramePayload {
+		return 0, nil, errors.Errorf("multiplexed frame payload of %d bytes exceeds the maximum of %d", length, MaxMuxFramePayload)
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, errors.Wrap(err, "failed to read multiplexed frame payload")
+	}
+	return header[0], payload, nil
+}
+
+// WriteMuxResizeFrame writes a control frame to w which resizes the console
+// of the process to height rows and width columns.
+func WriteMuxResizeFrame(w io.Writer, height, width uint16) error {
+	payload := make([]byte, muxResizePayloadSize)
+	payload[0] = MuxControlResize
+	binary.BigEndian.PutUint16(payload[1:3], height)
+	binary.BigEndian.PutUint16(payload[3:5], width)
+	return WriteMuxFrame(w, MuxStreamControl, payload)
+}
+
+// muxConnection is a single transport.Connection shared by the stdio streams of
+// a process. It is closed once every stream using it has been closed.
+type muxConnection struct {
+	conn transport.Connection
+
+	writeMutex sync.Mutex
+
+	refMutex sync.Mutex
+	refs     int
+	released bool
+
+	stdinReader *io.PipeReader
+	stdinWriter *io.PipeWriter
+
+	// control is set if control frames from the host are acted on rather
+	// than discarded.
+	control     bool
+	resizeMutex sync.Mutex
+	// onResize applies console resizes. Until it is set, the latest resize
+	// is kept in pendingResize so that it can be applied once it is.
+	onResize      func(height, width uint16)
+	pendingResize []uint16
+}
+
+// NewMuxConnectionSet returns a ConnectionSet whose stdin, stdout, and stderr
+// connections, as requested by in, out, and err, are all carried over conn.
+// Each write to stdout or stderr is sent as one or more frames tagged with the
+// stream it belongs to, and frames tagged as stdin are read from conn and
+// delivered to the stdin connection.
+func NewMuxConnectionSet(conn transport.Connection, in, out, err bool) *ConnectionSet {
+	return newMuxConnectionSet(conn, in, out, err, false)
+}
+
+// NewMuxControlConnectionSet is like NewMuxConnectionSet, but also reads
+// control frames from the host on the MuxStreamControl stream. Console resizes
+// sent this way are applied by the TtyRelay created from the returned
+// ConnectionSet, if any. Since frames are read in order, a resize is not seen
+// until all stdin sent before it has been read by the process.
+func NewMuxControlConnectionSet(conn transport.Connection, in, out, err bool) *ConnectionSet {
+	return newMuxConnectionSet(conn, in, out, err, true)
+}
+
+func newMuxConnectionSet(conn transport.Connection, in, out, err, control bool) *ConnectionSet {
+	m := &muxConnection{conn: conn, control: control}
+	s := &ConnectionSet{}
+	if control {
+		s.mux = m
+	}
+	if in {
+		m.refs++
+		m.stdinReader, m.stdinWriter = io.Pipe()
+		s.In = &muxStream{m: m, id: MuxStreamStdin}
+	}
+	if out {
+		m.refs++
+		s.Out = &muxStream{m: m, id: MuxStreamStdout}
+	}
+	if err {
+		m.refs++
+		s.Err = &muxStream{m: m, id: MuxStreamStderr}
+	}
+	if m.refs == 0 {
+		conn.Close()
+		return s
+	}
+	if in || control {
+		go m.demux()
+	}
+	return s
+}
+
+// demux reads frames from the connection, delivering stdin frames to the
+// stdin stream and acting on control frames. Without control frames, it
+// returns once stdin has ended. Otherwise it reads until the connection is
+// closed or an error is encountered.
+func (m *muxConnection) demux() {
+	stdinOpen := m.stdinWriter != nil
+	for {
+		stream, payload, err := ReadMuxFrame(m.conn)
+		if err != nil {
+			if err != io.EOF && !m.isReleased() {
+				logrus.Errorf("error reading multiplexed stdio frame: %s", err)
+			}
+			if stdinOpen {
+				m.stdinWriter.CloseWithError(io.EOF)
+			}
+			return
+		}
+		switch {
+		case stream == MuxStreamStdin && stdinOpen:
+			if len(payload) == 0 {
+				m.stdinWriter.Close()
+				stdinOpen = false
+			} else if _, err := m.stdinWriter.Write(payload); err != nil {
+				// The stdin stream has been closed by the reader.
+				stdinOpen = false
+			}
+			if !stdinOpen && !m.control {
+				return
+			}
+		case stream == MuxStreamControl && m.control:
+			m.handleControl(payload)
+		default:
+			logrus.Warnf("discarding multiplexed stdio frame for unexpected stream %d", stream)
+		}
+	}
+}
+
+// handleControl acts on the payload of a control frame.
+func (m *muxConnection) handleControl(payload []byte) {
+	if len(payload) == 0 {
+		logrus.Warn("discarding empty multiplexed stdio control frame")
+		return
+	}
+	switch payload[0] {
+	case MuxControlResize:
+		if len(payload) != muxResizePayloadSize {
+			logrus.Warnf("discarding multiplexed console resize frame with a %d byte payload", len(payload))
+			return
+		}
+		height := binary.BigEndian.Uint16(payload[1:3])
+		width := binary.BigEndian.Uint16(payload[3:5])
+		m.resizeMutex.Lock()
+		defer m.resizeMutex.Unlock()
+		if m.onResize == nil {
+			m.pendingResize = []uint16{height, width}
+			return
+		}
+		m.onResize(height, width)
+	default:
+		logrus.Warnf("discarding multiplexed stdio control frame of unknown type %d", payload[0])
+	}
+}
+
+// setResizeHandler sets the function which applies console resizes sent by
+// the host, and applies the latest resize sent before it was set.
+func (m *muxConnection) setResizeHandler(onResize func(height, width uint16)) {
+	m.resizeMutex.Lock()
+	defer m.resizeMutex.Unlock()
+	m.onResize = onResize
+	if m.pendingResize != nil {
+		onResize(m.pendingResize[0], m.pendingResize[1])
+		m.pendingResize = nil
+	}
+}
+
+// isReleased returns true once every stream has released the connection.
+func (m *muxConnection) isReleased() bool {
+	m.refMutex.Lock()
+	defer m.refMutex.Unlock()
+	return m.released
+}
+
+// write sends p on the given stream, splitting it across frames as needed.
+func (m *muxConnection) write(stream byte, p []byte) (int, error) {
+	m.writeMutex.Lock()
+	defer m.writeMutex.Unlock()
+
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > MaxMuxFramePayload {
+			chunk = chunk[:MaxMuxFramePayload]
+		}
+		if err := WriteMuxFrame(m.conn, stream, chunk); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
+
+// writeEOF sends the frame marking the end of the given stream.
+func (m *muxConnection) writeEOF(stream byte) error {
+	m.writeMutex.Lock()
+	defer m.writeMutex.Unlock()
+	return WriteMuxFrame(m.conn, stream, nil)
+}
+
+// release drops a stream's reference to the connection, closing it once no
+// streams remain.
+func (m *muxConnection) release() error {
+	m.refMutex.Lock()
+	defer m.refMutex.Unlock()
+
+	m.refs--
+	if m.refs == 0 {
+		m.released = true
+		return m.conn.Close()
+	}
+	return nil
+}
+
+// muxStream is a transport.Connection for one stdio stream carried over a
+// muxConnection. The stdin stream may only be read from, and the stdout and
+// stderr streams may only be written to.
+type muxStream struct {
+	m  *muxConnection
+	id byte
+
+	closeOnce sync.Once
+	closeErr  error
+
+	fileMutex sync.Mutex
+	// fileOwned is set once File has been called, after which the stream is
+	// closed by the goroutine relaying to and from the returned file rather
+	// than by Close.
+	fileOwned bool
+}
+
+func (s *muxStream) Read(p []byte) (int, error) {
+	if s.id != MuxStreamStdin {
+		return 0, errors.Errorf("cannot read from multiplexed output stream %d", s.id)
+	}
+	return s.m.stdinReader.Read(p)
+}
+
+func (s *muxStream) Write(p []byte) (int, error) {
+	if s.id == MuxStreamStdin {
+		return 0, errors.New("cannot write to multiplexed stdin stream")
+	}
+	return s.m.write(s.id, p)
+}
+
+// CloseRead stops reading from the stdin stream. It has no effect on output
+// streams.
+func (s *muxStream) CloseRead() error {
+	if s.id == MuxStreamStdin {
+		return s.m.stdinReader.Close()
+	}
+	return nil
+}
+
+// CloseWrite ends an output stream. It has no effect on the stdin stream.
+func (s *muxStream) CloseWrite() error {
+	if s.id == MuxStreamStdin {
+		return nil
+	}
+	return s.close()
+}
+
+// Close closes the stream, and the underlying connection once all of the
+// process's streams are closed. If File has been called, Close has no effect.
+func (s *muxStream) Close() error {
+	s.fileMutex.Lock()
+	owned := s.fileOwned
+	s.fileMutex.Unlock()
+	if owned {
+		return nil
+	}
+	return s.close()
+}
+
+func (s *muxStream) close() error {
+	s.closeOnce.Do(func() {
+		if s.id == MuxStreamStdin {
+			s.m.stdinReader.Close()
+		} else if err := s.m.writeEOF(s.id); err != nil {
+			s.closeErr = err
+		}
+		if err := s.m.release(); err != nil && s.closeErr == nil {
+			s.closeErr = errors.Wrap(err, "failed to close multiplexed connection")
+		}
+	})
+	return s.closeErr
+}
+
+// File returns one end of a pipe which is relayed to or from the stream, so
+// that it can be handed to a child process. The stream is closed once the
+// relay finishes.
+func (s *muxStream) File() (*os.File, error) {
+	s.fileMutex.Lock()
+	defer s.fileMutex.Unlock()
+	if s.fileOwned {
+		return nil, errors.Errorf("a file has already been created for multiplexed stream %d", s.id)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create pipe for multiplexed stream %d", s.id)
+	}
+	s.fileOwned = true
+	if s.id == MuxStreamStdin {
+		go func() {
+			if _, err := io.Copy(w, s); err != nil {
+				logrus.Errorf("error copying multiplexed stdin to pipe: %s", err)
+			}
+			w.Close()
+			s.close()
+		}()
+		return r, nil
+	}
+	go func() {
+		if _, err := io.Copy(s, r); err != nil {
+			logrus.Errorf("error copying pipe to multiplexed stream %d: %s", s.id, err)
+		}
+		r.Close()
+		s.close()
+	}()
+	return w, nil
+}
@@ -0,0 +1,261 @@
+package stdio
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Microsoft/opengcs/service/gcs/transport"
+	"golang.org/x/sys/unix"
+)
+
+// newMuxPair returns a multiplexed ConnectionSet carried over an in-memory
+// connection, along with the host's end of that connection.
+func newMuxPair(t *testing.T, in, out, err bool) (*ConnectionSet, *transport.MockConnection) {
+	tport := &transport.MockTransport{Channel: make(chan *transport.MockConnection, 1)}
+	conn, dialErr := tport.Dial(0)
+	if dialErr != nil {
+		t.Fatalf("failed to dial mock transport: %s", dialErr)
+	}
+	return NewMuxConnectionSet(conn, in, out, err), <-tport.Channel
+}
+
+// newMuxControlPair is like newMuxPair, but the ConnectionSet also reads
+// control frames from the host.
+func newMuxControlPair(t *testing.T, in, out, err bool) (*ConnectionSet, *transport.MockConnection) {
+	tport := &transport.MockTransport{Channel: make(chan *transport.MockConnection, 1)}
+	conn, dialErr := tport.Dial(0)
+	if dialErr != nil {
+		t.Fatalf("failed to dial mock transport: %s", dialErr)
+	}
+	return NewMuxControlConnectionSet(conn, in, out, err), <-tport.Channel
+}
+
+// newTestConsole returns the master of a new console, along with its slave.
+func newTestConsole(t *testing.T) (master, slave *os.File) {
+	master, slavePath, err := NewConsole()
+	if err != nil {
+		t.Fatalf("failed to create console: %s", err)
+	}
+	slave, err = os.OpenFile(slavePath, os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		t.Fatalf("failed to open console slave: %s", err)
+	}
+	return master, slave
+}
+
+func consoleSize(t *testing.T, f *os.File) (height, width uint16) {
+	ws, err := unix.IoctlGetWinsize(int(f.Fd()), unix.TIOCGWINSZ)
+	if err != nil {
+		t.Fatalf("failed to get console size: %s", err)
+	}
+	return ws.Row, ws.Col
+}
+
+// waitForConsoleSize fails the test if the console f is not resized to height
+// and width within a few seconds.
+func waitForConsoleSize(t *testing.T, f *os.File, height, width uint16) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		h, w := consoleSize(t, f)
+		if h == height && w == width {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("console size was %dx%d, expected %dx%d", h, w, height, width)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+type muxFrame struct {
+	stream  byte
+	payload string
+}
+
+func readMuxFrames(t *testing.T, r io.Reader, count int) []muxFrame {
+	frames := make([]muxFrame, 0, count)
+	for i := 0; i < count; i++ {
+		stream, payload, err := ReadMuxFrame(r)
+		if err != nil {
+			t.Fatalf("failed to read frame %d: %s", i, err)
+		}
+		frames = append(frames, muxFrame{stream, string(payload)})
+	}
+	return frames
+}
+
+func Test_Mux_InterleavedOutput_FramedPerStream(t *testing.T) {
+	s, host := newMuxPair(t, false, true, true)
+	defer host.Close()
+	m := s.Out.(*muxStream).m
+
+	s.Out.Write([]byte("out1"))
+	s.Err.Write([]byte("err1"))
+	s.Out.Write([]byte("out2"))
+	s.Err.Write([]byte("err2"))
+	s.Close()
+
+	expected := []muxFrame{
+		{MuxStreamStdout, "out1"},
+		{MuxStreamStderr, "err1"},
+		{MuxStreamStdout, "out2"},
+		{MuxStreamStderr, "err2"},
+		{MuxStreamStdout, ""},
+		{MuxStreamStderr, ""},
+	}
+	frames := readMuxFrames(t, host, len(expected))
+	for i := range expected {
+		if frames[i] != expected[i] {
+			t.Fatalf("frame %d was %+v, expected %+v", i, frames[i], expected[i])
+		}
+	}
+
+	// Once all streams are closed, the underlying connection is released.
+	if refs := m.refs; refs != 0 {
+		t.Fatalf("expected no remaining stream references, got %d", refs)
+	}
+}
+
+func Test_Mux_LargeWrite_SplitAcrossFrames(t *testing.T) {
+	s, host := newMuxPair(t, false, true, false)
+	defer host.Close()
+
+	data := make([]byte, MaxMuxFramePayload+10)
+	go func() {
+		s.Out.Write(data)
+		s.Close()
+	}()
+
+	frames := readMuxFrames(t, host, 3)
+	if len(frames[0].payload) != MaxMuxFramePayload || len(frames[1].payload) != 10 || frames[2].payload != "" {
+		t.Fatalf("unexpected frame sizes %d, %d, %d", len(frames[0].payload), len(frames[1].payload), len(frames[2].payload))
+	}
+}
+
+func Test_Mux_Stdin_DeliveredUntilEmptyFrame(t *testing.T) {
+	s, host := newMuxPair(t, true, false, false)
+	defer host.Close()
+
+	WriteMuxFrame(host, MuxStreamStdin, []byte("hello "))
+	WriteMuxFrame(host, MuxStreamStdin, []byte("world"))
+	WriteMuxFrame(host, MuxStreamStdin, nil)
+
+	in, err := ioutil.ReadAll(s.In)
+	if err != nil {
+		t.Fatalf("failed to read stdin: %s", err)
+	}
+	if string(in) != "hello world" {
+		t.Fatalf("unexpected stdin %q", in)
+	}
+	s.Close()
+}
+
+func Test_Mux_PipeRelay_InterleavedOutput(t *testing.T) {
+	s, host := newMuxPair(t, false, true, true)
+	defer host.Close()
+
+	pr, err := s.NewPipeRelay()
+	if err != nil {
+		t.Fatalf("failed to create pipe relay: %s", err)
+	}
+	fs, err := pr.Files()
+	if err != nil {
+		t.Fatalf("failed to get pipe relay files: %s", err)
+	}
+	pr.Start()
+	fs.Out.Write([]byte("stdout"))
+	fs.Err.Write([]byte("stderr"))
+	fs.Close()
+	go pr.Wait()
+
+	// The relay copies each stream concurrently, so only the content of each
+	// stream, and not their relative order, is deterministic.
+	received := map[byte]string{}
+	closed := 0
+	for closed < 2 {
+		stream, payload, err := ReadMuxFrame(host)
+		if err != nil {
+			t.Fatalf("failed to read frame: %s", err)
+		}
+		if len(payload) == 0 {
+			closed++
+			continue
+		}
+		received[stream] += string(payload)
+	}
+	if received[MuxStreamStdout] != "stdout" || received[MuxStreamStderr] != "stderr" {
+		t.Fatalf("unexpected output %q", received)
+	}
+}
+
+func Test_Mux_ControlResize_ResizesConsole(t *testing.T) {
+	s, host := newMuxControlPair(t, true, false, false)
+	defer host.Close()
+	master, slave := newTestConsole(t)
+	defer slave.Close()
+
+	relay := s.NewTtyRelay(master)
+	relay.Start()
+	if err := WriteMuxResizeFrame(host, 40, 120); err != nil {
+		t.Fatal(err)
+	}
+	waitForConsoleSize(t, master, 40, 120)
+
+	// Stdin ending does not stop later control frames from being applied.
+	if err := WriteMuxFrame(host, MuxStreamStdin, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteMuxResizeFrame(host, 50, 132); err != nil {
+		t.Fatal(err)
+	}
+	waitForConsoleSize(t, master, 50, 132)
+	relay.Wait()
+}
+
+func Test_Mux_ControlResize_SentBeforeRelayStarts_Applied(t *testing.T) {
+	s, host := newMuxControlPair(t, true, false, false)
+	defer host.Close()
+	master, slave := newTestConsole(t)
+	defer slave.Close()
+
+	if err := WriteMuxResizeFrame(host, 24, 80); err != nil {
+		t.Fatal(err)
+	}
+	relay := s.NewTtyRelay(master)
+	relay.Start()
+	waitForConsoleSize(t, master, 24, 80)
+	relay.Wait()
+}
+
+func Test_Mux_ControlResize_IgnoredWithoutControl(t *testing.T) {
+	s, host := newMuxPair(t, true, false, false)
+	defer host.Close()
+	master, slave := newTestConsole(t)
+	defer slave.Close()
+	if err := ResizeConsole(master, 10, 20); err != nil {
+		t.Fatal(err)
+	}
+
+	relay := s.NewTtyRelay(master)
+	relay.Start()
+	if err := WriteMuxResizeFrame(host, 40, 120); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteMuxFrame(host, MuxStreamStdin, []byte("x\n")); err != nil {
+		t.Fatal(err)
+	}
+	// Frames are handled in order, so once stdin arrives the resize has been
+	// discarded.
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(slave, buf); err != nil {
+		t.Fatalf("failed to read stdin from console: %s", err)
+	}
+	if h, w := consoleSize(t, master); h != 10 || w != 20 {
+		t.Fatalf("console was resized to %dx%d", h, w)
+	}
+	relay.Wait()
+}
@@ -0,0 +1,123 @@
+package stdio
+
+import (
+	"io"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultRingBufferSize is the capacity of a RingBuffer created with a size of
+// zero.
+const DefaultRingBufferSize = 64 * 1024
+
+// RingBuffer is a fixed size buffer which retains the most recent bytes
+// written to it, discarding the oldest once it is full. It implements
+// transport.Connection so that it can be used in a ConnectionSet in place of a
+// stdout or stderr connection. Reads from it return io.EOF, and closing it has
+// no effect, so its contents remain available after the process writing to it
+// has exited.
+type RingBuffer struct {
+	m    sync.Mutex
+	buf  []byte
+	size int
+	// start is the index of the oldest byte in buf, and full records whether
+	// buf has wrapped.
+	start int
+	full  bool
+	// truncated records whether any bytes have been discarded.
+	truncated bool
+}
+
+// NewRingBuffer returns a RingBuffer which retains the last size bytes written
+// to it. If size is zero, DefaultRingBufferSize is used.
+func NewRingBuffer(size int) *RingBuffer {
+	if size <= 0 {
+		size = DefaultRingBufferSize
+	}
+	return &RingBuffer{buf: make([]byte, 0, size), size: size}
+}
+
+// Write appends p to the buffer, discarding the oldest bytes if it would
+// exceed the buffer's capacity. It never fails.
+func (b *RingBuffer) Write(p []byte) (int, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	n := len(p)
+	if n >= b.size {
+		// Only the tail of p fits.
+		if n > b.size || len(b.buf) > 0 {
+			b.truncated = true
+		}
+		b.buf = append(b.buf[:0], p[n-b.size:]...)
+		b.start = 0
+		b.full = true
+		return n, nil
+	}
+	for len(p) > 0 {
+		if !b.full {
+			free := b.size - len(b.buf)
+			if len(p) <= free {
+				b.buf = append(b.buf, p...)
+				return n, nil
+			}
+			b.buf = append(b.buf, p[:free]...)
+			p = p[free:]
+			b.full = true
+			b.start = 0
+		}
+		b.truncated = true
+		copied := copy(b.buf[b.start:], p)
+		p = p[copied:]
+		b.start = (b.start + copied) % b.size
+	}
+	return n, nil
+}
+
+// Bytes returns a copy of the buffer's contents, oldest first.
+func (b *RingBuffer) Bytes() []byte {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	out := make([]byte, 0, len(b.buf))
+	if !b.full {
+		return append(out, b.buf...)
+	}
+	out = append(out, b.buf[b.start:]...)
+	return append(out, b.buf[:b.start]...)
+}
+
+// Truncated returns whether any of the bytes written to the buffer have been
+// discarded to make room for newer ones.
+func (b *RingBuffer) Truncated() bool {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.truncated
+}
+
+// Read always returns io.EOF.
+func (b *RingBuffer) Read(p []byte) (int, error) {
+	return 0, io.EOF
+}
+
+// Close has no effect.
+func (b *RingBuffer) Close() error {
+	return nil
+}
+
+// CloseRead has no effect.
+func (b *RingBuffer) CloseRead() error {
+	return nil
+}
+
+// CloseWrite has no effect.
+func (b *RingBuffer) CloseWrite() error {
+	return nil
+}
+
+// File returns an error, since a RingBuffer is not backed by a file.
+func (b *RingBuffer) File() (*os.File, error) {
+	return nil, errors.New("a ring buffer cannot be converted to a file")
+}
@@ -0,0 +1,86 @@
+package stdio
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func Test_RingBuffer_UnderCapacity_RetainsAll(t *testing.T) {
+	b := NewRingBuffer(8)
+	b.Write([]byte("abc"))
+	b.Write([]byte("de"))
+
+	if got := string(b.Bytes()); got != "abcde" {
+		t.Fatalf("expected \"abcde\", got %q", got)
+	}
+}
+
+func Test_RingBuffer_OverCapacity_RetainsNewest(t *testing.T) {
+	b := NewRingBuffer(8)
+	b.Write([]byte("abcdef"))
+	b.Write([]byte("ghij"))
+	b.Write([]byte("kl"))
+
+	if got := string(b.Bytes()); got != "efghijkl" {
+		t.Fatalf("expected \"efghijkl\", got %q", got)
+	}
+
+	b.Write([]byte("0123456789"))
+	if got := string(b.Bytes()); got != "23456789" {
+		t.Fatalf("expected \"23456789\", got %q", got)
+	}
+}
+
+func Test_RingBuffer_ZeroSize_UsesDefault(t *testing.T) {
+	b := NewRingBuffer(0)
+	b.Write(bytes.Repeat([]byte{'a'}, DefaultRingBufferSize+10))
+
+	if got := len(b.Bytes()); got != DefaultRingBufferSize {
+		t.Fatalf("expected %d bytes, got %d", DefaultRingBufferSize, got)
+	}
+}
+
+func Test_RingBuffer_PipeRelay_OutputRetrievable(t *testing.T) {
+	b := NewRingBuffer(64)
+	s := &ConnectionSet{Out: b, Err: b}
+
+	pr, err := s.NewPipeRelay()
+	if err != nil {
+		t.Fatalf("failed to create pipe relay: %s", err)
+	}
+	fs, err := pr.Files()
+	if err != nil {
+		t.Fatalf("failed to get pipe relay files: %s", err)
+	}
+	pr.Start()
+
+	if _, err := fs.Out.Write([]byte("stdout output\n")); err != nil {
+		t.Fatalf("failed to write to stdout: %s", err)
+	}
+	if _, err := fs.Err.Write([]byte("stderr output\n")); err != nil {
+		t.Fatalf("failed to write to stderr: %s", err)
+	}
+	fs.Close()
+	pr.Wait()
+
+	// stdout and stderr are relayed concurrently, so their relative order in
+	// the buffer is not deterministic.
+	got := string(b.Bytes())
+	if len(got) != len("stdout output\nstderr output\n") ||
+		!strings.Contains(got, "stdout output\n") || !strings.Contains(got, "stderr output\n") {
+		t.Fatalf("unexpected buffered output %q", got)
+	}
+}
+
+func Test_RingBuffer_Truncated(t *testing.T) {
+	b := NewRingBuffer(4)
+	b.Write([]byte("abcd"))
+	if b.Truncated() {
+		t.Fatal("buffer filled exactly to capacity was reported as truncated")
+	}
+	b.Write([]byte("e"))
+	if !b.Truncated() {
+		t.Fatal("buffer which discarded bytes was not reported as truncated")
+	}
+}
@@ -4,16 +4,34 @@ import (
 	"io"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/Microsoft/opengcs/service/gcs/transport"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
+// RelayDrainTimeout is how long Wait lets a relay copy the output left in a
+// process's pipes or console once it has exited. If a descendant of the
+// process still holds them open when it elapses, the relay stops copying and
+// any later output is lost.
+var RelayDrainTimeout = 5 * time.Second
+
 // ConnectionSet is a structure defining the readers and writers the Core
 // implementation should forward a process's stdio through.
 type ConnectionSet struct {
 	In, Out, Err transport.Connection
+
+	// FailurePolicy determines how a relay of the connections reacts if one
+	// of them fails while the process is running. An empty policy is
+	// RelayFailureIgnore. OnFailure is called with RelayFailureKill, and
+	// should kill the process.
+	FailurePolicy RelayFailurePolicy
+	OnFailure     func()
+
+	// mux is the multiplexed connection carrying the streams, if it reads
+	// control frames from the host.
+	mux *muxConnection
 }
 
 // Close closes each stdio connection.
@@ -40,6 +58,33 @@ func (s *ConnectionSet) Close() error {
 	return err
 }
 
+// Shutdown half-closes each stdio connection and then closes it. Half-closing
+// signals EOF to the other end of stdout and stderr and ends reads of stdin,
+// even if a duplicate of a connection's file is still held open elsewhere,
+// such as by a child of the process whose stdio it was.
+func (s *ConnectionSet) Shutdown() error {
+	var err error
+	if s.In != nil {
+		if cerr := s.In.CloseRead(); cerr != nil && err == nil {
+			err = errors.Wrap(cerr, "failed CloseRead on stdin")
+		}
+	}
+	if s.Out != nil {
+		if cerr := s.Out.CloseWrite(); cerr != nil && err == nil {
+			err = errors.Wrap(cerr, "failed CloseWrite on stdout")
+		}
+	}
+	if s.Err != nil {
+		if cerr := s.Err.CloseWrite(); cerr != nil && err == nil {
+			err = errors.Wrap(cerr, "failed CloseWrite on stderr")
+		}
+	}
+	if cerr := s.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	return err
+}
+
 // FileSet contains os.File fields for stdio.
 type FileSet struct {
 	In, Out, Err *os.File
@@ -101,7 +146,7 @@ func (s *ConnectionSet) Files() (_ *FileSet, err error) {
 
 // NewPipeRelay returns a new pipe relay wrapping the given connection stdin, stdout, stderr set.
 func (s *ConnectionSet) NewPipeRelay() (_ *PipeRelay, err error) {
-	pr := &PipeRelay{s: s}
+	pr := &PipeRelay{s: s, failure: newRelayFailureHandler(s)}
 	defer func() {
 		if err != nil {
 			pr.closePipes()
@@ -132,10 +177,20 @@ func (s *ConnectionSet) NewPipeRelay() (_ *PipeRelay, err error) {
 // PipeRelay is a relay built to expose a pipe interface
 // for stdin, stdout, stderr on top of a ConnectionSet.
 type PipeRelay struct {
-	wg sync.WaitGroup
-	s  *ConnectionSet
+	// counters must be the first field, to keep it 64-bit aligned.
+	counters relayCounters
+	wg       sync.WaitGroup
+	s        *ConnectionSet
 	// pipes format is stdin [0 read, 1 write], stdout [2 read, 3 write], stderr [4 read, 5 write].
 	pipes [6]*os.File
+	// stdinMutex serializes the writes to, and the closing of, the stdin
+	// write pipe, which is written by both the relay and WriteStdin.
+	stdinMutex sync.Mutex
+	// stdout and stderr are the writers the relay copies output to. They are
+	// set by Start, and allow the output to be reattached to new connections.
+	stdout, stderr *attachableWriter
+	// failure applies the ConnectionSet's failure policy.
+	failure *relayFailureHandler
 }
 
 // Files returns a FileSet with an os.File for each connection
@@ -160,35 +215,49 @@ func (pr *PipeRelay) Start() {
 	if pr.s.In != nil {
 		pr.wg.Add(1)
 		go func() {
-			if _, err := io.Copy(pr.pipes[1], pr.s.In); err != nil {
-				logrus.Errorf("error copying stdin to pipe: %s", err)
+			stdin := &lockedWriter{m: &pr.stdinMutex, w: pr.pipes[1]}
+			in := &failureReader{r: pr.s.In, name: "stdin", handler: pr.failure}
+			if _, err := io.Copy(&countingWriter{w: stdin, n: &pr.counters.stdin}, in); err != nil {
+				if !pr.failure.hostGone("stdin", err) {
+					logrus.Errorf("error copying stdin to pipe: %s", err)
+				}
+				if pr.failure.policy == RelayFailureDetach {
+					// The process keeps its stdin until it exits, so
+					// that it is not sent EOF by a disconnection.
+					pr.wg.Done()
+					return
+				}
 			}
+			pr.stdinMutex.Lock()
 			if err := pr.pipes[1].Close(); err != nil {
 				logrus.Errorf("error closing stdin write pipe: %s", err)
 			}
 			pr.pipes[1] = nil
+			pr.stdinMutex.Unlock()
 			pr.wg.Done()
 		}()
 	}
 	if pr.s.Out != nil {
+		pr.stdout = newAttachableWriter("stdout", pr.s.Out, pr.failure)
 		pr.wg.Add(1)
 		go func() {
-			if _, err := io.Copy(pr.s.Out, pr.pipes[2]); err != nil {
+			if _, err := io.Copy(&countingWriter{w: pr.stdout, n: &pr.counters.stdout}, pr.pipes[2]); err != nil {
 				logrus.Errorf("error copying stdout from pipe: %s", err)
 			}
-			if err := pr.s.Out.Close(); err != nil {
+			if err := pr.stdout.Close(); err != nil {
 				logrus.Errorf("error closing stdout socket: %s", err)
 			}
 			pr.wg.Done()
 		}()
 	}
 	if pr.s.Err != nil {
+		pr.stderr = newAttachableWriter("stderr", pr.s.Err, pr.failure)
 		pr.wg.Add(1)
 		go func() {
-			if _, err := io.Copy(pr.s.Err, pr.pipes[4]); err != nil {
+			if _, err := io.Copy(&countingWriter{w: pr.stderr, n: &pr.counters.stderr}, pr.pipes[4]); err != nil {
 				logrus.Errorf("error copying stderr from pipe: %s", err)
 			}
-			if err := pr.s.Err.Close(); err != nil {
+			if err := pr.stderr.Close(); err != nil {
 				logrus.Errorf("error closing stderr socket: %s", err)
 			}
 			pr.wg.Done()
@@ -196,6 +265,12 @@ func (pr *PipeRelay) Start() {
 	}
 }
 
+// BytesRelayed returns the number of bytes the relay has copied so far for
+// each stream.
+func (pr *PipeRelay) BytesRelayed() RelayCounts {
+	return pr.counters.counts()
+}
+
 // Wait waits for the relaying to finish and closes the associated
 // pipes and connections.
 func (pr *PipeRelay) Wait() {
@@ -204,16 +279,45 @@ func (pr *PipeRelay) Wait() {
 	// exit back to the client, and the client expects the process notification before
 	// it will close its side of stdin (which io.Copy is waiting on in the copying goroutine).
 	if pr.s.In != nil {
-		if err := pr.s.In.CloseRead(); err != nil {
+		if err := pr.s.In.CloseRead(); err != nil && !pr.failure.hostGone("stdin", err) {
 			logrus.Errorf("error closing read for stdin: %s", err)
 		}
 	}
 
-	pr.wg.Wait()
+	drain(&pr.wg, pr.pipes[2], pr.pipes[4])
 	pr.closePipes()
 	pr.s.Close()
 }
 
+// drain waits up to RelayDrainTimeout for the relay goroutines in wg to copy
+// the output remaining in outputs to the connections and finish. If they do
+// not, reading outputs is made to fail so that they stop, and then they are
+// waited for.
+func drain(wg *sync.WaitGroup, outputs ...*os.File) {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	timer := time.NewTimer(RelayDrainTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return
+	case <-timer.C:
+	}
+	logrus.Warnf("stdio relay did not finish within %s of the process exiting, discarding its remaining output", RelayDrainTimeout)
+	for _, f := range outputs {
+		if f == nil {
+			continue
+		}
+		if err := f.SetReadDeadline(time.Now()); err != nil {
+			logrus.Errorf("failed to stop reading process output: %s", err)
+		}
+	}
+	<-done
+}
+
 func (pr *PipeRelay) closePipes() {
 	for i := 0; i < len(pr.pipes); i++ {
 		if pr.pipes[i] != nil {
@@ -227,16 +331,30 @@ func (pr *PipeRelay) closePipes() {
 
 // NewTtyRelay returns a new TTY relay for a given master PTY file.
 func (s *ConnectionSet) NewTtyRelay(pty *os.File) *TtyRelay {
-	return &TtyRelay{s: s, pty: pty}
+	failure := newRelayFailureHandler(s)
+	// The console's output cannot be reattached, so there is no point
+	// buffering it.
+	if failure.policy == RelayFailureDetach {
+		failure.policy = RelayFailureIgnore
+	}
+	return &TtyRelay{s: s, pty: pty, failure: failure}
 }
 
 // TtyRelay relays IO between a set of stdio connections and a master PTY file.
 type TtyRelay struct {
-	m      sync.Mutex
-	closed bool
-	wg     sync.WaitGroup
-	s      *ConnectionSet
-	pty    *os.File
+	// counters must be the first field, to keep it 64-bit aligned. Since the
+	// pty combines the process's output, it is all counted as stdout.
+	counters relayCounters
+	m        sync.Mutex
+	closed   bool
+	wg       sync.WaitGroup
+	s        *ConnectionSet
+	pty      *os.File
+	// stdinMutex serializes the writes of the relay and WriteStdin to the
+	// pty.
+	stdinMutex sync.Mutex
+	// failure applies the ConnectionSet's failure policy.
+	failure *relayFailureHandler
 }
 
 // ResizeConsole sends the appropriate resize to a pTTY FD
@@ -253,11 +371,20 @@ func (r *TtyRelay) ResizeConsole(height, width uint16) error {
 // Start starts the relay operation. The caller must call Wait to wait
 // for the relay to finish and release the associated resources.
 func (r *TtyRelay) Start() {
+	if r.s.mux != nil {
+		r.s.mux.setResizeHandler(func(height, width uint16) {
+			if err := r.ResizeConsole(height, width); err != nil {
+				logrus.Warnf("failed to apply console resize from the host: %s", err)
+			}
+		})
+	}
 	if r.s.In != nil {
 		r.wg.Add(1)
 		go func() {
-			_, err := io.Copy(r.pty, r.s.In)
-			if err != nil {
+			stdin := &lockedWriter{m: &r.stdinMutex, w: r.pty}
+			in := &failureReader{r: r.s.In, name: "stdin", handler: r.failure}
+			_, err := io.Copy(&countingWriter{w: stdin, n: &r.counters.stdin}, in)
+			if err != nil && !r.failure.hostGone("stdin", err) {
 				logrus.Errorf("error copying stdin to pty: %s", err)
 			}
 			r.wg.Done()
@@ -266,7 +393,8 @@ func (r *TtyRelay) Start() {
 	if r.s.Out != nil {
 		r.wg.Add(1)
 		go func() {
-			_, err := io.Copy(r.s.Out, r.pty)
+			stdout := newAttachableWriter("stdout", r.s.Out, r.failure)
+			_, err := io.Copy(&countingWriter{w: stdout, n: &r.counters.stdout}, r.pty)
 			if err != nil {
 				logrus.Errorf("error copying pty to stdout: %s", err)
 			}
@@ -275,6 +403,12 @@ func (r *TtyRelay) Start() {
 	}
 }
 
+// BytesRelayed returns the number of bytes the relay has copied so far for
+// each stream.
+func (r *TtyRelay) BytesRelayed() RelayCounts {
+	return r.counters.counts()
+}
+
 // Wait waits for the relaying to finish and closes the associated
 // files and connections.
 func (r *TtyRelay) Wait() {
@@ -283,13 +417,13 @@ func (r *TtyRelay) Wait() {
 	// exit back to the client, and the client expects the process notification before
 	// it will close its side of stdin (which io.Copy is waiting on in the copying goroutine).
 	if r.s.In != nil {
-		if err := r.s.In.CloseRead(); err != nil {
+		if err := r.s.In.CloseRead(); err != nil && !r.failure.hostGone("stdin", err) {
 			logrus.Errorf("error closing read for stdin: %s", err)
 		}
 	}
 
 	// Wait for all users of stdioSet and master to finish before closing them.
-	r.wg.Wait()
+	drain(&r.wg, r.pty)
 
 	r.m.Lock()
 	defer r.m.Unlock()
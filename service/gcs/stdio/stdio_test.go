@@ -0,0 +1,211 @@
+package stdio
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func Test_PipeRelay_StdoutOnly(t *testing.T) {
+	logrus.SetOutput(ioutil.Discard)
+
+	out, host := dialPair(t)
+	defer host.Close()
+	pr, err := (&ConnectionSet{Out: out}).NewPipeRelay()
+	if err != nil {
+		t.Fatalf("failed to create pipe relay: %s", err)
+	}
+	files, _ := pr.Files()
+	if files.In != nil || files.Err != nil {
+		t.Fatal("relay should only have a stdout file")
+	}
+	pr.Start()
+
+	files.Out.Write([]byte("out"))
+	if s := readString(t, host, len("out")); s != "out" {
+		t.Fatalf("stdout connection received %q", s)
+	}
+	files.Out.Close()
+	pr.Wait()
+}
+
+func Test_PipeRelay_StderrOnly(t *testing.T) {
+	logrus.SetOutput(ioutil.Discard)
+
+	errConn, host := dialPair(t)
+	defer host.Close()
+	pr, err := (&ConnectionSet{Err: errConn}).NewPipeRelay()
+	if err != nil {
+		t.Fatalf("failed to create pipe relay: %s", err)
+	}
+	files, _ := pr.Files()
+	if files.In != nil || files.Out != nil {
+		t.Fatal("relay should only have a stderr file")
+	}
+	pr.Start()
+
+	files.Err.Write([]byte("err"))
+	if s := readString(t, host, len("err")); s != "err" {
+		t.Fatalf("stderr connection received %q", s)
+	}
+	files.Err.Close()
+	pr.Wait()
+}
+
+func Test_PipeRelay_StdinAndStdout(t *testing.T) {
+	logrus.SetOutput(ioutil.Discard)
+
+	in, inHost := dialPair(t)
+	defer inHost.Close()
+	out, outHost := dialPair(t)
+	defer outHost.Close()
+	pr, err := (&ConnectionSet{In: in, Out: out}).NewPipeRelay()
+	if err != nil {
+		t.Fatalf("failed to create pipe relay: %s", err)
+	}
+	files, _ := pr.Files()
+	if files.In == nil || files.Out == nil || files.Err != nil {
+		t.Fatal("relay should have stdin and stdout files but no stderr file")
+	}
+	pr.Start()
+
+	inHost.Write([]byte("in"))
+	if s := readString(t, files.In, len("in")); s != "in" {
+		t.Fatalf("stdin pipe received %q", s)
+	}
+	files.Out.Write([]byte("out"))
+	if s := readString(t, outHost, len("out")); s != "out" {
+		t.Fatalf("stdout connection received %q", s)
+	}
+	files.Out.Close()
+	pr.Wait()
+}
+
+func Test_PipeRelay_BytesRelayed(t *testing.T) {
+	logrus.SetOutput(ioutil.Discard)
+
+	in, inHost := dialPair(t)
+	defer inHost.Close()
+	out, outHost := dialPair(t)
+	defer outHost.Close()
+	errConn, errHost := dialPair(t)
+	defer errHost.Close()
+	pr, err := (&ConnectionSet{In: in, Out: out, Err: errConn}).NewPipeRelay()
+	if err != nil {
+		t.Fatalf("failed to create pipe relay: %s", err)
+	}
+	files, _ := pr.Files()
+	pr.Start()
+
+	inHost.Write([]byte("input"))
+	readString(t, files.In, len("input"))
+	files.Out.Write([]byte("output!"))
+	readString(t, outHost, len("output!"))
+	files.Err.Write([]byte("e"))
+	readString(t, errHost, len("e"))
+
+	expected := RelayCounts{Stdin: 5, Stdout: 7, Stderr: 1}
+	if counts := pr.BytesRelayed(); counts != expected {
+		t.Fatalf("relay reported %+v bytes relayed, expected %+v", counts, expected)
+	}
+	files.Out.Close()
+	files.Err.Close()
+	pr.Wait()
+}
+
+func Test_PipeRelay_Wait_RelaysOutputWrittenBeforeExit(t *testing.T) {
+	logrus.SetOutput(ioutil.Discard)
+
+	out, host := dialPair(t)
+	defer host.Close()
+	pr, err := (&ConnectionSet{Out: out}).NewPipeRelay()
+	if err != nil {
+		t.Fatalf("failed to create pipe relay: %s", err)
+	}
+	files, _ := pr.Files()
+	pr.Start()
+	// Write more than the pipe buffers hold, so that most of the output is
+	// still to be relayed when the process exits.
+	output := bytes.Repeat([]byte("0123456789abcdef"), 32*1024)
+	received := make(chan []byte, 1)
+	go func() {
+		b := make([]byte, len(output))
+		n, _ := io.ReadFull(host, b)
+		received <- b[:n]
+	}()
+	if _, err := files.Out.Write(output); err != nil {
+		t.Fatalf("failed to write output: %s", err)
+	}
+	files.Out.Close()
+	pr.Wait()
+
+	select {
+	case b := <-received:
+		if !bytes.Equal(b, output) {
+			t.Fatalf("stdout connection received %d of %d bytes", len(b), len(output))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the output was not relayed")
+	}
+}
+
+func Test_PipeRelay_Wait_OutputHeldOpen_StopsAfterDrainTimeout(t *testing.T) {
+	logrus.SetOutput(ioutil.Discard)
+	defer func(timeout time.Duration) { RelayDrainTimeout = timeout }(RelayDrainTimeout)
+	RelayDrainTimeout = 10 * time.Millisecond
+
+	out, host := dialPair(t)
+	defer host.Close()
+	pr, err := (&ConnectionSet{Out: out}).NewPipeRelay()
+	if err != nil {
+		t.Fatalf("failed to create pipe relay: %s", err)
+	}
+	files, _ := pr.Files()
+	pr.Start()
+
+	// The write end of the pipe stays open, as it would if a descendant of
+	// the process had inherited it.
+	files.Out.Write([]byte("tail"))
+	if s := readString(t, host, len("tail")); s != "tail" {
+		t.Fatalf("stdout connection received %q", s)
+	}
+	waited := make(chan struct{})
+	go func() {
+		pr.Wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiting for the relay blocked while its output was held open")
+	}
+}
+
+func Test_TtyRelay_WriteStdin_ReachesConsole(t *testing.T) {
+	master, slave := newTestConsole(t)
+	defer slave.Close()
+
+	relay := (&ConnectionSet{}).NewTtyRelay(master)
+	relay.Start()
+	n, err := relay.WriteStdin([]byte("answer\n"))
+	if err != nil || n != len("answer\n") {
+		t.Fatalf("failed to write stdin: wrote %d bytes: %v", n, err)
+	}
+	buf := make([]byte, len("answer\n"))
+	if _, err := io.ReadFull(slave, buf); err != nil {
+		t.Fatalf("failed to read stdin from console: %s", err)
+	}
+	if string(buf) != "answer\n" {
+		t.Fatalf("console received %q", buf)
+	}
+	relay.Wait()
+
+	if _, err := relay.WriteStdin([]byte("late")); errors.Cause(err) != ErrNoStdin {
+		t.Fatalf("expected ErrNoStdin after the relay finished, got %v", err)
+	}
+}
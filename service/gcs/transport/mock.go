@@ -3,6 +3,7 @@ package transport
 import (
 	"net"
 	"os"
+	"sync"
 	"syscall"
 
 	"github.com/pkg/errors"
@@ -13,10 +14,16 @@ type MockTransport struct {
 	// Channel sends connections to the "server" once the "client" has
 	// connected.
 	Channel chan *MockConnection
+
+	mu        sync.Mutex
+	listeners map[uint32]*mockListener
+	nextPort  uint32
 }
 
-// Dial ignores the port, and returns a MockTransport struct.
-func (t *MockTransport) Dial(_ uint32) (_ Connection, err error) {
+// Dial returns a MockConnection struct. If a listener returned by Listen is
+// on the port, the other end of the connection is accepted by the listener;
+// otherwise the port is ignored.
+func (t *MockTransport) Dial(port uint32) (_ Connection, err error) {
 	var fds [2]int
 	var serverFile *os.File
 	var clientFile *os.File
@@ -56,7 +63,16 @@ func (t *MockTransport) Dial(_ uint32) (_ Connection, err error) {
 		return nil, errors.New("client connection was not a unix socket")
 	}
 
-	if t.Channel != nil {
+	t.mu.Lock()
+	listener := t.listeners[port]
+	t.mu.Unlock()
+	if listener != nil {
+		select {
+		case listener.conns <- &MockConnection{UnixConn: serverUnixConn}:
+		case <-listener.closed:
+			return nil, errors.Errorf("listener on port %d was closed", port)
+		}
+	} else if t.Channel != nil {
 		t.Channel <- &MockConnection{
 			UnixConn: serverUnixConn,
 		}
@@ -73,3 +89,65 @@ func (t *MockTransport) Dial(_ uint32) (_ Connection, err error) {
 type MockConnection struct {
 	*net.UnixConn
 }
+
+// Listen returns a listener which accepts the connections dialed to port
+// through t. If port is AnyPort, the next port of DefaultListenPorts is used.
+func (t *MockTransport) Listen(port uint32) (Listener, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.listeners == nil {
+		t.listeners = make(map[uint32]*mockListener)
+	}
+	if port == AnyPort {
+		port = DefaultListenPorts.First + t.nextPort
+		t.nextPort++
+	}
+	if _, ok := t.listeners[port]; ok {
+		return nil, errors.Errorf("port %d is already being listened on", port)
+	}
+	l := &mockListener{
+		transport: t,
+		port:      port,
+		conns:     make(chan *MockConnection),
+		closed:    make(chan struct{}),
+	}
+	t.listeners[port] = l
+	return l, nil
+}
+
+// mockListener is a mock implementation of Listener.
+type mockListener struct {
+	transport *MockTransport
+	port      uint32
+	conns     chan *MockConnection
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// Accept returns the server end of the next connection dialed to the
+// listener's port.
+func (l *mockListener) Accept() (Connection, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, errors.Errorf("listener on port %d was closed", l.port)
+	}
+}
+
+// Close stops the listener from accepting connections, causing any blocked
+// Accept to return.
+func (l *mockListener) Close() error {
+	l.closeOnce.Do(func() {
+		l.transport.mu.Lock()
+		delete(l.transport.listeners, l.port)
+		l.transport.mu.Unlock()
+		close(l.closed)
+	})
+	return nil
+}
+
+// Port returns the port the listener is listening on.
+func (l *mockListener) Port() uint32 {
+	return l.port
+}
@@ -0,0 +1,124 @@
+package transport
+
+import (
+	"io"
+	"testing"
+)
+
+// acceptAsync accepts a connection on l in the background, returning a
+// channel which receives it, or nil if Accept failed.
+func acceptAsync(t *testing.T, l Listener) <-chan Connection {
+	accepted := make(chan Connection, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			t.Errorf("Accept failed: %s", err)
+		}
+		accepted <- conn
+	}()
+	return accepted
+}
+
+func Test_MockTransport_Listen_AcceptsMatchingDial(t *testing.T) {
+	const port = 5000
+	tport := &MockTransport{}
+	l, err := tport.Listen(port)
+	if err != nil {
+		t.Fatalf("Listen failed: %s", err)
+	}
+	defer l.Close()
+	if l.Port() != port {
+		t.Fatalf("listener is on port %d, expected %d", l.Port(), port)
+	}
+
+	accepted := acceptAsync(t, l)
+	client, err := tport.Dial(port)
+	if err != nil {
+		t.Fatalf("Dial failed: %s", err)
+	}
+	defer client.Close()
+	server := <-accepted
+	if server == nil {
+		t.FailNow()
+	}
+	defer server.Close()
+
+	if _, err := client.Write([]byte("ping")); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(server, buf); err != nil {
+		t.Fatalf("Read failed: %s", err)
+	}
+	if string(buf) != "ping" {
+		t.Fatalf("server read %q, expected %q", buf, "ping")
+	}
+}
+
+func Test_MockTransport_Listen_IgnoresOtherPorts(t *testing.T) {
+	channel := make(chan *MockConnection, 1)
+	tport := &MockTransport{Channel: channel}
+	l, err := tport.Listen(5000)
+	if err != nil {
+		t.Fatalf("Listen failed: %s", err)
+	}
+	defer l.Close()
+
+	client, err := tport.Dial(5001)
+	if err != nil {
+		t.Fatalf("Dial failed: %s", err)
+	}
+	defer client.Close()
+	select {
+	case server := <-channel:
+		server.Close()
+	default:
+		t.Fatal("dial to a port without a listener was not sent to Channel")
+	}
+}
+
+func Test_MockTransport_Listen_AnyPort(t *testing.T) {
+	tport := &MockTransport{}
+	first, err := tport.Listen(AnyPort)
+	if err != nil {
+		t.Fatalf("Listen failed: %s", err)
+	}
+	defer first.Close()
+	second, err := tport.Listen(AnyPort)
+	if err != nil {
+		t.Fatalf("Listen failed: %s", err)
+	}
+	defer second.Close()
+	if first.Port() == AnyPort || first.Port() == second.Port() {
+		t.Fatalf("listeners were allocated ports %d and %d", first.Port(), second.Port())
+	}
+}
+
+func Test_MockTransport_Listen_PortInUse_Failure(t *testing.T) {
+	tport := &MockTransport{}
+	l, err := tport.Listen(5000)
+	if err != nil {
+		t.Fatalf("Listen failed: %s", err)
+	}
+	defer l.Close()
+	if _, err := tport.Listen(5000); err == nil {
+		t.Fatal("second Listen on the same port should have failed")
+	}
+}
+
+func Test_MockTransport_Close_UnblocksAccept(t *testing.T) {
+	tport := &MockTransport{}
+	l, err := tport.Listen(5000)
+	if err != nil {
+		t.Fatalf("Listen failed: %s", err)
+	}
+	result := make(chan error, 1)
+	go func() {
+		_, err := l.Accept()
+		result <- err
+	}()
+	l.Close()
+	if err := <-result; err == nil {
+		t.Fatal("Accept on a closed listener should have failed")
+	}
+}
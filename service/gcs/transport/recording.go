@@ -0,0 +1,49 @@
+package transport
+
+import (
+	"sync"
+	"time"
+)
+
+// Dial describes a single call to Dial made through a RecordingTransport.
+type Dial struct {
+	Port uint32
+	Time time.Time
+}
+
+// RecordingTransport is a Transport which records the ports dialed through
+// it, in order, before delegating the dials to the wrapped Transport. It is
+// intended for use in tests.
+type RecordingTransport struct {
+	Transport
+
+	mu    sync.Mutex
+	dials []Dial
+}
+
+// Dial records the port and delegates to the wrapped Transport.
+func (t *RecordingTransport) Dial(port uint32) (Connection, error) {
+	t.mu.Lock()
+	t.dials = append(t.dials, Dial{Port: port, Time: time.Now()})
+	t.mu.Unlock()
+	return t.Transport.Dial(port)
+}
+
+// Dials returns the dials made through t so far, in the order they were made.
+func (t *RecordingTransport) Dials() []Dial {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Dial(nil), t.dials...)
+}
+
+// Ports returns the ports dialed through t so far, in the order they were
+// dialed.
+func (t *RecordingTransport) Ports() []uint32 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ports := make([]uint32, len(t.dials))
+	for i, d := range t.dials {
+		ports[i] = d.Port
+	}
+	return ports
+}
@@ -3,6 +3,7 @@
 package transport
 
 import (
+	"fmt"
 	"io"
 	"os"
 )
@@ -16,6 +17,44 @@ import (
 type Transport interface {
 	// Dial takes a port number and returns a connected connection.
 	Dial(port uint32) (Connection, error)
+	// Listen takes a port number and returns a listener for connections from
+	// the host to it. If the port is AnyPort, the transport allocates a free
+	// port, which the listener's Port reports.
+	Listen(port uint32) (Listener, error)
+}
+
+// AnyPort may be passed to Transport.Listen to listen on a port allocated by
+// the transport.
+const AnyPort = 0xffffffff
+
+// Listener is the interface defining a listener for connections from the
+// host, such as a listening socket or a mocked implementation.
+type Listener interface {
+	// Accept waits for and returns the next connection to the listener.
+	Accept() (Connection, error)
+	// Close stops listening, releasing the listener's port.
+	Close() error
+	// Port returns the port the listener is listening on, for the host to
+	// connect to.
+	Port() uint32
+}
+
+// PortRange is an inclusive range of ports.
+type PortRange struct {
+	First uint32
+	Last  uint32
+}
+
+// size returns the number of ports in r.
+func (r PortRange) size() uint64 {
+	if r.Last < r.First {
+		return 0
+	}
+	return uint64(r.Last-r.First) + 1
+}
+
+func (r PortRange) String() string {
+	return fmt.Sprintf("%d-%d", r.First, r.Last)
 }
 
 // Connection is the interface defining a data connection, such as a socket or
@@ -2,12 +2,15 @@ package transport
 
 import (
 	"fmt"
+	"os"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/linuxkit/virtsock/pkg/vsock"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
 )
 
 const (
@@ -15,12 +18,76 @@ const (
 	vmaddrCidAny  = 0xffffffff
 )
 
+// DefaultListenPorts is the range of ports a VsockTransport allocates
+// listening ports from if its ListenPorts is not set.
+var DefaultListenPorts = PortRange{First: 0x40000000, Last: 0x40000fff}
+
 // VsockTransport is an implementation of Transport which uses vsock
 // sockets.
-type VsockTransport struct{}
+type VsockTransport struct {
+	// ListenPorts is the range of ports Listen allocates from. If it is
+	// unset, DefaultListenPorts is used.
+	ListenPorts PortRange
+	// ReceiveBufferSize and SendBufferSize, if positive, are the sizes in
+	// bytes set with SO_RCVBUF and SO_SNDBUF on each connection dialed or
+	// accepted through the transport. Otherwise the kernel defaults are used.
+	ReceiveBufferSize int
+	SendBufferSize    int
+
+	mu sync.Mutex
+	// next is the offset into the port range of the next port to try, so
+	// that a port is not reused until the rest of the range has been tried.
+	next uint64
+}
 
 var _ Transport = &VsockTransport{}
 
+// setsockoptInt and getsockoptInt are replaced in tests.
+var (
+	setsockoptInt = unix.SetsockoptInt
+	getsockoptInt = unix.GetsockoptInt
+)
+
+// setBufferSizes sets the configured receive and send buffer sizes on the
+// socket fd, logging the sizes the kernel settled on.
+func (t *VsockTransport) setBufferSizes(fd int) error {
+	options := []struct {
+		name string
+		opt  int
+		size int
+	}{
+		{"SO_RCVBUF", unix.SO_RCVBUF, t.ReceiveBufferSize},
+		{"SO_SNDBUF", unix.SO_SNDBUF, t.SendBufferSize},
+	}
+	for _, option := range options {
+		if option.size <= 0 {
+			continue
+		}
+		if err := setsockoptInt(fd, unix.SOL_SOCKET, option.opt, option.size); err != nil {
+			return errors.Wrapf(err, "failed to set %s to %d", option.name, option.size)
+		}
+		effective, err := getsockoptInt(fd, unix.SOL_SOCKET, option.opt)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get %s", option.name)
+		}
+		logrus.Debugf("vsock %s set to %d, effective size %d", option.name, option.size, effective)
+	}
+	return nil
+}
+
+// setConnBufferSizes sets the configured buffer sizes on the socket of conn.
+func (t *VsockTransport) setConnBufferSizes(conn Connection) error {
+	if t.ReceiveBufferSize <= 0 && t.SendBufferSize <= 0 {
+		return nil
+	}
+	f, err := conn.File()
+	if err != nil {
+		return errors.Wrap(err, "failed to get the file of vsock connection")
+	}
+	defer f.Close()
+	return t.setBufferSizes(int(f.Fd()))
+}
+
 // Dial accepts a vsock socket port number as configuration, and
 // returns an unconnected VsockConnection struct.
 func (t *VsockTransport) Dial(port uint32) (Connection, error) {
@@ -32,6 +99,10 @@ func (t *VsockTransport) Dial(port uint32) (Connection, error) {
 		conn, err := vsock.Dial(vmaddrCidHost, port)
 		if err == nil {
 			logrus.Infof("vsock Connect port (%d)", port)
+			if err := t.setConnBufferSizes(conn); err != nil {
+				conn.Close()
+				return nil, errors.Wrapf(err, "vsock Dial port (%d) failed", port)
+			}
 			return conn, nil
 		}
 		// If the error was ETIMEDOUT retry, otherwise fail.
@@ -46,3 +117,174 @@ func (t *VsockTransport) Dial(port uint32) (Connection, error) {
 	}
 	return nil, fmt.Errorf("failed connecting the VsockConnection: can't connect after 10 attempts")
 }
+
+// Listen binds a vsock socket to port and listens on it for connections from
+// any CID. If port is AnyPort, the next free port in the transport's port
+// range is used instead, trying each port in the range at most once and
+// skipping ports which another socket is bound to.
+func (t *VsockTransport) Listen(port uint32) (Listener, error) {
+	if port != AnyPort {
+		l, err := t.listen(port)
+		if err != nil {
+			return nil, errors.Wrapf(err, "vsock Listen port (%d) failed", port)
+		}
+		logrus.Infof("vsock Listen port (%d)", port)
+		return l, nil
+	}
+
+	ports := t.ListenPorts
+	if ports == (PortRange{}) {
+		ports = DefaultListenPorts
+	}
+	size := ports.size()
+	if size == 0 {
+		return nil, errors.Errorf("vsock listen port range %s is empty", ports)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := uint64(0); i < size; i++ {
+		port := ports.First + uint32(t.next%size)
+		t.next++
+		l, err := t.listen(port)
+		if err == nil {
+			logrus.Infof("vsock Listen port (%d)", port)
+			return l, nil
+		}
+		if errors.Cause(err) != unix.EADDRINUSE {
+			return nil, errors.Wrapf(err, "vsock Listen port (%d) failed", port)
+		}
+	}
+	return nil, errors.Errorf("no port in vsock listen port range %s is free", ports)
+}
+
+// listen creates a vsock socket listening on port for connections from any
+// CID. The socket is non-blocking and wrapped in an os.File, so that Accept
+// waits in the runtime poller and is woken by Close.
+func (t *VsockTransport) listen(port uint32) (_ *vsockListener, err error) {
+	fd, err := unix.Socket(unix.AF_VSOCK, unix.SOCK_STREAM|unix.SOCK_CLOEXEC|unix.SOCK_NONBLOCK, 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create vsock socket")
+	}
+	defer func() {
+		if err != nil {
+			unix.Close(fd)
+		}
+	}()
+	if err = unix.Bind(fd, &unix.SockaddrVM{CID: vmaddrCidAny, Port: port}); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err = unix.Listen(fd, unix.SOMAXCONN); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	f := os.NewFile(uintptr(fd), fmt.Sprintf("vsock-listener:%d", port))
+	return &vsockListener{transport: t, f: f, port: port}, nil
+}
+
+// vsockListener is an implementation of Listener for a listening vsock
+// socket.
+type vsockListener struct {
+	transport *VsockTransport
+	f         *os.File
+	port      uint32
+}
+
+// Accept waits for and returns the next connection to the socket. It fails
+// once the listener has been closed.
+func (l *vsockListener) Accept() (Connection, error) {
+	rc, err := l.f.SyscallConn()
+	if err != nil {
+		return nil, errors.Wrapf(err, "vsock Accept port (%d) failed", l.port)
+	}
+	var fd int
+	var acceptErr error
+	err = rc.Read(func(s uintptr) bool {
+		// Accepted connections are blocking, since their files are passed
+		// on to processes as their stdio.
+		fd, _, acceptErr = unix.Accept4(int(s), unix.SOCK_CLOEXEC)
+		return acceptErr != unix.EAGAIN && acceptErr != unix.EINTR
+	})
+	if err == nil {
+		err = acceptErr
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "vsock Accept port (%d) failed", l.port)
+	}
+	logrus.Infof("vsock Accept port (%d)", l.port)
+	if err := l.transport.setBufferSizes(fd); err != nil {
+		unix.Close(fd)
+		return nil, errors.Wrapf(err, "vsock Accept port (%d) failed", l.port)
+	}
+	return &vsockConnection{f: os.NewFile(uintptr(fd), fmt.Sprintf("vsock:%d", fd))}, nil
+}
+
+// Close closes the socket, causing any blocked Accept to return an error.
+func (l *vsockListener) Close() error {
+	return l.f.Close()
+}
+
+// Port returns the port the socket is bound to.
+func (l *vsockListener) Port() uint32 {
+	return l.port
+}
+
+// vsockConnection is an implementation of Connection for a vsock socket
+// accepted by a vsockListener. The socket is only used through f, so that it
+// is never used after f has been closed.
+type vsockConnection struct {
+	f *os.File
+}
+
+func (c *vsockConnection) Read(p []byte) (int, error) {
+	return c.f.Read(p)
+}
+
+func (c *vsockConnection) Write(p []byte) (int, error) {
+	return c.f.Write(p)
+}
+
+func (c *vsockConnection) Close() error {
+	return c.f.Close()
+}
+
+// control calls fn with the connection's file descriptor, failing if the
+// connection has been closed.
+func (c *vsockConnection) control(fn func(fd int) error) error {
+	rc, err := c.f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var fnErr error
+	if err := rc.Control(func(fd uintptr) { fnErr = fn(int(fd)) }); err != nil {
+		return err
+	}
+	return fnErr
+}
+
+// CloseRead shuts down the reading side of the connection.
+func (c *vsockConnection) CloseRead() error {
+	return c.control(func(fd int) error { return unix.Shutdown(fd, unix.SHUT_RD) })
+}
+
+// CloseWrite shuts down the writing side of the connection.
+func (c *vsockConnection) CloseWrite() error {
+	return c.control(func(fd int) error { return unix.Shutdown(fd, unix.SHUT_WR) })
+}
+
+// File returns a duplicate of the connection's file.
+func (c *vsockConnection) File() (*os.File, error) {
+	var dup uintptr
+	err := c.control(func(fd int) error {
+		// This is equivalent to dup(2) but creates the new fd with CLOEXEC already set.
+		r0, _, errno := syscall.Syscall(syscall.SYS_FCNTL, uintptr(fd), syscall.F_DUPFD_CLOEXEC, 0)
+		if errno != 0 {
+			return os.NewSyscallError("fcntl", errno)
+		}
+		dup = r0
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to duplicate vsock connection")
+	}
+	return os.NewFile(dup, c.f.Name()), nil
+}
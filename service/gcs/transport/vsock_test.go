@@ -0,0 +1,118 @@
+package transport
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+type sockopt struct {
+	fd    int
+	level int
+	opt   int
+	value int
+}
+
+// recordSockopts replaces setsockoptInt and getsockoptInt until the returned
+// function is called, recording the options set and failing to set any option
+// in fail.
+func recordSockopts(fail map[int]bool) (*[]sockopt, func()) {
+	var set []sockopt
+	values := make(map[int]int)
+	oldSet, oldGet := setsockoptInt, getsockoptInt
+	setsockoptInt = func(fd, level, opt, value int) error {
+		if fail[opt] {
+			return errors.New("setsockopt failed")
+		}
+		set = append(set, sockopt{fd: fd, level: level, opt: opt, value: value})
+		values[opt] = value * 2
+		return nil
+	}
+	getsockoptInt = func(fd, level, opt int) (int, error) {
+		return values[opt], nil
+	}
+	return &set, func() {
+		setsockoptInt, getsockoptInt = oldSet, oldGet
+	}
+}
+
+func Test_VsockTransport_SetBufferSizes(t *testing.T) {
+	set, restore := recordSockopts(nil)
+	defer restore()
+	tport := &VsockTransport{ReceiveBufferSize: 1 << 20, SendBufferSize: 1 << 19}
+	if err := tport.setBufferSizes(42); err != nil {
+		t.Fatalf("setBufferSizes failed: %s", err)
+	}
+	expected := []sockopt{
+		{fd: 42, level: unix.SOL_SOCKET, opt: unix.SO_RCVBUF, value: 1 << 20},
+		{fd: 42, level: unix.SOL_SOCKET, opt: unix.SO_SNDBUF, value: 1 << 19},
+	}
+	if !reflect.DeepEqual(*set, expected) {
+		t.Fatalf("set socket options %+v, expected %+v", *set, expected)
+	}
+}
+
+func Test_VsockTransport_SetBufferSizes_OnlyConfigured(t *testing.T) {
+	set, restore := recordSockopts(nil)
+	defer restore()
+	tport := &VsockTransport{SendBufferSize: 4096}
+	if err := tport.setBufferSizes(42); err != nil {
+		t.Fatalf("setBufferSizes failed: %s", err)
+	}
+	expected := []sockopt{
+		{fd: 42, level: unix.SOL_SOCKET, opt: unix.SO_SNDBUF, value: 4096},
+	}
+	if !reflect.DeepEqual(*set, expected) {
+		t.Fatalf("set socket options %+v, expected %+v", *set, expected)
+	}
+}
+
+func Test_VsockTransport_SetBufferSizes_Defaults(t *testing.T) {
+	set, restore := recordSockopts(nil)
+	defer restore()
+	tport := &VsockTransport{}
+	if err := tport.setBufferSizes(42); err != nil {
+		t.Fatalf("setBufferSizes failed: %s", err)
+	}
+	if len(*set) != 0 {
+		t.Fatalf("set socket options %+v with no sizes configured", *set)
+	}
+}
+
+func Test_VsockTransport_SetBufferSizes_Failure(t *testing.T) {
+	_, restore := recordSockopts(map[int]bool{unix.SO_RCVBUF: true})
+	defer restore()
+	tport := &VsockTransport{ReceiveBufferSize: 4096}
+	if err := tport.setBufferSizes(42); err == nil {
+		t.Fatal("setBufferSizes should have failed")
+	}
+}
+
+func Test_VsockListener_Close_UnblocksAccept(t *testing.T) {
+	tport := &VsockTransport{}
+	l, err := tport.Listen(AnyPort)
+	if err != nil {
+		t.Skipf("vsock is not supported: %s", err)
+	}
+	result := make(chan error, 1)
+	go func() {
+		_, err := l.Accept()
+		result <- err
+	}()
+	// Give Accept time to block before closing.
+	time.Sleep(50 * time.Millisecond)
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close failed: %s", err)
+	}
+	select {
+	case err := <-result:
+		if err == nil {
+			t.Fatal("Accept on a closed listener should have failed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not unblock Accept")
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+// This utility is a minimal init process for containers whose own init does
+// not reap orphaned processes. The GCS bind mounts it into such containers and
+// runs it as the container's init process, with the real command as its
+// arguments. It forwards the signals it receives to the command, and reaps
+// every child it inherits. It exits with the command's exit status once the
+// command exits, which ends the container.
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+)
+
+func gcsinitMain() {
+	os.Exit(gcsinit(os.Args[1:]))
+}
+
+func gcsinit(args []string) int {
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "gcsinit: no command given")
+		return 127
+	}
+
+	// Start receiving signals before the command is started, so that none
+	// are lost.
+	signals := make(chan os.Signal, 32)
+	signal.Notify(signals)
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "gcsinit: failed to start %s: %s\n", args[0], err)
+		return 127
+	}
+	pid := cmd.Process.Pid
+
+	go func() {
+		for sig := range signals {
+			s, ok := sig.(syscall.Signal)
+			// SIGCHLD is handled by reaping, and SIGURG is used internally
+			// by the Go runtime.
+			if !ok || s == syscall.SIGCHLD || s == syscall.SIGURG {
+				continue
+			}
+			syscall.Kill(pid, s)
+		}
+	}()
+
+	// cmd.Wait is not used, since it would race with reaping the other
+	// children.
+	for {
+		var status syscall.WaitStatus
+		reaped, err := syscall.Wait4(-1, &status, 0, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "gcsinit: failed to wait for children: %s\n", err)
+			return 1
+		}
+		if reaped != pid {
+			continue
+		}
+		if status.Signaled() {
+			return 128 + int(status.Signal())
+		}
+		return status.ExitStatus()
+	}
+}
@@ -12,6 +12,7 @@ var commands = map[string]func(){
 	"exportSandbox": exportSandboxMain,
 	"netnscfg":      netnsConfigMain,
 	"remotefs":      remotefsMain,
+	"gcsinit":       gcsinitMain,
 }
 
 func main() {
@@ -98,6 +98,20 @@ func netnsConfig() error {
 		return fmt.Errorf("netlink.LinkByName(%s) failed: %v", *ifStr, err)
 	}
 
+	// Rename the interface if requested. This must be done while it is down.
+	ifName := *ifStr
+	if a.Name != "" && a.Name != ifName {
+		if err := netlink.LinkSetName(link, a.Name); err != nil {
+			return fmt.Errorf("netlink.LinkSetName(%#v, %s) failed: %v", link, a.Name, err)
+		}
+		ifName = a.Name
+		log.Infof("Renamed %s to %s", *ifStr, ifName)
+		link, err = netlink.LinkByName(ifName)
+		if err != nil {
+			return fmt.Errorf("netlink.LinkByName(%s) failed: %v", ifName, err)
+		}
+	}
+
 	// User requested non-default MTU size
 	if a.EncapOverhead != 0 {
 		mtu := link.Attrs().MTU - int(a.EncapOverhead)
@@ -106,6 +120,10 @@ func netnsConfig() error {
 		}
 	}
 
+	// Routes for the adapter go in its own table if it has one. Table 0
+	// means the main table.
+	table := int(a.RoutingTableID)
+
 	// Configure the interface
 	if a.NatEnabled {
 		metric := 1
@@ -126,6 +144,20 @@ func netnsConfig() error {
 		if err := netlink.AddrAdd(link, ipAddr); err != nil {
 			return fmt.Errorf("netlink.AddrAdd(%#v, %#v) failed: %v", link, ipAddr, err)
 		}
+		// The kernel only adds the route to the adapter's subnet to the main
+		// table, so add it to the adapter's own table too.
+		if table != 0 {
+			route := netlink.Route{
+				Scope:     netlink.SCOPE_LINK,
+				LinkIndex: link.Attrs().Index,
+				Dst:       &net.IPNet{IP: addr.IP.Mask(addr.Mask), Mask: addr.Mask},
+				Src:       addr.IP,
+				Table:     table,
+			}
+			if err := netlink.RouteAdd(&route); err != nil {
+				return fmt.Errorf("netlink.RouteAdd(%#v) failed: %v", route, err)
+			}
+		}
 		// Set gateway
 		if a.HostIPAddress != "" {
 			gw := net.ParseIP(a.HostIPAddress)
@@ -134,6 +166,7 @@ func netnsConfig() error {
 				LinkIndex: link.Attrs().Index,
 				Gw:        gw,
 				Priority:  metric, // This is what ip route add does
+				Table:     table,
 			}
 			if err := netlink.RouteAdd(&route); err != nil {
 				return fmt.Errorf("netlink.RouteAdd(%#v) failed: %v", route, err)
@@ -143,13 +176,52 @@ func netnsConfig() error {
 		err := exec.Command(
 			"udhcpc",
 			"-q",
-			"-i", *ifStr,
+			"-i", ifName,
 			"-s", "/sbin/udhcpc_config.script").Run()
 		if err != nil {
 			return fmt.Errorf("udhcpc failed: %v", err)
 		}
 	}
 
+	// Add any static routes now that the interface is up
+	for _, r := range a.Routes {
+		_, dst, err := net.ParseCIDR(r.Destination)
+		if err != nil {
+			return fmt.Errorf("invalid route destination %s: %v", r.Destination, err)
+		}
+		route := netlink.Route{
+			Scope:     netlink.SCOPE_UNIVERSE,
+			LinkIndex: link.Attrs().Index,
+			Dst:       dst,
+			Priority:  r.Metric,
+			Table:     table,
+		}
+		if r.Gateway != "" {
+			route.Gw = net.ParseIP(r.Gateway)
+		} else {
+			route.Scope = netlink.SCOPE_LINK
+		}
+		if err := netlink.RouteAdd(&route); err != nil {
+			return fmt.Errorf("netlink.RouteAdd(%#v) failed: %v", route, err)
+		}
+		log.Infof("Added route to %s via %s metric %d", r.Destination, r.Gateway, r.Metric)
+	}
+
+	// Direct traffic from the adapter's sources to its table
+	for _, source := range a.SourceBasedRules {
+		_, src, err := net.ParseCIDR(source)
+		if err != nil {
+			return fmt.Errorf("invalid source-based rule source %s: %v", source, err)
+		}
+		rule := netlink.NewRule()
+		rule.Src = src
+		rule.Table = table
+		if err := netlink.RuleAdd(rule); err != nil {
+			return fmt.Errorf("netlink.RuleAdd(%v) failed: %v", rule, err)
+		}
+		log.Infof("Added rule from %s lookup table %d", source, table)
+	}
+
 	// Add some debug logging
 	curNS, _ := netns.Get()
 	// Refresh link attributes/state